@@ -2,8 +2,12 @@ package main
 
 import (
     "os"
+    "strconv"
+    "strings"
+    "time"
 
     "etl-web3/internal/api"
+    "etl-web3/internal/version"
 
     "github.com/sirupsen/logrus"
 )
@@ -14,9 +18,75 @@ func main() {
         port = "8080"
     }
 
-    srv := api.NewServer()
-    logrus.Infof("API server listening on :%s", port)
+    opts := api.Options{
+        MaxBodyBytes:      envInt64("API_MAX_BODY_BYTES"),
+        ReadTimeout:       envDuration("API_READ_TIMEOUT"),
+        WriteTimeout:      envDuration("API_WRITE_TIMEOUT"),
+        IdleTimeout:       envDuration("API_IDLE_TIMEOUT"),
+        Tokens:            envList("API_TOKEN"),
+        MaxConcurrentJobs: int(envInt64("MAX_CONCURRENT_JOBS")),
+        TLSCertFile:       os.Getenv("TLS_CERT_FILE"),
+        TLSKeyFile:        os.Getenv("TLS_KEY_FILE"),
+        RedirectPort:      os.Getenv("API_HTTP_REDIRECT_PORT"),
+        FilesDir:          os.Getenv("API_FILES_DIR"),
+    }
+    if opts.RedirectPort != "" && opts.TLSCertFile == "" {
+        logrus.Warn("API_HTTP_REDIRECT_PORT is ignored without TLS_CERT_FILE/TLS_KEY_FILE")
+    }
+    if len(opts.Tokens) == 0 {
+        logrus.Warn("API_TOKEN is not set – the API accepts unauthenticated requests")
+    }
+
+    if path := os.Getenv("API_JOBS_FILE"); path != "" {
+        store, err := api.NewFileJobStore(path)
+        if err != nil {
+            logrus.Fatalf("failed to open job store: %v", err)
+        }
+        opts.Store = store
+    }
+
+    srv := api.NewServer(opts)
+    logrus.Infof("API server %s listening on :%s", version.Get(), port)
     if err := srv.Run(port); err != nil {
         logrus.Fatalf("server stopped with error: %v", err)
     }
+}
+
+// envInt64 reads an optional integer environment variable (0 when unset).
+func envInt64(name string) int64 {
+    v := os.Getenv(name)
+    if v == "" {
+        return 0
+    }
+    n, err := strconv.ParseInt(v, 10, 64)
+    if err != nil {
+        logrus.Fatalf("invalid %s: %v", name, err)
+    }
+    return n
+}
+
+// envList reads an optional comma-separated environment variable, skipping
+// empty entries.
+func envList(name string) []string {
+    var out []string
+    for _, v := range strings.Split(os.Getenv(name), ",") {
+        if v = strings.TrimSpace(v); v != "" {
+            out = append(out, v)
+        }
+    }
+    return out
+}
+
+// envDuration reads an optional duration environment variable such as "30s"
+// (0 when unset).
+func envDuration(name string) time.Duration {
+    v := os.Getenv(name)
+    if v == "" {
+        return 0
+    }
+    d, err := time.ParseDuration(v)
+    if err != nil {
+        logrus.Fatalf("invalid %s: %v", name, err)
+    }
+    return d
 } 
\ No newline at end of file
@@ -2,24 +2,54 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
 	"flag"
+	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"sync"
 	"syscall"
+	"time"
 
 	"etl-web3/internal/config"
 	"etl-web3/internal/indexer"
 	"etl-web3/internal/rpc"
 	"etl-web3/internal/sink"
+	"etl-web3/internal/version"
 
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
 )
 
 func main() {
+    if len(os.Args) > 1 && os.Args[1] == "version" {
+        fmt.Println(version.Get())
+        return
+    }
+
     configPath := flag.String("config", "config.yaml", "Path to configuration file")
+    printConfig := flag.Bool("print-config", false, "Print the effective configuration (defaults applied, secrets redacted) and exit")
+    validateABI := flag.Bool("validate-abi", false, "Check that every configured event exists in its contract's ABI (even with lenient_events) and exit")
+    estimate := flag.Bool("estimate", false, "Sample the configured range, print a projection of RPC calls and events, and exit without writing")
+    estimateSamples := flag.Int("estimate-samples", indexer.DefaultEstimateSamples, "Number of ranges sampled by --estimate")
+    discover := flag.String("discover", "", "List the contracts that emitted this event (signature or topic0) in the configured range, with log counts, as CSV and exit")
+    blockHash := flag.String("block-hash", "", "Reprocess only the block with this hash and exit")
+    statusFile := flag.String("status-file", "", "Periodically write JSON progress to this file (one file per chain in multi-chain mode)")
+    once := flag.Bool("once", false, "Catch up to the chain head at start and exit (default unless the config sets follow: true)")
+    follow := flag.Bool("follow", false, "Keep indexing new blocks after catching up (overrides follow in the config)")
+    resume := flag.Bool("resume", false, "Without a checkpoint, resume after the highest block already present in the output (CSV storage)")
+    progressInterval := flag.Duration("progress-interval", indexer.DefaultProgressLogInterval, "Log a progress summary (blocks/s, events/s, ETA) this often; per-range lines move to debug level (0 logs every range)")
     flag.Parse()
 
+    if *once && *follow {
+        log.Fatalf("--once and --follow are mutually exclusive")
+    }
+
     // Configure global logger (timestamped, info level by default).
     logrus.SetFormatter(&logrus.TextFormatter{FullTimestamp: true})
 
@@ -29,6 +59,50 @@ func main() {
         log.Fatalf("failed to load config: %v", err)
     }
 
+    switch {
+    case *once:
+        cfg.Follow = false
+    case *follow:
+        cfg.Follow = true
+    }
+
+    if *printConfig {
+        out, err := yaml.Marshal(cfg.Redacted())
+        if err != nil {
+            log.Fatalf("failed to encode config: %v", err)
+        }
+        fmt.Print(string(out))
+        return
+    }
+
+    if *validateABI {
+        if err := runValidateABI(cfg); err != nil {
+            log.Fatalf("ABI validation failed: %v", err)
+        }
+        return
+    }
+
+    if *estimate {
+        if err := runEstimate(cfg, *estimateSamples); err != nil {
+            log.Fatalf("estimate failed: %v", err)
+        }
+        return
+    }
+
+    if *discover != "" {
+        if err := runDiscover(cfg, *discover, os.Stdout); err != nil {
+            log.Fatalf("discovery failed: %v", err)
+        }
+        return
+    }
+
+    if *blockHash != "" {
+        if err := runBlockHash(cfg, *blockHash); err != nil {
+            log.Fatalf("block reprocessing failed: %v", err)
+        }
+        return
+    }
+
     // Prepare cancellable context that listens to OS signals (Ctrl+C).
     ctx, cancel := context.WithCancel(context.Background())
     defer cancel()
@@ -40,34 +114,263 @@ func main() {
         cancel()
     }()
 
+    // Run one indexer per configured chain. Each chain gets its own context
+    // derived from the root one so a failing chain doesn't stop the others,
+    // while Ctrl+C still shuts every chain down.
+    chains := cfg.ChainConfigs()
+    errs := make([]error, len(chains))
+    var wg sync.WaitGroup
+    for i, chainCfg := range chains {
+        wg.Add(1)
+        go func(i int, chainCfg *config.Config) {
+            defer wg.Done()
+            var status *indexer.StatusFile
+            if *statusFile != "" {
+                status = indexer.NewStatusFile(indexer.StatusFilePath(*statusFile, chainCfg.Chain, len(chains) > 1), chainCfg.Chain, indexer.DefaultStatusInterval)
+            }
+            errs[i] = runChain(ctx, chainCfg, status, *resume, *progressInterval)
+        }(i, chainCfg)
+    }
+    wg.Wait()
+
+    failed := false
+    for i, err := range errs {
+        if err != nil {
+            failed = true
+            logrus.Errorf("indexer for chain %q terminated with error: %v", chains[i].Chain, err)
+        }
+    }
+    if failed {
+        os.Exit(1)
+    }
+}
+
+// runChain dials the RPC endpoint, builds the sink and runs the indexer for a
+// single chain configuration. A non-nil status writer receives its progress;
+// resume continues after the last block of the existing output when no
+// checkpoint exists; progressInterval throttles the progress log lines.
+func runChain(parent context.Context, cfg *config.Config, status *indexer.StatusFile, resume bool, progressInterval time.Duration) (err error) {
+    if status != nil {
+        defer func() { status.Done(err) }()
+    }
+
+    ctx, cancel := context.WithCancel(parent)
+    defer cancel()
+
     // Initialise RPC client with retry logic.
-    client, err := rpc.Dial(ctx, cfg.RPCURL, cfg.Retry)
+    client, err := rpc.Dial(ctx, cfg.RPCURL, cfg.Retry, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent))
+    if err != nil {
+        return fmt.Errorf("failed to connect to RPC: %w", err)
+    }
+    client.WithCallTimeout(cfg.RPCTimeout())
+    // Follow mode subscribes through the WebSocket endpoint, if separate.
+    if cfg.Follow && cfg.RPCWSURL != "" {
+        if err := client.DialSubscriptions(ctx, cfg.RPCWSURL, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent)); err != nil {
+            client.Close()
+            return err
+        }
+    }
+
+    sk, err := sink.Build(cfg.Storage)
     if err != nil {
-        log.Fatalf("failed to connect to RPC: %v", err)
+        return err
     }
+    // Buffering sinks (Parquet, CSV with flush_rows) only produce complete
+    // files once closed. top is the outermost decorator built below; closing
+    // it closes the whole chain, dead-letter file included.
+    top := sk
+    defer func() {
+        if c, ok := top.(io.Closer); ok {
+            if cerr := c.Close(); cerr != nil && err == nil {
+                err = fmt.Errorf("failed to close sink: %w", cerr)
+            }
+        }
+    }()
 
-    // Build sink based on configuration.
-    var sk sink.Sink
-    switch cfg.Storage.Type {
-    case "csv":
-        s, err := sink.NewCSVSink(cfg.Storage.CSV.OutputDir)
-        if err != nil {
-            log.Fatalf("failed to initialise csv sink: %v", err)
+    var resumeAfter uint64
+    var hasResumeAfter bool
+    if resume {
+        lb, ok := sk.(sink.LastBlocker)
+        if !ok {
+            return fmt.Errorf("--resume is not supported by storage type %q", cfg.Storage.Type)
+        }
+        if resumeAfter, hasResumeAfter, err = lb.LastBlock(); err != nil {
+            return err
         }
-        sk = s
-    case "mysql":
-        // Placeholder until MySQL sink is implemented.
-        logrus.Warn("mysql sink selected but not yet implemented – proceeding without sink")
-    default:
-        log.Fatalf("unsupported storage type: %s", cfg.Storage.Type)
     }
 
+    // Check events against the pinned schema, if configured.
+    if sk, err = sink.WithSchema(sk, cfg.Storage); err != nil {
+        return err
+    }
     // Wrap the chosen sink with automatic retry logic (if any).
     sk = sink.NewRetrySink(sk, cfg.Retry.Attempts, cfg.Retry.DelayMS)
+    top = sk
+    // Events still failing after the retries go to the dead-letter file, if configured.
+    if sk, err = sink.WithDeadLetter(sk, cfg.Storage); err != nil {
+        return err
+    }
+    top = sk
 
     // Build and run indexer with the chosen sink.
     idx := indexer.New(cfg, client, sk)
-    if err := idx.Run(ctx); err != nil {
-        log.Fatalf("indexer terminated with error: %v", err)
+    idx.LogProgressEvery(progressInterval)
+    if hasResumeAfter {
+        idx.ResumeAfter(resumeAfter)
+    }
+    if status != nil {
+        idx.OnProgress(status.Update)
+    }
+    return idx.Run(ctx)
+}
+
+// runBlockHash reprocesses the logs of a single block, identified by hash, on
+// every configured chain.
+func runBlockHash(cfg *config.Config, hash string) error {
+    if b, err := hexutil.Decode(hash); err != nil || len(b) != common.HashLength {
+        return fmt.Errorf("invalid block hash %q", hash)
+    }
+    ctx := context.Background()
+    for _, chainCfg := range cfg.ChainConfigs() {
+        client, err := rpc.Dial(ctx, chainCfg.RPCURL, chainCfg.Retry, chainCfg.RPCTransport, rpc.WithUserAgent(chainCfg.RPCUserAgent))
+        if err != nil {
+            return fmt.Errorf("failed to connect to RPC: %w", err)
+        }
+        client.WithCallTimeout(chainCfg.RPCTimeout())
+
+        base, err := sink.Build(chainCfg.Storage)
+        if err != nil {
+            client.Close()
+            return err
+        }
+        checked, err := sink.WithSchema(base, chainCfg.Storage)
+        if err != nil {
+            client.Close()
+            return err
+        }
+        sk, err := sink.WithDeadLetter(sink.NewRetrySink(checked, chainCfg.Retry.Attempts, chainCfg.Retry.DelayMS), chainCfg.Storage)
+        if err != nil {
+            client.Close()
+            return err
+        }
+
+        n, err := indexer.New(chainCfg, client, sk).ProcessBlockHash(ctx, common.HexToHash(hash))
+        client.Close()
+        // Closing the outermost decorator closes the whole chain.
+        if cerr := sink.Close(sk); cerr != nil && err == nil {
+            err = fmt.Errorf("failed to close sink: %w", cerr)
+        }
+        if err != nil {
+            return err
+        }
+        logrus.Infof("Block %s reprocessed | chain=%s events=%d", hash, chainCfg.Chain, n)
+    }
+    return nil
+}
+
+// runValidateABI checks the configured events of every chain against the
+// contract ABIs, failing on missing ones whatever lenient_events says.
+func runValidateABI(cfg *config.Config) error {
+    var missing []string
+    contracts, events := 0, 0
+    for _, chainCfg := range cfg.ChainConfigs() {
+        for _, m := range config.MissingEvents(chainCfg.Contracts) {
+            if chainCfg.Chain != "" {
+                m = fmt.Sprintf("chain '%s': %s", chainCfg.Chain, m)
+            }
+            missing = append(missing, m)
+        }
+        for _, c := range chainCfg.Contracts {
+            contracts++
+            events += len(c.Events)
+        }
+    }
+    if len(missing) > 0 {
+        return &config.ValidationError{Problems: missing}
+    }
+    fmt.Printf("ABI check passed: %d contract(s), %d configured event(s)\n", contracts, events)
+    return nil
+}
+
+// runEstimate prints a dry-run projection for every configured chain.
+func runEstimate(cfg *config.Config, samples int) error {
+    ctx := context.Background()
+    for _, chainCfg := range cfg.ChainConfigs() {
+        client, err := rpc.Dial(ctx, chainCfg.RPCURL, chainCfg.Retry, chainCfg.RPCTransport, rpc.WithUserAgent(chainCfg.RPCUserAgent))
+        if err != nil {
+            return fmt.Errorf("failed to connect to RPC: %w", err)
+        }
+        client.WithCallTimeout(chainCfg.RPCTimeout())
+
+        est, err := indexer.New(chainCfg, client, nil).Estimate(ctx, samples)
+        client.Close()
+        if err != nil {
+            return err
+        }
+
+        if chainCfg.Chain != "" {
+            fmt.Printf("Chain %s\n", chainCfg.Chain)
+        }
+        fmt.Printf("  Range:            %d → %d (%d blocks)\n", est.StartBlock, est.EndBlock, est.TotalBlocks)
+        fmt.Printf("  Ranges:           %d of %d blocks\n", est.Ranges, est.ChunkSize)
+        fmt.Printf("  Sampled:          %d ranges, %d blocks, %d logs\n", est.SampledRanges, est.SampledBlocks, est.SampledLogs)
+        fmt.Printf("  Projected events: %d\n", est.Events)
+        fmt.Printf("  eth_getLogs:      %d\n", est.GetLogsCalls)
+        fmt.Printf("  Header calls:     %d\n", est.HeaderCalls)
+        fmt.Printf("  Tx calls:         %d\n", est.TxCalls)
+        fmt.Printf("  Receipt calls:    %d\n", est.ReceiptCalls)
+        if est.TraceCalls > 0 {
+            fmt.Printf("  Trace calls:      %d\n", est.TraceCalls)
+        }
+        fmt.Printf("  Total RPC calls:  ~%d\n", est.TotalCalls)
+    }
+    return nil
+}
+
+// runDiscover prints, per chain, the contracts that emitted the event with
+// the signature or topic0 sig over the configured range as CSV rows of
+// address, logs, first and last block.
+func runDiscover(cfg *config.Config, sig string, out io.Writer) error {
+    topic0, err := indexer.ParseTopic0(sig)
+    if err != nil {
+        return err
+    }
+    ctx := context.Background()
+    chains := cfg.ChainConfigs()
+    multi := len(chains) > 1
+
+    w := csv.NewWriter(out)
+    header := []string{"address", "logs", "first_block", "last_block"}
+    if multi {
+        header = append([]string{"chain"}, header...)
+    }
+    if err := w.Write(header); err != nil {
+        return err
+    }
+    for _, chainCfg := range chains {
+        client, err := rpc.Dial(ctx, chainCfg.RPCURL, chainCfg.Retry, chainCfg.RPCTransport, rpc.WithUserAgent(chainCfg.RPCUserAgent))
+        if err != nil {
+            return fmt.Errorf("failed to connect to RPC: %w", err)
+        }
+        client.WithCallTimeout(chainCfg.RPCTimeout())
+
+        emitters, err := indexer.New(chainCfg, client, nil).Discover(ctx, topic0)
+        client.Close()
+        if err != nil {
+            return err
+        }
+        logrus.Infof("Found %d contracts emitting %s", len(emitters), topic0.Hex())
+
+        for _, e := range emitters {
+            row := []string{e.Address.Hex(), strconv.Itoa(e.Logs), strconv.FormatUint(e.FirstBlock, 10), strconv.FormatUint(e.LastBlock, 10)}
+            if multi {
+                row = append([]string{chainCfg.Chain}, row...)
+            }
+            if err := w.Write(row); err != nil {
+                return err
+            }
+        }
     }
-} 
\ No newline at end of file
+    w.Flush()
+    return w.Error()
+}
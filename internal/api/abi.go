@@ -0,0 +1,238 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/parser"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// ABIEventsRequest is the body of POST /abi/events: either the ABI JSON
+// itself or the path of an ABI file in the server's files directory.
+type ABIEventsRequest struct {
+	ABI  json.RawMessage `json:"abi,omitempty"`
+	Path string          `json:"path,omitempty"`
+}
+
+// ABIEvent describes one event exposed by an ABI.
+type ABIEvent struct {
+	Name      string        `json:"name"`
+	Signature string        `json:"signature"`
+	Topic0    string        `json:"topic0"`
+	Anonymous bool          `json:"anonymous"`
+	Inputs    []ABIEventArg `json:"inputs"`
+}
+
+// ABIEventArg is a parameter of an ABIEvent. Indexed parameters are stored
+// in the log topics, the others in the log data.
+type ABIEventArg struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Indexed bool   `json:"indexed"`
+}
+
+// handleABIEvents handles POST /abi/events, listing the events of an ABI so
+// clients can offer them as filters.
+func (s *Server) handleABIEvents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req ABIEventsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var (
+		parsed *abi.ABI
+		err    error
+	)
+	switch {
+	case len(req.ABI) > 0 && req.Path != "":
+		http.Error(w, "provide either abi or path, not both", http.StatusBadRequest)
+		return
+	case len(req.ABI) > 0:
+		parsed, err = parseInlineABI(req.ABI)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case req.Path != "":
+		path, err := serverPath(s.opts.FilesDir, "path", req.Path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		parsed, err = config.ParseABIFiles([]string{path}, "request")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "abi or path is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(describeEvents(parsed))
+}
+
+// parseInlineABI parses an ABI sent in a request body, given either as JSON
+// or embedded as a JSON string.
+func parseInlineABI(raw json.RawMessage) (*abi.ABI, error) {
+	data := []byte(raw)
+	var str string
+	if json.Unmarshal(data, &str) == nil {
+		data = []byte(str)
+	}
+	a, err := abi.JSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse abi: %w", err)
+	}
+	return &a, nil
+}
+
+// DecodeRequest is the body of POST /decode: an inline ABI and a raw log.
+// Name is reported as contract_name (default "request").
+type DecodeRequest struct {
+	ABI  json.RawMessage `json:"abi"`
+	Name string          `json:"name,omitempty"`
+	Log  RawLog          `json:"log"`
+}
+
+// RawLog is a log as returned by eth_getLogs. Only topics and data are
+// needed to decode it; the other fields are copied into the event.
+type RawLog struct {
+	Address     string   `json:"address,omitempty"`
+	Topics      []string `json:"topics"`
+	Data        string   `json:"data"`
+	BlockNumber uint64   `json:"block_number,omitempty"`
+	TxHash      string   `json:"tx_hash,omitempty"`
+	LogIndex    uint     `json:"log_index,omitempty"`
+}
+
+// handleDecode handles POST /decode, decoding one log against an ABI exactly
+// as the indexer's parser does, minus the fields fetched over RPC
+// (timestamp, tx_from, receipt). It lets users check an ABI against sample
+// logs without running a job.
+func (s *Server) handleDecode(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req DecodeRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(req.ABI) == 0 {
+		http.Error(w, "abi is required", http.StatusBadRequest)
+		return
+	}
+	parsed, err := parseInlineABI(req.ABI)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lg, err := req.Log.toLog()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := req.Name
+	if name == "" {
+		name = "request"
+	}
+	p := parser.New(&config.Config{Contracts: []config.ContractConfig{{
+		Name:      name,
+		Address:   lg.Address.Hex(),
+		ParsedABI: parsed,
+	}}}, nil)
+	evt, err := p.Decode(lg)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to decode log: %v", err), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(evt)
+}
+
+// toLog validates the raw log and converts it to a types.Log.
+func (l RawLog) toLog() (*types.Log, error) {
+	if len(l.Topics) == 0 {
+		return nil, fmt.Errorf("log.topics must hold at least topic0")
+	}
+	lg := &types.Log{BlockNumber: l.BlockNumber, Index: l.LogIndex}
+	if l.Address != "" {
+		if !common.IsHexAddress(l.Address) {
+			return nil, fmt.Errorf("invalid log.address %q", l.Address)
+		}
+		lg.Address = common.HexToAddress(l.Address)
+	}
+	for i, t := range l.Topics {
+		b, err := hexutil.Decode(t)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid log.topics[%d] %q", i, t)
+		}
+		lg.Topics = append(lg.Topics, common.BytesToHash(b))
+	}
+	if l.Data != "" && l.Data != "0x" {
+		data, err := hexutil.Decode(l.Data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid log.data: %v", err)
+		}
+		lg.Data = data
+	}
+	if l.TxHash != "" {
+		b, err := hexutil.Decode(l.TxHash)
+		if err != nil || len(b) != common.HashLength {
+			return nil, fmt.Errorf("invalid log.tx_hash %q", l.TxHash)
+		}
+		lg.TxHash = common.BytesToHash(b)
+	}
+	return lg, nil
+}
+
+// describeEvents lists the events of an ABI sorted by name.
+func describeEvents(a *abi.ABI) []ABIEvent {
+	events := make([]ABIEvent, 0, len(a.Events))
+	for _, ev := range a.Events {
+		out := ABIEvent{
+			Name:      ev.Name,
+			Signature: ev.Sig,
+			Topic0:    ev.ID.Hex(),
+			Anonymous: ev.Anonymous,
+			Inputs:    make([]ABIEventArg, 0, len(ev.Inputs)),
+		}
+		for _, in := range ev.Inputs {
+			out.Inputs = append(out.Inputs, ABIEventArg{Name: in.Name, Type: in.Type.String(), Indexed: in.Indexed})
+		}
+		events = append(events, out)
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].Name < events[j].Name })
+	return events
+}
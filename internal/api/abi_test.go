@@ -0,0 +1,87 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// postJSON posts body to path of s.
+func postJSON(s *Server, path string, body any) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, bytes.NewReader(data)))
+	return rec
+}
+
+func TestABIEventsDescribesInlineABI(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	rec := postJSON(s, "/abi/events", map[string]any{"abi": json.RawMessage(transferABI)})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var events []ABIEvent
+	if err := json.Unmarshal(rec.Body.Bytes(), &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	ev := events[0]
+	if ev.Name != "Transfer" || ev.Signature != "Transfer(address,address,uint256)" || ev.Topic0 != transferID.Hex() {
+		t.Errorf("event = %+v", ev)
+	}
+	if len(ev.Inputs) != 3 || !ev.Inputs[0].Indexed || !ev.Inputs[1].Indexed || ev.Inputs[2].Indexed || ev.Inputs[2].Type != "uint256" {
+		t.Errorf("inputs = %+v", ev.Inputs)
+	}
+}
+
+func TestABIEventsReadsPathInFilesDir(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	rec := postJSON(s, "/abi/events", map[string]any{"path": testABI})
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"Transfer"`) {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestABIEventsRejectsPathOutsideFilesDir(t *testing.T) {
+	root := t.TempDir()
+	files := filepath.Join(root, "files")
+	if err := os.Mkdir(files, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	outside := writeABI(t, root)
+	s := NewServer(Options{FilesDir: files})
+	for _, path := range []string{outside, "../" + testABI, "abi/../../" + testABI} {
+		rec := postJSON(s, "/abi/events", map[string]any{"path": path})
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "outside the server's files directory") {
+			t.Errorf("path %q: %d %s", path, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestABIEventsNeedsOneSource(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	if rec := postJSON(s, "/abi/events", map[string]any{}); rec.Code != http.StatusBadRequest {
+		t.Errorf("without abi: %d", rec.Code)
+	}
+	if rec := postJSON(s, "/abi/events", map[string]any{"abi": json.RawMessage(transferABI), "path": testABI}); rec.Code != http.StatusBadRequest {
+		t.Errorf("with abi and path: %d", rec.Code)
+	}
+}
+
+func TestCreateJobRejectsABIOutsideFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	req := jobBody(t, node)
+	req["contracts"].([]any)[0].(map[string]any)["abi"] = writeABI(t, t.TempDir())
+	rec := postJSON(s, "/jobs", req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "contract 'Token' abi") {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+}
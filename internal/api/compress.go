@@ -0,0 +1,148 @@
+package api
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// compressor is the subset shared by gzip.Writer and zlib.Writer.
+type compressor interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// compressionMiddleware transparently decompresses gzip/deflate request
+// bodies and compresses responses for clients sending Accept-Encoding. SSE
+// streams are left uncompressed so events are delivered immediately.
+func (s *Server) compressionMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding"))) {
+		case "", "identity":
+		case "gzip":
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "invalid gzip body", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			r.Body = zr
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		case "deflate":
+			zr, err := zlib.NewReader(r.Body)
+			if err != nil {
+				http.Error(w, "invalid deflate body", http.StatusBadRequest)
+				return
+			}
+			defer zr.Close()
+			r.Body = zr
+			r.Header.Del("Content-Encoding")
+			r.Header.Del("Content-Length")
+			r.ContentLength = -1
+		default:
+			http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if encoding == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header,
+// preferring gzip. Encodings with q=0 are ignored.
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q := strings.ReplaceAll(params, " ", ""); q == "q=0" || q == "q=0.0" {
+			continue
+		}
+		accepted[strings.ToLower(name)] = true
+	}
+	switch {
+	case accepted["gzip"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// compressWriter compresses the response body once the handler has chosen
+// its status and content type.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	enc         compressor
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+
+	h := cw.Header()
+	compressible := code != http.StatusNoContent && code != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && h.Get("Content-Range") == "" &&
+		!strings.HasPrefix(h.Get("Content-Type"), "text/event-stream")
+	if compressible {
+		h.Set("Content-Encoding", cw.encoding)
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		if cw.encoding == "gzip" {
+			cw.enc = gzip.NewWriter(cw.ResponseWriter)
+		} else {
+			cw.enc = zlib.NewWriter(cw.ResponseWriter)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			// Sniff from the plain bytes; net/http would see compressed ones.
+			cw.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if cw.enc == nil {
+		return cw.ResponseWriter.Write(b)
+	}
+	return cw.enc.Write(b)
+}
+
+// Flush pushes buffered compressed data to the client.
+func (cw *compressWriter) Flush() {
+	if cw.enc != nil {
+		_ = cw.enc.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController.
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func (cw *compressWriter) close() {
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+	}
+}
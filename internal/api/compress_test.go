@@ -0,0 +1,131 @@
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// compressed returns data encoded with encoding ("gzip" or "deflate").
+func compressed(t *testing.T, encoding string, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser = gzip.NewWriter(&buf)
+	if encoding == "deflate" {
+		w = zlib.NewWriter(&buf)
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// serveCompressed sends r through the compression middleware of s.
+func serveCompressed(s *Server, r *http.Request) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.compressionMiddleware(s.mux).ServeHTTP(rec, r)
+	return rec
+}
+
+func TestCompressedRequestBodies(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	body, _ := json.Marshal(map[string]any{"abi": json.RawMessage(transferABI)})
+	for _, encoding := range []string{"gzip", "deflate"} {
+		r := httptest.NewRequest(http.MethodPost, "/abi/events", bytes.NewReader(compressed(t, encoding, body)))
+		r.Header.Set("Content-Encoding", encoding)
+		rec := serveCompressed(s, r)
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"Transfer"`) {
+			t.Errorf("%s body: %d %s", encoding, rec.Code, rec.Body)
+		}
+	}
+
+	for _, tc := range []struct {
+		encoding string
+		want     int
+	}{
+		{encoding: "gzip", want: http.StatusBadRequest},
+		{encoding: "deflate", want: http.StatusBadRequest},
+		{encoding: "br", want: http.StatusUnsupportedMediaType},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "/abi/events", bytes.NewReader(body))
+		r.Header.Set("Content-Encoding", tc.encoding)
+		if rec := serveCompressed(s, r); rec.Code != tc.want {
+			t.Errorf("plain body labelled %s: %d, want %d", tc.encoding, rec.Code, tc.want)
+		}
+	}
+}
+
+func TestBodyLimitAppliesAfterDecompression(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t), MaxBodyBytes: 4096})
+	// A few hundred compressed bytes expanding well past the limit.
+	body := []byte(`{"abi": ` + transferABI + strings.Repeat(" ", 64<<10) + `}`)
+	packed := compressed(t, "gzip", body)
+	if len(packed) >= 4096 {
+		t.Fatalf("compressed body is %d bytes, want it under the limit", len(packed))
+	}
+	r := httptest.NewRequest(http.MethodPost, "/abi/events", bytes.NewReader(packed))
+	r.Header.Set("Content-Encoding", "gzip")
+	if rec := serveCompressed(s, r); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("decompressed body over the limit: %d %s, want 413", rec.Code, rec.Body)
+	}
+}
+
+func TestCompressedResponses(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	for _, tc := range []struct {
+		accept string
+		want   string
+	}{
+		{accept: "gzip", want: "gzip"},
+		{accept: "deflate", want: "deflate"},
+		{accept: "deflate, gzip;q=0.5", want: "gzip"},
+		{accept: "gzip;q=0, deflate", want: "deflate"},
+		{accept: "gzip; q=0", want: ""},
+		{accept: "br", want: ""},
+		{accept: "", want: ""},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/version", nil)
+		if tc.accept != "" {
+			r.Header.Set("Accept-Encoding", tc.accept)
+		}
+		rec := serveCompressed(s, r)
+		if got := rec.Header().Get("Content-Encoding"); got != tc.want {
+			t.Errorf("Accept-Encoding %q: Content-Encoding %q, want %q", tc.accept, got, tc.want)
+			continue
+		}
+		var body io.Reader = rec.Body
+		switch tc.want {
+		case "gzip":
+			body, _ = gzip.NewReader(rec.Body)
+		case "deflate":
+			body, _ = zlib.NewReader(rec.Body)
+		}
+		var version map[string]any
+		if err := json.NewDecoder(body).Decode(&version); err != nil {
+			t.Errorf("Accept-Encoding %q: decoding the body: %v", tc.accept, err)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Accept-Encoding %q: Content-Type %q", tc.accept, ct)
+		}
+	}
+}
+
+func TestEventStreamIsNotCompressed(t *testing.T) {
+	rec := httptest.NewRecorder()
+	s := NewServer(Options{})
+	handler := s.compressionMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, "data: {}\n\n")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/jobs/x/stream", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	handler.ServeHTTP(rec, r)
+	if rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != "data: {}\n\n" {
+		t.Fatalf("event stream: encoding %q body %q", rec.Header().Get("Content-Encoding"), rec.Body)
+	}
+}
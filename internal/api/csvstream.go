@@ -0,0 +1,186 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/indexer"
+	"etl-web3/internal/rpc"
+	"etl-web3/internal/sink"
+
+	"github.com/sirupsen/logrus"
+)
+
+// streamColumns are the leading columns of POST /jobs/stream; every other
+// field of an event goes, JSON-encoded, into the trailing "args" column so
+// events of different types share one header.
+var streamColumns = []string{
+	"block_number", "timestamp", "tx_hash", "log_index", "contract",
+	"contract_name", "event_name", "removed",
+}
+
+// streamErrorTrailer carries the error of a run that failed after rows were
+// already sent, when the status code can no longer change.
+const streamErrorTrailer = "X-Job-Error"
+
+// csvStreamSink writes every event as a row of a single CSV document to an
+// HTTP response. The header is sent with the first row; flush pushes the
+// buffered rows to the client.
+type csvStreamSink struct {
+	mu      sync.Mutex
+	w       http.ResponseWriter
+	csv     *csv.Writer
+	started bool
+}
+
+func newCSVStreamSink(w http.ResponseWriter) *csvStreamSink {
+	return &csvStreamSink{w: w, csv: csv.NewWriter(w)}
+}
+
+// Write appends evt as one row.
+func (s *csvStreamSink) Write(evt sink.Event) error {
+	row := make([]string, 0, len(streamColumns)+1)
+	rest := make(map[string]interface{}, len(evt))
+	for k, v := range evt {
+		rest[k] = v
+	}
+	for _, col := range streamColumns {
+		v, ok := rest[col]
+		if !ok {
+			row = append(row, "")
+			continue
+		}
+		row = append(row, fmt.Sprint(v))
+		delete(rest, col)
+	}
+	args, err := json.Marshal(rest)
+	if err != nil {
+		return sink.Permanent(fmt.Errorf("failed to encode args: %w", err))
+	}
+	row = append(row, string(args))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		s.start()
+	}
+	return s.csv.Write(row)
+}
+
+// start sends the response headers and the CSV header. s.mu must be held.
+func (s *csvStreamSink) start() {
+	s.started = true
+	s.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	s.w.Header().Set("Trailer", streamErrorTrailer)
+	s.w.WriteHeader(http.StatusOK)
+	s.csv.Write(append(append([]string(nil), streamColumns...), "args"))
+}
+
+// flush pushes buffered rows to the client.
+func (s *csvStreamSink) flush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		return
+	}
+	s.csv.Flush()
+	_ = http.NewResponseController(s.w).Flush()
+}
+
+// finish ends the document: a run without events still gets the header,
+// and an error after the first row is reported in the trailer. It returns
+// false when nothing was sent yet, so the caller can reply with an error.
+func (s *csvStreamSink) finish(runErr error) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.started {
+		if runErr != nil {
+			return false
+		}
+		s.start()
+	}
+	s.csv.Flush()
+	if runErr != nil {
+		s.w.Header().Set(streamErrorTrailer, runErr.Error())
+	}
+	return true
+}
+
+// handleJobStream handles POST /jobs/stream: it runs a bounded job within
+// the request and streams its events back as CSV instead of writing them to
+// the job's storage. Rows arrive in completion order of the block ranges;
+// set workers to 1 for block order.
+func (s *Server) handleJobStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := s.readBody(w, r)
+	if !ok {
+		return
+	}
+
+	var req JobRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.EndBlock == nil {
+		http.Error(w, "end_block is required for streamed jobs", http.StatusBadRequest)
+		return
+	}
+	if req.Follow {
+		http.Error(w, "follow is not supported for streamed jobs", http.StatusBadRequest)
+		return
+	}
+	// Events go to the response: the storage settings of the request are
+	// ignored and replaced by a valid placeholder for validation.
+	req.Storage = config.StorageConfig{Type: "csv"}
+	req.Storage.CSV.OutputDir = "-"
+	cfg, err := buildConfigFromRequest(req, s.opts.FilesDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cfg.Storage = config.StorageConfig{} // no manifest or dead-letter file either
+
+	// The job counts against MAX_CONCURRENT_JOBS like queued ones and stops
+	// when the client goes away.
+	ctx := r.Context()
+	if !s.acquireSlot(ctx) {
+		return
+	}
+	defer s.releaseSlot()
+
+	client, err := rpc.Dial(ctx, cfg.RPCURL, cfg.Retry, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	client.WithCallTimeout(cfg.RPCTimeout())
+
+	// Streams may outlast the server-wide WriteTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	// Rows go straight to the response: a failed write means the client is
+	// gone, and retrying it could send part of a row twice.
+	out := newCSVStreamSink(w)
+	idx := indexer.New(cfg, client, out)
+	idx.OnProgress(func(indexer.Progress) { out.flush() })
+	err = idx.Run(ctx)
+	if ctx.Err() != nil {
+		// The client disconnected: nobody is left to read the result.
+		return
+	}
+	if err != nil {
+		logrus.Warnf("streamed job failed: %v", err)
+	}
+	if !out.finish(err) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// streamRequest returns a POST /jobs/stream body indexing the Transfer
+// events of tokenAddress on node over [0, end], with the ABI of filesDir.
+func streamRequest(t *testing.T, node *fakeNode, end any) []byte {
+	t.Helper()
+	req := map[string]any{
+		"rpc_url":     node.URL,
+		"start_block": 0,
+		"workers":     1,
+		"chunk_size":  10,
+		"retry":       map[string]any{"attempts": 1, "delay_ms": 1},
+		"contracts": []map[string]any{{
+			"name":    "Token",
+			"address": tokenAddress.Hex(),
+			"abi":     testABI,
+			"events":  []string{"Transfer"},
+		}},
+	}
+	if end != nil {
+		req["end_block"] = end
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func postStream(t *testing.T, s *Server, body []byte) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs/stream", bytes.NewReader(body)))
+	return rec
+}
+
+func TestJobStreamWritesCSV(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10), transferLog(3, 1, 20), transferLog(25, 0, 30))
+	rec := postStream(t, NewServer(Options{FilesDir: filesDir(t)}), streamRequest(t, node, 30))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/csv") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("response is not CSV: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("got %d rows, want header and 3 events: %v", len(rows), rows)
+	}
+	if got := strings.Join(rows[0], ","); got != strings.Join(append(streamColumns, "args"), ",") {
+		t.Errorf("header = %s", got)
+	}
+	for i, want := range []string{"3", "3", "25"} {
+		if rows[i+1][0] != want || rows[i+1][6] != "Transfer" {
+			t.Errorf("row %d = %v, want block %s Transfer", i+1, rows[i+1], want)
+		}
+	}
+	var args map[string]any
+	if err := json.Unmarshal([]byte(rows[3][len(rows[3])-1]), &args); err != nil || args["value"] != "30" {
+		t.Errorf("args of the last row = %v (%v), want value 30", rows[3][len(rows[3])-1], err)
+	}
+	if trailer := rec.Header().Get(streamErrorTrailer); trailer != "" {
+		t.Errorf("%s = %q on success", streamErrorTrailer, trailer)
+	}
+}
+
+func TestJobStreamWithoutEventsSendsHeader(t *testing.T) {
+	node := newFakeNode(t, 30)
+	rec := postStream(t, NewServer(Options{FilesDir: filesDir(t)}), streamRequest(t, node, 30))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	if got := strings.TrimSpace(rec.Body.String()); got != strings.Join(append(streamColumns, "args"), ",") {
+		t.Fatalf("body = %q, want the header only", got)
+	}
+}
+
+func TestJobStreamRejectsUnboundedRanges(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	if rec := postStream(t, s, streamRequest(t, node, nil)); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "end_block is required") {
+		t.Errorf("without end_block: %d %s", rec.Code, rec.Body)
+	}
+
+	var req map[string]any
+	json.Unmarshal(streamRequest(t, node, 30), &req)
+	req["follow"] = true
+	body, _ := json.Marshal(req)
+	if rec := postStream(t, s, body); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "follow") {
+		t.Errorf("with follow: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestJobStreamFailureBeforeFirstRow(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	node.failLogs = true
+	rec := postStream(t, NewServer(Options{FilesDir: filesDir(t)}), streamRequest(t, node, 30))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("status = %d, want 502: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestJobStreamRejectsGet(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(Options{FilesDir: filesDir(t)}).mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/stream", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+}
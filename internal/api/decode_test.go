@@ -0,0 +1,146 @@
+package api
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/parser"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// rawTransfer returns transferLog(3, 1, 10) as a POST /decode log.
+func rawTransfer() RawLog {
+	lg := transferLog(3, 1, 10)
+	raw := RawLog{
+		Address:     lg.Address.Hex(),
+		Data:        hexutil.Encode(lg.Data),
+		BlockNumber: lg.BlockNumber,
+		TxHash:      lg.TxHash.Hex(),
+		LogIndex:    lg.Index,
+	}
+	for _, topic := range lg.Topics {
+		raw.Topics = append(raw.Topics, topic.Hex())
+	}
+	return raw
+}
+
+// decodeEvent posts req to /decode and returns the decoded event.
+func decodeEvent(t *testing.T, req DecodeRequest) map[string]any {
+	t.Helper()
+	rec := postJSON(NewServer(Options{}), "/decode", req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var evt map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &evt); err != nil {
+		t.Fatal(err)
+	}
+	return evt
+}
+
+func TestDecodeTransferLog(t *testing.T) {
+	evt := decodeEvent(t, DecodeRequest{ABI: json.RawMessage(transferABI), Name: "Token", Log: rawTransfer()})
+
+	want := map[string]any{
+		"event_name":    "Transfer",
+		"contract_name": "Token",
+		"contract":      tokenAddress.Hex(),
+		"from":          common.HexToAddress("0x01").Hex(),
+		"to":            common.HexToAddress("0x02").Hex(),
+		"value":         "10",
+		"block_number":  float64(3),
+		"log_index":     float64(1),
+		"tx_hash":       transferLog(3, 1, 10).TxHash.Hex(),
+	}
+	for k, v := range want {
+		if got, ok := evt[k]; !ok || !strings.EqualFold(jsonString(got), jsonString(v)) {
+			t.Errorf("%s = %v, want %v", k, got, v)
+		}
+	}
+	for _, k := range []string{"timestamp", "tx_from"} {
+		if _, ok := evt[k]; ok {
+			t.Errorf("%s set without an RPC client", k)
+		}
+	}
+}
+
+func TestDecodeMatchesParser(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(transferABI))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg := transferLog(3, 1, 10)
+	p := parser.New(&config.Config{Contracts: []config.ContractConfig{{Name: "request", Address: tokenAddress.Hex(), ParsedABI: &parsed}}}, nil)
+	evt, err := p.Decode(&lg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := json.Marshal(evt)
+
+	rec := postJSON(NewServer(Options{}), "/decode", DecodeRequest{ABI: json.RawMessage(transferABI), Log: rawTransfer()})
+	if got := strings.TrimSpace(rec.Body.String()); got != string(want) {
+		t.Fatalf("POST /decode = %s\nParser.Decode = %s", got, want)
+	}
+}
+
+func TestDecodeABIAsString(t *testing.T) {
+	quoted, _ := json.Marshal(transferABI)
+	evt := decodeEvent(t, DecodeRequest{ABI: quoted, Log: rawTransfer()})
+	if evt["event_name"] != "Transfer" || evt["contract_name"] != "request" {
+		t.Fatalf("event = %v", evt)
+	}
+}
+
+func TestDecodeRejectsInvalidRequests(t *testing.T) {
+	unknown := rawTransfer()
+	unknown.Topics[0] = common.BigToHash(big.NewInt(0xbeef)).Hex()
+	badTopic := rawTransfer()
+	badTopic.Topics[1] = "0x01"
+	noTopics := rawTransfer()
+	noTopics.Topics = nil
+	badData := rawTransfer()
+	badData.Data = "0xzz"
+
+	cases := []struct {
+		name string
+		req  DecodeRequest
+		code int
+	}{
+		{name: "missing abi", req: DecodeRequest{Log: rawTransfer()}, code: http.StatusBadRequest},
+		{name: "invalid abi", req: DecodeRequest{ABI: json.RawMessage(`{"x":1}`), Log: rawTransfer()}, code: http.StatusBadRequest},
+		{name: "no topics", req: DecodeRequest{ABI: json.RawMessage(transferABI), Log: noTopics}, code: http.StatusBadRequest},
+		{name: "short topic", req: DecodeRequest{ABI: json.RawMessage(transferABI), Log: badTopic}, code: http.StatusBadRequest},
+		{name: "invalid data", req: DecodeRequest{ABI: json.RawMessage(transferABI), Log: badData}, code: http.StatusBadRequest},
+		{name: "event missing from abi", req: DecodeRequest{ABI: json.RawMessage(transferABI), Log: unknown}, code: http.StatusUnprocessableEntity},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if rec := postJSON(NewServer(Options{}), "/decode", tc.req); rec.Code != tc.code {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tc.code, rec.Body)
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsGet(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(Options{}).mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/decode", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+}
+
+// jsonString returns the JSON encoding of v; addresses are compared
+// case-insensitively since their JSON form is not checksummed.
+func jsonString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}
@@ -1,24 +1,27 @@
 package api
 
 import (
-	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"etl-web3/internal/config"
 	"etl-web3/internal/indexer"
+	"etl-web3/internal/metrics"
 	"etl-web3/internal/rpc"
 	"etl-web3/internal/sink"
+	"etl-web3/internal/version"
 
-	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/sirupsen/logrus"
 )
 
@@ -32,15 +35,58 @@ func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleJobByID routes GET and DELETE for specific job IDs.
+// handleJobByID routes GET and DELETE for specific job IDs, plus the
+// sub-resources living under /jobs/{id}/.
 func (s *Server) handleJobByID(w http.ResponseWriter, r *http.Request) {
-	// Expected path: /jobs/{id}
-	id := strings.TrimPrefix(r.URL.Path, "/jobs/")
+	// Expected path: /jobs/{id}[/{action}]
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/jobs/"), "/")
 	if id == "" {
 		http.Error(w, "job id missing", http.StatusBadRequest)
 		return
 	}
 
+	switch action {
+	case "":
+	case "stream":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.streamJob(w, r, id)
+		return
+	case "retry":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.retryJob(w, r, id)
+		return
+	case "resume":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.resumeJob(w, r, id)
+		return
+	case "metrics":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.jobMetrics(w, r, id)
+		return
+	case "output":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		s.jobOutput(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
 		s.getJob(w, r, id)
@@ -53,9 +99,8 @@ func (s *Server) handleJobByID(w http.ResponseWriter, r *http.Request) {
 
 // createJob handles POST /jobs
 func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	body, ok := s.readBody(w, r)
+	if !ok {
 		return
 	}
 	defer r.Body.Close()
@@ -74,28 +119,176 @@ func (s *Server) createJob(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "at least one contract must be provided", http.StatusBadRequest)
 		return
 	}
+	// Reject invalid settings now rather than through a failed job.
+	if _, err := buildConfigFromRequest(req, s.opts.FilesDir); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
+	jobID := s.startJob(req, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(JobResponse{JobID: jobID})
+}
+
+// readBody reads the request body up to the configured size limit. On
+// failure the error response (413 for oversized bodies) is already written.
+func (s *Server) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// retryJob handles POST /jobs/{id}/retry: the original request of a job that
+// is no longer running is launched again under a new job ID. With
+// ?resume=true it starts after the last checkpoint of the previous run.
+func (s *Server) retryJob(w http.ResponseWriter, r *http.Request, id string) {
+	req, progress, ok := s.finishedJob(w, id)
+	if !ok {
+		return
+	}
+
+	if resume, _ := strconv.ParseBool(r.URL.Query().Get("resume")); resume && progress != nil && progress.Checkpointed {
+		req.StartBlock = config.BlockRef{Number: indexer.ResumeStart(progress.StartBlock, progress.Checkpoint, req.ReindexOverlap)}
+	}
+
+	jobID := s.startJob(req, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(JobResponse{JobID: jobID})
+}
+
+// resumeJob handles POST /jobs/{id}/resume?from_block=N: like a retry, the
+// original request of a job that is no longer running is launched again
+// under a new job ID, but starting at block N. N must lie within the range
+// of the original job.
+func (s *Server) resumeJob(w http.ResponseWriter, r *http.Request, id string) {
+	raw := r.URL.Query().Get("from_block")
+	if raw == "" {
+		http.Error(w, "from_block is required", http.StatusBadRequest)
+		return
+	}
+	from, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid from_block %q, expected a block number", raw), http.StatusBadRequest)
+		return
+	}
+
+	req, progress, ok := s.finishedJob(w, id)
+	if !ok {
+		return
+	}
+	if err := validateResumeBlock(req, progress, from); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req.StartBlock = config.BlockRef{Number: from}
+
+	jobID := s.startJob(req, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(JobResponse{JobID: jobID})
+}
+
+// finishedJob returns the request and last progress of a job that can be
+// re-run. On failure the error response (404 for unknown jobs, 409 for
+// jobs still queued or running) is already written.
+func (s *Server) finishedJob(w http.ResponseWriter, id string) (JobRequest, *indexer.Progress, bool) {
+	s.mu.RLock()
+	entry, ok := s.jobs[id]
+	var (
+		req      JobRequest
+		status   string
+		progress *indexer.Progress
+	)
+	if ok {
+		req = entry.req
+		status = entry.status.Status
+		progress = entry.status.Progress
+	}
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return JobRequest{}, nil, false
+	}
+	if !isTerminal(status) {
+		http.Error(w, fmt.Sprintf("job is %s and cannot be retried", status), http.StatusConflict)
+		return JobRequest{}, nil, false
+	}
+	return req, progress, true
+}
+
+// validateResumeBlock checks that from lies within the range of the job
+// that ran req. Head-relative bounds are taken from the progress of the
+// run, which resolved them; follow jobs have no upper bound.
+func validateResumeBlock(req JobRequest, progress *indexer.Progress, from uint64) error {
+	var start uint64
+	switch {
+	case !req.StartBlock.FromLatest:
+		start = req.StartBlock.Number
+	case progress != nil:
+		start = progress.StartBlock
+	default:
+		return fmt.Errorf("the job started relative to the chain head and never ran, so its range is unknown")
+	}
+	if from < start {
+		return fmt.Errorf("from_block %d is before the job's start block %d", from, start)
+	}
+	if req.Follow {
+		return nil
+	}
+
+	switch {
+	case req.EndBlock != nil && !req.EndBlock.FromLatest:
+		if from > req.EndBlock.Number {
+			return fmt.Errorf("from_block %d is after the job's end block %d", from, req.EndBlock.Number)
+		}
+	case progress != nil:
+		if from > progress.EndBlock {
+			return fmt.Errorf("from_block %d is after the job's end block %d", from, progress.EndBlock)
+		}
+	}
+	return nil
+}
+
+// startJob registers a queued job for req and launches it in the background.
+// retryOf is the ID of the job being re-run, if any.
+func (s *Server) startJob(req JobRequest, retryOf string) string {
 	jobID := newUUID()
 
 	status := &JobStatus{
 		JobID:     jobID,
 		Status:    "queued",
 		StartedAt: time.Now(),
+		RetryOf:   retryOf,
 	}
 
 	s.mu.Lock()
-	s.jobs[jobID] = &jobEntry{status: status}
+	entry := &jobEntry{status: status, req: req}
+	s.jobs[jobID] = entry
+	s.notifyLocked(entry)
 	s.mu.Unlock()
 
 	go s.runJob(jobID, req)
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusAccepted)
-	json.NewEncoder(w).Encode(JobResponse{JobID: jobID})
+	return jobID
 }
 
 // runJob converts the request into a Config, initialises dependencies and runs the indexer.
 func (s *Server) runJob(jobID string, req JobRequest) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Get job entry to update status later.
 	s.mu.Lock()
 	entry := s.jobs[jobID]
@@ -104,59 +297,111 @@ func (s *Server) runJob(jobID string, req JobRequest) {
 		entry = &jobEntry{status: &JobStatus{JobID: jobID}}
 		s.jobs[jobID] = entry
 	}
+	entry.cancel = cancel
+	s.mu.Unlock()
+
+	// The job stays queued until a slot frees or it is cancelled.
+	if !s.acquireSlot(ctx) {
+		return
+	}
+	defer s.releaseSlot()
+
+	s.mu.Lock()
+	if entry.status.Status == "cancelled" {
+		s.mu.Unlock()
+		return
+	}
 	// Update status to running
 	entry.status.Status = "running"
+	s.notifyLocked(entry)
 	s.mu.Unlock()
 
 	// Build config from request
-	cfg, err := buildConfigFromRequest(req)
+	cfg, err := buildConfigFromRequest(req, s.opts.FilesDir)
 	if err != nil {
 		s.markJobError(jobID, err)
 		return
 	}
-
-	ctx, cancel := context.WithCancel(context.Background())
-	entry.cancel = cancel
+	if warnings := config.MissingEvents(cfg.Contracts); len(warnings) > 0 {
+		s.mu.Lock()
+		entry.status.Warnings = warnings
+		s.notifyLocked(entry)
+		s.mu.Unlock()
+	}
 
 	// Initialise RPC client
-	client, err := rpc.Dial(ctx, cfg.RPCURL, cfg.Retry)
+	client, err := rpc.Dial(ctx, cfg.RPCURL, cfg.Retry, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent))
 	if err != nil {
 		s.markJobError(jobID, err)
 		return
 	}
-
-	// Initialise sink
-	var sk sink.Sink
-	switch cfg.Storage.Type {
-	case "csv":
-		sk, err = sink.NewCSVSink(cfg.Storage.CSV.OutputDir)
-		if err != nil {
+	client.WithCallTimeout(cfg.RPCTimeout())
+	s.mu.Lock()
+	entry.client = client
+	s.mu.Unlock()
+	// Follow mode subscribes through the WebSocket endpoint, if separate.
+	if cfg.Follow && cfg.RPCWSURL != "" {
+		if err := client.DialSubscriptions(ctx, cfg.RPCWSURL, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent)); err != nil {
 			s.markJobError(jobID, err)
 			return
 		}
-	case "mysql":
-		s.markJobError(jobID, fmt.Errorf("mysql sink not implemented"))
-		return
-	default:
-		s.markJobError(jobID, fmt.Errorf("unsupported storage type: %s", cfg.Storage.Type))
+	}
+
+	// Initialise sink (plus mirrors, if any)
+	base, err := sink.Build(cfg.Storage)
+	if err != nil {
+		s.markJobError(jobID, err)
 		return
 	}
 
-	// Wrap sink with retry logic
-	sk = sink.NewRetrySink(sk, cfg.Retry.Attempts, cfg.Retry.DelayMS)
+	// Wrap sink with the schema check, retry logic, then dead-lettering (if configured)
+	checked, err := sink.WithSchema(base, cfg.Storage)
+	if err != nil {
+		sink.Close(base)
+		s.markJobError(jobID, err)
+		return
+	}
+	sk, err := sink.WithDeadLetter(sink.NewRetrySink(checked, cfg.Retry.Attempts, cfg.Retry.DelayMS), cfg.Storage)
+	if err != nil {
+		sink.Close(base)
+		s.markJobError(jobID, err)
+		return
+	}
 
 	// Build and run indexer
 	idx := indexer.New(cfg, client, sk)
-	if err := idx.Run(ctx); err != nil {
+	idx.OnProgress(func(p indexer.Progress) {
+		s.mu.Lock()
+		entry.status.Progress = &p
+		s.notifyLocked(entry)
+		s.mu.Unlock()
+	})
+	err = idx.Run(ctx)
+	// Buffering sinks (Parquet, CSV with flush_rows) only produce complete
+	// files once closed; the decorators forward Close down the chain.
+	if c, ok := sk.(io.Closer); ok {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = fmt.Errorf("failed to close sink: %w", cerr)
+		}
+	}
+	if err != nil {
+		// In continue mode a summary of the partial run is still available.
+		s.mu.Lock()
+		entry.status.Summary = idx.Summary()
+		s.mu.Unlock()
 		s.markJobError(jobID, err)
 		return
 	}
 
-	// Success
+	// Success, unless the run only ended because the job was cancelled.
 	s.mu.Lock()
-	entry.status.Status = "finished"
-	finished := time.Now()
-	entry.status.FinishedAt = &finished
+	entry.status.Summary = idx.Summary()
+	if entry.status.Status != "cancelled" {
+		entry.status.Status = "finished"
+		finished := time.Now()
+		entry.status.FinishedAt = &finished
+	}
+	s.notifyLocked(entry)
 	s.mu.Unlock()
 }
 
@@ -164,6 +409,50 @@ func (s *Server) runJob(jobID string, req JobRequest) {
 func (s *Server) getJob(w http.ResponseWriter, r *http.Request, id string) {
 	s.mu.RLock()
 	entry, ok := s.jobs[id]
+	var status JobStatus
+	if ok {
+		// Copy under the lock: the job goroutine keeps updating progress.
+		status = *entry.status
+	}
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// jobMetrics handles GET /jobs/{id}/metrics: throughput and position from
+// the job's progress plus the call counters of its RPC client.
+func (s *Server) jobMetrics(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.RLock()
+	entry, ok := s.jobs[id]
+	var m JobMetrics
+	if ok {
+		status := entry.status
+		m = JobMetrics{JobID: status.JobID, Status: status.Status}
+		if p := status.Progress; p != nil {
+			m.CurrentBlock = p.CurrentBlock
+			m.Checkpoint = p.Checkpoint
+			m.EndBlock = p.EndBlock
+			m.BlocksProcessed = p.BlocksProcessed
+			m.EventsWritten = p.EventsWritten
+			m.BlocksPerSecond = p.BlocksPerSecond
+			m.EventsPerSecond = p.EventsPerSecond
+		}
+		if !status.StartedAt.IsZero() {
+			end := time.Now()
+			if status.FinishedAt != nil {
+				end = *status.FinishedAt
+			}
+			m.ElapsedSeconds = end.Sub(status.StartedAt).Seconds()
+		}
+		if entry.client != nil {
+			m.RPC = entry.client.Stats()
+		}
+	}
 	s.mu.RUnlock()
 	if !ok {
 		http.Error(w, "job not found", http.StatusNotFound)
@@ -171,56 +460,144 @@ func (s *Server) getJob(w http.ResponseWriter, r *http.Request, id string) {
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(entry.status)
+	json.NewEncoder(w).Encode(m)
+}
+
+// handleVersion handles GET /version with the build information of the server.
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(version.Get())
+}
+
+// handleDebugRPC handles GET /debug/rpc, reporting per RPC endpoint the
+// retries and failures by method and the last error of the process.
+func (s *Server) handleDebugRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(metrics.RPCEndpoints())
+}
+
+// StorageType describes a registered sink for GET /storage/types.
+type StorageType struct {
+	Name   string       `json:"name"`
+	Fields []sink.Field `json:"fields"`
+}
+
+// handleStorageTypes handles GET /storage/types, listing the storage types
+// of the sink registry with the settings each one takes under storage.
+func (s *Server) handleStorageTypes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	types := []StorageType{}
+	for _, name := range sink.Types() {
+		fields := sink.Schema(name)
+		if fields == nil {
+			fields = []sink.Field{}
+		}
+		types = append(types, StorageType{Name: name, Fields: fields})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(types)
 }
 
 // cancelJob handles DELETE /jobs/{id}
 func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request, id string) {
 	s.mu.Lock()
 	entry, ok := s.jobs[id]
+	var cancel context.CancelFunc
+	if ok {
+		cancel = entry.cancel
+	}
 	s.mu.Unlock()
 	if !ok {
 		http.Error(w, "job not found", http.StatusNotFound)
 		return
 	}
 
-	if entry.cancel != nil {
-		entry.cancel()
+	if cancel != nil {
+		cancel()
 	}
 
 	s.mu.Lock()
 	entry.status.Status = "cancelled"
 	finished := time.Now()
 	entry.status.FinishedAt = &finished
+	s.notifyLocked(entry)
 	s.mu.Unlock()
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// markJobError sets the status of the job to error with the provided err.
+// markJobError sets the status of the job to error with the provided err. A
+// cancelled job stays cancelled: its run failing afterwards (typically with
+// context.Canceled) is a consequence of the cancellation.
 func (s *Server) markJobError(jobID string, err error) {
-	logrus.Errorf("job %s failed: %v", jobID, err)
 	s.mu.Lock()
-	if entry, ok := s.jobs[jobID]; ok {
-		entry.status.Status = "error"
-		entry.status.Error = err.Error()
-		finished := time.Now()
-		entry.status.FinishedAt = &finished
+	defer s.mu.Unlock()
+	entry, ok := s.jobs[jobID]
+	if !ok || entry.status.Status == "cancelled" {
+		return
 	}
-	s.mu.Unlock()
+	logrus.Errorf("job %s failed: %v", jobID, err)
+	entry.status.Status = "error"
+	entry.status.Error = err.Error()
+	finished := time.Now()
+	entry.status.FinishedAt = &finished
+	s.notifyLocked(entry)
 }
 
 // buildConfigFromRequest converts the HTTP request into a validated *config.Config
 // replicating the logic from config.Load but without reading from disk.
-func buildConfigFromRequest(req JobRequest) (*config.Config, error) {
+// Server-side files named by the request are resolved in filesDir.
+func buildConfigFromRequest(req JobRequest, filesDir string) (*config.Config, error) {
 	// Copy over values
 	cfg := &config.Config{
-		RPCURL:     req.RPCURL,
-		StartBlock: req.StartBlock,
-		Contracts:  req.Contracts,
-		Storage:    req.Storage,
-		Retry:      req.Retry,
-		ChunkSize:  req.ChunkSize,
+		RPCURL:        req.RPCURL,
+		RPCWSURL:      req.RPCWSURL,
+		StartBlock:    req.StartBlock,
+		EndBlock:      req.EndBlock,
+		Contracts:     append([]config.ContractConfig(nil), req.Contracts...), // ABIs are parsed into the copy
+		Storage:       req.Storage,
+		Transforms:    req.Transforms,
+		ExcludeAddresses: req.ExcludeAddresses,
+		StrictEvents:     req.StrictEvents,
+		LenientEvents:    req.LenientEvents,
+		Retry:         req.Retry,
+		RPCTimeoutMS:  req.RPCTimeoutMS,
+		RPCUserAgent:  req.RPCUserAgent,
+		RPCTransport:  req.RPCTransport,
+		ChunkSize:     req.ChunkSize,
+		MaxRPCRange:   req.MaxRPCRange,
+		Workers:       req.Workers,
+		EnrichWorkers: req.EnrichWorkers,
+		QueueDepth:    req.QueueDepth,
+		DecodeTxInput: req.DecodeTxInput,
+		EnrichReceipt: req.EnrichReceipt,
+		IndexBlocks:   req.IndexBlocks,
+		IndexTraces:   req.IndexTraces,
+		Follow:        req.Follow,
+
+		FollowConfirmations: req.FollowConfirmations,
+		CatchupChunkSize:    req.CatchupChunkSize,
+		TipThreshold:        req.TipThreshold,
+		TipPollIntervalMS:   req.TipPollIntervalMS,
+
+		InlineTimestamps:  req.InlineTimestamps,
+		SignatureDB:       req.SignatureDB,
+		ParseErrorsFile:   req.ParseErrorsFile,
+		ReindexOverlap:    req.ReindexOverlap,
+		OnError:           req.OnError,
+		RetryFailedRanges: req.RetryFailedRanges,
+		NoCodeLogs:        req.NoCodeLogs,
 	}
 
 	// Apply defaults
@@ -233,23 +610,68 @@ func buildConfigFromRequest(req JobRequest) (*config.Config, error) {
 	if cfg.ChunkSize == 0 {
 		cfg.ChunkSize = 1_000
 	}
+	if cfg.RPCTimeoutMS == 0 {
+		cfg.RPCTimeoutMS = config.DefaultRPCTimeoutMS
+	}
+	if cfg.RPCUserAgent == "" {
+		cfg.RPCUserAgent = config.DefaultRPCUserAgent
+	}
+	// Same checks and clamping as config.Load; max_workers is not accepted
+	// from clients, so API jobs always get the default bound.
+	if err := config.ValidateWorkers(cfg.Workers, cfg.EnrichWorkers, cfg.QueueDepth); err != nil {
+		return nil, err
+	}
+	if cfg.TipPollIntervalMS < 0 {
+		return nil, fmt.Errorf("tip_poll_interval_ms must not be negative, got %d", cfg.TipPollIntervalMS)
+	}
+	if err := config.ValidateRPCTransport(cfg.RPCTransport); err != nil {
+		return nil, err
+	}
+	// Certificate verification is the server's policy, not the client's.
+	if cfg.RPCTransport.InsecureSkipVerify {
+		return nil, fmt.Errorf("rpc_transport.insecure_skip_verify is not accepted from API jobs")
+	}
+	if cfg.RPCTransport.CACertFile != "" {
+		path, err := serverPath(filesDir, "rpc_transport.ca_cert_file", cfg.RPCTransport.CACertFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RPCTransport.CACertFile = path
+	}
+	if err := config.ValidateRPCWSURL(cfg.RPCWSURL); err != nil {
+		return nil, err
+	}
+	cfg.NormalizeWorkers()
 
 	// Validate
 	if cfg.RPCURL == "" {
 		return nil, fmt.Errorf("rpc_url is required")
 	}
 
-	switch cfg.Storage.Type {
-	case "csv":
-		if cfg.Storage.CSV.OutputDir == "" {
-			return nil, fmt.Errorf("storage.csv.output_dir is required")
-		}
-	case "mysql":
-		if cfg.Storage.MySQL.DSN == "" {
-			return nil, fmt.Errorf("storage.mysql.dsn is required")
+	if err := config.ValidateOnError(cfg.OnError); err != nil {
+		return nil, err
+	}
+
+	if err := config.ValidateNoCodeLogs(cfg.NoCodeLogs); err != nil {
+		return nil, err
+	}
+
+	if err := config.ValidateEndBlock(cfg.StartBlock, cfg.EndBlock, cfg.Follow); err != nil {
+		return nil, err
+	}
+
+	if err := config.ValidateStorage(cfg.Storage); err != nil {
+		return nil, err
+	}
+
+	for i, t := range cfg.Transforms {
+		if err := config.ValidateTransform(t); err != nil {
+			return nil, fmt.Errorf("transforms[%d]: %w", i, err)
 		}
-	default:
-		return nil, fmt.Errorf("unsupported storage type: %s", cfg.Storage.Type)
+	}
+
+	if err := config.ValidateExcludeAddresses(cfg.ExcludeAddresses); err != nil {
+		return nil, err
 	}
 
 	if len(cfg.Contracts) == 0 {
@@ -261,32 +683,146 @@ func buildConfigFromRequest(req JobRequest) (*config.Config, error) {
 		if c.Name == "" {
 			return nil, fmt.Errorf("contract at index %d missing name", i)
 		}
-		if c.Address == "" {
-			return nil, fmt.Errorf("contract '%s' missing address", c.Name)
+		if c.Address == "" && len(c.Addresses) == 0 && len(c.Events) == 0 {
+			return nil, fmt.Errorf("contract '%s' missing address (an address-less entry must list events)", c.Name)
+		}
+		if err := config.ValidateContractAddresses(c); err != nil {
+			return nil, fmt.Errorf("contract '%s': %w", c.Name, err)
 		}
-		if c.ABI == "" {
+		if len(c.ABI) == 0 {
 			return nil, fmt.Errorf("contract '%s' missing abi path", c.Name)
 		}
+		for event, sm := range c.Sample {
+			if err := config.ValidateSample(sm); err != nil {
+				return nil, fmt.Errorf("contract '%s' sample.%s: %w", c.Name, event, err)
+			}
+		}
+		for event, r := range c.ExpectedRate {
+			if err := config.ValidateExpectedRate(r); err != nil {
+				return nil, fmt.Errorf("contract '%s' expected_rate.%s: %w", c.Name, event, err)
+			}
+		}
 
+		paths := make(config.ABIPaths, len(c.ABI))
+		for j, p := range c.ABI {
+			path, err := serverPath(filesDir, fmt.Sprintf("contract '%s' abi", c.Name), p)
+			if err != nil {
+				return nil, err
+			}
+			paths[j] = path
+		}
+		cfg.Contracts[i].ABI = paths
 		if err := parseABIFile(&cfg.Contracts[i]); err != nil {
 			return nil, err
 		}
+		for event := range c.Topics {
+			if !slices.Contains(c.Events, event) {
+				return nil, fmt.Errorf("contract '%s' topics.%s: event is not listed in events", c.Name, event)
+			}
+			if _, err := config.EventTopicFilter(cfg.Contracts[i], event); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if cfg.SignatureDB != "" {
+		path, err := serverPath(filesDir, "signature_db", cfg.SignatureDB)
+		if err != nil {
+			return nil, err
+		}
+		sigs, err := config.LoadSignatureDB(path)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Signatures = sigs
+	}
+
+	if cfg.ParseErrorsFile != "" {
+		path, err := serverPath(filesDir, "parse_errors_file", cfg.ParseErrorsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ParseErrorsFile = path
+	}
+
+	if cfg.Storage.CSV.OutputDir != "" {
+		path, err := serverPath(filesDir, "storage.csv.output_dir", cfg.Storage.CSV.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Storage.CSV.OutputDir = path
+	}
+
+	if cfg.Storage.Schema.File != "" {
+		path, err := serverPath(filesDir, "storage.schema.file", cfg.Storage.Schema.File)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Storage.Schema.File = path
+	}
+
+	if cfg.Storage.DeadLetter.Path != "" {
+		path, err := serverPath(filesDir, "storage.dead_letter.path", cfg.Storage.DeadLetter.Path)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Storage.DeadLetter.Path = path
+	}
+
+	if cfg.Storage.BigQuery.CredentialsFile != "" {
+		path, err := serverPath(filesDir, "storage.bigquery.credentials_file", cfg.Storage.BigQuery.CredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Storage.BigQuery.CredentialsFile = path
+	}
+
+	if cfg.Storage.Parquet.OutputDir != "" {
+		path, err := serverPath(filesDir, "storage.parquet.output_dir", cfg.Storage.Parquet.OutputDir)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Storage.Parquet.OutputDir = path
+	}
+
+	if cfg.StrictEvents && cfg.LenientEvents {
+		return nil, fmt.Errorf("strict_events and lenient_events are mutually exclusive")
+	}
+	if missing := config.MissingEvents(cfg.Contracts); len(missing) > 0 && !cfg.LenientEvents {
+		return nil, fmt.Errorf("%s (set lenient_events to only warn)", strings.Join(missing, "; "))
 	}
 
 	return cfg, nil
 }
 
-// parseABIFile loads and parses the ABI JSON file specified in the contract config.
-func parseABIFile(c *config.ContractConfig) error {
-	abiBytes, err := os.ReadFile(c.ABI)
+// serverPath resolves p, a server-side file named by the field of a request,
+// in dir (the working directory when empty). Paths leaving dir are rejected
+// so clients cannot make the server read or write arbitrary files.
+func serverPath(dir, field, p string) (string, error) {
+	if dir == "" {
+		dir = "."
+	}
+	root, err := filepath.Abs(dir)
 	if err != nil {
-		return fmt.Errorf("failed to read abi file for contract '%s': %w", c.Name, err)
+		return "", err
+	}
+	full := filepath.Clean(p)
+	if !filepath.IsAbs(full) {
+		full = filepath.Join(root, full)
 	}
-	parsed, err := abi.JSON(bytes.NewReader(abiBytes))
+	if rel, err := filepath.Rel(root, full); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s %q is outside the server's files directory", field, p)
+	}
+	return full, nil
+}
+
+// parseABIFile loads and parses the ABI JSON file(s) specified in the contract config.
+func parseABIFile(c *config.ContractConfig) error {
+	parsed, err := config.ParseABIFiles(c.ABI, c.Name)
 	if err != nil {
-		return fmt.Errorf("failed to parse abi for contract '%s': %w", c.Name, err)
+		return err
 	}
-	c.ParsedABI = &parsed
+	c.ParsedABI = parsed
 	return nil
 }
 
@@ -0,0 +1,524 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/indexer"
+)
+
+// jobRequest returns a JobRequest indexing the Transfer events of
+// tokenAddress on node into CSV files of the out directory of filesDir,
+// with the ABI of filesDir.
+func jobRequest(t *testing.T, node *fakeNode) JobRequest {
+	t.Helper()
+	req := JobRequest{
+		RPCURL: node.URL,
+		Contracts: []config.ContractConfig{{
+			Name:    "Token",
+			Address: tokenAddress.Hex(),
+			ABI:     config.ABIPaths{testABI},
+			Events:  []string{"Transfer"},
+		}},
+	}
+	req.Storage.Type = "csv"
+	req.Storage.CSV.OutputDir = "out"
+	return req
+}
+
+// jobBody returns jobRequest as a JSON object, for requests with fields
+// a JobRequest cannot hold.
+func jobBody(t *testing.T, node *fakeNode) map[string]any {
+	t.Helper()
+	data, err := json.Marshal(jobRequest(t, node))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]any
+	json.Unmarshal(data, &body)
+	return body
+}
+
+func TestBuildConfigWorkers(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	defaultWorkers := runtime.NumCPU()
+	if defaultWorkers > config.DefaultMaxWorkers {
+		defaultWorkers = config.DefaultMaxWorkers
+	}
+	for _, tc := range []struct {
+		name    string
+		workers int
+		want    int
+	}{
+		{name: "valid", workers: 4, want: 4},
+		{name: "zero", workers: 0, want: defaultWorkers},
+		{name: "oversized", workers: 1000, want: config.DefaultMaxWorkers},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := jobRequest(t, node)
+			req.Workers = tc.workers
+			cfg, err := buildConfigFromRequest(req, dir)
+			if err != nil {
+				t.Fatalf("buildConfigFromRequest: %v", err)
+			}
+			if cfg.Workers != tc.want {
+				t.Errorf("workers = %d, want %d", cfg.Workers, tc.want)
+			}
+		})
+	}
+}
+
+func TestCreateJobRejectsNegativeWorkers(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	for _, field := range []string{"workers", "enrich_workers", "queue_depth"} {
+		req := jobBody(t, node)
+		req[field] = -1
+		rec := postJSON(s, "/jobs", req)
+		if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), field+" must not be negative") {
+			t.Errorf("%s=-1: %d %s", field, rec.Code, rec.Body)
+		}
+	}
+	if n := len(s.jobs); n != 0 {
+		t.Errorf("%d jobs started for invalid requests", n)
+	}
+}
+
+// addJob registers a job that ran req and ended with status and progress.
+func addJob(s *Server, req JobRequest, status string, progress *indexer.Progress) string {
+	id := newUUID()
+	s.mu.Lock()
+	s.jobs[id] = &jobEntry{status: &JobStatus{JobID: id, Status: status, Progress: progress}, req: req}
+	s.mu.Unlock()
+	return id
+}
+
+// retried posts path and returns the request of the job it started, once
+// that job has ended.
+func retried(t *testing.T, s *Server, path string) JobRequest {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, path, nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST %s: %d %s", path, rec.Code, rec.Body)
+	}
+	var resp JobResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.RLock()
+		entry := s.jobs[resp.JobID]
+		req, status := entry.req, entry.status.Status
+		s.mu.RUnlock()
+		if isTerminal(status) {
+			return req
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s still %s", resp.JobID, status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRetryJobResume(t *testing.T) {
+	node := newFakeNode(t, 30)
+	for _, tc := range []struct {
+		name     string
+		start    config.BlockRef
+		overlap  uint64
+		progress *indexer.Progress
+		query    string
+		want     config.BlockRef
+	}{
+		{
+			name:     "after checkpoint",
+			progress: &indexer.Progress{Checkpoint: 20, Checkpointed: true},
+			query:    "?resume=true",
+			want:     config.BlockRef{Number: 21},
+		},
+		{
+			name:     "after genesis checkpoint",
+			progress: &indexer.Progress{Checkpoint: 0, Checkpointed: true},
+			query:    "?resume=true",
+			want:     config.BlockRef{Number: 1},
+		},
+		{
+			name:     "without checkpoint",
+			progress: &indexer.Progress{},
+			query:    "?resume=true",
+			want:     config.BlockRef{},
+		},
+		{
+			name:     "with overlap",
+			overlap:  5,
+			progress: &indexer.Progress{Checkpoint: 20, Checkpointed: true},
+			query:    "?resume=true",
+			want:     config.BlockRef{Number: 16},
+		},
+		{
+			name:     "from latest",
+			start:    config.BlockRef{Number: 10, FromLatest: true},
+			progress: &indexer.Progress{StartBlock: 15, Checkpoint: 20, Checkpointed: true},
+			query:    "?resume=true",
+			want:     config.BlockRef{Number: 21},
+		},
+		{
+			name:     "without resume",
+			progress: &indexer.Progress{Checkpoint: 20, Checkpointed: true},
+			want:     config.BlockRef{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewServer(Options{FilesDir: filesDir(t)})
+			req := jobRequest(t, node)
+			req.StartBlock = tc.start
+			req.ReindexOverlap = tc.overlap
+			id := addJob(s, req, "error", tc.progress)
+
+			got := retried(t, s, "/jobs/"+id+"/retry"+tc.query)
+			if got.StartBlock != tc.want {
+				t.Errorf("start_block = %+v, want %+v", got.StartBlock, tc.want)
+			}
+		})
+	}
+}
+
+func TestRetryRunningJobConflicts(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	id := addJob(s, jobRequest(t, newFakeNode(t, 30)), "running", nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs/"+id+"/retry", nil))
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestResumeJobFromBlock(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	req := jobRequest(t, node)
+	req.StartBlock = config.BlockRef{Number: 5}
+	req.EndBlock = &config.BlockRef{Number: 25}
+	id := addJob(s, req, "finished", &indexer.Progress{StartBlock: 5, EndBlock: 25, Checkpoint: 25, Checkpointed: true})
+
+	got := retried(t, s, "/jobs/"+id+"/resume?from_block=12")
+	if got.StartBlock != (config.BlockRef{Number: 12}) {
+		t.Errorf("start_block = %+v, want 12", got.StartBlock)
+	}
+	if got.EndBlock == nil || *got.EndBlock != *req.EndBlock || got.RPCURL != req.RPCURL || len(got.Contracts) != 1 {
+		t.Errorf("resumed request = %+v, want the stored request", got)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for jobID, entry := range s.jobs {
+		if jobID != id && entry.status.RetryOf != id {
+			t.Errorf("job %s retry_of = %q, want %s", jobID, entry.status.RetryOf, id)
+		}
+	}
+}
+
+func TestResumeJobRejects(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	fixed := jobRequest(t, node)
+	fixed.StartBlock = config.BlockRef{Number: 5}
+	fixed.EndBlock = &config.BlockRef{Number: 25}
+	fixedID := addJob(s, fixed, "error", &indexer.Progress{StartBlock: 5, EndBlock: 25})
+
+	// Up to the head: the end comes from the progress of the run.
+	toHead := jobRequest(t, node)
+	toHeadID := addJob(s, toHead, "finished", &indexer.Progress{EndBlock: 30})
+
+	fromLatest := jobRequest(t, node)
+	fromLatest.StartBlock = config.BlockRef{Number: 10, FromLatest: true}
+	fromLatestID := addJob(s, fromLatest, "cancelled", nil)
+
+	runningID := addJob(s, jobRequest(t, node), "running", nil)
+
+	for _, tc := range []struct {
+		name    string
+		path    string
+		code    int
+		wantErr string
+	}{
+		{"missing from_block", "/jobs/" + fixedID + "/resume", http.StatusBadRequest, "from_block is required"},
+		{"not a number", "/jobs/" + fixedID + "/resume?from_block=latest", http.StatusBadRequest, "invalid from_block"},
+		{"before start", "/jobs/" + fixedID + "/resume?from_block=4", http.StatusBadRequest, "before the job's start block 5"},
+		{"after end", "/jobs/" + fixedID + "/resume?from_block=26", http.StatusBadRequest, "after the job's end block 25"},
+		{"after resolved end", "/jobs/" + toHeadID + "/resume?from_block=31", http.StatusBadRequest, "after the job's end block 30"},
+		{"unresolved start", "/jobs/" + fromLatestID + "/resume?from_block=20", http.StatusBadRequest, "range is unknown"},
+		{"running", "/jobs/" + runningID + "/resume?from_block=10", http.StatusConflict, "cannot be retried"},
+		{"unknown job", "/jobs/" + newUUID() + "/resume?from_block=10", http.StatusNotFound, "job not found"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, tc.path, nil))
+			if rec.Code != tc.code || !strings.Contains(rec.Body.String(), tc.wantErr) {
+				t.Fatalf("POST %s = %d %q, want %d %q", tc.path, rec.Code, rec.Body, tc.code, tc.wantErr)
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+fixedID+"/resume?from_block=10", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET resume = %d, want 405", rec.Code)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.jobs) != 4 {
+		t.Errorf("%d jobs registered, want no new job from rejected resumes", len(s.jobs))
+	}
+}
+
+func TestValidateResumeBlockFollow(t *testing.T) {
+	req := JobRequest{StartBlock: config.BlockRef{Number: 5}, Follow: true}
+	if err := validateResumeBlock(req, &indexer.Progress{StartBlock: 5, EndBlock: 30}, 1_000); err != nil {
+		t.Errorf("follow job: %v, want no upper bound", err)
+	}
+	if err := validateResumeBlock(req, nil, 4); err == nil {
+		t.Error("follow job accepted a block before its start")
+	}
+}
+
+func TestBuildConfigSignatureDBInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	db := `{"` + transferID.Hex() + `": "Transfer(address,address,uint256)"}`
+	if err := os.WriteFile(filepath.Join(dir, "signatures.json"), []byte(db), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := jobRequest(t, node)
+	req.SignatureDB = "signatures.json"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if cfg.Signatures[transferID] != "Transfer(address,address,uint256)" {
+		t.Errorf("signatures = %v", cfg.Signatures)
+	}
+
+	req.SignatureDB = "../signatures.json"
+	if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "signature_db") {
+		t.Errorf("signature_db outside the files directory: %v", err)
+	}
+}
+
+func TestBuildConfigParseErrorsFileInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+	req.ParseErrorsFile = "out/parse_errors.csv"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "out", "parse_errors.csv"); cfg.ParseErrorsFile != want {
+		t.Errorf("parse_errors_file = %s, want %s", cfg.ParseErrorsFile, want)
+	}
+
+	for _, path := range []string{"/tmp/parse_errors.csv", "../parse_errors.csv"} {
+		req.ParseErrorsFile = path
+		if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "parse_errors_file") {
+			t.Errorf("parse_errors_file %s: %v", path, err)
+		}
+	}
+}
+
+func TestBuildConfigCSVOutputDirInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "out"); cfg.Storage.CSV.OutputDir != want {
+		t.Errorf("output_dir = %s, want %s", cfg.Storage.CSV.OutputDir, want)
+	}
+
+	for _, path := range []string{"/tmp", "../out", "out/../.."} {
+		req.Storage.CSV.OutputDir = path
+		if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "storage.csv.output_dir") {
+			t.Errorf("output_dir %s: %v", path, err)
+		}
+	}
+}
+
+func TestBuildConfigSchemaFileInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+	req.Storage.Schema.File = "schemas/token.json"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "schemas", "token.json"); cfg.Storage.Schema.File != want {
+		t.Errorf("schema file = %s, want %s", cfg.Storage.Schema.File, want)
+	}
+
+	for _, path := range []string{"/etc/passwd", "../schema.json"} {
+		req.Storage.Schema.File = path
+		if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "storage.schema.file") {
+			t.Errorf("schema file %s: %v", path, err)
+		}
+	}
+}
+
+func TestBuildConfigDeadLetterPathInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+	req.Storage.DeadLetter.Path = "out/dead_letter.jsonl"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "out", "dead_letter.jsonl"); cfg.Storage.DeadLetter.Path != want {
+		t.Errorf("dead_letter.path = %s, want %s", cfg.Storage.DeadLetter.Path, want)
+	}
+
+	for _, path := range []string{"/var/log/dead_letter.jsonl", "../dead_letter.jsonl"} {
+		req.Storage.DeadLetter.Path = path
+		if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "storage.dead_letter.path") {
+			t.Errorf("dead_letter.path %s: %v", path, err)
+		}
+	}
+}
+
+func TestBuildConfigBigQueryCredentialsInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+	req.Storage.BigQuery.CredentialsFile = "keys/sa.json"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "keys", "sa.json"); cfg.Storage.BigQuery.CredentialsFile != want {
+		t.Errorf("credentials_file = %s, want %s", cfg.Storage.BigQuery.CredentialsFile, want)
+	}
+
+	for _, path := range []string{"/root/.config/gcloud/application_default_credentials.json", "../sa.json"} {
+		req.Storage.BigQuery.CredentialsFile = path
+		if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "storage.bigquery.credentials_file") {
+			t.Errorf("credentials_file %s: %v", path, err)
+		}
+	}
+}
+
+func TestBuildConfigParquetOutputDirInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+	req.Storage.Parquet.OutputDir = "parquet"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "parquet"); cfg.Storage.Parquet.OutputDir != want {
+		t.Errorf("parquet output_dir = %s, want %s", cfg.Storage.Parquet.OutputDir, want)
+	}
+
+	for _, path := range []string{"/tmp", "../parquet"} {
+		req.Storage.Parquet.OutputDir = path
+		if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "storage.parquet.output_dir") {
+			t.Errorf("parquet output_dir %s: %v", path, err)
+		}
+	}
+}
+
+func TestBuildConfigTLSSettings(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	req := jobRequest(t, node)
+
+	req.RPCTransport.InsecureSkipVerify = true
+	if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "insecure_skip_verify") {
+		t.Errorf("insecure_skip_verify: %v", err)
+	}
+	req.RPCTransport.InsecureSkipVerify = false
+
+	req.RPCTransport.CACertFile = "certs/node-ca.pem"
+	cfg, err := buildConfigFromRequest(req, dir)
+	if err != nil {
+		t.Fatalf("buildConfigFromRequest: %v", err)
+	}
+	if want := filepath.Join(dir, "certs", "node-ca.pem"); cfg.RPCTransport.CACertFile != want {
+		t.Errorf("ca_cert_file = %s, want %s", cfg.RPCTransport.CACertFile, want)
+	}
+	req.RPCTransport.CACertFile = "/etc/ssl/private/key.pem"
+	if _, err := buildConfigFromRequest(req, dir); err == nil || !strings.Contains(err.Error(), "ca_cert_file") {
+		t.Errorf("ca_cert_file outside the files directory: %v", err)
+	}
+}
+
+func TestBuildConfigRejectsEventsMissingFromABI(t *testing.T) {
+	node := newFakeNode(t, 30)
+	req := jobRequest(t, node)
+	req.Contracts[0].Events = []string{"Transfer", "Approval"}
+	if _, err := buildConfigFromRequest(req, filesDir(t)); err == nil || !strings.Contains(err.Error(), "events not found in ABI: Approval") {
+		t.Fatalf("buildConfigFromRequest = %v, want the missing Approval event", err)
+	}
+
+	req.LenientEvents = true
+	if _, err := buildConfigFromRequest(req, filesDir(t)); err != nil {
+		t.Fatalf("with lenient_events: %v", err)
+	}
+
+	req.StrictEvents = true
+	if _, err := buildConfigFromRequest(req, filesDir(t)); err == nil || !strings.Contains(err.Error(), "mutually exclusive") {
+		t.Fatalf("strict and lenient events: %v", err)
+	}
+}
+
+func TestCreateJobWithEventsMissingFromABI(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	s := NewServer(Options{FilesDir: filesDir(t)})
+
+	// Rejected before the job starts by default.
+	body := jobBody(t, node)
+	body["contracts"].([]any)[0].(map[string]any)["events"] = []string{"Transfer", "Approval"}
+	rec := postJSON(s, "/jobs", body)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "events not found in ABI: Approval") {
+		t.Fatalf("POST /jobs: %d %s, want 400 naming Approval", rec.Code, rec.Body)
+	}
+
+	// With lenient_events the job runs and its status carries the warning.
+	body["lenient_events"] = true
+	rec = postJSON(s, "/jobs", body)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /jobs with lenient_events: %d %s", rec.Code, rec.Body)
+	}
+	var resp JobResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	waitStatus(t, s, resp.JobID, "finished")
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+resp.JobID, nil))
+	var status JobStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if len(status.Warnings) != 1 || status.Warnings[0] != "contract 'Token': events not found in ABI: Approval" {
+		t.Errorf("warnings = %q", status.Warnings)
+	}
+	if status.Summary == nil || status.Summary.Events["Transfer"] != 1 {
+		t.Errorf("summary = %+v, want the Transfer event indexed", status.Summary)
+	}
+}
@@ -0,0 +1,68 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"etl-web3/internal/indexer"
+)
+
+// jobMetricsOf returns the GET /jobs/{id}/metrics answer of s.
+func jobMetricsOf(t *testing.T, s *Server, id string) (int, JobMetrics) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+id+"/metrics", nil))
+	var m JobMetrics
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &m); err != nil {
+			t.Fatalf("metrics %s: %v", rec.Body, err)
+		}
+	}
+	return rec.Code, m
+}
+
+func TestJobMetricsOfFinishedJob(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10), transferLog(12, 0, 20))
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	id := addJobRequest(t, s, node)
+	waitStatus(t, s, id, "finished")
+
+	code, m := jobMetricsOf(t, s, id)
+	if code != http.StatusOK {
+		t.Fatalf("GET metrics: %d", code)
+	}
+	if m.JobID != id || m.Status != "finished" || m.EndBlock != 30 || m.CurrentBlock != 30 || m.Checkpoint != 30 ||
+		m.BlocksProcessed != 31 || m.EventsWritten != 2 {
+		t.Errorf("metrics = %+v", m)
+	}
+	if m.ElapsedSeconds <= 0 {
+		t.Errorf("elapsed_seconds = %f, want the duration of the run", m.ElapsedSeconds)
+	}
+	// The fake node does not serve transactions, so the best-effort tx_from
+	// lookups of the two events fail.
+	if m.RPC.Calls < 4 || m.RPC.Failures != 2 || m.RPC.Retries != 0 {
+		t.Errorf("rpc = %+v", m.RPC)
+	}
+}
+
+func TestJobMetricsOfRestoredJob(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	progress := &indexer.Progress{EndBlock: 90, CurrentBlock: 60, Checkpoint: 49, Checkpointed: true, BlocksProcessed: 50, EventsWritten: 7, BlocksPerSecond: 2.5}
+	id := addJob(s, jobRequest(t, node), "interrupted", progress)
+
+	code, m := jobMetricsOf(t, s, id)
+	if code != http.StatusOK {
+		t.Fatalf("GET metrics: %d", code)
+	}
+	want := JobMetrics{JobID: id, Status: "interrupted", CurrentBlock: 60, Checkpoint: 49, EndBlock: 90, BlocksProcessed: 50, EventsWritten: 7, BlocksPerSecond: 2.5}
+	if m != want {
+		t.Errorf("metrics = %+v, want %+v with no RPC counts", m, want)
+	}
+
+	if code, _ := jobMetricsOf(t, s, "unknown"); code != http.StatusNotFound {
+		t.Errorf("metrics of an unknown job: %d", code)
+	}
+}
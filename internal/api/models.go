@@ -4,17 +4,65 @@ import (
 	"time"
 
 	"etl-web3/internal/config"
+	"etl-web3/internal/indexer"
+	"etl-web3/internal/rpc"
 )
 
 // JobRequest mirrors the structure of config.Config but is tagged for JSON
 // decoding so it can be received directly from HTTP requests.
 type JobRequest struct {
-    RPCURL     string                    `json:"rpc_url"`
-    StartBlock uint64                    `json:"start_block"`
-    Contracts  []config.ContractConfig   `json:"contracts"`
-    Storage    config.StorageConfig      `json:"storage"`
-    Retry      config.RetryConfig        `json:"retry"`
-    ChunkSize  uint64                    `json:"chunk_size"`
+    RPCURL        string                  `json:"rpc_url"`
+    RPCWSURL      string                  `json:"rpc_ws_url"` // ws(s):// endpoint for follow mode subscriptions
+    StartBlock    config.BlockRef         `json:"start_block"` // number, "latest" or "latest-N"
+    EndBlock      *config.BlockRef        `json:"end_block,omitempty"` // last block; the head at start when omitted
+    Contracts     []config.ContractConfig `json:"contracts"`
+    Storage       config.StorageConfig    `json:"storage"`
+    Transforms    []config.TransformConfig `json:"transforms"`
+    ExcludeAddresses []string             `json:"exclude_addresses"`
+    StrictEvents  bool                    `json:"strict_events"` // kept for compatibility: events missing from the ABI are rejected by default
+    LenientEvents bool                    `json:"lenient_events"` // warn about events missing from the ABI instead of rejecting the job
+    Retry         config.RetryConfig      `json:"retry"`
+    RPCTimeoutMS  int                     `json:"rpc_timeout_ms"`
+    RPCUserAgent  string                  `json:"rpc_user_agent"`
+    RPCTransport  config.RPCTransportConfig `json:"rpc_transport"`
+    ChunkSize     uint64                  `json:"chunk_size"`
+    CatchupChunkSize uint64               `json:"catchup_chunk_size"` // range size far from the head (default chunk_size)
+    TipThreshold  uint64                  `json:"tip_threshold"`       // blocks below the head where chunk_size takes over
+    TipPollIntervalMS int                 `json:"tip_poll_interval_ms"`
+    MaxRPCRange   uint64                  `json:"max_rpc_range"`
+    Workers       int                     `json:"workers"`
+    EnrichWorkers int                     `json:"enrich_workers"`
+    QueueDepth    int                     `json:"queue_depth"`
+    DecodeTxInput bool                    `json:"decode_tx_input"`
+    EnrichReceipt bool                    `json:"enrich_receipt"`
+    InlineTimestamps bool                 `json:"inline_timestamps"`
+    SignatureDB   string                  `json:"signature_db"` // path in the server's files directory, like abi paths
+    ParseErrorsFile string                `json:"parse_errors_file"` // CSV in the server's files directory receiving logs that fail to decode
+    IndexBlocks   bool                    `json:"index_blocks"`
+    IndexTraces   bool                    `json:"index_traces"` // needs trace_block or debug_traceBlockByNumber
+    NoCodeLogs    string                  `json:"no_code_logs"` // keep | flag | skip
+    Follow        bool                    `json:"follow"` // keep running until cancelled (WebSocket rpc_url)
+    FollowConfirmations uint64            `json:"follow_confirmations"` // blocks a live log waits before it is written
+    OnError       string                  `json:"on_error"` // abort | continue
+    RetryFailedRanges bool                `json:"retry_failed_ranges"`
+    ReindexOverlap    uint64              `json:"reindex_overlap"` // blocks re-scanned before the checkpoint on retry with resume
+}
+
+// JobMetrics is the per-job metrics snapshot served by GET /jobs/{id}/metrics.
+type JobMetrics struct {
+    JobID           string    `json:"job_id"`
+    Status          string    `json:"status"`
+    CurrentBlock    uint64    `json:"current_block"`
+    Checkpoint      uint64    `json:"checkpoint"`
+    EndBlock        uint64    `json:"end_block"`
+    BlocksProcessed uint64    `json:"blocks_processed"`
+    EventsWritten   int       `json:"events_written"`
+    BlocksPerSecond float64   `json:"blocks_per_second"`
+    EventsPerSecond float64   `json:"events_per_second"`
+    ElapsedSeconds  float64   `json:"elapsed_seconds"`
+    // RPC counts the calls made by the job's own client. It is zero for
+    // jobs restored from the job store.
+    RPC             rpc.Stats `json:"rpc"`
 }
 
 // JobResponse is returned after a successful job creation.
@@ -25,8 +73,19 @@ type JobResponse struct {
 // JobStatus represents the runtime state of a launched job.
 type JobStatus struct {
     JobID      string     `json:"job_id"`
-    Status     string     `json:"status"` // queued | running | finished | error | cancelled
+    Status     string     `json:"status"` // queued | running | finished | error | cancelled | interrupted
     Error      string     `json:"error,omitempty"`
     StartedAt  time.Time  `json:"started_at,omitempty"`
     FinishedAt *time.Time `json:"finished_at,omitempty"`
+    // RetryOf is the ID of the job this one re-runs (POST /jobs/{id}/retry
+    // or /jobs/{id}/resume).
+    RetryOf    string     `json:"retry_of,omitempty"`
+    // Progress is updated after every completed block range.
+    Progress   *indexer.Progress `json:"progress,omitempty"`
+    // Warnings lists configuration problems that did not prevent the job
+    // from running, such as events missing from an ABI.
+    Warnings   []string   `json:"warnings,omitempty"`
+    // Summary is populated once the job finishes, including runs that end
+    // with failed ranges in on_error: continue mode.
+    Summary    *indexer.Summary `json:"summary,omitempty"`
 } 
\ No newline at end of file
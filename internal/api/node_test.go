@@ -0,0 +1,160 @@
+package api
+
+import (
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// transferABI is the ABI of the ERC-20 Transfer event.
+const transferABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]}]`
+
+var (
+	tokenAddress = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+	transferID   = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// testABI is the name of the ABI file of test requests in the server's
+// files directory.
+const testABI = "token.json"
+
+// filesDir returns a server files directory holding testABI.
+func filesDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	writeABI(t, dir)
+	return dir
+}
+
+// writeABI writes transferABI to a file of dir and returns its path.
+func writeABI(t *testing.T, dir string) string {
+	t.Helper()
+	path := filepath.Join(dir, testABI)
+	if err := os.WriteFile(path, []byte(transferABI), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// transferLog returns a Transfer log of value emitted by tokenAddress.
+func transferLog(block uint64, index uint, value int64) types.Log {
+	return types.Log{
+		Address:     tokenAddress,
+		Topics:      []common.Hash{transferID, common.HexToHash("0x01"), common.HexToHash("0x02")},
+		Data:        common.LeftPadBytes(big.NewInt(value).Bytes(), 32),
+		BlockNumber: block,
+		TxHash:      common.BigToHash(new(big.Int).SetUint64(block*1000 + uint64(index))),
+		Index:       index,
+	}
+}
+
+// fakeNode is a JSON-RPC endpoint serving a chain of head+1 blocks and the
+// given logs. Setting failLogs makes eth_getLogs fail; setting hold delays
+// its answers until hold is closed.
+type fakeNode struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	head     uint64
+	logs     []types.Log
+	failLogs bool
+	hold     chan struct{}
+}
+
+func newFakeNode(t *testing.T, head uint64, logs ...types.Log) *fakeNode {
+	t.Helper()
+	n := &fakeNode{head: head, logs: logs}
+	n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+	t.Cleanup(n.Close)
+	return n
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		ID     json.RawMessage   `json:"id"`
+		Method string            `json:"method"`
+		Params []json.RawMessage `json:"params"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Method == "eth_getLogs" {
+		n.mu.Lock()
+		hold := n.hold
+		n.mu.Unlock()
+		if hold != nil {
+			<-hold
+		}
+	}
+	resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+	if result, err := n.answer(req.Method, req.Params); err != nil {
+		resp["error"] = err
+	} else {
+		resp["result"] = result
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// nodeError is a JSON-RPC error answer.
+type nodeError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (n *fakeNode) answer(method string, params []json.RawMessage) (any, *nodeError) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	switch method {
+	case "eth_blockNumber":
+		return hexutil.Uint64(n.head), nil
+	case "eth_chainId":
+		return hexutil.Uint64(1), nil
+	case "eth_getBlockByNumber":
+		var num hexutil.Uint64
+		if err := json.Unmarshal(params[0], &num); err != nil {
+			num = hexutil.Uint64(n.head)
+		}
+		if uint64(num) > n.head {
+			return nil, nil
+		}
+		return &types.Header{
+			Number:     new(big.Int).SetUint64(uint64(num)),
+			Time:       1_700_000_000 + uint64(num)*12,
+			Difficulty: big.NewInt(0),
+		}, nil
+	case "eth_getLogs":
+		if n.failLogs {
+			return nil, &nodeError{Code: -32000, Message: "backend unavailable"}
+		}
+		var q struct {
+			FromBlock hexutil.Uint64 `json:"fromBlock"`
+			ToBlock   hexutil.Uint64 `json:"toBlock"`
+		}
+		if err := json.Unmarshal(params[0], &q); err != nil {
+			return nil, &nodeError{Code: -32602, Message: err.Error()}
+		}
+		out := []types.Log{}
+		for _, lg := range n.logs {
+			if lg.BlockNumber >= uint64(q.FromBlock) && lg.BlockNumber <= uint64(q.ToBlock) {
+				out = append(out, lg)
+			}
+		}
+		return out, nil
+	}
+	return nil, &nodeError{Code: -32601, Message: "the method " + method + " does not exist/is not available"}
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"etl-web3/internal/sink"
+)
+
+// jobOutput handles GET /jobs/{id}/output?event=<name>[&contract=<name>],
+// streaming the CSV file a job produced for one event type. contract is only
+// needed when several contracts emitted the same event.
+func (s *Server) jobOutput(w http.ResponseWriter, r *http.Request, id string) {
+	s.mu.RLock()
+	entry, ok := s.jobs[id]
+	var req JobRequest
+	if ok {
+		req = entry.req
+	}
+	s.mu.RUnlock()
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	if req.Storage.CSV.OutputDir == "" || !usesCSV(req) {
+		http.Error(w, "job has no csv output", http.StatusNotFound)
+		return
+	}
+	// Resolved as the job resolved it when it was created.
+	dir, err := serverPath(s.opts.FilesDir, "storage.csv.output_dir", req.Storage.CSV.OutputDir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if req.Storage.CSV.FileNameTemplate != "" {
+		http.Error(w, "output download is not available with a custom file_name_template", http.StatusNotImplemented)
+		return
+	}
+
+	event := r.URL.Query().Get("event")
+	contract := r.URL.Query().Get("contract")
+	if !safeFileComponent(event) || (contract != "" && !safeFileComponent(contract)) {
+		http.Error(w, "invalid event or contract name", http.StatusBadRequest)
+		return
+	}
+
+	if !acceptsCSV(r.Header.Get("Accept")) {
+		http.Error(w, "output is only available as text/csv", http.StatusNotAcceptable)
+		return
+	}
+
+	name, status, err := csvFileName(dir, contract, event)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	f, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		http.Error(w, "output file not found", http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	// Large files may take longer than the server-wide WriteTimeout.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	contentType := "text/csv; charset=utf-8"
+	if req.Storage.CSV.Delimiter == "\t" {
+		contentType = "text/tab-separated-values; charset=utf-8"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// usesCSV reports whether the job writes CSV files, as primary or mirror.
+func usesCSV(req JobRequest) bool {
+	if req.Storage.Type == "csv" {
+		return true
+	}
+	for _, m := range req.Storage.Mirror {
+		if m == "csv" {
+			return true
+		}
+	}
+	return false
+}
+
+// csvFileName resolves the file of event inside dir. Without a contract the
+// event must match exactly one "<contract>_<event>.csv" file. On failure it
+// returns the HTTP status to reply with.
+func csvFileName(dir, contract, event string) (string, int, error) {
+	if contract != "" || event == sink.BlockEventName || event == sink.TraceEventName {
+		return sink.CSVKey(contract, event) + ".csv", http.StatusOK, nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", http.StatusNotFound, fmt.Errorf("output directory not found")
+	}
+	suffix := "_" + event + ".csv"
+	var matches []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), suffix) && len(e.Name()) > len(suffix) {
+			matches = append(matches, e.Name())
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", http.StatusNotFound, fmt.Errorf("no output for event %s", event)
+	case 1:
+		return matches[0], http.StatusOK, nil
+	default:
+		return "", http.StatusBadRequest, fmt.Errorf("event %s was written by several contracts (%s); pass contract=", event, strings.Join(matches, ", "))
+	}
+}
+
+// safeFileComponent rejects names that could escape the output directory.
+func safeFileComponent(name string) bool {
+	return name != "" && name != "." && name != ".." &&
+		!strings.ContainsAny(name, `/\`+"\x00") &&
+		filepath.Base(name) == name
+}
+
+// acceptsCSV reports whether an Accept header allows a CSV response. A
+// missing header accepts anything.
+func acceptsCSV(accept string) bool {
+	if accept == "" {
+		return true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if q := params["q"]; q == "0" || q == "0.0" || q == "0.00" || q == "0.000" {
+			continue
+		}
+		switch mediaType {
+		case "text/csv", "text/tab-separated-values", "text/*", "*/*":
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestJobOutputReadsOutputDirInFilesDir(t *testing.T) {
+	node := newFakeNode(t, 30)
+	dir := filesDir(t)
+	s := NewServer(Options{FilesDir: dir})
+	if err := os.MkdirAll(filepath.Join(dir, "out"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "out", "Token_Transfer.csv"), []byte("block_number\n7\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(id string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/jobs/"+id+"/output?event=Transfer", nil)
+		r.Header.Set("Accept", "text/csv")
+		s.mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := get(addJob(s, jobRequest(t, node), "finished", nil))
+	if rec.Code != http.StatusOK || rec.Body.String() != "block_number\n7\n" {
+		t.Fatalf("GET output: %d %q", rec.Code, rec.Body)
+	}
+
+	// A job stored with a directory outside the files directory (e.g. by
+	// an older server) serves nothing from it.
+	req := jobRequest(t, node)
+	req.Storage.CSV.OutputDir = filepath.Join(dir, "..")
+	if rec := get(addJob(s, req, "finished", nil)); rec.Code != http.StatusNotFound {
+		t.Fatalf("GET output outside the files directory: %d %q", rec.Code, rec.Body)
+	}
+}
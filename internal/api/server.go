@@ -2,47 +2,287 @@ package api
 
 import (
 	"context"
+	"crypto/subtle"
+	"expvar"
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/rpc"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Default limits applied when the corresponding Options field is zero.
+const (
+	DefaultMaxBodyBytes = 1 << 20 // 1 MiB
+	DefaultReadTimeout  = 15 * time.Second
+	DefaultWriteTimeout = 30 * time.Second
+	DefaultIdleTimeout  = 60 * time.Second
+)
+
+// Options tunes the HTTP server limits. Zero values select the defaults.
+type Options struct {
+	// MaxBodyBytes caps request bodies; larger requests get 413.
+	MaxBodyBytes int64
+	ReadTimeout  time.Duration
+	// WriteTimeout bounds regular responses. SSE streams lift it for their
+	// own connection.
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+	// Tokens enables bearer-token authentication: every request must carry
+	// "Authorization: Bearer <token>" matching one of them. Empty disables it.
+	Tokens []string
+	// Store persists the job registry across restarts. Nil keeps jobs in
+	// memory only.
+	Store JobStore
+	// MaxConcurrentJobs limits the jobs running at once; further jobs stay
+	// queued until a slot frees. Zero means unlimited.
+	MaxConcurrentJobs int
+	// TLSCertFile and TLSKeyFile serve HTTPS when both are set.
+	TLSCertFile string
+	TLSKeyFile  string
+	// RedirectPort, with TLS enabled, also listens for plain HTTP on this
+	// port and redirects every request to HTTPS. Empty disables it.
+	RedirectPort string
+	// FilesDir is the directory server-side files named by requests, such
+	// as ABI paths, are resolved in; paths leaving it are rejected. Empty
+	// means the working directory.
+	FilesDir string
+}
+
 // Server encapsulates the HTTP server, router and job registry.
 type Server struct {
-	mux *http.ServeMux
-	mu  sync.RWMutex
+	mux  *http.ServeMux
+	mu   sync.RWMutex
 	jobs map[string]*jobEntry
+	opts Options
+	// slots is a semaphore of MaxConcurrentJobs running jobs (nil: unlimited).
+	slots chan struct{}
 }
 
 type jobEntry struct {
 	status *JobStatus
+	req    JobRequest // original request, re-run by POST /jobs/{id}/retry
 	cancel context.CancelFunc // allows cancellation via DELETE /jobs/{id}
+	client *rpc.Client // counts the job's RPC calls for GET /jobs/{id}/metrics
+	// subscribers receive a copy of the status on every change (GET /jobs/{id}/stream).
+	subscribers map[chan JobStatus]struct{}
+	// savedAt and savedStatus throttle persistence of progress updates.
+	savedAt     time.Time
+	savedStatus string
 }
 
+// persistInterval bounds how often progress-only changes of a job are saved.
+const persistInterval = time.Second
+
 // NewServer builds a server with basic logging and panic recovery middlewares.
-func NewServer() *Server {
+func NewServer(opts Options) *Server {
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if opts.ReadTimeout <= 0 {
+		opts.ReadTimeout = DefaultReadTimeout
+	}
+	if opts.WriteTimeout <= 0 {
+		opts.WriteTimeout = DefaultWriteTimeout
+	}
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+
 	mux := http.NewServeMux()
 	s := &Server{
 		mux:  mux,
 		jobs: make(map[string]*jobEntry),
+		opts: opts,
+	}
+	if opts.MaxConcurrentJobs > 0 {
+		s.slots = make(chan struct{}, opts.MaxConcurrentJobs)
 	}
+	s.loadJobs()
 	s.registerRoutes()
 	return s
 }
 
+// acquireSlot blocks until a running-job slot is free. It returns false if
+// ctx is cancelled first.
+func (s *Server) acquireSlot(ctx context.Context) bool {
+	if s.slots == nil {
+		return true
+	}
+	select {
+	case s.slots <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// releaseSlot frees a slot taken by acquireSlot.
+func (s *Server) releaseSlot() {
+	if s.slots != nil {
+		<-s.slots
+	}
+}
+
+// loadJobs restores the registry from the store. Jobs that were still queued
+// or running when the previous process stopped are marked interrupted; they
+// can be re-run with POST /jobs/{id}/retry.
+func (s *Server) loadJobs() {
+	if s.opts.Store == nil {
+		return
+	}
+	stored, err := s.opts.Store.Load()
+	if err != nil {
+		logrus.Errorf("failed to load jobs: %v", err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sj := range stored {
+		status := sj.Status
+		entry := &jobEntry{status: &status, req: sj.Request, savedStatus: status.Status}
+		s.jobs[status.JobID] = entry
+		if !isTerminal(status.Status) {
+			status.Status = "interrupted"
+			status.Error = "API restarted while the job was running"
+			finished := time.Now()
+			status.FinishedAt = &finished
+			s.saveLocked(entry)
+		}
+	}
+	logrus.Infof("Loaded %d jobs from store", len(stored))
+}
+
+// saveLocked persists the job. It must be called with s.mu held. Progress
+// updates are saved at most once per persistInterval; status changes always.
+func (s *Server) saveLocked(entry *jobEntry) {
+	if s.opts.Store == nil {
+		return
+	}
+	if entry.status.Status == entry.savedStatus && time.Since(entry.savedAt) < persistInterval {
+		return
+	}
+
+	req := entry.req
+	// Parsed ABIs are rebuilt from the request when the job is retried.
+	req.Contracts = make([]config.ContractConfig, len(entry.req.Contracts))
+	for i, c := range entry.req.Contracts {
+		c.ParsedABI = nil
+		req.Contracts[i] = c
+	}
+	if err := s.opts.Store.Save(StoredJob{Status: *entry.status, Request: req}); err != nil {
+		logrus.Warnf("failed to persist job %s: %v", entry.status.JobID, err)
+		return
+	}
+	entry.savedAt = time.Now()
+	entry.savedStatus = entry.status.Status
+}
+
 func (s *Server) registerRoutes() {
-	s.mux.HandleFunc("/jobs", s.handleJobs)              // POST /jobs
-	s.mux.HandleFunc("/jobs/", s.handleJobByID)          // GET/DELETE /jobs/{id}
+	s.mux.Handle("/jobs", s.authMiddleware(http.HandlerFunc(s.handleJobs)))      // POST /jobs
+	s.mux.Handle("/jobs/stream", s.authMiddleware(http.HandlerFunc(s.handleJobStream))) // POST /jobs/stream
+	s.mux.Handle("/jobs/", s.authMiddleware(http.HandlerFunc(s.handleJobByID)))  // GET/DELETE /jobs/{id}, GET /jobs/{id}/stream, GET /jobs/{id}/metrics, GET /jobs/{id}/output, POST /jobs/{id}/retry, POST /jobs/{id}/resume
+	s.mux.Handle("/version", s.authMiddleware(http.HandlerFunc(s.handleVersion))) // GET /version
+	s.mux.Handle("/abi/events", s.authMiddleware(http.HandlerFunc(s.handleABIEvents))) // POST /abi/events
+	s.mux.Handle("/decode", s.authMiddleware(http.HandlerFunc(s.handleDecode)))         // POST /decode
+	s.mux.Handle("/storage/types", s.authMiddleware(http.HandlerFunc(s.handleStorageTypes))) // GET /storage/types
+	s.mux.Handle("/debug/vars", s.authMiddleware(expvar.Handler()))             // process metrics (expvar JSON)
+	s.mux.Handle("/debug/rpc", s.authMiddleware(http.HandlerFunc(s.handleDebugRPC))) // GET /debug/rpc
 }
 
-// Run starts the HTTP server on the provided port.
+// Run starts the HTTP server on the provided port, over TLS when a
+// certificate and key are configured.
 func (s *Server) Run(port string) error {
 	addr := fmt.Sprintf(":%s", port)
-	handler := s.recoveryMiddleware(s.loggingMiddleware(s.mux))
-	logrus.Infof("HTTP server running on %s", addr)
-	return http.ListenAndServe(addr, handler)
+	handler := s.recoveryMiddleware(s.loggingMiddleware(s.compressionMiddleware(s.mux)))
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.opts.ReadTimeout,
+		ReadTimeout:       s.opts.ReadTimeout,
+		WriteTimeout:      s.opts.WriteTimeout,
+		IdleTimeout:       s.opts.IdleTimeout,
+	}
+	if s.opts.TLSCertFile == "" && s.opts.TLSKeyFile == "" {
+		logrus.Infof("HTTP server running on %s", addr)
+		return srv.ListenAndServe()
+	}
+	if s.opts.TLSCertFile == "" || s.opts.TLSKeyFile == "" {
+		return fmt.Errorf("TLS needs both a certificate and a key file")
+	}
+	if s.opts.RedirectPort != "" {
+		go s.runRedirect(port)
+	}
+	logrus.Infof("HTTPS server running on %s", addr)
+	return srv.ListenAndServeTLS(s.opts.TLSCertFile, s.opts.TLSKeyFile)
+}
+
+// runRedirect serves plain HTTP on RedirectPort, sending every request to the
+// same host and path on the HTTPS port.
+func (s *Server) runRedirect(tlsPort string) {
+	addr := fmt.Sprintf(":%s", s.opts.RedirectPort)
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           redirect,
+		ReadHeaderTimeout: s.opts.ReadTimeout,
+		ReadTimeout:       s.opts.ReadTimeout,
+		WriteTimeout:      s.opts.WriteTimeout,
+		IdleTimeout:       s.opts.IdleTimeout,
+	}
+	logrus.Infof("HTTP redirect to HTTPS running on %s", addr)
+	if err := srv.ListenAndServe(); err != nil {
+		logrus.Errorf("HTTP redirect server stopped: %v", err)
+	}
+}
+
+// authMiddleware rejects requests without a valid bearer token with 401. It
+// is a no-op when no token is configured.
+func (s *Server) authMiddleware(next http.Handler) http.Handler {
+	if len(s.opts.Tokens) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !s.validToken(strings.TrimSpace(token)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="etl-web3"`)
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validToken compares token against every configured token in constant time.
+func (s *Server) validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	valid := false
+	for _, t := range s.opts.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+			valid = true
+		}
+	}
+	return valid
 }
 
 // Simple request logger middleware.
@@ -0,0 +1,259 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"etl-web3/internal/indexer"
+	"etl-web3/internal/version"
+)
+
+// jobStatus returns the status of job id.
+func jobStatus(s *Server, id string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.jobs[id].status.Status
+}
+
+// waitStatus polls job id until its status is one of want.
+func waitStatus(t *testing.T, s *Server, id string, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		status := jobStatus(s, id)
+		for _, w := range want {
+			if status == w {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s is %s, want %v", id, status, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMaxConcurrentJobsQueuesThirdJob(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	node.hold = make(chan struct{})
+	s := NewServer(Options{FilesDir: filesDir(t), MaxConcurrentJobs: 2})
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id := addJobRequest(t, s, node)
+		ids = append(ids, id)
+		if i < 2 {
+			waitStatus(t, s, id, "running")
+		}
+	}
+
+	// The first two hold both slots while their eth_getLogs calls wait.
+	time.Sleep(50 * time.Millisecond)
+	if status := jobStatus(s, ids[2]); status != "queued" {
+		t.Fatalf("third job is %s with two running, want queued", status)
+	}
+
+	close(node.hold)
+	for _, id := range ids {
+		waitStatus(t, s, id, "finished")
+	}
+}
+
+func TestQueuedJobCanBeCancelled(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	node.hold = make(chan struct{})
+	s := NewServer(Options{FilesDir: filesDir(t), MaxConcurrentJobs: 1})
+
+	running := addJobRequest(t, s, node)
+	waitStatus(t, s, running, "running")
+	queued := addJobRequest(t, s, node)
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/jobs/"+queued, nil))
+	waitStatus(t, s, queued, "cancelled")
+
+	close(node.hold)
+	waitStatus(t, s, running, "finished")
+	if status := jobStatus(s, queued); status != "cancelled" {
+		t.Fatalf("cancelled job is %s after a slot freed", status)
+	}
+}
+
+func TestCancelledJobStaysCancelledWhenItReturns(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	node.hold = make(chan struct{})
+	s := NewServer(Options{FilesDir: filesDir(t), MaxConcurrentJobs: 1})
+
+	cancelled := addJobRequest(t, s, node)
+	waitStatus(t, s, cancelled, "running")
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/jobs/"+cancelled, nil))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE: %d %s", rec.Code, rec.Body)
+	}
+
+	// The next job only gets the slot once the cancelled run has returned.
+	next := addJobRequest(t, s, node)
+	close(node.hold)
+	waitStatus(t, s, next, "finished")
+	if status := jobStatus(s, cancelled); status != "cancelled" {
+		t.Fatalf("cancelled job is %s after its run returned", status)
+	}
+
+	// A retry runs the job again under a new ID.
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jobs/"+cancelled+"/retry", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST retry: %d %s", rec.Code, rec.Body)
+	}
+	var resp JobResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	waitStatus(t, s, resp.JobID, "finished")
+	if status := jobStatus(s, cancelled); status != "cancelled" {
+		t.Fatalf("retried job is %s, want cancelled", status)
+	}
+}
+
+// addJobRequest creates a single-worker job of jobRequest and returns its ID.
+func addJobRequest(t *testing.T, s *Server, node *fakeNode) string {
+	t.Helper()
+	req := jobBody(t, node)
+	req["workers"] = 1
+	rec := postJSON(s, "/jobs", req)
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /jobs: %d %s", rec.Code, rec.Body)
+	}
+	var resp JobResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	return resp.JobID
+}
+
+func TestBearerAuth(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t), Tokens: []string{"first-token", "second-token"}})
+	get := func(path, authorization string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		if authorization != "" {
+			r.Header.Set("Authorization", authorization)
+		}
+		s.mux.ServeHTTP(rec, r)
+		return rec
+	}
+
+	for _, path := range []string{"/version", "/jobs/unknown", "/storage/types", "/debug/vars", "/debug/rpc"} {
+		for _, tc := range []struct {
+			name, authorization string
+			want                int
+		}{
+			{name: "missing", want: http.StatusUnauthorized},
+			{name: "empty bearer", authorization: "Bearer ", want: http.StatusUnauthorized},
+			{name: "other scheme", authorization: "Basic Zmlyc3QtdG9rZW4=", want: http.StatusUnauthorized},
+			{name: "wrong", authorization: "Bearer first-token-2", want: http.StatusUnauthorized},
+			{name: "prefix", authorization: "Bearer first", want: http.StatusUnauthorized},
+			{name: "first", authorization: "Bearer first-token"},
+			{name: "second", authorization: "Bearer second-token"},
+		} {
+			rec := get(path, tc.authorization)
+			if tc.want == http.StatusUnauthorized {
+				if rec.Code != http.StatusUnauthorized || rec.Header().Get("WWW-Authenticate") == "" {
+					t.Errorf("%s %s: %d, want 401 with a challenge", path, tc.name, rec.Code)
+				}
+				continue
+			}
+			if rec.Code == http.StatusUnauthorized {
+				t.Errorf("%s %s: 401 with a valid token", path, tc.name)
+			}
+		}
+	}
+
+	// Unregistered paths are not routed to any handler, so there is nothing
+	// to authenticate.
+	if rec := get("/", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("GET / without a token: %d, want 404", rec.Code)
+	}
+}
+
+func TestNoTokensDisablesAuth(t *testing.T) {
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /version without tokens configured: %d %s", rec.Code, rec.Body)
+	}
+}
+
+func TestOversizedBodyIsRejected(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t), MaxBodyBytes: 8192})
+	oversized := jobBody(t, node)
+	oversized["padding"] = strings.Repeat("x", 8192)
+	for _, path := range []string{"/jobs", "/jobs/stream", "/abi/events", "/decode"} {
+		rec := postJSON(s, path, oversized)
+		if rec.Code != http.StatusRequestEntityTooLarge || !strings.Contains(rec.Body.String(), "8192 bytes") {
+			t.Errorf("POST %s: %d %s, want 413", path, rec.Code, rec.Body)
+		}
+	}
+
+	// A body under the limit gets through.
+	rec := postJSON(s, "/jobs", jobBody(t, node))
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("POST /jobs under the limit: %d %s", rec.Code, rec.Body)
+	}
+	var resp JobResponse
+	json.Unmarshal(rec.Body.Bytes(), &resp)
+	waitStatus(t, s, resp.JobID, "finished")
+}
+
+func TestFinishedJobReportsSummary(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10), transferLog(12, 0, 20))
+	dir := filesDir(t)
+	s := NewServer(Options{FilesDir: dir})
+	id := addJobRequest(t, s, node)
+	waitStatus(t, s, id, "finished")
+
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil))
+	var status JobStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /jobs/%s: %d %s", id, rec.Code, rec.Body)
+	}
+	sum := status.Summary
+	if sum == nil || sum.TotalEvents != 2 || sum.Events["Transfer"] != 2 || sum.EndBlock != 30 {
+		t.Fatalf("summary = %+v, want 2 Transfer events up to block 30", sum)
+	}
+
+	// The CSV output directory gets the same summary as manifest.
+	data, err := os.ReadFile(filepath.Join(dir, "out", indexer.ManifestFileName))
+	if err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	var manifest indexer.Summary
+	if err := json.Unmarshal(data, &manifest); err != nil || manifest.TotalEvents != 2 {
+		t.Errorf("manifest = %s (%v)", data, err)
+	}
+}
+
+func TestVersionEndpoint(t *testing.T) {
+	s := NewServer(Options{})
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/version", nil))
+	var info version.Info
+	if err := json.Unmarshal(rec.Body.Bytes(), &info); err != nil || rec.Code != http.StatusOK {
+		t.Fatalf("GET /version: %d %s", rec.Code, rec.Body)
+	}
+	if info != version.Get() || rec.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("GET /version = %+v (%s), want %+v", info, rec.Header().Get("Content-Type"), version.Get())
+	}
+
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/version", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /version: %d", rec.Code)
+	}
+}
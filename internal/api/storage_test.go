@@ -0,0 +1,81 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+)
+
+func init() {
+	// A type registered outside the sink package, as plugins do.
+	sink.Register("apitest", func(config.StorageConfig) (sink.Sink, error) { return nil, nil })
+}
+
+// storageTypes returns the GET /storage/types answer by type name.
+func storageTypes(t *testing.T) map[string][]sink.Field {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	NewServer(Options{}).mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/storage/types", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var list []StorageType
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decoding %s: %v", rec.Body, err)
+	}
+	out := make(map[string][]sink.Field, len(list))
+	for i, st := range list {
+		if i > 0 && list[i-1].Name >= st.Name {
+			t.Errorf("types not sorted: %s before %s", list[i-1].Name, st.Name)
+		}
+		out[st.Name] = st.Fields
+	}
+	return out
+}
+
+// field returns the field of fields named name.
+func field(fields []sink.Field, name string) (sink.Field, bool) {
+	for _, f := range fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return sink.Field{}, false
+}
+
+func TestStorageTypesListsRegistry(t *testing.T) {
+	types := storageTypes(t)
+	for _, name := range []string{"csv", "bigquery", "parquet", "apitest"} {
+		if _, ok := types[name]; !ok {
+			t.Errorf("%s missing from %v", name, types)
+		}
+	}
+
+	if f, ok := field(types["csv"], "csv.output_dir"); !ok || !f.Required || f.Type != "string" {
+		t.Errorf("csv.output_dir = %+v (%v), want a required string", f, ok)
+	}
+	if f, ok := field(types["csv"], "csv.flush_rows"); !ok || f.Required || f.Type != "int" {
+		t.Errorf("csv.flush_rows = %+v (%v), want an optional int", f, ok)
+	}
+	for _, name := range []string{"bigquery.project", "bigquery.dataset"} {
+		if f, ok := field(types["bigquery"], name); !ok || !f.Required {
+			t.Errorf("%s = %+v (%v), want required", name, f, ok)
+		}
+	}
+	// Undescribed types list no fields rather than null.
+	if fields, ok := types["apitest"]; !ok || fields == nil || len(fields) != 0 {
+		t.Errorf("apitest fields = %#v, want []", fields)
+	}
+}
+
+func TestStorageTypesRejectsPost(t *testing.T) {
+	rec := httptest.NewRecorder()
+	NewServer(Options{}).mux.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/storage/types", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("status = %d, want 405", rec.Code)
+	}
+}
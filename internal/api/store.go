@@ -0,0 +1,90 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// StoredJob is the persisted form of a job: its status and the original
+// request, so jobs can still be inspected and retried after a restart.
+type StoredJob struct {
+	Status  JobStatus  `json:"status"`
+	Request JobRequest `json:"request"`
+}
+
+// JobStore persists the job registry. Save is called with s.mu held on every
+// status change (progress updates are throttled), so implementations should
+// be quick.
+type JobStore interface {
+	// Load returns every stored job.
+	Load() ([]StoredJob, error)
+	// Save inserts or replaces the job with the same ID.
+	Save(StoredJob) error
+}
+
+// FileJobStore keeps all jobs in a single JSON file, rewritten atomically on
+// every save. Requests may embed credentials (e.g. a MySQL DSN), so the file
+// is only readable by its owner.
+type FileJobStore struct {
+	path string
+	mu   sync.Mutex
+	jobs map[string]StoredJob
+}
+
+// NewFileJobStore opens the store at path, reading any existing jobs.
+func NewFileJobStore(path string) (*FileJobStore, error) {
+	st := &FileJobStore{path: path, jobs: make(map[string]StoredJob)}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read job store: %w", err)
+	}
+	var jobs []StoredJob
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return nil, fmt.Errorf("failed to decode job store %s: %w", path, err)
+	}
+	for _, j := range jobs {
+		st.jobs[j.Status.JobID] = j
+	}
+	return st, nil
+}
+
+// Load returns the stored jobs ordered by start time.
+func (st *FileJobStore) Load() ([]StoredJob, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.sortedLocked(), nil
+}
+
+// Save records job and rewrites the file.
+func (st *FileJobStore) Save(job StoredJob) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.jobs[job.Status.JobID] = job
+
+	data, err := json.Marshal(st.sortedLocked())
+	if err != nil {
+		return err
+	}
+	tmp := st.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, st.path)
+}
+
+func (st *FileJobStore) sortedLocked() []StoredJob {
+	jobs := make([]StoredJob, 0, len(st.jobs))
+	for _, j := range st.jobs {
+		jobs = append(jobs, j)
+	}
+	sort.Slice(jobs, func(i, k int) bool {
+		return jobs[i].Status.StartedAt.Before(jobs[k].Status.StartedAt)
+	})
+	return jobs
+}
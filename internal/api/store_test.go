@@ -0,0 +1,91 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileJobStoreRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	st, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatalf("NewFileJobStore: %v", err)
+	}
+	if jobs, _ := st.Load(); len(jobs) != 0 {
+		t.Fatalf("new store holds %d jobs", len(jobs))
+	}
+
+	started := time.Now()
+	req := JobRequest{RPCURL: "http://node"}
+	st.Save(StoredJob{Status: JobStatus{JobID: "b", Status: "finished", StartedAt: started.Add(time.Second)}, Request: req})
+	st.Save(StoredJob{Status: JobStatus{JobID: "a", Status: "running", StartedAt: started}, Request: req})
+	st.Save(StoredJob{Status: JobStatus{JobID: "a", Status: "error", StartedAt: started}, Request: req})
+
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o600 {
+		t.Fatalf("store file mode = %v (%v), want 0600", info.Mode().Perm(), err)
+	}
+	reopened, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	jobs, _ := reopened.Load()
+	if len(jobs) != 2 || jobs[0].Status.JobID != "a" || jobs[1].Status.JobID != "b" {
+		t.Fatalf("jobs = %+v, want a then b", jobs)
+	}
+	if jobs[0].Status.Status != "error" || jobs[0].Request.RPCURL != "http://node" {
+		t.Errorf("job a = %+v, want the last save with its request", jobs[0])
+	}
+}
+
+func TestFileJobStoreRejectsCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	os.WriteFile(path, []byte("{not json"), 0o600)
+	if _, err := NewFileJobStore(path); err == nil {
+		t.Fatal("NewFileJobStore accepted a corrupt file")
+	}
+}
+
+func TestServerRestoresJobsFromStore(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	dir := filesDir(t)
+	path := filepath.Join(t.TempDir(), "jobs.json")
+	st, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(Options{FilesDir: dir, Store: st})
+	finished := addJobRequest(t, s, node)
+	waitStatus(t, s, finished, "finished")
+	// Jobs the previous process left unfinished.
+	for _, status := range []string{"queued", "running"} {
+		st.Save(StoredJob{Status: JobStatus{JobID: status, Status: status, StartedAt: time.Now()}, Request: jobRequest(t, node)})
+	}
+
+	reopened, err := NewFileJobStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewServer(Options{FilesDir: dir, Store: reopened})
+	if status := jobStatus(restarted, finished); status != "finished" {
+		t.Errorf("finished job restored as %s", status)
+	}
+	for _, id := range []string{"queued", "running"} {
+		restarted.mu.RLock()
+		status := *restarted.jobs[id].status
+		restarted.mu.RUnlock()
+		if status.Status != "interrupted" || status.Error == "" || status.FinishedAt == nil {
+			t.Errorf("%s job restored as %+v, want interrupted", id, status)
+		}
+	}
+
+	// The interruption is persisted and the job can be retried.
+	jobs, _ := reopened.Load()
+	for _, j := range jobs {
+		if j.Status.JobID == "running" && j.Status.Status != "interrupted" {
+			t.Errorf("stored status = %s, want interrupted", j.Status.Status)
+		}
+	}
+	retried(t, restarted, "/jobs/running/retry")
+}
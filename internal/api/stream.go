@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// streamHeartbeat keeps idle SSE connections alive through proxies.
+const streamHeartbeat = 15 * time.Second
+
+// notifyLocked persists the job and pushes a copy of its status to every
+// subscriber. It must be called with s.mu held. Slow subscribers miss
+// intermediate updates instead of blocking the job.
+func (s *Server) notifyLocked(entry *jobEntry) {
+	s.saveLocked(entry)
+	if len(entry.subscribers) == 0 {
+		return
+	}
+	status := *entry.status
+	for ch := range entry.subscribers {
+		select {
+		case ch <- status:
+		default:
+		}
+	}
+}
+
+// subscribe registers a new status listener for the job and returns it along
+// with the current status.
+func (s *Server) subscribe(id string) (chan JobStatus, JobStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.jobs[id]
+	if !ok {
+		return nil, JobStatus{}, false
+	}
+	if entry.subscribers == nil {
+		entry.subscribers = make(map[chan JobStatus]struct{})
+	}
+	ch := make(chan JobStatus, 16)
+	entry.subscribers[ch] = struct{}{}
+	return ch, *entry.status, true
+}
+
+// unsubscribe removes a listener registered via subscribe.
+func (s *Server) unsubscribe(id string, ch chan JobStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.jobs[id]; ok {
+		delete(entry.subscribers, ch)
+	}
+}
+
+// streamJob handles GET /jobs/{id}/stream, pushing status and progress changes
+// as Server-Sent Events until the job reaches a terminal state or the client
+// disconnects.
+func (s *Server) streamJob(w http.ResponseWriter, r *http.Request, id string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ch, current, ok := s.subscribe(id)
+	if !ok {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	defer s.unsubscribe(id, ch)
+
+	// The server-wide WriteTimeout would cut long-lived streams.
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	send := func(status JobStatus) bool {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, "event: status\ndata: %s\n\n", data); err != nil {
+			return false
+		}
+		flusher.Flush()
+		return !isTerminal(status.Status)
+	}
+
+	if !send(current) {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case status := <-ch:
+			if !send(status) {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// isTerminal reports whether a job status will not change anymore.
+func isTerminal(status string) bool {
+	switch status {
+	case "finished", "error", "cancelled", "interrupted":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,103 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// readEvents returns the status events of an SSE body until it ends.
+func readEvents(t *testing.T, body io.Reader) []JobStatus {
+	t.Helper()
+	var events []JobStatus
+	scanner := bufio.NewScanner(body)
+	event := ""
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			if event != "status" {
+				t.Fatalf("data of event %q", event)
+			}
+			var status JobStatus
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &status); err != nil {
+				t.Fatalf("event data %q: %v", line, err)
+			}
+			events = append(events, status)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("reading the stream: %v", err)
+	}
+	return events
+}
+
+func TestJobStreamFollowsJobToTheEnd(t *testing.T) {
+	node := newFakeNode(t, 30, transferLog(3, 0, 10))
+	node.hold = make(chan struct{})
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+
+	id := addJobRequest(t, s, node)
+	waitStatus(t, s, id, "running")
+	resp, err := http.Get(srv.URL + "/jobs/" + id + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("GET stream: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	close(node.hold)
+	// The stream ends by itself once the job is finished.
+	events := readEvents(t, resp.Body)
+	if len(events) < 2 {
+		t.Fatalf("events = %+v, want the current status and the final one", events)
+	}
+	if first := events[0]; first.JobID != id || first.Status != "running" {
+		t.Errorf("first event = %+v, want the running job", first)
+	}
+	last := events[len(events)-1]
+	if last.Status != "finished" || last.Summary == nil || last.Summary.TotalEvents != 1 {
+		t.Errorf("last event = %+v, want finished with its summary", last)
+	}
+	for _, e := range events[:len(events)-1] {
+		if isTerminal(e.Status) {
+			t.Errorf("terminal event %+v before the last one", e)
+		}
+	}
+}
+
+func TestJobStreamOfEndedJob(t *testing.T) {
+	node := newFakeNode(t, 30)
+	s := NewServer(Options{FilesDir: filesDir(t)})
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+
+	id := addJob(s, jobRequest(t, node), "cancelled", nil)
+	resp, err := http.Get(srv.URL + "/jobs/" + id + "/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if events := readEvents(t, resp.Body); len(events) != 1 || events[0].Status != "cancelled" {
+		t.Fatalf("events = %+v, want the cancelled status only", events)
+	}
+
+	resp, err = http.Get(srv.URL + "/jobs/unknown/stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("stream of an unknown job: %d", resp.StatusCode)
+	}
+}
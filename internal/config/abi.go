@@ -0,0 +1,236 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/sirupsen/logrus"
+)
+
+// ABIPaths lists the ABI files of a contract. It accepts a single path or a
+// list in YAML/JSON, so upgradeable proxies can combine the ABIs of every
+// implementation they pointed to.
+type ABIPaths []string
+
+// UnmarshalYAML accepts either a string or a list of strings.
+func (p *ABIPaths) UnmarshalYAML(unmarshal func(interface{}) error) error {
+    var single string
+    if err := unmarshal(&single); err == nil {
+        *p = nil
+        if single != "" {
+            *p = ABIPaths{single}
+        }
+        return nil
+    }
+    var list []string
+    if err := unmarshal(&list); err != nil {
+        return fmt.Errorf("abi must be a path or a list of paths")
+    }
+    *p = list
+    return nil
+}
+
+// MarshalYAML writes a single path as a plain string.
+func (p ABIPaths) MarshalYAML() (interface{}, error) {
+    if len(p) == 1 {
+        return p[0], nil
+    }
+    return []string(p), nil
+}
+
+// UnmarshalJSON accepts either a string or a list of strings.
+func (p *ABIPaths) UnmarshalJSON(data []byte) error {
+    var single string
+    if err := json.Unmarshal(data, &single); err == nil {
+        *p = nil
+        if single != "" {
+            *p = ABIPaths{single}
+        }
+        return nil
+    }
+    var list []string
+    if err := json.Unmarshal(data, &list); err != nil {
+        return fmt.Errorf("abi must be a path or a list of paths")
+    }
+    *p = list
+    return nil
+}
+
+// ParseABIFiles reads and parses the given ABI files and merges them into a
+// single ABI (see MergeABIs). contractName is only used in error messages.
+func ParseABIFiles(paths []string, contractName string) (*abi.ABI, error) {
+    parsed := make([]abi.ABI, 0, len(paths))
+    for _, path := range paths {
+        abiBytes, err := os.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read abi file for contract '%s': %w", contractName, err)
+        }
+        a, err := abi.JSON(bytes.NewReader(abiBytes))
+        if err != nil {
+            return nil, fmt.Errorf("failed to parse abi %s for contract '%s': %w", path, contractName, err)
+        }
+        parsed = append(parsed, a)
+    }
+    merged := parsed[0]
+    if len(parsed) > 1 {
+        merged = MergeABIs(contractName, parsed...)
+    }
+    for _, line := range OverloadedEvents(&merged) {
+        logrus.Infof("contract '%s': %s", contractName, line)
+    }
+    return &merged, nil
+}
+
+// LookupEvent finds the event of a referenced by an events or topics entry:
+// its name as keyed by go-ethereum (overloads get a suffix: Transfer,
+// Transfer0, …), its signature ("Transfer(address,address,uint256)") or its
+// topic0 hash.
+func LookupEvent(a *abi.ABI, ref string) (abi.Event, bool) {
+    if ev, ok := a.Events[ref]; ok {
+        return ev, true
+    }
+    sig := strings.ReplaceAll(ref, " ", "")
+    for _, ev := range a.Events {
+        if ev.Sig == sig || strings.EqualFold(ev.ID.Hex(), ref) {
+            return ev, true
+        }
+    }
+    return abi.Event{}, false
+}
+
+// EventName returns the name events referenced by ref are emitted under
+// (their event_name), or ref itself when the ABI is not loaded or lacks it.
+func EventName(c ContractConfig, ref string) string {
+    if c.ParsedABI == nil {
+        return ref
+    }
+    if ev, ok := LookupEvent(c.ParsedABI, ref); ok {
+        return ev.Name
+    }
+    return ref
+}
+
+// OverloadedEvents describes every event name of a shared by several
+// signatures, e.g. "event Transfer is overloaded: Transfer =
+// Transfer(address,address,uint256), Transfer0 = Transfer(address,uint256)",
+// so config can refer to the right variant. Names are sorted.
+func OverloadedEvents(a *abi.ABI) []string {
+    byRawName := make(map[string][]string)
+    for key := range a.Events {
+        raw := a.Events[key].RawName
+        byRawName[raw] = append(byRawName[raw], key)
+    }
+    var out []string
+    for raw, keys := range byRawName {
+        if len(keys) < 2 {
+            continue
+        }
+        sort.Strings(keys)
+        variants := make([]string, len(keys))
+        for i, k := range keys {
+            variants[i] = k + " = " + a.Events[k].Sig
+        }
+        out = append(out, fmt.Sprintf("event %s is overloaded: %s", raw, strings.Join(variants, ", ")))
+    }
+    sort.Strings(out)
+    return out
+}
+
+// MergeABIs combines several ABIs into one event and method set keyed by
+// topic0 / selector. When the same signature appears more than once the
+// later ABI wins and a warning is logged; different signatures sharing a name
+// get go-ethereum's overload suffix (Transfer, Transfer0, …).
+func MergeABIs(contractName string, abis ...abi.ABI) abi.ABI {
+    out := abi.ABI{
+        Methods: make(map[string]abi.Method),
+        Events:  make(map[string]abi.Event),
+        Errors:  make(map[string]abi.Error),
+    }
+
+    for _, a := range abis {
+        // Walk events and methods by name so overload suffixes are assigned
+        // in the same order on every run.
+        for _, evName := range sortedKeys(a.Events) {
+            ev := a.Events[evName]
+            if key, ok := eventKeyByID(out.Events, ev); ok {
+                logrus.Warnf("contract '%s': event %s defined in several ABIs, using the later one", contractName, ev.Sig)
+                delete(out.Events, key)
+            }
+            name := abi.ResolveNameConflict(ev.RawName, func(s string) bool { _, ok := out.Events[s]; return ok })
+            out.Events[name] = abi.NewEvent(name, ev.RawName, ev.Anonymous, ev.Inputs)
+        }
+        for _, mName := range sortedKeys(a.Methods) {
+            m := a.Methods[mName]
+            if key, ok := methodKeyByID(out.Methods, m); ok {
+                logrus.Warnf("contract '%s': method %s defined in several ABIs, using the later one", contractName, m.Sig)
+                delete(out.Methods, key)
+            }
+            name := abi.ResolveNameConflict(m.RawName, func(s string) bool { _, ok := out.Methods[s]; return ok })
+            out.Methods[name] = abi.NewMethod(name, m.RawName, m.Type, m.StateMutability, m.Constant, m.Payable, m.Inputs, m.Outputs)
+        }
+        for name, e := range a.Errors {
+            out.Errors[name] = e
+        }
+        if a.HasFallback() {
+            out.Fallback = a.Fallback
+        }
+        if a.HasReceive() {
+            out.Receive = a.Receive
+        }
+    }
+    return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+func eventKeyByID(events map[string]abi.Event, ev abi.Event) (string, bool) {
+    for k, e := range events {
+        if e.ID == ev.ID {
+            return k, true
+        }
+    }
+    return "", false
+}
+
+func methodKeyByID(methods map[string]abi.Method, m abi.Method) (string, bool) {
+    for k, e := range methods {
+        if bytes.Equal(e.ID, m.ID) {
+            return k, true
+        }
+    }
+    return "", false
+}
+
+// MissingEvents describes every contract whose configured events are absent
+// from its parsed ABI, one message per contract listing the missing names.
+// Such events would silently match nothing.
+func MissingEvents(contracts []ContractConfig) []string {
+    var out []string
+    for _, c := range contracts {
+        if c.ParsedABI == nil {
+            continue
+        }
+        var missing []string
+        for _, name := range c.Events {
+            if _, ok := LookupEvent(c.ParsedABI, name); !ok {
+                missing = append(missing, name)
+            }
+        }
+        if len(missing) > 0 {
+            out = append(out, fmt.Sprintf("contract '%s': events not found in ABI: %s", c.Name, strings.Join(missing, ", ")))
+        }
+    }
+    return out
+}
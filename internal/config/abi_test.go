@@ -0,0 +1,172 @@
+package config
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// overloadedABI declares two Transfer events of different signatures.
+const overloadedABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"from","type":"address"},
+    {"indexed":true,"name":"to","type":"address"},
+    {"indexed":false,"name":"value","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"to","type":"address"},
+    {"indexed":false,"name":"amount","type":"uint256"}]}]`
+
+func parseOverloaded(t *testing.T) *abi.ABI {
+    t.Helper()
+    a, err := abi.JSON(strings.NewReader(overloadedABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &a
+}
+
+func TestLookupEventOverloads(t *testing.T) {
+    a := parseOverloaded(t)
+    short := crypto.Keccak256Hash([]byte("Transfer(address,uint256)"))
+    for _, ref := range []string{"Transfer0", "Transfer(address,uint256)", "Transfer(address, uint256)", short.Hex(), strings.ToUpper(short.Hex())} {
+        if ev, ok := LookupEvent(a, ref); !ok || ev.ID != short || ev.Name != "Transfer0" {
+            t.Errorf("LookupEvent(%q) = %s (%v), want Transfer0", ref, ev.Sig, ok)
+        }
+    }
+    if ev, ok := LookupEvent(a, "Transfer"); !ok || ev.Sig != "Transfer(address,address,uint256)" {
+        t.Errorf("LookupEvent(Transfer) = %s (%v)", ev.Sig, ok)
+    }
+    if _, ok := LookupEvent(a, "Transfer1"); ok {
+        t.Error("LookupEvent matched a missing variant")
+    }
+
+    c := ContractConfig{ParsedABI: a}
+    if got := EventName(c, "Transfer(address,uint256)"); got != "Transfer0" {
+        t.Errorf("EventName = %q, want Transfer0", got)
+    }
+    if got := EventName(ContractConfig{}, "Transfer(address,uint256)"); got != "Transfer(address,uint256)" {
+        t.Errorf("EventName without ABI = %q", got)
+    }
+}
+
+func TestOverloadedEvents(t *testing.T) {
+    got := OverloadedEvents(parseOverloaded(t))
+    want := "event Transfer is overloaded: Transfer = Transfer(address,address,uint256), Transfer0 = Transfer(address,uint256)"
+    if len(got) != 1 || got[0] != want {
+        t.Fatalf("OverloadedEvents = %q, want [%q]", got, want)
+    }
+}
+
+func TestMergeABIsSuffixesOverloads(t *testing.T) {
+    a := parseOverloaded(t)
+    first := abi.ABI{Events: map[string]abi.Event{"Transfer": a.Events["Transfer"]}}
+    second := abi.ABI{Events: map[string]abi.Event{"Transfer": abi.NewEvent("Transfer", "Transfer", false, a.Events["Transfer0"].Inputs)}}
+
+    merged := MergeABIs("Token", first, second)
+    if len(merged.Events) != 2 || merged.Events["Transfer"].ID != a.Events["Transfer"].ID || merged.Events["Transfer0"].ID != a.Events["Transfer0"].ID {
+        t.Fatalf("merged events = %v", merged.Events)
+    }
+}
+
+func TestMissingEvents(t *testing.T) {
+    parsed, err := abi.JSON(strings.NewReader(transferABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    contracts := []ContractConfig{
+        {Name: "Token", ParsedABI: &parsed, Events: []string{"Transfer", "Tranfser", "Approval"}},
+        // References by signature or topic0 are found.
+        {Name: "ByRef", ParsedABI: &parsed, Events: []string{"Transfer(address,address,uint256)", "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"}},
+        {Name: "All", ParsedABI: &parsed},
+        // Contracts without a parsed ABI are not checked.
+        {Name: "NoABI", Events: []string{"Mint"}},
+        {Name: "Other", ParsedABI: &parsed, Events: []string{"Mint"}},
+    }
+    got := MissingEvents(contracts)
+    want := []string{
+        "contract 'Token': events not found in ABI: Tranfser, Approval",
+        "contract 'Other': events not found in ABI: Mint",
+    }
+    if strings.Join(got, "\n") != strings.Join(want, "\n") {
+        t.Errorf("MissingEvents = %q, want %q", got, want)
+    }
+}
+
+// upgradedABI is a later implementation of the Token of transferABI: it
+// renames the value of Transfer and adds Upgraded.
+const upgradedABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"src","type":"address"},
+    {"indexed":true,"name":"dst","type":"address"},
+    {"indexed":false,"name":"wad","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"Upgraded","inputs":[
+    {"indexed":true,"name":"implementation","type":"address"}]}]`
+
+func TestABIPathsAcceptsPathOrList(t *testing.T) {
+    cases := []struct {
+        json    string
+        want    ABIPaths
+        wantErr bool
+    }{
+        {json: `"token.json"`, want: ABIPaths{"token.json"}},
+        {json: `""`, want: nil},
+        {json: `["v1.json","v2.json"]`, want: ABIPaths{"v1.json", "v2.json"}},
+        {json: `{"path":"token.json"}`, wantErr: true},
+    }
+    for _, tc := range cases {
+        var got ABIPaths
+        err := json.Unmarshal([]byte(tc.json), &got)
+        if (err != nil) != tc.wantErr || strings.Join(got, ",") != strings.Join(tc.want, ",") {
+            t.Errorf("unmarshal %s = %q, %v; want %q", tc.json, got, err, tc.want)
+        }
+    }
+}
+
+func TestLoadMergesABIFiles(t *testing.T) {
+    path := writeConfig(t, `rpc_url: http://localhost:8545
+storage:
+  type: csv
+  csv:
+    output_dir: out
+contracts:
+  - name: Proxy
+    address: "0x00000000000000000000000000000000000000a1"
+    abi: [token.json, upgraded.json]
+    events: [Transfer, Upgraded]
+`)
+    if err := os.WriteFile(filepath.Join(filepath.Dir(path), "upgraded.json"), []byte(upgradedABI), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    cfg, err := Load(path)
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    merged := cfg.Contracts[0].ParsedABI
+    if merged == nil || len(merged.Events) != 2 {
+        t.Fatalf("merged events = %v, want Transfer and Upgraded", merged)
+    }
+    // Transfer is in both files: the later one wins.
+    transfer, ok := LookupEvent(merged, "Transfer(address,address,uint256)")
+    if !ok || transfer.Name != "Transfer" || transfer.Inputs[2].Name != "wad" {
+        t.Errorf("Transfer = %+v, want the definition of upgraded.json", transfer)
+    }
+    if _, ok := merged.Events["Upgraded"]; !ok {
+        t.Error("Upgraded missing from the merged ABI")
+    }
+
+    // The order of the files decides which definition wins.
+    reversed, err := ParseABIFiles([]string{filepath.Join(filepath.Dir(path), "upgraded.json"), filepath.Join(filepath.Dir(path), "token.json")}, "Proxy")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if in := reversed.Events["Transfer"].Inputs; in[2].Name != "value" {
+        t.Errorf("reversed Transfer value = %s, want value", in[2].Name)
+    }
+
+    if _, err := ParseABIFiles([]string{filepath.Join(filepath.Dir(path), "token.json"), "missing.json"}, "Proxy"); err == nil || !strings.Contains(err.Error(), "contract 'Proxy'") {
+        t.Errorf("missing file: %v", err)
+    }
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// BlockRef is a start block given either as an absolute number or relative
+// to the chain head at run time: "latest" or "latest-N".
+type BlockRef struct {
+    Number uint64
+    // FromLatest marks a head-relative reference; Number is then the offset N.
+    FromLatest bool
+}
+
+// ParseBlockRef parses "12345", "latest" or "latest-N".
+func ParseBlockRef(s string) (BlockRef, error) {
+    s = strings.TrimSpace(s)
+    if s == "" {
+        return BlockRef{}, nil
+    }
+    if rest, ok := strings.CutPrefix(s, "latest"); ok {
+        if rest == "" {
+            return BlockRef{FromLatest: true}, nil
+        }
+        n, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(rest, "-")), 10, 64)
+        if err != nil || !strings.HasPrefix(rest, "-") {
+            return BlockRef{}, fmt.Errorf("invalid block %q, expected a number, \"latest\" or \"latest-N\"", s)
+        }
+        return BlockRef{Number: n, FromLatest: true}, nil
+    }
+    n, err := strconv.ParseUint(s, 10, 64)
+    if err != nil {
+        return BlockRef{}, fmt.Errorf("invalid block %q, expected a number, \"latest\" or \"latest-N\"", s)
+    }
+    return BlockRef{Number: n}, nil
+}
+
+// ValidateEndBlock checks that an end block can bound a run from start:
+// follow mode has no end, and an absolute end must not precede an absolute
+// start.
+func ValidateEndBlock(start BlockRef, end *BlockRef, follow bool) error {
+    if end == nil {
+        return nil
+    }
+    if follow {
+        return fmt.Errorf("end_block cannot be combined with follow")
+    }
+    if !start.FromLatest && !end.FromLatest && end.Number < start.Number {
+        return fmt.Errorf("end_block %d is before start_block %d", end.Number, start.Number)
+    }
+    return nil
+}
+
+// Resolve returns the absolute block number given the current head.
+func (b BlockRef) Resolve(latest uint64) uint64 {
+    if !b.FromLatest {
+        return b.Number
+    }
+    if b.Number > latest {
+        return 0
+    }
+    return latest - b.Number
+}
+
+func (b BlockRef) String() string {
+    switch {
+    case !b.FromLatest:
+        return strconv.FormatUint(b.Number, 10)
+    case b.Number == 0:
+        return "latest"
+    default:
+        return "latest-" + strconv.FormatUint(b.Number, 10)
+    }
+}
+
+// UnmarshalYAML accepts a number or one of the string forms.
+func (b *BlockRef) UnmarshalYAML(unmarshal func(interface{}) error) error {
+    var n uint64
+    if err := unmarshal(&n); err == nil {
+        *b = BlockRef{Number: n}
+        return nil
+    }
+    var s string
+    if err := unmarshal(&s); err != nil {
+        return err
+    }
+    ref, err := ParseBlockRef(s)
+    if err != nil {
+        return err
+    }
+    *b = ref
+    return nil
+}
+
+// MarshalYAML writes absolute blocks as numbers.
+func (b BlockRef) MarshalYAML() (interface{}, error) {
+    if !b.FromLatest {
+        return b.Number, nil
+    }
+    return b.String(), nil
+}
+
+// UnmarshalJSON accepts a number or one of the string forms.
+func (b *BlockRef) UnmarshalJSON(data []byte) error {
+    var n uint64
+    if err := json.Unmarshal(data, &n); err == nil {
+        *b = BlockRef{Number: n}
+        return nil
+    }
+    var s string
+    if err := json.Unmarshal(data, &s); err != nil {
+        return fmt.Errorf("start_block must be a number or a string")
+    }
+    ref, err := ParseBlockRef(s)
+    if err != nil {
+        return err
+    }
+    *b = ref
+    return nil
+}
+
+// MarshalJSON writes absolute blocks as numbers.
+func (b BlockRef) MarshalJSON() ([]byte, error) {
+    if !b.FromLatest {
+        return json.Marshal(b.Number)
+    }
+    return json.Marshal(b.String())
+}
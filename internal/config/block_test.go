@@ -0,0 +1,65 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseBlockRef(t *testing.T) {
+    for _, tc := range []struct {
+        in      string
+        want    BlockRef
+        resolve uint64 // at head 5000
+    }{
+        {in: "1234", want: BlockRef{Number: 1234}, resolve: 1234},
+        {in: "latest", want: BlockRef{FromLatest: true}, resolve: 5000},
+        {in: "latest-1000", want: BlockRef{Number: 1000, FromLatest: true}, resolve: 4000},
+        {in: "latest-9000", want: BlockRef{Number: 9000, FromLatest: true}, resolve: 0},
+    } {
+        got, err := ParseBlockRef(tc.in)
+        if err != nil || got != tc.want {
+            t.Errorf("ParseBlockRef(%q) = %+v, %v, want %+v", tc.in, got, err, tc.want)
+            continue
+        }
+        if n := got.Resolve(5000); n != tc.resolve {
+            t.Errorf("%q resolves to %d at head 5000, want %d", tc.in, n, tc.resolve)
+        }
+        if got.String() != tc.in {
+            t.Errorf("String() = %q, want %q", got.String(), tc.in)
+        }
+    }
+    for _, in := range []string{"latest+5", "latest-", "-5", "head", "latest-x"} {
+        if _, err := ParseBlockRef(in); err == nil {
+            t.Errorf("ParseBlockRef(%q) accepted", in)
+        }
+    }
+}
+
+func TestBlockRefDecoding(t *testing.T) {
+    var fromYAML struct {
+        A BlockRef `yaml:"a"`
+        B BlockRef `yaml:"b"`
+    }
+    if err := yaml.Unmarshal([]byte("a: 42\nb: latest-10\n"), &fromYAML); err != nil {
+        t.Fatalf("yaml: %v", err)
+    }
+    if fromYAML.A != (BlockRef{Number: 42}) || fromYAML.B != (BlockRef{Number: 10, FromLatest: true}) {
+        t.Errorf("yaml decoded %+v", fromYAML)
+    }
+
+    var fromJSON struct {
+        A BlockRef `json:"a"`
+        B BlockRef `json:"b"`
+    }
+    if err := json.Unmarshal([]byte(`{"a": 42, "b": "latest"}`), &fromJSON); err != nil {
+        t.Fatalf("json: %v", err)
+    }
+    if fromJSON.A != (BlockRef{Number: 42}) || fromJSON.B != (BlockRef{FromLatest: true}) {
+        t.Errorf("json decoded %+v", fromJSON)
+    }
+    if err := json.Unmarshal([]byte(`{"a": true}`), &fromJSON); err == nil {
+        t.Error("json accepted a boolean start block")
+    }
+}
@@ -1,53 +1,534 @@
 package config
 
 import (
-	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"etl-web3/internal/version"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 
+	"github.com/sirupsen/logrus"
 	yaml "gopkg.in/yaml.v2"
 )
 
+// DefaultMaxWorkers is the upper bound applied to Workers when MaxWorkers is
+// not set.
+const DefaultMaxWorkers = 64
+
+// QueueDepthPerMaxWorker bounds QueueDepth to this many block ranges per
+// allowed worker (MaxWorkers).
+const QueueDepthPerMaxWorker = 16
+
+// DefaultRPCTimeoutMS is the per-call RPC timeout applied when RPCTimeoutMS
+// is not set.
+const DefaultRPCTimeoutMS = 30_000
+
+// DefaultRPCUserAgent is the User-Agent sent to RPC providers when
+// RPCUserAgent is empty.
+var DefaultRPCUserAgent = "etl-evm-chain/" + version.Version
+
+// DefaultTimestampCacheSize is the number of block timestamps kept in memory
+// when TimestampCacheSize is not set.
+const DefaultTimestampCacheSize = 10_000
+
+// ContractConfig describes a contract (or, when Address is empty, an event
+// signature scanned across all contracts) to index.
 type ContractConfig struct {
     Name      string     `yaml:"name"`
+    // Address may be omitted when Events is set: the listed events are then
+    // matched by topic0 on every contract of the chain.
     Address   string     `yaml:"address"`
-    ABI       string     `yaml:"abi"`
+    // Addresses lists several contracts sharing this entry's ABI, events and
+    // options, in place of Address (see ExpandAddresses).
+    Addresses []string   `yaml:"addresses"`
+    // ABI is one path or, for upgradeable proxies, a list of paths whose
+    // events are merged (later files win on identical signatures).
+    ABI       ABIPaths   `yaml:"abi"`
     ParsedABI *abi.ABI   `yaml:"-"`
     Events    []string   `yaml:"events"`
+    // Projections reshape the output columns per event name.
+    Projections map[string]Projection `yaml:"projections" json:"projections"`
+    // Sample thins out high-frequency events, per event name.
+    Sample map[string]Sample `yaml:"sample" json:"sample"`
+    // ExpectedRate sets the usual volume of an event, per event name; the
+    // indexer warns when a block window deviates from it.
+    ExpectedRate map[string]ExpectedRate `yaml:"expected_rate" json:"expected_rate"`
+    // Topics restricts events by indexed parameter values: event name →
+    // parameter name → accepted values. Values of one parameter are ORed,
+    // different parameters ANDed (see EventTopicFilter).
+    Topics map[string]map[string][]string `yaml:"topics" json:"topics"`
+    // Decoder names a protocol-specific decoder registered with
+    // parser.RegisterDecoder; empty selects the generic ABI decoder.
+    Decoder string `yaml:"decoder" json:"decoder"`
+}
+
+// Sample keeps a subset of an event: about one in Every events (chosen by a
+// hash of tx_hash and log_index), or the first event of every Per time
+// bucket (a duration such as "1m", based on the block timestamp). Exactly
+// one of them must be set.
+type Sample struct {
+    Every int    `yaml:"every" json:"every"`
+    Per   string `yaml:"per" json:"per"`
+}
+
+// Bucket returns the parsed Per duration (zero when unset).
+func (s Sample) Bucket() (time.Duration, error) {
+    if s.Per == "" {
+        return 0, nil
+    }
+    d, err := time.ParseDuration(s.Per)
+    if err != nil {
+        return 0, err
+    }
+    if d < time.Second {
+        return 0, fmt.Errorf("per must be at least 1s, got %s", s.Per)
+    }
+    return d, nil
+}
+
+// DefaultExpectedRateBlocks and DefaultExpectedRateTolerance apply to an
+// ExpectedRate that leaves Blocks or Tolerance unset.
+const (
+    DefaultExpectedRateBlocks    = 1_000
+    DefaultExpectedRateTolerance = 0.5
+)
+
+// ExpectedRate is the number of events expected per window of Blocks
+// blocks. A completed window holding fewer than Events×(1-Tolerance) or
+// more than Events×(1+Tolerance) events raises an alert, e.g. when an
+// upstream broke or the contract was paused.
+type ExpectedRate struct {
+    Events    float64 `yaml:"events" json:"events"`
+    Blocks    uint64  `yaml:"blocks" json:"blocks"`
+    Tolerance float64 `yaml:"tolerance" json:"tolerance"`
+}
+
+// Window returns Blocks, or the default when unset.
+func (r ExpectedRate) Window() uint64 {
+    if r.Blocks == 0 {
+        return DefaultExpectedRateBlocks
+    }
+    return r.Blocks
+}
+
+// Bounds returns the lowest and highest event counts of a window that do
+// not raise an alert.
+func (r ExpectedRate) Bounds() (low, high float64) {
+    tol := r.Tolerance
+    if tol == 0 {
+        tol = DefaultExpectedRateTolerance
+    }
+    low = r.Events * (1 - tol)
+    if low < 0 {
+        low = 0
+    }
+    return low, r.Events * (1 + tol)
+}
+
+// Projection renames and filters the output fields of one event. Include and
+// Exclude list source keys (decoded params or metadata such as chain_id);
+// FieldMap renames source keys to output keys (e.g. value → amount).
+// event_name and contract_name are always kept since sinks route on them.
+type Projection struct {
+    FieldMap map[string]string `yaml:"field_map" json:"field_map"`
+    Include  []string          `yaml:"include" json:"include"`
+    Exclude  []string          `yaml:"exclude" json:"exclude"`
+}
+
+// TransformConfig is one step of the transforms chain applied to every event
+// between parsing and the sink. Type selects the built-in (rename, set,
+// concat or drop); Events optionally restricts it to some event names.
+type TransformConfig struct {
+    Type      string   `yaml:"type" json:"type"`
+    Events    []string `yaml:"events" json:"events"`
+    // rename: From → To
+    From      string   `yaml:"from" json:"from"`
+    To        string   `yaml:"to" json:"to"`
+    // set: Field = Value; drop: events whose Field equals Value;
+    // concat: Field = Fields joined by Separator
+    Field     string   `yaml:"field" json:"field"`
+    Value     string   `yaml:"value" json:"value"`
+    Fields    []string `yaml:"fields" json:"fields"`
+    Separator string   `yaml:"separator" json:"separator"`
 }
 
 type StorageConfig struct {
     Type  string `yaml:"type"`
     MySQL struct {
         DSN string `yaml:"dsn"`
+        // CheckpointName is the etl_checkpoints row of the checkpoint
+        // (default "default"); multi-chain runs append ".<chain>".
+        CheckpointName string `yaml:"checkpoint_name" json:"checkpoint_name"`
     } `yaml:"mysql"`
     CSV struct {
         OutputDir string `yaml:"output_dir"`
+        // Delimiter is the single-character field separator (default ",").
+        Delimiter string `yaml:"delimiter" json:"delimiter"`
+        // UseCRLF terminates rows with \r\n instead of \n.
+        UseCRLF   bool   `yaml:"use_crlf" json:"use_crlf"`
+        // ForceQuote quotes every field instead of only those that need it.
+        ForceQuote bool  `yaml:"force_quote" json:"force_quote"`
+        // FileNameTemplate lays out the files under OutputDir, e.g.
+        // "{chain_id}/{contract}/{event}.csv". Defaults to
+        // "{contract}_{event}.csv".
+        FileNameTemplate string `yaml:"file_name_template" json:"file_name_template"`
+        // FlushRows and FlushIntervalMS buffer rows instead of flushing every
+        // row: a file is flushed once it holds FlushRows pending rows and/or
+        // every FlushIntervalMS. Both zero flushes every row (the default).
+        FlushRows       int `yaml:"flush_rows" json:"flush_rows"`
+        FlushIntervalMS int `yaml:"flush_interval_ms" json:"flush_interval_ms"`
     } `yaml:"csv"`
+    Parquet struct {
+        OutputDir    string `yaml:"output_dir" json:"output_dir"`
+        // RowGroupSize is the number of rows buffered per file before a row
+        // group is written (default 10000).
+        RowGroupSize int    `yaml:"row_group_size" json:"row_group_size"`
+        // MaxFileMB rolls over to a new part file past this size (default 256).
+        MaxFileMB    int    `yaml:"max_file_mb" json:"max_file_mb"`
+        // Compression is "gzip" (default) or "none".
+        Compression  string `yaml:"compression" json:"compression"`
+    } `yaml:"parquet" json:"parquet"`
+    // Mirror lists additional storage types receiving every event as well
+    // (e.g. type: csv, mirror: [bigquery]), using their sections below.
+    Mirror         []string `yaml:"mirror" json:"mirror"`
+    // DeadLetter, when Path is set, appends events the sink still fails to
+    // write after retries to a JSON-lines file instead of failing the run.
+    // MaxEvents (0: unlimited) fails the run again past that many events.
+    DeadLetter struct {
+        Path      string `yaml:"path" json:"path"`
+        MaxEvents int    `yaml:"max_events" json:"max_events"`
+    } `yaml:"dead_letter" json:"dead_letter"`
+    // Schema, when File is set, pins the keys of every event type in that
+    // JSON file (generated on the first run) and checks later events against
+    // it. OnDrift is "warn" (the default) or "fail".
+    Schema struct {
+        File    string `yaml:"file" json:"file"`
+        OnDrift string `yaml:"on_drift" json:"on_drift"`
+    } `yaml:"schema" json:"schema"`
+    // MirrorFailFast stops at the first failing sink instead of writing to
+    // all of them and reporting the combined error.
+    MirrorFailFast bool     `yaml:"mirror_fail_fast" json:"mirror_fail_fast"`
+    // TableMap routes events of table-based sinks to a shared table, keyed
+    // by "<contract>.<event>" ("*.<event>" matches any contract). Merged
+    // rows carry their key in a source_event column.
+    TableMap map[string]string `yaml:"table_map" json:"table_map"`
+    // PrimaryKey sets the primary key columns of the tables created by
+    // table-based sinks, keyed by table name ("<contract>_<event>", a
+    // table_map target, "blocks", "traces") or "*" for any table. Tables
+    // without an entry get DefaultPrimaryKey when they have its columns.
+    PrimaryKey map[string][]string `yaml:"primary_key" json:"primary_key"`
+    // Options holds free-form settings for custom sinks registered with
+    // sink.Register.
+    Options map[string]string `yaml:"options" json:"options"`
+    BigQuery struct {
+        Project         string `yaml:"project" json:"project"`
+        Dataset         string `yaml:"dataset" json:"dataset"`
+        // CredentialsFile is a service-account JSON key. When empty the GCE
+        // metadata server (default service account) is used.
+        CredentialsFile string `yaml:"credentials_file" json:"credentials_file"`
+        // BatchSize is the number of rows sent per insertAll request
+        // (default 500).
+        BatchSize int `yaml:"batch_size" json:"batch_size"`
+    } `yaml:"bigquery" json:"bigquery"`
 }
 
 type RetryConfig struct {
     Attempts int `yaml:"attempts"`
     DelayMS  int `yaml:"delay_ms"`
+    // BreakerThreshold opens the RPC circuit breaker after that many
+    // consecutive failures within BreakerWindowMS; calls then fail fast for
+    // BreakerCooldownMS before a single probe is attempted. 0 disables it.
+    BreakerThreshold  int `yaml:"breaker_threshold" json:"breaker_threshold"`
+    BreakerWindowMS   int `yaml:"breaker_window_ms" json:"breaker_window_ms"`
+    BreakerCooldownMS int `yaml:"breaker_cooldown_ms" json:"breaker_cooldown_ms"`
+}
+
+// RPCTransportConfig tunes the connection pool used for HTTP(S) RPC
+// endpoints. Zero values keep the net/http defaults (100 idle connections, 2
+// per host, 90s idle timeout); raise MaxIdleConnsPerHost towards
+// workers × enrich_workers so concurrent calls reuse connections instead of
+// opening new ones.
+type RPCTransportConfig struct {
+    MaxIdleConns        int `yaml:"max_idle_conns" json:"max_idle_conns"`
+    MaxIdleConnsPerHost int `yaml:"max_idle_conns_per_host" json:"max_idle_conns_per_host"`
+    IdleConnTimeoutMS   int `yaml:"idle_conn_timeout_ms" json:"idle_conn_timeout_ms"`
+    // WSCompression negotiates permessage-deflate on WebSocket endpoints.
+    WSCompression bool `yaml:"ws_compression" json:"ws_compression"`
+    // CACertFile is a PEM bundle of CA certificates trusted, on top of the
+    // system roots, for https:// and wss:// endpoints, e.g. a self-hosted
+    // node behind a private CA.
+    CACertFile string `yaml:"ca_cert_file" json:"ca_cert_file"`
+    // InsecureSkipVerify disables certificate verification altogether. Only
+    // meant for development nodes with self-signed certificates.
+    InsecureSkipVerify bool `yaml:"insecure_skip_verify" json:"insecure_skip_verify"`
+}
+
+// ValidateRPCWSURL checks that a rpc_ws_url, when set, is a WebSocket URL.
+func ValidateRPCWSURL(url string) error {
+    if url != "" && !strings.HasPrefix(url, "ws://") && !strings.HasPrefix(url, "wss://") {
+        return fmt.Errorf("rpc_ws_url must be a ws:// or wss:// URL")
+    }
+    return nil
+}
+
+// ValidateRPCTransport rejects negative pool settings.
+func ValidateRPCTransport(t RPCTransportConfig) error {
+    if t.MaxIdleConns < 0 || t.MaxIdleConnsPerHost < 0 || t.IdleConnTimeoutMS < 0 {
+        return fmt.Errorf("rpc_transport.max_idle_conns, max_idle_conns_per_host and idle_conn_timeout_ms must not be negative")
+    }
+    return nil
+}
+
+// ChainConfig describes one chain indexed by a multi-chain process. Every
+// chain gets its own RPC connection, start block and contract list while the
+// remaining settings (storage, retry, workers…) are shared.
+type ChainConfig struct {
+    Name       string           `yaml:"name"`
+    RPCURL     string           `yaml:"rpc_url"`
+    RPCWSURL   string           `yaml:"rpc_ws_url"`
+    StartBlock BlockRef         `yaml:"start_block"` // number, "latest" or "latest-N"
+    Contracts  []ContractConfig `yaml:"contracts"`
 }
 
 type Config struct {
+    // Chain is the label attached to every event as "chain". It is set from
+    // the chain name when the config is expanded from Chains.
+    Chain      string           `yaml:"chain"`
     RPCURL     string           `yaml:"rpc_url"`
-    StartBlock uint64           `yaml:"start_block"`
+    // RPCWSURL, when set, is a ws:// or wss:// endpoint used only for the
+    // subscriptions of follow mode; every other call goes to RPCURL, which
+    // can then be an HTTP endpoint.
+    RPCWSURL   string           `yaml:"rpc_ws_url"`
+    StartBlock BlockRef         `yaml:"start_block"` // number, "latest" or "latest-N"
+    // EndBlock, when set, is the last block of the run instead of the head
+    // seen at start. It cannot be combined with Follow.
+    EndBlock   *BlockRef        `yaml:"end_block"`
     Contracts  []ContractConfig `yaml:"contracts"`
     Storage    StorageConfig    `yaml:"storage"`
+    // Transforms post-process events, in order, before they are written.
+    Transforms []TransformConfig `yaml:"transforms"`
     Retry      RetryConfig      `yaml:"retry"`
+    // RPCTimeoutMS bounds every individual RPC attempt (default 30000) so a
+    // hung call is retried instead of stalling a worker. -1 disables it.
+    RPCTimeoutMS int            `yaml:"rpc_timeout_ms"`
+    // RPCUserAgent identifies the indexer to RPC providers that key quotas
+    // or support by client (default DefaultRPCUserAgent).
+    RPCUserAgent string         `yaml:"rpc_user_agent"`
+    // RPCTransport tunes the HTTP connection pool of the RPC client.
+    RPCTransport RPCTransportConfig `yaml:"rpc_transport"`
     // ChunkSize defines how many blocks will be processed per batch when fetching logs.
     // If not set, a sensible default will be applied by the loader.
     ChunkSize  uint64           `yaml:"chunk_size"`
+    // CatchupChunkSize is the range size used while more than TipThreshold
+    // blocks remain below the chain head, so a back-fill can use large
+    // ranges while ranges near the head stay at ChunkSize. 0 uses ChunkSize
+    // throughout.
+    CatchupChunkSize uint64     `yaml:"catchup_chunk_size"`
+    // TipThreshold is the distance to the head below which ranges switch
+    // from CatchupChunkSize to ChunkSize. 0 means one catch-up range.
+    TipThreshold uint64         `yaml:"tip_threshold"`
+    // TipPollIntervalMS is how often follow mode polls the chain head to
+    // write the logs that reached follow_confirmations (default 5000).
+    TipPollIntervalMS int       `yaml:"tip_poll_interval_ms"`
+    // MaxRPCRange caps the blocks covered by a single eth_getLogs call, for
+    // providers with a hard range limit. Chunks larger than the cap are paged
+    // into several calls. 0 means no cap.
+    MaxRPCRange uint64          `yaml:"max_rpc_range"`
     // Workers defines how many concurrent workers will process block ranges.
     // If not set, it defaults to the number of available CPUs.
     Workers    int              `yaml:"workers"`
+    // MaxWorkers caps Workers so a typo cannot flood the RPC provider with
+    // concurrent requests. Defaults to DefaultMaxWorkers.
+    MaxWorkers int              `yaml:"max_workers"`
+    // EnrichWorkers bounds the concurrent parse/enrichment calls (timestamp,
+    // tx_from, receipts, ...) within a single range. Defaults to 1 (serial).
+    EnrichWorkers int           `yaml:"enrich_workers"`
+    // QueueDepth is the number of block ranges buffered ahead of the workers.
+    // Defaults to twice Workers.
+    QueueDepth int              `yaml:"queue_depth"`
+    // DecodeTxInput enables decoding of the calldata of the transaction that
+    // emitted each log against the contract ABI (method_name + input_* fields).
+    DecodeTxInput bool          `yaml:"decode_tx_input"`
+    // EnrichReceipt attaches tx_status and gas_used from the transaction
+    // receipt, fetched per block with eth_getBlockReceipts when supported.
+    EnrichReceipt bool          `yaml:"enrich_receipt"`
+    // TimestampCacheSize bounds the LRU of block timestamps reused across
+    // events of nearby blocks. Defaults to DefaultTimestampCacheSize.
+    TimestampCacheSize int      `yaml:"timestamp_cache_size"`
+    // SignatureDB is a JSON file of topic0 → event signature (see
+    // LoadSignatureDB) used to name and, best effort, decode events missing
+    // from the ABI. Signatures holds it once loaded.
+    SignatureDB string          `yaml:"signature_db"`
+    Signatures  map[common.Hash]string `yaml:"-" json:"-"`
+    // InlineTimestamps takes block timestamps from the non-standard
+    // blockTimestamp field some providers add to eth_getLogs results instead
+    // of fetching each block header; blocks without it still fetch the header.
+    InlineTimestamps bool       `yaml:"inline_timestamps"`
+    // NoCodeLogs selects how logs emitted by addresses without a configured
+    // entry are treated when the emitter has no code at the latest block
+    // (e.g. a contract that self-destructed): "keep" (the default) does not check,
+    // "flag" marks them with no_code and "skip" drops them.
+    NoCodeLogs    string        `yaml:"no_code_logs"`
+    // IndexBlocks additionally writes one "block" record per scanned block
+    // (hash, timestamp, miner, gas, base fee) regardless of matching logs.
+    IndexBlocks   bool          `yaml:"index_blocks"`
+    // IndexTraces additionally writes one "trace" record per call frame
+    // (from, to, value, input) of every transaction of the scanned blocks,
+    // fetched with trace_block or debug_traceBlockByNumber.
+    IndexTraces   bool          `yaml:"index_traces"`
+    // OnError selects what happens when a block range fails: "abort" (the
+    // default) cancels the whole run, "continue" records the failed range and
+    // keeps processing the others.
+    OnError       string        `yaml:"on_error"`
+    // RetryFailedRanges re-processes the ranges that failed in "continue"
+    // mode once more after all other ranges are done.
+    RetryFailedRanges bool      `yaml:"retry_failed_ranges"`
+    // StrictEvents is kept for compatibility: a configured event name
+    // missing from its contract's ABI is rejected by default.
+    StrictEvents bool           `yaml:"strict_events"`
+    // LenientEvents only logs a warning for configured event names missing
+    // from their contract's ABI instead of rejecting the configuration.
+    LenientEvents bool          `yaml:"lenient_events"`
+    // ExcludeAddresses drops logs emitted by these contracts (e.g. the zero
+    // address or known spam tokens) before they are parsed, whatever the
+    // contracts and events they would otherwise match.
+    ExcludeAddresses []string   `yaml:"exclude_addresses"`
+    // CheckpointFile records the last block up to which every range is
+    // indexed; a later run resumes after it instead of start_block. In
+    // multi-chain mode each chain gets its own file (x.json → x.<chain>.json).
+    CheckpointFile string       `yaml:"checkpoint_file"`
+    // ParseErrorsFile, when set, receives the logs that fail to decode as CSV
+    // rows with their raw topics, data and the error. In multi-chain mode
+    // each chain gets its own file, like CheckpointFile.
+    ParseErrorsFile string      `yaml:"parse_errors_file"`
+    // ReindexOverlap rewinds the resume point (checkpoint, --resume or an API
+    // retry with resume) by this many blocks, never before start_block, so
+    // logs near the previous tip that a reorg replaced are indexed again.
+    ReindexOverlap uint64       `yaml:"reindex_overlap"`
+    // Follow keeps the indexer running after the catch-up phase, indexing new
+    // logs live through a subscription. Requires a WebSocket rpc_url.
+    Follow     bool             `yaml:"follow"`
+    // FollowConfirmations holds live logs in follow mode until their block
+    // has this many blocks on top of it, so logs a reorg retracts in the
+    // meantime never reach the sink. Zero writes logs as they arrive.
+    FollowConfirmations uint64  `yaml:"follow_confirmations"`
+    // Chains enables multi-chain mode: when set, the top-level rpc_url,
+    // start_block and contracts are ignored and one indexer runs per chain.
+    Chains     []ChainConfig    `yaml:"chains"`
+}
+
+// ChainConfigs expands the configuration into one Config per chain. A
+// single-chain config is returned as-is. For the CSV and Parquet sinks each
+// chain writes into its own sub-directory so files and manifests don't collide;
+// checkpoint, parse error and schema files get the chain name as suffix.
+func (c *Config) ChainConfigs() []*Config {
+    if len(c.Chains) == 0 {
+        return []*Config{c}
+    }
+
+    out := make([]*Config, 0, len(c.Chains))
+    for _, ch := range c.Chains {
+        cc := *c
+        cc.Chains = nil
+        cc.Chain = ch.Name
+        cc.RPCURL = ch.RPCURL
+        cc.RPCWSURL = ch.RPCWSURL
+        cc.StartBlock = ch.StartBlock
+        cc.Contracts = ch.Contracts
+        if cc.Storage.CSV.OutputDir != "" {
+            cc.Storage.CSV.OutputDir = filepath.Join(cc.Storage.CSV.OutputDir, ch.Name)
+        }
+        if cc.Storage.Parquet.OutputDir != "" {
+            cc.Storage.Parquet.OutputDir = filepath.Join(cc.Storage.Parquet.OutputDir, ch.Name)
+        }
+        if cc.Storage.Type == "mysql" {
+            name := cc.Storage.MySQL.CheckpointName
+            if name == "" {
+                name = "default"
+            }
+            cc.Storage.MySQL.CheckpointName = name + "." + ch.Name
+        }
+        if cc.CheckpointFile != "" {
+            ext := filepath.Ext(cc.CheckpointFile)
+            cc.CheckpointFile = strings.TrimSuffix(cc.CheckpointFile, ext) + "." + ch.Name + ext
+        }
+        if cc.ParseErrorsFile != "" {
+            ext := filepath.Ext(cc.ParseErrorsFile)
+            cc.ParseErrorsFile = strings.TrimSuffix(cc.ParseErrorsFile, ext) + "." + ch.Name + ext
+        }
+        if cc.Storage.Schema.File != "" {
+            ext := filepath.Ext(cc.Storage.Schema.File)
+            cc.Storage.Schema.File = strings.TrimSuffix(cc.Storage.Schema.File, ext) + "." + ch.Name + ext
+        }
+        out = append(out, &cc)
+    }
+    return out
+}
+
+// Supported values of Config.OnError.
+const (
+    OnErrorAbort    = "abort"
+    OnErrorContinue = "continue"
+)
+
+// ValidateOnError checks the on_error setting. An empty value selects abort.
+func ValidateOnError(s string) error {
+    switch s {
+    case "", OnErrorAbort, OnErrorContinue:
+        return nil
+    default:
+        return fmt.Errorf("on_error must be %q or %q, got %q", OnErrorAbort, OnErrorContinue, s)
+    }
+}
+
+// Supported values of StorageConfig.Schema.OnDrift.
+const (
+    SchemaDriftWarn = "warn"
+    SchemaDriftFail = "fail"
+)
+
+// Supported values of Config.NoCodeLogs.
+const (
+    NoCodeLogsKeep = "keep"
+    NoCodeLogsFlag = "flag"
+    NoCodeLogsSkip = "skip"
+)
+
+// ValidateNoCodeLogs checks the no_code_logs setting. An empty value selects
+// keep.
+func ValidateNoCodeLogs(s string) error {
+    switch s {
+    case "", NoCodeLogsKeep, NoCodeLogsFlag, NoCodeLogsSkip:
+        return nil
+    default:
+        return fmt.Errorf("no_code_logs must be %q, %q or %q, got %q", NoCodeLogsKeep, NoCodeLogsFlag, NoCodeLogsSkip, s)
+    }
+}
+
+// ParseDelimiter validates a CSV delimiter setting and returns it as a rune.
+// An empty value selects the default comma.
+func ParseDelimiter(s string) (rune, error) {
+    if s == "" {
+        return ',', nil
+    }
+    if utf8.RuneCountInString(s) != 1 {
+        return 0, fmt.Errorf("delimiter must be a single character, got %q", s)
+    }
+    r, _ := utf8.DecodeRuneInString(s)
+    if r == utf8.RuneError || r == '"' || r == '\r' || r == '\n' {
+        return 0, fmt.Errorf("invalid delimiter %q", s)
+    }
+    return r, nil
 }
 
 // Load reads and unmarshals the configuration file located at the given path.
@@ -62,73 +543,55 @@ func Load(path string) (*Config, error) {
         return nil, err
     }
 
+    // Strict decoding: unknown (e.g. misspelled or mis-indented) keys are
+    // reported with their line instead of silently yielding zero values.
     var cfg Config
-    if err := yaml.Unmarshal(data, &cfg); err != nil {
-        return nil, err
+    if err := yaml.UnmarshalStrict(data, &cfg); err != nil {
+        return nil, fmt.Errorf("failed to parse %s: %w", path, err)
     }
 
-    // Basic validation
-    if cfg.RPCURL == "" {
-        return nil, fmt.Errorf("rpc_url is required")
-    }
-
-    // Validate storage configuration
-    switch cfg.Storage.Type {
-    case "mysql":
-        if cfg.Storage.MySQL.DSN == "" {
-            return nil, fmt.Errorf("storage.mysql.dsn is required when storage type is mysql")
-        }
-    case "csv":
-        if cfg.Storage.CSV.OutputDir == "" {
-            return nil, fmt.Errorf("storage.csv.output_dir is required when storage type is csv")
-        }
-    default:
-        return nil, fmt.Errorf("unsupported storage type: %s", cfg.Storage.Type)
+    if err := resolveSecrets(&cfg); err != nil {
+        return nil, err
     }
 
-    // Ensure we have at least one contract
-    if len(cfg.Contracts) == 0 {
-        return nil, fmt.Errorf("at least one contract must be defined")
+    // Report every structural problem at once.
+    if err := cfg.Validate(); err != nil {
+        return nil, err
     }
 
     // Directory of the config file to resolve relative paths
     cfgDir := filepath.Dir(absPath)
 
-    // Load and parse ABI for each contract
-    for i, c := range cfg.Contracts {
-        if c.Name == "" {
-            return nil, fmt.Errorf("contract at index %d is missing name", i)
-        }
-        if c.Address == "" {
-            return nil, fmt.Errorf("contract '%s' is missing address", c.Name)
-        }
-        if c.ABI == "" {
-            return nil, fmt.Errorf("contract '%s' is missing abi path", c.Name)
-        }
-
-        abiPath := c.ABI
-        if !filepath.IsAbs(abiPath) {
-            abiPath = filepath.Join(cfgDir, abiPath)
+    if len(cfg.Chains) > 0 {
+        for i, ch := range cfg.Chains {
+            if err := loadContracts(cfg.Chains[i].Contracts, cfgDir); err != nil {
+                return nil, fmt.Errorf("chain '%s': %w", ch.Name, err)
+            }
         }
+    } else if err := loadContracts(cfg.Contracts, cfgDir); err != nil {
+        return nil, err
+    }
 
-        // Verify file exists
-        if _, err := os.Stat(abiPath); err != nil {
-            return nil, fmt.Errorf("abi file for contract '%s' not found: %w", c.Name, err)
+    if cfg.SignatureDB != "" {
+        if !filepath.IsAbs(cfg.SignatureDB) {
+            cfg.SignatureDB = filepath.Join(cfgDir, cfg.SignatureDB)
         }
-
-        abiBytes, err := ioutil.ReadFile(abiPath)
-        if err != nil {
-            return nil, fmt.Errorf("failed to read abi file for contract '%s': %w", c.Name, err)
+        if cfg.Signatures, err = LoadSignatureDB(cfg.SignatureDB); err != nil {
+            return nil, err
         }
+    }
 
-        parsed, err := abi.JSON(bytes.NewReader(abiBytes))
-        if err != nil {
-            return nil, fmt.Errorf("failed to parse abi for contract '%s': %w", c.Name, err)
+    missing := MissingEvents(cfg.Contracts)
+    for _, ch := range cfg.Chains {
+        for _, m := range MissingEvents(ch.Contracts) {
+            missing = append(missing, fmt.Sprintf("chain '%s': %s", ch.Name, m))
         }
-
-        cfg.Contracts[i].ParsedABI = &parsed
-        // Replace ABI path with absolute path for future reference
-        cfg.Contracts[i].ABI = abiPath
+    }
+    if len(missing) > 0 && !cfg.LenientEvents {
+        return nil, &ValidationError{Problems: missing}
+    }
+    for _, m := range missing {
+        logrus.Warn(m)
     }
 
     // Default retry values if not set
@@ -144,13 +607,270 @@ func Load(path string) (*Config, error) {
         cfg.ChunkSize = 1_000
     }
 
-    // Default workers to the number of CPUs when not provided or invalid.
-    if cfg.Workers <= 0 {
-        cfg.Workers = runtime.NumCPU()
-        if cfg.Workers < 1 {
-            cfg.Workers = 1
-        }
+    if cfg.RPCTimeoutMS == 0 {
+        cfg.RPCTimeoutMS = DefaultRPCTimeoutMS
+    }
+    if cfg.RPCUserAgent == "" {
+        cfg.RPCUserAgent = DefaultRPCUserAgent
     }
 
+    if cfg.TimestampCacheSize <= 0 {
+        cfg.TimestampCacheSize = DefaultTimestampCacheSize
+    }
+
+    cfg.NormalizeWorkers()
+
     return &cfg, nil
-} 
\ No newline at end of file
+}
+
+// RPCTimeout returns the per-call RPC timeout; zero means no timeout.
+func (c *Config) RPCTimeout() time.Duration {
+    if c.RPCTimeoutMS <= 0 {
+        return 0
+    }
+    return time.Duration(c.RPCTimeoutMS) * time.Millisecond
+}
+
+// NormalizeWorkers defaults Workers to the number of CPUs when not provided or
+// invalid and clamps it to MaxWorkers, logging a warning when it does.
+// EnrichWorkers defaults to 1 and is clamped the same way. QueueDepth is
+// clamped to QueueDepthPerMaxWorker × MaxWorkers.
+func (c *Config) NormalizeWorkers() {
+    if c.MaxWorkers <= 0 {
+        c.MaxWorkers = DefaultMaxWorkers
+    }
+    if c.Workers <= 0 {
+        c.Workers = runtime.NumCPU()
+        if c.Workers < 1 {
+            c.Workers = 1
+        }
+    }
+    if c.Workers > c.MaxWorkers {
+        logrus.Warnf("workers=%d exceeds max_workers=%d, clamping", c.Workers, c.MaxWorkers)
+        c.Workers = c.MaxWorkers
+    }
+    if c.EnrichWorkers <= 0 {
+        c.EnrichWorkers = 1
+    }
+    if c.EnrichWorkers > c.MaxWorkers {
+        logrus.Warnf("enrich_workers=%d exceeds max_workers=%d, clamping", c.EnrichWorkers, c.MaxWorkers)
+        c.EnrichWorkers = c.MaxWorkers
+    }
+    if maxDepth := QueueDepthPerMaxWorker * c.MaxWorkers; c.QueueDepth > maxDepth {
+        logrus.Warnf("queue_depth=%d exceeds %d (%d per max_workers), clamping", c.QueueDepth, maxDepth, QueueDepthPerMaxWorker)
+        c.QueueDepth = maxDepth
+    }
+}
+
+// ValidateStorage checks the settings required by the primary storage type
+// and every mirror.
+func ValidateStorage(st StorageConfig) error {
+    if st.DeadLetter.MaxEvents < 0 {
+        return fmt.Errorf("storage.dead_letter.max_events must not be negative")
+    }
+    switch st.Schema.OnDrift {
+    case "", SchemaDriftWarn, SchemaDriftFail:
+    default:
+        return fmt.Errorf("storage.schema.on_drift must be %q or %q, got %q", SchemaDriftWarn, SchemaDriftFail, st.Schema.OnDrift)
+    }
+    if err := ValidateTableMap(st.TableMap); err != nil {
+        return fmt.Errorf("storage.table_map: %w", err)
+    }
+    if err := ValidatePrimaryKey(st.PrimaryKey); err != nil {
+        return fmt.Errorf("storage.primary_key: %w", err)
+    }
+    for _, typ := range append([]string{st.Type}, st.Mirror...) {
+        switch typ {
+        case "mysql":
+            if st.MySQL.DSN == "" {
+                return fmt.Errorf("storage.mysql.dsn is required when storage type is mysql")
+            }
+        case "csv":
+            if len(st.TableMap) > 0 {
+                return fmt.Errorf("storage.table_map is not supported by the csv sink")
+            }
+            if st.CSV.OutputDir == "" {
+                return fmt.Errorf("storage.csv.output_dir is required when storage type is csv")
+            }
+            if _, err := ParseDelimiter(st.CSV.Delimiter); err != nil {
+                return fmt.Errorf("storage.csv.delimiter: %w", err)
+            }
+            if err := ValidateFileNameTemplate(st.CSV.FileNameTemplate); err != nil {
+                return fmt.Errorf("storage.csv.file_name_template: %w", err)
+            }
+            if st.CSV.FlushRows < 0 || st.CSV.FlushIntervalMS < 0 {
+                return fmt.Errorf("storage.csv.flush_rows and flush_interval_ms must not be negative")
+            }
+        case "parquet":
+            if len(st.TableMap) > 0 {
+                return fmt.Errorf("storage.table_map is not supported by the parquet sink")
+            }
+            if st.Parquet.OutputDir == "" {
+                return fmt.Errorf("storage.parquet.output_dir is required when storage type is parquet")
+            }
+            switch st.Parquet.Compression {
+            case "", "gzip", "none":
+            default:
+                return fmt.Errorf("storage.parquet.compression must be gzip or none, got %q", st.Parquet.Compression)
+            }
+        case "bigquery":
+            if st.BigQuery.Project == "" || st.BigQuery.Dataset == "" {
+                return fmt.Errorf("storage.bigquery.project and storage.bigquery.dataset are required when storage type is bigquery")
+            }
+            if st.BigQuery.BatchSize < 0 {
+                return fmt.Errorf("storage.bigquery.batch_size must not be negative")
+            }
+        default:
+            if !IsStorageType(typ) {
+                return fmt.Errorf("unsupported storage type: %s", typ)
+            }
+        }
+    }
+    return nil
+}
+
+// ValidateTableMap checks that every key of a table_map has the form
+// "<contract>.<event>" and maps to a table name.
+func ValidateTableMap(m map[string]string) error {
+    for key, table := range m {
+        // Event names cannot contain dots, contract names may.
+        i := strings.LastIndex(key, ".")
+        if i <= 0 || i == len(key)-1 {
+            return fmt.Errorf("key %q must have the form <contract>.<event>", key)
+        }
+        if strings.TrimSpace(table) == "" {
+            return fmt.Errorf("%q maps to an empty table name", key)
+        }
+    }
+    return nil
+}
+
+// DefaultPrimaryKey identifies an event row: its log within the chain.
+var DefaultPrimaryKey = []string{"tx_hash", "log_index"}
+
+// ValidatePrimaryKey checks that every primary_key entry lists at least one
+// column and no column twice. Whether the columns exist is only known once
+// the first event of a table is written.
+func ValidatePrimaryKey(m map[string][]string) error {
+    for table, cols := range m {
+        if len(cols) == 0 {
+            return fmt.Errorf("%q lists no columns", table)
+        }
+        seen := make(map[string]bool, len(cols))
+        for _, c := range cols {
+            if strings.TrimSpace(c) == "" {
+                return fmt.Errorf("%q lists an empty column", table)
+            }
+            if seen[c] {
+                return fmt.Errorf("%q lists column %q twice", table, c)
+            }
+            seen[c] = true
+        }
+    }
+    return nil
+}
+
+var (
+    storageTypesMu sync.RWMutex
+    storageTypes   = make(map[string]bool)
+)
+
+// RegisterStorageType marks a storage type as valid for storage.type and
+// storage.mirror. It is called by sink.Register.
+func RegisterStorageType(name string) {
+    storageTypesMu.Lock()
+    storageTypes[name] = true
+    storageTypesMu.Unlock()
+}
+
+// IsStorageType reports whether a sink was registered under name.
+func IsStorageType(name string) bool {
+    storageTypesMu.RLock()
+    defer storageTypesMu.RUnlock()
+    return storageTypes[name]
+}
+
+var (
+    decodersMu sync.RWMutex
+    decoders   = make(map[string]bool)
+)
+
+// RegisterDecoder marks a decoder name as valid for the decoder setting of
+// a contract. It is called by parser.RegisterDecoder.
+func RegisterDecoder(name string) {
+    decodersMu.Lock()
+    decoders[name] = true
+    decodersMu.Unlock()
+}
+
+// IsDecoder reports whether a decoder was registered under name.
+func IsDecoder(name string) bool {
+    decodersMu.RLock()
+    defer decodersMu.RUnlock()
+    return decoders[name]
+}
+
+// resolveSecrets replaces secret:// references in the DSN and RPC URLs with
+// their plaintext values. Literal values are kept as-is.
+func resolveSecrets(cfg *Config) error {
+    ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+    defer cancel()
+
+    var err error
+    if cfg.Storage.MySQL.DSN, err = ResolveSecret(ctx, cfg.Storage.MySQL.DSN); err != nil {
+        return fmt.Errorf("storage.mysql.dsn: %w", err)
+    }
+    if cfg.RPCURL, err = ResolveSecret(ctx, cfg.RPCURL); err != nil {
+        return fmt.Errorf("rpc_url: %w", err)
+    }
+    if cfg.RPCWSURL, err = ResolveSecret(ctx, cfg.RPCWSURL); err != nil {
+        return fmt.Errorf("rpc_ws_url: %w", err)
+    }
+    for i := range cfg.Chains {
+        if cfg.Chains[i].RPCURL, err = ResolveSecret(ctx, cfg.Chains[i].RPCURL); err != nil {
+            return fmt.Errorf("chain '%s' rpc_url: %w", cfg.Chains[i].Name, err)
+        }
+        if cfg.Chains[i].RPCWSURL, err = ResolveSecret(ctx, cfg.Chains[i].RPCWSURL); err != nil {
+            return fmt.Errorf("chain '%s' rpc_ws_url: %w", cfg.Chains[i].Name, err)
+        }
+    }
+    return nil
+}
+
+// loadContracts parses the ABI files of the contract entries (already checked
+// by Validate), resolving relative paths against cfgDir. Entries are updated
+// in place.
+func loadContracts(contracts []ContractConfig, cfgDir string) error {
+    // Load and parse ABI for each contract
+    for i, c := range contracts {
+        abiPaths := make(ABIPaths, len(c.ABI))
+        for j, abiPath := range c.ABI {
+            if !filepath.IsAbs(abiPath) {
+                abiPath = filepath.Join(cfgDir, abiPath)
+            }
+
+            // Verify file exists
+            if _, err := os.Stat(abiPath); err != nil {
+                return fmt.Errorf("abi file for contract '%s' not found: %w", c.Name, err)
+            }
+            abiPaths[j] = abiPath
+        }
+
+        parsed, err := ParseABIFiles(abiPaths, c.Name)
+        if err != nil {
+            return err
+        }
+
+        contracts[i].ParsedABI = parsed
+        // Replace ABI paths with absolute paths for future reference
+        contracts[i].ABI = abiPaths
+
+        for event := range c.Topics {
+            if _, err := EventTopicFilter(contracts[i], event); err != nil {
+                return err
+            }
+        }
+    }
+
+    return nil
+}
\ No newline at end of file
@@ -0,0 +1,285 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateStorageTableMap(t *testing.T) {
+    tableMap := map[string]string{"*.Transfer": "erc20_transfers"}
+    cases := []struct {
+        name    string
+        storage StorageConfig
+        wantErr string
+    }{
+        {name: "bigquery", storage: StorageConfig{Type: "bigquery"}},
+        {name: "csv", storage: StorageConfig{Type: "csv"}, wantErr: "not supported by the csv sink"},
+        {name: "parquet", storage: StorageConfig{Type: "parquet"}, wantErr: "not supported by the parquet sink"},
+        {name: "csv mirror", storage: StorageConfig{Type: "bigquery", Mirror: []string{"csv"}}, wantErr: "not supported by the csv sink"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            st := tc.storage
+            st.TableMap = tableMap
+            st.BigQuery.Project, st.BigQuery.Dataset = "p", "d"
+            st.CSV.OutputDir, st.Parquet.OutputDir = "./out", "./lake"
+            err := ValidateStorage(st)
+            if tc.wantErr == "" {
+                if err != nil {
+                    t.Fatalf("ValidateStorage: %v", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+                t.Fatalf("ValidateStorage = %v, want %q", err, tc.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateTableMapKeys(t *testing.T) {
+    for key, ok := range map[string]bool{
+        "USDC.Transfer":    true,
+        "*.Transfer":       true,
+        "My.Token.Approve": true,
+        "Transfer":         false,
+        ".Transfer":        false,
+        "USDC.":            false,
+    } {
+        err := ValidateTableMap(map[string]string{key: "t"})
+        if (err == nil) != ok {
+            t.Errorf("ValidateTableMap(%q) = %v, want ok=%v", key, err, ok)
+        }
+    }
+    if err := ValidateTableMap(map[string]string{"USDC.Transfer": " "}); err == nil {
+        t.Error("ValidateTableMap accepted an empty table name")
+    }
+}
+
+func TestValidateChainNames(t *testing.T) {
+    for name, ok := range map[string]bool{
+        "mainnet":      true,
+        "arbitrum-one": true,
+        "op.mainnet":   true,
+        "base_sepolia": true,
+        "../x":         false,
+        "a/b":          false,
+        `a\b`:          false,
+        ".":            false,
+        "..":           false,
+        "-mainnet":     false,
+    } {
+        cfg := &Config{Chains: []ChainConfig{{Name: name, RPCURL: "http://localhost:8545"}}}
+        err := cfg.Validate()
+        rejected := err != nil && strings.Contains(err.Error(), "invalid name")
+        if rejected == ok {
+            t.Errorf("chain name %q: %v, want ok=%v", name, err, ok)
+        }
+    }
+}
+
+func TestChainConfigsSeparateOutputs(t *testing.T) {
+    cfg := &Config{
+        CheckpointFile: "state/progress.json",
+        Chains: []ChainConfig{
+            {Name: "mainnet", RPCURL: "http://mainnet"},
+            {Name: "base", RPCURL: "http://base", StartBlock: BlockRef{Number: 7}},
+        },
+    }
+    cfg.Storage.CSV.OutputDir = "out"
+    chains := cfg.ChainConfigs()
+    if len(chains) != 2 {
+        t.Fatalf("got %d configs, want 2", len(chains))
+    }
+    base := chains[1]
+    if base.Chain != "base" || base.RPCURL != "http://base" || base.StartBlock.Number != 7 || len(base.Chains) != 0 {
+        t.Errorf("base config = %+v", base)
+    }
+    if base.Storage.CSV.OutputDir != filepath.Join("out", "base") || base.CheckpointFile != "state/progress.base.json" {
+        t.Errorf("base outputs = %s, %s", base.Storage.CSV.OutputDir, base.CheckpointFile)
+    }
+    if chains[0].Storage.CSV.OutputDir != filepath.Join("out", "mainnet") || cfg.Storage.CSV.OutputDir != "out" {
+        t.Errorf("mainnet output = %s, original = %s", chains[0].Storage.CSV.OutputDir, cfg.Storage.CSV.OutputDir)
+    }
+}
+
+func TestValidateRPCTransport(t *testing.T) {
+    if err := ValidateRPCTransport(RPCTransportConfig{MaxIdleConns: 100, MaxIdleConnsPerHost: 32, IdleConnTimeoutMS: 1000}); err != nil {
+        t.Errorf("ValidateRPCTransport: %v", err)
+    }
+    for _, tc := range []RPCTransportConfig{{MaxIdleConns: -1}, {MaxIdleConnsPerHost: -1}, {IdleConnTimeoutMS: -1}} {
+        if err := ValidateRPCTransport(tc); err == nil {
+            t.Errorf("ValidateRPCTransport(%+v) accepted a negative setting", tc)
+        }
+    }
+}
+
+func TestValidateContractAddresses(t *testing.T) {
+    const a1, a2 = "0x00000000000000000000000000000000000000a1", "0x00000000000000000000000000000000000000a2"
+    cases := []struct {
+        name     string
+        contract ContractConfig
+        wantErr  string
+    }{
+        {name: "address", contract: ContractConfig{Address: a1}},
+        {name: "addresses", contract: ContractConfig{Addresses: []string{a1, a2}}},
+        {name: "both", contract: ContractConfig{Address: a1, Addresses: []string{a2}}, wantErr: "not both"},
+        {name: "comma list", contract: ContractConfig{Address: a1 + "," + a2}, wantErr: "list several contracts under addresses"},
+        {name: "wildcard", contract: ContractConfig{Address: "*"}, wantErr: "list several contracts under addresses"},
+        {name: "not hex", contract: ContractConfig{Address: "usdc"}, wantErr: `address: invalid address "usdc"`},
+        {name: "bad list entry", contract: ContractConfig{Addresses: []string{a1, "0x12"}}, wantErr: "addresses[1]: invalid address"},
+        {name: "duplicate", contract: ContractConfig{Addresses: []string{a1, "0x" + strings.ToUpper(a1[2:])}}, wantErr: "addresses[1]: duplicate address"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            err := ValidateContractAddresses(tc.contract)
+            if tc.wantErr == "" {
+                if err != nil {
+                    t.Fatalf("ValidateContractAddresses: %v", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+                t.Fatalf("ValidateContractAddresses = %v, want %q", err, tc.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateExcludeAddresses(t *testing.T) {
+    const zero = "0x0000000000000000000000000000000000000000"
+    cases := []struct {
+        name    string
+        addrs   []string
+        wantErr string
+    }{
+        {name: "none"},
+        {name: "addresses", addrs: []string{zero, "0x00000000000000000000000000000000000000A1"}},
+        {name: "short", addrs: []string{zero, "0x12"}, wantErr: `exclude_addresses[1]: invalid address "0x12"`},
+        {name: "not hex", addrs: []string{"burn"}, wantErr: `exclude_addresses[0]: invalid address "burn"`},
+        {name: "empty", addrs: []string{""}, wantErr: "exclude_addresses[0]"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            err := ValidateExcludeAddresses(tc.addrs)
+            if tc.wantErr == "" {
+                if err != nil {
+                    t.Fatalf("ValidateExcludeAddresses: %v", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+                t.Fatalf("ValidateExcludeAddresses = %v, want %q", err, tc.wantErr)
+            }
+        })
+    }
+}
+
+func TestValidateFileNameTemplate(t *testing.T) {
+    cases := []struct {
+        tmpl    string
+        wantErr string
+    }{
+        {tmpl: ""},
+        {tmpl: "{contract}_{event}.csv"},
+        {tmpl: "{chain}/{chain_id}/{address}/{event}.csv"},
+        {tmpl: "{contract}..{event}.csv"},
+        {tmpl: "{contract}/{block}.csv", wantErr: "unknown placeholder {block}"},
+        {tmpl: "{}.csv", wantErr: "unknown placeholder {}"},
+        {tmpl: "/var/out/{event}.csv", wantErr: "must be a relative path"},
+        {tmpl: "../{event}.csv", wantErr: "must not contain '..'"},
+        {tmpl: "{chain}/../../{event}.csv", wantErr: "must not contain '..'"},
+        {tmpl: `{chain}\..\{event}.csv`, wantErr: "must not contain '..'"},
+        {tmpl: "{contract}/{event}/", wantErr: "must name a file"},
+    }
+    for _, tc := range cases {
+        err := ValidateFileNameTemplate(tc.tmpl)
+        if tc.wantErr == "" {
+            if err != nil {
+                t.Errorf("ValidateFileNameTemplate(%q): %v", tc.tmpl, err)
+            }
+            continue
+        }
+        if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+            t.Errorf("ValidateFileNameTemplate(%q) = %v, want %q", tc.tmpl, err, tc.wantErr)
+        }
+    }
+}
+
+func TestExpandAddresses(t *testing.T) {
+    contracts := []ContractConfig{
+        {Name: "Single", Address: "0x01"},
+        {Name: "Stables", Addresses: []string{"0x02", "0x03"}, Events: []string{"Transfer"}},
+    }
+    got := ExpandAddresses(contracts)
+    if len(got) != 3 {
+        t.Fatalf("got %d entries, want 3: %+v", len(got), got)
+    }
+    for i, want := range []string{"0x01", "0x02", "0x03"} {
+        if got[i].Address != want || len(got[i].Addresses) != 0 {
+            t.Errorf("entry %d = %+v, want address %s", i, got[i], want)
+        }
+    }
+    if got[1].Name != "Stables" || got[2].Name != "Stables" || len(got[2].Events) != 1 {
+        t.Errorf("expanded entries lost their settings: %+v", got[1:])
+    }
+    if len(contracts[1].Addresses) != 2 {
+        t.Error("ExpandAddresses modified its input")
+    }
+}
+
+func TestValidateRPCWSURL(t *testing.T) {
+    for url, ok := range map[string]bool{
+        "":                            true,
+        "ws://localhost:8546":         true,
+        "wss://mainnet.example/ws":    true,
+        "http://localhost:8545":       false,
+        "https://mainnet.example/rpc": false,
+    } {
+        if err := ValidateRPCWSURL(url); (err == nil) != ok {
+            t.Errorf("ValidateRPCWSURL(%q) = %v, want ok=%v", url, err, ok)
+        }
+    }
+}
+
+func TestValidatePrimaryKey(t *testing.T) {
+    if err := ValidatePrimaryKey(map[string][]string{"*": DefaultPrimaryKey, "blocks": {"block_number"}}); err != nil {
+        t.Errorf("ValidatePrimaryKey: %v", err)
+    }
+    for name, pk := range map[string][]string{
+        "no columns":   {},
+        "empty column": {"block_number", " "},
+        "duplicate":    {"tx_hash", "log_index", "tx_hash"},
+    } {
+        if err := ValidatePrimaryKey(map[string][]string{"Token_Transfer": pk}); err == nil {
+            t.Errorf("%s: ValidatePrimaryKey accepted %q", name, pk)
+        }
+    }
+    st := StorageConfig{Type: "bigquery", PrimaryKey: map[string][]string{"blocks": {}}}
+    st.BigQuery.Project, st.BigQuery.Dataset = "p", "d"
+    if err := ValidateStorage(st); err == nil || !strings.Contains(err.Error(), "storage.primary_key") {
+        t.Errorf("ValidateStorage = %v, want a storage.primary_key error", err)
+    }
+}
+
+func TestNormalizeWorkersCapsQueueDepth(t *testing.T) {
+    for _, tc := range []struct {
+        name              string
+        maxWorkers, depth int
+        want              int
+    }{
+        {name: "default", depth: 0, want: 0},
+        {name: "within", depth: 100, want: 100},
+        {name: "oversized", depth: 1_000_000, want: QueueDepthPerMaxWorker * DefaultMaxWorkers},
+        {name: "max_workers", maxWorkers: 4, depth: 1_000, want: QueueDepthPerMaxWorker * 4},
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            cfg := &Config{Workers: 1, MaxWorkers: tc.maxWorkers, QueueDepth: tc.depth}
+            cfg.NormalizeWorkers()
+            if cfg.QueueDepth != tc.want {
+                t.Errorf("queue_depth = %d, want %d", cfg.QueueDepth, tc.want)
+            }
+        })
+    }
+}
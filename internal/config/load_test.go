@@ -0,0 +1,201 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// transferABI is the ABI of the ERC-20 Transfer event.
+const transferABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"from","type":"address"},
+    {"indexed":true,"name":"to","type":"address"},
+    {"indexed":false,"name":"value","type":"uint256"}]}]`
+
+// writeConfig writes yaml as config.yaml, next to token.json holding
+// transferABI, and returns its path.
+func writeConfig(t *testing.T, yaml string) string {
+    t.Helper()
+    dir := t.TempDir()
+    if err := os.WriteFile(filepath.Join(dir, "token.json"), []byte(transferABI), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    path := filepath.Join(dir, "config.yaml")
+    if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+// tokenConfig is a config indexing events of a Token contract.
+func tokenConfig(events, extra string) string {
+    return `rpc_url: http://localhost:8545
+storage:
+  type: csv
+  csv:
+    output_dir: out
+contracts:
+  - name: Token
+    address: "0x00000000000000000000000000000000000000a1"
+    abi: token.json
+    events: [` + events + `]
+` + extra
+}
+
+func TestLoadRejectsEventsMissingFromABI(t *testing.T) {
+    _, err := Load(writeConfig(t, tokenConfig("Transfer, Tranfser, Approval", "")))
+    var verr *ValidationError
+    if !errors.As(err, &verr) {
+        t.Fatalf("Load = %v, want a ValidationError", err)
+    }
+    if len(verr.Problems) != 1 || !strings.Contains(verr.Problems[0], "contract 'Token': events not found in ABI: Tranfser, Approval") {
+        t.Fatalf("problems = %q", verr.Problems)
+    }
+}
+
+func TestLoadLenientEventsOnlyWarns(t *testing.T) {
+    cfg, err := Load(writeConfig(t, tokenConfig("Transfer, Approval", "lenient_events: true\n")))
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    if len(cfg.Contracts) != 1 || cfg.Contracts[0].ParsedABI == nil {
+        t.Fatalf("contracts = %+v", cfg.Contracts)
+    }
+}
+
+func TestLoadAcceptsEventReferences(t *testing.T) {
+    refs := `Transfer, "Transfer(address,address,uint256)", "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"`
+    if _, err := Load(writeConfig(t, tokenConfig(refs, ""))); err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+}
+
+func TestLoadReportsMissingEventsPerChain(t *testing.T) {
+    yaml := `storage:
+  type: csv
+  csv:
+    output_dir: out
+chains:
+  - name: mainnet
+    rpc_url: http://localhost:8545
+    contracts:
+      - name: Token
+        address: "0x00000000000000000000000000000000000000a1"
+        abi: token.json
+        events: [Transfer]
+  - name: base
+    rpc_url: http://localhost:8546
+    contracts:
+      - name: Bridged
+        address: "0x00000000000000000000000000000000000000a2"
+        abi: token.json
+        events: [Mint]
+`
+    _, err := Load(writeConfig(t, yaml))
+    var verr *ValidationError
+    if !errors.As(err, &verr) || len(verr.Problems) != 1 || !strings.HasPrefix(verr.Problems[0], "chain 'base': contract 'Bridged'") {
+        t.Fatalf("Load = %v, want the missing event of base only", err)
+    }
+}
+
+func TestLoadDefaultsRPCUserAgent(t *testing.T) {
+    cfg, err := Load(writeConfig(t, tokenConfig("Transfer", "")))
+    if err != nil {
+        t.Fatalf("Load: %v", err)
+    }
+    if cfg.RPCUserAgent != DefaultRPCUserAgent || !strings.HasPrefix(cfg.RPCUserAgent, "etl-evm-chain/") {
+        t.Errorf("rpc_user_agent = %q, want %q", cfg.RPCUserAgent, DefaultRPCUserAgent)
+    }
+    cfg, err = Load(writeConfig(t, tokenConfig("Transfer", "rpc_user_agent: acme-indexer/2\n")))
+    if err != nil || cfg.RPCUserAgent != "acme-indexer/2" {
+        t.Errorf("rpc_user_agent = %q (%v), want the configured one", cfg.RPCUserAgent, err)
+    }
+}
+
+func TestLoadRejectsMalformedConfigs(t *testing.T) {
+    cases := []struct {
+        name string
+        yaml string
+        want []string
+    }{
+        {
+            name: "misspelled key",
+            yaml: strings.Replace(tokenConfig("Transfer", ""), "rpc_url:", "rpcurl:", 1),
+            want: []string{"line 1: field rpcurl not found"},
+        },
+        {
+            name: "mis-indented contract field",
+            yaml: tokenConfig("Transfer", "abi: token.json\n"),
+            want: []string{"field abi not found"},
+        },
+        {
+            name: "misspelled nested key",
+            yaml: strings.Replace(tokenConfig("Transfer", ""), "output_dir:", "outputdir:", 1),
+            want: []string{"field outputdir not found"},
+        },
+        {
+            name: "wrong type",
+            yaml: tokenConfig("Transfer", "workers: many\n"),
+            want: []string{"cannot unmarshal !!str `many` into int"},
+        },
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            _, err := Load(writeConfig(t, tc.yaml))
+            if err == nil {
+                t.Fatal("Load succeeded")
+            }
+            for _, w := range tc.want {
+                if !strings.Contains(err.Error(), w) {
+                    t.Errorf("Load = %v, want %q", err, w)
+                }
+            }
+        })
+    }
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+    yaml := `storage:
+  type: csv
+on_error: skip
+workers: -1
+retry:
+  attempts: -2
+exclude_addresses: ["0x12"]
+contracts:
+  - address: "0x00000000000000000000000000000000000000a1"
+    abi: token.json
+  - name: NoABI
+    address: "0xzz"
+`
+    _, err := Load(writeConfig(t, yaml))
+    var verr *ValidationError
+    if !errors.As(err, &verr) {
+        t.Fatalf("Load = %v, want a ValidationError", err)
+    }
+    want := []string{
+        "rpc_url is required",
+        "csv.output_dir",
+        "on_error",
+        "workers must not be negative, got -1",
+        "retry.attempts must not be negative, got -2",
+        `exclude_addresses[0]: invalid address "0x12"`,
+        "contracts[0]: name is required",
+        "contract 'NoABI': abi path is required",
+        `contract 'NoABI': address: invalid address "0xzz"`,
+    }
+    all := strings.Join(verr.Problems, "\n")
+    for _, w := range want {
+        if !strings.Contains(all, w) {
+            t.Errorf("problems lack %q:\n%s", w, all)
+        }
+    }
+    if len(verr.Problems) != len(want) {
+        t.Errorf("got %d problems, want %d:\n%s", len(verr.Problems), len(want), all)
+    }
+    if !strings.HasPrefix(err.Error(), "invalid config:\n  - ") {
+        t.Errorf("error = %q", err)
+    }
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+// redactedMask replaces secret values in printed configurations.
+const redactedMask = "****"
+
+// secretQueryParams lists query parameter names whose values are masked in
+// RPC URLs and DSNs.
+var secretQueryParams = map[string]bool{
+    "key":          true,
+    "apikey":       true,
+    "api_key":      true,
+    "token":        true,
+    "access_token": true,
+    "secret":       true,
+    "auth":         true,
+    "password":     true,
+}
+
+// Redacted returns a copy of the configuration that is safe to print: RPC
+// URLs and storage DSNs have their credentials masked. The receiver is left
+// untouched.
+func (c *Config) Redacted() *Config {
+    out := *c
+    out.RPCURL = RedactURL(c.RPCURL)
+    out.RPCWSURL = RedactURL(c.RPCWSURL)
+    out.Storage.MySQL.DSN = RedactDSN(c.Storage.MySQL.DSN)
+
+    if len(c.Chains) > 0 {
+        out.Chains = make([]ChainConfig, len(c.Chains))
+        for i, ch := range c.Chains {
+            ch.RPCURL = RedactURL(ch.RPCURL)
+            ch.RPCWSURL = RedactURL(ch.RPCWSURL)
+            out.Chains[i] = ch
+        }
+    }
+    return &out
+}
+
+// RedactURL masks the secrets commonly embedded in RPC endpoints: userinfo
+// passwords, API-key query parameters and API keys used as path segments
+// (e.g. Infura's /v3/<key> or Alchemy's /v2/<key>).
+func RedactURL(raw string) string {
+    if raw == "" {
+        return raw
+    }
+    u, err := url.Parse(raw)
+    if err != nil || u.Host == "" {
+        // Not a URL we understand – hide it entirely rather than leak it.
+        return redactedMask
+    }
+
+    if u.User != nil {
+        if _, ok := u.User.Password(); ok {
+            u.User = url.UserPassword(u.User.Username(), redactedMask)
+        }
+    }
+
+    if u.RawQuery != "" {
+        q := u.Query()
+        for k := range q {
+            if secretQueryParams[strings.ToLower(k)] {
+                q.Set(k, redactedMask)
+            }
+        }
+        u.RawQuery = q.Encode()
+    }
+
+    segments := strings.Split(u.Path, "/")
+    for i, seg := range segments {
+        if looksLikeKey(seg) {
+            segments[i] = redactedMask
+        }
+    }
+    u.Path = strings.Join(segments, "/")
+    u.RawPath = ""
+
+    // Keep the mask readable instead of percent-encoded.
+    return strings.ReplaceAll(u.String(), url.QueryEscape(redactedMask), redactedMask)
+}
+
+// RedactDSN masks the password of a go-sql-driver style DSN
+// ("user:pass@tcp(host:3306)/db") or of a URL-style DSN.
+func RedactDSN(dsn string) string {
+    if dsn == "" {
+        return dsn
+    }
+    if strings.Contains(dsn, "://") {
+        return RedactURL(dsn)
+    }
+
+    at := strings.LastIndex(dsn, "@")
+    if at < 0 {
+        return dsn
+    }
+    creds := dsn[:at]
+    if colon := strings.Index(creds, ":"); colon >= 0 {
+        creds = creds[:colon+1] + redactedMask
+    }
+    return creds + dsn[at:]
+}
+
+// looksLikeKey reports whether a URL path segment is likely an API key:
+// long and made only of alphanumerics, dashes or underscores.
+func looksLikeKey(seg string) bool {
+    if len(seg) < 20 {
+        return false
+    }
+    for _, r := range seg {
+        switch {
+        case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+        default:
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// secretScheme prefixes values that must be resolved through a secret
+// backend instead of being used literally, e.g. "secret://aws/prod/mysql-dsn"
+// or "secret://env/MYSQL_DSN". An optional "#field" suffix selects a key of a
+// JSON-encoded secret ("secret://aws/prod/db#dsn").
+const secretScheme = "secret://"
+
+// SecretResolver fetches the plaintext value of a secret identified by the
+// provider-specific id (the part after "secret://<provider>/").
+type SecretResolver interface {
+    Resolve(ctx context.Context, id string) (string, error)
+}
+
+var (
+    resolversMu sync.RWMutex
+    resolvers   = map[string]SecretResolver{
+        "env": EnvSecretResolver{},
+        "aws": &AWSSecretResolver{},
+    }
+)
+
+// RegisterSecretResolver installs (or replaces) the resolver used for
+// "secret://<provider>/..." references. It is typically called from init.
+func RegisterSecretResolver(provider string, r SecretResolver) {
+    resolversMu.Lock()
+    defer resolversMu.Unlock()
+    resolvers[provider] = r
+}
+
+// ResolveSecret returns value unchanged unless it is a secret reference, in
+// which case the matching resolver is queried.
+func ResolveSecret(ctx context.Context, value string) (string, error) {
+    if !strings.HasPrefix(value, secretScheme) {
+        return value, nil
+    }
+
+    ref := strings.TrimPrefix(value, secretScheme)
+    provider, id, ok := strings.Cut(ref, "/")
+    if !ok || provider == "" || id == "" {
+        return "", fmt.Errorf("invalid secret reference %q, expected secret://<provider>/<id>", value)
+    }
+    id, field, _ := strings.Cut(id, "#")
+
+    resolversMu.RLock()
+    r, ok := resolvers[provider]
+    resolversMu.RUnlock()
+    if !ok {
+        return "", fmt.Errorf("unknown secret provider %q", provider)
+    }
+
+    secret, err := r.Resolve(ctx, id)
+    if err != nil {
+        return "", fmt.Errorf("failed to resolve secret %s/%s: %w", provider, id, err)
+    }
+    if field == "" {
+        return secret, nil
+    }
+
+    var fields map[string]interface{}
+    if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+        return "", fmt.Errorf("secret %s/%s is not a JSON object: %w", provider, id, err)
+    }
+    v, ok := fields[field]
+    if !ok {
+        return "", fmt.Errorf("secret %s/%s has no field %q", provider, id, field)
+    }
+    return fmt.Sprint(v), nil
+}
+
+// EnvSecretResolver reads secrets from environment variables
+// ("secret://env/VAR").
+type EnvSecretResolver struct{}
+
+// Resolve returns the value of the environment variable named id.
+func (EnvSecretResolver) Resolve(_ context.Context, id string) (string, error) {
+    v, ok := os.LookupEnv(id)
+    if !ok {
+        return "", fmt.Errorf("environment variable %s is not set", id)
+    }
+    return v, nil
+}
@@ -0,0 +1,44 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// AWSSecretResolver reads secrets from AWS Secrets Manager
+// ("secret://aws/<secret-id-or-arn>"). Credentials and region come from the
+// default AWS chain (env vars, shared config, instance/task role).
+type AWSSecretResolver struct {
+    once   sync.Once
+    client *secretsmanager.Client
+    err    error
+}
+
+// Resolve fetches the current string value of the secret.
+func (r *AWSSecretResolver) Resolve(ctx context.Context, id string) (string, error) {
+    r.once.Do(func() {
+        cfg, err := awsconfig.LoadDefaultConfig(ctx)
+        if err != nil {
+            r.err = fmt.Errorf("failed to load aws config: %w", err)
+            return
+        }
+        r.client = secretsmanager.NewFromConfig(cfg)
+    })
+    if r.err != nil {
+        return "", r.err
+    }
+
+    out, err := r.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+    if err != nil {
+        return "", err
+    }
+    if out.SecretString == nil {
+        return "", fmt.Errorf("secret has no string value")
+    }
+    return *out.SecretString, nil
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecret(t *testing.T) {
+    t.Setenv("ETL_TEST_DSN", "user:pass@tcp(db)/etl")
+    t.Setenv("ETL_TEST_JSON", `{"dsn": "user:pass@tcp(db)/etl", "port": 3306}`)
+    for _, tc := range []struct {
+        value   string
+        want    string
+        wantErr string
+    }{
+        {value: "user:pass@tcp(db)/etl", want: "user:pass@tcp(db)/etl"},
+        {value: "", want: ""},
+        {value: "secret://env/ETL_TEST_DSN", want: "user:pass@tcp(db)/etl"},
+        {value: "secret://env/ETL_TEST_JSON#dsn", want: "user:pass@tcp(db)/etl"},
+        {value: "secret://env/ETL_TEST_JSON#port", want: "3306"},
+        {value: "secret://env/ETL_TEST_JSON#user", wantErr: `has no field "user"`},
+        {value: "secret://env/ETL_TEST_DSN#dsn", wantErr: "is not a JSON object"},
+        {value: "secret://env/ETL_TEST_UNSET", wantErr: "ETL_TEST_UNSET is not set"},
+        {value: "secret://vault/prod/db", wantErr: `unknown secret provider "vault"`},
+        {value: "secret://env", wantErr: "invalid secret reference"},
+        {value: "secret:///ETL_TEST_DSN", wantErr: "invalid secret reference"},
+    } {
+        t.Run(tc.value, func(t *testing.T) {
+            got, err := ResolveSecret(context.Background(), tc.value)
+            if tc.wantErr != "" {
+                if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+                    t.Fatalf("ResolveSecret = %q, %v; want an error containing %q", got, err, tc.wantErr)
+                }
+                return
+            }
+            if err != nil || got != tc.want {
+                t.Fatalf("ResolveSecret = %q, %v; want %q", got, err, tc.want)
+            }
+        })
+    }
+}
+
+// fakeSecretsManager answers GetSecretValue for the secrets it holds, like
+// the AWS Secrets Manager JSON API.
+func fakeSecretsManager(t *testing.T, secrets map[string]string) *httptest.Server {
+    t.Helper()
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+        if r.Header.Get("X-Amz-Target") != "secretsmanager.GetSecretValue" {
+            w.WriteHeader(http.StatusBadRequest)
+            json.NewEncoder(w).Encode(map[string]string{"__type": "UnknownOperationException"})
+            return
+        }
+        var in struct{ SecretId string }
+        json.NewDecoder(r.Body).Decode(&in)
+        secret, ok := secrets[in.SecretId]
+        if !ok {
+            w.WriteHeader(http.StatusBadRequest)
+            json.NewEncoder(w).Encode(map[string]string{
+                "__type":  "ResourceNotFoundException",
+                "message": "Secrets Manager can't find the specified secret.",
+            })
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"Name": in.SecretId, "SecretString": secret})
+    }))
+    t.Cleanup(srv.Close)
+    return srv
+}
+
+func TestAWSSecretResolver(t *testing.T) {
+    srv := fakeSecretsManager(t, map[string]string{"prod/db": `{"dsn": "user:pass@tcp(db)/etl"}`})
+    // Static credentials and the fake endpoint; no shared config or IMDS.
+    dir := t.TempDir()
+    t.Setenv("AWS_ENDPOINT_URL", srv.URL)
+    t.Setenv("AWS_REGION", "us-east-1")
+    t.Setenv("AWS_ACCESS_KEY_ID", "test")
+    t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+    t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+    t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+    t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+    r := &AWSSecretResolver{}
+    got, err := r.Resolve(context.Background(), "prod/db")
+    if err != nil || got != `{"dsn": "user:pass@tcp(db)/etl"}` {
+        t.Fatalf("Resolve = %q, %v", got, err)
+    }
+    if _, err := r.Resolve(context.Background(), "prod/missing"); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+        t.Fatalf("Resolve of a missing secret = %v, want ResourceNotFoundException", err)
+    }
+
+    // Through ResolveSecret, with a field of the JSON secret.
+    RegisterSecretResolver("aws", r)
+    t.Cleanup(func() { RegisterSecretResolver("aws", &AWSSecretResolver{}) })
+    if got, err := ResolveSecret(context.Background(), "secret://aws/prod/db#dsn"); err != nil || got != "user:pass@tcp(db)/etl" {
+        t.Fatalf("ResolveSecret = %q, %v", got, err)
+    }
+}
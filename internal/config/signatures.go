@@ -0,0 +1,48 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// LoadSignatureDB reads a signature database: a JSON object mapping topic0
+// to the canonical event signature, e.g.
+//
+//	{"0xddf252ad…": "Transfer(address,address,uint256)"}
+//
+// as exported from 4byte.directory. Every entry must hash to its key.
+func LoadSignatureDB(path string) (map[common.Hash]string, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read signature_db: %w", err)
+    }
+    var raw map[string]string
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return nil, fmt.Errorf("failed to parse signature_db %s: %w", path, err)
+    }
+
+    db := make(map[common.Hash]string, len(raw))
+    for key, sig := range raw {
+        b, err := hexutil.Decode(key)
+        if err != nil || len(b) != common.HashLength {
+            return nil, fmt.Errorf("signature_db %s: invalid topic0 %q", path, key)
+        }
+        sig = strings.TrimSpace(sig)
+        open := strings.IndexByte(sig, '(')
+        if open <= 0 || !strings.HasSuffix(sig, ")") {
+            return nil, fmt.Errorf("signature_db %s: invalid signature %q", path, sig)
+        }
+        topic0 := common.BytesToHash(b)
+        if crypto.Keccak256Hash([]byte(sig)) != topic0 {
+            return nil, fmt.Errorf("signature_db %s: %q does not hash to %s", path, sig, key)
+        }
+        db[topic0] = sig
+    }
+    return db, nil
+}
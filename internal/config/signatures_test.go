@@ -0,0 +1,43 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// writeSignatureDB writes content to a signature database file and returns
+// its path.
+func writeSignatureDB(t *testing.T, content string) string {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), "signatures.json")
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return path
+}
+
+func TestLoadSignatureDB(t *testing.T) {
+    transfer := crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+    db, err := LoadSignatureDB(writeSignatureDB(t, `{"`+transfer.Hex()+`": " Transfer(address,address,uint256) "}`))
+    if err != nil {
+        t.Fatalf("LoadSignatureDB: %v", err)
+    }
+    if db[transfer] != "Transfer(address,address,uint256)" {
+        t.Fatalf("db = %v", db)
+    }
+
+    for name, tc := range map[string]struct{ content, want string }{
+        "wrong hash":    {`{"` + transfer.Hex() + `": "Approval(address,address,uint256)"}`, "does not hash to"},
+        "short topic0":  {`{"0xddf252ad": "Transfer(address,address,uint256)"}`, "invalid topic0"},
+        "no parameters": {`{"` + transfer.Hex() + `": "Transfer"}`, "invalid signature"},
+        "not an object": {`["Transfer(address,address,uint256)"]`, "failed to parse"},
+    } {
+        if _, err := LoadSignatureDB(writeSignatureDB(t, tc.content)); err == nil || !strings.Contains(err.Error(), tc.want) {
+            t.Errorf("%s: LoadSignatureDB = %v, want %q", name, err, tc.want)
+        }
+    }
+}
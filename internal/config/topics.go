@@ -0,0 +1,138 @@
+package config
+
+import (
+	"fmt"
+	"math/big"
+	"sort"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// EventTopicFilter converts the topics entry of one event into the topic
+// positions that follow topic0 in an eth_getLogs filter: position i holds the
+// accepted values (OR) of the i-th indexed parameter, nil meaning any value.
+// Positions are ANDed. It returns nil when the event has no topic filter and
+// requires the contract ABI to be parsed.
+func EventTopicFilter(c ContractConfig, event string) ([][]common.Hash, error) {
+    args := c.Topics[event]
+    if len(args) == 0 {
+        return nil, nil
+    }
+    if c.ParsedABI == nil {
+        return nil, fmt.Errorf("contract '%s': abi not loaded", c.Name)
+    }
+    ev, ok := LookupEvent(c.ParsedABI, event)
+    if !ok {
+        return nil, fmt.Errorf("contract '%s' topics.%s: event not found in ABI", c.Name, event)
+    }
+
+    var indexed abi.Arguments
+    for _, in := range ev.Inputs {
+        if in.Indexed {
+            indexed = append(indexed, in)
+        }
+    }
+
+    positions := make([][]common.Hash, len(indexed))
+    last, used := -1, 0
+    for i, in := range indexed {
+        values, ok := args[in.Name]
+        if !ok {
+            continue
+        }
+        used++
+        if len(values) == 0 {
+            return nil, fmt.Errorf("contract '%s' topics.%s.%s: at least one value is required", c.Name, event, in.Name)
+        }
+        for _, v := range values {
+            h, err := topicValue(in.Type, v)
+            if err != nil {
+                return nil, fmt.Errorf("contract '%s' topics.%s.%s: %w", c.Name, event, in.Name, err)
+            }
+            positions[i] = append(positions[i], h)
+        }
+        last = i
+    }
+    if used != len(args) {
+        var unknown []string
+        for name := range args {
+            if !hasArg(indexed, name) {
+                unknown = append(unknown, name)
+            }
+        }
+        sort.Strings(unknown)
+        return nil, fmt.Errorf("contract '%s' topics.%s: unknown or non-indexed parameters %v", c.Name, event, unknown)
+    }
+    // Trailing wildcards are implied.
+    return positions[:last+1], nil
+}
+
+func hasArg(args abi.Arguments, name string) bool {
+    for _, in := range args {
+        if in.Name == name {
+            return true
+        }
+    }
+    return false
+}
+
+// topicValue encodes one configured value of an indexed parameter the way it
+// appears in the log topics. Dynamic types (string, bytes) are indexed by
+// their keccak256 hash.
+func topicValue(t abi.Type, v string) (common.Hash, error) {
+    switch t.T {
+    case abi.AddressTy:
+        if !common.IsHexAddress(v) {
+            return common.Hash{}, fmt.Errorf("invalid address %q", v)
+        }
+        return common.BytesToHash(common.HexToAddress(v).Bytes()), nil
+    case abi.UintTy, abi.IntTy:
+        n, ok := new(big.Int).SetString(v, 0)
+        if !ok {
+            return common.Hash{}, fmt.Errorf("invalid integer %q", v)
+        }
+        if t.T == abi.UintTy && (n.Sign() < 0 || n.BitLen() > t.Size) {
+            return common.Hash{}, fmt.Errorf("%s out of range for %s", v, t)
+        }
+        if t.T == abi.IntTy {
+            limit := new(big.Int).Lsh(big.NewInt(1), uint(t.Size-1))
+            if n.Cmp(limit) >= 0 || n.Cmp(new(big.Int).Neg(limit)) < 0 {
+                return common.Hash{}, fmt.Errorf("%s out of range for %s", v, t)
+            }
+        }
+        // Negative values are sign-extended to 256 bits (two's complement).
+        return common.BigToHash(math.U256(n)), nil
+    case abi.BoolTy:
+        b, err := strconv.ParseBool(v)
+        if err != nil {
+            return common.Hash{}, fmt.Errorf("invalid bool %q", v)
+        }
+        if b {
+            return common.BigToHash(big.NewInt(1)), nil
+        }
+        return common.Hash{}, nil
+    case abi.FixedBytesTy:
+        b, err := hexutil.Decode(v)
+        if err != nil || len(b) != t.Size {
+            return common.Hash{}, fmt.Errorf("invalid %s %q", t, v)
+        }
+        var h common.Hash
+        copy(h[:], b) // bytesN is left-aligned
+        return h, nil
+    case abi.StringTy:
+        return crypto.Keccak256Hash([]byte(v)), nil
+    case abi.BytesTy:
+        b, err := hexutil.Decode(v)
+        if err != nil {
+            return common.Hash{}, fmt.Errorf("invalid bytes %q", v)
+        }
+        return crypto.Keccak256Hash(b), nil
+    default:
+        return common.Hash{}, fmt.Errorf("filtering on %s parameters is not supported", t)
+    }
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// topicsABI declares events with indexed parameters of several types.
+const topicsABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"from","type":"address"},
+    {"indexed":true,"name":"to","type":"address"},
+    {"indexed":false,"name":"value","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"Tagged","inputs":[
+    {"indexed":true,"name":"sel","type":"bytes4"},
+    {"indexed":true,"name":"delta","type":"int8"},
+    {"indexed":true,"name":"flag","type":"bool"}]},
+{"anonymous":false,"type":"event","name":"Named","inputs":[
+    {"indexed":true,"name":"name","type":"string"},
+    {"indexed":true,"name":"data","type":"bytes"}]}]`
+
+func topicsContract(t *testing.T, event string, args map[string][]string) ContractConfig {
+    t.Helper()
+    a, err := abi.JSON(strings.NewReader(topicsABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return ContractConfig{Name: "Token", ParsedABI: &a, Topics: map[string]map[string][]string{event: args}}
+}
+
+func TestEventTopicFilterPositions(t *testing.T) {
+    const a1, a2 = "0x00000000000000000000000000000000000000a1", "0x00000000000000000000000000000000000000a2"
+    addr := func(s string) common.Hash { return common.BytesToHash(common.HexToAddress(s).Bytes()) }
+
+    // Values of one position are ORed; an unset leading position is a
+    // wildcard and trailing ones are left out.
+    got, err := EventTopicFilter(topicsContract(t, "Transfer", map[string][]string{"to": {a1, a2}}), "Transfer")
+    if err != nil {
+        t.Fatalf("EventTopicFilter: %v", err)
+    }
+    if len(got) != 2 || got[0] != nil || len(got[1]) != 2 || got[1][0] != addr(a1) || got[1][1] != addr(a2) {
+        t.Errorf("to filter = %v, want [nil [a1 a2]]", got)
+    }
+    got, _ = EventTopicFilter(topicsContract(t, "Transfer", map[string][]string{"from": {a1}}), "Transfer")
+    if len(got) != 1 || len(got[0]) != 1 || got[0][0] != addr(a1) {
+        t.Errorf("from filter = %v, want [[a1]]", got)
+    }
+    if got, err := EventTopicFilter(topicsContract(t, "Transfer", nil), "Transfer"); got != nil || err != nil {
+        t.Errorf("no filter = %v, %v", got, err)
+    }
+
+    got, err = EventTopicFilter(topicsContract(t, "Tagged", map[string][]string{"sel": {"0xa9059cbb"}, "delta": {"-1", "2"}, "flag": {"true"}}), "Tagged")
+    if err != nil {
+        t.Fatalf("EventTopicFilter: %v", err)
+    }
+    want := [][]common.Hash{
+        {common.HexToHash("0xa9059cbb00000000000000000000000000000000000000000000000000000000")},
+        {common.HexToHash("0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"), common.HexToHash("0x02")},
+        {common.HexToHash("0x01")},
+    }
+    if len(got) != len(want) {
+        t.Fatalf("Tagged filter = %v, want %v", got, want)
+    }
+    for i := range want {
+        if len(got[i]) != len(want[i]) {
+            t.Fatalf("Tagged position %d = %v, want %v", i, got[i], want[i])
+        }
+        for j := range want[i] {
+            if got[i][j] != want[i][j] {
+                t.Errorf("Tagged position %d value %d = %s, want %s", i, j, got[i][j], want[i][j])
+            }
+        }
+    }
+
+    // Dynamic types are matched by their keccak256 hash.
+    got, err = EventTopicFilter(topicsContract(t, "Named", map[string][]string{"name": {"alice"}, "data": {"0x0102"}}), "Named")
+    if err != nil {
+        t.Fatalf("EventTopicFilter: %v", err)
+    }
+    if got[0][0] != crypto.Keccak256Hash([]byte("alice")) || got[1][0] != crypto.Keccak256Hash([]byte{1, 2}) {
+        t.Errorf("Named filter = %v", got)
+    }
+}
+
+func TestEventTopicFilterErrors(t *testing.T) {
+    cases := []struct {
+        name    string
+        event   string
+        args    map[string][]string
+        wantErr string
+    }{
+        {name: "unknown event", event: "Approval", args: map[string][]string{"owner": {"0x01"}}, wantErr: "topics.Approval: event not found in ABI"},
+        {name: "unknown parameter", event: "Transfer", args: map[string][]string{"spender": {"0x01"}}, wantErr: "unknown or non-indexed parameters [spender]"},
+        {name: "non-indexed parameter", event: "Transfer", args: map[string][]string{"value": {"1"}}, wantErr: "unknown or non-indexed parameters [value]"},
+        {name: "no values", event: "Transfer", args: map[string][]string{"to": {}}, wantErr: "topics.Transfer.to: at least one value is required"},
+        {name: "bad address", event: "Transfer", args: map[string][]string{"to": {"0x12"}}, wantErr: `topics.Transfer.to: invalid address "0x12"`},
+        {name: "int out of range", event: "Tagged", args: map[string][]string{"delta": {"128"}}, wantErr: "128 out of range for int8"},
+        {name: "int below range", event: "Tagged", args: map[string][]string{"delta": {"-129"}}, wantErr: "-129 out of range for int8"},
+        {name: "not an integer", event: "Tagged", args: map[string][]string{"delta": {"ten"}}, wantErr: `invalid integer "ten"`},
+        {name: "bad bool", event: "Tagged", args: map[string][]string{"flag": {"yes"}}, wantErr: `invalid bool "yes"`},
+        {name: "short bytes4", event: "Tagged", args: map[string][]string{"sel": {"0xa905"}}, wantErr: `invalid bytes4 "0xa905"`},
+        {name: "bad bytes", event: "Named", args: map[string][]string{"data": {"zz"}}, wantErr: `invalid bytes "zz"`},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            _, err := EventTopicFilter(topicsContract(t, tc.event, tc.args), tc.event)
+            if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+                t.Fatalf("EventTopicFilter = %v, want %q", err, tc.wantErr)
+            }
+        })
+    }
+
+    c := topicsContract(t, "Transfer", map[string][]string{"to": {"0x01"}})
+    c.ParsedABI = nil
+    if _, err := EventTopicFilter(c, "Transfer"); err == nil || !strings.Contains(err.Error(), "abi not loaded") {
+        t.Errorf("EventTopicFilter without ABI = %v", err)
+    }
+}
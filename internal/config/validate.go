@@ -0,0 +1,324 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ValidationError lists every problem found in a configuration so they can be
+// fixed in one go instead of one per run.
+type ValidationError struct {
+    Problems []string
+}
+
+func (e *ValidationError) Error() string {
+    return "invalid config:\n  - " + strings.Join(e.Problems, "\n  - ")
+}
+
+// Validate checks the structure of the configuration without touching the
+// disk or the network. It returns a *ValidationError listing all problems.
+func (c *Config) Validate() error {
+    var problems []string
+    add := func(format string, args ...interface{}) {
+        problems = append(problems, fmt.Sprintf(format, args...))
+    }
+
+    if c.RPCURL == "" && len(c.Chains) == 0 {
+        add("rpc_url is required")
+    }
+    if err := ValidateStorage(c.Storage); err != nil {
+        add("%v", err)
+    }
+    if err := ValidateOnError(c.OnError); err != nil {
+        add("%v", err)
+    }
+    if err := ValidateNoCodeLogs(c.NoCodeLogs); err != nil {
+        add("%v", err)
+    }
+    if c.StrictEvents && c.LenientEvents {
+        add("strict_events and lenient_events are mutually exclusive")
+    }
+    for i, t := range c.Transforms {
+        if err := ValidateTransform(t); err != nil {
+            add("transforms[%d]: %v", i, err)
+        }
+    }
+    if err := ValidateExcludeAddresses(c.ExcludeAddresses); err != nil {
+        add("%v", err)
+    }
+    if err := ValidateRPCTransport(c.RPCTransport); err != nil {
+        add("%v", err)
+    }
+    if err := ValidateRPCWSURL(c.RPCWSURL); err != nil {
+        add("%v", err)
+    }
+    if err := ValidateEndBlock(c.StartBlock, c.EndBlock, c.Follow); err != nil {
+        add("%v", err)
+    }
+    if c.TipPollIntervalMS < 0 {
+        add("tip_poll_interval_ms must not be negative, got %d", c.TipPollIntervalMS)
+    }
+    if err := ValidateWorkers(c.Workers, c.EnrichWorkers, c.QueueDepth); err != nil {
+        add("%v", err)
+    }
+    if c.Retry.Attempts < 0 {
+        add("retry.attempts must not be negative, got %d", c.Retry.Attempts)
+    }
+    if c.Retry.DelayMS < 0 {
+        add("retry.delay_ms must not be negative, got %d", c.Retry.DelayMS)
+    }
+
+    if len(c.Chains) == 0 {
+        for _, p := range contractProblems(c.Contracts) {
+            add("%s", p)
+        }
+    }
+    seen := make(map[string]bool, len(c.Chains))
+    for i, ch := range c.Chains {
+        label := ch.Name
+        if ch.Name == "" {
+            add("chains[%d]: name is required", i)
+            label = fmt.Sprintf("chains[%d]", i)
+        } else if !chainNameRe.MatchString(ch.Name) {
+            add("chains[%d]: invalid name %q (letters, digits, '.', '_' and '-', starting with a letter or digit)", i, ch.Name)
+        } else if seen[ch.Name] {
+            add("duplicate chain name '%s'", ch.Name)
+        }
+        seen[ch.Name] = true
+        if ch.RPCURL == "" {
+            add("chain '%s': rpc_url is required", label)
+        }
+        if err := ValidateRPCWSURL(ch.RPCWSURL); err != nil {
+            add("chain '%s': %v", label, err)
+        }
+        for _, p := range contractProblems(ch.Contracts) {
+            add("chain '%s': %s", label, p)
+        }
+    }
+
+    if len(problems) > 0 {
+        return &ValidationError{Problems: problems}
+    }
+    return nil
+}
+
+// chainNameRe matches chain names. They become directory names and file
+// name suffixes, so path separators and "." or ".." are excluded.
+var chainNameRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateWorkers rejects negative worker counts and queue depths; zero
+// selects the defaults applied by NormalizeWorkers.
+func ValidateWorkers(workers, enrichWorkers, queueDepth int) error {
+    if workers < 0 {
+        return fmt.Errorf("workers must not be negative, got %d", workers)
+    }
+    if enrichWorkers < 0 {
+        return fmt.Errorf("enrich_workers must not be negative, got %d", enrichWorkers)
+    }
+    if queueDepth < 0 {
+        return fmt.Errorf("queue_depth must not be negative, got %d", queueDepth)
+    }
+    return nil
+}
+
+// ValidateExcludeAddresses checks that every exclude_addresses entry is a hex
+// address.
+func ValidateExcludeAddresses(addrs []string) error {
+    for i, a := range addrs {
+        if !common.IsHexAddress(a) {
+            return fmt.Errorf("exclude_addresses[%d]: invalid address %q", i, a)
+        }
+    }
+    return nil
+}
+
+// contractProblems describes everything wrong with a contracts list.
+func contractProblems(contracts []ContractConfig) []string {
+    if len(contracts) == 0 {
+        return []string{"at least one contract must be defined"}
+    }
+
+    var problems []string
+    for i, c := range contracts {
+        label := c.Name
+        if c.Name == "" {
+            problems = append(problems, fmt.Sprintf("contracts[%d]: name is required", i))
+            label = fmt.Sprintf("contracts[%d]", i)
+        }
+        if c.Address == "" && len(c.Addresses) == 0 && len(c.Events) == 0 {
+            problems = append(problems, fmt.Sprintf("contract '%s': address is required (an address-less entry must list events)", label))
+        } else if err := ValidateContractAddresses(c); err != nil {
+            problems = append(problems, fmt.Sprintf("contract '%s': %v", label, err))
+        }
+        if len(c.ABI) == 0 {
+            problems = append(problems, fmt.Sprintf("contract '%s': abi path is required", label))
+        }
+        for event, s := range c.Sample {
+            if err := ValidateSample(s); err != nil {
+                problems = append(problems, fmt.Sprintf("contract '%s': sample.%s: %v", label, event, err))
+            }
+        }
+        for event, r := range c.ExpectedRate {
+            if err := ValidateExpectedRate(r); err != nil {
+                problems = append(problems, fmt.Sprintf("contract '%s': expected_rate.%s: %v", label, event, err))
+            }
+        }
+        if c.Decoder != "" && !IsDecoder(c.Decoder) {
+            problems = append(problems, fmt.Sprintf("contract '%s': unknown decoder %q", label, c.Decoder))
+        }
+        for event := range c.Topics {
+            if !slices.Contains(c.Events, event) {
+                problems = append(problems, fmt.Sprintf("contract '%s': topics.%s: event is not listed in events", label, event))
+            }
+        }
+    }
+    return problems
+}
+
+// ValidateContractAddresses checks the address or addresses of a contract
+// entry. A list or wildcard in address is rejected with a hint, as it would
+// otherwise be read as one unrelated address.
+func ValidateContractAddresses(c ContractConfig) error {
+    if c.Address != "" && len(c.Addresses) > 0 {
+        return fmt.Errorf("set either address or addresses, not both")
+    }
+    if c.Address != "" {
+        return validateContractAddress("address", c.Address)
+    }
+    seen := make(map[common.Address]bool, len(c.Addresses))
+    for i, a := range c.Addresses {
+        field := fmt.Sprintf("addresses[%d]", i)
+        if err := validateContractAddress(field, a); err != nil {
+            return err
+        }
+        addr := common.HexToAddress(a)
+        if seen[addr] {
+            return fmt.Errorf("%s: duplicate address %s", field, a)
+        }
+        seen[addr] = true
+    }
+    return nil
+}
+
+func validateContractAddress(field, a string) error {
+    if common.IsHexAddress(a) {
+        return nil
+    }
+    if strings.ContainsAny(a, ",; *") {
+        return fmt.Errorf("%s: invalid address %q (list several contracts under addresses)", field, a)
+    }
+    return fmt.Errorf("%s: invalid address %q", field, a)
+}
+
+// ExpandAddresses returns contracts with every entry listing addresses
+// replaced by one entry per address, otherwise identical.
+func ExpandAddresses(contracts []ContractConfig) []ContractConfig {
+    out := make([]ContractConfig, 0, len(contracts))
+    for _, c := range contracts {
+        if len(c.Addresses) == 0 {
+            out = append(out, c)
+            continue
+        }
+        for _, a := range c.Addresses {
+            e := c
+            e.Address, e.Addresses = a, nil
+            out = append(out, e)
+        }
+    }
+    return out
+}
+
+// ValidateSample checks that exactly one of every and per is set.
+func ValidateSample(s Sample) error {
+    if s.Every < 0 {
+        return fmt.Errorf("every must not be negative, got %d", s.Every)
+    }
+    if (s.Every > 0) == (s.Per != "") {
+        return fmt.Errorf("exactly one of every and per must be set")
+    }
+    _, err := s.Bucket()
+    return err
+}
+
+// ValidateExpectedRate rejects negative event counts and tolerances.
+func ValidateExpectedRate(r ExpectedRate) error {
+    if r.Events < 0 {
+        return fmt.Errorf("events must not be negative, got %g", r.Events)
+    }
+    if r.Tolerance < 0 {
+        return fmt.Errorf("tolerance must not be negative, got %g", r.Tolerance)
+    }
+    return nil
+}
+
+// FileNamePlaceholders are the values available to file name templates.
+var FileNamePlaceholders = map[string]bool{
+    "contract": true, // contract name
+    "event":    true, // event name
+    "address":  true, // contract address
+    "chain":    true, // chain label (multi-chain configs)
+    "chain_id": true,
+}
+
+var placeholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// ValidateFileNameTemplate checks that a template only uses known
+// placeholders and stays inside the output directory. Empty selects the
+// default layout.
+func ValidateFileNameTemplate(tmpl string) error {
+    if tmpl == "" {
+        return nil
+    }
+    for _, m := range placeholderRe.FindAllStringSubmatch(tmpl, -1) {
+        if !FileNamePlaceholders[m[1]] {
+            return fmt.Errorf("unknown placeholder {%s}", m[1])
+        }
+    }
+    static := placeholderRe.ReplaceAllString(tmpl, "x")
+    if filepath.IsAbs(static) || strings.HasPrefix(static, "/") {
+        return fmt.Errorf("must be a relative path, got %q", tmpl)
+    }
+    for _, seg := range strings.FieldsFunc(static, func(r rune) bool { return r == '/' || r == '\\' }) {
+        if seg == ".." {
+            return fmt.Errorf("must not contain '..', got %q", tmpl)
+        }
+    }
+    if strings.HasSuffix(static, "/") {
+        return fmt.Errorf("must name a file, got %q", tmpl)
+    }
+    return nil
+}
+
+// Built-in transform types of TransformConfig.Type.
+const (
+    TransformRename = "rename"
+    TransformSet    = "set"
+    TransformConcat = "concat"
+    TransformDrop   = "drop"
+)
+
+// ValidateTransform checks that a transform has the fields its type needs.
+func ValidateTransform(t TransformConfig) error {
+    switch t.Type {
+    case TransformRename:
+        if t.From == "" || t.To == "" {
+            return fmt.Errorf("rename requires from and to")
+        }
+    case TransformSet, TransformDrop:
+        if t.Field == "" {
+            return fmt.Errorf("%s requires field", t.Type)
+        }
+    case TransformConcat:
+        if t.Field == "" || len(t.Fields) == 0 {
+            return fmt.Errorf("concat requires field and fields")
+        }
+    default:
+        return fmt.Errorf("unknown transform type %q (expected rename, set, concat or drop)", t.Type)
+    }
+    return nil
+}
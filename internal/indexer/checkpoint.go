@@ -0,0 +1,314 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// checkpointInterval bounds how often the checkpoint file is rewritten while
+// ranges complete; the final position is always written when Run stops.
+const checkpointInterval = time.Second
+
+// checkpointHistory is how many earlier checkpointed blocks the file keeps
+// to find the common ancestor after a reorg.
+const checkpointHistory = 32
+
+// Checkpoint is the content of the checkpoint file.
+type Checkpoint struct {
+    Chain string `json:"chain,omitempty"`
+    Block uint64 `json:"block"` // every block up to this one is indexed
+    // Hash is the hash Block had when it was checkpointed; a resume checks
+    // it against the chain to detect reorgs that happened in between.
+    Hash string `json:"hash,omitempty"`
+    // Recent lists earlier checkpoints, newest first.
+    Recent    []CheckpointBlock `json:"recent,omitempty"`
+    // Completed lists the ranges past Block that already completed (workers
+    // finish out of order); the next run skips them.
+    Completed []BlockRange      `json:"completed,omitempty"`
+    UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// CheckpointBlock is a checkpointed block number with its hash.
+type CheckpointBlock struct {
+    Block uint64 `json:"block"`
+    Hash  string `json:"hash"`
+}
+
+// blocks returns the checkpointed blocks with a hash, newest first.
+func (cp *Checkpoint) blocks() []CheckpointBlock {
+    var out []CheckpointBlock
+    if cp.Hash != "" {
+        out = append(out, CheckpointBlock{Block: cp.Block, Hash: cp.Hash})
+    }
+    return append(out, cp.Recent...)
+}
+
+// hashFunc returns the current hash of a block.
+type hashFunc func(ctx context.Context, block uint64) (common.Hash, error)
+
+// checkpointWriter persists the progress checkpoint of a run to
+// cfg.CheckpointFile. A nil writer does nothing.
+type checkpointWriter struct {
+    path  string
+    chain string
+
+    mu               sync.Mutex
+    written          uint64
+    writtenCompleted int
+    hasBlock         bool
+    lastWrite        time.Time
+    recent           []CheckpointBlock // newest first
+    // hashes holds the hash of the last block of each indexed range not
+    // yet covered by a written checkpoint.
+    hashes map[uint64]common.Hash
+}
+
+func newCheckpointWriter(path, chain string) *checkpointWriter {
+    if path == "" {
+        return nil
+    }
+    return &checkpointWriter{path: path, chain: chain, hashes: make(map[uint64]common.Hash)}
+}
+
+// readCheckpoint returns the checkpoint recorded in path, or nil when the
+// file does not exist yet.
+func readCheckpoint(path string) (*Checkpoint, error) {
+    data, err := os.ReadFile(path)
+    if errors.Is(err, os.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read checkpoint %s: %w", path, err)
+    }
+    var cp Checkpoint
+    if err := json.Unmarshal(data, &cp); err != nil {
+        return nil, fmt.Errorf("failed to parse checkpoint %s: %w", path, err)
+    }
+    return &cp, nil
+}
+
+// seed makes the writer keep the given checkpointed blocks (newest first) as
+// history, so it survives across runs.
+func (w *checkpointWriter) seed(blocks []CheckpointBlock) {
+    if w == nil {
+        return
+    }
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if len(blocks) > checkpointHistory {
+        blocks = blocks[:checkpointHistory]
+    }
+    w.recent = append([]CheckpointBlock(nil), blocks...)
+}
+
+// rangeHash records the hash block had when the range ending at it was
+// indexed, to be written with the checkpoint once it reaches block.
+func (w *checkpointWriter) rangeHash(block uint64, hash common.Hash) {
+    if w == nil {
+        return
+    }
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    w.hashes[block] = hash
+}
+
+// due reports whether update would write the file for these arguments.
+func (w *checkpointWriter) due(block uint64, completed []BlockRange, force bool) bool {
+    if w == nil {
+        return false
+    }
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    return w.dueLocked(block, completed, force)
+}
+
+func (w *checkpointWriter) dueLocked(block uint64, completed []BlockRange, force bool) bool {
+    // Completed ranges only grow until the checkpoint absorbs them.
+    if w.hasBlock && block == w.written && len(completed) == w.writtenCompleted {
+        return false
+    }
+    return force || time.Since(w.lastWrite) >= checkpointInterval
+}
+
+// update records block as the checkpoint, with the ranges completed past
+// it, writing the file at most once per checkpointInterval unless force is
+// set.
+func (w *checkpointWriter) update(block uint64, completed []BlockRange, force bool) {
+    if w == nil {
+        return
+    }
+    w.mu.Lock()
+    defer w.mu.Unlock()
+    if !w.dueLocked(block, completed, force) {
+        return
+    }
+
+    // Keep only history before block, e.g. when it is rewritten on resume.
+    for len(w.recent) > 0 && w.recent[0].Block >= block {
+        w.recent = w.recent[1:]
+    }
+    cp := Checkpoint{Chain: w.chain, Block: block, Recent: w.recent, Completed: completed, UpdatedAt: time.Now()}
+    // Ranges skipped as completed by a previous run have no hash.
+    if hash, ok := w.hashes[block]; ok {
+        cp.Hash = hash.Hex()
+    }
+    data, err := json.MarshalIndent(cp, "", "  ")
+    if err != nil {
+        logrus.Warnf("failed to encode checkpoint: %v", err)
+        return
+    }
+    tmp := w.path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o644); err != nil {
+        logrus.Warnf("failed to write checkpoint: %v", err)
+        return
+    }
+    if err := os.Rename(tmp, w.path); err != nil {
+        logrus.Warnf("failed to write checkpoint: %v", err)
+        return
+    }
+    w.written, w.writtenCompleted, w.hasBlock, w.lastWrite = block, len(completed), true, time.Now()
+    for b := range w.hashes {
+        if b <= block {
+            delete(w.hashes, b)
+        }
+    }
+    if cp.Hash != "" {
+        w.recent = append([]CheckpointBlock{{Block: block, Hash: cp.Hash}}, w.recent...)
+        if len(w.recent) > checkpointHistory {
+            w.recent = w.recent[:checkpointHistory]
+        }
+    }
+}
+
+// verifyCheckpoint checks the hashes recorded in cp against the chain and
+// returns the block to resume after: cp.Block when its hash still matches
+// (or none was recorded), otherwise the newest recorded block that is still
+// canonical, i.e. the common ancestor of the reorged chain. It fails when no
+// recorded block matches any more.
+func verifyCheckpoint(ctx context.Context, cp *Checkpoint, hashOf hashFunc) (uint64, error) {
+    blocks := cp.blocks()
+    if cp.Hash == "" || hashOf == nil {
+        return cp.Block, nil
+    }
+    for i, b := range blocks {
+        hash, err := hashOf(ctx, b.Block)
+        if err != nil {
+            return 0, fmt.Errorf("failed to verify checkpoint block %d: %w", b.Block, err)
+        }
+        if hash == common.HexToHash(b.Hash) {
+            if i > 0 {
+                logrus.Warnf("Checkpoint block %d was reorged since the last run; rewinding to common ancestor %d", cp.Block, b.Block)
+            }
+            return b.Block, nil
+        }
+    }
+    return 0, fmt.Errorf("checkpoint block %d was reorged and none of the %d recorded blocks is still canonical; remove the checkpoint file and re-index from an earlier start_block", cp.Block, len(blocks))
+}
+
+// loadCheckpoint returns the checkpoint of a previous run, from the
+// transactional sink when there is one and from the checkpoint file
+// otherwise, where recorded block hashes are verified against the chain.
+// completed lists the ranges past it the file records as done.
+func (idx *Indexer) loadCheckpoint(ctx context.Context) (block uint64, ok bool, completed []BlockRange, err error) {
+    if idx.txSink != nil {
+        block, ok, err := idx.txSink.Checkpoint()
+        if err != nil {
+            return 0, false, nil, fmt.Errorf("failed to read checkpoint from sink: %w", err)
+        }
+        return block, ok, nil, nil
+    }
+    cp, err := readCheckpoint(idx.cfg.CheckpointFile)
+    if err != nil || cp == nil {
+        return 0, false, nil, err
+    }
+    block, err = verifyCheckpoint(ctx, cp, idx.blockHash)
+    if err != nil {
+        return 0, false, nil, err
+    }
+    // After a reorg rewind the ranges past the old checkpoint are stale.
+    if block == cp.Block {
+        completed = cp.Completed
+    }
+    // Recorded blocks past the resume point are no longer canonical.
+    var kept []CheckpointBlock
+    for _, b := range cp.blocks() {
+        if b.Block <= block {
+            kept = append(kept, b)
+        }
+    }
+    idx.checkpoints.seed(kept)
+    return block, true, completed, nil
+}
+
+// rangeEndHash returns the hash of to, the last block of an indexed range,
+// taken from its logs when it has any and from its header otherwise.
+func (idx *Indexer) rangeEndHash(ctx context.Context, to uint64, logs []types.Log) (common.Hash, error) {
+    for i := len(logs) - 1; i >= 0; i-- {
+        if logs[i].BlockNumber == to && !logs[i].Removed {
+            return logs[i].BlockHash, nil
+        }
+    }
+    return idx.blockHash(ctx, to)
+}
+
+// blockHash returns the current hash of block on the chain.
+func (idx *Indexer) blockHash(ctx context.Context, block uint64) (common.Hash, error) {
+    header, err := idx.client.GetHeaderByNumber(ctx, new(big.Int).SetUint64(block))
+    if err != nil {
+        return common.Hash{}, err
+    }
+    return header.Hash(), nil
+}
+
+// writeRangeTx writes the logs of [from, to] through one transaction of the
+// transactional sink, together with the checkpoint if completing the range
+// advances it. A failure rolls the whole range back, so it can be retried
+// without duplicates. Writes bypass the retry and dead-letter decorators:
+// the range as a whole fails instead.
+func (idx *Indexer) writeRangeTx(ctx context.Context, from, to uint64, logs []types.Log) (int, error) {
+    tx, err := idx.txSink.Begin()
+    if err != nil {
+        return 0, fmt.Errorf("failed to begin sink transaction: %w", err)
+    }
+
+    eventsWritten, err := idx.writeRange(ctx, tx, from, to, logs)
+    if err == nil {
+        if block, ok := idx.progress.checkpointWith(from, to); ok {
+            err = tx.SetCheckpoint(block)
+        }
+    }
+    if err != nil {
+        if rerr := tx.Rollback(); rerr != nil {
+            logrus.Warnf("failed to roll back sink transaction: %v", rerr)
+        }
+        return 0, err
+    }
+    if err := tx.Commit(); err != nil {
+        return 0, fmt.Errorf("failed to commit sink transaction: %w", err)
+    }
+    return eventsWritten, nil
+}
+
+// commitCheckpoint stores block as checkpoint of the transactional sink in a
+// transaction of its own.
+func (idx *Indexer) commitCheckpoint(block uint64) error {
+    tx, err := idx.txSink.Begin()
+    if err != nil {
+        return err
+    }
+    if err := tx.SetCheckpoint(block); err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
@@ -0,0 +1,258 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+
+	"etl-web3/internal/sink"
+)
+
+func TestCheckpointRecordsHashOfIndexedBlock(t *testing.T) {
+    node := newFakeNode(t, 25, transferLog(3, 0, 1), transferLog(25, 0, 2))
+    // The chain reorgs right after the last range is fetched: the
+    // checkpoint must keep the hash block 25 had when it was indexed.
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        var out []types.Log
+        for _, lg := range node.logs {
+            if lg.BlockNumber >= from && lg.BlockNumber <= to {
+                out = append(out, lg)
+            }
+        }
+        if to == 25 {
+            node.reorg()
+        }
+        return out, nil
+    }
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+
+    if err := New(cfg, node.dial(t), &memorySink{}).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    cp, err := readCheckpoint(cfg.CheckpointFile)
+    if err != nil || cp == nil {
+        t.Fatalf("readCheckpoint: %v, %v", cp, err)
+    }
+    if cp.Block != 25 || cp.Hash != blockHash(25, 0).Hex() {
+        t.Fatalf("checkpoint = block %d hash %s, want block 25 hash %s", cp.Block, cp.Hash, blockHash(25, 0).Hex())
+    }
+}
+
+func TestCheckpointHashOfQuietRangeFromHeader(t *testing.T) {
+    node := newFakeNode(t, 9)
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+
+    if err := New(cfg, node.dial(t), &memorySink{}).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    cp, err := readCheckpoint(cfg.CheckpointFile)
+    if err != nil || cp == nil {
+        t.Fatalf("readCheckpoint: %v, %v", cp, err)
+    }
+    if cp.Block != 9 || cp.Hash != blockHash(9, 0).Hex() {
+        t.Fatalf("checkpoint = block %d hash %s, want block 9 hash %s", cp.Block, cp.Hash, blockHash(9, 0).Hex())
+    }
+}
+
+func TestResumeRewindsToCommonAncestor(t *testing.T) {
+    cp := &Checkpoint{
+        Block:  20,
+        Hash:   blockHash(20, 1).Hex(),
+        Recent: []CheckpointBlock{{Block: 10, Hash: blockHash(10, 1).Hex()}, {Block: 5, Hash: blockHash(5, 0).Hex()}},
+    }
+    hashOf := func(_ context.Context, block uint64) (common.Hash, error) {
+        return blockHash(block, 0), nil
+    }
+    block, err := verifyCheckpoint(context.Background(), cp, hashOf)
+    if err != nil || block != 5 {
+        t.Fatalf("verifyCheckpoint = %d, %v, want 5", block, err)
+    }
+
+    cp.Recent = cp.Recent[:1]
+    if _, err := verifyCheckpoint(context.Background(), cp, hashOf); err == nil {
+        t.Fatal("verifyCheckpoint succeeded without a canonical recorded block")
+    }
+}
+
+func TestResumeStart(t *testing.T) {
+    for _, tc := range []struct{ start, after, overlap, want uint64 }{
+        {start: 0, after: 100, overlap: 0, want: 101},
+        {start: 0, after: 100, overlap: 10, want: 91},
+        {start: 95, after: 100, overlap: 10, want: 95},
+        {start: 200, after: 100, overlap: 10, want: 200},
+    } {
+        if got := ResumeStart(tc.start, tc.after, tc.overlap); got != tc.want {
+            t.Errorf("ResumeStart(%d, %d, %d) = %d, want %d", tc.start, tc.after, tc.overlap, got, tc.want)
+        }
+    }
+}
+
+func TestResumeRescansOverlap(t *testing.T) {
+    node := newFakeNode(t, 30, transferLog(24, 0, 1), transferLog(27, 0, 2), transferLog(35, 0, 3))
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = t.TempDir() + "/checkpoint.json"
+    if err := New(cfg, node.dial(t), &memorySink{}).Run(context.Background()); err != nil {
+        t.Fatalf("first Run: %v", err)
+    }
+
+    node.mu.Lock()
+    node.head = 40
+    node.mu.Unlock()
+    cfg.ReindexOverlap = 5
+    out := &memorySink{}
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("second Run: %v", err)
+    }
+    // Checkpoint 30, so the second run starts at 31 - 5 = 26.
+    if got := out.blocks(); len(got) != 2 || got[0] != 27 || got[1] != 35 {
+        t.Fatalf("written blocks = %v, want [27 35]", got)
+    }
+}
+
+// txSink is an in-memory TransactionalSink. A transaction setting the
+// checkpoint to crashAt fails, as if the process died between writing the
+// rows of a range and storing its checkpoint.
+type txSink struct {
+    memorySink
+    mu         sync.Mutex
+    checkpoint uint64
+    stored     bool
+    crashAt    uint64
+}
+
+type memoryTx struct {
+    s          *txSink
+    events     []sink.Event
+    checkpoint *uint64
+}
+
+func (s *txSink) Begin() (sink.Tx, error) { return &memoryTx{s: s}, nil }
+
+func (s *txSink) Checkpoint() (uint64, bool, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return s.checkpoint, s.stored, nil
+}
+
+func (tx *memoryTx) Write(evt sink.Event) error {
+    tx.events = append(tx.events, evt)
+    return nil
+}
+
+func (tx *memoryTx) SetCheckpoint(block uint64) error {
+    if tx.s.crashAt != 0 && block == tx.s.crashAt {
+        return errors.New("connection lost")
+    }
+    tx.checkpoint = &block
+    return nil
+}
+
+func (tx *memoryTx) Commit() error {
+    for _, evt := range tx.events {
+        tx.s.memorySink.Write(evt)
+    }
+    if tx.checkpoint != nil {
+        tx.s.mu.Lock()
+        tx.s.checkpoint, tx.s.stored = *tx.checkpoint, true
+        tx.s.mu.Unlock()
+    }
+    return nil
+}
+
+func (tx *memoryTx) Rollback() error { return nil }
+
+func TestTransactionalSinkCrashBeforeCheckpoint(t *testing.T) {
+    node := newFakeNode(t, 29, transferLog(5, 0, 1), transferLog(15, 0, 2), transferLog(25, 0, 3))
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+    out := &txSink{crashAt: 19}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err == nil {
+        t.Fatal("Run succeeded despite the failed checkpoint")
+    }
+    // The range [10, 19] was rolled back with its checkpoint.
+    if block, ok, _ := out.Checkpoint(); !ok || block != 9 {
+        t.Fatalf("checkpoint = %d, %v; want 9", block, ok)
+    }
+    if got := out.blocks(); len(got) != 1 || got[0] != 5 {
+        t.Fatalf("committed blocks = %v, want [5]", got)
+    }
+    if cp, err := readCheckpoint(cfg.CheckpointFile); cp != nil || err != nil {
+        t.Fatalf("checkpoint file written next to the sink: %v, %v", cp, err)
+    }
+
+    // The restarted run resumes from the sink's checkpoint: no range is
+    // written twice.
+    out.crashAt = 0
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("second Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 3 || got[1] != 15 || got[2] != 25 {
+        t.Fatalf("committed blocks = %v, want [5 15 25]", got)
+    }
+    if block, _, _ := out.Checkpoint(); block != 29 {
+        t.Fatalf("checkpoint = %d, want 29", block)
+    }
+}
+
+func TestResumeFromCheckpointFile(t *testing.T) {
+    node := newFakeNode(t, 19, transferLog(15, 0, 1), transferLog(25, 0, 2))
+    var mu sync.Mutex
+    var scannedRanges []string
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        mu.Lock()
+        scannedRanges = append(scannedRanges, fmt.Sprintf("%d-%d", from, to))
+        mu.Unlock()
+        var out []types.Log
+        for _, lg := range node.logs {
+            if lg.BlockNumber >= from && lg.BlockNumber <= to {
+                out = append(out, lg)
+            }
+        }
+        return out, nil
+    }
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+
+    run := func(head uint64) []uint64 {
+        t.Helper()
+        node.mu.Lock()
+        node.head = head
+        node.mu.Unlock()
+        mu.Lock()
+        scannedRanges = nil
+        mu.Unlock()
+        out := &memorySink{}
+        if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+            t.Fatalf("Run to %d: %v", head, err)
+        }
+        cp, err := readCheckpoint(cfg.CheckpointFile)
+        if err != nil || cp == nil || cp.Block != head || cp.Hash != blockHash(head, 0).Hex() {
+            t.Fatalf("checkpoint after run to %d = %+v (%v)", head, cp, err)
+        }
+        return out.blocks()
+    }
+
+    if got := run(19); len(got) != 1 || got[0] != 15 {
+        t.Fatalf("first run wrote blocks %v, want [15]", got)
+    }
+    // The next run starts after the checkpoint: only the new blocks are
+    // scanned.
+    if got := run(39); len(got) != 1 || got[0] != 25 {
+        t.Fatalf("second run wrote blocks %v, want [25]", got)
+    }
+    if got := fmt.Sprint(scannedRanges); got != "[20-29 30-39]" {
+        t.Errorf("second run scanned %s, want [20-29 30-39]", got)
+    }
+    if got := run(39); len(got) != 0 || len(scannedRanges) != 0 {
+        t.Errorf("run at the checkpoint wrote %v and scanned %v, want nothing", got, scannedRanges)
+    }
+}
@@ -0,0 +1,122 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/sirupsen/logrus"
+)
+
+// Emitter is a contract found by Discover, with the number of matching logs
+// it emitted and the blocks of the first and last one.
+type Emitter struct {
+    Address    common.Address `json:"address"`
+    Logs       int            `json:"logs"`
+    FirstBlock uint64         `json:"first_block"`
+    LastBlock  uint64         `json:"last_block"`
+}
+
+// ParseTopic0 returns the topic0 of an event signature such as
+// "Transfer(address indexed from, address to, uint256)" – parameter names
+// and indexed markers are ignored – or of a 0x-prefixed topic0 hash.
+func ParseTopic0(s string) (common.Hash, error) {
+    s = strings.TrimSpace(s)
+    if strings.HasPrefix(s, "0x") {
+        b, err := hexutil.Decode(s)
+        if err != nil || len(b) != common.HashLength {
+            return common.Hash{}, fmt.Errorf("invalid topic0 %q, expected 32 hex-encoded bytes", s)
+        }
+        return common.BytesToHash(b), nil
+    }
+    name, params, ok := strings.Cut(s, "(")
+    if !ok || !strings.HasSuffix(params, ")") || strings.TrimSpace(name) == "" {
+        return common.Hash{}, fmt.Errorf("invalid event signature %q, expected e.g. Transfer(address,address,uint256)", s)
+    }
+    var paramTypes []string
+    if params = strings.TrimSpace(strings.TrimSuffix(params, ")")); params != "" {
+        for _, p := range strings.Split(params, ",") {
+            // Keep the type, the first word of "address indexed from".
+            fields := strings.Fields(p)
+            if len(fields) == 0 {
+                return common.Hash{}, fmt.Errorf("invalid event signature %q: empty parameter", s)
+            }
+            paramTypes = append(paramTypes, fields[0])
+        }
+    }
+    sig := strings.TrimSpace(name) + "(" + strings.Join(paramTypes, ",") + ")"
+    return crypto.Keccak256Hash([]byte(sig)), nil
+}
+
+// Discover scans the configured range for logs with topic0 emitted by any
+// contract – the query of address-less entries – and returns the distinct
+// emitters instead of decoding the events, by descending log count. Only
+// eth_getLogs is issued; exclude_addresses are left out.
+func (idx *Indexer) Discover(ctx context.Context, topic0 common.Hash) ([]Emitter, error) {
+    latest, err := idx.client.LatestBlockNumber(ctx)
+    if err != nil {
+        return nil, err
+    }
+    from := idx.cfg.StartBlock.Resolve(latest)
+    to := idx.endBlock(latest)
+
+    found := make(map[common.Address]*Emitter)
+    for start := from; start <= to; start += idx.chunkSize {
+        end := start + idx.chunkSize - 1
+        if end > to || end < start {
+            end = to
+        }
+        for _, page := range pageRange(start, end, idx.cfg.MaxRPCRange) {
+            logs, err := idx.client.GetLogs(ctx, anyAddressQuery(new(big.Int).SetUint64(page.From), new(big.Int).SetUint64(page.To), []common.Hash{topic0}))
+            if err != nil {
+                return nil, err
+            }
+            logs, _ = filterBlockRange(logs, page.From, page.To)
+            for _, lg := range logs {
+                if _, ok := idx.excluded[lg.Address]; ok {
+                    continue
+                }
+                e, ok := found[lg.Address]
+                if !ok {
+                    e = &Emitter{Address: lg.Address, FirstBlock: lg.BlockNumber}
+                    found[lg.Address] = e
+                }
+                e.Logs++
+                e.FirstBlock = min(e.FirstBlock, lg.BlockNumber)
+                e.LastBlock = max(e.LastBlock, lg.BlockNumber)
+            }
+        }
+        logrus.Debugf("Discovered %d emitters up to block %d", len(found), end)
+        if end == to {
+            break
+        }
+    }
+
+    out := make([]Emitter, 0, len(found))
+    for _, e := range found {
+        out = append(out, *e)
+    }
+    sort.Slice(out, func(i, j int) bool {
+        if out[i].Logs != out[j].Logs {
+            return out[i].Logs > out[j].Logs
+        }
+        return out[i].Address.Hex() < out[j].Address.Hex()
+    })
+    return out, nil
+}
+
+// anyAddressQuery matches the logs with one of the topic0 hashes, whatever
+// contract emitted them.
+func anyAddressQuery(from, to *big.Int, topics []common.Hash) ethereum.FilterQuery {
+    return ethereum.FilterQuery{
+        FromBlock: from,
+        ToBlock:   to,
+        Topics:    [][]common.Hash{topics},
+    }
+}
@@ -0,0 +1,101 @@
+package indexer
+
+import (
+	"context"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// logFrom returns a Transfer log of addr in block at position index.
+func logFrom(addr common.Address, block uint64, index uint) types.Log {
+    lg := transferLog(block, index, 1)
+    lg.Address = addr
+    return lg
+}
+
+func TestDiscoverCountsEmitters(t *testing.T) {
+    a, b, c := common.HexToAddress("0xa"), common.HexToAddress("0xb"), common.HexToAddress("0xc")
+    excluded := common.HexToAddress("0xdead")
+    node := newFakeNode(t, 100,
+        logFrom(a, 3, 0), logFrom(b, 4, 0), logFrom(a, 17, 1), logFrom(c, 25, 0),
+        logFrom(a, 31, 0), logFrom(excluded, 32, 0), logFrom(b, 39, 2),
+        logFrom(a, 45, 0), // past end_block
+    )
+    queried := scanned(node)
+    cfg := testConfig(t, 0)
+    cfg.EndBlock = &config.BlockRef{Number: 40}
+    cfg.MaxRPCRange = 5
+    cfg.ExcludeAddresses = []string{excluded.Hex()}
+
+    emitters, err := New(cfg, node.dial(t), nil).Discover(context.Background(), transferID)
+    if err != nil {
+        t.Fatalf("Discover: %v", err)
+    }
+    want := []Emitter{
+        {Address: a, Logs: 3, FirstBlock: 3, LastBlock: 31},
+        {Address: b, Logs: 2, FirstBlock: 4, LastBlock: 39},
+        {Address: c, Logs: 1, FirstBlock: 25, LastBlock: 25},
+    }
+    if len(emitters) != len(want) {
+        t.Fatalf("emitters = %+v, want %+v", emitters, want)
+    }
+    for i := range want {
+        if emitters[i] != want[i] {
+            t.Errorf("emitter %d = %+v, want %+v", i, emitters[i], want[i])
+        }
+    }
+
+    // Ranges of chunk_size 10 are paged by max_rpc_range.
+    ranges := queried()
+    if len(ranges) != 9 || ranges[0] != (BlockRange{From: 0, To: 4}) || ranges[8] != (BlockRange{From: 40, To: 40}) {
+        t.Errorf("queried ranges = %v, want pages of 5 blocks over [0, 40]", ranges)
+    }
+    if n := node.callCount("eth_getBlockByNumber"); n != 0 {
+        t.Errorf("Discover fetched %d headers, want eth_getLogs only", n)
+    }
+}
+
+func TestDiscoverOrdersTiesByAddress(t *testing.T) {
+    a, b := common.HexToAddress("0xa"), common.HexToAddress("0xb")
+    node := newFakeNode(t, 10, logFrom(b, 1, 0), logFrom(a, 2, 0))
+    emitters, err := New(testConfig(t, 0), node.dial(t), nil).Discover(context.Background(), transferID)
+    if err != nil {
+        t.Fatalf("Discover: %v", err)
+    }
+    if len(emitters) != 2 || emitters[0].Address != a || emitters[1].Address != b {
+        t.Fatalf("emitters = %+v, want 0xa then 0xb", emitters)
+    }
+}
+
+func TestAnyAddressQuery(t *testing.T) {
+    q := anyAddressQuery(nil, nil, []common.Hash{transferID})
+    if len(q.Addresses) != 0 {
+        t.Errorf("query addresses = %v, want any", q.Addresses)
+    }
+    if len(q.Topics) != 1 || len(q.Topics[0]) != 1 || q.Topics[0][0] != transferID {
+        t.Errorf("query topics = %v, want [[Transfer]]", q.Topics)
+    }
+}
+
+func TestParseTopic0(t *testing.T) {
+    for _, s := range []string{
+        "Transfer(address,address,uint256)",
+        "Transfer(address indexed from, address indexed to, uint256 value)",
+        " Transfer( address , address,uint256 ) ",
+        transferID.Hex(),
+    } {
+        got, err := ParseTopic0(s)
+        if err != nil || got != transferID {
+            t.Errorf("ParseTopic0(%q) = %s, %v; want %s", s, got.Hex(), err, transferID.Hex())
+        }
+    }
+    for _, s := range []string{"Transfer", "(address)", "Transfer(address,,uint256)", "0x1234"} {
+        if _, err := ParseTopic0(s); err == nil {
+            t.Errorf("ParseTopic0(%q) accepted an invalid signature", s)
+        }
+    }
+}
@@ -0,0 +1,159 @@
+package indexer
+
+import (
+	"context"
+	"math"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// DefaultEstimateSamples is the number of ranges sampled by Estimate when
+// the caller does not ask for a specific amount.
+const DefaultEstimateSamples = 5
+
+// Estimate is a projection of the RPC usage and output volume of a run over
+// the configured range, extrapolated from a few sampled ranges.
+type Estimate struct {
+    StartBlock     uint64 `json:"start_block"`
+    EndBlock       uint64 `json:"end_block"`
+    TotalBlocks    uint64 `json:"total_blocks"`
+    ChunkSize      uint64 `json:"chunk_size"`
+    Ranges         uint64 `json:"ranges"`
+    GetLogsCalls   uint64 `json:"get_logs_calls"`
+    SampledRanges  int    `json:"sampled_ranges"`
+    SampledBlocks  uint64 `json:"sampled_blocks"`
+    SampledLogs    int    `json:"sampled_logs"`
+    // Projections based on the sampled log density.
+    Events         uint64 `json:"events"`
+    HeaderCalls    uint64 `json:"header_calls"`      // timestamps (+ index_blocks)
+    TxCalls        uint64 `json:"tx_calls"`          // tx_from / decode_tx_input
+    ReceiptCalls   uint64 `json:"receipt_calls"`     // enrich_receipt, one per block with events
+    TraceCalls     uint64 `json:"trace_calls"`       // index_traces, one per block
+    TotalCalls     uint64 `json:"total_calls"`
+}
+
+// sampleStats are the raw counts gathered over the sampled ranges.
+type sampleStats struct {
+    blocks      uint64 // blocks covered by the samples
+    logs        int
+    eventBlocks int // distinct blocks containing at least one log
+    txs         int // distinct transactions
+}
+
+// Estimate samples up to samples ranges of chunk size spread evenly over the
+// configured range and projects the totals of a full run. Only eth_getLogs
+// is issued while sampling; nothing is written.
+func (idx *Indexer) Estimate(ctx context.Context, samples int) (*Estimate, error) {
+    if samples <= 0 {
+        samples = DefaultEstimateSamples
+    }
+
+    latest, err := idx.client.LatestBlockNumber(ctx)
+    if err != nil {
+        return nil, err
+    }
+    from := idx.cfg.StartBlock.Resolve(latest)
+    latest = idx.endBlock(latest)
+    if from > latest {
+        from = latest
+    }
+
+    ranges := sampleRanges(from, latest, idx.chunkSize, samples)
+    var st sampleStats
+    for _, r := range ranges {
+        blocks := make(map[uint64]struct{})
+        txs := make(map[common.Hash]struct{})
+        logs, err := idx.fetchLogs(ctx, r.From, r.To)
+        if err != nil {
+            return nil, err
+        }
+        for _, lg := range logs {
+            blocks[lg.BlockNumber] = struct{}{}
+            txs[lg.TxHash] = struct{}{}
+        }
+        st.logs += len(logs)
+        st.blocks += r.To - r.From + 1
+        st.eventBlocks += len(blocks)
+        st.txs += len(txs)
+    }
+
+    queries := len(idx.filterQueries(nil, nil))
+    est := extrapolate(from, latest, idx.chunkSize, queries, st)
+    est.SampledRanges = len(ranges)
+    if m := idx.cfg.MaxRPCRange; m > 0 && m < idx.chunkSize && est.TotalBlocks > 0 {
+        // Every chunk is paged into ceil(chunk/m) calls, the last one by its own size.
+        full, rest := est.TotalBlocks/idx.chunkSize, est.TotalBlocks%idx.chunkSize
+        pages := full * ((idx.chunkSize + m - 1) / m)
+        pages += (rest + m - 1) / m
+        est.GetLogsCalls = pages * uint64(queries)
+    }
+
+    if idx.cfg.IndexBlocks {
+        est.HeaderCalls += est.TotalBlocks
+    }
+    if !idx.cfg.EnrichReceipt {
+        est.ReceiptCalls = 0
+    }
+    if idx.cfg.IndexTraces {
+        est.TraceCalls = est.TotalBlocks
+    }
+    est.TotalCalls = est.GetLogsCalls + est.HeaderCalls + est.TxCalls + est.ReceiptCalls + est.TraceCalls
+    return est, nil
+}
+
+// sampleRanges picks n chunk-sized ranges evenly spaced over [from, to]. When
+// the range holds n chunks or fewer every chunk is returned.
+func sampleRanges(from, to, chunk uint64, n int) []BlockRange {
+    if chunk == 0 || to < from || n <= 0 {
+        return nil
+    }
+    chunks := (to-from)/chunk + 1
+    step := uint64(1)
+    if chunks > uint64(n) {
+        step = chunks / uint64(n)
+    }
+
+    var out []BlockRange
+    for i := uint64(0); i < chunks && len(out) < n; i += step {
+        start := from + i*chunk
+        end := start + chunk - 1
+        if end > to {
+            end = to
+        }
+        out = append(out, BlockRange{From: start, To: end})
+    }
+    return out
+}
+
+// extrapolate scales the sampled densities to the full [from, to] range.
+// Header and transaction calls assume the parser caches (one header per
+// block with events, one tx lookup per distinct transaction); receipt calls
+// assume eth_getBlockReceipts (one per block with events).
+func extrapolate(from, to, chunk uint64, queriesPerRange int, st sampleStats) *Estimate {
+    est := &Estimate{
+        StartBlock:    from,
+        EndBlock:      to,
+        ChunkSize:     chunk,
+        SampledBlocks: st.blocks,
+        SampledLogs:   st.logs,
+    }
+    if to < from || chunk == 0 {
+        return est
+    }
+
+    est.TotalBlocks = to - from + 1
+    est.Ranges = (est.TotalBlocks + chunk - 1) / chunk
+    est.GetLogsCalls = est.Ranges * uint64(queriesPerRange)
+
+    if st.blocks == 0 {
+        return est
+    }
+    scale := float64(est.TotalBlocks) / float64(st.blocks)
+    project := func(n int) uint64 { return uint64(math.Round(float64(n) * scale)) }
+
+    est.Events = project(st.logs)
+    est.HeaderCalls = project(st.eventBlocks)
+    est.TxCalls = project(st.txs)
+    est.ReceiptCalls = project(st.eventBlocks)
+    return est
+}
@@ -0,0 +1,185 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestSampleRanges(t *testing.T) {
+    cases := []struct {
+        from, to, chunk uint64
+        n               int
+        want            string
+    }{
+        // Spread evenly when the range holds more chunks than samples.
+        {0, 99, 10, 5, "[0→9 20→29 40→49 60→69 80→89]"},
+        {0, 104, 10, 3, "[0→9 30→39 60→69]"},
+        {1000, 1999, 100, 2, "[1000→1099 1500→1599]"},
+        // Every chunk otherwise, the last one cut at to.
+        {0, 24, 10, 5, "[0→9 10→19 20→24]"},
+        {5, 5, 10, 3, "[5→5]"},
+        {0, 99, 10, 10, "[0→9 10→19 20→29 30→39 40→49 50→59 60→69 70→79 80→89 90→99]"},
+        {10, 9, 10, 5, "[]"},
+        {0, 99, 0, 5, "[]"},
+        {0, 99, 10, 0, "[]"},
+    }
+    for _, tc := range cases {
+        got := sampleRanges(tc.from, tc.to, tc.chunk, tc.n)
+        if s := fmt.Sprint(got); s != tc.want {
+            t.Errorf("sampleRanges(%d, %d, %d, %d) = %s, want %s", tc.from, tc.to, tc.chunk, tc.n, s, tc.want)
+        }
+    }
+}
+
+func TestExtrapolate(t *testing.T) {
+    cases := []struct {
+        name            string
+        from, to, chunk uint64
+        queries         int
+        st              sampleStats
+        want            Estimate
+    }{
+        {
+            name: "scaled by total over sampled blocks",
+            from: 0, to: 999, chunk: 100, queries: 2,
+            st: sampleStats{blocks: 200, logs: 50, eventBlocks: 20, txs: 30},
+            want: Estimate{EndBlock: 999, TotalBlocks: 1000, ChunkSize: 100, Ranges: 10, GetLogsCalls: 20,
+                SampledBlocks: 200, SampledLogs: 50, Events: 250, HeaderCalls: 100, TxCalls: 150, ReceiptCalls: 100},
+        },
+        {
+            name: "partial last range and rounding",
+            from: 100, to: 204, chunk: 10, queries: 1,
+            st: sampleStats{blocks: 30, logs: 7, eventBlocks: 1, txs: 2},
+            want: Estimate{StartBlock: 100, EndBlock: 204, TotalBlocks: 105, ChunkSize: 10, Ranges: 11, GetLogsCalls: 11,
+                SampledBlocks: 30, SampledLogs: 7, Events: 25, HeaderCalls: 4, TxCalls: 7, ReceiptCalls: 4},
+        },
+        {
+            name: "no logs sampled",
+            from: 0, to: 49, chunk: 10, queries: 3,
+            st: sampleStats{blocks: 20},
+            want: Estimate{EndBlock: 49, TotalBlocks: 50, ChunkSize: 10, Ranges: 5, GetLogsCalls: 15, SampledBlocks: 20},
+        },
+        {
+            name: "nothing sampled",
+            from: 0, to: 49, chunk: 10, queries: 1,
+            want: Estimate{EndBlock: 49, TotalBlocks: 50, ChunkSize: 10, Ranges: 5, GetLogsCalls: 5},
+        },
+        {
+            name: "empty range",
+            from: 10, to: 9, chunk: 10, queries: 1,
+            st: sampleStats{blocks: 10, logs: 4},
+            want: Estimate{StartBlock: 10, EndBlock: 9, ChunkSize: 10, SampledBlocks: 10, SampledLogs: 4},
+        },
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            if got := extrapolate(tc.from, tc.to, tc.chunk, tc.queries, tc.st); *got != tc.want {
+                t.Errorf("extrapolate = %+v\nwant          %+v", *got, tc.want)
+            }
+        })
+    }
+}
+
+// sampledNode returns a node of blocks 0 to head with transfers in blocks
+// 3 (twice), 41 and 95, recording the ranges of its eth_getLogs calls.
+func sampledNode(t *testing.T, head uint64) (*fakeNode, func() []BlockRange) {
+    node := newFakeNode(t, head)
+    logs := []types.Log{transferLog(3, 0, 1), transferLog(3, 1, 2), transferLog(41, 0, 3), transferLog(95, 0, 4)}
+    var mu sync.Mutex
+    var fetched []BlockRange
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        mu.Lock()
+        fetched = append(fetched, BlockRange{From: from, To: to})
+        mu.Unlock()
+        var out []types.Log
+        for _, lg := range logs {
+            if lg.BlockNumber >= from && lg.BlockNumber <= to {
+                out = append(out, lg)
+            }
+        }
+        return out, nil
+    }
+    return node, func() []BlockRange {
+        mu.Lock()
+        defer mu.Unlock()
+        return append([]BlockRange(nil), fetched...)
+    }
+}
+
+func TestEstimateSamplesTheConfiguredRange(t *testing.T) {
+    node, fetched := sampledNode(t, 99)
+    est, err := New(testConfig(t, 0), node.dial(t), nil).Estimate(context.Background(), 5)
+    if err != nil {
+        t.Fatalf("Estimate: %v", err)
+    }
+
+    // Only the sampled ranges are fetched, and nothing else is called.
+    if got := fmt.Sprint(fetched()); got != "[0→9 20→29 40→49 60→69 80→89]" {
+        t.Errorf("fetched ranges = %s", got)
+    }
+    if n := node.callCount("eth_getBlockByNumber"); n != 0 {
+        t.Errorf("%d header requests while estimating", n)
+    }
+
+    // 3 logs in 2 blocks and 3 transactions over 50 of 100 blocks.
+    want := Estimate{
+        EndBlock: 99, TotalBlocks: 100, ChunkSize: 10, Ranges: 10, GetLogsCalls: 10,
+        SampledRanges: 5, SampledBlocks: 50, SampledLogs: 3,
+        Events: 6, HeaderCalls: 4, TxCalls: 6, TotalCalls: 20,
+    }
+    if *est != want {
+        t.Errorf("estimate = %+v\nwant       %+v", *est, want)
+    }
+}
+
+func TestEstimateOptionalCalls(t *testing.T) {
+    cases := []struct {
+        name   string
+        head   uint64
+        modify func(*config.Config)
+        check  func(t *testing.T, est *Estimate)
+    }{
+        {
+            name: "max_rpc_range pages every chunk",
+            head: 104,
+            modify: func(cfg *config.Config) { cfg.MaxRPCRange = 4 },
+            // 10 full chunks of 3 pages and a last chunk of 5 blocks in 2.
+            check: func(t *testing.T, est *Estimate) {
+                if est.Ranges != 11 || est.GetLogsCalls != 32 {
+                    t.Errorf("ranges, get_logs_calls = %d, %d; want 11, 32", est.Ranges, est.GetLogsCalls)
+                }
+            },
+        },
+        {
+            name: "index_blocks, enrich_receipt and index_traces",
+            head: 99,
+            modify: func(cfg *config.Config) { cfg.IndexBlocks, cfg.EnrichReceipt, cfg.IndexTraces = true, true, true },
+            check: func(t *testing.T, est *Estimate) {
+                if est.HeaderCalls != 104 || est.ReceiptCalls != 4 || est.TraceCalls != 100 {
+                    t.Errorf("header, receipt, trace calls = %d, %d, %d; want 104, 4, 100", est.HeaderCalls, est.ReceiptCalls, est.TraceCalls)
+                }
+                if est.TotalCalls != est.GetLogsCalls+est.HeaderCalls+est.TxCalls+est.ReceiptCalls+est.TraceCalls {
+                    t.Errorf("total_calls = %d, not the sum of %+v", est.TotalCalls, *est)
+                }
+            },
+        },
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            node, _ := sampledNode(t, tc.head)
+            cfg := testConfig(t, 0)
+            tc.modify(cfg)
+            est, err := New(cfg, node.dial(t), nil).Estimate(context.Background(), 5)
+            if err != nil {
+                t.Fatalf("Estimate: %v", err)
+            }
+            tc.check(t, est)
+        })
+    }
+}
@@ -0,0 +1,58 @@
+package indexer
+
+import "time"
+
+// etaWindow is how many recent ranges the ETA moving average covers.
+const etaWindow = 20
+
+// rangeSample is one completed range as seen by the moving average.
+type rangeSample struct {
+    at     time.Time
+    blocks uint64
+}
+
+// movingRate smooths the block throughput over the last etaWindow completed
+// ranges, so a burst of empty or slow ranges does not swing the ETA.
+type movingRate struct {
+    start   time.Time // when the window was empty, the start of the run
+    samples []rangeSample
+}
+
+func newMovingRate(start time.Time) movingRate {
+    return movingRate{start: start}
+}
+
+// add records a range of blocks completed at t.
+func (m *movingRate) add(t time.Time, blocks uint64) {
+    if len(m.samples) == etaWindow {
+        m.start = m.samples[0].at
+        m.samples = m.samples[1:]
+    }
+    m.samples = append(m.samples, rangeSample{at: t, blocks: blocks})
+}
+
+// rate returns the blocks per second over the window; zero until a range
+// has completed some time after the window start.
+func (m *movingRate) rate() float64 {
+    if len(m.samples) == 0 {
+        return 0
+    }
+    elapsed := m.samples[len(m.samples)-1].at.Sub(m.start).Seconds()
+    if elapsed <= 0 {
+        return 0
+    }
+    var blocks uint64
+    for _, s := range m.samples {
+        blocks += s.blocks
+    }
+    return float64(blocks) / elapsed
+}
+
+// estimateETA returns how long the remaining blocks take at rate blocks per
+// second, rounded to the second. ok is false when the rate is not positive.
+func estimateETA(remaining uint64, rate float64) (time.Duration, bool) {
+    if rate <= 0 {
+        return 0, false
+    }
+    return (time.Duration(float64(remaining)/rate*float64(time.Second))).Round(time.Second), true
+}
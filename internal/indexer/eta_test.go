@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMovingRateAndETA(t *testing.T) {
+    start := time.Unix(1_700_000_000, 0)
+    m := newMovingRate(start)
+    if m.rate() != 0 {
+        t.Fatalf("rate without samples = %f", m.rate())
+    }
+    // 10 blocks per second over the first window.
+    for i := 1; i <= etaWindow; i++ {
+        m.add(start.Add(time.Duration(i)*time.Second), 10)
+    }
+    if r := m.rate(); r != 10 {
+        t.Fatalf("rate = %f, want 10", r)
+    }
+    // Slower ranges push the old ones out of the window.
+    for i := 1; i <= etaWindow; i++ {
+        m.add(start.Add(time.Duration(etaWindow)*time.Second+time.Duration(i)*2*time.Second), 10)
+    }
+    if r := m.rate(); r != 5 {
+        t.Fatalf("rate after slowing down = %f, want 5", r)
+    }
+
+    if eta, ok := estimateETA(1000, 5); !ok || eta != 200*time.Second {
+        t.Errorf("estimateETA(1000, 5) = %s, %v", eta, ok)
+    }
+    if eta, ok := estimateETA(10, 3); !ok || eta != 3*time.Second {
+        t.Errorf("estimateETA(10, 3) = %s, want 3s rounded", eta)
+    }
+    if _, ok := estimateETA(1000, 0); ok {
+        t.Error("estimateETA with a zero rate is ok")
+    }
+}
+
+func TestProgressETA(t *testing.T) {
+    var tr progressTracker
+    tr.start(0, 999)
+    // The run started ten seconds ago.
+    tr.rate = newMovingRate(time.Now().Add(-10 * time.Second))
+    tr.rangeDone(0, 49, 0)
+    tr.rangeDone(50, 99, 0)
+
+    // 100 blocks in ~10s, 900 to go.
+    if eta := tr.snapshot().ETASeconds; eta < 85 || eta > 95 {
+        t.Fatalf("ETASeconds = %d, want about 90", eta)
+    }
+
+    tr.follow(1000)
+    if eta := tr.snapshot().ETASeconds; eta != 0 {
+        t.Fatalf("ETASeconds = %d after switching to follow mode, want 0", eta)
+    }
+    tr.rangeDone(1000, 1009, 0)
+    if eta := tr.snapshot().ETASeconds; eta != 0 {
+        t.Fatalf("ETASeconds = %d while following, want 0", eta)
+    }
+}
+
+func TestProgressETAOfFinishedRun(t *testing.T) {
+    var tr progressTracker
+    tr.start(0, 99)
+    tr.rate = newMovingRate(time.Now().Add(-time.Second))
+    tr.skip([]BlockRange{{From: 0, To: 49}})
+    tr.rangeDone(50, 99, 0)
+    if eta := tr.snapshot().ETASeconds; eta != 0 {
+        t.Fatalf("ETASeconds = %d with nothing left, want 0", eta)
+    }
+}
@@ -0,0 +1,244 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/sirupsen/logrus"
+)
+
+// followBuffer is the capacity of the channel receiving subscribed logs.
+const followBuffer = 1_024
+
+// follow keeps indexing after the catch-up phase by subscribing to new logs
+// (eth_subscribe, so rpc_url or rpc_ws_url must be a WebSocket endpoint). Logs the node
+// retracts on a reorg are delivered again with Removed set and routed to
+// sink.Remove, so no parent-hash tracking is needed. A dropped subscription
+// is re-established and the missed blocks are back-filled from the
+// checkpoint on. It only returns on an unrecoverable error or once ctx is
+// cancelled.
+func (idx *Indexer) follow(ctx context.Context, from uint64) error {
+    logrus.Infof("Following new logs from block %d", from)
+    idx.progress.follow(from)
+    partial := make(map[logID]struct{})
+    for {
+        next, err := idx.followOnce(ctx, from, partial)
+        if ctx.Err() != nil {
+            return nil
+        }
+        if errors.Is(err, gethrpc.ErrNotificationsUnsupported) {
+            return fmt.Errorf("follow mode requires a websocket rpc_url or rpc_ws_url: %w", err)
+        }
+        logrus.Warnf("log subscription interrupted at block %d: %v – resubscribing", next, err)
+        from = next
+
+        select {
+        case <-ctx.Done():
+            return nil
+        case <-time.After(time.Duration(idx.cfg.Retry.DelayMS) * time.Millisecond):
+        }
+    }
+}
+
+// followOnce subscribes to every filter query, back-fills [from, latest] and
+// then writes live logs until the subscription fails. It returns the first
+// block that is not known to be fully indexed, used to resume from: the
+// checkpoint advances to the block before it. partial holds the logs of
+// that block already written, which the next back-fill skips.
+//
+// With follow_confirmations set, only blocks that many blocks below the
+// head are written: the back-fill stops there, and the logs of later blocks
+// wait in a pendingLogs buffer, flushed as the head advances. Logs a reorg
+// retracts while buffered are never written.
+func (idx *Indexer) followOnce(ctx context.Context, from uint64, partial map[logID]struct{}) (uint64, error) {
+    subCtx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    logs := make(chan types.Log, followBuffer)
+    queries := idx.filterQueries(nil, nil)
+    subErr := make(chan error, len(queries))
+    for _, q := range queries {
+        sub, err := idx.client.SubscribeFilterLogs(subCtx, q, logs)
+        if err != nil {
+            return from, err
+        }
+        defer sub.Unsubscribe()
+        go func() {
+            if err := <-sub.Err(); err != nil {
+                subErr <- err
+            }
+        }()
+    }
+
+    // Close the gap between the previous phase and the subscription start.
+    // Live logs at or below the back-filled head are skipped below.
+    latest, err := idx.client.LatestBlockNumber(ctx)
+    if err != nil {
+        return from, err
+    }
+    confirmations := idx.cfg.FollowConfirmations
+    confirmed := confirmedBlock(latest, confirmations)
+    if len(partial) > 0 && from <= confirmed {
+        evCount, err := idx.finishBlock(ctx, from, partial)
+        if err != nil {
+            return from, err
+        }
+        idx.liveBlocksDone(from, from, evCount)
+        from++
+        clear(partial)
+    }
+    for from <= confirmed {
+        to := from + idx.chunks.size(from, latest) - 1
+        if to > confirmed || to < from {
+            to = confirmed
+        }
+        evCount, err := idx.processRange(ctx, from, to)
+        if err != nil {
+            return from, err
+        }
+        idx.progress.rangeDone(from, to, evCount)
+        idx.rates.rangeDone(from, to)
+        idx.saveCheckpoint(false)
+        from = to + 1
+    }
+
+    // scanned is the first block whose logs only the subscription delivers.
+    scanned := from
+    live := 0 // events written from the subscription in blocks from on
+    pending := newPendingLogs()
+    var heads <-chan time.Time
+    if confirmations > 0 {
+        if scanned <= latest {
+            lgs, err := idx.fetchLogs(ctx, scanned, latest)
+            if err != nil {
+                return from, err
+            }
+            lgs, _ = filterBlockRange(lgs, scanned, latest)
+            for _, lg := range idx.dropUnwanted(lgs) {
+                pending.add(lg)
+            }
+            scanned = latest + 1
+        }
+        ticker := time.NewTicker(idx.tipPollInterval())
+        defer ticker.Stop()
+        heads = ticker.C
+    }
+
+    for {
+        select {
+        case <-ctx.Done():
+            return from, ctx.Err()
+        case err := <-subErr:
+            return from, err
+        case <-heads:
+            head, err := idx.client.LatestBlockNumber(ctx)
+            if err != nil {
+                logrus.Warnf("failed to fetch the chain head, pending logs not flushed: %v", err)
+                continue
+            }
+            final := confirmedBlock(head, confirmations)
+            flushed := 0
+            for _, lg := range pending.final(final) {
+                written, err := idx.writeLog(ctx, &lg)
+                if err != nil {
+                    return from, err
+                }
+                if written {
+                    flushed++
+                }
+            }
+            // Blocks up to final are complete: the back-fill or the
+            // subscription delivered their logs, now flushed.
+            if final+1 > from {
+                idx.liveBlocksDone(from, final, flushed)
+                from = final + 1
+            }
+        case lg := <-logs:
+            if !lg.Removed && lg.BlockNumber < scanned {
+                continue
+            }
+            if !idx.wanted(&lg) {
+                continue
+            }
+            if confirmations > 0 {
+                // Retractions of logs already written still go to the sink.
+                if !lg.Removed {
+                    pending.add(lg)
+                    continue
+                }
+                if pending.remove(lg) {
+                    continue
+                }
+            }
+            // The first log of a block completes the blocks before it.
+            // Later logs of the same block may still be in flight, so on
+            // resubscription it is scanned again, skipping those written.
+            if confirmations == 0 && !lg.Removed && lg.BlockNumber > from {
+                idx.liveBlocksDone(from, lg.BlockNumber-1, live)
+                from, scanned, live = lg.BlockNumber, lg.BlockNumber, 0
+                clear(partial)
+            }
+            written, err := idx.writeLog(ctx, &lg)
+            if err != nil {
+                return from, err
+            }
+            if written {
+                live++
+            }
+            if confirmations == 0 && !lg.Removed && lg.BlockNumber == from {
+                partial[logIDOf(&lg)] = struct{}{}
+                idx.checkpoints.rangeHash(from, lg.BlockHash)
+            }
+        }
+    }
+}
+
+// logID identifies a log within its block.
+type logID struct {
+    tx    common.Hash
+    index uint
+}
+
+func logIDOf(lg *types.Log) logID {
+    return logID{tx: lg.TxHash, index: lg.Index}
+}
+
+// finishBlock writes the logs of block missing from skip, the logs a
+// dropped subscription already delivered.
+func (idx *Indexer) finishBlock(ctx context.Context, block uint64, skip map[logID]struct{}) (int, error) {
+    logs, err := idx.fetchLogs(ctx, block, block)
+    if err != nil {
+        return 0, err
+    }
+    logs, _ = filterBlockRange(logs, block, block)
+    var missed []types.Log
+    for _, lg := range idx.dropUnwanted(logs) {
+        if _, ok := skip[logIDOf(&lg)]; !ok {
+            missed = append(missed, lg)
+        }
+    }
+    return idx.writeLogs(ctx, idx.sink, missed)
+}
+
+// liveBlocksDone records [from, to], indexed from the subscription, as
+// done, which advances the checkpoint.
+func (idx *Indexer) liveBlocksDone(from, to uint64, events int) {
+    idx.progress.rangeDone(from, to, events)
+    idx.rates.rangeDone(from, to)
+    idx.saveCheckpoint(false)
+}
+
+// confirmedBlock returns the highest block with at least confirmations
+// blocks on top of it when head is the chain head. Without confirmations
+// it is head itself.
+func confirmedBlock(head, confirmations uint64) uint64 {
+    if confirmations > head {
+        return 0
+    }
+    return head - confirmations
+}
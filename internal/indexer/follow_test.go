@@ -0,0 +1,285 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+// logFeed is a WebSocket endpoint serving eth_subscribe("logs"). Every
+// subscription receives the logs sent with push; drop closes every
+// connection, as a node restart would.
+type logFeed struct {
+    *httptest.Server
+
+    mu     sync.Mutex
+    server *gethrpc.Server
+    subs   []chan types.Log
+}
+
+func newLogFeed(t *testing.T) *logFeed {
+    t.Helper()
+    f := &logFeed{}
+    f.server = f.newServer(t)
+    f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        f.mu.Lock()
+        srv := f.server
+        f.mu.Unlock()
+        srv.WebsocketHandler([]string{"*"}).ServeHTTP(w, r)
+    }))
+    t.Cleanup(func() {
+        f.mu.Lock()
+        f.server.Stop()
+        f.mu.Unlock()
+        f.Close()
+    })
+    return f
+}
+
+func (f *logFeed) newServer(t *testing.T) *gethrpc.Server {
+    srv := gethrpc.NewServer()
+    if err := srv.RegisterName("eth", &logsService{feed: f}); err != nil {
+        t.Fatal(err)
+    }
+    return srv
+}
+
+// url returns the ws:// URL of the feed.
+func (f *logFeed) url() string {
+    return "ws" + strings.TrimPrefix(f.URL, "http")
+}
+
+// subscribers returns how many subscriptions were made so far.
+func (f *logFeed) subscribers() int {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return len(f.subs)
+}
+
+// push delivers lg to the newest subscription.
+func (f *logFeed) push(lg types.Log) {
+    f.mu.Lock()
+    ch := f.subs[len(f.subs)-1]
+    f.mu.Unlock()
+    ch <- lg
+}
+
+// drop closes every connection and serves new ones from a fresh server.
+func (f *logFeed) drop(t *testing.T) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.server.Stop()
+    f.server = f.newServer(t)
+}
+
+// logsService implements the "logs" subscription of the eth namespace.
+type logsService struct {
+    feed *logFeed
+}
+
+func (s *logsService) Logs(ctx context.Context, _ json.RawMessage) (*gethrpc.Subscription, error) {
+    notifier, ok := gethrpc.NotifierFromContext(ctx)
+    if !ok {
+        return nil, gethrpc.ErrNotificationsUnsupported
+    }
+    sub := notifier.CreateSubscription()
+    ch := make(chan types.Log, 16)
+    s.feed.mu.Lock()
+    s.feed.subs = append(s.feed.subs, ch)
+    s.feed.mu.Unlock()
+    go func() {
+        for {
+            select {
+            case lg := <-ch:
+                notifier.Notify(sub.ID, lg)
+            case <-sub.Err():
+                return
+            }
+        }
+    }()
+    return sub, nil
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds.
+func waitFor(t *testing.T, what string, cond func() bool) {
+    t.Helper()
+    deadline := time.Now().Add(5 * time.Second)
+    for !cond() {
+        if time.Now().After(deadline) {
+            t.Fatalf("timed out waiting for %s", what)
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestFollowResubscribeResumesAfterWrittenLogs(t *testing.T) {
+    node := newFakeNode(t, 10, transferLog(5, 0, 1), transferLog(11, 0, 2), transferLog(11, 1, 3), transferLog(12, 0, 4))
+    feed := newLogFeed(t)
+    cfg := testConfig(t, 0)
+    cfg.Follow = true
+    client := node.dial(t)
+    if err := client.DialSubscriptions(context.Background(), feed.url(), config.RPCTransportConfig{}); err != nil {
+        t.Fatalf("DialSubscriptions: %v", err)
+    }
+    out := &memorySink{}
+    idx := New(cfg, client, out)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() { done <- idx.Run(ctx) }()
+
+    // Block 11 is mined; the subscription drops after its first log.
+    // The head stays at 10 until then, so the back-fill of the first
+    // subscription cannot reach block 11.
+    waitFor(t, "the first subscription", func() bool { return feed.subscribers() == 1 })
+    feed.push(transferLog(11, 0, 2))
+    waitFor(t, "the live log", func() bool { return len(out.written()) == 2 })
+    node.mu.Lock()
+    node.head = 12
+    node.mu.Unlock()
+    feed.drop(t)
+
+    waitFor(t, "the back-fill", func() bool { return len(out.written()) >= 4 })
+    waitFor(t, "the second subscription", func() bool { return feed.subscribers() == 2 })
+    cancel()
+    if err := <-done; err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+
+    seen := map[string]bool{}
+    for _, evt := range out.written() {
+        if hash := evt["tx_hash"].(string); seen[hash] {
+            t.Fatalf("log %s written twice", hash)
+        } else {
+            seen[hash] = true
+        }
+    }
+    if blocks := out.blocks(); len(blocks) != 4 || blocks[0] != 5 || blocks[1] != 11 || blocks[2] != 11 || blocks[3] != 12 {
+        t.Fatalf("written blocks = %v, want [5 11 11 12]", blocks)
+    }
+    if cp, ok := idx.progress.checkpoint(); !ok || cp != 12 {
+        t.Fatalf("checkpoint = %d (ok %v), want 12", cp, ok)
+    }
+}
+
+func TestFollowConfirmationsHoldLogsUntilFinal(t *testing.T) {
+    node := newFakeNode(t, 10, transferLog(5, 0, 1))
+    feed := newLogFeed(t)
+    cfg := testConfig(t, 0)
+    cfg.Follow = true
+    cfg.FollowConfirmations = 3
+    cfg.TipPollIntervalMS = 5
+    client := node.dial(t)
+    if err := client.DialSubscriptions(context.Background(), feed.url(), config.RPCTransportConfig{}); err != nil {
+        t.Fatalf("DialSubscriptions: %v", err)
+    }
+    out := &memorySink{}
+    idx := New(cfg, client, out)
+
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() { done <- idx.Run(ctx) }()
+    setHead := func(head uint64) {
+        node.mu.Lock()
+        node.head = head
+        node.mu.Unlock()
+    }
+
+    waitFor(t, "the subscription", func() bool { return feed.subscribers() == 1 })
+    waitFor(t, "the back-fill", func() bool { return len(out.written()) == 1 })
+    feed.push(transferLog(12, 1, 3))
+    feed.push(transferLog(11, 0, 2))
+    feed.push(transferLog(12, 0, 4))
+    feed.push(transferLog(13, 0, 5))
+    // Block 13 is reorged out while its log is still buffered.
+    retracted := transferLog(13, 0, 5)
+    retracted.Removed = true
+    feed.push(retracted)
+
+    // Head 13 makes block 10 final: nothing live may be written yet.
+    setHead(13)
+    waitFor(t, "the checkpoint of block 10", func() bool {
+        cp, ok := idx.progress.checkpoint()
+        return ok && cp >= 10
+    })
+    if blocks := out.blocks(); len(blocks) != 1 {
+        t.Fatalf("written blocks = %v before any live block was final", blocks)
+    }
+
+    setHead(16)
+    waitFor(t, "the final blocks", func() bool { return len(out.written()) == 4 })
+    waitFor(t, "the checkpoint of block 13", func() bool {
+        cp, ok := idx.progress.checkpoint()
+        return ok && cp == 13
+    })
+    cancel()
+    if err := <-done; err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+
+    written := out.written()
+    if blocks := out.blocks(); len(blocks) != 4 || blocks[1] != 11 || blocks[2] != 12 || blocks[3] != 12 {
+        t.Fatalf("written blocks = %v, want [5 11 12 12]", blocks)
+    }
+    if written[2]["log_index"] != uint64(0) {
+        t.Errorf("block 12 written out of order: %v then %v", written[2]["log_index"], written[3]["log_index"])
+    }
+    for _, evt := range written {
+        if evt["removed"] == true {
+            t.Fatalf("retraction of a buffered log reached the sink: %v", evt)
+        }
+    }
+}
+
+func TestFollowKeepsIndexingAfterCatchUp(t *testing.T) {
+    node := newFakeNode(t, 10, transferLog(5, 0, 1))
+    feed := newLogFeed(t)
+    client := node.dial(t)
+    if err := client.DialSubscriptions(context.Background(), feed.url(), config.RPCTransportConfig{}); err != nil {
+        t.Fatalf("DialSubscriptions: %v", err)
+    }
+
+    // Without follow (--once) the run ends at the head it saw at start.
+    out := &memorySink{}
+    if err := New(testConfig(t, 0), client, out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 1 || got[0] != 5 || feed.subscribers() != 0 {
+        t.Fatalf("once: wrote blocks %v with %d subscriptions, want [5] and none", got, feed.subscribers())
+    }
+
+    // With follow (--follow) it subscribes and writes new blocks until
+    // cancelled.
+    cfg := testConfig(t, 0)
+    cfg.Follow = true
+    out = &memorySink{}
+    ctx, cancel := context.WithCancel(context.Background())
+    done := make(chan error, 1)
+    go func() { done <- New(cfg, client, out).Run(ctx) }()
+
+    waitFor(t, "the subscription", func() bool { return feed.subscribers() == 1 })
+    feed.push(transferLog(11, 0, 2))
+    waitFor(t, "the live log", func() bool { return len(out.written()) == 2 })
+    select {
+    case err := <-done:
+        t.Fatalf("follow Run returned after catching up: %v", err)
+    default:
+    }
+    cancel()
+    if err := <-done; err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 5 || got[1] != 11 {
+        t.Fatalf("follow: wrote blocks %v, want [5 11]", got)
+    }
+}
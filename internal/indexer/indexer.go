@@ -2,17 +2,26 @@ package indexer
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"etl-web3/internal/config"
+	"etl-web3/internal/metrics"
 	"etl-web3/internal/parser"
 	"etl-web3/internal/rpc"
 	"etl-web3/internal/sink"
+	"etl-web3/internal/transform"
 
 	"github.com/ethereum/go-ethereum"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/sirupsen/logrus"
 )
@@ -22,6 +31,16 @@ import (
 // the main config file later on.
 const DefaultChunkSize uint64 = 1_000
 
+// BlockRange is an inclusive [From, To] interval of blocks.
+type BlockRange struct {
+    From uint64 `json:"from"`
+    To   uint64 `json:"to"`
+}
+
+func (r BlockRange) String() string {
+    return fmt.Sprintf("%d→%d", r.From, r.To)
+}
+
 // Indexer orchestrates the end-to-end ETL process.
 // It is intentionally decoupled from concrete parser / sink implementations so
 // those components can evolve independently.
@@ -30,16 +49,56 @@ type Indexer struct {
     client    *rpc.Client
     sink      sink.Sink
     chunkSize uint64
+    // chunks sizes ranges by their distance to the head: catchup_chunk_size
+    // far from it, chunkSize near it.
+    chunks    chunkSizer
     parser    *parser.Parser
+    // transforms post-process every parsed event before it is written.
+    transforms transform.Chain
 
     // Filtering helpers
     filteredAddresses  []common.Address   // addresses with event filters applied
     unfilteredAddresses []common.Address  // addresses without filters (all events fetched)
     filteredTopics     []common.Hash      // precomputed topic0 hashes for the allowed events
+    anyAddressTopics   []common.Hash      // topic0 hashes scanned across all contracts (address-less entries)
+    restricted         []topicFilter      // events with indexed-value filters, one query each
+
+    // topicFilters and plainEvents let matchesTopics re-check fetched logs
+    // against the restricted events.
+    topicFilters map[topicKey][][]common.Hash
+    plainEvents  map[topicKey]struct{}
+
+    // excluded holds the exclude_addresses whose logs are dropped unparsed.
+    excluded map[common.Address]struct{}
 
     // Pre-computed helpers to speed things up during the scan loop.
     contractByAddress map[common.Address]config.ContractConfig // quick look-up
     addresses         []common.Address                         // slice reused in filter queries
+
+    // Run statistics used to build the end-of-run summary.
+    stats   *stats
+    summary *Summary
+
+    progress    progressTracker
+    checkpoints *checkpointWriter
+    // parseErrors records logs that fail to decode (nil: not configured);
+    // parseErrorCount counts them either way.
+    parseErrors     *parseErrorWriter
+    parseErrorCount atomic.Int64
+    // txSink, set when checkpointing into a transactional sink, receives
+    // every range in one transaction together with the checkpoint.
+    txSink sink.TransactionalSink
+    // progressLog throttles the per-range log lines into periodic summaries.
+    progressLog progressLog
+    // rates checks event volumes against expected_rate (nil: not configured).
+    rates *rateMonitor
+
+    // resumeAfter, when set, is where Run resumes if no checkpoint exists.
+    resumeAfter    uint64
+    hasResumeAfter bool
+
+    // noInlineTimestamps is set once inline_timestamps found none.
+    noInlineTimestamps atomic.Bool
 }
 
 // New constructs a fully-initialised Indexer.
@@ -48,6 +107,11 @@ type Indexer struct {
 // implementation so different configurations (e.g. mock sink for tests) can be
 // injected as needed.
 func New(cfg *config.Config, client *rpc.Client, sk sink.Sink) *Indexer {
+    // Entries listing several addresses become one contract per address.
+    expanded := *cfg
+    expanded.Contracts = config.ExpandAddresses(cfg.Contracts)
+    cfg = &expanded
+
     m := make(map[common.Address]config.ContractConfig, len(cfg.Contracts))
     addrs := make([]common.Address, 0, len(cfg.Contracts))
 
@@ -55,26 +119,38 @@ func New(cfg *config.Config, client *rpc.Client, sk sink.Sink) *Indexer {
     var filteredAddrs []common.Address
     var unfilteredAddrs []common.Address
     topicSet := make(map[common.Hash]struct{})
+    var anyAddrTopics []common.Hash
+    var restricted []topicFilter
+    topicFilters := make(map[topicKey][][]common.Hash)
+    plainEvents := make(map[topicKey]struct{})
 
     for _, c := range cfg.Contracts {
+        filters := eventTopicFilters(c)
+        restricted = append(restricted, filters...)
+        for _, f := range filters {
+            topicFilters[f.key] = f.topics
+        }
+
+        if c.Address == "" {
+            // Address-less entry: match its events on every contract.
+            anyAddrTopics = append(anyAddrTopics, eventTopics(c)...)
+            continue
+        }
+
         addr := common.HexToAddress(c.Address)
         m[addr] = c
         addrs = append(addrs, addr)
 
         if len(c.Events) > 0 {
-            filteredAddrs = append(filteredAddrs, addr)
-
             // Pre-compute topic0 (event signature hash) for every configured event name.
-            if c.ParsedABI != nil {
-                for _, evName := range c.Events {
-                    evDef, ok := c.ParsedABI.Events[evName]
-                    if !ok {
-                        // If event not found in ABI, panic is avoided; instead log and continue.
-                        logrus.Warnf("event '%s' not found in ABI for contract '%s'", evName, c.Name)
-                        continue
-                    }
-                    topicSet[evDef.ID] = struct{}{}
-                }
+            plain := eventTopics(c)
+            // A contract whose events are all restricted only needs their own queries.
+            if len(plain) > 0 || len(filters) == 0 {
+                filteredAddrs = append(filteredAddrs, addr)
+            }
+            for _, id := range plain {
+                topicSet[id] = struct{}{}
+                plainEvents[topicKey{address: addr, topic0: id}] = struct{}{}
             }
         } else {
             unfilteredAddrs = append(unfilteredAddrs, addr)
@@ -92,54 +168,242 @@ func New(cfg *config.Config, client *rpc.Client, sk sink.Sink) *Indexer {
     if size == 0 {
         size = DefaultChunkSize
     }
-    if cfg.StartBlock == 0 {
-        // Prevent infinite loops if start block is somehow zero in config.
-        cfg.StartBlock = 1
+    pr := parser.New(cfg, client)
+
+    // Samples and transforms were checked by config validation; a broken
+    // chain here means the config bypassed it. Sampling runs first so it
+    // sees the original event names.
+    transforms, err := transform.FromSamples(cfg.Contracts)
+    if err != nil {
+        logrus.Errorf("ignoring samples: %v", err)
     }
+    configured, err := transform.FromConfig(cfg.Transforms)
+    if err != nil {
+        logrus.Errorf("ignoring transforms: %v", err)
+    }
+    transforms = append(transforms, configured...)
 
-    pr := parser.New(cfg, client)
+    excluded := make(map[common.Address]struct{}, len(cfg.ExcludeAddresses))
+    for _, a := range cfg.ExcludeAddresses {
+        excluded[common.HexToAddress(a)] = struct{}{}
+    }
+
+    // With checkpointing enabled a transactional sink stores the checkpoint
+    // atomically with the rows; other sinks use the checkpoint file.
+    var txSink sink.TransactionalSink
+    if cfg.CheckpointFile != "" {
+        txSink, _ = sink.AsTransactional(sk)
+    }
 
-    return &Indexer{
+    idx := &Indexer{
         cfg:               cfg,
         client:            client,
         sink:              sk,
         chunkSize:         size,
+        chunks:            newChunkSizer(size, cfg.CatchupChunkSize, cfg.TipThreshold),
         contractByAddress: m,
         addresses:         addrs,
         parser:            pr,
+        transforms:        transforms,
+        excluded:          excluded,
 
         filteredAddresses:  filteredAddrs,
         unfilteredAddresses: unfilteredAddrs,
         filteredTopics:     topics,
+        anyAddressTopics:   anyAddrTopics,
+        restricted:         restricted,
+        topicFilters:       topicFilters,
+        plainEvents:        plainEvents,
+        stats:              newStats(),
+        rates:              newRateMonitor(cfg.Chain, cfg.Contracts),
+        parseErrors:        newParseErrorWriter(cfg.ParseErrorsFile),
+        progressLog:        progressLog{interval: DefaultProgressLogInterval},
+        txSink:             txSink,
+    }
+    if txSink == nil {
+        idx.checkpoints = newCheckpointWriter(cfg.CheckpointFile, cfg.Chain)
+    }
+    return idx
+}
+
+// eventTopics resolves the configured event names of a contract to their
+// topic0 hashes. Names missing from the ABI are logged and skipped, as are
+// events restricted by topics (see eventTopicFilters).
+func eventTopics(c config.ContractConfig) []common.Hash {
+    if c.ParsedABI == nil {
+        return nil
+    }
+    var ids []common.Hash
+    for _, evName := range c.Events {
+        if _, ok := c.Topics[evName]; ok {
+            continue
+        }
+        evDef, ok := config.LookupEvent(c.ParsedABI, evName)
+        if !ok {
+            // If event not found in ABI, panic is avoided; instead log and continue.
+            logrus.Warnf("event '%s' not found in ABI for contract '%s'", evName, c.Name)
+            continue
+        }
+        ids = append(ids, evDef.ID)
+    }
+    return ids
+}
+
+// AddTransformers appends transformers to the chain built from the config.
+// It must be called before Run.
+func (idx *Indexer) AddTransformers(ts ...transform.Transformer) {
+    idx.transforms = append(idx.transforms, ts...)
+}
+
+// OnProgress registers a callback invoked after every completed block range.
+// It must be set before Run is called.
+func (idx *Indexer) OnProgress(fn ProgressFunc) {
+    idx.progress.fn = fn
+}
+
+// ResumeAfter makes Run start after block (unless start_block is later) when
+// no checkpoint records the progress of a previous run, e.g. with the last
+// block found in the existing output. It must be set before Run is called.
+func (idx *Indexer) ResumeAfter(block uint64) {
+    idx.resumeAfter, idx.hasResumeAfter = block, true
+}
+
+// LogProgressEvery sets how often Run logs a progress summary (rates and
+// ETA) instead of one line per completed range, which is then logged at
+// debug level. Zero or less logs every range. It must be set before Run.
+func (idx *Indexer) LogProgressEvery(d time.Duration) {
+    idx.progressLog.interval = d
+}
+
+// Progress returns the latest progress snapshot of the current run.
+func (idx *Indexer) Progress() Progress {
+    return idx.progress.snapshot()
+}
+
+// Summary returns the report of the last completed run, or nil when Run has
+// not finished successfully yet.
+func (idx *Indexer) Summary() *Summary {
+    return idx.summary
+}
+
+// clipRanges returns ranges restricted to [from, to], sorted and merged so
+// they are disjoint and not adjacent.
+func clipRanges(ranges []BlockRange, from, to uint64) []BlockRange {
+    var out []BlockRange
+    for _, r := range ranges {
+        r.From, r.To = max(r.From, from), min(r.To, to)
+        if r.From <= r.To {
+            out = append(out, r)
+        }
     }
+    sort.Slice(out, func(i, j int) bool { return out[i].From < out[j].From })
+    merged := out[:0]
+    for _, r := range out {
+        if n := len(merged); n > 0 && r.From <= merged[n-1].To+1 {
+            merged[n-1].To = max(merged[n-1].To, r.To)
+            continue
+        }
+        merged = append(merged, r)
+    }
+    return merged
+}
+
+// endBlock returns the last block of the run: the configured end_block, or
+// head when it is unset or beyond it.
+func (idx *Indexer) endBlock(head uint64) uint64 {
+    if idx.cfg.EndBlock == nil {
+        return head
+    }
+    return min(idx.cfg.EndBlock.Resolve(head), head)
 }
 
 // Run starts the indexing loop and blocks until the context is cancelled or an
 // unrecoverable error is returned.
 func (idx *Indexer) Run(ctx context.Context) error {
+    defer idx.parseErrors.close()
+
     // Fetch latest block number (cheap RPC) so we know up to where we need to scan.
     latest, err := idx.client.LatestBlockNumber(ctx)
     if err != nil {
         return err
     }
 
-    startFrom := idx.cfg.StartBlock
+    // Head-relative start blocks ("latest-N") are resolved now.
+    startFrom := idx.cfg.StartBlock.Resolve(latest)
+    checkpointed := false
+    var completed []BlockRange
+    if idx.cfg.CheckpointFile != "" {
+        block, ok, done, err := idx.loadCheckpoint(ctx)
+        if err != nil {
+            return err
+        }
+        checkpointed, completed = ok, done
+        if ok && block+1 > startFrom {
+            startFrom = ResumeStart(startFrom, block, idx.cfg.ReindexOverlap)
+            logrus.Infof("Resuming after checkpoint block %d from block %d", block, startFrom)
+        }
+    }
+    if !checkpointed && idx.hasResumeAfter && idx.resumeAfter+1 > startFrom {
+        startFrom = ResumeStart(startFrom, idx.resumeAfter, idx.cfg.ReindexOverlap)
+        logrus.Infof("Resuming after block %d found in the existing output from block %d", idx.resumeAfter, startFrom)
+    }
+    ranges, _, err := sink.CompletedRanges(idx.sink)
+    if err != nil {
+        return fmt.Errorf("failed to read completed ranges from sink: %w", err)
+    }
+    for _, r := range ranges {
+        completed = append(completed, BlockRange{From: r.From, To: r.To})
+    }
+    // Head-relative ends resolve against the real head as well.
+    head := latest
+    latest = idx.endBlock(latest)
+    if startFrom > latest {
+        logrus.Infof("Nothing to index: start block %d is beyond head %d", startFrom, latest)
+        if idx.cfg.Follow {
+            return idx.follow(ctx, startFrom)
+        }
+        return nil
+    }
+    startedAt := time.Now()
+    idx.progress.start(startFrom, latest)
+    // Ranges a previous run completed are not scanned again.
+    skipped := clipRanges(completed, startFrom, latest)
+    if len(skipped) > 0 {
+        var blocks uint64
+        for _, r := range skipped {
+            blocks += r.To - r.From + 1
+        }
+        logrus.Infof("Skipping %d block(s) in %d range(s) already indexed by a previous run", blocks, len(skipped))
+        idx.progress.skip(skipped)
+    }
 
-    logrus.Infof("Starting indexer | from=%d latest=%d chunkSize=%d workers=%d", startFrom, latest, idx.chunkSize, idx.cfg.Workers)
+    logrus.Infof("Starting indexer | from=%d latest=%d chunkSize=%d catchupChunkSize=%d workers=%d", startFrom, latest, idx.chunkSize, idx.chunks.catchup, idx.cfg.Workers)
 
     // Prepare jobs for workers
     type job struct{ from, to uint64 }
-    jobs := make(chan job, idx.cfg.Workers*2)
+    queueDepth := idx.cfg.QueueDepth
+    if queueDepth <= 0 {
+        queueDepth = idx.cfg.Workers * 2
+    }
+    jobs := make(chan job, queueDepth)
     errCh := make(chan error, idx.cfg.Workers)
 
     // Derive a cancellable context for early termination on first error
     wctx, cancel := context.WithCancel(ctx)
     defer cancel()
 
+    // In continue mode failing ranges are collected instead of aborting.
+    continueOnError := idx.cfg.OnError == config.OnErrorContinue
+    var (
+        failedMu sync.Mutex
+        failed   []BlockRange
+    )
+
     var wg sync.WaitGroup
     worker := func() {
         defer wg.Done()
         for j := range jobs {
+            metrics.AddIndexerQueued(idx.cfg.Chain, -1)
             select {
             case <-wctx.Done():
                 return
@@ -148,6 +412,15 @@ func (idx *Indexer) Run(ctx context.Context) error {
 
             startTs := time.Now()
             evCount, err := idx.processRange(wctx, j.from, j.to)
+            // A node without tracing fails every range alike, so it aborts
+            // the run even in continue mode.
+            if err != nil && continueOnError && wctx.Err() == nil && !errors.Is(err, rpc.ErrTracesUnsupported) {
+                logrus.Errorf("[FAILED] Block %d → %d: %v", j.from, j.to, err)
+                failedMu.Lock()
+                failed = append(failed, BlockRange{From: j.from, To: j.to})
+                failedMu.Unlock()
+                continue
+            }
             if err != nil {
                 // Notify first error and cancel the rest
                 select {
@@ -157,8 +430,10 @@ func (idx *Indexer) Run(ctx context.Context) error {
                 cancel()
                 return
             }
-            elapsed := time.Since(startTs).Seconds()
-            logrus.Infof("[OK] Block %d → %d | Events: %d | Time: %.2fs", j.from, j.to, evCount, elapsed)
+            idx.progress.rangeDone(j.from, j.to, evCount)
+            idx.rates.rangeDone(j.from, j.to)
+            idx.progressLog.rangeDone(idx.progress.snapshot(), j.from, j.to, evCount, time.Since(startTs))
+            idx.saveCheckpoint(false)
         }
     }
 
@@ -169,18 +444,44 @@ func (idx *Indexer) Run(ctx context.Context) error {
     }
 
     // Enqueue jobs
+    next := 0 // first skipped range not behind from
 enqueue:
     for from := startFrom; from <= latest; {
-        to := from + idx.chunkSize - 1
-        if to > latest {
+        for next < len(skipped) && skipped[next].To < from {
+            next++
+        }
+        if next < len(skipped) && skipped[next].From <= from {
+            if skipped[next].To >= latest {
+                break
+            }
+            from = skipped[next].To + 1
+            continue
+        }
+        to := from + idx.chunks.size(from, head) - 1
+        if to > latest || to < from {
             to = latest
         }
+        // Chunks end where a skipped range begins.
+        if next < len(skipped) && skipped[next].From <= to {
+            to = skipped[next].From - 1
+        }
         j := job{from: from, to: to}
+        metrics.AddIndexerQueued(idx.cfg.Chain, 1)
         select {
-        case <-wctx.Done():
-            break enqueue
         case jobs <- j:
+        default:
+            // Queue full: workers are the bottleneck.
+            blockedAt := time.Now()
+            select {
+            case <-wctx.Done():
+                metrics.AddIndexerQueued(idx.cfg.Chain, -1)
+                break enqueue
+            case jobs <- j:
+            }
+            metrics.AddIndexerEnqueueBlocked(idx.cfg.Chain, time.Since(blockedAt))
         }
+        // Stop on the last range rather than relying on from <= latest, so
+        // no range is repeated whatever the start block (including genesis).
         if to == latest {
             break
         }
@@ -190,83 +491,586 @@ enqueue:
 
     // Wait for workers to finish
     wg.Wait()
+    // Also after errors and interruptions, so the next run resumes.
+    idx.saveCheckpoint(true)
+
+    // Ranges left behind by workers that stopped early are no longer queued.
+    for range jobs {
+        metrics.AddIndexerQueued(idx.cfg.Chain, -1)
+    }
 
     // Return first error if any
     select {
     case e := <-errCh:
         return e
     default:
+    }
+
+    // Interrupted runs did not cover the full range, so no summary is produced.
+    if ctx.Err() != nil {
         return nil
     }
+
+    if len(failed) > 0 && idx.cfg.RetryFailedRanges {
+        failed = idx.retryRanges(ctx, failed)
+        if ctx.Err() != nil {
+            return nil
+        }
+    }
+
+    if err := idx.finish(ctx, startFrom, latest, startedAt, failed); err != nil {
+        return err
+    }
+    if len(failed) > 0 {
+        parts := make([]string, len(failed))
+        for i, r := range failed {
+            parts[i] = r.String()
+        }
+        return fmt.Errorf("%d block range(s) failed: %s", len(failed), strings.Join(parts, ", "))
+    }
+
+    if idx.cfg.Follow {
+        return idx.follow(ctx, latest+1)
+    }
+    return nil
+}
+
+// retryRanges re-processes the given ranges sequentially and returns those
+// that failed again. Events written before the original failure may be
+// written a second time.
+func (idx *Indexer) retryRanges(ctx context.Context, ranges []BlockRange) []BlockRange {
+    logrus.Infof("Retrying %d failed block range(s)", len(ranges))
+
+    var still []BlockRange
+    for _, r := range ranges {
+        if ctx.Err() != nil {
+            return append(still, r)
+        }
+        evCount, err := idx.processRange(ctx, r.From, r.To)
+        if err != nil {
+            logrus.Errorf("[FAILED] Block %d → %d (retry): %v", r.From, r.To, err)
+            still = append(still, r)
+            continue
+        }
+        logrus.Infof("[OK] Block %d → %d (retry) | Events: %d", r.From, r.To, evCount)
+        idx.progress.rangeDone(r.From, r.To, evCount)
+        idx.rates.rangeDone(r.From, r.To)
+    }
+    idx.saveCheckpoint(true)
+    return still
+}
+
+// ResumeStart returns the first block to index when resuming after block
+// after: after+1 rewound by overlap blocks, but never before start.
+func ResumeStart(start, after, overlap uint64) uint64 {
+    from := after + 1
+    if from < start {
+        return start
+    }
+    if overlap > from-start {
+        return start
+    }
+    return from - overlap
+}
+
+// saveCheckpoint writes the progress checkpoint to the checkpoint file, if
+// configured. Without force writes are throttled. Transactional sinks get
+// the checkpoint with each range; forced saves (only made while no range is
+// in flight) commit the final position.
+func (idx *Indexer) saveCheckpoint(force bool) {
+    block, ok := idx.progress.checkpoint()
+    if !ok {
+        return
+    }
+    if idx.txSink == nil {
+        completed := idx.progress.completed()
+        if !idx.checkpoints.due(block, completed, force) {
+            return
+        }
+        // The events the checkpoint covers may still be buffered by the
+        // sink (CSV flush_rows, BigQuery batches); they must be stored
+        // before a resume skips them.
+        if err := sink.Flush(idx.sink); err != nil {
+            logrus.Warnf("checkpoint not advanced to block %d: flushing the sink failed: %v", block, err)
+            return
+        }
+        idx.checkpoints.update(block, completed, force)
+        return
+    }
+    if force {
+        if err := idx.commitCheckpoint(block); err != nil {
+            logrus.Warnf("failed to store checkpoint: %v", err)
+        }
+    }
+}
+
+// finish builds the run summary and, for file-based sinks, writes it as a
+// manifest next to the generated output.
+func (idx *Indexer) finish(ctx context.Context, from, to uint64, startedAt time.Time, failed []BlockRange) error {
+    finishedAt := time.Now()
+    sum := &Summary{
+        StartBlock:      from,
+        EndBlock:        to,
+        StartedAt:       startedAt,
+        FinishedAt:      finishedAt,
+        DurationSeconds: finishedAt.Sub(startedAt).Seconds(),
+        FailedRanges:    failed,
+    }
+    idx.stats.snapshot(sum)
+    if n := idx.parser.TimestampErrors(); n > 0 {
+        sum.Warnings = map[string]int{"timestamp_error": int(n)}
+        logrus.Warnf("%d event(s) written without timestamp (block header fetch failed), flagged with timestamp_error", n)
+    }
+    if n := idx.rates.alertCount(); n > 0 {
+        if sum.Warnings == nil {
+            sum.Warnings = make(map[string]int)
+        }
+        sum.Warnings["event_rate"] = n
+    }
+    if n := idx.parseErrorCount.Load(); n > 0 {
+        if sum.Warnings == nil {
+            sum.Warnings = make(map[string]int)
+        }
+        sum.Warnings["parse_error"] = int(n)
+        if idx.cfg.ParseErrorsFile != "" {
+            logrus.Warnf("%d log(s) could not be decoded, recorded in %s", n, idx.cfg.ParseErrorsFile)
+        } else {
+            logrus.Warnf("%d log(s) could not be decoded and were skipped (set parse_errors_file to keep them)", n)
+        }
+    }
+
+    if id, err := idx.client.GetChainID(ctx); err == nil {
+        sum.ChainID = id.String()
+    } else {
+        logrus.Warnf("failed to fetch chain id for manifest: %v", err)
+    }
+
+    idx.summary = sum
+    logrus.Infof("Run complete | blocks=%d→%d events=%d duration=%.2fs", from, to, sum.TotalEvents, sum.DurationSeconds)
+
+    if idx.cfg.Storage.Type == "csv" {
+        return writeManifest(idx.cfg.Storage.CSV.OutputDir, sum)
+    }
+    return nil
 }
 
 // processRange fetches, parses and persists logs within the [from, to] block
 // interval (inclusive). It returns the number of events successfully written to
 // the sink.
 func (idx *Indexer) processRange(ctx context.Context, from, to uint64) (int, error) {
-    var logs []types.Log
-
-    // 1. Addresses with explicit event filters
-    if len(idx.filteredAddresses) > 0 {
-        if len(idx.filteredTopics) == 0 {
-            // No valid topics resolved; treat as unfiltered to avoid empty filter resulting in no logs.
-            query := ethereum.FilterQuery{
-                FromBlock: big.NewInt(int64(from)),
-                ToBlock:   big.NewInt(int64(to)),
-                Addresses: idx.filteredAddresses,
-            }
-            lgs, err := idx.client.GetLogs(ctx, query)
-            if err != nil {
-                return 0, err
-            }
-            logs = append(logs, lgs...)
+    logs, err := idx.fetchLogs(ctx, from, to)
+    if err != nil {
+        return 0, err
+    }
+    // Some providers, or a reorg during the call, return logs outside the
+    // requested blocks; writing them would break checkpointing and dedupe.
+    logs, dropped := filterBlockRange(logs, from, to)
+    if dropped > 0 {
+        logrus.Warnf("Discarded %d logs outside requested range %d→%d", dropped, from, to)
+    }
+    // The checkpoint records the hash of the block it reaches, as indexed,
+    // so a resume can tell whether it was reorged in between.
+    if idx.checkpoints != nil {
+        hash, err := idx.rangeEndHash(ctx, to, logs)
+        if err != nil {
+            logrus.Warnf("failed to fetch hash of block %d: %v", to, err)
         } else {
-            query := ethereum.FilterQuery{
-                FromBlock: big.NewInt(int64(from)),
-                ToBlock:   big.NewInt(int64(to)),
-                Addresses: idx.filteredAddresses,
-                Topics:    [][]common.Hash{idx.filteredTopics},
-            }
-            lgs, err := idx.client.GetLogs(ctx, query)
+            idx.checkpoints.rangeHash(to, hash)
+        }
+    }
+    logs = idx.dropUnwanted(logs)
+
+    // Fast path for quiet ranges, the common case on most chains: nothing to
+    // parse or write. The caller still records the range as done, which
+    // advances the checkpoint. Transactional sinks keep their transaction,
+    // as it carries the checkpoint.
+    if len(logs) == 0 && !idx.cfg.IndexBlocks && !idx.cfg.IndexTraces && idx.txSink == nil {
+        return 0, nil
+    }
+
+    if idx.txSink != nil {
+        return idx.writeRangeTx(ctx, from, to, logs)
+    }
+    return idx.writeRange(ctx, idx.sink, from, to, logs)
+}
+
+// writeRange persists the logs of [from, to], and the block and trace
+// records when enabled, to out.
+func (idx *Indexer) writeRange(ctx context.Context, out sink.Sink, from, to uint64, logs []types.Log) (int, error) {
+    eventsWritten, err := idx.writeLogs(ctx, out, logs)
+    if err != nil {
+        return eventsWritten, err
+    }
+
+    if idx.cfg.IndexBlocks {
+        if err := idx.writeBlocks(ctx, out, from, to); err != nil {
+            return eventsWritten, err
+        }
+    }
+    if idx.cfg.IndexTraces {
+        if err := idx.writeTraces(ctx, out, from, to); err != nil {
+            return eventsWritten, err
+        }
+    }
+
+    return eventsWritten, nil
+}
+
+// fetchLogs runs the filter queries over [from, to], paged into sub-ranges of
+// at most max_rpc_range blocks when the cap is set.
+func (idx *Indexer) fetchLogs(ctx context.Context, from, to uint64) ([]types.Log, error) {
+    var logs []types.Log
+    for _, page := range pageRange(from, to, idx.cfg.MaxRPCRange) {
+        for _, query := range idx.filterQueries(new(big.Int).SetUint64(page.From), new(big.Int).SetUint64(page.To)) {
+            lgs, err := idx.getLogs(ctx, query)
             if err != nil {
-                return 0, err
+                return nil, err
             }
             logs = append(logs, lgs...)
         }
     }
+    return logs, nil
+}
 
-    // 2. Addresses without filters (fetch all events)
-    if len(idx.unfilteredAddresses) > 0 {
-        query := ethereum.FilterQuery{
-            FromBlock: big.NewInt(int64(from)),
-            ToBlock:   big.NewInt(int64(to)),
-            Addresses: idx.unfilteredAddresses,
+// getLogs runs one filter query. With inline_timestamps the blockTimestamp
+// returned with the logs seeds the parser's timestamp cache; if the provider
+// does not return it the header is fetched as usual, which is logged once.
+func (idx *Indexer) getLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+    if !idx.cfg.InlineTimestamps {
+        return idx.client.GetLogs(ctx, query)
+    }
+    logs, timestamps, err := idx.client.GetLogsWithTimestamps(ctx, query)
+    if err != nil {
+        return nil, err
+    }
+    for block, ts := range timestamps {
+        idx.parser.SetTimestamp(block, ts)
+    }
+    if len(logs) > 0 && len(timestamps) == 0 && idx.noInlineTimestamps.CompareAndSwap(false, true) {
+        logrus.Warnf("inline_timestamps is set but the RPC returned logs without blockTimestamp; fetching block headers instead")
+    }
+    return logs, nil
+}
+
+// pageRange splits [from, to] into consecutive ranges of at most size blocks.
+// A size of 0 returns the whole range.
+func pageRange(from, to, size uint64) []BlockRange {
+    if size == 0 || to-from < size {
+        return []BlockRange{{From: from, To: to}}
+    }
+    var pages []BlockRange
+    for start := from; ; start += size {
+        end := start + size - 1
+        if end >= to || end < start { // end < start: overflow near MaxUint64
+            return append(pages, BlockRange{From: start, To: to})
         }
-        lgs, err := idx.client.GetLogs(ctx, query)
+        pages = append(pages, BlockRange{From: start, To: end})
+    }
+}
+
+// dropUnwanted removes, in place, the logs rejected by wanted.
+func (idx *Indexer) dropUnwanted(logs []types.Log) []types.Log {
+    if len(idx.excluded) == 0 && len(idx.topicFilters) == 0 {
+        return logs
+    }
+    kept := logs[:0]
+    for i := range logs {
+        if idx.wanted(&logs[i]) {
+            kept = append(kept, logs[i])
+        }
+    }
+    if n := len(logs) - len(kept); n > 0 {
+        logrus.Debugf("Dropped %d logs from excluded addresses or not matching topics", n)
+    }
+    return kept
+}
+
+// wanted reports whether lg is neither emitted by an excluded address nor
+// rejected by the topic filter of its event.
+func (idx *Indexer) wanted(lg *types.Log) bool {
+    if _, ok := idx.excluded[lg.Address]; ok {
+        return false
+    }
+    return idx.matchesTopics(lg)
+}
+
+// filterBlockRange keeps the logs whose block number lies within [from, to],
+// filtering in place. It returns the kept logs and the number discarded.
+func filterBlockRange(logs []types.Log, from, to uint64) ([]types.Log, int) {
+    kept := logs[:0]
+    for _, lg := range logs {
+        if lg.BlockNumber >= from && lg.BlockNumber <= to {
+            kept = append(kept, lg)
+        }
+    }
+    return kept, len(logs) - len(kept)
+}
+
+// ProcessBlockHash fetches, parses and persists the logs of the single block
+// identified by hash. Matching by hash rather than number makes it suitable for
+// reprocessing a specific block, e.g. the canonical replacement after a reorg.
+// It returns the number of events written to the sink.
+func (idx *Indexer) ProcessBlockHash(ctx context.Context, hash common.Hash) (int, error) {
+    var logs []types.Log
+    for _, query := range idx.filterQueries(nil, nil) {
+        lgs, err := idx.client.GetLogsByBlockHash(ctx, hash, query.Addresses, query.Topics)
         if err != nil {
             return 0, err
         }
         logs = append(logs, lgs...)
     }
+    logs = idx.dropUnwanted(logs)
+    logrus.Infof("Processing block %s | logs=%d", hash.Hex(), len(logs))
+    return idx.writeLogs(ctx, idx.sink, logs)
+}
+
+// writeLogs parses logs and persists the resulting events to out in order.
+// It returns the number of events written before the first sink error.
+func (idx *Indexer) writeLogs(ctx context.Context, out sink.Sink, logs []types.Log) (int, error) {
+    events := idx.parseLogs(ctx, logs)
 
     eventsWritten := 0
-    for _, lg := range logs {
-        evt, err := idx.parser.Parse(ctx, &lg)
-        if err != nil {
-            // Non-fatal: continue processing other logs but report at debug level.
-            logrus.Debugf("failed to parse log | block=%d tx=%s err=%v", lg.BlockNumber, lg.TxHash.Hex(), err)
+    for i := range logs {
+        if events[i] == nil {
             continue
         }
+        written, err := idx.writeEvent(out, &logs[i], events[i])
+        if err != nil {
+            // Propagate error so higher-level retry mechanism can kick in.
+            return eventsWritten, err
+        }
+        if written {
+            eventsWritten++
+        }
+    }
+    return eventsWritten, nil
+}
+
+// filterQueries builds the log filters covering every configured contract for
+// the [from, to] interval. Nil bounds leave the query open, as used by the
+// follow-mode subscription.
+func (idx *Indexer) filterQueries(from, to *big.Int) []ethereum.FilterQuery {
+    var queries []ethereum.FilterQuery
+
+    // 1. Addresses with explicit event filters
+    if len(idx.filteredAddresses) > 0 {
+        query := ethereum.FilterQuery{
+            FromBlock: from,
+            ToBlock:   to,
+            Addresses: idx.filteredAddresses,
+        }
+        // No valid topics resolved; treat as unfiltered to avoid empty filter resulting in no logs.
+        if len(idx.filteredTopics) > 0 {
+            query.Topics = [][]common.Hash{idx.filteredTopics}
+        }
+        queries = append(queries, query)
+    }
 
-        if idx.sink != nil {
-            if err := idx.sink.Write(evt); err != nil {
-                // Propagate error so higher-level retry mechanism can kick in.
-                return eventsWritten, err
+    // 2. Addresses without filters (fetch all events)
+    if len(idx.unfilteredAddresses) > 0 {
+        queries = append(queries, ethereum.FilterQuery{
+            FromBlock: from,
+            ToBlock:   to,
+            Addresses: idx.unfilteredAddresses,
+        })
+    }
+
+    // 3. Events restricted by indexed values, each with its own topic matrix
+    for _, f := range idx.restricted {
+        query := ethereum.FilterQuery{
+            FromBlock: from,
+            ToBlock:   to,
+            Topics:    f.matrix(),
+        }
+        if f.key.address != (common.Address{}) {
+            query.Addresses = []common.Address{f.key.address}
+        }
+        queries = append(queries, query)
+    }
+
+    // 4. Address-less entries (topic0 only, any emitting contract)
+    if len(idx.anyAddressTopics) > 0 {
+        queries = append(queries, anyAddressQuery(from, to, idx.anyAddressTopics))
+    }
+
+    return queries
+}
+
+// parseLogs parses (and enriches) logs with up to EnrichWorkers concurrent
+// parser calls. Events keep the order of logs; a nil entry marks a log that
+// failed to parse.
+func (idx *Indexer) parseLogs(ctx context.Context, logs []types.Log) []sink.Event {
+    events := make([]sink.Event, len(logs))
+    workers := idx.cfg.EnrichWorkers
+    if workers > len(logs) {
+        workers = len(logs)
+    }
+    if workers <= 1 {
+        for i := range logs {
+            events[i] = idx.parseLog(ctx, &logs[i])
+        }
+        return events
+    }
+
+    next := make(chan int)
+    var wg sync.WaitGroup
+    for w := 0; w < workers; w++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for i := range next {
+                events[i] = idx.parseLog(ctx, &logs[i])
             }
+        }()
+    }
+    for i := range logs {
+        next <- i
+    }
+    close(next)
+    wg.Wait()
+    return events
+}
+
+// parseLog returns the parsed event of lg, or nil when it cannot be decoded.
+func (idx *Indexer) parseLog(ctx context.Context, lg *types.Log) sink.Event {
+    evt, err := idx.parser.Parse(ctx, lg)
+    if err != nil {
+        // Non-fatal: continue processing other logs but report at debug level.
+        logrus.Debugf("failed to parse log | block=%d tx=%s err=%v", lg.BlockNumber, lg.TxHash.Hex(), err)
+        idx.parseErrorCount.Add(1)
+        idx.parseErrors.record(lg, err)
+        return nil
+    }
+    return evt
+}
+
+// writeLog parses a log and hands the event to the sink. It reports whether
+// an event was written; logs that fail to parse are skipped.
+func (idx *Indexer) writeLog(ctx context.Context, lg *types.Log) (bool, error) {
+    evt := idx.parseLog(ctx, lg)
+    if evt == nil {
+        return false, nil
+    }
+    return idx.writeEvent(idx.sink, lg, evt)
+}
+
+// writeEvent hands the parsed event of lg to out. Logs removed by a reorg
+// are retracted through sink.Remove instead.
+func (idx *Indexer) writeEvent(out sink.Sink, lg *types.Log, evt sink.Event) (bool, error) {
+    contract, _ := evt["contract_name"].(string)
+    name, _ := evt["event_name"].(string)
+
+    evt, err := idx.transforms.Transform(evt)
+    if err != nil {
+        return false, fmt.Errorf("transform failed | block=%d tx=%s: %w", lg.BlockNumber, lg.TxHash.Hex(), err)
+    }
+    if evt == nil {
+        // Dropped by a transformer.
+        if !lg.Removed {
+            idx.rates.record(contract, name, lg.BlockNumber)
         }
+        return false, nil
+    }
 
-        eventsWritten++
+    if out != nil {
+        if lg.Removed {
+            err = sink.Remove(out, evt)
+        } else {
+            err = out.Write(evt)
+        }
+        if err != nil {
+            return false, err
+        }
     }
 
-    return eventsWritten, nil
-} 
\ No newline at end of file
+    if !lg.Removed {
+        idx.stats.record(evt)
+        idx.rates.record(contract, name, lg.BlockNumber)
+    }
+    return true, nil
+}
+
+// writeBlocks emits one synthetic "block" record per block in [from, to] so
+// per-block metadata is available even for ranges without matching logs.
+func (idx *Indexer) writeBlocks(ctx context.Context, out sink.Sink, from, to uint64) error {
+    if out == nil {
+        return nil
+    }
+    for n := from; n <= to; n++ {
+        hdr, err := idx.client.GetHeaderByNumber(ctx, new(big.Int).SetUint64(n))
+        if err != nil {
+            return err
+        }
+
+        evt := sink.Event{
+            "event_name":   sink.BlockEventName,
+            "block_number": n,
+            "block_hash":   hdr.Hash().Hex(),
+            "parent_hash":  hdr.ParentHash.Hex(),
+            "timestamp":    hdr.Time,
+            "miner":        hdr.Coinbase.Hex(),
+            "gas_used":     hdr.GasUsed,
+            "gas_limit":    hdr.GasLimit,
+            "base_fee":     "",
+        }
+        if idx.cfg.Chain != "" {
+            evt["chain"] = idx.cfg.Chain
+        }
+        // Pre-London blocks have no base fee.
+        if hdr.BaseFee != nil {
+            evt["base_fee"] = hdr.BaseFee.String()
+        }
+
+        if err := out.Write(evt); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// writeTraces emits one synthetic "trace" record per call frame of every
+// transaction in [from, to], internal calls included.
+func (idx *Indexer) writeTraces(ctx context.Context, out sink.Sink, from, to uint64) error {
+    if out == nil {
+        return nil
+    }
+    for n := from; n <= to; n++ {
+        traces, err := idx.client.TraceBlock(ctx, n)
+        if err != nil {
+            return fmt.Errorf("index_traces: %w", err)
+        }
+        for _, t := range traces {
+            addr := make([]string, len(t.TraceAddress))
+            for i, a := range t.TraceAddress {
+                addr[i] = strconv.Itoa(a)
+            }
+            evt := sink.Event{
+                "event_name":    sink.TraceEventName,
+                "block_number":  n,
+                "tx_hash":       t.TxHash.Hex(),
+                "tx_index":      t.TxIndex,
+                // Dot-separated path in the call tree, empty for the top-level call.
+                "trace_address": strings.Join(addr, "."),
+                "type":          t.Type,
+                "from":          t.From.Hex(),
+                "to":            "",
+                "value":         "0",
+                "input":         hexutil.Encode(t.Input),
+                "error":         t.Error,
+            }
+            if idx.cfg.Chain != "" {
+                evt["chain"] = idx.cfg.Chain
+            }
+            if t.Value != nil {
+                evt["value"] = t.Value.String()
+            }
+            if t.To != nil {
+                evt["to"] = t.To.Hex()
+            }
+            if err := out.Write(evt); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
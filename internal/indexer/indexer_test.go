@@ -0,0 +1,543 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+	"etl-web3/internal/transform"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func TestRunFromGenesisIncludesBlockZero(t *testing.T) {
+    node := newFakeNode(t, 25, transferLog(0, 0, 1), transferLog(1, 0, 2), transferLog(25, 0, 3))
+    cfg := testConfig(t, 0)
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    got := out.blocks()
+    if len(got) != 3 || got[0] != 0 || got[1] != 1 || got[2] != 25 {
+        t.Fatalf("written blocks = %v, want [0 1 25]", got)
+    }
+    if cfg.StartBlock.Number != 0 {
+        t.Errorf("Run changed the caller's start_block to %d", cfg.StartBlock.Number)
+    }
+}
+
+func TestQuietRangesAdvanceCheckpoint(t *testing.T) {
+    node := newFakeNode(t, 45, transferLog(3, 0, 1))
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = t.TempDir() + "/checkpoint.json"
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 1 || got[0] != 3 {
+        t.Fatalf("written blocks = %v, want [3]", got)
+    }
+    cp, err := readCheckpoint(cfg.CheckpointFile)
+    if err != nil || cp == nil || cp.Block != 45 {
+        t.Fatalf("checkpoint = %+v (%v), want block 45", cp, err)
+    }
+}
+
+// queueOccupancy reads the indexer_queue_occupancy gauge of chain.
+func queueOccupancy(chain string) int64 {
+    v, _ := expvar.Get("indexer_queue_occupancy").(*expvar.Map).Get(chain).(*expvar.Int)
+    if v == nil {
+        return 0
+    }
+    return v.Value()
+}
+
+func TestQueueOccupancyGauge(t *testing.T) {
+    node := newFakeNode(t, 99)
+    release := make(chan struct{})
+    var once sync.Once
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        // The only worker stalls on the first range while ranges queue up.
+        once.Do(func() { <-release })
+        return nil, nil
+    }
+    cfg := testConfig(t, 0)
+    cfg.Chain = t.Name()
+    cfg.QueueDepth = 3
+
+    done := make(chan error, 1)
+    go func() { done <- New(cfg, node.dial(t), &memorySink{}).Run(context.Background()) }()
+
+    // Three ranges fill the queue; the enqueuer holds a fourth.
+    waitFor(t, "a full queue", func() bool { return queueOccupancy(cfg.Chain) >= 3 })
+    time.Sleep(20 * time.Millisecond)
+    if got := queueOccupancy(cfg.Chain); got > 4 {
+        t.Errorf("occupancy = %d with queue_depth 3", got)
+    }
+    close(release)
+    if err := <-done; err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := queueOccupancy(cfg.Chain); got != 0 {
+        t.Errorf("occupancy after the run = %d, want 0", got)
+    }
+}
+
+// BenchmarkProcessEmptyRange measures the throughput of ranges without logs,
+// the common case on quiet chains.
+func BenchmarkProcessEmptyRange(b *testing.B) {
+    node := newFakeNode(b, 1_000_000)
+    idx := New(testConfig(b, 0), node.dial(b), &memorySink{})
+    ctx := context.Background()
+
+    b.ReportAllocs()
+    b.ResetTimer()
+    for i := 0; i < b.N; i++ {
+        from := uint64(i%100_000) * 10
+        if _, err := idx.processRange(ctx, from, from+9); err != nil {
+            b.Fatal(err)
+        }
+    }
+}
+
+func TestRunFromLatestMinusN(t *testing.T) {
+    node := newFakeNode(t, 25, transferLog(14, 0, 1), transferLog(15, 0, 2), transferLog(25, 0, 3))
+    cfg := testConfig(t, 0)
+    cfg.StartBlock = config.BlockRef{Number: 10, FromLatest: true}
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 15 || got[1] != 25 {
+        t.Fatalf("written blocks = %v, want [15 25]", got)
+    }
+}
+
+func TestInlineTimestampsSkipHeaderFetch(t *testing.T) {
+    node := newFakeNode(t, 30, transferLog(5, 0, 1), transferLog(5, 1, 2), transferLog(12, 0, 3), transferLog(25, 0, 4))
+    // Block 12 comes without a blockTimestamp and falls back to its header.
+    node.inlineTimestamps = map[uint64]uint64{5: 555, 25: 2525}
+    cfg := testConfig(t, 0)
+    cfg.InlineTimestamps = true
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    want := map[uint64]uint64{5: 555, 12: header(12, 0).Time, 25: 2525}
+    events := out.written()
+    if len(events) != 4 {
+        t.Fatalf("wrote %d events, want 4", len(events))
+    }
+    for _, evt := range events {
+        block := evt["block_number"].(uint64)
+        if evt["timestamp"] != want[block] {
+            t.Errorf("timestamp of block %d = %v, want %d", block, evt["timestamp"], want[block])
+        }
+    }
+    for block, fetched := range map[uint64]bool{5: false, 12: true, 25: false} {
+        if got := node.headerCount(block) > 0; got != fetched {
+            t.Errorf("header of block %d fetched = %v, want %v", block, got, fetched)
+        }
+    }
+}
+
+func TestInlineTimestampsDisabledIgnoresThem(t *testing.T) {
+    node := newFakeNode(t, 30, transferLog(5, 0, 1))
+    node.inlineTimestamps = map[uint64]uint64{5: 555}
+    out := &memorySink{}
+
+    if err := New(testConfig(t, 0), node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if events := out.written(); len(events) != 1 || events[0]["timestamp"] != header(5, 0).Time {
+        t.Fatalf("events = %v, want the header timestamp", events)
+    }
+    if node.headerCount(5) == 0 {
+        t.Fatal("header of block 5 not fetched")
+    }
+}
+
+func TestUnlistedEventsAreNotWritten(t *testing.T) {
+    parsed, err := abi.JSON(strings.NewReader(strings.TrimSuffix(transferABI, "]") + `,
+    {"anonymous":false,"type":"event","name":"Approval","inputs":[
+    {"indexed":true,"name":"owner","type":"address"},
+    {"indexed":true,"name":"spender","type":"address"},
+    {"indexed":false,"name":"value","type":"uint256"}]}]`))
+    if err != nil {
+        t.Fatal(err)
+    }
+    approval := transferLog(7, 1, 5)
+    approval.Topics[0] = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+    node := newFakeNode(t, 10)
+    // The node ignores the topic filter, as some providers do.
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        if from > 7 || to < 7 {
+            return nil, nil
+        }
+        return []types.Log{transferLog(7, 0, 1), approval}, nil
+    }
+    cfg := testConfig(t, 0)
+    cfg.Contracts[0].ParsedABI = &parsed
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    events := out.written()
+    if len(events) != 1 || events[0]["event_name"] != "Transfer" {
+        t.Fatalf("written events = %v, want the Transfer only", events)
+    }
+}
+
+func TestContractAddressesExpand(t *testing.T) {
+    second := common.HexToAddress("0x00000000000000000000000000000000000000a2")
+    lg := transferLog(8, 0, 2)
+    lg.Address = second
+    node := newFakeNode(t, 10, transferLog(4, 0, 1), lg)
+    cfg := testConfig(t, 0)
+    cfg.Contracts[0].Address = ""
+    cfg.Contracts[0].Addresses = []string{tokenAddress.Hex(), second.Hex()}
+    out := &memorySink{}
+
+    idx := New(cfg, node.dial(t), out)
+    if len(idx.filteredAddresses) != 2 || idx.filteredAddresses[0] != tokenAddress || idx.filteredAddresses[1] != second {
+        t.Fatalf("filtered addresses = %v, want both entries", idx.filteredAddresses)
+    }
+    if err := idx.Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    events := out.written()
+    if len(events) != 2 {
+        t.Fatalf("wrote %d events, want 2", len(events))
+    }
+    for i, addr := range []common.Address{tokenAddress, second} {
+        if events[i]["contract"] != addr.Hex() || events[i]["contract_name"] != "Token" || events[i]["event_name"] != "Transfer" {
+            t.Errorf("event %d = %v, want a Token Transfer of %s", i, events[i], addr.Hex())
+        }
+    }
+    if len(cfg.Contracts) != 1 || len(cfg.Contracts[0].Addresses) != 2 {
+        t.Error("New modified the caller's config")
+    }
+}
+
+func TestProcessBlockHash(t *testing.T) {
+    node := newFakeNode(t, 30, transferLog(11, 0, 1), transferLog(12, 0, 2), transferLog(12, 1, 3), transferLog(13, 0, 4))
+    out := &memorySink{}
+
+    n, err := New(testConfig(t, 0), node.dial(t), out).ProcessBlockHash(context.Background(), blockHash(12, 0))
+    if err != nil {
+        t.Fatalf("ProcessBlockHash: %v", err)
+    }
+    if got := out.blocks(); n != 2 || len(got) != 2 || got[0] != 12 || got[1] != 12 {
+        t.Fatalf("wrote %d events of blocks %v, want the 2 events of block 12", n, got)
+    }
+
+    // The hash of a block replaced by a reorg matches nothing.
+    out = &memorySink{}
+    n, err = New(testConfig(t, 0), node.dial(t), out).ProcessBlockHash(context.Background(), blockHash(12, 1))
+    if err != nil || n != 0 || len(out.blocks()) != 0 {
+        t.Errorf("ProcessBlockHash of an unknown hash = %d, %v; wrote %v", n, err, out.blocks())
+    }
+}
+
+func TestFilterBlockRange(t *testing.T) {
+    logs := []types.Log{transferLog(4, 0, 1), transferLog(5, 0, 2), transferLog(7, 0, 3), transferLog(9, 0, 4), transferLog(10, 0, 5)}
+    kept, dropped := filterBlockRange(logs, 5, 9)
+    if dropped != 2 || len(kept) != 3 || kept[0].BlockNumber != 5 || kept[1].BlockNumber != 7 || kept[2].BlockNumber != 9 {
+        t.Fatalf("filterBlockRange = %d logs %v, %d dropped; want blocks [5 7 9] and 2 dropped", len(kept), kept, dropped)
+    }
+    if kept, dropped := filterBlockRange(nil, 0, 9); len(kept) != 0 || dropped != 0 {
+        t.Errorf("filterBlockRange(nil) = %v, %d", kept, dropped)
+    }
+}
+
+func TestRangeDropsLogsOutsideRequestedBlocks(t *testing.T) {
+    node := newFakeNode(t, 19)
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        // A provider answering every range with the same window.
+        return []types.Log{transferLog(8, 0, 1), transferLog(12, 0, 2), transferLog(25, 0, 3)}, nil
+    }
+    out := &memorySink{}
+    if err := New(testConfig(t, 0), node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 8 || got[1] != 12 {
+        t.Fatalf("written blocks = %v, want [8 12], each once from its own range", got)
+    }
+}
+
+func TestPageRange(t *testing.T) {
+    tests := []struct {
+        from, to, size uint64
+        want           string
+    }{
+        {0, 9, 0, "[0→9]"},
+        {0, 9, 10, "[0→9]"},
+        {0, 9, 5, "[0→4 5→9]"},
+        {0, 9, 4, "[0→3 4→7 8→9]"},
+        {7, 7, 3, "[7→7]"},
+        {math.MaxUint64 - 4, math.MaxUint64, 3, fmt.Sprintf("[%d→%d %d→%d]", uint64(math.MaxUint64-4), uint64(math.MaxUint64-2), uint64(math.MaxUint64-1), uint64(math.MaxUint64))},
+    }
+    for _, tt := range tests {
+        if got := fmt.Sprint(pageRange(tt.from, tt.to, tt.size)); got != tt.want {
+            t.Errorf("pageRange(%d, %d, %d) = %s, want %s", tt.from, tt.to, tt.size, got, tt.want)
+        }
+    }
+}
+
+func TestMaxRPCRangeSplitsGetLogs(t *testing.T) {
+    node := newFakeNode(t, 24)
+    var mu sync.Mutex
+    var calls []string
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        mu.Lock()
+        defer mu.Unlock()
+        calls = append(calls, fmt.Sprintf("%d-%d", from, to))
+        return nil, nil
+    }
+    cfg := testConfig(t, 0)
+    cfg.MaxRPCRange = 4
+
+    if err := New(cfg, node.dial(t), &memorySink{}).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    // Chunks of 10 blocks, each fetched in pages of at most 4.
+    want := "[0-3 4-7 8-9 10-13 14-17 18-19 20-23 24-24]"
+    if got := fmt.Sprint(calls); got != want {
+        t.Errorf("eth_getLogs ranges = %s, want %s", got, want)
+    }
+}
+
+func TestExcludeAddressesDropsTheirLogs(t *testing.T) {
+    other := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+    fromOther := transferLog(4, 0, 2)
+    fromOther.Address = other
+    logs := []types.Log{transferLog(3, 0, 1), fromOther, transferLog(5, 0, 3)}
+
+    cfg := testConfig(t, 0)
+    cfg.Contracts[0].Addresses = []string{tokenAddress.Hex(), other.Hex()}
+    cfg.Contracts[0].Address = ""
+    out := &memorySink{}
+    if err := New(cfg, newFakeNode(t, 9, logs...).dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 3 {
+        t.Fatalf("written blocks without exclusion = %v, want [3 4 5]", got)
+    }
+
+    cfg = testConfig(t, 0)
+    cfg.Contracts[0].Addresses = []string{tokenAddress.Hex(), other.Hex()}
+    cfg.Contracts[0].Address = ""
+    cfg.ExcludeAddresses = []string{strings.ToLower(other.Hex())}
+    out = &memorySink{}
+    if err := New(cfg, newFakeNode(t, 9, logs...).dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 3 || got[1] != 5 {
+        t.Fatalf("written blocks = %v, want [3 5] without the excluded address", got)
+    }
+}
+
+// transferTo returns a Transfer log of block sent to the address topic to.
+func transferTo(block uint64, to common.Hash) types.Log {
+    lg := transferLog(block, 0, 1)
+    lg.Topics = []common.Hash{transferID, common.HexToHash("0x01"), to}
+    return lg
+}
+
+func TestTopicFiltersMatchPerPosition(t *testing.T) {
+    a, b, c := common.HexToHash("0xa"), common.HexToHash("0xb"), common.HexToHash("0xc")
+    short := transferTo(6, a)
+    short.Topics = short.Topics[:2] // no topic for the "to" position
+    node := newFakeNode(t, 9, transferTo(3, a), transferTo(4, b), transferTo(5, c), short)
+    cfg := testConfig(t, 0)
+    cfg.Contracts[0].Topics = map[string]map[string][]string{
+        "Transfer": {"to": {common.BytesToAddress(a.Bytes()).Hex(), common.BytesToAddress(b.Bytes()).Hex()}},
+    }
+    idx := New(cfg, node.dial(t), &memorySink{})
+
+    // The restricted event gets a query of its own: topic0, then a wildcard
+    // for "from" and the accepted "to" values.
+    queries := idx.filterQueries(nil, nil)
+    if len(queries) != 1 {
+        t.Fatalf("queries = %+v, want the restricted event's only", queries)
+    }
+    want := [][]common.Hash{{transferID}, nil, {a, b}}
+    if got := fmt.Sprint(queries[0].Topics); got != fmt.Sprint(want) || len(queries[0].Addresses) != 1 || queries[0].Addresses[0] != tokenAddress {
+        t.Fatalf("query = %v %v, want %v from %s", queries[0].Addresses, got, want, tokenAddress)
+    }
+
+    // The fake node ignores topics, as queries of other events could return
+    // these logs: the indexer checks them again.
+    out := &memorySink{}
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+        t.Fatalf("written blocks = %v, want [3 4]: to a or b only", got)
+    }
+}
+
+func TestEnrichWorkersKeepLogOrder(t *testing.T) {
+    var logs []types.Log
+    for b := uint64(1); b <= 8; b++ {
+        logs = append(logs, transferLog(b, 0, int64(b)))
+    }
+    node := newFakeNode(t, 9, logs...)
+    var mu sync.Mutex
+    var inFlight, maxInFlight int
+    node.before = func(method string, params []json.RawMessage) {
+        if method != "eth_getBlockByNumber" {
+            return
+        }
+        var block hexutil.Uint64
+        json.Unmarshal(params[0], &block)
+        mu.Lock()
+        inFlight++
+        maxInFlight = max(maxInFlight, inFlight)
+        mu.Unlock()
+        // Earlier blocks answer last, so enrichment finishes out of order.
+        time.Sleep(time.Duration(10-block) * 5 * time.Millisecond)
+        mu.Lock()
+        inFlight--
+        mu.Unlock()
+    }
+    cfg := testConfig(t, 0)
+    cfg.EnrichWorkers = 4
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := fmt.Sprint(out.blocks()); got != "[1 2 3 4 5 6 7 8]" {
+        t.Fatalf("written blocks = %s, want the log order [1 2 3 4 5 6 7 8]", got)
+    }
+    for i, evt := range out.written() {
+        if want := header(uint64(i+1), 0).Time; fmt.Sprint(evt["timestamp"]) != fmt.Sprint(want) {
+            t.Errorf("event of block %d has timestamp %v, want %d", i+1, evt["timestamp"], want)
+        }
+    }
+    if maxInFlight < 2 || maxInFlight > 4 {
+        t.Errorf("%d header requests in flight at most, want 2 to enrich_workers (4)", maxInFlight)
+    }
+}
+
+func TestMissingTimestampIsFlagged(t *testing.T) {
+    node := newFakeNode(t, 19, transferLog(5, 0, 1), transferLog(15, 0, 2), transferLog(15, 1, 3))
+    node.failHeaders = map[uint64]bool{15: true}
+    out := &memorySink{}
+    idx := New(testConfig(t, 0), node.dial(t), out)
+
+    if err := idx.Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    events := out.written()
+    if len(events) != 3 {
+        t.Fatalf("wrote %d events, want all 3 despite the missing header", len(events))
+    }
+    if evt := events[0]; evt["timestamp"] != header(5, 0).Time || evt["timestamp_error"] != nil {
+        t.Errorf("event of block 5 = %v, want its timestamp and no flag", evt)
+    }
+    for _, evt := range events[1:] {
+        if _, ok := evt["timestamp"]; ok || evt["timestamp_error"] != true {
+            t.Errorf("event of block 15 = %v, want timestamp_error and no timestamp", evt)
+        }
+    }
+    if sum := idx.Summary(); sum == nil || sum.Warnings["timestamp_error"] != 2 {
+        t.Errorf("summary = %+v, want 2 timestamp_error warnings", sum)
+    }
+}
+
+func TestIndexBlocksWritesOneRecordPerBlock(t *testing.T) {
+    node := newFakeNode(t, 4, transferLog(2, 0, 1))
+    cfg := testConfig(t, 0)
+    cfg.IndexBlocks = true
+    cfg.Chain = "mainnet"
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    var blocks []uint64
+    transfers := 0
+    for _, evt := range out.written() {
+        if evt["event_name"] != sink.BlockEventName {
+            transfers++
+            continue
+        }
+        n := evt["block_number"].(uint64)
+        blocks = append(blocks, n)
+        hdr := header(n, 0)
+        if evt["block_hash"] != hdr.Hash().Hex() || evt["parent_hash"] != hdr.ParentHash.Hex() || evt["timestamp"] != hdr.Time ||
+            evt["gas_limit"] != hdr.GasLimit || evt["base_fee"] != "" || evt["chain"] != "mainnet" {
+            t.Errorf("block record %d = %v", n, evt)
+        }
+    }
+    // Quiet blocks get a record too.
+    if fmt.Sprint(blocks) != "[0 1 2 3 4]" || transfers != 1 {
+        t.Fatalf("block records %v and %d transfers, want [0 1 2 3 4] and 1", blocks, transfers)
+    }
+
+    // A block whose header cannot be fetched fails its range.
+    node.failHeaders = map[uint64]bool{3: true}
+    if err := New(cfg, node.dial(t), &memorySink{}).Run(context.Background()); err == nil {
+        t.Fatal("Run succeeded without the header of block 3")
+    }
+}
+
+func TestTransformerChainRunsBeforeSink(t *testing.T) {
+    node := newFakeNode(t, 9, transferLog(3, 0, 1), transferLog(4, 0, 2), transferLog(5, 0, 3))
+    cfg := testConfig(t, 0)
+    cfg.Transforms = []config.TransformConfig{
+        {Type: config.TransformDrop, Field: "value", Value: "2"},
+        {Type: config.TransformRename, From: "value", To: "amount"},
+        {Type: config.TransformSet, Field: "source", Value: "etl", Events: []string{"Approval"}},
+    }
+    out := &memorySink{}
+    idx := New(cfg, node.dial(t), out)
+    // Programmatic transformers run after the configured ones.
+    idx.AddTransformers(transform.Compute("amount_x10", func(evt sink.Event) (interface{}, error) {
+        return fmt.Sprint(evt["amount"], "0"), nil
+    }))
+
+    if err := idx.Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    events := out.written()
+    if len(events) != 2 {
+        t.Fatalf("wrote %d events, want the value 2 transfer dropped", len(events))
+    }
+    for i, want := range []string{"1", "3"} {
+        evt := events[i]
+        if _, ok := evt["value"]; ok || fmt.Sprint(evt["amount"]) != want || evt["amount_x10"] != want+"0" || evt["source"] != nil {
+            t.Errorf("event %d = %v, want value renamed to amount %s", i, evt, want)
+        }
+    }
+    if sum := idx.Summary(); sum.TotalEvents != 2 {
+        t.Errorf("summary counts %d events, want the 2 written", sum.TotalEvents)
+    }
+
+    // A failing transformer fails the range.
+    idx = New(testConfig(t, 0), node.dial(t), &memorySink{})
+    idx.AddTransformers(transform.Func(func(sink.Event) (sink.Event, error) { return nil, errors.New("bad rate") }))
+    if err := idx.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "bad rate") {
+        t.Errorf("Run with a failing transformer = %v", err)
+    }
+}
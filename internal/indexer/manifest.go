@@ -0,0 +1,90 @@
+package indexer
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"etl-web3/internal/sink"
+)
+
+// ManifestFileName is the name of the summary file written next to the output
+// of file-based sinks once a bounded run completes.
+const ManifestFileName = "manifest.json"
+
+// Summary is a machine-readable report of a completed run. It is written as
+// manifest.json for file sinks and exposed through the API job status.
+type Summary struct {
+    ChainID         string         `json:"chain_id"`
+    StartBlock      uint64         `json:"start_block"`
+    EndBlock        uint64         `json:"end_block"`
+    TotalEvents     int            `json:"total_events"`
+    Events          map[string]int `json:"events"`    // keyed by event_name
+    Contracts       map[string]int `json:"contracts"` // keyed by contract_name
+    StartedAt       time.Time      `json:"started_at"`
+    FinishedAt      time.Time      `json:"finished_at"`
+    DurationSeconds float64        `json:"duration_seconds"`
+    // FailedRanges lists the ranges that could not be processed when running
+    // with on_error: continue.
+    FailedRanges    []BlockRange   `json:"failed_ranges,omitempty"`
+    // Warnings counts non-fatal enrichment problems by kind
+    // (e.g. "timestamp_error").
+    Warnings        map[string]int `json:"warnings,omitempty"`
+}
+
+// stats accumulates per-event and per-contract counters while workers write
+// events concurrently.
+type stats struct {
+    mu        sync.Mutex
+    total     int
+    events    map[string]int
+    contracts map[string]int
+}
+
+func newStats() *stats {
+    return &stats{events: make(map[string]int), contracts: make(map[string]int)}
+}
+
+// record counts an event that was successfully handed to the sink.
+func (s *stats) record(evt sink.Event) {
+    name, _ := evt["event_name"].(string)
+    contract, _ := evt["contract_name"].(string)
+
+    s.mu.Lock()
+    s.total++
+    s.events[name]++
+    s.contracts[contract]++
+    s.mu.Unlock()
+}
+
+// snapshot copies the counters into the given summary.
+func (s *stats) snapshot(sum *Summary) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sum.TotalEvents = s.total
+    sum.Events = make(map[string]int, len(s.events))
+    for k, v := range s.events {
+        sum.Events[k] = v
+    }
+    sum.Contracts = make(map[string]int, len(s.contracts))
+    for k, v := range s.contracts {
+        sum.Contracts[k] = v
+    }
+}
+
+// writeManifest persists the summary as indented JSON inside dir.
+func writeManifest(dir string, sum *Summary) error {
+    data, err := json.MarshalIndent(sum, "", "  ")
+    if err != nil {
+        return fmt.Errorf("failed to encode manifest: %w", err)
+    }
+    fp := filepath.Join(dir, ManifestFileName)
+    if err := os.WriteFile(fp, data, 0o644); err != nil {
+        return fmt.Errorf("failed to write manifest %s: %w", fp, err)
+    }
+    return nil
+}
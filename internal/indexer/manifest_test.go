@@ -0,0 +1,53 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCSVRunWritesManifest(t *testing.T) {
+    node := newFakeNode(t, 29, transferLog(5, 0, 1), transferLog(15, 0, 2), transferLog(15, 1, 3))
+    cfg := testConfig(t, 3)
+    cfg.Storage.Type = "csv"
+    cfg.Storage.CSV.OutputDir = t.TempDir()
+    idx := New(cfg, node.dial(t), &memorySink{})
+
+    if err := idx.Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    data, err := os.ReadFile(filepath.Join(cfg.Storage.CSV.OutputDir, ManifestFileName))
+    if err != nil {
+        t.Fatalf("manifest: %v", err)
+    }
+    var got Summary
+    if err := json.Unmarshal(data, &got); err != nil {
+        t.Fatalf("manifest %s: %v", data, err)
+    }
+    if got.ChainID != "1" || got.StartBlock != 3 || got.EndBlock != 29 || got.TotalEvents != 3 ||
+        got.Events["Transfer"] != 3 || got.Contracts["Token"] != 3 || len(got.FailedRanges) != 0 || len(got.Warnings) != 0 {
+        t.Errorf("manifest = %s", data)
+    }
+    if got.FinishedAt.Before(got.StartedAt) || got.DurationSeconds < 0 {
+        t.Errorf("manifest times = %v → %v (%fs)", got.StartedAt, got.FinishedAt, got.DurationSeconds)
+    }
+    if sum := idx.Summary(); sum == nil || sum.TotalEvents != 3 {
+        t.Errorf("Summary() = %+v, want the manifest's", sum)
+    }
+
+    // Other sinks keep the summary in memory only.
+    cfg = testConfig(t, 3)
+    cfg.Storage.CSV.OutputDir = t.TempDir()
+    idx = New(cfg, node.dial(t), &memorySink{})
+    if err := idx.Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if _, err := os.Stat(filepath.Join(cfg.Storage.CSV.OutputDir, ManifestFileName)); !os.IsNotExist(err) {
+        t.Errorf("manifest written for a non-CSV sink: %v", err)
+    }
+    if sum := idx.Summary(); sum == nil || sum.TotalEvents != 3 {
+        t.Errorf("Summary() = %+v", sum)
+    }
+}
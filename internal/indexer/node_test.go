@@ -0,0 +1,290 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/rpc"
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// transferABI is the ABI of the ERC-20 Transfer event.
+const transferABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"from","type":"address"},
+    {"indexed":true,"name":"to","type":"address"},
+    {"indexed":false,"name":"value","type":"uint256"}]}]`
+
+var (
+    tokenAddress = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+    transferID   = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// testConfig returns a single-worker config indexing the Transfer events of
+// tokenAddress from block start.
+func testConfig(t testing.TB, start uint64) *config.Config {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(transferABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &config.Config{
+        StartBlock:    config.BlockRef{Number: start},
+        ChunkSize:     10,
+        Workers:       1,
+        EnrichWorkers: 1,
+        Retry:         config.RetryConfig{Attempts: 1, DelayMS: 1},
+        Contracts: []config.ContractConfig{{
+            Name:      "Token",
+            Address:   tokenAddress.Hex(),
+            Events:    []string{"Transfer"},
+            ParsedABI: &parsed,
+        }},
+    }
+}
+
+// transferLog returns a Transfer log of value emitted by tokenAddress in
+// block at position index.
+func transferLog(block uint64, index uint, value int64) types.Log {
+    return types.Log{
+        Address:     tokenAddress,
+        Topics:      []common.Hash{transferID, common.HexToHash("0x01"), common.HexToHash("0x02")},
+        Data:        common.LeftPadBytes(big.NewInt(value).Bytes(), 32),
+        BlockNumber: block,
+        TxHash:      common.BigToHash(new(big.Int).SetUint64(block*1000 + uint64(index))),
+        BlockHash:   blockHash(block, 0),
+        Index:       index,
+    }
+}
+
+// blockHash is the hash the fake node gives block in the given fork.
+func blockHash(block uint64, fork byte) common.Hash {
+    return header(block, fork).Hash()
+}
+
+func header(block uint64, fork byte) *types.Header {
+    return &types.Header{
+        Number:     new(big.Int).SetUint64(block),
+        Time:       1_700_000_000 + block*12,
+        Difficulty: big.NewInt(0),
+        Extra:      []byte{fork},
+    }
+}
+
+// fakeNode is a JSON-RPC endpoint serving a chain of head+1 blocks and the
+// given logs. Other methods fail with "method not found". Blocks in
+// inlineTimestamps get that blockTimestamp added to their logs, as some
+// providers do.
+type fakeNode struct {
+    *httptest.Server
+
+    mu    sync.Mutex
+    head  uint64
+    logs  []types.Log
+    fork  byte // changes every block hash, as a reorg would
+    calls map[string]int
+    // headers counts the eth_getBlockByNumber requests of each block.
+    headers          map[uint64]int
+    inlineTimestamps map[uint64]uint64
+    // failHeaders lists blocks whose header requests fail.
+    failHeaders map[uint64]bool
+    // getLogs, when set, replaces the eth_getLogs answer.
+    getLogs func(from, to uint64) ([]types.Log, error)
+    // before, when set, runs ahead of every request, outside mu.
+    before func(method string, params []json.RawMessage)
+}
+
+func newFakeNode(t testing.TB, head uint64, logs ...types.Log) *fakeNode {
+    t.Helper()
+    n := &fakeNode{head: head, logs: logs, calls: map[string]int{}, headers: map[uint64]int{}}
+    n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+    t.Cleanup(n.Close)
+    return n
+}
+
+// dial returns a client of n with a single attempt per call.
+func (n *fakeNode) dial(t testing.TB) *rpc.Client {
+    t.Helper()
+    c, err := rpc.Dial(context.Background(), n.URL, config.RetryConfig{Attempts: 1, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    t.Cleanup(c.Close)
+    return c
+}
+
+// callCount returns how many requests for method the node received.
+func (n *fakeNode) callCount(method string) int {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return n.calls[method]
+}
+
+// reorg changes the hash of every block.
+func (n *fakeNode) reorg() {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    n.fork++
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        ID     json.RawMessage   `json:"id"`
+        Method string            `json:"method"`
+        Params []json.RawMessage `json:"params"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    n.mu.Lock()
+    n.calls[req.Method]++
+    before := n.before
+    n.mu.Unlock()
+    if before != nil {
+        before(req.Method, req.Params)
+    }
+
+    result, err := n.answer(req.Method, req.Params)
+    resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+    if err != nil {
+        resp["error"] = err
+    } else {
+        resp["result"] = result
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// nodeError is a JSON-RPC error answer.
+type nodeError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+func (n *fakeNode) answer(method string, params []json.RawMessage) (any, *nodeError) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    switch method {
+    case "eth_blockNumber":
+        return hexutil.Uint64(n.head), nil
+    case "eth_chainId":
+        return hexutil.Uint64(1), nil
+    case "net_version":
+        return "1", nil
+    case "eth_getBlockByNumber":
+        var num hexutil.Uint64
+        if err := json.Unmarshal(params[0], &num); err != nil {
+            var tag string
+            json.Unmarshal(params[0], &tag)
+            if tag != "latest" {
+                return nil, &nodeError{Code: -32602, Message: err.Error()}
+            }
+            num = hexutil.Uint64(n.head)
+        }
+        n.headers[uint64(num)]++
+        if n.failHeaders[uint64(num)] {
+            return nil, &nodeError{Code: -32000, Message: "header not available"}
+        }
+        if uint64(num) > n.head {
+            return nil, nil
+        }
+        return header(uint64(num), n.fork), nil
+    case "eth_getLogs":
+        var q struct {
+            FromBlock hexutil.Uint64 `json:"fromBlock"`
+            ToBlock   hexutil.Uint64 `json:"toBlock"`
+            BlockHash *common.Hash   `json:"blockHash"`
+        }
+        if err := json.Unmarshal(params[0], &q); err != nil {
+            return nil, &nodeError{Code: -32602, Message: err.Error()}
+        }
+        if n.getLogs != nil {
+            n.mu.Unlock()
+            logs, err := n.getLogs(uint64(q.FromBlock), uint64(q.ToBlock))
+            n.mu.Lock()
+            if err != nil {
+                return nil, &nodeError{Code: -32000, Message: err.Error()}
+            }
+            return logs, nil
+        }
+        out := []types.Log{}
+        for _, lg := range n.logs {
+            if q.BlockHash != nil {
+                if lg.BlockHash == *q.BlockHash {
+                    out = append(out, lg)
+                }
+                continue
+            }
+            if lg.BlockNumber >= uint64(q.FromBlock) && lg.BlockNumber <= uint64(q.ToBlock) {
+                out = append(out, lg)
+            }
+        }
+        return n.withInlineTimestamps(out), nil
+    }
+    return nil, &nodeError{Code: -32601, Message: "the method " + method + " does not exist/is not available"}
+}
+
+// withInlineTimestamps adds the blockTimestamp of inlineTimestamps to logs.
+func (n *fakeNode) withInlineTimestamps(logs []types.Log) any {
+    if n.inlineTimestamps == nil {
+        return logs
+    }
+    out := make([]map[string]any, len(logs))
+    for i := range logs {
+        raw, _ := json.Marshal(&logs[i])
+        json.Unmarshal(raw, &out[i])
+        if ts, ok := n.inlineTimestamps[logs[i].BlockNumber]; ok {
+            out[i]["blockTimestamp"] = hexutil.Uint64(ts)
+        }
+    }
+    return out
+}
+
+// headerCount returns how many times the header of block was requested.
+func (n *fakeNode) headerCount(block uint64) int {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return n.headers[block]
+}
+
+// memorySink keeps every written event.
+type memorySink struct {
+    mu     sync.Mutex
+    events []sink.Event
+}
+
+func (m *memorySink) Write(evt sink.Event) error {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.events = append(m.events, evt)
+    return nil
+}
+
+// written returns the written events.
+func (m *memorySink) written() []sink.Event {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return append([]sink.Event(nil), m.events...)
+}
+
+// blocks returns the block_number of every written event, in write order.
+func (m *memorySink) blocks() []uint64 {
+    var out []uint64
+    for _, evt := range m.written() {
+        out = append(out, evt["block_number"].(uint64))
+    }
+    return out
+}
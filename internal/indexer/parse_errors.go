@@ -0,0 +1,124 @@
+package indexer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// parseErrorColumns is the header of the parse errors file.
+var parseErrorColumns = []string{"block_number", "tx_hash", "log_index", "address", "topics", "data", "error", "failed_at"}
+
+// parseErrorWriter appends the logs the parser fails to decode to the CSV
+// file cfg.ParseErrorsFile, with their raw topics and data and the error, so
+// ABIs can be fixed and the logs audited. The file is opened on the first
+// failure; a nil writer does nothing.
+type parseErrorWriter struct {
+    path string
+
+    mu     sync.Mutex
+    f      *os.File
+    w      *csv.Writer
+    failed bool // opening the file failed; already reported
+}
+
+func newParseErrorWriter(path string) *parseErrorWriter {
+    if path == "" {
+        return nil
+    }
+    return &parseErrorWriter{path: path}
+}
+
+// record appends lg with its parse error. Failing to write is logged rather
+// than returned: the file is diagnostic and must not fail the run.
+func (pw *parseErrorWriter) record(lg *types.Log, parseErr error) {
+    if pw == nil {
+        return
+    }
+    topics := make([]string, len(lg.Topics))
+    for i, t := range lg.Topics {
+        topics[i] = t.Hex()
+    }
+    topicsJSON, _ := json.Marshal(topics)
+    row := []string{
+        strconv.FormatUint(lg.BlockNumber, 10),
+        lg.TxHash.Hex(),
+        strconv.FormatUint(uint64(lg.Index), 10),
+        lg.Address.Hex(),
+        string(topicsJSON),
+        hexutil.Encode(lg.Data),
+        parseErr.Error(),
+        time.Now().UTC().Format(time.RFC3339),
+    }
+
+    pw.mu.Lock()
+    defer pw.mu.Unlock()
+    if err := pw.openLocked(); err != nil {
+        if !pw.failed {
+            logrus.Warnf("failed to open parse errors file: %v", err)
+            pw.failed = true
+        }
+        return
+    }
+    pw.w.Write(row)
+    pw.w.Flush()
+    if err := pw.w.Error(); err != nil {
+        logrus.Warnf("failed to write parse errors file: %v", err)
+    }
+}
+
+// openLocked opens the file for appending, writing the header when it is
+// new. pw.mu must be held.
+func (pw *parseErrorWriter) openLocked() error {
+    if pw.f != nil {
+        return nil
+    }
+    if err := os.MkdirAll(filepath.Dir(pw.path), 0o755); err != nil {
+        return err
+    }
+    f, err := os.OpenFile(pw.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return err
+    }
+    info, err := f.Stat()
+    if err != nil {
+        f.Close()
+        return err
+    }
+    w := csv.NewWriter(f)
+    if info.Size() == 0 {
+        w.Write(parseErrorColumns)
+        w.Flush()
+        if err := w.Error(); err != nil {
+            f.Close()
+            return fmt.Errorf("failed to write header of %s: %w", pw.path, err)
+        }
+    }
+    pw.f, pw.w = f, w
+    return nil
+}
+
+// close closes the file, if it was opened. A later record reopens it.
+func (pw *parseErrorWriter) close() {
+    if pw == nil {
+        return
+    }
+    pw.mu.Lock()
+    defer pw.mu.Unlock()
+    if pw.f == nil {
+        return
+    }
+    if err := pw.f.Close(); err != nil {
+        logrus.Warnf("failed to close parse errors file: %v", err)
+    }
+    pw.f, pw.w = nil, nil
+}
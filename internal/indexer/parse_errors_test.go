@@ -0,0 +1,59 @@
+package indexer
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseErrorsFileRecordsFailingLogs(t *testing.T) {
+    broken := transferLog(7, 1, 0)
+    broken.Data = []byte{0x01} // too short for the uint256 value
+    node := newFakeNode(t, 20, transferLog(5, 0, 1), broken, transferLog(9, 0, 2))
+    cfg := testConfig(t, 0)
+    cfg.ParseErrorsFile = filepath.Join(t.TempDir(), "errors", "parse_errors.csv")
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 5 || got[1] != 9 {
+        t.Fatalf("written blocks = %v, want [5 9]", got)
+    }
+
+    f, err := os.Open(cfg.ParseErrorsFile)
+    if err != nil {
+        t.Fatalf("parse errors file: %v", err)
+    }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != 2 || strings.Join(rows[0], ",") != strings.Join(parseErrorColumns, ",") {
+        t.Fatalf("rows = %v, want the header and one log", rows)
+    }
+    row := rows[1]
+    if row[0] != "7" || row[1] != broken.TxHash.Hex() || row[2] != "1" || row[3] != tokenAddress.Hex() || row[5] != "0x01" || row[6] == "" {
+        t.Errorf("row = %v", row)
+    }
+    if !strings.Contains(row[4], transferID.Hex()) {
+        t.Errorf("topics = %s, want topic0 %s", row[4], transferID.Hex())
+    }
+}
+
+func TestParseErrorsFileNotCreatedWithoutFailures(t *testing.T) {
+    node := newFakeNode(t, 20, transferLog(5, 0, 1))
+    cfg := testConfig(t, 0)
+    cfg.ParseErrorsFile = filepath.Join(t.TempDir(), "parse_errors.csv")
+
+    if err := New(cfg, node.dial(t), &memorySink{}).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    if _, err := os.Stat(cfg.ParseErrorsFile); !os.IsNotExist(err) {
+        t.Fatalf("parse errors file exists without failures: %v", err)
+    }
+}
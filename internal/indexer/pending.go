@@ -0,0 +1,64 @@
+package indexer
+
+import (
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// pendingLogs holds the live logs of follow mode until their block has
+// enough confirmations (follow_confirmations). Logs are grouped by block so
+// final blocks are flushed whole and in order, and a log retracted by a
+// reorg while still buffered is dropped without ever reaching the sink.
+// It is only used by the follow goroutine and is not safe for concurrent use.
+type pendingLogs struct {
+    blocks map[uint64][]types.Log
+}
+
+func newPendingLogs() *pendingLogs {
+    return &pendingLogs{blocks: make(map[uint64][]types.Log)}
+}
+
+// add buffers lg.
+func (p *pendingLogs) add(lg types.Log) {
+    p.blocks[lg.BlockNumber] = append(p.blocks[lg.BlockNumber], lg)
+}
+
+// remove drops the buffered log that the removed log lg retracts. It
+// reports false when no such log is buffered, i.e. it was already written.
+func (p *pendingLogs) remove(lg types.Log) bool {
+    logs := p.blocks[lg.BlockNumber]
+    for i, b := range logs {
+        if b.BlockHash == lg.BlockHash && b.TxHash == lg.TxHash && b.Index == lg.Index {
+            logs = append(logs[:i], logs[i+1:]...)
+            if len(logs) == 0 {
+                delete(p.blocks, lg.BlockNumber)
+            } else {
+                p.blocks[lg.BlockNumber] = logs
+            }
+            return true
+        }
+    }
+    return false
+}
+
+// final removes and returns the logs of the blocks up to block, ordered by
+// block and log index.
+func (p *pendingLogs) final(block uint64) []types.Log {
+    var numbers []uint64
+    for n := range p.blocks {
+        if n <= block {
+            numbers = append(numbers, n)
+        }
+    }
+    sort.Slice(numbers, func(i, j int) bool { return numbers[i] < numbers[j] })
+
+    var out []types.Log
+    for _, n := range numbers {
+        logs := p.blocks[n]
+        sort.Slice(logs, func(i, j int) bool { return logs[i].Index < logs[j].Index })
+        out = append(out, logs...)
+        delete(p.blocks, n)
+    }
+    return out
+}
@@ -0,0 +1,70 @@
+package indexer
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestPendingLogsFlushFinalBlocksInOrder(t *testing.T) {
+    p := newPendingLogs()
+    for _, lg := range []types.Log{transferLog(12, 1, 1), transferLog(11, 0, 2), transferLog(12, 0, 3), transferLog(13, 0, 4)} {
+        p.add(lg)
+    }
+
+    if got := p.final(10); len(got) != 0 {
+        t.Fatalf("final(10) = %d logs, want none", len(got))
+    }
+    got := p.final(12)
+    want := []struct {
+        block uint64
+        index uint
+    }{{11, 0}, {12, 0}, {12, 1}}
+    if len(got) != len(want) {
+        t.Fatalf("final(12) = %d logs, want %d", len(got), len(want))
+    }
+    for i, w := range want {
+        if got[i].BlockNumber != w.block || got[i].Index != w.index {
+            t.Errorf("log %d = block %d index %d, want block %d index %d", i, got[i].BlockNumber, got[i].Index, w.block, w.index)
+        }
+    }
+    if again := p.final(12); len(again) != 0 {
+        t.Fatalf("final(12) flushed %d logs twice", len(again))
+    }
+    if rest := p.final(13); len(rest) != 1 || rest[0].BlockNumber != 13 {
+        t.Fatalf("final(13) = %v, want the log of block 13", rest)
+    }
+}
+
+func TestPendingLogsRemoveRetractedLogs(t *testing.T) {
+    p := newPendingLogs()
+    p.add(transferLog(11, 0, 1))
+    p.add(transferLog(11, 1, 2))
+
+    retracted := transferLog(11, 0, 1)
+    retracted.Removed = true
+    if !p.remove(retracted) {
+        t.Fatal("remove did not find the buffered log")
+    }
+    if p.remove(retracted) {
+        t.Fatal("remove found a log already dropped")
+    }
+
+    // A log of the same position in another fork is not the buffered one.
+    other := transferLog(11, 1, 2)
+    other.BlockHash = blockHash(11, 1)
+    if p.remove(other) {
+        t.Fatal("remove dropped the log of another block hash")
+    }
+
+    if got := p.final(11); len(got) != 1 || got[0].Index != 1 {
+        t.Fatalf("final(11) = %v, want the surviving log", got)
+    }
+    p.add(transferLog(12, 0, 3))
+    last := transferLog(12, 0, 3)
+    last.Removed = true
+    p.remove(last)
+    if len(p.blocks) != 0 {
+        t.Fatalf("emptied block still buffered: %v", p.blocks)
+    }
+}
@@ -0,0 +1,184 @@
+package indexer
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Progress is a point-in-time snapshot of a running indexer, delivered to the
+// registered progress callback after every completed block range.
+type Progress struct {
+    StartBlock      uint64    `json:"start_block"`
+    EndBlock        uint64    `json:"end_block"`     // target block of the current run
+    CurrentBlock    uint64    `json:"current_block"` // highest block of any completed range
+    // Checkpoint is the last block up to which every range since StartBlock
+    // has completed, once Checkpointed is set. Unlike CurrentBlock it is
+    // safe to resume from with concurrent workers.
+    Checkpoint      uint64    `json:"checkpoint"`
+    // Checkpointed reports whether Checkpoint is set: block 0 is a valid
+    // checkpoint of a run from genesis.
+    Checkpointed    bool      `json:"checkpointed"`
+    BlocksProcessed uint64    `json:"blocks_processed"`
+    // BlocksSkipped counts blocks a previous run already indexed.
+    BlocksSkipped   uint64    `json:"blocks_skipped,omitempty"`
+    RangesProcessed int       `json:"ranges_processed"`
+    EventsWritten   int       `json:"events_written"`
+    // Average throughput since the start of the run.
+    BlocksPerSecond float64   `json:"blocks_per_second"`
+    EventsPerSecond float64   `json:"events_per_second"`
+    // ETASeconds estimates the time left to EndBlock from the pace of the
+    // recent ranges. Zero until known and once the run follows the head.
+    ETASeconds      int64     `json:"eta_seconds,omitempty"`
+    StartedAt       time.Time `json:"started_at"`
+    UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ProgressFunc receives progress snapshots. It is invoked from worker
+// goroutines (serialised by the indexer) and must not block for long.
+type ProgressFunc func(Progress)
+
+// progressTracker aggregates per-range results reported concurrently by the
+// workers into a single Progress value.
+type progressTracker struct {
+    mu  sync.Mutex
+    cur Progress
+    fn  ProgressFunc
+
+    next uint64            // first block not yet covered by the checkpoint
+    done map[uint64]uint64 // completed ranges beyond the checkpoint, from → to
+
+    rate      movingRate // recent throughput, for the ETA
+    following bool       // past EndBlock, so there is no ETA
+}
+
+func (t *progressTracker) start(from, to uint64) {
+    t.mu.Lock()
+    now := time.Now()
+    t.cur = Progress{StartBlock: from, EndBlock: to, StartedAt: now, UpdatedAt: now}
+    t.next = from
+    t.done = make(map[uint64]uint64)
+    t.rate = newMovingRate(now)
+    t.following = false
+    t.mu.Unlock()
+}
+
+// follow marks the end of the bounded run: ranges completed from now on
+// follow the chain head and have no ETA. Without a bounded run, the
+// checkpoint starts before block from.
+func (t *progressTracker) follow(from uint64) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if t.done == nil {
+        now := time.Now()
+        t.cur = Progress{StartBlock: from, StartedAt: now, UpdatedAt: now}
+        t.next = from
+        t.done = make(map[uint64]uint64)
+    }
+    t.following = true
+    t.cur.ETASeconds = 0
+}
+
+// rangeDone records a completed [from, to] range and notifies the callback.
+func (t *progressTracker) rangeDone(from, to uint64, events int) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+
+    t.cur.RangesProcessed++
+    t.cur.BlocksProcessed += to - from + 1
+    t.cur.EventsWritten += events
+    if to > t.cur.CurrentBlock {
+        t.cur.CurrentBlock = to
+    }
+    t.done[from] = to
+    t.advanceLocked()
+    t.cur.UpdatedAt = time.Now()
+    if elapsed := t.cur.UpdatedAt.Sub(t.cur.StartedAt).Seconds(); elapsed > 0 {
+        t.cur.BlocksPerSecond = float64(t.cur.BlocksProcessed) / elapsed
+        t.cur.EventsPerSecond = float64(t.cur.EventsWritten) / elapsed
+    }
+    if !t.following {
+        t.rate.add(t.cur.UpdatedAt, to-from+1)
+        t.cur.ETASeconds = 0
+        if eta, ok := estimateETA(t.remainingLocked(), t.rate.rate()); ok {
+            t.cur.ETASeconds = int64(eta / time.Second)
+        }
+    }
+
+    if t.fn != nil {
+        t.fn(t.cur)
+    }
+}
+
+// skip records ranges a previous run already completed, so the checkpoint
+// advances across them although they are not scanned again. The ranges must
+// be disjoint and lie within the run.
+func (t *progressTracker) skip(ranges []BlockRange) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    for _, r := range ranges {
+        t.done[r.From] = r.To
+        t.cur.BlocksSkipped += r.To - r.From + 1
+    }
+    t.advanceLocked()
+}
+
+// remainingLocked returns the blocks of the run neither processed nor skipped.
+func (t *progressTracker) remainingLocked() uint64 {
+    total := t.cur.EndBlock - t.cur.StartBlock + 1
+    done := t.cur.BlocksProcessed + t.cur.BlocksSkipped
+    if done >= total {
+        return 0
+    }
+    return total - done
+}
+
+// advanceLocked moves the checkpoint over completed ranges adjacent to it.
+func (t *progressTracker) advanceLocked() {
+    for end, ok := t.done[t.next]; ok; end, ok = t.done[t.next] {
+        delete(t.done, t.next)
+        t.cur.Checkpoint = end
+        t.cur.Checkpointed = true
+        t.next = end + 1
+    }
+}
+
+// completed returns the ranges completed beyond the checkpoint, in order.
+func (t *progressTracker) completed() []BlockRange {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    out := make([]BlockRange, 0, len(t.done))
+    for from, to := range t.done {
+        out = append(out, BlockRange{From: from, To: to})
+    }
+    sort.Slice(out, func(i, j int) bool { return out[i].From < out[j].From })
+    return out
+}
+
+// checkpointWith returns the checkpoint as it will be once [from, to]
+// completes; ok is false when completing it does not advance the checkpoint.
+func (t *progressTracker) checkpointWith(from, to uint64) (block uint64, ok bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    if from != t.next {
+        return 0, false
+    }
+    for end, done := t.done[to+1]; done; end, done = t.done[to+1] {
+        to = end
+    }
+    return to, true
+}
+
+// checkpoint returns the last block up to which every range since the start
+// has completed; ok is false until the first range does.
+func (t *progressTracker) checkpoint() (block uint64, ok bool) {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return t.next - 1, t.next > t.cur.StartBlock
+}
+
+func (t *progressTracker) snapshot() Progress {
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return t.cur
+}
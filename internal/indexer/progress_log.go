@@ -0,0 +1,71 @@
+package indexer
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultProgressLogInterval is how often Run logs a progress summary
+// instead of one line per completed range.
+const DefaultProgressLogInterval = 10 * time.Second
+
+// progressLog aggregates the ranges completed between two progress lines.
+// With a zero interval every range is logged on its own, as before.
+type progressLog struct {
+    interval time.Duration
+
+    mu     sync.Mutex
+    since  time.Time // start of the current window
+    ranges int
+    blocks uint64
+    events int
+}
+
+// rangeDone logs the completed range at debug level and, once the interval
+// has elapsed, a summary of the window with p as the overall progress.
+func (l *progressLog) rangeDone(p Progress, from, to uint64, events int, took time.Duration) {
+    line := fmt.Sprintf("[OK] Block %d → %d | Events: %d | Time: %.2fs", from, to, events, took.Seconds())
+    if l.interval <= 0 {
+        logrus.Info(line)
+        return
+    }
+    logrus.Debug(line)
+
+    l.mu.Lock()
+    defer l.mu.Unlock()
+    now := time.Now()
+    if l.since.IsZero() {
+        l.since = p.StartedAt
+    }
+    l.ranges++
+    l.blocks += to - from + 1
+    l.events += events
+    window := now.Sub(l.since)
+    if window < l.interval {
+        return
+    }
+    logrus.Info(progressLine(p, l.ranges, l.blocks, l.events, window))
+    l.since, l.ranges, l.blocks, l.events = now, 0, 0, 0
+}
+
+// progressLine formats the summary of a window of ranges: the rates over
+// the window and the ETA of p, if known.
+func progressLine(p Progress, ranges int, blocks uint64, events int, window time.Duration) string {
+    blockRate := float64(blocks) / window.Seconds()
+    eventRate := float64(events) / window.Seconds()
+    line := fmt.Sprintf("Progress | checkpoint=%d", p.Checkpoint)
+    // Once following the head the run has no fixed end to measure against.
+    total := p.EndBlock - p.StartBlock + 1
+    if done := p.BlocksProcessed + p.BlocksSkipped; done <= total {
+        line += fmt.Sprintf(" | %d/%d blocks (%.1f%%)", done, total, 100*float64(done)/float64(total))
+    }
+    line += fmt.Sprintf(" | %d range(s), %d event(s) in %s | %.1f blocks/s | %.1f events/s",
+        ranges, events, window.Round(time.Second), blockRate, eventRate)
+    if p.ETASeconds > 0 {
+        line += " | ETA " + (time.Duration(p.ETASeconds) * time.Second).String()
+    }
+    return line
+}
@@ -0,0 +1,72 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestProgressLine(t *testing.T) {
+    p := Progress{StartBlock: 1000, EndBlock: 1999, BlocksProcessed: 200, BlocksSkipped: 50, Checkpoint: 1249, ETASeconds: 150}
+    got := progressLine(p, 4, 200, 30, 10*time.Second)
+    want := "Progress | checkpoint=1249 | 250/1000 blocks (25.0%) | 4 range(s), 30 event(s) in 10s | 20.0 blocks/s | 3.0 events/s | ETA 2m30s"
+    if got != want {
+        t.Fatalf("progressLine =\n%s\nwant\n%s", got, want)
+    }
+
+    // Following the head: no fixed end and no ETA.
+    p = Progress{StartBlock: 1000, EndBlock: 1000, BlocksProcessed: 10, Checkpoint: 1009}
+    got = progressLine(p, 1, 10, 0, 5*time.Second)
+    want = "Progress | checkpoint=1009 | 1 range(s), 0 event(s) in 5s | 2.0 blocks/s | 0.0 events/s"
+    if got != want {
+        t.Fatalf("progressLine while following =\n%s\nwant\n%s", got, want)
+    }
+}
+
+func TestProgressLogAggregatesWindow(t *testing.T) {
+    hook := logtest.NewGlobal()
+    defer hook.Reset()
+    level := logrus.GetLevel()
+    logrus.SetLevel(logrus.DebugLevel)
+    defer logrus.SetLevel(level)
+
+    l := &progressLog{interval: time.Hour}
+    p := Progress{StartBlock: 0, EndBlock: 99, StartedAt: time.Now()}
+    l.rangeDone(p, 0, 9, 1, time.Millisecond)
+    l.rangeDone(p, 10, 19, 2, time.Millisecond)
+    for _, e := range hook.AllEntries() {
+        if e.Level == logrus.InfoLevel {
+            t.Fatalf("logged %q before the interval elapsed", e.Message)
+        }
+    }
+    if n := len(hook.AllEntries()); n != 2 {
+        t.Fatalf("%d debug lines, want one per range", n)
+    }
+
+    // The window started over an hour ago: the next range closes it.
+    l.since = time.Now().Add(-2 * time.Hour)
+    l.rangeDone(p, 20, 29, 3, time.Millisecond)
+    last := hook.LastEntry()
+    if last.Level != logrus.InfoLevel || !strings.Contains(last.Message, "3 range(s), 6 event(s)") {
+        t.Fatalf("summary = %v %q, want 3 ranges and 6 events", last.Level, last.Message)
+    }
+    if l.ranges != 0 || l.blocks != 0 || l.events != 0 {
+        t.Errorf("window not reset: %d ranges, %d blocks, %d events", l.ranges, l.blocks, l.events)
+    }
+}
+
+func TestProgressLogZeroIntervalLogsEveryRange(t *testing.T) {
+    hook := logtest.NewGlobal()
+    defer hook.Reset()
+
+    l := &progressLog{}
+    l.rangeDone(Progress{}, 0, 9, 1, time.Millisecond)
+    l.rangeDone(Progress{}, 10, 19, 0, time.Millisecond)
+    entries := hook.AllEntries()
+    if len(entries) != 2 || entries[0].Level != logrus.InfoLevel || !strings.HasPrefix(entries[1].Message, "[OK] Block 10 → 19") {
+        t.Fatalf("entries = %v, want one info line per range", entries)
+    }
+}
@@ -0,0 +1,214 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// rangeSink is a memorySink reporting done as its completed ranges.
+type rangeSink struct {
+    memorySink
+    done []sink.Range
+}
+
+func (r *rangeSink) CompletedRanges() ([]sink.Range, error) {
+    return r.done, nil
+}
+
+// scanned makes node record the ranges queried by eth_getLogs.
+func scanned(node *fakeNode) func() []BlockRange {
+    var mu sync.Mutex
+    var queried []BlockRange
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        mu.Lock()
+        queried = append(queried, BlockRange{From: from, To: to})
+        mu.Unlock()
+        var out []types.Log
+        for _, lg := range node.logs {
+            if lg.BlockNumber >= from && lg.BlockNumber <= to {
+                out = append(out, lg)
+            }
+        }
+        return out, nil
+    }
+    return func() []BlockRange {
+        mu.Lock()
+        defer mu.Unlock()
+        return append([]BlockRange(nil), queried...)
+    }
+}
+
+// assertScanned checks that queried covers exactly the blocks of [0, head]
+// outside done.
+func assertScanned(t *testing.T, queried []BlockRange, head uint64, done []BlockRange) {
+    t.Helper()
+    seen := make(map[uint64]int)
+    for _, r := range queried {
+        for b := r.From; b <= r.To; b++ {
+            seen[b]++
+        }
+    }
+    for b := uint64(0); b <= head; b++ {
+        want := 1
+        for _, r := range done {
+            if b >= r.From && b <= r.To {
+                want = 0
+            }
+        }
+        if seen[b] != want {
+            t.Fatalf("block %d scanned %d time(s), want %d (queries %v)", b, seen[b], want, queried)
+        }
+    }
+}
+
+func TestSinkCompletedRangesAreSkipped(t *testing.T) {
+    node := newFakeNode(t, 99, transferLog(5, 0, 1), transferLog(25, 0, 2), transferLog(55, 0, 3), transferLog(85, 0, 4))
+    queried := scanned(node)
+    // Half the chunks are done: [0, 29] and [50, 69].
+    out := &rangeSink{done: []sink.Range{{From: 0, To: 29}, {From: 50, To: 69}}}
+
+    if err := New(testConfig(t, 0), node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    assertScanned(t, queried(), 99, []BlockRange{{From: 0, To: 29}, {From: 50, To: 69}})
+    if got := out.blocks(); len(got) != 1 || got[0] != 85 {
+        t.Fatalf("written blocks = %v, want [85]", got)
+    }
+}
+
+func TestCheckpointCompletedRangesAreSkipped(t *testing.T) {
+    node := newFakeNode(t, 99, transferLog(15, 0, 1), transferLog(25, 0, 2), transferLog(45, 0, 3), transferLog(75, 0, 4))
+    queried := scanned(node)
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+    // Everything up to 9 is done, and so are [20, 39] and [60, 99]: workers
+    // finished them before the run stopped.
+    done := []BlockRange{{From: 20, To: 39}, {From: 60, To: 99}}
+    data, _ := json.Marshal(Checkpoint{Block: 9, Hash: blockHash(9, 0).Hex(), Completed: done})
+    if err := os.WriteFile(cfg.CheckpointFile, data, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    assertScanned(t, queried(), 99, append([]BlockRange{{From: 0, To: 9}}, done...))
+    if got := out.blocks(); len(got) != 2 || got[0] != 15 || got[1] != 45 {
+        t.Fatalf("written blocks = %v, want [15 45]", got)
+    }
+    cp, err := readCheckpoint(cfg.CheckpointFile)
+    if err != nil || cp == nil || cp.Block != 99 || len(cp.Completed) != 0 {
+        t.Fatalf("checkpoint = %+v (%v), want block 99 without pending ranges", cp, err)
+    }
+}
+
+func TestCompletedRangesDroppedAfterReorg(t *testing.T) {
+    node := newFakeNode(t, 49, transferLog(25, 0, 1))
+    queried := scanned(node)
+    cfg := testConfig(t, 0)
+    cfg.CheckpointFile = filepath.Join(t.TempDir(), "checkpoint.json")
+    // Block 9 was reorged: the ranges completed past it are stale.
+    data, _ := json.Marshal(Checkpoint{
+        Block:     9,
+        Hash:      blockHash(9, 1).Hex(),
+        Recent:    []CheckpointBlock{{Block: 4, Hash: blockHash(4, 0).Hex()}},
+        Completed: []BlockRange{{From: 20, To: 29}},
+    })
+    if err := os.WriteFile(cfg.CheckpointFile, data, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    assertScanned(t, queried(), 49, []BlockRange{{From: 0, To: 4}})
+    if got := out.blocks(); len(got) != 1 || got[0] != 25 {
+        t.Fatalf("written blocks = %v, want [25]", got)
+    }
+}
+
+func TestClipRanges(t *testing.T) {
+    got := clipRanges([]BlockRange{{From: 50, To: 60}, {From: 0, To: 15}, {From: 16, To: 20}, {From: 90, To: 200}, {From: 55, To: 58}}, 10, 100)
+    want := []BlockRange{{From: 10, To: 20}, {From: 50, To: 60}, {From: 90, To: 100}}
+    if len(got) != len(want) {
+        t.Fatalf("clipRanges = %v, want %v", got, want)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("clipRanges = %v, want %v", got, want)
+        }
+    }
+}
+
+// failingRange makes node fail eth_getLogs over [10, 19] the given number of
+// times, or always when failures is negative.
+func failingRange(node *fakeNode, failures int) {
+    var mu sync.Mutex
+    node.getLogs = func(from, to uint64) ([]types.Log, error) {
+        mu.Lock()
+        defer mu.Unlock()
+        if from == 10 && failures != 0 {
+            failures--
+            return nil, errors.New("upstream unavailable")
+        }
+        var out []types.Log
+        for _, lg := range node.logs {
+            if lg.BlockNumber >= from && lg.BlockNumber <= to {
+                out = append(out, lg)
+            }
+        }
+        return out, nil
+    }
+}
+
+func TestOnErrorContinue(t *testing.T) {
+    logs := []types.Log{transferLog(5, 0, 1), transferLog(15, 0, 2), transferLog(25, 0, 3), transferLog(35, 0, 4)}
+    cases := []struct {
+        name       string
+        onError    string
+        retry      bool
+        failures   int
+        wantErr    string
+        wantBlocks string
+    }{
+        {name: "abort", failures: -1, wantErr: "upstream unavailable", wantBlocks: "[5]"},
+        {name: "continue", onError: config.OnErrorContinue, failures: -1, wantErr: "1 block range(s) failed: 10→19", wantBlocks: "[5 25 35]"},
+        {name: "retry recovers", onError: config.OnErrorContinue, retry: true, failures: 1, wantBlocks: "[5 25 35 15]"},
+        {name: "retry fails again", onError: config.OnErrorContinue, retry: true, failures: -1, wantErr: "1 block range(s) failed: 10→19", wantBlocks: "[5 25 35]"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            node := newFakeNode(t, 39, logs...)
+            failingRange(node, tc.failures)
+            cfg := testConfig(t, 0)
+            cfg.OnError = tc.onError
+            cfg.RetryFailedRanges = tc.retry
+            out := &memorySink{}
+
+            err := New(cfg, node.dial(t), out).Run(context.Background())
+            if tc.wantErr == "" && err != nil {
+                t.Fatalf("Run: %v", err)
+            }
+            if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+                t.Fatalf("Run = %v, want %q", err, tc.wantErr)
+            }
+            if got := fmt.Sprint(out.blocks()); got != tc.wantBlocks {
+                t.Errorf("written blocks = %s, want %s", got, tc.wantBlocks)
+            }
+        })
+    }
+}
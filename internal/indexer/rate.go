@@ -0,0 +1,139 @@
+package indexer
+
+import (
+	"sync"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rateKey identifies the events an expected_rate applies to.
+type rateKey struct {
+    contract string
+    event    string
+}
+
+// rateWindow counts the events of one block window and the blocks of it
+// that were indexed so far.
+type rateWindow struct {
+    events  int
+    covered uint64
+}
+
+// rateRule tracks the windows of one expected_rate. Windows are aligned to
+// multiples of the window size so ranges completing out of order still
+// add up; windows the run only partly covers are never checked.
+type rateRule struct {
+    rate    config.ExpectedRate
+    windows map[uint64]*rateWindow
+}
+
+// rateMonitor compares the event volume of completed block windows with the
+// expected_rate of each event and alerts on deviations. It is safe for
+// concurrent use by the workers.
+type rateMonitor struct {
+    chain string
+
+    mu     sync.Mutex
+    rules  map[rateKey]*rateRule
+    alerts int
+}
+
+// newRateMonitor returns the monitor of the expected rates of contracts, or
+// nil when none is configured.
+func newRateMonitor(chain string, contracts []config.ContractConfig) *rateMonitor {
+    rules := make(map[rateKey]*rateRule)
+    for _, c := range contracts {
+        for event, r := range c.ExpectedRate {
+            // Entries expanded from addresses share one rule.
+            key := rateKey{contract: c.Name, event: config.EventName(c, event)}
+            rules[key] = &rateRule{rate: r, windows: make(map[uint64]*rateWindow)}
+        }
+    }
+    if len(rules) == 0 {
+        return nil
+    }
+    return &rateMonitor{chain: chain, rules: rules}
+}
+
+// record counts an event of block, by its names before transforms so
+// sampling and renames don't skew the volume.
+func (m *rateMonitor) record(contract, event string, block uint64) {
+    if m == nil {
+        return
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    rule, ok := m.rules[rateKey{contract: contract, event: event}]
+    if !ok {
+        return
+    }
+    rule.window(block / rule.rate.Window()).events++
+}
+
+// rangeDone marks [from, to] as indexed and checks the windows it completes.
+func (m *rateMonitor) rangeDone(from, to uint64) {
+    if m == nil {
+        return
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    for key, rule := range m.rules {
+        size := rule.rate.Window()
+        for n := from / size; n <= to/size; n++ {
+            start, end := n*size, n*size+size-1
+            if start < from {
+                start = from
+            }
+            if end > to {
+                end = to
+            }
+            w := rule.window(n)
+            w.covered += end - start + 1
+            if w.covered < size {
+                continue
+            }
+            delete(rule.windows, n)
+            m.check(key, rule.rate, n*size, w.events)
+        }
+    }
+}
+
+// check alerts when the events of the window starting at block are outside
+// the bounds of rate.
+func (m *rateMonitor) check(key rateKey, rate config.ExpectedRate, block uint64, events int) {
+    low, high := rate.Bounds()
+    observed := float64(events)
+    if observed >= low && observed <= high {
+        return
+    }
+    direction := "below"
+    if observed > high {
+        direction = "above"
+    }
+    m.alerts++
+    metrics.IncEventRateAlert(m.chain, key.contract, key.event)
+    logrus.Warnf("event volume %s expected_rate | contract=%s event=%s blocks=%d→%d events=%d expected=%g (%g–%g)",
+        direction, key.contract, key.event, block, block+rate.Window()-1, events, rate.Events, low, high)
+}
+
+// alertCount returns the number of alerts raised so far.
+func (m *rateMonitor) alertCount() int {
+    if m == nil {
+        return 0
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.alerts
+}
+
+func (r *rateRule) window(n uint64) *rateWindow {
+    w, ok := r.windows[n]
+    if !ok {
+        w = &rateWindow{}
+        r.windows[n] = w
+    }
+    return w
+}
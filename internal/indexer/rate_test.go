@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// rateContracts returns a Token contract expecting the given number of
+// Transfer events per window of 10 blocks, within the default 50%.
+func rateContracts(events float64) []config.ContractConfig {
+    return []config.ContractConfig{{
+        Name:         "Token",
+        Events:       []string{"Transfer", "Approval"},
+        ExpectedRate: map[string]config.ExpectedRate{"Transfer": {Events: events, Blocks: 10}},
+    }}
+}
+
+// recordEvery records one Transfer every step blocks of [from, to].
+func recordEvery(m *rateMonitor, from, to, step uint64) {
+    for b := from; b <= to; b += step {
+        m.record("Token", "Transfer", b)
+    }
+}
+
+func TestRateMonitorWithinBounds(t *testing.T) {
+    m := newRateMonitor("mainnet", rateContracts(5))
+    recordEvery(m, 0, 29, 2) // 5 per window
+    m.record("Token", "Transfer", 3)
+    m.record("Token", "Approval", 4) // no expected rate
+    m.rangeDone(0, 29)
+    if n := m.alertCount(); n != 0 {
+        t.Fatalf("%d alerts for windows within 50%% of the expected volume", n)
+    }
+}
+
+func TestRateMonitorAlertsOnDeviation(t *testing.T) {
+    hook := logtest.NewGlobal()
+    defer hook.Reset()
+
+    m := newRateMonitor("mainnet", rateContracts(5))
+    recordEvery(m, 0, 9, 5)   // 2 events: below 2.5
+    recordEvery(m, 10, 19, 1) // 10 events: above 7.5
+    recordEvery(m, 20, 29, 2) // 5 events
+    m.rangeDone(0, 29)
+    if n := m.alertCount(); n != 2 {
+        t.Fatalf("alerts = %d, want 2", n)
+    }
+
+    var warnings []string
+    for _, e := range hook.AllEntries() {
+        if e.Level == logrus.WarnLevel {
+            warnings = append(warnings, e.Message)
+        }
+    }
+    if len(warnings) != 2 {
+        t.Fatalf("warnings = %q, want 2", warnings)
+    }
+    if !strings.Contains(warnings[0], "below") || !strings.Contains(warnings[0], "blocks=0→9 events=2") {
+        t.Errorf("first warning = %q", warnings[0])
+    }
+    if !strings.Contains(warnings[1], "above") || !strings.Contains(warnings[1], "blocks=10→19 events=10") {
+        t.Errorf("second warning = %q", warnings[1])
+    }
+}
+
+func TestRateMonitorEmptyWindowIsBelow(t *testing.T) {
+    m := newRateMonitor("mainnet", rateContracts(5))
+    m.rangeDone(0, 9)
+    if n := m.alertCount(); n != 1 {
+        t.Fatalf("alerts = %d for a window without events, want 1", n)
+    }
+}
+
+func TestRateMonitorWindowsAddUpOutOfOrder(t *testing.T) {
+    m := newRateMonitor("mainnet", rateContracts(5))
+    recordEvery(m, 0, 19, 2)
+    // Ranges of 7 blocks straddle the windows and complete out of order.
+    m.rangeDone(7, 13)
+    m.rangeDone(14, 20)
+    if n := m.alertCount(); n != 0 {
+        t.Fatalf("%d alerts before any window was complete", n)
+    }
+    m.rangeDone(0, 6)
+    if n := m.alertCount(); n != 0 {
+        t.Fatalf("%d alerts for complete windows within bounds", n)
+    }
+    rule := m.rules[rateKey{contract: "Token", event: "Transfer"}]
+    if _, ok := rule.windows[0]; ok {
+        t.Error("window 0 still tracked after it was checked")
+    }
+    if w, ok := rule.windows[2]; !ok || w.covered != 1 {
+        t.Errorf("window 2 = %+v, want 1 block covered", w)
+    }
+}
+
+func TestRateMonitorSkipsPartialWindows(t *testing.T) {
+    m := newRateMonitor("mainnet", rateContracts(5))
+    // The run starts and ends mid-window: neither edge window is checked.
+    m.rangeDone(5, 24)
+    if n := m.alertCount(); n != 1 {
+        t.Fatalf("alerts = %d, want 1 for the only complete window", n)
+    }
+}
+
+func TestRateMonitorUnconfigured(t *testing.T) {
+    m := newRateMonitor("mainnet", []config.ContractConfig{{Name: "Token", Events: []string{"Transfer"}}})
+    if m != nil {
+        t.Fatalf("newRateMonitor = %+v, want nil without expected_rate", m)
+    }
+    m.record("Token", "Transfer", 1)
+    m.rangeDone(0, 100)
+    if n := m.alertCount(); n != 0 {
+        t.Fatalf("nil monitor raised %d alerts", n)
+    }
+}
@@ -0,0 +1,95 @@
+package indexer
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultStatusInterval throttles status file writes while ranges complete.
+const DefaultStatusInterval = time.Second
+
+// RunStatus is the JSON document of a status file.
+type RunStatus struct {
+    Chain    string    `json:"chain,omitempty"`
+    Status   string    `json:"status"` // running | finished | error
+    Error    string    `json:"error,omitempty"`
+    Progress *Progress `json:"progress,omitempty"`
+}
+
+// StatusFile mirrors indexer progress into a JSON file that external
+// supervisors can poll (the --status-file of CLI runs). The file is
+// replaced atomically, so readers never see a partial document.
+type StatusFile struct {
+    path     string
+    interval time.Duration
+
+    mu        sync.Mutex
+    cur       RunStatus
+    lastWrite time.Time
+}
+
+// NewStatusFile writes a "running" status for chain to path. Progress is
+// then written at most once per interval; zero writes every update.
+func NewStatusFile(path, chain string, interval time.Duration) *StatusFile {
+    f := &StatusFile{path: path, interval: interval, cur: RunStatus{Chain: chain, Status: "running"}}
+    f.mu.Lock()
+    f.writeLocked()
+    f.mu.Unlock()
+    return f
+}
+
+// StatusFilePath returns the status file of a chain: path itself, or with
+// the chain name inserted before the extension in multi-chain mode.
+func StatusFilePath(path, chain string, multi bool) string {
+    if !multi {
+        return path
+    }
+    ext := filepath.Ext(path)
+    return strings.TrimSuffix(path, ext) + "." + chain + ext
+}
+
+// Update records p; it is meant to be registered with OnProgress.
+func (f *StatusFile) Update(p Progress) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.cur.Progress = &p
+    if time.Since(f.lastWrite) >= f.interval {
+        f.writeLocked()
+    }
+}
+
+// Done records the final outcome of the run and writes it whatever the
+// interval.
+func (f *StatusFile) Done(err error) {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    f.cur.Status = "finished"
+    if err != nil {
+        f.cur.Status = "error"
+        f.cur.Error = err.Error()
+    }
+    f.writeLocked()
+}
+
+func (f *StatusFile) writeLocked() {
+    f.lastWrite = time.Now()
+    data, err := json.MarshalIndent(f.cur, "", "  ")
+    if err != nil {
+        logrus.Warnf("failed to encode status: %v", err)
+        return
+    }
+    tmp := f.path + ".tmp"
+    if err := os.WriteFile(tmp, data, 0o644); err != nil {
+        logrus.Warnf("failed to write status file: %v", err)
+        return
+    }
+    if err := os.Rename(tmp, f.path); err != nil {
+        logrus.Warnf("failed to write status file: %v", err)
+    }
+}
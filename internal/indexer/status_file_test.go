@@ -0,0 +1,97 @@
+package indexer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readStatus decodes the status file at path.
+func readStatus(t *testing.T, path string) RunStatus {
+    t.Helper()
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var st RunStatus
+    if err := json.Unmarshal(data, &st); err != nil {
+        t.Fatalf("status file %s: %v", data, err)
+    }
+    return st
+}
+
+func TestStatusFileUpdatesAsRangesComplete(t *testing.T) {
+    node := newFakeNode(t, 29, transferLog(3, 0, 1), transferLog(12, 0, 2), transferLog(25, 0, 3))
+    path := filepath.Join(t.TempDir(), "status.json")
+    status := NewStatusFile(path, "mainnet", 0)
+    if st := readStatus(t, path); st.Status != "running" || st.Chain != "mainnet" || st.Progress != nil {
+        t.Fatalf("initial status = %+v", st)
+    }
+
+    // Read the file back after every range, as a supervisor would.
+    var seen []RunStatus
+    idx := New(testConfig(t, 0), node.dial(t), &memorySink{})
+    idx.OnProgress(func(p Progress) {
+        status.Update(p)
+        seen = append(seen, readStatus(t, path))
+    })
+    err := idx.Run(context.Background())
+    status.Done(err)
+    if err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+
+    if len(seen) != 3 {
+        t.Fatalf("status read %d times, want once per range", len(seen))
+    }
+    for i, st := range seen {
+        if st.Status != "running" || st.Progress == nil {
+            t.Fatalf("status after range %d = %+v", i, st)
+        }
+        if p := st.Progress; p.RangesProcessed != i+1 || p.EventsWritten != i+1 || p.CurrentBlock != uint64(10*i+9) || p.EndBlock != 29 {
+            t.Errorf("progress after range %d = %+v", i, p)
+        }
+    }
+    if st := readStatus(t, path); st.Status != "finished" || st.Error != "" || st.Progress == nil || st.Progress.CurrentBlock != 29 {
+        t.Errorf("final status = %+v", st)
+    }
+    if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+        t.Errorf("temporary file left behind: %v", err)
+    }
+}
+
+func TestStatusFileThrottlesProgress(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "status.json")
+    status := NewStatusFile(path, "", time.Hour)
+    status.Update(Progress{CurrentBlock: 9})
+    if st := readStatus(t, path); st.Progress != nil {
+        t.Errorf("progress written within the interval: %+v", st.Progress)
+    }
+    // The outcome is always written, with the latest progress.
+    status.Done(errors.New("rpc unreachable"))
+    st := readStatus(t, path)
+    if st.Status != "error" || st.Error != "rpc unreachable" || st.Progress == nil || st.Progress.CurrentBlock != 9 {
+        t.Errorf("final status = %+v", st)
+    }
+}
+
+func TestStatusFilePath(t *testing.T) {
+    cases := []struct {
+        path, chain string
+        multi       bool
+        want        string
+    }{
+        {"run/status.json", "mainnet", false, "run/status.json"},
+        {"run/status.json", "mainnet", true, "run/status.mainnet.json"},
+        {"status", "base", true, "status.base"},
+    }
+    for _, tc := range cases {
+        if got := StatusFilePath(tc.path, tc.chain, tc.multi); got != tc.want {
+            t.Errorf("StatusFilePath(%q, %q, %v) = %q, want %q", tc.path, tc.chain, tc.multi, got, tc.want)
+        }
+    }
+}
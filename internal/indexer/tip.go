@@ -0,0 +1,58 @@
+package indexer
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultTipPollInterval is how often follow mode polls the chain head to
+// flush the pending logs that reached follow_confirmations.
+const DefaultTipPollInterval = 5 * time.Second
+
+// chunkSizer picks the size of the next block range: catchup blocks while
+// the range starts at least threshold blocks below the head, tip blocks
+// after that, so a back-fill uses few large eth_getLogs calls and the last
+// blocks before the head are written promptly in small ranges.
+type chunkSizer struct {
+    tip       uint64
+    catchup   uint64
+    threshold uint64
+
+    // nearTip is set once a range was sized for the tip, to log the
+    // transition once. Ranges are sized by a single goroutine at a time.
+    nearTip bool
+}
+
+// newChunkSizer returns the sizer of chunk_size tip, catchup_chunk_size and
+// tip_threshold; zero catchup and threshold take their defaults.
+func newChunkSizer(tip, catchup, threshold uint64) chunkSizer {
+    if catchup == 0 {
+        catchup = tip
+    }
+    if threshold == 0 {
+        threshold = catchup
+    }
+    return chunkSizer{tip: tip, catchup: catchup, threshold: threshold}
+}
+
+// size returns the size of the range starting at from when head is the
+// chain head.
+func (c *chunkSizer) size(from, head uint64) uint64 {
+    if from <= head && head-from >= c.threshold {
+        return c.catchup
+    }
+    if !c.nearTip && c.catchup != c.tip {
+        logrus.Infof("Within %d blocks of the head at block %d, indexing ranges of %d blocks", c.threshold, from, c.tip)
+        c.nearTip = true
+    }
+    return c.tip
+}
+
+// tipPollInterval returns tip_poll_interval_ms, or the default when unset.
+func (idx *Indexer) tipPollInterval() time.Duration {
+    if idx.cfg.TipPollIntervalMS > 0 {
+        return time.Duration(idx.cfg.TipPollIntervalMS) * time.Millisecond
+    }
+    return DefaultTipPollInterval
+}
@@ -0,0 +1,100 @@
+package indexer
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestChunkSizerTransition(t *testing.T) {
+    c := newChunkSizer(10, 100, 50)
+    for _, tc := range []struct {
+        from, head, want uint64
+    }{
+        {from: 0, head: 1_000, want: 100},
+        {from: 950, head: 1_000, want: 100}, // exactly threshold blocks below
+        {from: 951, head: 1_000, want: 10},
+        {from: 1_000, head: 1_000, want: 10},
+        {from: 1_005, head: 1_000, want: 10}, // past the head
+        {from: 0, head: 1_000, want: 100},    // the head moved away again
+    } {
+        if got := c.size(tc.from, tc.head); got != tc.want {
+            t.Errorf("size(%d, %d) = %d, want %d", tc.from, tc.head, got, tc.want)
+        }
+    }
+}
+
+func TestChunkSizerDefaults(t *testing.T) {
+    // Without catchup_chunk_size every range has chunk_size blocks.
+    plain := newChunkSizer(10, 0, 0)
+    for _, from := range []uint64{0, 990, 1_000} {
+        if got := plain.size(from, 1_000); got != 10 {
+            t.Errorf("size(%d) without catchup = %d, want 10", from, got)
+        }
+    }
+    // Without tip_threshold the switch happens one catch-up range below
+    // the head.
+    c := newChunkSizer(10, 100, 0)
+    if got := c.size(900, 1_000); got != 100 {
+        t.Errorf("size(900) = %d, want 100", got)
+    }
+    if got := c.size(901, 1_000); got != 10 {
+        t.Errorf("size(901) = %d, want 10", got)
+    }
+}
+
+func TestChunkSizerLogsTransitionOnce(t *testing.T) {
+    hook := logtest.NewGlobal()
+    defer hook.Reset()
+
+    c := newChunkSizer(10, 100, 50)
+    for from := uint64(0); from <= 1_000; {
+        from += c.size(from, 1_000)
+    }
+    var notes []string
+    for _, e := range hook.AllEntries() {
+        if strings.Contains(e.Message, "Within 50 blocks of the head") {
+            notes = append(notes, e.Message)
+        }
+    }
+    if len(notes) != 1 || !strings.Contains(notes[0], "at block 1000") {
+        t.Fatalf("transition messages = %q, want one at block 1000", notes)
+    }
+}
+
+func TestRunSwitchesToTipChunks(t *testing.T) {
+    node := newFakeNode(t, 99, transferLog(5, 0, 1), transferLog(97, 0, 2))
+    queried := scanned(node)
+    cfg := testConfig(t, 0)
+    cfg.CatchupChunkSize = 40
+    cfg.TipThreshold = 30
+    out := &memorySink{}
+
+    if err := New(cfg, node.dial(t), out).Run(context.Background()); err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+    // [0, 39] and [40, 79] start at least 30 blocks below head 99; the
+    // rest is indexed in ranges of chunk_size 10.
+    want := []BlockRange{{From: 0, To: 39}, {From: 40, To: 79}, {From: 80, To: 89}, {From: 90, To: 99}}
+    if got := queried(); fmt.Sprint(got) != fmt.Sprint(want) {
+        t.Fatalf("queried ranges = %v, want %v", got, want)
+    }
+    if got := out.blocks(); len(got) != 2 || got[0] != 5 || got[1] != 97 {
+        t.Fatalf("written blocks = %v, want [5 97]", got)
+    }
+}
+
+func TestTipPollInterval(t *testing.T) {
+    idx := New(testConfig(t, 0), nil, nil)
+    if got := idx.tipPollInterval(); got != DefaultTipPollInterval {
+        t.Errorf("tipPollInterval = %s, want the default %s", got, DefaultTipPollInterval)
+    }
+    idx.cfg.TipPollIntervalMS = 250
+    if got := idx.tipPollInterval(); got != 250*time.Millisecond {
+        t.Errorf("tipPollInterval = %s, want 250ms", got)
+    }
+}
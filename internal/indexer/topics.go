@@ -0,0 +1,96 @@
+package indexer
+
+import (
+	"slices"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// topicKey identifies an event of one contract; the zero address stands for
+// address-less entries.
+type topicKey struct {
+    address common.Address
+    topic0  common.Hash
+}
+
+// topicFilter is a configured event restricted by indexed parameter values.
+// It gets its own eth_getLogs query: topic0 followed by topics, where each
+// position ORs its values and positions are ANDed.
+type topicFilter struct {
+    key    topicKey
+    topics [][]common.Hash
+}
+
+// matrix returns the filter as topic matrix, topic0 first.
+func (f topicFilter) matrix() [][]common.Hash {
+    return append([][]common.Hash{{f.key.topic0}}, f.topics...)
+}
+
+// eventTopicFilters returns the events of c restricted by its topics config.
+// Invalid entries were rejected by config validation; should one slip
+// through it is logged and the event is not queried at all rather than
+// queried unrestricted.
+func eventTopicFilters(c config.ContractConfig) []topicFilter {
+    if len(c.Topics) == 0 || c.ParsedABI == nil {
+        return nil
+    }
+    var addr common.Address
+    if c.Address != "" {
+        addr = common.HexToAddress(c.Address)
+    }
+    var filters []topicFilter
+    for _, evName := range c.Events {
+        if _, ok := c.Topics[evName]; !ok {
+            continue
+        }
+        topics, err := config.EventTopicFilter(c, evName)
+        if err != nil {
+            logrus.Errorf("skipping event: %v", err)
+            continue
+        }
+        ev, _ := config.LookupEvent(c.ParsedABI, evName)
+        filters = append(filters, topicFilter{
+            key:    topicKey{address: addr, topic0: ev.ID},
+            topics: topics,
+        })
+    }
+    return filters
+}
+
+// matchesTopics reports whether lg satisfies the topic filter of its event,
+// if any. Queries of unrestricted events may still return logs of restricted
+// ones (topic0 lists are shared across the contracts of one query), so
+// fetched logs are checked again. A contract's own configuration wins over
+// an address-less entry for the same event.
+func (idx *Indexer) matchesTopics(lg *types.Log) bool {
+    if len(idx.topicFilters) == 0 || len(lg.Topics) == 0 {
+        return true
+    }
+    key := topicKey{address: lg.Address, topic0: lg.Topics[0]}
+    topics, ok := idx.topicFilters[key]
+    if !ok {
+        if _, plain := idx.plainEvents[key]; plain {
+            return true
+        }
+        if c, known := idx.contractByAddress[lg.Address]; known && len(c.Events) == 0 {
+            return true // every event of the contract is indexed
+        }
+        key.address = common.Address{}
+        if topics, ok = idx.topicFilters[key]; !ok {
+            return true
+        }
+    }
+    for i, accepted := range topics {
+        if len(accepted) == 0 {
+            continue
+        }
+        if len(lg.Topics) <= i+1 || !slices.Contains(accepted, lg.Topics[i+1]) {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,65 @@
+// Package metrics exposes process-wide operational metrics through the
+// standard library expvar registry. They are served as JSON by the API server
+// under /debug/vars.
+package metrics
+
+import (
+	"expvar"
+	"time"
+)
+
+var (
+    // rpcBreakerState holds the circuit breaker state per RPC endpoint
+    // ("closed", "open" or "half-open").
+    rpcBreakerState = expvar.NewMap("rpc_circuit_breaker_state")
+    // rpcBreakerTrips counts how many times each endpoint's breaker opened.
+    rpcBreakerTrips = expvar.NewMap("rpc_circuit_breaker_trips")
+    // indexerQueued is the number of block ranges waiting in the worker
+    // queue per chain. Constantly near zero means workers are starved,
+    // constantly at queue_depth means the enqueuer is blocked.
+    indexerQueued = expvar.NewMap("indexer_queue_occupancy")
+    // indexerEnqueueBlocked accumulates the seconds the enqueuer spent
+    // waiting for room in the full worker queue per chain.
+    indexerEnqueueBlocked = expvar.NewMap("indexer_enqueue_blocked_seconds")
+    // eventRateAlerts counts the block windows whose event volume deviated
+    // from expected_rate, per chain, contract and event.
+    eventRateAlerts = expvar.NewMap("indexer_event_rate_alerts")
+)
+
+// chainLabel keys per-chain metrics; single-chain runs have no chain name.
+func chainLabel(chain string) string {
+    if chain == "" {
+        return "default"
+    }
+    return chain
+}
+
+// AddIndexerQueued adjusts the worker queue occupancy of a chain by delta.
+func AddIndexerQueued(chain string, delta int64) {
+    indexerQueued.Add(chainLabel(chain), delta)
+}
+
+// AddIndexerEnqueueBlocked records time the enqueuer of a chain waited for a
+// free queue slot.
+func AddIndexerEnqueueBlocked(chain string, d time.Duration) {
+    indexerEnqueueBlocked.AddFloat(chainLabel(chain), d.Seconds())
+}
+
+// IncEventRateAlert counts a block window in which an event of a contract
+// deviated from its expected rate.
+func IncEventRateAlert(chain, contract, event string) {
+    eventRateAlerts.Add(chainLabel(chain)+"/"+contract+"/"+event, 1)
+}
+
+// SetRPCBreakerState records the current breaker state of an endpoint.
+func SetRPCBreakerState(endpoint, state string) {
+    v := new(expvar.String)
+    v.Set(state)
+    rpcBreakerState.Set(endpoint, v)
+}
+
+// IncRPCBreakerTrips increments the number of times the endpoint's breaker
+// opened.
+func IncRPCBreakerTrips(endpoint string) {
+    rpcBreakerTrips.Add(endpoint, 1)
+}
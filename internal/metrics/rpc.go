@@ -0,0 +1,91 @@
+package metrics
+
+import (
+	"expvar"
+	"sync"
+	"time"
+)
+
+// RPCEndpoint is the failure record of one RPC endpoint, as served by the
+// API under /debug/rpc. Methods are the client helpers (GetLogs,
+// GetHeaderByNumber, …) rather than raw JSON-RPC names.
+type RPCEndpoint struct {
+    // Retries counts attempts beyond the first of a call, by method.
+    Retries map[string]uint64 `json:"retries"`
+    // Failures counts calls that failed after all attempts, by method.
+    Failures        map[string]uint64 `json:"failures"`
+    LastError       string            `json:"last_error,omitempty"`
+    LastErrorMethod string            `json:"last_error_method,omitempty"`
+    LastErrorAt     *time.Time        `json:"last_error_at,omitempty"`
+    // BreakerState is the circuit breaker state, when one is configured.
+    BreakerState string `json:"breaker_state,omitempty"`
+}
+
+var (
+    rpcMu        sync.Mutex
+    rpcEndpoints = make(map[string]*RPCEndpoint)
+)
+
+func init() {
+    expvar.Publish("rpc_endpoints", expvar.Func(func() any { return RPCEndpoints() }))
+}
+
+// rpcEndpointLocked returns the record of endpoint, creating it if needed.
+func rpcEndpointLocked(endpoint string) *RPCEndpoint {
+    e, ok := rpcEndpoints[endpoint]
+    if !ok {
+        e = &RPCEndpoint{Retries: make(map[string]uint64), Failures: make(map[string]uint64)}
+        rpcEndpoints[endpoint] = e
+    }
+    return e
+}
+
+// IncRPCRetry counts a retried attempt of method on endpoint.
+func IncRPCRetry(endpoint, method string) {
+    rpcMu.Lock()
+    rpcEndpointLocked(endpoint).Retries[method]++
+    rpcMu.Unlock()
+}
+
+// IncRPCFailure counts a call of method on endpoint that failed after all
+// attempts.
+func IncRPCFailure(endpoint, method string) {
+    rpcMu.Lock()
+    rpcEndpointLocked(endpoint).Failures[method]++
+    rpcMu.Unlock()
+}
+
+// SetRPCLastError records the error of the latest failed attempt on
+// endpoint. msg must already be redacted.
+func SetRPCLastError(endpoint, method, msg string) {
+    now := time.Now().UTC()
+    rpcMu.Lock()
+    e := rpcEndpointLocked(endpoint)
+    e.LastError, e.LastErrorMethod, e.LastErrorAt = msg, method, &now
+    rpcMu.Unlock()
+}
+
+// RPCEndpoints returns a copy of the failure records of every endpoint that
+// saw a retry or failure, keyed by redacted endpoint URL.
+func RPCEndpoints() map[string]RPCEndpoint {
+    rpcMu.Lock()
+    defer rpcMu.Unlock()
+
+    out := make(map[string]RPCEndpoint, len(rpcEndpoints))
+    for endpoint, e := range rpcEndpoints {
+        c := *e
+        c.Retries = make(map[string]uint64, len(e.Retries))
+        for k, v := range e.Retries {
+            c.Retries[k] = v
+        }
+        c.Failures = make(map[string]uint64, len(e.Failures))
+        for k, v := range e.Failures {
+            c.Failures[k] = v
+        }
+        if s, ok := rpcBreakerState.Get(endpoint).(*expvar.String); ok {
+            c.BreakerState = s.Value()
+        }
+        out[endpoint] = c
+    }
+    return out
+}
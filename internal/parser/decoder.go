@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Decoder fills the event of a log emitted by a configured contract. evt
+// already holds the generic fields (tx_hash, block_number, contract,
+// contract_name…); the decoder sets event_name and the event parameters.
+//
+// Protocol-specific decoders are selected per contract with its decoder
+// setting. They can run before the generic decoding, or after it to adjust
+// its output, by calling ABIDecoder themselves.
+type Decoder interface {
+    Decode(cfg *config.ContractConfig, lg *types.Log, evt sink.Event) error
+}
+
+// DecoderFunc adapts a function to the Decoder interface.
+type DecoderFunc func(cfg *config.ContractConfig, lg *types.Log, evt sink.Event) error
+
+// Decode calls f.
+func (f DecoderFunc) Decode(cfg *config.ContractConfig, lg *types.Log, evt sink.Event) error {
+    return f(cfg, lg, evt)
+}
+
+var (
+    // ErrUnknownEvent is returned by decoders for logs whose topic0 matches
+    // no event of the contract. Contracts indexing all their events then
+    // fall back to the signature database.
+    ErrUnknownEvent = errors.New("event not found in ABI")
+    // ErrSkipEvent is returned by decoders for events the contract does not
+    // index; the log yields no event.
+    ErrSkipEvent = errors.New("event not indexed")
+)
+
+// DefaultDecoder is the name of the generic ABI decoder, used by contracts
+// without a decoder setting.
+const DefaultDecoder = "abi"
+
+var (
+    decodersMu sync.RWMutex
+    decoders   = make(map[string]Decoder)
+)
+
+func init() {
+    RegisterDecoder(DefaultDecoder, ABIDecoder{})
+}
+
+// RegisterDecoder makes a decoder selectable through the decoder setting of
+// a contract. It is meant to be called from init functions. Registering a
+// name twice panics.
+func RegisterDecoder(name string, d Decoder) {
+    decodersMu.Lock()
+    defer decodersMu.Unlock()
+
+    if d == nil {
+        panic("parser: RegisterDecoder decoder is nil for " + name)
+    }
+    if _, dup := decoders[name]; dup {
+        panic("parser: RegisterDecoder called twice for " + name)
+    }
+    decoders[name] = d
+    config.RegisterDecoder(name)
+}
+
+// LookupDecoder returns the decoder registered under name; an empty name
+// selects the generic ABI decoder.
+func LookupDecoder(name string) (Decoder, error) {
+    if name == "" {
+        name = DefaultDecoder
+    }
+    decodersMu.RLock()
+    defer decodersMu.RUnlock()
+    d, ok := decoders[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown decoder: %s", name)
+    }
+    return d, nil
+}
+
+// ABIDecoder is the generic decoder: it unpacks the topics and data of a log
+// with the event of the contract ABI matching its topic0.
+type ABIDecoder struct{}
+
+// Decode implements Decoder.
+func (ABIDecoder) Decode(cfg *config.ContractConfig, lg *types.Log, evt sink.Event) error {
+    if cfg.ParsedABI == nil || len(lg.Topics) == 0 {
+        return ErrUnknownEvent
+    }
+    // Derive event definition via its signature hash (topic[0]).
+    evDef, err := findEventByID(cfg.ParsedABI, lg.Topics[0])
+    if err != nil {
+        return err
+    }
+    evt["event_name"] = evDef.Name
+    if !allowsTopic(*cfg, evDef.ID) {
+        return ErrSkipEvent
+    }
+
+    var indexedArgs abi.Arguments
+    for _, input := range evDef.Inputs {
+        if input.Indexed {
+            indexedArgs = append(indexedArgs, input)
+        }
+    }
+
+    // A log whose topic count disagrees with the ABI (malformed, or emitted
+    // by a contract with a different event layout) would be decoded into
+    // wrong values; keep what can be trusted and flag it instead.
+    topicsMatch := len(lg.Topics)-1 == len(indexedArgs)
+    if !topicsMatch {
+        evt["decode_warning"] = fmt.Sprintf("log has %d indexed topics but the ABI expects %d; indexed arguments not decoded", len(lg.Topics)-1, len(indexedArgs))
+    }
+
+    // Decode non-indexed params (contained in log.Data).
+    args := make(map[string]interface{})
+    // Unpack with the definition found by topic0: going through the ABI by
+    // name could pick another event or a method sharing the key.
+    if err := evDef.Inputs.UnpackIntoMap(args, lg.Data); err != nil {
+        if topicsMatch {
+            return err
+        }
+        // The data layout is likely off as well: keep it raw.
+        evt["data"] = hexutil.Encode(lg.Data)
+    }
+
+    // Decode indexed params (topics[1:]).
+    if !topicsMatch {
+        indexedArgs = nil
+    }
+    for i, arg := range indexedArgs {
+        topicVals := make(map[string]interface{})
+        // ParseTopicsIntoMap mutates the provided map and returns only error.
+        err := abi.ParseTopicsIntoMap(topicVals, abi.Arguments{arg}, []common.Hash{lg.Topics[i+1]})
+        if err == nil {
+            for k, v := range topicVals {
+                args[k] = v
+            }
+        } else {
+            // On failure, keep raw topic so data is not discarded.
+            args[arg.Name] = lg.Topics[i+1].Hex()
+        }
+    }
+
+    normalizeArgs(evDef.Inputs, args)
+
+    // Merge decoded params into the event map.
+    for k, v := range args {
+        evt[k] = v
+    }
+    return nil
+}
+
+// findEventByID searches the ABI for an event whose ID matches the provided
+// signature hash.
+func findEventByID(contractABI *abi.ABI, id common.Hash) (*abi.Event, error) {
+    for _, ev := range contractABI.Events {
+        if ev.ID == id {
+            return &ev, nil
+        }
+    }
+    return nil, fmt.Errorf("%w: no event with ID %s", ErrUnknownEvent, id.Hex())
+}
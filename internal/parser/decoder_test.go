@@ -0,0 +1,115 @@
+package parser
+
+import (
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// packedID is the topic0 of an event missing from tokenABI whose
+// parameters are packed in its data.
+var packedID = crypto.Keccak256Hash([]byte("Packed(bytes)"))
+
+func init() {
+    // test-scaled reports Transfer values in thousands, after the generic
+    // decoding; test-packed decodes Packed itself, before it.
+    RegisterDecoder("test-scaled", DecoderFunc(func(cfg *config.ContractConfig, lg *types.Log, evt sink.Event) error {
+        if err := (ABIDecoder{}).Decode(cfg, lg, evt); err != nil {
+            return err
+        }
+        if evt["event_name"] == "Transfer" {
+            evt["value"] = evt["value"].(string) + "000"
+            evt["scaled"] = true
+        }
+        return nil
+    }))
+    RegisterDecoder("test-packed", DecoderFunc(func(cfg *config.ContractConfig, lg *types.Log, evt sink.Event) error {
+        if lg.Topics[0] == packedID {
+            evt["event_name"] = "Packed"
+            evt["flag"] = lg.Data[0]
+            return nil
+        }
+        return ABIDecoder{}.Decode(cfg, lg, evt)
+    }))
+}
+
+// decoderParser returns a parser for liveToken with tokenABI and decoder.
+func decoderParser(t *testing.T, decoder string, events ...string) *Parser {
+    t.Helper()
+    c := tokenContract(t, events...)
+    c.Decoder = decoder
+    return New(&config.Config{Contracts: []config.ContractConfig{c}}, nil)
+}
+
+func TestCustomDecoderOverridesOneEvent(t *testing.T) {
+    p := decoderParser(t, "test-scaled")
+    evt, err := p.Decode(transferFrom(liveToken, 5))
+    if err != nil || evt["value"] != "7000" || evt["scaled"] != true || evt["from"] != common.HexToAddress("0x01") {
+        t.Fatalf("Decode(Transfer) = %v, %v", evt, err)
+    }
+    evt, err = p.Decode(approvalFrom(liveToken, 5))
+    if err != nil || evt["value"] != "7" || evt["scaled"] != nil {
+        t.Fatalf("Decode(Approval) = %v, %v; want the generic output", evt, err)
+    }
+
+    // The generic decoder still applies to contracts without the setting.
+    if evt, err := decoderParser(t, "").Decode(transferFrom(liveToken, 5)); err != nil || evt["value"] != "7" {
+        t.Fatalf("default Decode(Transfer) = %v, %v", evt, err)
+    }
+}
+
+func TestCustomDecoderRunsBeforeABI(t *testing.T) {
+    lg := transferFrom(liveToken, 5)
+    lg.Topics = []common.Hash{packedID}
+    lg.Data = []byte{0x2a}
+
+    evt, err := decoderParser(t, "test-packed").Decode(lg)
+    if err != nil || evt["event_name"] != "Packed" || evt["flag"] != byte(0x2a) || evt["contract_name"] != "Token" {
+        t.Fatalf("Decode(Packed) = %v, %v", evt, err)
+    }
+    if evt, err := decoderParser(t, "test-packed").Decode(transferFrom(liveToken, 5)); err != nil || evt["event_name"] != "Transfer" {
+        t.Fatalf("Decode(Transfer) = %v, %v; want the ABI fallback", evt, err)
+    }
+    // Without the decoder the log is unknown to the ABI.
+    if _, err := decoderParser(t, "", "Transfer").Decode(lg); err == nil {
+        t.Fatal("generic decoder decoded Packed")
+    }
+}
+
+func TestCustomDecoderHonoursEventsList(t *testing.T) {
+    if evt, err := decoderParser(t, "test-scaled", "Transfer").Decode(approvalFrom(liveToken, 5)); err != nil || evt != nil {
+        t.Fatalf("Decode(Approval) = %v, %v; want it dropped", evt, err)
+    }
+}
+
+func TestDecoderRegistry(t *testing.T) {
+    if d, err := LookupDecoder(""); err != nil || d != (ABIDecoder{}) {
+        t.Errorf("LookupDecoder(\"\") = %v, %v; want ABIDecoder", d, err)
+    }
+    if _, err := LookupDecoder("nosuchdecoder"); err == nil {
+        t.Error("LookupDecoder accepted an unregistered name")
+    }
+    if !config.IsDecoder("test-scaled") || config.IsDecoder("nosuchdecoder") {
+        t.Error("config does not know the registered decoders")
+    }
+    for name, d := range map[string]Decoder{"test-scaled": ABIDecoder{}, "test-nil": nil} {
+        func() {
+            defer func() {
+                if recover() == nil {
+                    t.Errorf("RegisterDecoder(%q, %v) did not panic", name, d)
+                }
+            }()
+            RegisterDecoder(name, d)
+        }()
+    }
+
+    // An unknown decoder falls back to the ABI decoder.
+    if evt, err := decoderParser(t, "nosuchdecoder").Decode(transferFrom(liveToken, 5)); err != nil || evt["value"] != "7" {
+        t.Fatalf("Decode with an unknown decoder = %v, %v", evt, err)
+    }
+}
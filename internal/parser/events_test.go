@@ -0,0 +1,231 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// tokenABI is the ABI of an ERC-20 with its Transfer and Approval events.
+const tokenABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"Approval","inputs":[
+	{"indexed":true,"name":"owner","type":"address"},
+	{"indexed":true,"name":"spender","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]}]`
+
+var approvalID = crypto.Keccak256Hash([]byte("Approval(address,address,uint256)"))
+
+// tokenContract returns liveToken with tokenABI, indexing events.
+func tokenContract(t *testing.T, events ...string) config.ContractConfig {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(tokenABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return config.ContractConfig{Name: "Token", Address: liveToken.Hex(), Events: events, ParsedABI: &parsed}
+}
+
+// approvalFrom returns an Approval log of addr in block.
+func approvalFrom(addr common.Address, block uint64) *types.Log {
+    lg := transferFrom(addr, block)
+    lg.Topics[0] = approvalID
+    return lg
+}
+
+func TestParseDropsEventsMissingFromEventsList(t *testing.T) {
+    p := New(&config.Config{Contracts: []config.ContractConfig{tokenContract(t, "Transfer")}}, codeNode(t).dial(t))
+
+    evt, err := p.Parse(context.Background(), approvalFrom(liveToken, 5))
+    if err != nil || evt != nil {
+        t.Fatalf("Parse(Approval) = %v, %v; want it dropped", evt, err)
+    }
+    evt, err = p.Parse(context.Background(), transferFrom(liveToken, 5))
+    if err != nil || evt == nil || evt["event_name"] != "Transfer" {
+        t.Fatalf("Parse(Transfer) = %v, %v", evt, err)
+    }
+    if evt, err := p.Decode(approvalFrom(liveToken, 5)); err != nil || evt != nil {
+        t.Fatalf("Decode(Approval) = %v, %v; want it dropped", evt, err)
+    }
+}
+
+func TestParseEmptyEventsListKeepsAll(t *testing.T) {
+    p := New(&config.Config{Contracts: []config.ContractConfig{tokenContract(t)}}, nil)
+    for _, lg := range []*types.Log{transferFrom(liveToken, 5), approvalFrom(liveToken, 5)} {
+        if evt, err := p.Decode(lg); err != nil || evt == nil {
+            t.Fatalf("Decode(%s) = %v, %v", lg.Topics[0].Hex(), evt, err)
+        }
+    }
+}
+
+func TestEventsListDefersToAddressLessEntry(t *testing.T) {
+    anyApproval := tokenContract(t, "Approval")
+    anyApproval.Name, anyApproval.Address = "AnyApproval", ""
+    p := New(&config.Config{Contracts: []config.ContractConfig{tokenContract(t, "Transfer"), anyApproval}}, nil)
+
+    evt, err := p.Decode(approvalFrom(liveToken, 5))
+    if err != nil || evt == nil || evt["contract_name"] != "AnyApproval" || evt["event_name"] != "Approval" {
+        t.Fatalf("Decode(Approval) = %v, %v; want it decoded by AnyApproval", evt, err)
+    }
+}
+
+// overloadedABI declares two Transfer events of different signatures;
+// go-ethereum keys the second one Transfer0.
+const overloadedABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"amount","type":"uint256"}]}]`
+
+// mintLog returns a log of the two-argument Transfer(address,uint256).
+func mintLog(addr common.Address, block uint64) *types.Log {
+    lg := transferFrom(addr, block)
+    lg.Topics = []common.Hash{crypto.Keccak256Hash([]byte("Transfer(address,uint256)")), common.HexToHash("0x02")}
+    return lg
+}
+
+func TestOverloadedEventsDecodeByTopic0(t *testing.T) {
+    parsed, err := abi.JSON(strings.NewReader(overloadedABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    contract := func(events ...string) *Parser {
+        return New(&config.Config{Contracts: []config.ContractConfig{{Name: "Token", Address: liveToken.Hex(), Events: events, ParsedABI: &parsed}}}, nil)
+    }
+
+    p := contract()
+    evt, err := p.Decode(transferFrom(liveToken, 5))
+    if err != nil || evt["event_name"] != "Transfer" || evt["from"] != common.HexToAddress("0x01") || evt["value"] != "7" {
+        t.Fatalf("Decode(Transfer) = %v, %v", evt, err)
+    }
+    evt, err = p.Decode(mintLog(liveToken, 5))
+    if err != nil || evt["event_name"] != "Transfer0" || evt["to"] != common.HexToAddress("0x02") || evt["amount"] != "7" {
+        t.Fatalf("Decode(Transfer0) = %v, %v", evt, err)
+    }
+    if _, ok := evt["from"]; ok {
+        t.Errorf("Transfer0 decoded with the arguments of Transfer: %v", evt)
+    }
+
+    // Each variant can be selected by its suffixed name or its signature.
+    for _, ref := range []string{"Transfer0", "Transfer(address,uint256)"} {
+        p := contract(ref)
+        if evt, err := p.Decode(transferFrom(liveToken, 5)); err != nil || evt != nil {
+            t.Errorf("events [%s]: Decode(Transfer) = %v, %v; want it dropped", ref, evt, err)
+        }
+        if evt, err := p.Decode(mintLog(liveToken, 5)); err != nil || evt == nil || evt["event_name"] != "Transfer0" {
+            t.Errorf("events [%s]: Decode(Transfer0) = %v, %v", ref, evt, err)
+        }
+    }
+    if evt, err := contract("Transfer").Decode(mintLog(liveToken, 5)); err != nil || evt != nil {
+        t.Errorf("events [Transfer]: Decode(Transfer0) = %v, %v; want it dropped", evt, err)
+    }
+}
+
+func TestTopicCountMismatchSkipsIndexedArgs(t *testing.T) {
+    p := New(&config.Config{Contracts: []config.ContractConfig{tokenContract(t)}}, nil)
+    cases := []struct {
+        name     string
+        topics   int    // topics after topic0; the ABI expects 2
+        data     []byte // nil keeps the uint256 value
+        wantData bool
+    }{
+        {name: "matching", topics: 2},
+        {name: "fewer topics", topics: 1},
+        {name: "no indexed topics", topics: 0},
+        {name: "more topics", topics: 3},
+        // An ERC-721 Transfer against an ERC-20 ABI: the tokenId is the third
+        // topic and the data is empty.
+        {name: "more topics and no data", topics: 3, data: []byte{}, wantData: true},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            lg := transferFrom(liveToken, 5)
+            lg.Topics = []common.Hash{transferID}
+            for i := 1; i <= tc.topics; i++ {
+                lg.Topics = append(lg.Topics, common.BigToHash(big.NewInt(int64(i))))
+            }
+            if tc.data != nil {
+                lg.Data = tc.data
+            }
+            evt, err := p.Decode(lg)
+            if err != nil || evt == nil {
+                t.Fatalf("Decode = %v, %v; want the event kept", evt, err)
+            }
+            if evt["event_name"] != "Transfer" {
+                t.Errorf("event_name = %v", evt["event_name"])
+            }
+
+            w, warned := evt["decode_warning"].(string)
+            if tc.topics == 2 {
+                if warned || evt["from"] == nil || evt["to"] == nil {
+                    t.Errorf("matching log: decode_warning = %q, from = %v, to = %v", w, evt["from"], evt["to"])
+                }
+                return
+            }
+            want := fmt.Sprintf("log has %d indexed topics but the ABI expects 2", tc.topics)
+            if !strings.Contains(w, want) {
+                t.Errorf("decode_warning = %q, want %q", w, want)
+            }
+            if _, ok := evt["from"]; ok {
+                t.Errorf("from = %v, want indexed arguments left out", evt["from"])
+            }
+            if _, ok := evt["to"]; ok {
+                t.Errorf("to = %v, want indexed arguments left out", evt["to"])
+            }
+            if tc.wantData {
+                if evt["data"] != "0x" || evt["value"] != nil {
+                    t.Errorf("data, value = %v, %v; want the raw data kept", evt["data"], evt["value"])
+                }
+            } else if evt["value"] != "7" {
+                t.Errorf("value = %#v, want the non-indexed data decoded", evt["value"])
+            }
+        })
+    }
+}
+
+// upgradeABI is a later implementation of tokenABI's Token.
+const upgradeABI = `[{"anonymous":false,"type":"event","name":"Upgraded","inputs":[
+	{"indexed":true,"name":"implementation","type":"address"}]}]`
+
+func TestMergedABIsDecodeEventsOfEveryImplementation(t *testing.T) {
+    v1, err := abi.JSON(strings.NewReader(tokenABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    v2, err := abi.JSON(strings.NewReader(upgradeABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    merged := config.MergeABIs("Proxy", v1, v2)
+    p := New(&config.Config{Contracts: []config.ContractConfig{{Name: "Proxy", Address: liveToken.Hex(), ParsedABI: &merged}}}, nil)
+
+    evt, err := p.Decode(transferFrom(liveToken, 5))
+    if err != nil || evt == nil || evt["event_name"] != "Transfer" || evt["value"] != "7" {
+        t.Fatalf("Decode(Transfer) = %v, %v", evt, err)
+    }
+    upgraded := &types.Log{
+        Address: liveToken,
+        Topics:  []common.Hash{crypto.Keccak256Hash([]byte("Upgraded(address)")), common.HexToHash("0xb2")},
+        TxHash:  common.HexToHash("0xabc"),
+    }
+    evt, err = p.Decode(upgraded)
+    if err != nil || evt == nil || evt["event_name"] != "Upgraded" || evt["contract_name"] != "Proxy" {
+        t.Fatalf("Decode(Upgraded) = %v, %v", evt, err)
+    }
+    if evt["implementation"] != common.HexToAddress("0xb2") {
+        t.Errorf("implementation = %v", evt["implementation"])
+    }
+}
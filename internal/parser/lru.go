@@ -0,0 +1,61 @@
+package parser
+
+import (
+	"container/list"
+	"sync"
+)
+
+// lru is a fixed-size, concurrency-safe least-recently-used cache.
+type lru[K comparable, V any] struct {
+    mu    sync.Mutex
+    size  int
+    order *list.List // front is the most recently used entry
+    items map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+    key K
+    val V
+}
+
+// newLRU returns a cache holding at most size entries (minimum 1).
+func newLRU[K comparable, V any](size int) *lru[K, V] {
+    if size < 1 {
+        size = 1
+    }
+    return &lru[K, V]{
+        size:  size,
+        order: list.New(),
+        items: make(map[K]*list.Element, size),
+    }
+}
+
+// Get returns the value stored under key and marks it as recently used.
+func (c *lru[K, V]) Get(key K) (V, bool) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if el, ok := c.items[key]; ok {
+        c.order.MoveToFront(el)
+        return el.Value.(*lruEntry[K, V]).val, true
+    }
+    var zero V
+    return zero, false
+}
+
+// Add stores val under key, evicting the least recently used entry when the
+// cache is full.
+func (c *lru[K, V]) Add(key K, val V) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if el, ok := c.items[key]; ok {
+        el.Value.(*lruEntry[K, V]).val = val
+        c.order.MoveToFront(el)
+        return
+    }
+    c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, val: val})
+    if c.order.Len() > c.size {
+        oldest := c.order.Back()
+        c.order.Remove(oldest)
+        delete(c.items, oldest.Value.(*lruEntry[K, V]).key)
+    }
+}
@@ -0,0 +1,64 @@
+package parser
+
+import (
+	"context"
+	"testing"
+
+	"etl-web3/internal/config"
+)
+
+func TestLRUEvictsLeastRecentlyUsed(t *testing.T) {
+    c := newLRU[uint64, uint64](2)
+    c.Add(1, 10)
+    c.Add(2, 20)
+    if v, ok := c.Get(1); !ok || v != 10 { // 1 is now the most recent
+        t.Fatalf("Get(1) = %d, %v", v, ok)
+    }
+    c.Add(3, 30)
+
+    if _, ok := c.Get(2); ok {
+        t.Error("2 was not evicted")
+    }
+    for k, want := range map[uint64]uint64{1: 10, 3: 30} {
+        if v, ok := c.Get(k); !ok || v != want {
+            t.Errorf("Get(%d) = %d, %v, want %d", k, v, ok, want)
+        }
+    }
+    if n := len(c.items); n != 2 || c.order.Len() != 2 {
+        t.Errorf("cache holds %d items (%d in order), want 2", n, c.order.Len())
+    }
+}
+
+func TestLRUStaysBounded(t *testing.T) {
+    c := newLRU[uint64, uint64](100)
+    for i := uint64(0); i < 10_000; i++ {
+        c.Add(i, i)
+    }
+    if n := len(c.items); n != 100 {
+        t.Fatalf("cache holds %d items, want 100", n)
+    }
+    if v, ok := c.Get(9_999); !ok || v != 9_999 {
+        t.Errorf("most recent block evicted")
+    }
+    if _, ok := c.Get(9_899); ok {
+        t.Errorf("block 9899 still cached")
+    }
+}
+
+func TestTimestampCacheServesRecentBlocks(t *testing.T) {
+    n := codeNode(t)
+    p := anyTransferParser(t, n, config.NoCodeLogsKeep)
+    p.timestampCache = newLRU[uint64, uint64](2)
+
+    for _, block := range []uint64{1, 2, 1, 3, 1, 2} {
+        evt, err := p.Parse(context.Background(), transferFrom(liveToken, block))
+        if err != nil || evt["timestamp"] == nil {
+            t.Fatalf("block %d: Parse = %v, %v", block, evt, err)
+        }
+    }
+    // 1 and 2 are fetched, 1 is cached, 3 evicts 2, 1 is cached, 2 is
+    // fetched again.
+    if got := len(n.params("eth_getBlockByNumber")); got != 4 {
+        t.Fatalf("fetched %d headers, want 4", got)
+    }
+}
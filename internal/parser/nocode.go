@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"context"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
+)
+
+// codeCacheSize bounds the cache of eth_getCode results, one per emitter.
+const codeCacheSize = 4_096
+
+// checkNoCode applies the no_code_logs setting to the event of lg. Only logs
+// of addresses without a configured entry are checked: they come from
+// arbitrary emitters, which may have self-destructed since. The code is
+// looked up at the latest block, where enrichment calls read the contract,
+// since every emitter had code when it emitted the log. It reports false
+// when the event must be dropped.
+func (p *Parser) checkNoCode(ctx context.Context, lg *types.Log, evt sink.Event) bool {
+    if p.noCodeLogs == "" || p.noCodeLogs == config.NoCodeLogsKeep {
+        return true
+    }
+    if _, configured := p.contracts[lg.Address]; configured {
+        return true
+    }
+    if p.hasCode(ctx, lg.Address) {
+        return true
+    }
+    if p.noCodeLogs == config.NoCodeLogsSkip {
+        logrus.Debugf("dropping event of %s: no code at the latest block | tx=%s", lg.Address.Hex(), lg.TxHash.Hex())
+        return false
+    }
+    evt["no_code"] = true
+    return true
+}
+
+// hasCode reports whether addr has code at the latest block. Lookup failures
+// count as code present so the event is kept unmarked.
+func (p *Parser) hasCode(ctx context.Context, addr common.Address) bool {
+    if ok, cached := p.codeCache.Get(addr); cached {
+        return ok
+    }
+    code, err := p.client.GetCode(ctx, addr, nil)
+    if err != nil {
+        return true
+    }
+    ok := len(code) > 0
+    p.codeCache.Add(addr, ok)
+    return ok
+}
@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const transferABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]}]`
+
+var (
+    deadToken  = common.HexToAddress("0x00000000000000000000000000000000000000d1")
+    liveToken  = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+    transferID = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+)
+
+// codeNode returns a node where deadToken has no code and every other
+// address has some.
+func codeNode(t *testing.T) *fakeNode {
+    n := newFakeNode(t)
+    n.handle("eth_getCode", func(params []json.RawMessage) any {
+        var addr common.Address
+        json.Unmarshal(params[0], &addr)
+        if addr == deadToken {
+            return hexutil.Bytes{}
+        }
+        return hexutil.Bytes{0x60, 0x80}
+    })
+    n.handle("eth_getBlockByNumber", func(params []json.RawMessage) any {
+        var num hexutil.Uint64
+        json.Unmarshal(params[0], &num)
+        return &types.Header{Number: new(big.Int).SetUint64(uint64(num)), Time: 1_700_000_000, Difficulty: big.NewInt(0)}
+    })
+    return n
+}
+
+// anyTransferParser returns a parser decoding the Transfer events of any
+// emitter with the given no_code_logs setting.
+func anyTransferParser(t *testing.T, n *fakeNode, noCode string) *Parser {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(transferABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := &config.Config{
+        NoCodeLogs: noCode,
+        Contracts:  []config.ContractConfig{{Name: "AnyToken", Events: []string{"Transfer"}, ParsedABI: &parsed}},
+    }
+    return New(cfg, n.dial(t))
+}
+
+func transferFrom(addr common.Address, block uint64) *types.Log {
+    return &types.Log{
+        Address:     addr,
+        Topics:      []common.Hash{transferID, common.HexToHash("0x01"), common.HexToHash("0x02")},
+        Data:        common.LeftPadBytes(big.NewInt(7).Bytes(), 32),
+        BlockNumber: block,
+        TxHash:      common.HexToHash("0xabc"),
+    }
+}
+
+func TestNoCodeLogsFlag(t *testing.T) {
+    n := codeNode(t)
+    p := anyTransferParser(t, n, config.NoCodeLogsFlag)
+
+    evt, err := p.Parse(context.Background(), transferFrom(deadToken, 5))
+    if err != nil || evt == nil {
+        t.Fatalf("Parse = %v, %v", evt, err)
+    }
+    if evt["no_code"] != true {
+        t.Errorf("event of an emitter without code: no_code = %v, want true", evt["no_code"])
+    }
+    evt, _ = p.Parse(context.Background(), transferFrom(liveToken, 5))
+    if _, ok := evt["no_code"]; ok {
+        t.Errorf("event of an emitter with code has no_code = %v", evt["no_code"])
+    }
+}
+
+func TestNoCodeLogsSkip(t *testing.T) {
+    n := codeNode(t)
+    p := anyTransferParser(t, n, config.NoCodeLogsSkip)
+
+    if evt, err := p.Parse(context.Background(), transferFrom(deadToken, 5)); err != nil || evt != nil {
+        t.Fatalf("Parse = %v, %v, want the event dropped", evt, err)
+    }
+    if evt, _ := p.Parse(context.Background(), transferFrom(liveToken, 5)); evt == nil {
+        t.Fatal("event of an emitter with code dropped")
+    }
+}
+
+func TestNoCodeLogsChecksLatestBlockOnce(t *testing.T) {
+    n := codeNode(t)
+    p := anyTransferParser(t, n, config.NoCodeLogsFlag)
+    for _, block := range []uint64{5, 6, 7} {
+        p.Parse(context.Background(), transferFrom(deadToken, block))
+    }
+
+    calls := n.params("eth_getCode")
+    if len(calls) != 1 {
+        t.Fatalf("eth_getCode called %d times for one emitter, want 1", len(calls))
+    }
+    var block string
+    if err := json.Unmarshal(calls[0][1], &block); err != nil || block != "latest" {
+        t.Fatalf("eth_getCode block = %s, want \"latest\"", calls[0][1])
+    }
+}
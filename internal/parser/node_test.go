@@ -0,0 +1,84 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/rpc"
+)
+
+// fakeNode is a JSON-RPC endpoint answering each method with its handler;
+// unknown methods fail with "method not found".
+type fakeNode struct {
+    *httptest.Server
+
+    mu       sync.Mutex
+    handlers map[string]func(params []json.RawMessage) any
+    calls    map[string][][]json.RawMessage
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+    t.Helper()
+    n := &fakeNode{
+        handlers: map[string]func([]json.RawMessage) any{},
+        calls:    map[string][][]json.RawMessage{},
+    }
+    n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+    t.Cleanup(n.Close)
+    return n
+}
+
+// handle sets the handler of method.
+func (n *fakeNode) handle(method string, h func(params []json.RawMessage) any) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    n.handlers[method] = h
+}
+
+// params returns the parameters of every request for method.
+func (n *fakeNode) params(method string) [][]json.RawMessage {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return n.calls[method]
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        ID     json.RawMessage   `json:"id"`
+        Method string            `json:"method"`
+        Params []json.RawMessage `json:"params"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+    n.mu.Lock()
+    n.calls[req.Method] = append(n.calls[req.Method], req.Params)
+    h := n.handlers[req.Method]
+    n.mu.Unlock()
+
+    resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+    if h == nil {
+        resp["error"] = map[string]any{"code": -32601, "message": "the method " + req.Method + " does not exist/is not available"}
+    } else {
+        resp["result"] = h(req.Params)
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// dial returns a client of n with a single attempt per call.
+func (n *fakeNode) dial(t *testing.T) *rpc.Client {
+    t.Helper()
+    c, err := rpc.Dial(context.Background(), n.URL, config.RetryConfig{Attempts: 1, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    t.Cleanup(c.Close)
+    return c
+}
@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strconv"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// normalizeArgs rewrites decoded arguments into sink-friendly values based on
+// their ABI type. Integers of every width are emitted as base-10 strings:
+// go-ethereum returns native int8…uint64 for widths that fit and *big.Int for
+// the rest (int24, uint160, int256…), so normalising here keeps the sign and
+// full precision regardless of width and spares sinks a type switch.
+func normalizeArgs(inputs abi.Arguments, args map[string]interface{}) {
+    for _, in := range inputs {
+        v, ok := args[in.Name]
+        if !ok {
+            continue
+        }
+        args[in.Name] = normalizeValue(in.Type, v)
+    }
+}
+
+// normalizeValue converts a single decoded value according to its ABI type.
+// Arrays (e.g. the ids and values of an ERC-1155 TransferBatch, or address[]
+// and bytes32[] parameters) become a JSON array string of canonical elements:
+// integers as decimal strings so no element is narrowed, addresses as
+// checksummed hex and byte strings as 0x-prefixed hex.
+func normalizeValue(t abi.Type, v interface{}) interface{} {
+    switch t.T {
+    case abi.IntTy, abi.UintTy:
+        return integerString(v)
+    case abi.SliceTy, abi.ArrayTy:
+        elems, ok := canonicalValue(t, v)
+        if !ok {
+            return v
+        }
+        out, err := json.Marshal(elems)
+        if err != nil {
+            return v
+        }
+        return string(out)
+    default:
+        return v
+    }
+}
+
+// canonicalValue renders a decoded value as a JSON-friendly value: nested
+// arrays become []interface{}, integers decimal strings and addresses or bytes
+// hex strings. It reports false for types it cannot represent (e.g. tuples).
+func canonicalValue(t abi.Type, v interface{}) (interface{}, bool) {
+    switch t.T {
+    case abi.IntTy, abi.UintTy:
+        s, ok := integerString(v).(string)
+        return s, ok
+    case abi.AddressTy:
+        a, ok := v.(common.Address)
+        if !ok {
+            return nil, false
+        }
+        return a.Hex(), true
+    case abi.BytesTy:
+        b, ok := v.([]byte)
+        if !ok {
+            return nil, false
+        }
+        return hexutil.Encode(b), true
+    case abi.FixedBytesTy:
+        rv := reflect.ValueOf(v)
+        if rv.Kind() != reflect.Array || rv.Type().Elem().Kind() != reflect.Uint8 {
+            return nil, false
+        }
+        b := make([]byte, rv.Len())
+        reflect.Copy(reflect.ValueOf(b), rv)
+        return hexutil.Encode(b), true
+    case abi.BoolTy, abi.StringTy:
+        return v, true
+    case abi.SliceTy, abi.ArrayTy:
+        rv := reflect.ValueOf(v)
+        if t.Elem == nil || (rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array) {
+            return nil, false
+        }
+        out := make([]interface{}, rv.Len())
+        for i := range out {
+            e, ok := canonicalValue(*t.Elem, rv.Index(i).Interface())
+            if !ok {
+                return nil, false
+            }
+            out[i] = e
+        }
+        return out, true
+    default:
+        return nil, false
+    }
+}
+
+// integerString renders any integer type produced by the ABI decoder as a
+// signed/unsigned decimal string. Unknown types are returned unchanged.
+func integerString(v interface{}) interface{} {
+    switch n := v.(type) {
+    case *big.Int:
+        if n == nil {
+            return ""
+        }
+        return n.String()
+    case int8:
+        return strconv.FormatInt(int64(n), 10)
+    case int16:
+        return strconv.FormatInt(int64(n), 10)
+    case int32:
+        return strconv.FormatInt(int64(n), 10)
+    case int64:
+        return strconv.FormatInt(n, 10)
+    case uint8:
+        return strconv.FormatUint(uint64(n), 10)
+    case uint16:
+        return strconv.FormatUint(uint64(n), 10)
+    case uint32:
+        return strconv.FormatUint(uint64(n), 10)
+    case uint64:
+        return strconv.FormatUint(n, 10)
+    default:
+        return v
+    }
+}
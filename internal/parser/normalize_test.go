@@ -0,0 +1,280 @@
+package parser
+
+import (
+	"math"
+	"math/big"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// abiType returns the ABI type of the given name.
+func abiType(t *testing.T, name string) abi.Type {
+    t.Helper()
+    typ, err := abi.NewType(name, "", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return typ
+}
+
+// bigInt parses a decimal integer.
+func bigInt(t *testing.T, s string) *big.Int {
+    t.Helper()
+    n, ok := new(big.Int).SetString(s, 10)
+    if !ok {
+        t.Fatalf("invalid integer %q", s)
+    }
+    return n
+}
+
+func TestNormalizeIntegers(t *testing.T) {
+    const (
+        maxUint256 = "115792089237316195423570985008687907853269984665640564039457584007913129639935"
+        minInt256  = "-57896044618658097711785492504343953926634992332820282019728792003956564819968"
+    )
+    cases := []struct {
+        typ   string
+        value interface{}
+        want  string
+    }{
+        {"int8", int8(math.MinInt8), "-128"},
+        {"int16", int16(-300), "-300"},
+        {"int32", int32(math.MaxInt32), "2147483647"},
+        {"int64", int64(math.MinInt64), "-9223372036854775808"},
+        {"uint8", uint8(math.MaxUint8), "255"},
+        {"uint16", uint16(65535), "65535"},
+        {"uint32", uint32(math.MaxUint32), "4294967295"},
+        {"uint64", uint64(math.MaxUint64), "18446744073709551615"},
+        // Widths without a native Go type decode to *big.Int.
+        {"int24", big.NewInt(-887272), "-887272"},
+        {"int128", bigInt(t, "-170141183460469231731687303715884105728"), "-170141183460469231731687303715884105728"},
+        {"int256", bigInt(t, minInt256), minInt256},
+        {"uint160", bigInt(t, "1461501637330902918203684832716283019655932542975"), "1461501637330902918203684832716283019655932542975"},
+        {"uint256", bigInt(t, maxUint256), maxUint256},
+        {"uint256", big.NewInt(0), "0"},
+        {"uint256", (*big.Int)(nil), ""},
+    }
+    for _, tc := range cases {
+        got := normalizeValue(abiType(t, tc.typ), tc.value)
+        if got != tc.want {
+            t.Errorf("normalizeValue(%s, %v) = %#v, want %q", tc.typ, tc.value, got, tc.want)
+        }
+    }
+
+    // Other types are left alone.
+    if got := normalizeValue(abiType(t, "bool"), true); got != true {
+        t.Errorf("normalizeValue(bool) = %#v", got)
+    }
+    if got := normalizeValue(abiType(t, "string"), "x"); got != "x" {
+        t.Errorf("normalizeValue(string) = %#v", got)
+    }
+}
+
+func TestNormalizeArgsDecodedFromData(t *testing.T) {
+    args := abi.Arguments{
+        {Name: "tick", Type: abiType(t, "int24")},
+        {Name: "delta", Type: abiType(t, "int64")},
+        {Name: "amount", Type: abiType(t, "uint256")},
+    }
+    data, err := args.Pack(big.NewInt(-887272), int64(-5), bigInt(t, "340282366920938463463374607431768211456"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    decoded := make(map[string]interface{})
+    if err := args.UnpackIntoMap(decoded, data); err != nil {
+        t.Fatal(err)
+    }
+    decoded["other"] = 1.5
+    normalizeArgs(args, decoded)
+
+    want := map[string]interface{}{"tick": "-887272", "delta": "-5", "amount": "340282366920938463463374607431768211456", "other": 1.5}
+    for k, v := range want {
+        if decoded[k] != v {
+            t.Errorf("%s = %#v, want %#v", k, decoded[k], v)
+        }
+    }
+}
+
+// nftABI declares the transfers of ERC-721 and ERC-1155.
+const nftABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":true,"name":"tokenId","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"TransferSingle","inputs":[
+	{"indexed":true,"name":"operator","type":"address"},
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"id","type":"uint256"},
+	{"indexed":false,"name":"value","type":"uint256"}]},
+{"anonymous":false,"type":"event","name":"TransferBatch","inputs":[
+	{"indexed":true,"name":"operator","type":"address"},
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"ids","type":"uint256[]"},
+	{"indexed":false,"name":"values","type":"uint256[]"}]}]`
+
+// nftParser returns a parser decoding nftABI for liveToken.
+func nftParser(t *testing.T) (*Parser, abi.ABI) {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(nftABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := &config.Config{Contracts: []config.ContractConfig{{Name: "Collection", Address: liveToken.Hex(), ParsedABI: &parsed}}}
+    return New(cfg, nil), parsed
+}
+
+func TestTokenIDsAboveInt64StayExact(t *testing.T) {
+    p, parsed := nftParser(t)
+    // 2^64 + 1 and 2^255: neither fits an int64 nor a float64.
+    id := bigInt(t, "18446744073709551617")
+    huge := new(big.Int).Lsh(big.NewInt(1), 255)
+    topic := func(s string) common.Hash { return crypto.Keccak256Hash([]byte(s)) }
+
+    erc721 := &types.Log{
+        Address: liveToken,
+        Topics:  []common.Hash{topic("Transfer(address,address,uint256)"), common.HexToHash("0x01"), common.HexToHash("0x02"), common.BigToHash(id)},
+        TxHash:  common.HexToHash("0xabc"),
+    }
+    evt, err := p.Decode(erc721)
+    if err != nil {
+        t.Fatalf("Decode(Transfer): %v", err)
+    }
+    if evt["tokenId"] != "18446744073709551617" {
+        t.Errorf("tokenId = %#v, want \"18446744073709551617\"", evt["tokenId"])
+    }
+
+    data, err := parsed.Events["TransferSingle"].Inputs.NonIndexed().Pack(huge, big.NewInt(3))
+    if err != nil {
+        t.Fatal(err)
+    }
+    single := &types.Log{
+        Address: liveToken,
+        Topics:  []common.Hash{topic("TransferSingle(address,address,address,uint256,uint256)"), common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")},
+        Data:    data,
+        TxHash:  common.HexToHash("0xabc"),
+    }
+    evt, err = p.Decode(single)
+    if err != nil {
+        t.Fatalf("Decode(TransferSingle): %v", err)
+    }
+    if evt["id"] != huge.String() || evt["value"] != "3" {
+        t.Errorf("TransferSingle id, value = %#v, %#v; want %q, \"3\"", evt["id"], evt["value"], huge.String())
+    }
+
+    data, err = parsed.Events["TransferBatch"].Inputs.NonIndexed().Pack([]*big.Int{id, huge}, []*big.Int{big.NewInt(1), big.NewInt(2)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    batch := &types.Log{
+        Address: liveToken,
+        Topics:  []common.Hash{topic("TransferBatch(address,address,address,uint256[],uint256[])"), common.HexToHash("0x01"), common.HexToHash("0x02"), common.HexToHash("0x03")},
+        Data:    data,
+        TxHash:  common.HexToHash("0xabc"),
+    }
+    evt, err = p.Decode(batch)
+    if err != nil {
+        t.Fatalf("Decode(TransferBatch): %v", err)
+    }
+    wantIDs := `["18446744073709551617","` + huge.String() + `"]`
+    if evt["ids"] != wantIDs || evt["values"] != `["1","2"]` {
+        t.Errorf("TransferBatch ids, values = %#v, %#v; want %s, [\"1\",\"2\"]", evt["ids"], evt["values"], wantIDs)
+    }
+}
+
+// arraysABI declares an event with a non-indexed array of every element type.
+const arraysABI = `[{"anonymous":false,"type":"event","name":"Arrays","inputs":[
+	{"indexed":false,"name":"addrs","type":"address[]"},
+	{"indexed":false,"name":"amounts","type":"uint256[]"},
+	{"indexed":false,"name":"deltas","type":"int8[]"},
+	{"indexed":false,"name":"hashes","type":"bytes32[]"},
+	{"indexed":false,"name":"sels","type":"bytes4[2]"},
+	{"indexed":false,"name":"blobs","type":"bytes[]"},
+	{"indexed":false,"name":"flags","type":"bool[]"},
+	{"indexed":false,"name":"names","type":"string[]"},
+	{"indexed":false,"name":"grid","type":"uint256[][]"}]}]`
+
+func TestArrayParamsRenderAsJSON(t *testing.T) {
+    parsed, err := abi.JSON(strings.NewReader(arraysABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    p := New(&config.Config{Contracts: []config.ContractConfig{{Name: "Arrays", Address: liveToken.Hex(), ParsedABI: &parsed}}}, nil)
+    ev := parsed.Events["Arrays"]
+    decode := func(t *testing.T, values ...interface{}) map[string]interface{} {
+        t.Helper()
+        data, err := ev.Inputs.Pack(values...)
+        if err != nil {
+            t.Fatal(err)
+        }
+        evt, err := p.Decode(&types.Log{Address: liveToken, Topics: []common.Hash{ev.ID}, Data: data, TxHash: common.HexToHash("0xabc")})
+        if err != nil {
+            t.Fatalf("Decode: %v", err)
+        }
+        return evt
+    }
+
+    t.Run("values", func(t *testing.T) {
+        addr := common.HexToAddress("0x52908400098527886e0f7030069857d2e4169ee7")
+        evt := decode(t,
+            []common.Address{addr, liveToken},
+            []*big.Int{bigInt(t, "18446744073709551617"), big.NewInt(0)},
+            []int8{-1, 127},
+            [][32]byte{common.HexToHash("0x01")},
+            [2][4]byte{{0xa9, 0x05, 0x9c, 0xbb}, {}},
+            [][]byte{{0x01, 0x02}, {}},
+            []bool{true, false},
+            []string{"a", `"b"`},
+            [][]*big.Int{{big.NewInt(1), big.NewInt(2)}, {}},
+        )
+        want := map[string]string{
+            "addrs":   `["0x52908400098527886E0F7030069857D2E4169EE7","0x00000000000000000000000000000000000000A1"]`,
+            "amounts": `["18446744073709551617","0"]`,
+            "deltas":  `["-1","127"]`,
+            "hashes":  `["0x0000000000000000000000000000000000000000000000000000000000000001"]`,
+            "sels":    `["0xa9059cbb","0x00000000"]`,
+            "blobs":   `["0x0102","0x"]`,
+            "flags":   `[true,false]`,
+            "names":   `["a","\"b\""]`,
+            "grid":    `[["1","2"],[]]`,
+        }
+        for k, v := range want {
+            if evt[k] != v {
+                t.Errorf("%s = %#v, want %s", k, evt[k], v)
+            }
+        }
+    })
+
+    t.Run("empty", func(t *testing.T) {
+        evt := decode(t,
+            []common.Address{}, []*big.Int{}, []int8{}, [][32]byte{},
+            [2][4]byte{}, [][]byte{}, []bool{}, []string{}, [][]*big.Int{},
+        )
+        for _, k := range []string{"addrs", "amounts", "deltas", "hashes", "blobs", "flags", "names", "grid"} {
+            if evt[k] != "[]" {
+                t.Errorf("%s = %#v, want []", k, evt[k])
+            }
+        }
+        // A fixed-size array always has its elements.
+        if evt["sels"] != `["0x00000000","0x00000000"]` {
+            t.Errorf("sels = %#v", evt["sels"])
+        }
+    })
+
+    // Tuples have no canonical form: an array of them keeps its decoded value.
+    tuples, err := abi.NewType("tuple[]", "", []abi.ArgumentMarshaling{{Name: "a", Type: "uint256"}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    v := []struct{ A *big.Int }{{A: big.NewInt(1)}}
+    if got, ok := normalizeValue(tuples, v).([]struct{ A *big.Int }); !ok || len(got) != 1 {
+        t.Errorf("normalizeValue(tuple[]) = %#v, want the value unchanged", got)
+    }
+}
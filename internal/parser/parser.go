@@ -2,9 +2,10 @@ package parser
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"math/big"
 	"sync"
+	"sync/atomic"
 
 	"etl-web3/internal/config"
 	"etl-web3/internal/rpc"
@@ -13,6 +14,7 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/sirupsen/logrus"
 )
 
 // Parser handles the transformation of raw Ethereum logs into generic
@@ -21,112 +23,288 @@ import (
 type Parser struct {
     client    *rpc.Client
     contracts map[common.Address]config.ContractConfig
+    // topicContracts maps topic0 to address-less contract entries so logs
+    // from any emitter can still be decoded with the configured ABI.
+    topicContracts map[common.Hash]config.ContractConfig
     chainID   *big.Int
     // timestampCache allows reusing block timestamps when multiple events
-    // belong to the same block, saving additional RPC calls.
-    timestampCache map[uint64]uint64
+    // belong to the same block, saving additional RPC calls. It is an LRU
+    // bounded by timestamp_cache_size since only nearby blocks are reused.
+    timestampCache *lru[uint64, uint64]
+    // txCache avoids refetching the same transaction when several logs were
+    // emitted by it. It is reset once it reaches maxCachedTxs entries.
+    txCache       map[common.Hash]*types.Transaction
+    decodeTxInput bool
+    // receiptCache holds the receipts of recently seen blocks (or single
+    // transactions on fallback) keyed by tx hash, bounded like txCache.
+    receiptCache  map[common.Hash]*types.Receipt
+    enrichReceipt bool
+    // noBlockReceipts is set once the node rejects eth_getBlockReceipts;
+    // receipts are then fetched per transaction.
+    noBlockReceipts atomic.Bool
+    // timestampErrors counts events whose block header could not be fetched.
+    timestampErrors atomic.Int64
+    // chain is the optional chain label attached to every event.
+    chain         string
+    // signatures names events missing from the ABI (signature_db).
+    signatures map[common.Hash]signature
+    // decoders holds the decoder of every contract's decoder setting.
+    decoders map[string]Decoder
+    // noCodeLogs is the no_code_logs setting; codeCache remembers which
+    // emitters still have code.
+    noCodeLogs string
+    codeCache  *lru[common.Address, bool]
     mu sync.RWMutex
 }
 
+// maxCachedTxs bounds the transaction cache; logs of one transaction are
+// adjacent in a range so a small window is enough.
+const maxCachedTxs = 4_096
+
 // New builds a Parser using the loaded configuration and an initialised RPC
 // client. The ABI of every configured contract is cached for quick look-ups.
 func New(cfg *config.Config, client *rpc.Client) *Parser {
     m := make(map[common.Address]config.ContractConfig, len(cfg.Contracts))
+    byTopic := make(map[common.Hash]config.ContractConfig)
+    decs := make(map[string]Decoder)
     for _, c := range cfg.Contracts {
+        if d, err := LookupDecoder(c.Decoder); err == nil {
+            decs[c.Decoder] = d
+        } else {
+            logrus.Warnf("contract %s: %v, using the ABI decoder", c.Name, err)
+        }
+        if c.Address == "" {
+            if c.ParsedABI != nil {
+                for _, evName := range c.Events {
+                    if evDef, ok := config.LookupEvent(c.ParsedABI, evName); ok {
+                        byTopic[evDef.ID] = c
+                    }
+                }
+            }
+            continue
+        }
         m[common.HexToAddress(c.Address)] = c
     }
-    return &Parser{client: client, contracts: m, timestampCache: make(map[uint64]uint64)}
+    cacheSize := cfg.TimestampCacheSize
+    if cacheSize <= 0 {
+        cacheSize = config.DefaultTimestampCacheSize
+    }
+    return &Parser{
+        client:         client,
+        contracts:      m,
+        topicContracts: byTopic,
+        timestampCache: newLRU[uint64, uint64](cacheSize),
+        txCache:        make(map[common.Hash]*types.Transaction),
+        decodeTxInput:  cfg.DecodeTxInput,
+        receiptCache:   make(map[common.Hash]*types.Receipt),
+        enrichReceipt:  cfg.EnrichReceipt,
+        chain:          cfg.Chain,
+        signatures:     parseSignatures(cfg.Signatures),
+        decoders:       decs,
+        noCodeLogs:     cfg.NoCodeLogs,
+        codeCache:      newLRU[common.Address, bool](codeCacheSize),
+    }
 }
 
 // Parse converts the provided log into a sink.Event. When the contract ABI is
 // available, the event parameters are fully decoded; otherwise a minimal event
-// containing only generic information is returned.
+// containing only generic information is returned. Events a contract with a
+// non-empty events list does not include yield a nil event (the RPC filter
+// is not relied on to exclude them), as do logs dropped by no_code_logs.
 func (p *Parser) Parse(ctx context.Context, lg *types.Log) (sink.Event, error) {
+    evt, cfg, err := p.decode(lg)
+    if evt == nil || err != nil {
+        return evt, err
+    }
+    if !p.checkNoCode(ctx, lg, evt) {
+        return nil, nil
+    }
+
+    // Extra metadata (timestamp, tx_from).
+    p.enrichWithBlockAndTx(ctx, lg, evt)
+    if cfg == nil {
+        return evt, nil
+    }
+
+    if p.decodeTxInput {
+        p.decodeInput(ctx, cfg.ParsedABI, lg, evt)
+    }
+    projectEvent(cfg, evt)
+    return evt, nil
+}
+
+// Decode converts lg into the event Parse would produce, without the fields
+// fetched over RPC (timestamp, tx_from, receipt and calldata fields). It
+// needs no client.
+func (p *Parser) Decode(lg *types.Log) (sink.Event, error) {
+    evt, cfg, err := p.decode(lg)
+    if evt == nil || err != nil {
+        return evt, err
+    }
+    if cfg != nil {
+        projectEvent(cfg, evt)
+    }
+    return evt, nil
+}
+
+// projectEvent applies the projection cfg configures for the event, if any.
+func projectEvent(cfg *config.ContractConfig, evt sink.Event) {
+    name, _ := evt["event_name"].(string)
+    if pr, ok := cfg.Projections[name]; ok {
+        project(evt, pr)
+        return
+    }
+    // Projections may refer to the event by signature or topic0.
+    for ref, pr := range cfg.Projections {
+        if config.EventName(*cfg, ref) == name {
+            project(evt, pr)
+            return
+        }
+    }
+}
+
+// decode builds the event of lg from its topics and data. cfg is the
+// contract whose ABI decoded it, nil for logs without ABI: those get minimal
+// events, named from the signature database when it knows their topic0.
+func (p *Parser) decode(lg *types.Log) (sink.Event, *config.ContractConfig, error) {
     evt := sink.Event{
         "tx_hash":       lg.TxHash.Hex(),
+        "log_index":     uint64(lg.Index),
         "block_number":  lg.BlockNumber,
+        // removed is true for logs retracted by a reorg (follow mode).
+        "removed":       lg.Removed,
         "contract":      lg.Address.Hex(),
         "contract_name": "unknown",
         "event_name":    "unknown",
         "chain_id":      "",
     }
+    if p.chain != "" {
+        evt["chain"] = p.chain
+    }
 
     cfg, ok := p.contracts[lg.Address]
+    if len(lg.Topics) > 0 {
+        // An address-less entry listing the event applies when the
+        // contract's own entry does not.
+        if alt, found := p.topicContracts[lg.Topics[0]]; found && (!ok || !allowsTopic(cfg, lg.Topics[0])) {
+            cfg, ok = alt, true
+        }
+    }
     if !ok || cfg.ParsedABI == nil {
         if ok {
             evt["contract_name"] = cfg.Name
         }
         // No ABI for this address – return minimal info so it is not lost.
-    p.enrichWithBlockAndTx(ctx, lg, evt)
-        return evt, nil
+        p.decodeSignature(lg, evt)
+        return evt, nil, nil
     }
 
-    // Derive event definition via its signature hash (topic[0]).
-    evDef, err := p.findEventByID(cfg.ParsedABI, lg.Topics[0])
-    if err != nil {
-        return evt, err
-    }
-    evt["event_name"] = evDef.Name
     // Store the human-friendly contract name for downstream sinks (e.g. CSV naming).
     evt["contract_name"] = cfg.Name
-
-    // Decode non-indexed params (contained in log.Data).
-    args := make(map[string]interface{})
-    if err := cfg.ParsedABI.UnpackIntoMap(args, evDef.Name, lg.Data); err != nil {
-        return evt, err
+    dec, ok := p.decoders[cfg.Decoder]
+    if !ok {
+        dec = ABIDecoder{}
     }
-
-    // Decode indexed params (topics[1:]).
-    var indexedArgs abi.Arguments
-    for _, input := range evDef.Inputs {
-        if input.Indexed {
-            indexedArgs = append(indexedArgs, input)
+    if err := dec.Decode(&cfg, lg, evt); err != nil {
+        switch {
+        case errors.Is(err, ErrSkipEvent):
+            logrus.Debugf("dropping %v event of %s: not in its events list | block=%d tx=%s", evt["event_name"], cfg.Name, lg.BlockNumber, lg.TxHash.Hex())
+            return nil, nil, nil
+        case errors.Is(err, ErrUnknownEvent) && len(cfg.Events) == 0:
+            // Contracts indexing all their events fall back to the
+            // signature database for events their ABI lacks.
+            if p.decodeSignature(lg, evt) {
+                return evt, nil, nil
+            }
         }
+        return evt, nil, err
     }
+    return evt, &cfg, nil
+}
 
-    for i, arg := range indexedArgs {
-        if len(lg.Topics) <= i+1 {
-            break
+// allowsTopic reports whether cfg indexes the event with signature hash
+// topic0: always when it lists no events, which means all of them.
+func allowsTopic(cfg config.ContractConfig, topic0 common.Hash) bool {
+    if len(cfg.Events) == 0 {
+        return true
+    }
+    if cfg.ParsedABI == nil {
+        return false
+    }
+    for _, name := range cfg.Events {
+        if ev, ok := config.LookupEvent(cfg.ParsedABI, name); ok && ev.ID == topic0 {
+            return true
         }
+    }
+    return false
+}
 
-        topicVals := make(map[string]interface{})
-        // ParseTopicsIntoMap mutates the provided map and returns only error.
-        err := abi.ParseTopicsIntoMap(topicVals, abi.Arguments{arg}, []common.Hash{lg.Topics[i+1]})
-        if err == nil {
-            for k, v := range topicVals {
-                args[k] = v
-            }
-        } else {
-            // On failure, keep raw topic so data is not discarded.
-            args[arg.Name] = lg.Topics[i+1].Hex()
-        }
+// decodeInput resolves the method called by the transaction that emitted the
+// log and attaches method_name plus its arguments prefixed with "input_".
+// Transactions calling another contract (e.g. a router) are left untouched.
+func (p *Parser) decodeInput(ctx context.Context, contractABI *abi.ABI, lg *types.Log, evt sink.Event) {
+    tx, err := p.transaction(ctx, lg.TxHash)
+    if err != nil {
+        return
+    }
+    data := tx.Data()
+    if len(data) < 4 {
+        return
+    }
+    method, err := contractABI.MethodById(data[:4])
+    if err != nil {
+        return
     }
 
-    // Merge decoded params into the event map.
+    args := make(map[string]interface{})
+    if err := method.Inputs.UnpackIntoMap(args, data[4:]); err != nil {
+        return
+    }
+    normalizeArgs(method.Inputs, args)
+    evt["method_name"] = method.Name
     for k, v := range args {
-        evt[k] = v
+        evt["input_"+k] = v
     }
+}
 
-    // Extra metadata (timestamp, tx_from).
-    p.enrichWithBlockAndTx(ctx, lg, evt)
+// transaction returns the transaction with the given hash, served from the
+// cache when possible.
+func (p *Parser) transaction(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+    p.mu.RLock()
+    tx, ok := p.txCache[hash]
+    p.mu.RUnlock()
+    if ok {
+        return tx, nil
+    }
 
-    return evt, nil
+    tx, err := p.client.GetTransaction(ctx, hash)
+    if err != nil {
+        return nil, err
+    }
+
+    p.mu.Lock()
+    if len(p.txCache) >= maxCachedTxs {
+        p.txCache = make(map[common.Hash]*types.Transaction)
+    }
+    p.txCache[hash] = tx
+    p.mu.Unlock()
+    return tx, nil
 }
 
 // enrichWithBlockAndTx adds timestamp and tx_from metadata using best-effort
 // RPC calls. Failures are silently ignored so they do not block main parsing.
 func (p *Parser) enrichWithBlockAndTx(ctx context.Context, lg *types.Log, evt sink.Event) {
     // Block timestamp (with cache to avoid repeated RPC calls).
-    p.mu.RLock()
-    ts, ok := p.timestampCache[lg.BlockNumber]
-    p.mu.RUnlock()
-    if ok {
+    if ts, ok := p.timestampCache.Get(lg.BlockNumber); ok {
         evt["timestamp"] = ts
     } else if hdr, err := p.client.GetHeaderByNumber(ctx, big.NewInt(int64(lg.BlockNumber))); err == nil {
         evt["timestamp"] = hdr.Time
-        p.mu.Lock()
-        p.timestampCache[lg.BlockNumber] = hdr.Time
-        p.mu.Unlock()
+        p.timestampCache.Add(lg.BlockNumber, hdr.Time)
+    } else {
+        // The header call already went through the RPC retries; flag the
+        // row so a missing timestamp is not mistaken for a decoding issue.
+        evt["timestamp_error"] = true
+        p.timestampErrors.Add(1)
     }
 
     // Transaction sender.
@@ -134,7 +312,7 @@ func (p *Parser) enrichWithBlockAndTx(ctx context.Context, lg *types.Log, evt si
     chainKnown := p.chainID != nil
     p.mu.RUnlock()
     if !chainKnown {
-        if id, err := p.client.NetworkID(ctx); err == nil {
+        if id, err := p.client.GetNetworkID(ctx); err == nil {
             p.mu.Lock()
             if p.chainID == nil { // double-check under lock
                 p.chainID = id
@@ -150,22 +328,79 @@ func (p *Parser) enrichWithBlockAndTx(ctx context.Context, lg *types.Log, evt si
         evt["chain_id"] = cid.String()
     }
     if cid != nil {
-        if tx, _, err := p.client.Client.TransactionByHash(ctx, lg.TxHash); err == nil {
+        if tx, err := p.transaction(ctx, lg.TxHash); err == nil {
             signer := types.LatestSignerForChainID(cid)
             if from, err := types.Sender(signer, tx); err == nil {
                 evt["tx_from"] = from.Hex()
             }
         }
     }
+
+    // Transaction outcome (tx_status: 1 success / 0 reverted, gas_used).
+    if p.enrichReceipt {
+        if rcpt, err := p.receipt(ctx, lg); err == nil {
+            evt["tx_status"] = rcpt.Status
+            evt["gas_used"] = rcpt.GasUsed
+        }
+    }
 }
 
-// findEventByID searches the ABI for an event whose ID matches the provided
-// signature hash.
-func (p *Parser) findEventByID(contractABI *abi.ABI, id common.Hash) (*abi.Event, error) {
-    for _, ev := range contractABI.Events {
-        if ev.ID == id {
-            return &ev, nil
+// receipt returns the receipt of the transaction that emitted lg. All
+// receipts of its block are fetched at once with eth_getBlockReceipts and
+// cached; nodes without that method fall back to eth_getTransactionReceipt.
+func (p *Parser) receipt(ctx context.Context, lg *types.Log) (*types.Receipt, error) {
+    p.mu.RLock()
+    rcpt, ok := p.receiptCache[lg.TxHash]
+    p.mu.RUnlock()
+    if ok {
+        return rcpt, nil
+    }
+
+    if !p.noBlockReceipts.Load() {
+        receipts, err := p.client.BlockReceipts(ctx, lg.BlockHash)
+        if err == nil {
+            p.cacheReceipts(receipts...)
+            for _, r := range receipts {
+                if r.TxHash == lg.TxHash {
+                    return r, nil
+                }
+            }
+        } else if rpc.IsMethodNotFound(err) {
+            if p.noBlockReceipts.CompareAndSwap(false, true) {
+                logrus.Infof("eth_getBlockReceipts not supported by the node, fetching receipts per transaction")
+            }
         }
     }
-    return nil, fmt.Errorf("event with ID %s not found in ABI", id.Hex())
-} 
\ No newline at end of file
+
+    rcpt, err := p.client.GetTransactionReceipt(ctx, lg.TxHash)
+    if err != nil {
+        return nil, err
+    }
+    p.cacheReceipts(rcpt)
+    return rcpt, nil
+}
+
+// cacheReceipts stores receipts by tx hash, resetting the cache when it
+// would exceed maxCachedTxs.
+func (p *Parser) cacheReceipts(receipts ...*types.Receipt) {
+    p.mu.Lock()
+    defer p.mu.Unlock()
+    if len(p.receiptCache)+len(receipts) > maxCachedTxs {
+        p.receiptCache = make(map[common.Hash]*types.Receipt, len(receipts))
+    }
+    for _, r := range receipts {
+        p.receiptCache[r.TxHash] = r
+    }
+}
+
+// SetTimestamp records the timestamp of block, e.g. one returned inline with
+// its logs, so events of that block skip the header fetch.
+func (p *Parser) SetTimestamp(block, timestamp uint64) {
+    p.timestampCache.Add(block, timestamp)
+}
+
+// TimestampErrors returns how many events were emitted without a timestamp
+// because their block header could not be fetched.
+func (p *Parser) TimestampErrors() int64 {
+    return p.timestampErrors.Load()
+}
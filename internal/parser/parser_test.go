@@ -0,0 +1,235 @@
+package parser
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var receiptBlock = common.HexToHash("0xb10c")
+
+// receiptOf returns the receipt of tx: reverted for 0xbad, successful
+// otherwise, with gas used derived from the hash.
+func receiptOf(tx common.Hash) *types.Receipt {
+    status := types.ReceiptStatusSuccessful
+    if tx == common.HexToHash("0xbad") {
+        status = types.ReceiptStatusFailed
+    }
+    return &types.Receipt{
+        Status:      status,
+        TxHash:      tx,
+        GasUsed:     21_000 + uint64(tx[31]),
+        BlockHash:   receiptBlock,
+        BlockNumber: big.NewInt(5),
+        Logs:        []*types.Log{},
+    }
+}
+
+// receiptNode returns a node with block headers and per-transaction
+// receipts, plus eth_getBlockReceipts when blockReceipts is set.
+func receiptNode(t *testing.T, blockReceipts bool, txs ...common.Hash) *fakeNode {
+    n := newFakeNode(t)
+    n.handle("eth_getBlockByNumber", func(params []json.RawMessage) any {
+        var num hexutil.Uint64
+        json.Unmarshal(params[0], &num)
+        return &types.Header{Number: new(big.Int).SetUint64(uint64(num)), Time: 1_700_000_000, Difficulty: big.NewInt(0)}
+    })
+    n.handle("eth_getTransactionReceipt", func(params []json.RawMessage) any {
+        var tx common.Hash
+        json.Unmarshal(params[0], &tx)
+        return receiptOf(tx)
+    })
+    if blockReceipts {
+        n.handle("eth_getBlockReceipts", func(params []json.RawMessage) any {
+            var receipts []*types.Receipt
+            for _, tx := range txs {
+                receipts = append(receipts, receiptOf(tx))
+            }
+            return receipts
+        })
+    }
+    return n
+}
+
+// receiptParser returns a parser decoding Transfer events of any emitter
+// with enrich_receipt set.
+func receiptParser(t *testing.T, n *fakeNode) *Parser {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(transferABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := &config.Config{
+        EnrichReceipt: true,
+        Contracts:     []config.ContractConfig{{Name: "AnyToken", Events: []string{"Transfer"}, ParsedABI: &parsed}},
+    }
+    return New(cfg, n.dial(t))
+}
+
+// parseReceipts parses a Transfer of every tx in receiptBlock and returns
+// tx_status and gas_used of each event.
+func parseReceipts(t *testing.T, p *Parser, txs ...common.Hash) [][2]any {
+    t.Helper()
+    var out [][2]any
+    for i, tx := range txs {
+        lg := transferFrom(liveToken, 5)
+        lg.TxHash, lg.BlockHash, lg.Index = tx, receiptBlock, uint(i)
+        evt, err := p.Parse(context.Background(), lg)
+        if err != nil || evt == nil {
+            t.Fatalf("Parse: %v, %v", evt, err)
+        }
+        out = append(out, [2]any{evt["tx_status"], evt["gas_used"]})
+    }
+    return out
+}
+
+func TestReceiptEnrichmentFetchesBlockReceipts(t *testing.T) {
+    txs := []common.Hash{common.HexToHash("0x01"), common.HexToHash("0xbad"), common.HexToHash("0x03")}
+    n := receiptNode(t, true, txs...)
+    got := parseReceipts(t, receiptParser(t, n), txs...)
+
+    want := [][2]any{{uint64(1), uint64(21_001)}, {uint64(0), uint64(21_000 + 0xad)}, {uint64(1), uint64(21_003)}}
+    for i := range want {
+        if got[i] != want[i] {
+            t.Errorf("event %d: tx_status, gas_used = %v, want %v", i, got[i], want[i])
+        }
+    }
+    calls := n.params("eth_getBlockReceipts")
+    if len(calls) != 1 {
+        t.Fatalf("eth_getBlockReceipts called %d times, want once for the block", len(calls))
+    }
+    var hash common.Hash
+    if json.Unmarshal(calls[0][0], &hash); hash != receiptBlock {
+        t.Errorf("eth_getBlockReceipts of %s, want %s", hash, receiptBlock)
+    }
+    if n := len(n.params("eth_getTransactionReceipt")); n != 0 {
+        t.Errorf("eth_getTransactionReceipt called %d times, want none", n)
+    }
+}
+
+func TestReceiptEnrichmentFallsBackPerTransaction(t *testing.T) {
+    txs := []common.Hash{common.HexToHash("0x01"), common.HexToHash("0xbad"), common.HexToHash("0x03")}
+    n := receiptNode(t, false)
+    got := parseReceipts(t, receiptParser(t, n), txs...)
+
+    if got[0][0] != uint64(1) || got[1][0] != uint64(0) || got[2][1] != uint64(21_003) {
+        t.Errorf("tx_status, gas_used = %v", got)
+    }
+    // The unsupported method is only tried once.
+    if calls := len(n.params("eth_getBlockReceipts")); calls != 1 {
+        t.Errorf("eth_getBlockReceipts called %d times, want 1", calls)
+    }
+    if calls := len(n.params("eth_getTransactionReceipt")); calls != 3 {
+        t.Errorf("eth_getTransactionReceipt called %d times, want 3", calls)
+    }
+}
+
+func TestReceiptEnrichmentOff(t *testing.T) {
+    n := receiptNode(t, true, common.HexToHash("0x01"))
+    p := receiptParser(t, n)
+    p.enrichReceipt = false
+    evt, err := p.Parse(context.Background(), transferFrom(liveToken, 5))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := evt["tx_status"]; ok || len(n.params("eth_getBlockReceipts")) != 0 {
+        t.Fatalf("receipt fetched without enrich_receipt: %v", evt)
+    }
+}
+
+// transferCallABI adds the transfer function to the Transfer event.
+const transferCallABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+    {"indexed":true,"name":"from","type":"address"},
+    {"indexed":true,"name":"to","type":"address"},
+    {"indexed":false,"name":"value","type":"uint256"}]},
+{"type":"function","name":"transfer","stateMutability":"nonpayable","inputs":[
+    {"name":"to","type":"address"},
+    {"name":"amount","type":"uint256"}],"outputs":[{"name":"","type":"bool"}]}]`
+
+// txInputNode returns a node serving headers and one signed transaction
+// with calldata data for every hash.
+func txInputNode(t *testing.T, data []byte) *fakeNode {
+    t.Helper()
+    key, err := crypto.GenerateKey()
+    if err != nil {
+        t.Fatal(err)
+    }
+    tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 1, To: &liveToken, Gas: 60_000, GasPrice: big.NewInt(1), Data: data}), types.HomesteadSigner{}, key)
+    if err != nil {
+        t.Fatal(err)
+    }
+    n := codeNode(t)
+    n.handle("eth_getTransactionByHash", func([]json.RawMessage) any { return tx })
+    return n
+}
+
+// txInputParser returns a parser of liveToken's Transfer events with
+// transferCallABI and the given decode_tx_input setting.
+func txInputParser(t *testing.T, n *fakeNode, decode bool) *Parser {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(transferCallABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg := &config.Config{
+        DecodeTxInput: decode,
+        Contracts:     []config.ContractConfig{{Name: "Token", Address: liveToken.Hex(), Events: []string{"Transfer"}, ParsedABI: &parsed}},
+    }
+    return New(cfg, n.dial(t))
+}
+
+func TestDecodeTxInput(t *testing.T) {
+    parsed, _ := abi.JSON(strings.NewReader(transferCallABI))
+    recipient := common.HexToAddress("0x00000000000000000000000000000000000000b2")
+    data, err := parsed.Pack("transfer", recipient, big.NewInt(1_000))
+    if err != nil {
+        t.Fatal(err)
+    }
+    n := txInputNode(t, data)
+    p := txInputParser(t, n, true)
+
+    for i := 0; i < 2; i++ {
+        lg := transferFrom(liveToken, 5)
+        lg.Index = uint(i)
+        evt, err := p.Parse(context.Background(), lg)
+        if err != nil || evt == nil {
+            t.Fatalf("Parse: %v, %v", evt, err)
+        }
+        if evt["method_name"] != "transfer" || fmt.Sprint(evt["input_to"]) != recipient.Hex() || fmt.Sprint(evt["input_amount"]) != "1000" {
+            t.Errorf("event %d = %v, want the decoded transfer call", i, evt)
+        }
+    }
+    // Logs of one transaction share its lookup, tx_from included.
+    if calls := len(n.params("eth_getTransactionByHash")); calls != 1 {
+        t.Errorf("eth_getTransactionByHash called %d times, want once", calls)
+    }
+
+    // Off, no calldata fields are added.
+    evt, err := txInputParser(t, txInputNode(t, data), false).Parse(context.Background(), transferFrom(liveToken, 5))
+    if err != nil || evt["method_name"] != nil || evt["input_to"] != nil {
+        t.Errorf("Parse without decode_tx_input = %v, %v", evt, err)
+    }
+}
+
+func TestDecodeTxInputUnknownMethod(t *testing.T) {
+    for _, data := range [][]byte{{0xde, 0xad, 0xbe, 0xef, 0x01}, {0x01}, nil} {
+        evt, err := txInputParser(t, txInputNode(t, data), true).Parse(context.Background(), transferFrom(liveToken, 5))
+        if err != nil || evt == nil || evt["event_name"] != "Transfer" {
+            t.Fatalf("Parse with calldata %x = %v, %v", data, evt, err)
+        }
+        if _, ok := evt["method_name"]; ok {
+            t.Errorf("calldata %x decoded as %v", data, evt["method_name"])
+        }
+    }
+}
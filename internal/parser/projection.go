@@ -0,0 +1,53 @@
+package parser
+
+import (
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+)
+
+// routingKeys are used by the sinks to pick the output file/table and are
+// therefore never dropped nor renamed by a projection.
+var routingKeys = map[string]bool{
+    "event_name":    true,
+    "contract_name": true,
+}
+
+// project reshapes evt in place according to the projection: keys outside
+// Include (when set) or listed in Exclude are dropped, then the remaining
+// keys are renamed through FieldMap. Include and Exclude refer to the source
+// key names.
+func project(evt sink.Event, pr config.Projection) {
+    if len(pr.Include) > 0 {
+        keep := make(map[string]bool, len(pr.Include))
+        for _, k := range pr.Include {
+            keep[k] = true
+        }
+        for k := range evt {
+            if !keep[k] && !routingKeys[k] {
+                delete(evt, k)
+            }
+        }
+    }
+    for _, k := range pr.Exclude {
+        if !routingKeys[k] {
+            delete(evt, k)
+        }
+    }
+
+    if len(pr.FieldMap) == 0 {
+        return
+    }
+    renamed := make(sink.Event, len(pr.FieldMap))
+    for from, to := range pr.FieldMap {
+        if routingKeys[from] || to == "" {
+            continue
+        }
+        if v, ok := evt[from]; ok {
+            delete(evt, from)
+            renamed[to] = v
+        }
+    }
+    for k, v := range renamed {
+        evt[k] = v
+    }
+}
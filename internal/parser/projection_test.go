@@ -0,0 +1,130 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+func TestProject(t *testing.T) {
+    base := func() sink.Event {
+        return sink.Event{
+            "event_name": "Transfer", "contract_name": "Token", "chain_id": "1",
+            "from": "0x01", "to": "0x02", "value": "7", "tx_hash": "0xabc",
+        }
+    }
+    cases := []struct {
+        name string
+        pr   config.Projection
+        want sink.Event
+    }{
+        {
+            name: "empty projection keeps everything",
+            want: base(),
+        },
+        {
+            name: "rename and exclude",
+            pr:   config.Projection{FieldMap: map[string]string{"value": "amount"}, Exclude: []string{"chain_id"}},
+            want: sink.Event{"event_name": "Transfer", "contract_name": "Token", "from": "0x01", "to": "0x02", "amount": "7", "tx_hash": "0xabc"},
+        },
+        {
+            name: "include names source keys",
+            pr:   config.Projection{Include: []string{"from", "value"}, FieldMap: map[string]string{"value": "amount", "from": "sender"}},
+            want: sink.Event{"event_name": "Transfer", "contract_name": "Token", "sender": "0x01", "amount": "7"},
+        },
+        {
+            name: "exclude after include",
+            pr:   config.Projection{Include: []string{"from", "to"}, Exclude: []string{"to"}},
+            want: sink.Event{"event_name": "Transfer", "contract_name": "Token", "from": "0x01"},
+        },
+        {
+            name: "swapped names",
+            pr:   config.Projection{FieldMap: map[string]string{"from": "to", "to": "from"}},
+            want: sink.Event{"event_name": "Transfer", "contract_name": "Token", "chain_id": "1", "from": "0x02", "to": "0x01", "value": "7", "tx_hash": "0xabc"},
+        },
+        {
+            name: "routing keys are never dropped nor renamed",
+            pr:   config.Projection{Include: []string{"value"}, Exclude: []string{"event_name"}, FieldMap: map[string]string{"contract_name": "contract", "missing": "x"}},
+            want: sink.Event{"event_name": "Transfer", "contract_name": "Token", "value": "7"},
+        },
+        {
+            name: "empty target keeps the key",
+            pr:   config.Projection{FieldMap: map[string]string{"value": ""}, Include: []string{"value"}},
+            want: sink.Event{"event_name": "Transfer", "contract_name": "Token", "value": "7"},
+        },
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            evt := base()
+            project(evt, tc.pr)
+            if !reflect.DeepEqual(evt, tc.want) {
+                t.Errorf("project = %v, want %v", evt, tc.want)
+            }
+        })
+    }
+}
+
+func TestProjectionShapesOutputColumns(t *testing.T) {
+    c := tokenContract(t)
+    c.Projections = map[string]config.Projection{
+        "Transfer": {FieldMap: map[string]string{"value": "amount"}, Exclude: []string{"chain_id", "removed"}},
+        // Projections may name the event by signature too.
+        "Approval(address,address,uint256)": {Include: []string{"owner", "value"}},
+    }
+    p := New(&config.Config{Contracts: []config.ContractConfig{c}}, nil)
+
+    dir := t.TempDir()
+    s, err := sink.NewCSVSink(dir, sink.CSVOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, lg := range []*types.Log{transferFrom(liveToken, 5), approvalFrom(liveToken, 5)} {
+        evt, err := p.Decode(lg)
+        if err != nil || evt == nil {
+            t.Fatalf("Decode = %v, %v", evt, err)
+        }
+        if err := s.Write(evt); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    if err := sink.Close(s); err != nil {
+        t.Fatal(err)
+    }
+
+    header := func(file string) []string {
+        data, err := os.ReadFile(filepath.Join(dir, file))
+        if err != nil {
+            t.Fatal(err)
+        }
+        return strings.Split(strings.SplitN(string(data), "\n", 2)[0], ",")
+    }
+    cols := header("Token_Transfer.csv")
+    has := func(col string) bool {
+        for _, c := range cols {
+            if c == col {
+                return true
+            }
+        }
+        return false
+    }
+    for _, col := range []string{"amount", "from", "to", "tx_hash"} {
+        if !has(col) {
+            t.Errorf("Transfer columns %v lack %s", cols, col)
+        }
+    }
+    for _, col := range []string{"value", "chain_id", "removed"} {
+        if has(col) {
+            t.Errorf("Transfer columns %v still have %s", cols, col)
+        }
+    }
+    if cols := header("Token_Approval.csv"); !reflect.DeepEqual(cols, []string{"contract_name", "event_name", "owner", "value"}) {
+        t.Errorf("Approval columns = %v, want contract_name, event_name, owner and value", cols)
+    }
+}
@@ -0,0 +1,114 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+
+	"etl-web3/internal/sink"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// signature is an event known only from the signature database. A
+// signature does not tell which parameters are indexed, so decoding assumes
+// the first len(topics)-1 parameters are, as is the case for most events
+// (e.g. Transfer(address indexed, address indexed, uint256)).
+type signature struct {
+    text  string
+    name  string
+    types []abi.Type // nil when a parameter type is not supported
+}
+
+// parseSignatures prepares the signature database entries for decoding.
+func parseSignatures(db map[common.Hash]string) map[common.Hash]signature {
+    if len(db) == 0 {
+        return nil
+    }
+    out := make(map[common.Hash]signature, len(db))
+    for id, text := range db {
+        open := strings.IndexByte(text, '(')
+        sig := signature{text: text, name: text[:open]}
+        params := text[open+1 : len(text)-1]
+        // Tuple parameters would need their components; keep the name only.
+        if !strings.Contains(params, "(") {
+            sig.types = []abi.Type{}
+            for _, p := range strings.Split(params, ",") {
+                if p == "" {
+                    continue
+                }
+                t, err := abi.NewType(p, "", nil)
+                if err != nil {
+                    sig.types = nil
+                    break
+                }
+                sig.types = append(sig.types, t)
+            }
+        }
+        out[id] = sig
+    }
+    return out
+}
+
+// decodeSignature fills evt from the signature database entry of lg's
+// topic0. It reports false when topic0 is unknown. Parameters are named
+// arg0, arg1… and the event is flagged with decode_warning since the
+// indexed layout is a guess; when the log does not fit it, only the event
+// name and the raw data are kept.
+func (p *Parser) decodeSignature(lg *types.Log, evt sink.Event) bool {
+    if len(lg.Topics) == 0 {
+        return false
+    }
+    sig, ok := p.signatures[lg.Topics[0]]
+    if !ok {
+        return false
+    }
+    evt["event_name"] = sig.name
+    evt["event_signature"] = sig.text
+
+    args, inputs, err := sig.decode(lg)
+    if err != nil {
+        evt["decode_warning"] = fmt.Sprintf("event from signature_db not decoded: %v", err)
+        evt["data"] = hexutil.Encode(lg.Data)
+        return true
+    }
+    normalizeArgs(inputs, args)
+    for k, v := range args {
+        evt[k] = v
+    }
+    evt["decode_warning"] = fmt.Sprintf("decoded from signature_db assuming the first %d parameter(s) are indexed", len(lg.Topics)-1)
+    return true
+}
+
+// decode unpacks lg assuming its first len(topics)-1 parameters are indexed.
+func (s signature) decode(lg *types.Log) (map[string]interface{}, abi.Arguments, error) {
+    if s.types == nil {
+        return nil, nil, fmt.Errorf("unsupported parameter types")
+    }
+    indexed := len(lg.Topics) - 1
+    if indexed > len(s.types) {
+        return nil, nil, fmt.Errorf("log has %d indexed topics but the signature %d parameters", indexed, len(s.types))
+    }
+
+    inputs := make(abi.Arguments, len(s.types))
+    for i, t := range s.types {
+        inputs[i] = abi.Argument{Name: fmt.Sprintf("arg%d", i), Type: t, Indexed: i < indexed}
+    }
+
+    args := make(map[string]interface{})
+    if err := inputs.UnpackIntoMap(args, lg.Data); err != nil {
+        return nil, nil, err
+    }
+    var topicArgs abi.Arguments
+    for _, in := range inputs {
+        if in.Indexed {
+            topicArgs = append(topicArgs, in)
+        }
+    }
+    if err := abi.ParseTopicsIntoMap(args, topicArgs, lg.Topics[1:]); err != nil {
+        return nil, nil, err
+    }
+    return args, inputs, nil
+}
@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// approvalABI is an ABI without the Transfer event.
+const approvalABI = `[{"anonymous":false,"type":"event","name":"Approval","inputs":[
+	{"indexed":true,"name":"owner","type":"address"},
+	{"indexed":true,"name":"spender","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]}]`
+
+// signatureParser returns a parser for liveToken, whose ABI lacks Transfer,
+// with a signature database naming it.
+func signatureParser(t *testing.T) *Parser {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(approvalABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return New(&config.Config{
+        Contracts:  []config.ContractConfig{{Name: "Token", Address: liveToken.Hex(), ParsedABI: &parsed}},
+        Signatures: map[common.Hash]string{transferID: "Transfer(address,address,uint256)"},
+    }, nil)
+}
+
+func TestSignatureDBNamesEventMissingFromABI(t *testing.T) {
+    evt, err := signatureParser(t).Decode(transferFrom(liveToken, 5))
+    if err != nil || evt == nil {
+        t.Fatalf("Decode = %v, %v", evt, err)
+    }
+    if evt["event_name"] != "Transfer" || evt["event_signature"] != "Transfer(address,address,uint256)" {
+        t.Errorf("event_name = %v, event_signature = %v", evt["event_name"], evt["event_signature"])
+    }
+    if evt["arg0"] != common.HexToAddress("0x01") || evt["arg1"] != common.HexToAddress("0x02") {
+        t.Errorf("indexed args = %v, %v", evt["arg0"], evt["arg1"])
+    }
+    if evt["arg2"] != "7" {
+        t.Errorf("arg2 = %v (%T), want \"7\"", evt["arg2"], evt["arg2"])
+    }
+    if w, _ := evt["decode_warning"].(string); !strings.Contains(w, "first 2 parameter(s) are indexed") {
+        t.Errorf("decode_warning = %q", w)
+    }
+}
+
+func TestSignatureDBKeepsRawDataOfMisfitLog(t *testing.T) {
+    lg := transferFrom(liveToken, 5)
+    lg.Topics = append(lg.Topics, common.HexToHash("0x03"), common.HexToHash("0x04")) // 4 indexed topics for 3 parameters
+    evt, err := signatureParser(t).Decode(lg)
+    if err != nil || evt == nil {
+        t.Fatalf("Decode = %v, %v", evt, err)
+    }
+    if evt["event_name"] != "Transfer" || evt["data"] != "0x"+common.Bytes2Hex(common.LeftPadBytes(big.NewInt(7).Bytes(), 32)) {
+        t.Errorf("event = %v", evt)
+    }
+    if w, _ := evt["decode_warning"].(string); !strings.Contains(w, "not decoded") {
+        t.Errorf("decode_warning = %q", w)
+    }
+}
+
+func TestUnknownTopicWithoutSignature(t *testing.T) {
+    lg := transferFrom(liveToken, 5)
+    lg.Topics[0] = common.HexToHash("0xbeef")
+    evt, _ := signatureParser(t).Decode(lg)
+    if evt != nil && evt["event_name"] == "Transfer" {
+        t.Fatalf("unknown topic0 named Transfer: %v", evt)
+    }
+}
@@ -0,0 +1,72 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// nullUntil answers null, as providers do for blocks past their head, to
+// the first n requests and header afterwards.
+func nullUntil(n int, header *types.Header) func([]json.RawMessage) (any, error) {
+    calls := 0
+    return func([]json.RawMessage) (any, error) {
+        calls++
+        if calls <= n {
+            return nil, nil
+        }
+        return header, nil
+    }
+}
+
+func TestGetBlockByNumberNullIsNotFound(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("eth_getBlockByNumber", nullUntil(100, nil))
+    c := dialFake(t, node, 3)
+
+    block, err := c.GetBlockByNumber(context.Background(), big.NewInt(42))
+    if !errors.Is(err, ErrNotFound) {
+        t.Fatalf("GetBlockByNumber = %v, %v; want ErrNotFound", block, err)
+    }
+    if !strings.Contains(err.Error(), "block 42") {
+        t.Errorf("error %q does not name the block", err)
+    }
+    if got := node.callCount("eth_getBlockByNumber"); got != 3 {
+        t.Errorf("node called %d times, want 3 attempts", got)
+    }
+}
+
+func TestGetHeaderByNumberNullIsNotFound(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("eth_getBlockByNumber", nullUntil(100, nil))
+    c := dialFake(t, node, 2)
+
+    if _, err := c.GetHeaderByNumber(context.Background(), big.NewInt(42)); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "header 42") {
+        t.Fatalf("GetHeaderByNumber = %v, want ErrNotFound for header 42", err)
+    }
+    if _, err := c.GetHeaderByNumber(context.Background(), nil); !errors.Is(err, ErrNotFound) || !strings.Contains(err.Error(), "latest header") {
+        t.Fatalf("GetHeaderByNumber(nil) = %v, want ErrNotFound for the latest header", err)
+    }
+}
+
+func TestGetHeaderByNumberRetriesNull(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("eth_getBlockByNumber", nullUntil(2, &types.Header{Number: big.NewInt(42), Time: 1_700_000_000, Difficulty: big.NewInt(0)}))
+    c := dialFake(t, node, 3)
+
+    header, err := c.GetHeaderByNumber(context.Background(), big.NewInt(42))
+    if err != nil {
+        t.Fatalf("GetHeaderByNumber: %v", err)
+    }
+    if header.Number.Uint64() != 42 || header.Time != 1_700_000_000 {
+        t.Fatalf("header = %d at %d, want 42 at 1700000000", header.Number, header.Time)
+    }
+    if got := c.Stats().Retries; got != 2 {
+        t.Errorf("retries = %d, want 2", got)
+    }
+}
@@ -0,0 +1,144 @@
+package rpc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"etl-web3/internal/metrics"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrCircuitOpen is returned without contacting the node while the endpoint's
+// circuit breaker is open.
+var ErrCircuitOpen = errors.New("rpc circuit breaker open")
+
+const (
+    breakerClosed   = "closed"
+    breakerOpen     = "open"
+    breakerHalfOpen = "half-open"
+)
+
+// breaker is a consecutive-failure circuit breaker guarding one endpoint.
+// After threshold failures within window it opens and fails every call fast
+// for cooldown; then a single probe call is let through (half-open) and its
+// outcome closes or re-opens the breaker. A nil breaker never trips.
+type breaker struct {
+    endpoint  string
+    threshold int
+    window    time.Duration
+    cooldown  time.Duration
+
+    mu           sync.Mutex
+    state        string
+    failures     int
+    firstFailure time.Time
+    openedAt     time.Time
+    probing      bool
+}
+
+// newBreaker returns nil (disabled) when threshold is not positive.
+func newBreaker(endpoint string, cfg breakerConfig) *breaker {
+    if cfg.threshold <= 0 {
+        return nil
+    }
+    b := &breaker{
+        endpoint:  endpoint,
+        threshold: cfg.threshold,
+        window:    cfg.window,
+        cooldown:  cfg.cooldown,
+        state:     breakerClosed,
+    }
+    metrics.SetRPCBreakerState(endpoint, breakerClosed)
+    return b
+}
+
+type breakerConfig struct {
+    threshold int
+    window    time.Duration
+    cooldown  time.Duration
+}
+
+// allow reports whether a call may be attempted now.
+func (b *breaker) allow() error {
+    if b == nil {
+        return nil
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    switch b.state {
+    case breakerOpen:
+        if time.Since(b.openedAt) < b.cooldown {
+            return ErrCircuitOpen
+        }
+        b.setState(breakerHalfOpen)
+        b.probing = true
+        return nil
+    case breakerHalfOpen:
+        // Only one probe at a time while half-open.
+        if b.probing {
+            return ErrCircuitOpen
+        }
+        b.probing = true
+        return nil
+    default:
+        return nil
+    }
+}
+
+// success closes the breaker and resets the failure count.
+func (b *breaker) success() {
+    if b == nil {
+        return
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    b.failures = 0
+    b.probing = false
+    if b.state != breakerClosed {
+        logrus.Infof("RPC circuit breaker closed for %s", b.endpoint)
+        b.setState(breakerClosed)
+    }
+}
+
+// failure records a failed call and opens the breaker when the threshold is
+// reached within the window (or immediately when a half-open probe fails).
+func (b *breaker) failure() {
+    if b == nil {
+        return
+    }
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    now := time.Now()
+    if b.state == breakerHalfOpen {
+        b.probing = false
+        b.open(now)
+        return
+    }
+
+    if b.failures == 0 || now.Sub(b.firstFailure) > b.window {
+        b.failures = 0
+        b.firstFailure = now
+    }
+    b.failures++
+    if b.state == breakerClosed && b.failures >= b.threshold {
+        b.open(now)
+    }
+}
+
+func (b *breaker) open(now time.Time) {
+    logrus.Warnf("RPC circuit breaker open for %s after %d consecutive failures; cooling down for %s", b.endpoint, b.failures, b.cooldown)
+    b.openedAt = now
+    b.failures = 0
+    b.setState(breakerOpen)
+    metrics.IncRPCBreakerTrips(b.endpoint)
+}
+
+func (b *breaker) setState(state string) {
+    b.state = state
+    metrics.SetRPCBreakerState(b.endpoint, state)
+}
@@ -0,0 +1,133 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+)
+
+// breakerState returns the state the breaker of endpoint exports.
+func breakerState(endpoint string) string {
+    v, _ := expvar.Get("rpc_circuit_breaker_state").(*expvar.Map).Get(endpoint).(*expvar.String)
+    if v == nil {
+        return ""
+    }
+    return v.Value()
+}
+
+func TestBreakerOpensAtThreshold(t *testing.T) {
+    b := newBreaker(t.Name(), breakerConfig{threshold: 3, window: time.Minute, cooldown: time.Minute})
+    for i := 0; i < 2; i++ {
+        b.failure()
+        if err := b.allow(); err != nil {
+            t.Fatalf("breaker open after %d failures, threshold 3", i+1)
+        }
+    }
+    // A success resets the count.
+    b.success()
+    b.failure()
+    b.failure()
+    if err := b.allow(); err != nil {
+        t.Fatalf("breaker open after a success and 2 failures: %v", err)
+    }
+    b.failure()
+    if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+        t.Fatalf("allow after 3 failures = %v, want ErrCircuitOpen", err)
+    }
+    if got := breakerState(t.Name()); got != breakerOpen {
+        t.Errorf("exported state = %q, want open", got)
+    }
+}
+
+func TestBreakerFailuresOutsideWindowDoNotAccumulate(t *testing.T) {
+    b := newBreaker(t.Name(), breakerConfig{threshold: 2, window: 20 * time.Millisecond, cooldown: time.Minute})
+    b.failure()
+    time.Sleep(40 * time.Millisecond)
+    b.failure()
+    if err := b.allow(); err != nil {
+        t.Fatalf("failures further apart than the window opened the breaker: %v", err)
+    }
+}
+
+func TestBreakerHalfOpenRecovery(t *testing.T) {
+    b := newBreaker(t.Name(), breakerConfig{threshold: 1, window: time.Minute, cooldown: 20 * time.Millisecond})
+    b.failure()
+    if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+        t.Fatalf("allow while cooling down = %v, want ErrCircuitOpen", err)
+    }
+    time.Sleep(30 * time.Millisecond)
+
+    // One probe is let through; others fail fast until it reports back.
+    if err := b.allow(); err != nil {
+        t.Fatalf("probe after the cooldown: %v", err)
+    }
+    if got := breakerState(t.Name()); got != breakerHalfOpen {
+        t.Errorf("exported state = %q, want half-open", got)
+    }
+    if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+        t.Fatalf("second call during the probe = %v, want ErrCircuitOpen", err)
+    }
+
+    // A failed probe re-opens it for another cooldown.
+    b.failure()
+    if err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+        t.Fatalf("allow after a failed probe = %v, want ErrCircuitOpen", err)
+    }
+    time.Sleep(30 * time.Millisecond)
+    if err := b.allow(); err != nil {
+        t.Fatalf("second probe: %v", err)
+    }
+    b.success()
+    if got := breakerState(t.Name()); got != breakerClosed {
+        t.Errorf("exported state = %q, want closed", got)
+    }
+    for i := 0; i < 3; i++ {
+        if err := b.allow(); err != nil {
+            t.Fatalf("allow after recovery: %v", err)
+        }
+    }
+}
+
+func TestBreakerDisabled(t *testing.T) {
+    for _, threshold := range []int{0, -1} {
+        b := newBreaker(t.Name(), breakerConfig{threshold: threshold})
+        if b != nil {
+            t.Fatalf("threshold %d built a breaker", threshold)
+        }
+        for i := 0; i < 10; i++ {
+            b.failure()
+        }
+        if err := b.allow(); err != nil {
+            t.Fatalf("disabled breaker refused a call: %v", err)
+        }
+        b.success()
+    }
+}
+
+func TestClientFailsFastWhileBreakerOpen(t *testing.T) {
+    node := newFakeNode(t)
+    node.status = http.StatusServiceUnavailable
+    retry := config.RetryConfig{Attempts: 1, DelayMS: 1, BreakerThreshold: 2, BreakerCooldownMS: 60_000}
+    c, err := Dial(context.Background(), node.URL, retry, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    defer c.Close()
+
+    for i := 0; i < 2; i++ {
+        if _, err := c.LatestBlockNumber(context.Background()); err == nil || errors.Is(err, ErrCircuitOpen) {
+            t.Fatalf("call %d = %v, want the node's error", i+1, err)
+        }
+    }
+    if _, err := c.LatestBlockNumber(context.Background()); !errors.Is(err, ErrCircuitOpen) {
+        t.Fatalf("call past the threshold = %v, want ErrCircuitOpen", err)
+    }
+    if n := node.callCount("eth_blockNumber"); n != 2 {
+        t.Fatalf("node saw %d calls, want 2", n)
+    }
+}
@@ -2,44 +2,140 @@ package rpc
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"net/http"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"etl-web3/internal/config"
+	"etl-web3/internal/metrics"
 
 	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
 	"github.com/sirupsen/logrus"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 )
 
+// codeMethodNotFound is the JSON-RPC error code of unsupported methods.
+const codeMethodNotFound = -32601
+
+// IsMethodNotFound reports whether err means the node does not implement the
+// called RPC method.
+func IsMethodNotFound(err error) bool {
+    var rpcErr gethrpc.Error
+    return errors.As(err, &rpcErr) && rpcErr.ErrorCode() == codeMethodNotFound
+}
+
 // Client wraps the go-ethereum ethclient with potential additional helpers.
 type Client struct {
     *ethclient.Client
+    // subs, when set by DialSubscriptions, serves subscriptions instead of
+    // the main endpoint.
+    subs *ethclient.Client
 
     retryCfg config.RetryConfig
+    breaker  *breaker
+    // url is the dialled endpoint and endpoint its redacted form, which
+    // keys the per-endpoint metrics.
+    url      string
+    endpoint string
+    // callTimeout bounds every single attempt of a wrapped call so a hung
+    // request fails and is retried instead of stalling its worker.
+    callTimeout time.Duration
+    // throttle holds the Retry-After of the last HTTP 429 (nil for
+    // WebSocket endpoints).
+    throttle *throttleTransport
+    // noTraceBlock is set once the node rejects trace_block; TraceBlock
+    // then uses debug_traceBlockByNumber.
+    noTraceBlock atomic.Bool
+
+    calls    atomic.Uint64
+    retries  atomic.Uint64
+    failures atomic.Uint64
+}
+
+// Stats counts the RPC attempts made through the client's retrying helpers.
+type Stats struct {
+    Calls    uint64 `json:"calls"`    // attempts sent to the node, retries included
+    Retries  uint64 `json:"retries"`  // attempts beyond the first of a call
+    Failures uint64 `json:"failures"` // calls that failed after all attempts
+}
+
+// Stats returns a snapshot of the client's call counters.
+func (c *Client) Stats() Stats {
+    return Stats{
+        Calls:    c.calls.Load(),
+        Retries:  c.retries.Load(),
+        Failures: c.failures.Load(),
+    }
+}
+
+// WithUserAgent sets the User-Agent header sent with every request, falling
+// back to config.DefaultRPCUserAgent when ua is empty.
+func WithUserAgent(ua string) gethrpc.ClientOption {
+    if ua == "" {
+        ua = config.DefaultRPCUserAgent
+    }
+    return gethrpc.WithHeader("User-Agent", ua)
 }
 
 // Dial establishes a new RPC connection with retry support using the provided context and URL.
 // The retry configuration controls the number of attempts and the delay (in milliseconds) between them.
-func Dial(ctx context.Context, url string, retryCfg config.RetryConfig) (*Client, error) {
+// HTTP(S) endpoints use a connection pool tuned by transportCfg, WebSocket
+// ones its ws_compression setting; both use its TLS settings.
+// Options such as WithUserAgent are passed through to the underlying go-ethereum client.
+func Dial(ctx context.Context, url string, retryCfg config.RetryConfig, transportCfg config.RPCTransportConfig, opts ...gethrpc.ClientOption) (*Client, error) {
     if retryCfg.Attempts == 0 {
         retryCfg.Attempts = 3
     }
     if retryCfg.DelayMS == 0 {
         retryCfg.DelayMS = 1500
     }
+    if retryCfg.BreakerWindowMS == 0 {
+        retryCfg.BreakerWindowMS = 60_000
+    }
+    if retryCfg.BreakerCooldownMS == 0 {
+        retryCfg.BreakerCooldownMS = 30_000
+    }
 
     var (
-        cli *ethclient.Client
-        err error
+        rc       *gethrpc.Client
+        err      error
+        throttle *throttleTransport
     )
+    if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+        t, err := newTransport(transportCfg)
+        if err != nil {
+            return nil, err
+        }
+        throttle = newThrottleTransport(t)
+        opts = append([]gethrpc.ClientOption{gethrpc.WithHTTPClient(&http.Client{Transport: throttle})}, opts...)
+    } else if isWebsocketURL(url) {
+        wsOpts, err := websocketOptions(transportCfg)
+        if err != nil {
+            return nil, err
+        }
+        opts = append(wsOpts, opts...)
+    }
 
     for attempt := 1; attempt <= retryCfg.Attempts; attempt++ {
-        cli, err = ethclient.DialContext(ctx, url)
+        rc, err = gethrpc.DialOptions(ctx, url, opts...)
         if err == nil {
-            return &Client{Client: cli, retryCfg: retryCfg}, nil
+            cli := ethclient.NewClient(rc)
+            endpoint := config.RedactURL(url)
+            br := newBreaker(endpoint, breakerConfig{
+                threshold: retryCfg.BreakerThreshold,
+                window:    time.Duration(retryCfg.BreakerWindowMS) * time.Millisecond,
+                cooldown:  time.Duration(retryCfg.BreakerCooldownMS) * time.Millisecond,
+            })
+            return &Client{Client: cli, retryCfg: retryCfg, breaker: br, throttle: throttle, url: url, endpoint: endpoint}, nil
         }
 
         logrus.Warnf("RPC dial failed (attempt %d/%d): %v", attempt, retryCfg.Attempts, err)
@@ -57,64 +153,162 @@ func Dial(ctx context.Context, url string, retryCfg config.RetryConfig) (*Client
     return nil, err
 }
 
-// GetBlockByNumber retrieves a block by its number with retry logic.
-// Pass nil as the number parameter to fetch the latest block.
-func (c *Client) GetBlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
-    var (
-        block *types.Block
-        err   error
-    )
+// WithCallTimeout sets the per-attempt timeout applied to every RPC call made
+// through the client's helpers. Zero disables it.
+func (c *Client) WithCallTimeout(d time.Duration) *Client {
+    c.callTimeout = d
+    return c
+}
+
+// withRetry runs fn until it succeeds, the configured attempts are exhausted
+// or the context is cancelled, waiting the configured delay (or the provider's
+// Retry-After, when longer) between attempts.
+// Every attempt goes through the endpoint's circuit breaker: while it is open
+// the call fails fast with ErrCircuitOpen instead of hitting the node. Each
+// attempt gets its own callTimeout deadline derived from ctx. Attempts,
+// retries and calls that end in an error are counted in Stats.
+func (c *Client) withRetry(ctx context.Context, op string, fn func(context.Context) error) error {
+    err := c.retry(ctx, op, fn)
+    if err != nil {
+        c.failures.Add(1)
+        metrics.IncRPCFailure(c.endpoint, opMethod(op))
+    }
+    return err
+}
 
+// opMethod is the metrics label of op: "CallContract balanceOf" counts as
+// CallContract.
+func opMethod(op string) string {
+    method, _, _ := strings.Cut(op, " ")
+    return method
+}
+
+// recordError publishes the error of a failed attempt as the endpoint's
+// last error, with the endpoint URL, which may carry an API key, redacted.
+func (c *Client) recordError(op string, err error) {
+    msg := err.Error()
+    if c.url != "" {
+        msg = strings.ReplaceAll(msg, c.url, c.endpoint)
+    }
+    metrics.SetRPCLastError(c.endpoint, opMethod(op), msg)
+}
+
+func (c *Client) retry(ctx context.Context, op string, fn func(context.Context) error) error {
+    var err error
     for attempt := 1; attempt <= c.retryCfg.Attempts; attempt++ {
-        block, err = c.Client.BlockByNumber(ctx, number)
-        if err == nil {
-            // DEBUG: print transaction types within the fetched block
-            logrus.Infof("Processing block %d with %d txs", block.NumberU64(), len(block.Transactions()))
-            for i, tx := range block.Transactions() {
-                logrus.Infof("TX %d type: %d", i, tx.Type())
+        if berr := c.breaker.allow(); berr != nil {
+            if err == nil {
+                err = berr
             }
-            return block, nil
+            return fmt.Errorf("%s: %w", op, err)
+        }
+
+        c.calls.Add(1)
+        if attempt > 1 {
+            c.retries.Add(1)
+            metrics.IncRPCRetry(c.endpoint, opMethod(op))
+        }
+        err = c.attempt(ctx, fn)
+        if err == nil {
+            c.breaker.success()
+            return nil
         }
+        if IsMethodNotFound(err) {
+            // The node answered; retrying an unsupported method is pointless.
+            c.breaker.success()
+            return fmt.Errorf("%s: %w", op, err)
+        }
+        c.breaker.failure()
+        c.recordError(op, err)
 
-        logrus.Warnf("GetBlockByNumber failed (attempt %d/%d): %v", attempt, c.retryCfg.Attempts, err)
+        logrus.Warnf("%s failed (attempt %d/%d): %v", op, attempt, c.retryCfg.Attempts, err)
 
+        // Don't wait after the final attempt
         if attempt < c.retryCfg.Attempts {
+            delay := time.Duration(c.retryCfg.DelayMS) * time.Millisecond
+            // Honour a Retry-After sent with an HTTP 429.
+            if wait := c.throttle.wait(); wait > delay {
+                delay = wait
+            }
             select {
             case <-ctx.Done():
-                return nil, ctx.Err()
-            case <-time.After(time.Duration(c.retryCfg.DelayMS) * time.Millisecond):
+                return ctx.Err()
+            case <-time.After(delay):
             }
         }
     }
+    return err
+}
 
-    return nil, err
+// attempt runs fn once, bounded by callTimeout when set.
+func (c *Client) attempt(ctx context.Context, fn func(context.Context) error) error {
+    if c.callTimeout <= 0 {
+        return fn(ctx)
+    }
+    callCtx, cancel := context.WithTimeout(ctx, c.callTimeout)
+    defer cancel()
+    return fn(callCtx)
 }
 
-// GetLogs fetches logs that match the given filter query with retry logic.
-func (c *Client) GetLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
-    var (
-        logs []types.Log
-        err  error
-    )
+// ErrNotFound is returned, once the retries are exhausted, when the node
+// answers a block or header request without error but without a result,
+// as some providers do for blocks just past their head. ethclient reports
+// such a null result as ethereum.NotFound, which is mapped to ErrNotFound.
+var ErrNotFound = errors.New("not found")
+
+// notFound describes a missing block or header; it is retried like any
+// transient failure since the block usually shows up shortly after.
+func notFound(what string, number *big.Int) error {
+    if number == nil {
+        return fmt.Errorf("latest %s: %w", what, ErrNotFound)
+    }
+    return fmt.Errorf("%s %s: %w", what, number, ErrNotFound)
+}
 
-    for attempt := 1; attempt <= c.retryCfg.Attempts; attempt++ {
-        logs, err = c.Client.FilterLogs(ctx, query)
-        if err == nil {
-            return logs, nil
+// GetBlockByNumber retrieves a block by its number with retry logic.
+// Pass nil as the number parameter to fetch the latest block.
+func (c *Client) GetBlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+    var block *types.Block
+    err := c.withRetry(ctx, "GetBlockByNumber", func(ctx context.Context) error {
+        var err error
+        block, err = c.Client.BlockByNumber(ctx, number)
+        if errors.Is(err, ethereum.NotFound) || (err == nil && block == nil) {
+            err = notFound("block", number)
         }
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    logrus.Debugf("Fetched block %d with %d txs", block.NumberU64(), len(block.Transactions()))
+    return block, nil
+}
 
-        logrus.Warnf("GetLogs failed (attempt %d/%d): %v", attempt, c.retryCfg.Attempts, err)
-
-        if attempt < c.retryCfg.Attempts {
-            select {
-            case <-ctx.Done():
-                return nil, ctx.Err()
-            case <-time.After(time.Duration(c.retryCfg.DelayMS) * time.Millisecond):
-            }
-        }
+// GetLogs fetches logs that match the given filter query with retry logic.
+func (c *Client) GetLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
+    var logs []types.Log
+    err := c.withRetry(ctx, "GetLogs", func(ctx context.Context) error {
+        var err error
+        logs, err = c.Client.FilterLogs(ctx, query)
+        return err
+    })
+    if err != nil {
+        return nil, err
     }
+    return logs, nil
+}
 
-    return nil, err
+// GetLogsByBlockHash fetches the logs of exactly the block identified by hash,
+// using the BlockHash filter instead of a block range. Unlike a number range,
+// the result cannot silently include logs from a block that replaced it in a
+// reorg.
+func (c *Client) GetLogsByBlockHash(ctx context.Context, hash common.Hash, addresses []common.Address, topics [][]common.Hash) ([]types.Log, error) {
+    query := ethereum.FilterQuery{
+        BlockHash: &hash,
+        Addresses: addresses,
+        Topics:    topics,
+    }
+    return c.GetLogs(ctx, query)
 }
 
 // GetHeaderByNumber retrieves a block header by its number with retry logic.
@@ -122,56 +316,202 @@ func (c *Client) GetLogs(ctx context.Context, query ethereum.FilterQuery) ([]typ
 // lightweight alternative to fetching the full block and is useful when only
 // the timestamp or basic metadata is required.
 func (c *Client) GetHeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
-    var (
-        header *types.Header
-        err    error
-    )
-
-    for attempt := 1; attempt <= c.retryCfg.Attempts; attempt++ {
+    var header *types.Header
+    err := c.withRetry(ctx, "GetHeaderByNumber", func(ctx context.Context) error {
+        var err error
         header, err = c.Client.HeaderByNumber(ctx, number)
-        if err == nil {
-            return header, nil
-        }
-
-        logrus.Warnf("GetHeaderByNumber failed (attempt %d/%d): %v", attempt, c.retryCfg.Attempts, err)
-
-        if attempt < c.retryCfg.Attempts {
-            select {
-            case <-ctx.Done():
-                return nil, ctx.Err()
-            case <-time.After(time.Duration(c.retryCfg.DelayMS) * time.Millisecond):
-            }
+        if errors.Is(err, ethereum.NotFound) || (err == nil && header == nil) {
+            err = notFound("header", number)
         }
+        return err
+    })
+    if err != nil {
+        return nil, err
     }
-
-    return nil, err
+    return header, nil
 }
 
 // LatestBlockNumber fetches the latest block number via eth_blockNumber with
 // retry logic. It is significantly cheaper than downloading the full latest
 // block when only the height is required.
 func (c *Client) LatestBlockNumber(ctx context.Context) (uint64, error) {
-    var (
-        num uint64
-        err error
-    )
-
-    for attempt := 1; attempt <= c.retryCfg.Attempts; attempt++ {
+    var num uint64
+    err := c.withRetry(ctx, "LatestBlockNumber", func(ctx context.Context) error {
+        var err error
         num, err = c.Client.BlockNumber(ctx)
-        if err == nil {
-            return num, nil
-        }
+        return err
+    })
+    if err != nil {
+        return 0, err
+    }
+    return num, nil
+}
 
-        logrus.Warnf("LatestBlockNumber failed (attempt %d/%d): %v", attempt, c.retryCfg.Attempts, err)
+// BlockReceipts fetches every receipt of the block with the given hash via
+// eth_getBlockReceipts with retry logic. Nodes lacking the method return an
+// error for which IsMethodNotFound is true.
+func (c *Client) BlockReceipts(ctx context.Context, blockHash common.Hash) ([]*types.Receipt, error) {
+    var receipts []*types.Receipt
+    err := c.withRetry(ctx, "BlockReceipts", func(ctx context.Context) error {
+        var err error
+        receipts, err = c.Client.BlockReceipts(ctx, gethrpc.BlockNumberOrHashWithHash(blockHash, false))
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return receipts, nil
+}
 
-        if attempt < c.retryCfg.Attempts {
-            select {
-            case <-ctx.Done():
-                return 0, ctx.Err()
-            case <-time.After(time.Duration(c.retryCfg.DelayMS) * time.Millisecond):
-            }
+// GetTransactionReceipt fetches the receipt of a single transaction with retry
+// logic.
+func (c *Client) GetTransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
+    var receipt *types.Receipt
+    err := c.withRetry(ctx, "TransactionReceipt", func(ctx context.Context) error {
+        var err error
+        receipt, err = c.Client.TransactionReceipt(ctx, txHash)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return receipt, nil
+}
+
+// GetTransaction fetches a transaction by hash with retry logic.
+func (c *Client) GetTransaction(ctx context.Context, hash common.Hash) (*types.Transaction, error) {
+    var tx *types.Transaction
+    err := c.withRetry(ctx, "TransactionByHash", func(ctx context.Context) error {
+        var err error
+        tx, _, err = c.Client.TransactionByHash(ctx, hash)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return tx, nil
+}
+
+// GetChainID fetches the chain ID (eth_chainId) with retry logic.
+func (c *Client) GetChainID(ctx context.Context) (*big.Int, error) {
+    var id *big.Int
+    err := c.withRetry(ctx, "ChainID", func(ctx context.Context) error {
+        var err error
+        id, err = c.Client.ChainID(ctx)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return id, nil
+}
+
+// GetNetworkID fetches the network ID (net_version) with retry logic.
+func (c *Client) GetNetworkID(ctx context.Context) (*big.Int, error) {
+    var id *big.Int
+    err := c.withRetry(ctx, "NetworkID", func(ctx context.Context) error {
+        var err error
+        id, err = c.Client.NetworkID(ctx)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return id, nil
+}
+
+// ErrNoCode is returned by Call when the contract has no code at the
+// requested block, e.g. because it self-destructed.
+var ErrNoCode = errors.New("no contract code at address")
+
+// GetCode fetches the code of addr at the given block (nil means latest) via
+// eth_getCode with retry logic. It is empty for accounts without code.
+func (c *Client) GetCode(ctx context.Context, addr common.Address, block *big.Int) ([]byte, error) {
+    var code []byte
+    err := c.withRetry(ctx, "CodeAt", func(ctx context.Context) error {
+        var err error
+        code, err = c.Client.CodeAt(ctx, addr, block)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    return code, nil
+}
+
+// Call packs the given ABI method with its arguments, executes a read-only
+// eth_call against the contract at the requested block (nil means latest) and
+// returns the unpacked outputs. Transient RPC failures are retried. An empty
+// result from an address without code fails with ErrNoCode.
+func (c *Client) Call(ctx context.Context, contract common.Address, contractABI *abi.ABI, block *big.Int, method string, args ...interface{}) ([]interface{}, error) {
+    input, err := contractABI.Pack(method, args...)
+    if err != nil {
+        return nil, fmt.Errorf("failed to pack call to %s: %w", method, err)
+    }
+
+    msg := ethereum.CallMsg{To: &contract, Data: input}
+
+    var output []byte
+    err = c.withRetry(ctx, "CallContract "+method, func(ctx context.Context) error {
+        var err error
+        output, err = c.Client.CallContract(ctx, msg, block)
+        return err
+    })
+    if err != nil {
+        return nil, err
+    }
+    if len(output) == 0 {
+        if code, err := c.GetCode(ctx, contract, block); err == nil && len(code) == 0 {
+            return nil, fmt.Errorf("%w %s", ErrNoCode, contract.Hex())
         }
     }
 
-    return 0, err
-} 
\ No newline at end of file
+    values, err := contractABI.Unpack(method, output)
+    if err != nil {
+        return nil, fmt.Errorf("failed to unpack result of %s: %w", method, err)
+    }
+    return values, nil
+}
+
+// ReadString calls a view method returning a single string (e.g. name() or
+// symbol() on ERC-20 tokens).
+func (c *Client) ReadString(ctx context.Context, contract common.Address, contractABI *abi.ABI, block *big.Int, method string, args ...interface{}) (string, error) {
+    values, err := c.Call(ctx, contract, contractABI, block, method, args...)
+    if err != nil {
+        return "", err
+    }
+    if len(values) != 1 {
+        return "", fmt.Errorf("%s returned %d values, expected 1", method, len(values))
+    }
+    str, ok := values[0].(string)
+    if !ok {
+        return "", fmt.Errorf("%s returned %T, expected string", method, values[0])
+    }
+    return str, nil
+}
+
+// ReadUint calls a view method returning a single unsigned integer (e.g.
+// decimals() or totalSupply()). Every uintN width is normalised to *big.Int.
+func (c *Client) ReadUint(ctx context.Context, contract common.Address, contractABI *abi.ABI, block *big.Int, method string, args ...interface{}) (*big.Int, error) {
+    values, err := c.Call(ctx, contract, contractABI, block, method, args...)
+    if err != nil {
+        return nil, err
+    }
+    if len(values) != 1 {
+        return nil, fmt.Errorf("%s returned %d values, expected 1", method, len(values))
+    }
+    switch v := values[0].(type) {
+    case *big.Int:
+        return v, nil
+    case uint8:
+        return new(big.Int).SetUint64(uint64(v)), nil
+    case uint16:
+        return new(big.Int).SetUint64(uint64(v)), nil
+    case uint32:
+        return new(big.Int).SetUint64(uint64(v)), nil
+    case uint64:
+        return new(big.Int).SetUint64(v), nil
+    default:
+        return nil, fmt.Errorf("%s returned %T, expected unsigned integer", method, values[0])
+    }
+}
@@ -0,0 +1,280 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/metrics"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// apiKey is a provider key carried in the path of the test endpoints.
+const apiKey = "0123456789abcdef0123456789abcdef"
+
+func TestFailedCallsCountRetriesAndFailures(t *testing.T) {
+    node := newFakeNode(t)
+    node.status = http.StatusServiceUnavailable
+    url := node.URL + "/v3/" + apiKey
+    c, err := Dial(context.Background(), url, config.RetryConfig{Attempts: 3, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    defer c.Close()
+
+    if _, err := c.LatestBlockNumber(context.Background()); err == nil {
+        t.Fatal("LatestBlockNumber succeeded against a failing node")
+    }
+    if n := node.callCount("eth_blockNumber"); n != 3 {
+        t.Fatalf("node saw %d attempts, want 3", n)
+    }
+
+    stats := c.Stats()
+    if stats.Calls != 3 || stats.Retries != 2 || stats.Failures != 1 {
+        t.Errorf("stats = %+v, want 3 calls, 2 retries, 1 failure", stats)
+    }
+    if _, ok := metrics.RPCEndpoints()[url]; ok {
+        t.Fatalf("metrics keyed by the unredacted URL")
+    }
+    ep, ok := metrics.RPCEndpoints()[config.RedactURL(url)]
+    if !ok {
+        t.Fatalf("no metrics for %s", config.RedactURL(url))
+    }
+    if ep.Retries["LatestBlockNumber"] != 2 || ep.Failures["LatestBlockNumber"] != 1 {
+        t.Errorf("retries = %v, failures = %v, want 2 and 1 for LatestBlockNumber", ep.Retries, ep.Failures)
+    }
+    if ep.LastErrorMethod != "LatestBlockNumber" || ep.LastErrorAt == nil || !strings.Contains(ep.LastError, "503") {
+        t.Errorf("last error = %q (%s at %v)", ep.LastError, ep.LastErrorMethod, ep.LastErrorAt)
+    }
+}
+
+func TestLastErrorRedactsEndpointURL(t *testing.T) {
+    // A closed endpoint fails with an error quoting the request URL.
+    closed := httptest.NewServer(http.NotFoundHandler())
+    closed.Close()
+    url := closed.URL + "/v3/" + apiKey
+    c, err := Dial(context.Background(), url, config.RetryConfig{Attempts: 1, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    defer c.Close()
+
+    _, callErr := c.LatestBlockNumber(context.Background())
+    if callErr == nil || !strings.Contains(callErr.Error(), apiKey) {
+        t.Fatalf("call error %v does not quote the URL; the test needs one that does", callErr)
+    }
+    ep := metrics.RPCEndpoints()[config.RedactURL(url)]
+    if ep.LastError == "" || strings.Contains(ep.LastError, apiKey) {
+        t.Fatalf("last error = %q, want it without the API key", ep.LastError)
+    }
+    if !strings.Contains(ep.LastError, config.RedactURL(url)) {
+        t.Errorf("last error = %q, want the redacted URL %s", ep.LastError, config.RedactURL(url))
+    }
+    if ep.Failures["LatestBlockNumber"] != 1 || len(ep.Retries) != 0 {
+        t.Errorf("retries = %v, failures = %v, want no retry and 1 failure", ep.Retries, ep.Failures)
+    }
+}
+
+func TestCallTimeoutRetriesSlowAttempt(t *testing.T) {
+    node := newFakeNode(t)
+    var mu sync.Mutex
+    slow := true
+    node.handle("eth_blockNumber", func([]json.RawMessage) (any, error) {
+        mu.Lock()
+        first := slow
+        slow = false
+        mu.Unlock()
+        if first {
+            time.Sleep(500 * time.Millisecond)
+        }
+        return "0x2a", nil
+    })
+    c := dialFake(t, node, 2).WithCallTimeout(50 * time.Millisecond)
+
+    start := time.Now()
+    n, err := c.LatestBlockNumber(context.Background())
+    if err != nil || n != 42 {
+        t.Fatalf("LatestBlockNumber = %d, %v", n, err)
+    }
+    if elapsed := time.Since(start); elapsed >= 500*time.Millisecond {
+        t.Errorf("call took %s, want the slow attempt abandoned after 50ms", elapsed)
+    }
+    if got := node.callCount("eth_blockNumber"); got != 2 {
+        t.Errorf("node saw %d attempts, want 2", got)
+    }
+    if stats := c.Stats(); stats.Retries != 1 || stats.Failures != 0 {
+        t.Errorf("stats = %+v, want 1 retry and no failure", stats)
+    }
+}
+
+func TestCallTimeoutFailsWhenEveryAttemptIsSlow(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("eth_blockNumber", func([]json.RawMessage) (any, error) {
+        time.Sleep(200 * time.Millisecond)
+        return "0x2a", nil
+    })
+    c := dialFake(t, node, 2).WithCallTimeout(20 * time.Millisecond)
+    if _, err := c.LatestBlockNumber(context.Background()); !errors.Is(err, context.DeadlineExceeded) {
+        t.Fatalf("LatestBlockNumber = %v, want a deadline error", err)
+    }
+    if got := node.callCount("eth_blockNumber"); got != 2 {
+        t.Errorf("node saw %d attempts, want 2", got)
+    }
+
+    // Without a timeout the slow answer is awaited.
+    c = dialFake(t, node, 1).WithCallTimeout((&config.Config{RPCTimeoutMS: -1}).RPCTimeout())
+    if n, err := c.LatestBlockNumber(context.Background()); err != nil || n != 42 {
+        t.Fatalf("without a timeout: %d, %v", n, err)
+    }
+}
+
+const erc20ABI = `[
+    {"type":"function","name":"name","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"string"}]},
+    {"type":"function","name":"decimals","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+    {"type":"function","name":"balanceOf","stateMutability":"view","inputs":[{"name":"owner","type":"address"}],"outputs":[{"name":"","type":"uint256"}]}
+]`
+
+// tokenNode answers eth_call like an ERC-20 token whose balanceOf returns
+// the last byte of the owner address times 10^18, after failing failures
+// calls. blocks records the block argument of every call.
+func tokenNode(t *testing.T, failures int) (*fakeNode, *abi.ABI, *[]string) {
+    t.Helper()
+    parsed, err := abi.JSON(strings.NewReader(erc20ABI))
+    if err != nil {
+        t.Fatal(err)
+    }
+    node := newFakeNode(t)
+    var mu sync.Mutex
+    var blocks []string
+    node.handle("eth_call", func(params []json.RawMessage) (any, error) {
+        var msg struct {
+            Input hexutil.Bytes `json:"input"`
+            Data  hexutil.Bytes `json:"data"`
+        }
+        var block string
+        json.Unmarshal(params[0], &msg)
+        json.Unmarshal(params[1], &block)
+        mu.Lock()
+        blocks = append(blocks, block)
+        fail := failures > 0
+        failures--
+        mu.Unlock()
+        if fail {
+            return nil, errors.New("upstream unavailable")
+        }
+        input := msg.Input
+        if len(input) == 0 {
+            input = msg.Data
+        }
+        method, err := parsed.MethodById(input[:4])
+        if err != nil {
+            return nil, err
+        }
+        var out []byte
+        switch method.Name {
+        case "name":
+            out, err = method.Outputs.Pack("Test Token")
+        case "decimals":
+            out, err = method.Outputs.Pack(uint8(6))
+        case "balanceOf":
+            args, uerr := method.Inputs.Unpack(input[4:])
+            if uerr != nil {
+                return nil, uerr
+            }
+            owner := args[0].(common.Address)
+            balance := new(big.Int).Mul(big.NewInt(int64(owner[19])), new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+            out, err = method.Outputs.Pack(balance)
+        }
+        return hexutil.Bytes(out), err
+    })
+    return node, &parsed, &blocks
+}
+
+func TestReadStringAndUint(t *testing.T) {
+    node, parsed, blocks := tokenNode(t, 0)
+    c := dialFake(t, node, 1)
+    token := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+    ctx := context.Background()
+
+    if name, err := c.ReadString(ctx, token, parsed, nil, "name"); err != nil || name != "Test Token" {
+        t.Errorf("name = %q, %v", name, err)
+    }
+    if d, err := c.ReadUint(ctx, token, parsed, big.NewInt(16), "decimals"); err != nil || d.Int64() != 6 {
+        t.Errorf("decimals = %v, %v; want 6 from a uint8", d, err)
+    }
+    owner := common.HexToAddress("0x0000000000000000000000000000000000000007")
+    want, _ := new(big.Int).SetString("7000000000000000000", 10)
+    if b, err := c.ReadUint(ctx, token, parsed, nil, "balanceOf", owner); err != nil || b.Cmp(want) != 0 {
+        t.Errorf("balanceOf = %v, %v; want %s", b, err, want)
+    }
+    if got := *blocks; len(got) != 3 || got[0] != "latest" || got[1] != "0x10" {
+        t.Errorf("call blocks = %v, want latest, 0x10, latest", got)
+    }
+
+    // Wrong result types and arguments fail without a panic.
+    if _, err := c.ReadString(ctx, token, parsed, nil, "decimals"); err == nil || !strings.Contains(err.Error(), "expected string") {
+        t.Errorf("ReadString(decimals) = %v", err)
+    }
+    if _, err := c.ReadUint(ctx, token, parsed, nil, "name"); err == nil || !strings.Contains(err.Error(), "expected unsigned integer") {
+        t.Errorf("ReadUint(name) = %v", err)
+    }
+    if _, err := c.ReadUint(ctx, token, parsed, nil, "balanceOf"); err == nil || !strings.Contains(err.Error(), "failed to pack") {
+        t.Errorf("ReadUint(balanceOf) without its argument = %v", err)
+    }
+}
+
+func TestReadUintRetriesFailedCall(t *testing.T) {
+    node, parsed, _ := tokenNode(t, 2)
+    c := dialFake(t, node, 3)
+    token := common.HexToAddress("0x00000000000000000000000000000000000000a1")
+    if d, err := c.ReadUint(context.Background(), token, parsed, nil, "decimals"); err != nil || d.Int64() != 6 {
+        t.Fatalf("decimals = %v, %v", d, err)
+    }
+    if got := node.callCount("eth_call"); got != 3 {
+        t.Fatalf("node saw %d eth_calls, want 3", got)
+    }
+
+    node, parsed, _ = tokenNode(t, 5)
+    c = dialFake(t, node, 2)
+    if _, err := c.ReadString(context.Background(), token, parsed, nil, "name"); err == nil || !strings.Contains(err.Error(), "upstream unavailable") {
+        t.Fatalf("name after exhausted retries = %v", err)
+    }
+}
+
+func TestUserAgentReachesNode(t *testing.T) {
+    for _, tc := range []struct{ ua, want string }{
+        {ua: "my-indexer/1.0 (ops@example.com)", want: "my-indexer/1.0 (ops@example.com)"},
+        {ua: "", want: config.DefaultRPCUserAgent},
+    } {
+        node := newFakeNode(t)
+        node.handle("eth_blockNumber", func([]json.RawMessage) (any, error) { return "0x10", nil })
+        c, err := Dial(context.Background(), node.URL, config.RetryConfig{Attempts: 1, DelayMS: 1}, config.RPCTransportConfig{}, WithUserAgent(tc.ua))
+        if err != nil {
+            t.Fatalf("Dial: %v", err)
+        }
+        if _, err := c.LatestBlockNumber(context.Background()); err != nil {
+            t.Fatalf("LatestBlockNumber: %v", err)
+        }
+        c.Close()
+        agents := node.userAgents()
+        if len(agents) == 0 {
+            t.Fatalf("user agent %q: no request reached the node", tc.ua)
+        }
+        for _, got := range agents {
+            if got != tc.want {
+                t.Errorf("user agent %q: node saw %q, want %q", tc.ua, got, tc.want)
+            }
+        }
+    }
+}
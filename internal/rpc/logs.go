@@ -0,0 +1,75 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+// GetLogsWithTimestamps is GetLogs for providers that add the (non-standard)
+// blockTimestamp field to eth_getLogs results. Besides the logs it returns
+// the timestamps found, keyed by block number; blocks whose logs carry none
+// are absent, so callers fall back to fetching the header.
+func (c *Client) GetLogsWithTimestamps(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, map[uint64]uint64, error) {
+    var raw []json.RawMessage
+    err := c.withRetry(ctx, "GetLogs", func(ctx context.Context) error {
+        raw = nil
+        return c.Client.Client().CallContext(ctx, &raw, "eth_getLogs", filterArg(query))
+    })
+    if err != nil {
+        return nil, nil, err
+    }
+
+    logs := make([]types.Log, len(raw))
+    timestamps := make(map[uint64]uint64)
+    for i, msg := range raw {
+        if err := json.Unmarshal(msg, &logs[i]); err != nil {
+            return nil, nil, fmt.Errorf("failed to decode log: %w", err)
+        }
+        var extra struct {
+            BlockTimestamp *hexutil.Uint64 `json:"blockTimestamp"`
+        }
+        // A malformed timestamp is treated as missing rather than failing the logs.
+        if json.Unmarshal(msg, &extra) == nil && extra.BlockTimestamp != nil {
+            timestamps[logs[i].BlockNumber] = uint64(*extra.BlockTimestamp)
+        }
+    }
+    return logs, timestamps, nil
+}
+
+// filterArg encodes query as eth_getLogs parameter, like ethclient does.
+func filterArg(q ethereum.FilterQuery) map[string]interface{} {
+    arg := map[string]interface{}{
+        "address": q.Addresses,
+        "topics":  q.Topics,
+    }
+    if q.BlockHash != nil {
+        arg["blockHash"] = *q.BlockHash
+        return arg
+    }
+    if q.FromBlock == nil {
+        arg["fromBlock"] = "0x0"
+    } else {
+        arg["fromBlock"] = blockNumArg(q.FromBlock)
+    }
+    arg["toBlock"] = blockNumArg(q.ToBlock)
+    return arg
+}
+
+// blockNumArg encodes a block number; nil means latest and negative numbers
+// are the special tags (pending, finalized, ...).
+func blockNumArg(n *big.Int) string {
+    if n == nil {
+        return "latest"
+    }
+    if n.Sign() >= 0 {
+        return hexutil.EncodeBig(n)
+    }
+    return gethrpc.BlockNumber(n.Int64()).String()
+}
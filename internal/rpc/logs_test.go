@@ -0,0 +1,115 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// logWith returns the JSON of a log of block with extra fields added, as a
+// provider extending eth_getLogs results would send it.
+func logWith(t *testing.T, block uint64, extra map[string]any) map[string]any {
+    t.Helper()
+    raw, err := json.Marshal(&types.Log{
+        Address:     common.HexToAddress("0xa1"),
+        Topics:      []common.Hash{common.HexToHash("0x01")},
+        Data:        []byte{},
+        BlockNumber: block,
+        TxHash:      common.BigToHash(new(big.Int).SetUint64(block)),
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    var out map[string]any
+    json.Unmarshal(raw, &out)
+    for k, v := range extra {
+        out[k] = v
+    }
+    return out
+}
+
+func TestGetLogsWithTimestamps(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("eth_getLogs", func([]json.RawMessage) (any, error) {
+        return []map[string]any{
+            logWith(t, 10, map[string]any{"blockTimestamp": "0x64"}),
+            logWith(t, 10, map[string]any{"blockTimestamp": "0x64"}),
+            logWith(t, 11, nil),
+            logWith(t, 12, map[string]any{"blockTimestamp": "not a number"}),
+            logWith(t, 13, map[string]any{"blockTimestamp": "0xc8"}),
+        }, nil
+    })
+    c := dialFake(t, node, 1)
+
+    logs, timestamps, err := c.GetLogsWithTimestamps(context.Background(), ethereum.FilterQuery{FromBlock: big.NewInt(10), ToBlock: big.NewInt(13)})
+    if err != nil {
+        t.Fatalf("GetLogsWithTimestamps: %v", err)
+    }
+    if len(logs) != 5 || logs[4].BlockNumber != 13 {
+        t.Fatalf("got %d logs: %+v", len(logs), logs)
+    }
+    // Blocks 11 and 12 fall back to the header: no timestamp, or an invalid one.
+    want := map[uint64]uint64{10: 100, 13: 200}
+    if len(timestamps) != len(want) {
+        t.Fatalf("timestamps = %v, want %v", timestamps, want)
+    }
+    for block, ts := range want {
+        if timestamps[block] != ts {
+            t.Errorf("timestamp of block %d = %d, want %d", block, timestamps[block], ts)
+        }
+    }
+}
+
+func TestGetLogsWithTimestampsStandardProvider(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("eth_getLogs", func([]json.RawMessage) (any, error) {
+        return []map[string]any{logWith(t, 10, nil)}, nil
+    })
+    logs, timestamps, err := dialFake(t, node, 1).GetLogsWithTimestamps(context.Background(), ethereum.FilterQuery{})
+    if err != nil || len(logs) != 1 || len(timestamps) != 0 {
+        t.Fatalf("GetLogsWithTimestamps = %d logs, %v, %v; want 1 log and no timestamps", len(logs), timestamps, err)
+    }
+}
+
+func TestGetLogsByBlockHash(t *testing.T) {
+    hash := common.HexToHash("0xb10c")
+    token := common.HexToAddress("0xa1")
+    topic := common.HexToHash("0x01")
+    var filter map[string]json.RawMessage
+    node := newFakeNode(t)
+    node.handle("eth_getLogs", func(params []json.RawMessage) (any, error) {
+        if err := json.Unmarshal(params[0], &filter); err != nil {
+            return nil, err
+        }
+        return []map[string]any{logWith(t, 10, nil)}, nil
+    })
+
+    logs, err := dialFake(t, node, 1).GetLogsByBlockHash(context.Background(), hash, []common.Address{token}, [][]common.Hash{{topic}})
+    if err != nil || len(logs) != 1 {
+        t.Fatalf("GetLogsByBlockHash = %d logs, %v", len(logs), err)
+    }
+    var got struct {
+        BlockHash common.Hash      `json:"blockHash"`
+        Address   []common.Address `json:"address"`
+        Topics    [][]common.Hash  `json:"topics"`
+    }
+    raw, _ := json.Marshal(filter)
+    json.Unmarshal(raw, &got)
+    if got.BlockHash != hash {
+        t.Errorf("blockHash = %s, want %s", got.BlockHash, hash)
+    }
+    if _, ok := filter["fromBlock"]; ok {
+        t.Errorf("filter %s has a fromBlock", raw)
+    }
+    if _, ok := filter["toBlock"]; ok {
+        t.Errorf("filter %s has a toBlock", raw)
+    }
+    if len(got.Address) != 1 || got.Address[0] != token || len(got.Topics) != 1 || len(got.Topics[0]) != 1 || got.Topics[0][0] != topic {
+        t.Errorf("filter = %s, want the address and topic passed through", raw)
+    }
+}
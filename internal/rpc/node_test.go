@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"etl-web3/internal/config"
+)
+
+// rpcError is the error a fakeNode handler returns as a JSON-RPC error.
+type rpcError struct {
+    Code    int    `json:"code"`
+    Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+// fakeNode is a JSON-RPC endpoint answering each method with its handler;
+// unknown methods fail with "method not found". Setting status makes every
+// request fail with that HTTP status instead.
+type fakeNode struct {
+    *httptest.Server
+
+    mu       sync.Mutex
+    handlers map[string]func(params []json.RawMessage) (any, error)
+    calls    map[string]int
+    status   int
+    agents   []string // User-Agent of every request
+}
+
+func newFakeNode(t *testing.T) *fakeNode {
+    t.Helper()
+    n := &fakeNode{
+        handlers: map[string]func([]json.RawMessage) (any, error){},
+        calls:    map[string]int{},
+    }
+    n.Server = httptest.NewServer(http.HandlerFunc(n.serve))
+    t.Cleanup(n.Close)
+    return n
+}
+
+// handle sets the handler of method.
+func (n *fakeNode) handle(method string, h func(params []json.RawMessage) (any, error)) {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    n.handlers[method] = h
+}
+
+// callCount returns how many requests for method the node received.
+func (n *fakeNode) callCount(method string) int {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return n.calls[method]
+}
+
+// userAgents returns the User-Agent headers the node received.
+func (n *fakeNode) userAgents() []string {
+    n.mu.Lock()
+    defer n.mu.Unlock()
+    return append([]string(nil), n.agents...)
+}
+
+func (n *fakeNode) serve(w http.ResponseWriter, r *http.Request) {
+    var req struct {
+        ID     json.RawMessage   `json:"id"`
+        Method string            `json:"method"`
+        Params []json.RawMessage `json:"params"`
+    }
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
+        return
+    }
+
+    n.mu.Lock()
+    n.calls[req.Method]++
+    n.agents = append(n.agents, r.UserAgent())
+    h, status := n.handlers[req.Method], n.status
+    n.mu.Unlock()
+    if status != 0 {
+        http.Error(w, http.StatusText(status), status)
+        return
+    }
+
+    resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+    if h == nil {
+        resp["error"] = &rpcError{Code: codeMethodNotFound, Message: "the method " + req.Method + " does not exist/is not available"}
+    } else if result, err := h(req.Params); err != nil {
+        rerr, ok := err.(*rpcError)
+        if !ok {
+            rerr = &rpcError{Code: -32000, Message: err.Error()}
+        }
+        resp["error"] = rerr
+    } else {
+        resp["result"] = result
+    }
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(resp)
+}
+
+// dialFake dials node with the given number of attempts and no delay
+// between them.
+func dialFake(t *testing.T, node *fakeNode, attempts int) *Client {
+    t.Helper()
+    c, err := Dial(context.Background(), node.URL, config.RetryConfig{Attempts: attempts, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    t.Cleanup(c.Close)
+    return c
+}
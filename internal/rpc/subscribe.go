@@ -0,0 +1,80 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+	"github.com/gorilla/websocket"
+)
+
+// isWebsocketURL reports whether url is a ws:// or wss:// endpoint.
+func isWebsocketURL(url string) bool {
+    return strings.HasPrefix(url, "ws://") || strings.HasPrefix(url, "wss://")
+}
+
+// websocketOptions returns the client options of a WebSocket endpoint:
+// with ws_compression the connection negotiates permessage-deflate, which
+// shrinks the JSON of large log notifications considerably, and wss://
+// endpoints get the TLS settings of the transport.
+func websocketOptions(transportCfg config.RPCTransportConfig) ([]gethrpc.ClientOption, error) {
+    tc, err := tlsConfig(transportCfg)
+    if err != nil {
+        return nil, err
+    }
+    if !transportCfg.WSCompression && tc == nil {
+        return nil, nil
+    }
+    // Same buffers as the go-ethereum default dialer.
+    return []gethrpc.ClientOption{gethrpc.WithWebsocketDialer(websocket.Dialer{
+        ReadBufferSize:    1024,
+        WriteBufferSize:   1024,
+        Proxy:             http.ProxyFromEnvironment,
+        EnableCompression: transportCfg.WSCompression,
+        TLSClientConfig:   tc,
+    })}, nil
+}
+
+// DialSubscriptions connects a WebSocket endpoint used for subscriptions
+// only (follow mode), so bulk calls such as eth_getLogs keep going to the
+// usually cheaper HTTP endpoint the client was dialled with. Without it
+// subscriptions use that endpoint, which must then be a WebSocket one.
+func (c *Client) DialSubscriptions(ctx context.Context, url string, transportCfg config.RPCTransportConfig, opts ...gethrpc.ClientOption) error {
+    if !isWebsocketURL(url) {
+        return fmt.Errorf("subscription endpoint %s is not a ws:// or wss:// URL", config.RedactURL(url))
+    }
+    wsOpts, err := websocketOptions(transportCfg)
+    if err != nil {
+        return err
+    }
+    rc, err := gethrpc.DialOptions(ctx, url, append(wsOpts, opts...)...)
+    if err != nil {
+        return fmt.Errorf("failed to connect to %s: %w", config.RedactURL(url), err)
+    }
+    c.subs = ethclient.NewClient(rc)
+    return nil
+}
+
+// SubscribeFilterLogs subscribes to the logs matching q through the
+// subscription endpoint when one was dialled, the main endpoint otherwise.
+func (c *Client) SubscribeFilterLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
+    if c.subs != nil {
+        return c.subs.SubscribeFilterLogs(ctx, q, ch)
+    }
+    return c.Client.SubscribeFilterLogs(ctx, q, ch)
+}
+
+// Close closes the connections to the main and subscription endpoints.
+func (c *Client) Close() {
+    if c.subs != nil {
+        c.subs.Close()
+    }
+    c.Client.Close()
+}
@@ -0,0 +1,141 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	gethrpc "github.com/ethereum/go-ethereum/rpc"
+)
+
+// wsNode is a WebSocket endpoint counting its eth_getLogs calls and log
+// subscriptions, and recording the extensions its clients asked for.
+type wsNode struct {
+    *httptest.Server
+
+    getLogs    atomic.Int32
+    subscribed atomic.Int32
+
+    mu         sync.Mutex
+    extensions string
+}
+
+func newWSNode(t *testing.T) *wsNode {
+    t.Helper()
+    n := &wsNode{}
+    srv := gethrpc.NewServer()
+    if err := srv.RegisterName("eth", &wsEthService{node: n}); err != nil {
+        t.Fatal(err)
+    }
+    ws := srv.WebsocketHandler([]string{"*"})
+    n.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        n.mu.Lock()
+        n.extensions = r.Header.Get("Sec-WebSocket-Extensions")
+        n.mu.Unlock()
+        ws.ServeHTTP(w, r)
+    }))
+    t.Cleanup(func() {
+        srv.Stop()
+        n.Close()
+    })
+    return n
+}
+
+// url returns the ws:// URL of the node.
+func (n *wsNode) url() string {
+    return "ws" + strings.TrimPrefix(n.URL, "http")
+}
+
+// wsEthService serves eth_getLogs and the "logs" subscription.
+type wsEthService struct {
+    node *wsNode
+}
+
+func (s *wsEthService) GetLogs(context.Context, json.RawMessage) ([]types.Log, error) {
+    s.node.getLogs.Add(1)
+    return []types.Log{}, nil
+}
+
+func (s *wsEthService) Logs(ctx context.Context, _ json.RawMessage) (*gethrpc.Subscription, error) {
+    notifier, ok := gethrpc.NotifierFromContext(ctx)
+    if !ok {
+        return nil, gethrpc.ErrNotificationsUnsupported
+    }
+    s.node.subscribed.Add(1)
+    return notifier.CreateSubscription(), nil
+}
+
+func TestHistoricalQueriesUseHTTPAndSubscriptionsWS(t *testing.T) {
+    httpNode := newFakeNode(t)
+    httpNode.handle("eth_getLogs", func([]json.RawMessage) (any, error) { return []types.Log{}, nil })
+    ws := newWSNode(t)
+
+    c := dialFake(t, httpNode, 1)
+    if err := c.DialSubscriptions(context.Background(), ws.url(), config.RPCTransportConfig{}); err != nil {
+        t.Fatalf("DialSubscriptions: %v", err)
+    }
+    if _, err := c.GetLogs(context.Background(), ethereum.FilterQuery{}); err != nil {
+        t.Fatalf("GetLogs: %v", err)
+    }
+    sub, err := c.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, make(chan types.Log))
+    if err != nil {
+        t.Fatalf("SubscribeFilterLogs: %v", err)
+    }
+    sub.Unsubscribe()
+
+    if httpNode.callCount("eth_getLogs") != 1 || ws.getLogs.Load() != 0 {
+        t.Errorf("eth_getLogs went to HTTP %d time(s) and WS %d time(s), want HTTP only", httpNode.callCount("eth_getLogs"), ws.getLogs.Load())
+    }
+    if ws.subscribed.Load() != 1 || httpNode.callCount("eth_subscribe") != 0 {
+        t.Errorf("subscriptions: %d over WS, %d over HTTP; want WS only", ws.subscribed.Load(), httpNode.callCount("eth_subscribe"))
+    }
+}
+
+func TestSubscriptionsWithoutWSEndpoint(t *testing.T) {
+    ws := newWSNode(t)
+    c, err := Dial(context.Background(), ws.url(), config.RetryConfig{Attempts: 1, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    defer c.Close()
+    sub, err := c.SubscribeFilterLogs(context.Background(), ethereum.FilterQuery{}, make(chan types.Log))
+    if err != nil {
+        t.Fatalf("SubscribeFilterLogs: %v", err)
+    }
+    sub.Unsubscribe()
+    if ws.subscribed.Load() != 1 {
+        t.Fatalf("%d subscriptions on the main endpoint, want 1", ws.subscribed.Load())
+    }
+}
+
+func TestDialSubscriptionsRejectsHTTP(t *testing.T) {
+    c := dialFake(t, newFakeNode(t), 1)
+    if err := c.DialSubscriptions(context.Background(), "http://localhost:8545", config.RPCTransportConfig{}); err == nil || !strings.Contains(err.Error(), "not a ws://") {
+        t.Fatalf("DialSubscriptions(http) = %v", err)
+    }
+}
+
+func TestWSCompressionIsNegotiated(t *testing.T) {
+    for _, compress := range []bool{false, true} {
+        ws := newWSNode(t)
+        c := dialFake(t, newFakeNode(t), 1)
+        if err := c.DialSubscriptions(context.Background(), ws.url(), config.RPCTransportConfig{WSCompression: compress}); err != nil {
+            t.Fatalf("DialSubscriptions: %v", err)
+        }
+        ws.mu.Lock()
+        ext := ws.extensions
+        ws.mu.Unlock()
+        if got := strings.Contains(ext, "permessage-deflate"); got != compress {
+            t.Errorf("ws_compression %v: Sec-WebSocket-Extensions = %q", compress, ext)
+        }
+    }
+}
@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+)
+
+// maxRetryAfter caps the wait honoured from a Retry-After header so a bogus
+// value cannot stall the indexer indefinitely.
+const maxRetryAfter = 5 * time.Minute
+
+// throttleTransport records the Retry-After of HTTP 429 responses. The
+// go-ethereum client drops response headers from its errors, so withRetry
+// asks the transport how long the provider wants it to back off.
+type throttleTransport struct {
+    base http.RoundTripper
+
+    mu    sync.Mutex
+    until time.Time
+}
+
+func newThrottleTransport(base http.RoundTripper) *throttleTransport {
+    return &throttleTransport{base: base}
+}
+
+// newTransport returns a copy of http.DefaultTransport with the pool and
+// TLS settings of cfg applied; zero values keep the defaults.
+func newTransport(cfg config.RPCTransportConfig) (*http.Transport, error) {
+    t := http.DefaultTransport.(*http.Transport).Clone()
+    tc, err := tlsConfig(cfg)
+    if err != nil {
+        return nil, err
+    }
+    if tc != nil {
+        t.TLSClientConfig = tc
+    }
+    if cfg.MaxIdleConns > 0 {
+        t.MaxIdleConns = cfg.MaxIdleConns
+    }
+    if cfg.MaxIdleConnsPerHost > 0 {
+        t.MaxIdleConnsPerHost = cfg.MaxIdleConnsPerHost
+    }
+    if cfg.IdleConnTimeoutMS > 0 {
+        t.IdleConnTimeout = time.Duration(cfg.IdleConnTimeoutMS) * time.Millisecond
+    }
+    return t, nil
+}
+
+func (t *throttleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    resp, err := t.base.RoundTrip(req)
+    if err != nil || resp.StatusCode != http.StatusTooManyRequests {
+        return resp, err
+    }
+    now := time.Now()
+    if d, ok := parseRetryAfter(resp.Header.Get("Retry-After"), now); ok {
+        t.mu.Lock()
+        if until := now.Add(d); until.After(t.until) {
+            t.until = until
+        }
+        t.mu.Unlock()
+    }
+    return resp, nil
+}
+
+// wait returns how long remains before the provider accepts requests again,
+// zero when it has not asked to back off.
+func (t *throttleTransport) wait() time.Duration {
+    if t == nil {
+        return 0
+    }
+    t.mu.Lock()
+    defer t.mu.Unlock()
+    return time.Until(t.until)
+}
+
+// parseRetryAfter parses a Retry-After value, either delay seconds or an
+// HTTP date, into a duration from now capped at maxRetryAfter.
+func parseRetryAfter(v string, now time.Time) (time.Duration, bool) {
+    v = strings.TrimSpace(v)
+    if v == "" {
+        return 0, false
+    }
+    var d time.Duration
+    if secs, err := strconv.Atoi(v); err == nil {
+        if secs < 0 {
+            return 0, false
+        }
+        d = time.Duration(secs) * time.Second
+    } else if at, err := http.ParseTime(v); err == nil {
+        d = at.Sub(now)
+    } else {
+        return 0, false
+    }
+    if d < 0 {
+        d = 0
+    }
+    if d > maxRetryAfter {
+        d = maxRetryAfter
+    }
+    return d, true
+}
@@ -0,0 +1,124 @@
+package rpc
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+)
+
+func TestNewTransportAppliesPoolSettings(t *testing.T) {
+    def := http.DefaultTransport.(*http.Transport)
+    tr, err := newTransport(config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tr == def {
+        t.Fatal("newTransport returned http.DefaultTransport itself")
+    }
+    if tr.MaxIdleConns != def.MaxIdleConns || tr.MaxIdleConnsPerHost != def.MaxIdleConnsPerHost || tr.IdleConnTimeout != def.IdleConnTimeout {
+        t.Errorf("zero settings changed the defaults: %d, %d, %s", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+    }
+
+    tr, err = newTransport(config.RPCTransportConfig{MaxIdleConns: 500, MaxIdleConnsPerHost: 64, IdleConnTimeoutMS: 30_000})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tr.MaxIdleConns != 500 || tr.MaxIdleConnsPerHost != 64 || tr.IdleConnTimeout != 30*time.Second {
+        t.Errorf("transport = %d, %d, %s; want 500, 64, 30s", tr.MaxIdleConns, tr.MaxIdleConnsPerHost, tr.IdleConnTimeout)
+    }
+    if def.MaxIdleConnsPerHost == 64 {
+        t.Error("newTransport modified http.DefaultTransport")
+    }
+}
+
+func TestDialUsesConfiguredTransport(t *testing.T) {
+    node := newFakeNode(t)
+    c, err := Dial(context.Background(), node.URL, config.RetryConfig{Attempts: 1, DelayMS: 1}, config.RPCTransportConfig{MaxIdleConnsPerHost: 32})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    defer c.Close()
+    tr, ok := c.throttle.base.(*http.Transport)
+    if !ok || tr.MaxIdleConnsPerHost != 32 {
+        t.Fatalf("client transport = %#v, want max_idle_conns_per_host 32", c.throttle.base)
+    }
+}
+
+func TestParseRetryAfter(t *testing.T) {
+    now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+    for _, tc := range []struct {
+        value string
+        want  time.Duration
+        ok    bool
+    }{
+        {value: "", ok: false},
+        {value: "soon", ok: false},
+        {value: "-5", ok: false},
+        {value: "0", want: 0, ok: true},
+        {value: " 12 ", want: 12 * time.Second, ok: true},
+        {value: "300", want: 5 * time.Minute, ok: true},
+        {value: "301", want: maxRetryAfter, ok: true},
+        {value: "86400", want: maxRetryAfter, ok: true},
+        {value: now.Add(90 * time.Second).Format(http.TimeFormat), want: 90 * time.Second, ok: true},
+        {value: now.Add(-time.Minute).Format(http.TimeFormat), want: 0, ok: true},
+        {value: now.Add(time.Hour).Format(http.TimeFormat), want: maxRetryAfter, ok: true},
+        {value: now.Add(time.Minute).Format(time.RFC850), want: time.Minute, ok: true},
+    } {
+        got, ok := parseRetryAfter(tc.value, now)
+        if ok != tc.ok || got != tc.want {
+            t.Errorf("parseRetryAfter(%q) = %s, %v; want %s, %v", tc.value, got, ok, tc.want, tc.ok)
+        }
+    }
+}
+
+func TestRetryHonoursRetryAfter(t *testing.T) {
+    var calls atomic.Int32
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if calls.Add(1) == 1 {
+            w.Header().Set("Retry-After", "1")
+            http.Error(w, "slow down", http.StatusTooManyRequests)
+            return
+        }
+        w.Header().Set("Content-Type", "application/json")
+        w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":"0x2a"}`))
+    }))
+    defer srv.Close()
+    c, err := Dial(context.Background(), srv.URL, config.RetryConfig{Attempts: 2, DelayMS: 1}, config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatalf("Dial: %v", err)
+    }
+    defer c.Close()
+
+    start := time.Now()
+    n, err := c.LatestBlockNumber(context.Background())
+    if err != nil || n != 42 {
+        t.Fatalf("LatestBlockNumber = %d, %v", n, err)
+    }
+    // The configured 1ms delay gives way to the provider's second.
+    if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+        t.Fatalf("retried after %s, want about the 1s Retry-After", elapsed)
+    }
+}
+
+func TestThrottleIgnoresOtherStatuses(t *testing.T) {
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Set("Retry-After", "120")
+        http.Error(w, "unavailable", http.StatusServiceUnavailable)
+    }))
+    defer srv.Close()
+    tr := newThrottleTransport(http.DefaultTransport)
+    req, _ := http.NewRequest(http.MethodPost, srv.URL, nil)
+    resp, err := tr.RoundTrip(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    resp.Body.Close()
+    if wait := tr.wait(); wait > 0 {
+        t.Fatalf("wait = %s after a 503, want none", wait)
+    }
+}
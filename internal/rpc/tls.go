@@ -0,0 +1,41 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"etl-web3/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// tlsConfig returns the TLS settings of https:// and wss:// endpoints, or
+// nil when cfg keeps the defaults. A ca_cert_file extends the system roots
+// rather than replacing them, so public endpoints keep working.
+func tlsConfig(cfg config.RPCTransportConfig) (*tls.Config, error) {
+    if cfg.CACertFile == "" && !cfg.InsecureSkipVerify {
+        return nil, nil
+    }
+    tc := &tls.Config{MinVersion: tls.VersionTLS12}
+    if cfg.CACertFile != "" {
+        pem, err := os.ReadFile(cfg.CACertFile)
+        if err != nil {
+            return nil, fmt.Errorf("rpc_transport.ca_cert_file: %w", err)
+        }
+        pool, err := x509.SystemCertPool()
+        if err != nil {
+            pool = x509.NewCertPool()
+        }
+        if !pool.AppendCertsFromPEM(pem) {
+            return nil, fmt.Errorf("rpc_transport.ca_cert_file: no PEM certificate found in %s", cfg.CACertFile)
+        }
+        tc.RootCAs = pool
+    }
+    if cfg.InsecureSkipVerify {
+        logrus.Warn("rpc_transport.insecure_skip_verify is set: RPC server certificates are not verified")
+        tc.InsecureSkipVerify = true
+    }
+    return tc, nil
+}
@@ -0,0 +1,94 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// newTLSNode returns a fakeNode served over HTTPS with a self-signed
+// certificate, answering eth_blockNumber, and the path of a PEM file
+// holding that certificate.
+func newTLSNode(t *testing.T) (*fakeNode, string) {
+    t.Helper()
+    n := &fakeNode{
+        handlers: map[string]func([]json.RawMessage) (any, error){},
+        calls:    map[string]int{},
+    }
+    n.Server = httptest.NewTLSServer(http.HandlerFunc(n.serve))
+    t.Cleanup(n.Close)
+    n.handle("eth_blockNumber", func([]json.RawMessage) (any, error) { return hexutil.Uint64(42), nil })
+
+    path := filepath.Join(t.TempDir(), "node-ca.pem")
+    cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: n.Certificate().Raw})
+    if err := os.WriteFile(path, cert, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    return n, path
+}
+
+// headOver dials node with transport and returns its head.
+func headOver(t *testing.T, node *fakeNode, transport config.RPCTransportConfig) (uint64, error) {
+    t.Helper()
+    c, err := Dial(context.Background(), node.URL, config.RetryConfig{Attempts: 1, DelayMS: 1}, transport)
+    if err != nil {
+        return 0, err
+    }
+    defer c.Close()
+    return c.LatestBlockNumber(context.Background())
+}
+
+func TestCACertFileTrustsPrivateCA(t *testing.T) {
+    node, caFile := newTLSNode(t)
+
+    if _, err := headOver(t, node, config.RPCTransportConfig{}); err == nil || !strings.Contains(err.Error(), "certificate") {
+        t.Fatalf("without ca_cert_file: %v, want a certificate error", err)
+    }
+    head, err := headOver(t, node, config.RPCTransportConfig{CACertFile: caFile})
+    if err != nil || head != 42 {
+        t.Fatalf("with ca_cert_file: %d, %v", head, err)
+    }
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+    node, _ := newTLSNode(t)
+    if head, err := headOver(t, node, config.RPCTransportConfig{InsecureSkipVerify: true}); err != nil || head != 42 {
+        t.Fatalf("with insecure_skip_verify: %d, %v", head, err)
+    }
+}
+
+func TestNewTransportAppliesTLSConfig(t *testing.T) {
+    _, caFile := newTLSNode(t)
+
+    tr, err := newTransport(config.RPCTransportConfig{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tr.TLSClientConfig != nil && (tr.TLSClientConfig.RootCAs != nil || tr.TLSClientConfig.InsecureSkipVerify) {
+        t.Errorf("default transport changed the TLS settings: %+v", tr.TLSClientConfig)
+    }
+
+    tr, err = newTransport(config.RPCTransportConfig{CACertFile: caFile})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if tr.TLSClientConfig == nil || tr.TLSClientConfig.RootCAs == nil || tr.TLSClientConfig.InsecureSkipVerify {
+        t.Errorf("ca_cert_file not applied: %+v", tr.TLSClientConfig)
+    }
+
+    empty := filepath.Join(t.TempDir(), "empty.pem")
+    os.WriteFile(empty, []byte("not a certificate"), 0o644)
+    if _, err := newTransport(config.RPCTransportConfig{CACertFile: empty}); err == nil || !strings.Contains(err.Error(), "no PEM certificate") {
+        t.Errorf("ca_cert_file without certificates: %v", err)
+    }
+}
@@ -0,0 +1,206 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrTracesUnsupported is returned by TraceBlock when the node implements
+// neither trace_block nor debug_traceBlockByNumber.
+var ErrTracesUnsupported = errors.New("node supports neither trace_block nor debug_traceBlockByNumber")
+
+// Trace is one call frame of a transaction: the top-level call, with an
+// empty TraceAddress, or an internal call, create or selfdestruct.
+type Trace struct {
+    TxHash  common.Hash
+    TxIndex int
+    // TraceAddress is the path of the frame in the call tree, e.g. [0 2]
+    // for the third call made by the first call of the transaction.
+    TraceAddress []int
+    Type         string // call, delegatecall, staticcall, callcode, create, create2, selfdestruct
+    From         common.Address
+    // To is the created contract for creates and the beneficiary for
+    // selfdestructs; nil for failed creates and frames without a target.
+    To           *common.Address
+    Value        *big.Int
+    Input        []byte
+    Error        string // non-empty when the frame reverted
+}
+
+// TraceBlock returns the call frames of every transaction of a block. It
+// uses trace_block (OpenEthereum/Erigon/Nethermind) and falls back to
+// debug_traceBlockByNumber with the callTracer (Geth), remembering once
+// trace_block turned out to be unsupported. Nodes with neither method fail
+// with ErrTracesUnsupported.
+func (c *Client) TraceBlock(ctx context.Context, number uint64) ([]Trace, error) {
+    if !c.noTraceBlock.Load() {
+        traces, err := c.traceBlock(ctx, number)
+        if err == nil || !IsMethodNotFound(err) {
+            return traces, err
+        }
+        if c.noTraceBlock.CompareAndSwap(false, true) {
+            logrus.Infof("trace_block not supported by the node, using debug_traceBlockByNumber")
+        }
+    }
+    traces, err := c.debugTraceBlock(ctx, number)
+    if IsMethodNotFound(err) {
+        return nil, fmt.Errorf("%w: %v", ErrTracesUnsupported, err)
+    }
+    return traces, err
+}
+
+// parityTrace is an element of the trace_block result.
+type parityTrace struct {
+    Type   string `json:"type"`
+    Action struct {
+        CallType      string          `json:"callType"`
+        From          common.Address  `json:"from"`
+        To            *common.Address `json:"to"`
+        Value         *hexutil.Big    `json:"value"`
+        Input         hexutil.Bytes   `json:"input"`
+        Init          hexutil.Bytes   `json:"init"`
+        Address       common.Address  `json:"address"`       // selfdestruct
+        RefundAddress common.Address  `json:"refundAddress"` // selfdestruct
+        Balance       *hexutil.Big    `json:"balance"`       // selfdestruct
+    } `json:"action"`
+    Result *struct {
+        Address *common.Address `json:"address"` // create
+    } `json:"result"`
+    Error               string       `json:"error"`
+    TraceAddress        []int        `json:"traceAddress"`
+    TransactionHash     *common.Hash `json:"transactionHash"`
+    TransactionPosition int          `json:"transactionPosition"`
+}
+
+func (c *Client) traceBlock(ctx context.Context, number uint64) ([]Trace, error) {
+    var raw []parityTrace
+    err := c.withRetry(ctx, "TraceBlock", func(ctx context.Context) error {
+        raw = nil
+        return c.Client.Client().CallContext(ctx, &raw, "trace_block", hexutil.Uint64(number))
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    traces := make([]Trace, 0, len(raw))
+    for _, r := range raw {
+        // Block and uncle rewards belong to no transaction.
+        if r.TransactionHash == nil {
+            continue
+        }
+        t := Trace{
+            TxHash:       *r.TransactionHash,
+            TxIndex:      r.TransactionPosition,
+            TraceAddress: r.TraceAddress,
+            Type:         r.Type,
+            From:         r.Action.From,
+            Value:        (*big.Int)(r.Action.Value),
+            Input:        r.Action.Input,
+            Error:        r.Error,
+        }
+        switch r.Type {
+        case "call":
+            t.Type = r.Action.CallType
+            t.To = r.Action.To
+        case "create":
+            t.Input = r.Action.Init
+            if r.Result != nil {
+                t.To = r.Result.Address
+            }
+        case "suicide":
+            t.Type = "selfdestruct"
+            refund := r.Action.RefundAddress
+            t.From, t.To = r.Action.Address, &refund
+            t.Value = (*big.Int)(r.Action.Balance)
+        }
+        traces = append(traces, t)
+    }
+    return traces, nil
+}
+
+// callFrame is a frame of the callTracer output.
+type callFrame struct {
+    Type  string          `json:"type"`
+    From  common.Address  `json:"from"`
+    To    *common.Address `json:"to"`
+    Value *hexutil.Big    `json:"value"`
+    Input hexutil.Bytes   `json:"input"`
+    Error string          `json:"error"`
+    Calls []callFrame     `json:"calls"`
+}
+
+func (c *Client) debugTraceBlock(ctx context.Context, number uint64) ([]Trace, error) {
+    var raw []struct {
+        TxHash *common.Hash `json:"txHash"` // absent before Geth 1.13
+        Result callFrame    `json:"result"`
+    }
+    err := c.withRetry(ctx, "DebugTraceBlockByNumber", func(ctx context.Context) error {
+        raw = nil
+        return c.Client.Client().CallContext(ctx, &raw, "debug_traceBlockByNumber", hexutil.Uint64(number), map[string]string{"tracer": "callTracer"})
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    var hashes []common.Hash
+    var traces []Trace
+    for i, r := range raw {
+        var hash common.Hash
+        if r.TxHash != nil {
+            hash = *r.TxHash
+        } else {
+            // Older nodes only return the frames, in transaction order.
+            if hashes == nil {
+                if hashes, err = c.blockTxHashes(ctx, number); err != nil {
+                    return nil, err
+                }
+            }
+            if i < len(hashes) {
+                hash = hashes[i]
+            }
+        }
+        traces = flattenFrame(traces, r.Result, hash, i, nil)
+    }
+    return traces, nil
+}
+
+// flattenFrame appends f and its sub-calls, depth first, as traces.
+func flattenFrame(out []Trace, f callFrame, hash common.Hash, txIndex int, addr []int) []Trace {
+    t := Trace{
+        TxHash:       hash,
+        TxIndex:      txIndex,
+        TraceAddress: addr,
+        Type:         strings.ToLower(f.Type), // CALL → call, as with trace_block
+        From:         f.From,
+        Value:        (*big.Int)(f.Value),
+        Input:        f.Input,
+        To:           f.To,
+        Error:        f.Error,
+    }
+    out = append(out, t)
+    for i, sub := range f.Calls {
+        subAddr := append(append(make([]int, 0, len(addr)+1), addr...), i)
+        out = flattenFrame(out, sub, hash, txIndex, subAddr)
+    }
+    return out
+}
+
+// blockTxHashes returns the transaction hashes of a block, in order.
+func (c *Client) blockTxHashes(ctx context.Context, number uint64) ([]common.Hash, error) {
+    block, err := c.GetBlockByNumber(ctx, new(big.Int).SetUint64(number))
+    if err != nil {
+        return nil, err
+    }
+    hashes := make([]common.Hash, len(block.Transactions()))
+    for i, tx := range block.Transactions() {
+        hashes[i] = tx.Hash()
+    }
+    return hashes, nil
+}
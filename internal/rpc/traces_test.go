@@ -0,0 +1,99 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// debugTraceBlockResult is a debug_traceBlockByNumber callTracer response:
+// a call making a reverted call and a create that failed.
+const debugTraceBlockResult = `[{
+    "txHash": "0x00000000000000000000000000000000000000000000000000000000000000aa",
+    "result": {
+        "type": "CALL",
+        "from": "0x1111111111111111111111111111111111111111",
+        "to": "0x2222222222222222222222222222222222222222",
+        "value": "0xde0b6b3a7640000",
+        "input": "0xa9059cbb",
+        "calls": [
+            {
+                "type": "DELEGATECALL",
+                "from": "0x2222222222222222222222222222222222222222",
+                "to": "0x3333333333333333333333333333333333333333",
+                "input": "0x",
+                "error": "execution reverted"
+            },
+            {
+                "type": "CREATE",
+                "from": "0x2222222222222222222222222222222222222222",
+                "value": "0x0",
+                "input": "0x6080",
+                "error": "out of gas"
+            }
+        ]
+    }
+}]`
+
+func TestTraceBlockFallsBackToDebugTraceBlock(t *testing.T) {
+    node := newFakeNode(t)
+    node.handle("debug_traceBlockByNumber", func(params []json.RawMessage) (any, error) {
+        var number string
+        if err := json.Unmarshal(params[0], &number); err != nil || number != "0x10" {
+            t.Errorf("block parameter = %s, want \"0x10\"", params[0])
+        }
+        return json.RawMessage(debugTraceBlockResult), nil
+    })
+    c := dialFake(t, node, 1)
+
+    traces, err := c.TraceBlock(context.Background(), 16)
+    if err != nil {
+        t.Fatalf("TraceBlock: %v", err)
+    }
+    if len(traces) != 3 {
+        t.Fatalf("got %d traces, want 3", len(traces))
+    }
+
+    hash := common.HexToHash("0xaa")
+    top, sub, create := traces[0], traces[1], traces[2]
+    if top.TxHash != hash || top.Type != "call" || len(top.TraceAddress) != 0 {
+        t.Errorf("top frame = %+v", top)
+    }
+    if top.To == nil || *top.To != common.HexToAddress("0x2222222222222222222222222222222222222222") {
+        t.Errorf("top frame to = %v", top.To)
+    }
+    if top.Value == nil || top.Value.String() != "1000000000000000000" {
+        t.Errorf("top frame value = %v", top.Value)
+    }
+    if sub.Type != "delegatecall" || sub.Error != "execution reverted" || len(sub.TraceAddress) != 1 || sub.TraceAddress[0] != 0 {
+        t.Errorf("sub frame = %+v", sub)
+    }
+    if create.Type != "create" || create.To != nil || len(create.TraceAddress) != 1 || create.TraceAddress[0] != 1 {
+        t.Errorf("failed create = %+v, want type create, no to, trace address [1]", create)
+    }
+
+    // trace_block is only tried once.
+    if _, err := c.TraceBlock(context.Background(), 16); err != nil {
+        t.Fatalf("second TraceBlock: %v", err)
+    }
+    if n := node.callCount("trace_block"); n != 1 {
+        t.Errorf("trace_block called %d times, want 1", n)
+    }
+}
+
+func TestTraceBlockUnsupported(t *testing.T) {
+    node := newFakeNode(t)
+    c := dialFake(t, node, 3)
+
+    _, err := c.TraceBlock(context.Background(), 1)
+    if !errors.Is(err, ErrTracesUnsupported) {
+        t.Fatalf("err = %v, want ErrTracesUnsupported", err)
+    }
+    // Unsupported methods are not retried.
+    if n := node.callCount("debug_traceBlockByNumber"); n != 1 {
+        t.Errorf("debug_traceBlockByNumber called %d times, want 1", n)
+    }
+}
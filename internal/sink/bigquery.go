@@ -0,0 +1,541 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+    Register("bigquery", func(cfg config.StorageConfig) (Sink, error) {
+        s, err := NewBigQuerySink(cfg.BigQuery.Project, cfg.BigQuery.Dataset, cfg.BigQuery.CredentialsFile, cfg.BigQuery.BatchSize)
+        if err != nil {
+            return nil, err
+        }
+        s.tableMap = cfg.TableMap
+        s.primaryKey = cfg.PrimaryKey
+        return s, nil
+    })
+    Describe("bigquery",
+        Field{Name: "bigquery.project", Type: "string", Required: true, Description: "GCP project"},
+        Field{Name: "bigquery.dataset", Type: "string", Required: true, Description: "Dataset the event tables are created in"},
+        Field{Name: "bigquery.credentials_file", Type: "string", Description: "Service-account JSON key; the GCE metadata server is used when empty"},
+        Field{Name: "bigquery.batch_size", Type: "int", Description: "Rows per insertAll request (default 500)"},
+        Field{Name: "table_map", Type: "map[string]string", Description: "Routes \"<contract>.<event>\" keys to shared tables"},
+        Field{Name: "primary_key", Type: "map[string][]string", Description: "Primary key (and clustering) columns per table name or \"*\"; default tx_hash, log_index"},
+    )
+}
+
+const bigQueryAPI = "https://bigquery.googleapis.com/bigquery/v2"
+
+// bigQueryTimeout bounds every REST call made by the sink since Write does
+// not receive a context from the indexer.
+const bigQueryTimeout = 30 * time.Second
+
+// DefaultBigQueryBatchSize is the number of rows sent per insertAll request
+// when storage.bigquery.batch_size is unset.
+const DefaultBigQueryBatchSize = 500
+
+// bqField is a column of an auto-created BigQuery table.
+type bqField struct {
+    Name string `json:"name"`
+    Type string `json:"type"`
+    Mode string `json:"mode"`
+}
+
+// BigQuerySink streams decoded events into BigQuery using the REST
+// tabledata.insertAll API. One table per "<contractName>_<eventName>" is
+// created on first sight with a schema derived from that first event; keys
+// of later events that are not part of the schema are added to the table as
+// NULLABLE columns. Events listed in storage.table_map go to the named table
+// instead, with their source in the SourceEventColumn.
+//
+// Rows are buffered per table and inserted batchSize at a time, and on
+// Flush or Close. A failed insert keeps the batch buffered, with the
+// insertId of every row so a resend is deduplicated, and the Write that
+// triggered it reports the error so the RetrySink wrapping this sink
+// re-attempts it. Rows BigQuery rejects as invalid are dropped from the
+// batch and reported in a permanent RejectedError.
+type BigQuerySink struct {
+    project    string
+    dataset    string
+    baseURL    string // bigQueryAPI
+    httpClient *http.Client
+    tokens     *gcpTokenSource
+    tableMap   map[string]string // storage.table_map
+    primaryKey map[string][]string // storage.primary_key
+    batchSize  int
+
+    mu     sync.Mutex
+    tables map[string]*bqTable // tables known to exist
+    // rejected holds invalid rows not reported yet, because the insert
+    // that found them failed otherwise.
+    rejected []Event
+    insertIDs uint64
+    idPrefix  string
+}
+
+// bqTable is a table known to exist, with its columns and buffered rows.
+type bqTable struct {
+    fields  []bqField
+    columns map[string]bool
+    rows    []bqRow
+}
+
+// bqRow is a buffered row with the event it was converted from.
+type bqRow struct {
+    insertID string
+    json     map[string]interface{}
+    evt      Event
+}
+
+// NewBigQuerySink builds a sink streaming into the given project and dataset.
+// credentialsFile is a service-account JSON key; when empty, tokens are taken
+// from the GCE metadata server. A batchSize of 0 uses DefaultBigQueryBatchSize.
+func NewBigQuerySink(project, dataset, credentialsFile string, batchSize int) (*BigQuerySink, error) {
+    if project == "" || dataset == "" {
+        return nil, fmt.Errorf("bigquery project and dataset are required")
+    }
+    if batchSize <= 0 {
+        batchSize = DefaultBigQueryBatchSize
+    }
+
+    httpClient := &http.Client{Timeout: bigQueryTimeout}
+    tokens, err := newGCPTokenSource(httpClient, credentialsFile)
+    if err != nil {
+        return nil, err
+    }
+
+    return &BigQuerySink{
+        project:    project,
+        dataset:    dataset,
+        baseURL:    bigQueryAPI,
+        httpClient: httpClient,
+        tokens:     tokens,
+        batchSize:  batchSize,
+        tables:     make(map[string]*bqTable),
+        idPrefix:   strconv.FormatInt(time.Now().UnixNano(), 36),
+    }, nil
+}
+
+// Write buffers the event as a row of its table, creating the table or
+// adding columns first if needed, and inserts the table's rows once
+// batchSize are buffered.
+func (s *BigQuerySink) Write(evt Event) error {
+    ctx, cancel := context.WithTimeout(context.Background(), bigQueryTimeout)
+    defer cancel()
+
+    table := bigQueryTableName(evt)
+    if mapped, source, ok := mappedTable(s.tableMap, evt); ok {
+        // Copy the event: it is shared with mirrors and transforms.
+        merged := make(Event, len(evt)+1)
+        for k, v := range evt {
+            merged[k] = v
+        }
+        merged[SourceEventColumn] = source
+        table, evt = bigQueryColumnName(mapped), merged
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    t, err := s.ensureTable(ctx, table, evt)
+    if err != nil {
+        return err
+    }
+    row := make(map[string]interface{}, len(evt))
+    for k, v := range evt {
+        row[bigQueryColumnName(k)] = bigQueryValue(v)
+    }
+    s.insertIDs++
+    id := fmt.Sprintf("%s-%d", s.idPrefix, s.insertIDs)
+    t.rows = append(t.rows, bqRow{insertID: id, json: row, evt: evt})
+    if len(t.rows) < s.batchSize {
+        return nil
+    }
+
+    if err := s.insert(ctx, table, t); err != nil {
+        // The event is reported as failed, so it must not stay buffered
+        // as well: a retry would add it twice.
+        for i := len(t.rows) - 1; i >= 0; i-- {
+            if t.rows[i].insertID == id {
+                t.rows = append(t.rows[:i], t.rows[i+1:]...)
+                break
+            }
+        }
+        return err
+    }
+    return s.takeRejected()
+}
+
+// Flush inserts the buffered rows of every table.
+func (s *BigQuerySink) Flush() error {
+    ctx, cancel := context.WithTimeout(context.Background(), bigQueryTimeout)
+    defer cancel()
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    names := make([]string, 0, len(s.tables))
+    for name := range s.tables {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    var errs []error
+    for _, name := range names {
+        if err := s.insert(ctx, name, s.tables[name]); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    if len(errs) > 0 {
+        return errors.Join(errs...)
+    }
+    return s.takeRejected()
+}
+
+// Close inserts the rows still buffered.
+func (s *BigQuerySink) Close() error {
+    return s.Flush()
+}
+
+// takeRejected returns the invalid rows found since the last call as a
+// permanent RejectedError. s.mu must be held.
+func (s *BigQuerySink) takeRejected() error {
+    if len(s.rejected) == 0 {
+        return nil
+    }
+    rejected := s.rejected
+    s.rejected = nil
+    return Permanent(&RejectedError{Events: rejected, Err: errors.New("bigquery rejected rows as invalid")})
+}
+
+// insert sends the buffered rows of t in one insertAll request. Rows
+// rejected as invalid are dropped from the batch, queued for takeRejected,
+// and the others sent again; on any other failure the rows stay buffered.
+// s.mu must be held.
+func (s *BigQuerySink) insert(ctx context.Context, table string, t *bqTable) error {
+    for len(t.rows) > 0 {
+        rows := make([]map[string]interface{}, len(t.rows))
+        for i, r := range t.rows {
+            rows[i] = map[string]interface{}{"insertId": r.insertID, "json": r.json}
+        }
+        body := map[string]interface{}{
+            "ignoreUnknownValues": true,
+            "rows":                rows,
+        }
+        var resp struct {
+            InsertErrors []struct {
+                Index  int `json:"index"`
+                Errors []struct {
+                    Reason  string `json:"reason"`
+                    Message string `json:"message"`
+                } `json:"errors"`
+            } `json:"insertErrors"`
+        }
+        path := fmt.Sprintf("/projects/%s/datasets/%s/tables/%s/insertAll", s.project, s.dataset, table)
+        if _, err := s.do(ctx, http.MethodPost, path, body, &resp); err != nil {
+            return fmt.Errorf("bigquery insert into %s failed: %w", table, err)
+        }
+        if len(resp.InsertErrors) == 0 {
+            t.rows = t.rows[:0]
+            return nil
+        }
+
+        // Invalid rows do not fit the table schema and fail again on every
+        // resend; the other rows were only stopped because of them.
+        invalid := make(map[int]bool)
+        var firstErr string
+        for _, ie := range resp.InsertErrors {
+            for _, e := range ie.Errors {
+                if e.Reason == "invalid" && ie.Index >= 0 && ie.Index < len(t.rows) {
+                    invalid[ie.Index] = true
+                }
+                if firstErr == "" && e.Reason != "stopped" {
+                    firstErr = e.Reason + ": " + e.Message
+                }
+            }
+        }
+        if len(invalid) == 0 {
+            return fmt.Errorf("bigquery rejected rows for %s: %s", table, firstErr)
+        }
+        kept := t.rows[:0]
+        for i, r := range t.rows {
+            if invalid[i] {
+                logrus.Warnf("bigquery rejected a row of %s: %s", table, firstErr)
+                s.rejected = append(s.rejected, r.evt)
+                continue
+            }
+            kept = append(kept, r)
+        }
+        t.rows = kept
+    }
+    return nil
+}
+
+// ensureTable returns the table, creating it with a schema derived from evt
+// unless it is already known to exist, and adding the keys of evt missing
+// from its schema as NULLABLE columns. s.mu must be held.
+func (s *BigQuerySink) ensureTable(ctx context.Context, table string, evt Event) (*bqTable, error) {
+    t, ok := s.tables[table]
+    if !ok {
+        fields, err := s.createTable(ctx, table, evt)
+        if err != nil {
+            return nil, err
+        }
+        t = &bqTable{fields: fields, columns: make(map[string]bool, len(fields))}
+        for _, f := range fields {
+            t.columns[f.Name] = true
+        }
+        s.tables[table] = t
+    }
+
+    var missing []bqField
+    for _, f := range bigQuerySchema(evt) {
+        if !t.columns[f.Name] {
+            missing = append(missing, f)
+        }
+    }
+    if len(missing) == 0 {
+        return t, nil
+    }
+    fields := append(append([]bqField(nil), t.fields...), missing...)
+    path := fmt.Sprintf("/projects/%s/datasets/%s/tables/%s", s.project, s.dataset, table)
+    patch := map[string]interface{}{"schema": map[string]interface{}{"fields": fields}}
+    if _, err := s.do(ctx, http.MethodPatch, path, patch, nil); err != nil {
+        return nil, fmt.Errorf("bigquery adding %d column(s) to %s failed: %w", len(missing), table, err)
+    }
+    t.fields = fields
+    for _, f := range missing {
+        t.columns[f.Name] = true
+    }
+    return t, nil
+}
+
+// createTable looks the table up, creating it with a schema derived from evt
+// when it does not exist, and returns its columns.
+func (s *BigQuerySink) createTable(ctx context.Context, table string, evt Event) ([]bqField, error) {
+    path := fmt.Sprintf("/projects/%s/datasets/%s/tables/%s", s.project, s.dataset, table)
+    var existing struct {
+        Schema struct {
+            Fields []bqField `json:"fields"`
+        } `json:"schema"`
+    }
+    status, err := s.do(ctx, http.MethodGet, path, nil, &existing)
+    if err == nil {
+        return existing.Schema.Fields, nil
+    }
+    if status != http.StatusNotFound {
+        return nil, fmt.Errorf("bigquery lookup of table %s failed: %w", table, err)
+    }
+
+    schema := bigQuerySchema(evt)
+    def := map[string]interface{}{
+        "tableReference": map[string]string{
+            "projectId": s.project,
+            "datasetId": s.dataset,
+            "tableId":   table,
+        },
+        "schema": map[string]interface{}{"fields": schema},
+    }
+    pk, explicit := primaryKeyOf(s.primaryKey, table)
+    cols, err := primaryKeyColumns(pk, schema)
+    switch {
+    case err != nil && explicit:
+        return nil, Permanent(fmt.Errorf("bigquery table %s: storage.primary_key: %w", table, err))
+    case err == nil:
+        // BigQuery does not enforce primary keys; clustering on the same
+        // columns is what orders the storage.
+        def["tableConstraints"] = map[string]interface{}{
+            "primaryKey": map[string]interface{}{"columns": cols},
+        }
+        if explicit {
+            def["clustering"] = map[string]interface{}{"fields": cols[:min(len(cols), bigQueryMaxClustering)]}
+        }
+    }
+    createPath := fmt.Sprintf("/projects/%s/datasets/%s/tables", s.project, s.dataset)
+    status, err = s.do(ctx, http.MethodPost, createPath, def, nil)
+    if err == nil {
+        return schema, nil
+    }
+    if status != http.StatusConflict {
+        return nil, fmt.Errorf("bigquery create table %s failed: %w", table, err)
+    }
+    // 409: another writer created it concurrently, maybe with other columns.
+    if _, err := s.do(ctx, http.MethodGet, path, nil, &existing); err != nil {
+        return nil, fmt.Errorf("bigquery lookup of table %s failed: %w", table, err)
+    }
+    return existing.Schema.Fields, nil
+}
+
+// bigQueryMaxClustering is the most clustering columns a table can have.
+const bigQueryMaxClustering = 4
+
+// primaryKeyOf returns the primary key configured for table, an entry for
+// the table winning over "*", or DefaultPrimaryKey with explicit false.
+func primaryKeyOf(m map[string][]string, table string) (cols []string, explicit bool) {
+    if cols, ok := m[table]; ok {
+        return cols, true
+    }
+    if cols, ok := m["*"]; ok {
+        return cols, true
+    }
+    return config.DefaultPrimaryKey, false
+}
+
+// primaryKeyColumns maps the primary key columns, named by event key, to
+// the columns of schema, failing when one is not a field of the event.
+func primaryKeyColumns(pk []string, schema []bqField) ([]string, error) {
+    have := make(map[string]bool, len(schema))
+    for _, f := range schema {
+        have[f.Name] = true
+    }
+    cols := make([]string, 0, len(pk))
+    for _, k := range pk {
+        col := bigQueryColumnName(k)
+        if !have[col] {
+            return nil, fmt.Errorf("column %q is not a field of the event", k)
+        }
+        cols = append(cols, col)
+    }
+    return cols, nil
+}
+
+// do performs an authenticated JSON request against the BigQuery API and
+// returns the HTTP status code alongside any error.
+func (s *BigQuerySink) do(ctx context.Context, method, path string, in, out interface{}) (int, error) {
+    token, err := s.tokens.Token(ctx)
+    if err != nil {
+        return 0, err
+    }
+
+    var body io.Reader
+    if in != nil {
+        data, err := json.Marshal(in)
+        if err != nil {
+            return 0, err
+        }
+        body = bytes.NewReader(data)
+    }
+
+    req, err := http.NewRequestWithContext(ctx, method, s.baseURL+path, body)
+    if err != nil {
+        return 0, err
+    }
+    req.Header.Set("Authorization", "Bearer "+token)
+    if in != nil {
+        req.Header.Set("Content-Type", "application/json")
+    }
+
+    resp, err := s.httpClient.Do(req)
+    if err != nil {
+        return 0, err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+        msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+        err := fmt.Errorf("status %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+        // Client errors other than expired credentials, timeouts and rate
+        // limiting won't go away.
+        switch resp.StatusCode {
+        case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+        default:
+            if resp.StatusCode >= 400 && resp.StatusCode < 500 {
+                err = Permanent(err)
+            }
+        }
+        return resp.StatusCode, err
+    }
+    if out != nil {
+        if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+            return resp.StatusCode, fmt.Errorf("failed to decode bigquery response: %w", err)
+        }
+    }
+    return resp.StatusCode, nil
+}
+
+// bigQueryTableName derives the table ID for an event, following the same
+// "<contractName>_<eventName>" layout as the CSV sink.
+func bigQueryTableName(evt Event) string {
+    name, _ := evt["event_name"].(string)
+    if name == "" {
+        name = "unknown"
+    }
+    if name == BlockEventName {
+        return "blocks"
+    }
+    if name == TraceEventName {
+        return "traces"
+    }
+    contractName, _ := evt["contract_name"].(string)
+    if contractName == "" {
+        contractName = "unknown"
+    }
+    return bigQueryColumnName(contractName + "_" + name)
+}
+
+// bigQueryColumnName replaces characters BigQuery does not accept in table
+// and column names with underscores.
+func bigQueryColumnName(name string) string {
+    var b strings.Builder
+    for i, r := range name {
+        switch {
+        case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+            b.WriteRune(r)
+        case r >= '0' && r <= '9':
+            if i == 0 {
+                b.WriteRune('_')
+            }
+            b.WriteRune(r)
+        default:
+            b.WriteRune('_')
+        }
+    }
+    return b.String()
+}
+
+// bigQuerySchema derives NULLABLE columns from the first event of a table.
+// Native Go integers map to INTEGER and booleans to BOOLEAN; everything else
+// (including *big.Int, which may exceed INT64) is stored as STRING.
+func bigQuerySchema(evt Event) []bqField {
+    keys := extractHeaders(evt)
+    fields := make([]bqField, 0, len(keys))
+    for _, k := range keys {
+        typ := "STRING"
+        switch evt[k].(type) {
+        case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64:
+            typ = "INTEGER"
+        case bool:
+            typ = "BOOLEAN"
+        }
+        fields = append(fields, bqField{Name: bigQueryColumnName(k), Type: typ, Mode: "NULLABLE"})
+    }
+    return fields
+}
+
+// bigQueryValue converts an event value into its JSON representation for a
+// streaming insert, consistent with the types chosen by bigQuerySchema.
+func bigQueryValue(v interface{}) interface{} {
+    switch val := v.(type) {
+    case int, int8, int16, int32, int64, uint8, uint16, uint32, uint64, bool:
+        return val
+    case *big.Int:
+        return val.String()
+    default:
+        return fmt.Sprint(val)
+    }
+}
@@ -0,0 +1,167 @@
+package sink
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	bigQueryScope    = "https://www.googleapis.com/auth/bigquery"
+	gceTokenEndpoint = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+)
+
+// serviceAccountKey holds the fields of a Google service-account JSON key
+// required for the OAuth2 JWT-bearer flow.
+type serviceAccountKey struct {
+    ClientEmail string `json:"client_email"`
+    PrivateKey  string `json:"private_key"`
+    TokenURI    string `json:"token_uri"`
+}
+
+// gcpTokenSource issues and caches OAuth2 access tokens either from a
+// service-account key file or, when no file is configured, from the GCE
+// metadata server (workload identity / default service account).
+type gcpTokenSource struct {
+    httpClient *http.Client
+    key        *serviceAccountKey
+    signer     *rsa.PrivateKey
+
+    mu      sync.Mutex
+    token   string
+    expires time.Time
+}
+
+func newGCPTokenSource(httpClient *http.Client, credentialsFile string) (*gcpTokenSource, error) {
+    ts := &gcpTokenSource{httpClient: httpClient}
+    if credentialsFile == "" {
+        return ts, nil
+    }
+
+    data, err := os.ReadFile(credentialsFile)
+    if err != nil {
+        return nil, fmt.Errorf("failed to read bigquery credentials: %w", err)
+    }
+    var key serviceAccountKey
+    if err := json.Unmarshal(data, &key); err != nil {
+        return nil, fmt.Errorf("failed to decode bigquery credentials: %w", err)
+    }
+    if key.ClientEmail == "" || key.PrivateKey == "" {
+        return nil, fmt.Errorf("bigquery credentials must be a service-account key")
+    }
+    if key.TokenURI == "" {
+        key.TokenURI = "https://oauth2.googleapis.com/token"
+    }
+
+    block, _ := pem.Decode([]byte(key.PrivateKey))
+    if block == nil {
+        return nil, fmt.Errorf("bigquery credentials contain an invalid private key")
+    }
+    parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+    if err != nil {
+        return nil, fmt.Errorf("failed to parse bigquery private key: %w", err)
+    }
+    rsaKey, ok := parsed.(*rsa.PrivateKey)
+    if !ok {
+        return nil, fmt.Errorf("bigquery private key is not RSA")
+    }
+
+    ts.key = &key
+    ts.signer = rsaKey
+    return ts, nil
+}
+
+// Token returns a valid access token, refreshing it shortly before expiry.
+func (ts *gcpTokenSource) Token(ctx context.Context) (string, error) {
+    ts.mu.Lock()
+    defer ts.mu.Unlock()
+
+    if ts.token != "" && time.Until(ts.expires) > time.Minute {
+        return ts.token, nil
+    }
+
+    var (
+        req *http.Request
+        err error
+    )
+    if ts.key != nil {
+        req, err = ts.jwtRequest(ctx)
+    } else {
+        req, err = http.NewRequestWithContext(ctx, http.MethodGet, gceTokenEndpoint, nil)
+        if err == nil {
+            req.Header.Set("Metadata-Flavor", "Google")
+        }
+    }
+    if err != nil {
+        return "", err
+    }
+
+    resp, err := ts.httpClient.Do(req)
+    if err != nil {
+        return "", fmt.Errorf("failed to fetch gcp access token: %w", err)
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("failed to fetch gcp access token: status %s", resp.Status)
+    }
+
+    var body struct {
+        AccessToken string `json:"access_token"`
+        ExpiresIn   int    `json:"expires_in"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+        return "", fmt.Errorf("failed to decode gcp access token: %w", err)
+    }
+
+    ts.token = body.AccessToken
+    ts.expires = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+    return ts.token, nil
+}
+
+// jwtRequest builds the token exchange request for the service-account key
+// using a self-signed RS256 assertion.
+func (ts *gcpTokenSource) jwtRequest(ctx context.Context) (*http.Request, error) {
+    now := time.Now()
+    header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+    claims, err := json.Marshal(map[string]interface{}{
+        "iss":   ts.key.ClientEmail,
+        "scope": bigQueryScope,
+        "aud":   ts.key.TokenURI,
+        "iat":   now.Unix(),
+        "exp":   now.Add(time.Hour).Unix(),
+    })
+    if err != nil {
+        return nil, err
+    }
+    unsigned := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+    digest := sha256.Sum256([]byte(unsigned))
+    sig, err := rsa.SignPKCS1v15(nil, ts.signer, crypto.SHA256, digest[:])
+    if err != nil {
+        return nil, fmt.Errorf("failed to sign gcp token assertion: %w", err)
+    }
+    assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(sig)
+
+    form := url.Values{
+        "grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+        "assertion":  {assertion},
+    }
+    req, err := http.NewRequestWithContext(ctx, http.MethodPost, ts.key.TokenURI, strings.NewReader(form.Encode()))
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+    return req, nil
+}
@@ -0,0 +1,435 @@
+package sink
+
+import (
+	"bufio"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeBigQuery serves the token endpoint and the table and insertAll calls
+// of the BigQuery REST API for the project "p" and dataset "d".
+type fakeBigQuery struct {
+    *httptest.Server
+    t   *testing.T
+    key *rsa.PrivateKey
+
+    mu      sync.Mutex
+    schemas map[string][]bqField
+    rows    map[string][]map[string]any // stored rows per table
+    ids     map[string]bool             // insertIds seen in stored rows
+    inserts int                         // insertAll requests
+    // keys and clustering hold the primary key and clustering columns
+    // tables were created with.
+    keys       map[string][]string
+    clustering map[string][]string
+    // failInserts fails that many insertAll requests with a 503.
+    failInserts int
+}
+
+func newFakeBigQuery(t *testing.T) *fakeBigQuery {
+    t.Helper()
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    f := &fakeBigQuery{t: t, key: key, schemas: map[string][]bqField{}, rows: map[string][]map[string]any{}, ids: map[string]bool{}, keys: map[string][]string{}, clustering: map[string][]string{}}
+    f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+    t.Cleanup(f.Close)
+    return f
+}
+
+// sink returns a BigQuerySink of the fake, authenticating with a
+// service-account key.
+func (f *fakeBigQuery) sink(batchSize int) *BigQuerySink {
+    f.t.Helper()
+    der, err := x509.MarshalPKCS8PrivateKey(f.key)
+    if err != nil {
+        f.t.Fatal(err)
+    }
+    creds, _ := json.Marshal(serviceAccountKey{
+        ClientEmail: "etl@p.iam.gserviceaccount.com",
+        PrivateKey:  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+        TokenURI:    f.URL + "/token",
+    })
+    path := filepath.Join(f.t.TempDir(), "key.json")
+    if err := os.WriteFile(path, creds, 0o600); err != nil {
+        f.t.Fatal(err)
+    }
+    s, err := NewBigQuerySink("p", "d", path, batchSize)
+    if err != nil {
+        f.t.Fatalf("NewBigQuerySink: %v", err)
+    }
+    s.baseURL = f.URL
+    return s
+}
+
+func (f *fakeBigQuery) serve(w http.ResponseWriter, r *http.Request) {
+    if r.URL.Path == "/token" {
+        f.checkAssertion(r.FormValue("assertion"))
+        json.NewEncoder(w).Encode(map[string]any{"access_token": "test-token", "expires_in": 3600})
+        return
+    }
+    if r.Header.Get("Authorization") != "Bearer test-token" {
+        http.Error(w, "unauthenticated", http.StatusUnauthorized)
+        return
+    }
+
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    const prefix = "/projects/p/datasets/d/tables"
+    rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+    if !ok {
+        http.NotFound(w, r)
+        return
+    }
+    table, action, _ := strings.Cut(strings.TrimPrefix(rest, "/"), "/")
+    var body struct {
+        TableReference struct {
+            TableID string `json:"tableId"`
+        } `json:"tableReference"`
+        Schema struct {
+            Fields []bqField `json:"fields"`
+        } `json:"schema"`
+        TableConstraints struct {
+            PrimaryKey struct {
+                Columns []string `json:"columns"`
+            } `json:"primaryKey"`
+        } `json:"tableConstraints"`
+        Clustering struct {
+            Fields []string `json:"fields"`
+        } `json:"clustering"`
+        Rows []struct {
+            InsertID string         `json:"insertId"`
+            JSON     map[string]any `json:"json"`
+        } `json:"rows"`
+    }
+    if r.Body != nil {
+        json.NewDecoder(r.Body).Decode(&body)
+    }
+
+    switch {
+    case r.Method == http.MethodGet:
+        schema, ok := f.schemas[table]
+        if !ok {
+            http.Error(w, "not found", http.StatusNotFound)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]any{"schema": map[string]any{"fields": schema}})
+    case r.Method == http.MethodPost && table == "":
+        id := body.TableReference.TableID
+        f.schemas[id] = body.Schema.Fields
+        f.keys[id] = body.TableConstraints.PrimaryKey.Columns
+        f.clustering[id] = body.Clustering.Fields
+        w.Write([]byte("{}"))
+    case r.Method == http.MethodPatch:
+        f.schemas[table] = body.Schema.Fields
+        w.Write([]byte("{}"))
+    case r.Method == http.MethodPost && action == "insertAll":
+        f.inserts++
+        if f.failInserts > 0 {
+            f.failInserts--
+            http.Error(w, "backend error", http.StatusServiceUnavailable)
+            return
+        }
+        // Rows with bad=true are invalid; the others are stopped, as
+        // BigQuery does without skipInvalidRows.
+        type rowErr struct {
+            Reason  string `json:"reason"`
+            Message string `json:"message"`
+        }
+        var insertErrors []map[string]any
+        for i, row := range body.Rows {
+            if row.JSON["bad"] == true {
+                insertErrors = append(insertErrors, map[string]any{"index": i, "errors": []rowErr{{Reason: "invalid", Message: "no such field"}}})
+            }
+        }
+        if len(insertErrors) > 0 {
+            for i, row := range body.Rows {
+                if row.JSON["bad"] != true {
+                    insertErrors = append(insertErrors, map[string]any{"index": i, "errors": []rowErr{{Reason: "stopped"}}})
+                }
+            }
+            json.NewEncoder(w).Encode(map[string]any{"insertErrors": insertErrors})
+            return
+        }
+        for _, row := range body.Rows {
+            if f.ids[row.InsertID] {
+                continue // deduplicated by insertId
+            }
+            f.ids[row.InsertID] = true
+            f.rows[table] = append(f.rows[table], row.JSON)
+        }
+        w.Write([]byte("{}"))
+    default:
+        http.Error(w, "unexpected "+r.Method+" "+r.URL.Path, http.StatusBadRequest)
+    }
+}
+
+// checkAssertion verifies the RS256 signature of the JWT bearer assertion.
+func (f *fakeBigQuery) checkAssertion(assertion string) {
+    parts := strings.Split(assertion, ".")
+    if len(parts) != 3 {
+        f.t.Errorf("malformed assertion %q", assertion)
+        return
+    }
+    sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        f.t.Errorf("assertion signature: %v", err)
+        return
+    }
+    digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+    if err := rsa.VerifyPKCS1v15(&f.key.PublicKey, crypto.SHA256, digest[:], sig); err != nil {
+        f.t.Errorf("assertion signature does not verify: %v", err)
+    }
+}
+
+func (f *fakeBigQuery) stored(table string) []map[string]any {
+    f.mu.Lock()
+    defer f.mu.Unlock()
+    return f.rows[table]
+}
+
+func transfer(n int) Event {
+    return Event{"contract_name": "Token", "event_name": "Transfer", "block_number": uint64(n), "log_index": uint(0), "tx_hash": "0x" + strings.Repeat("0", 63) + string(rune('0'+n%10))}
+}
+
+func TestBigQuerySinkBatchesInserts(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    s := bq.sink(3)
+    for i := 0; i < 7; i++ {
+        if err := s.Write(transfer(i)); err != nil {
+            t.Fatalf("Write %d: %v", i, err)
+        }
+    }
+    if bq.inserts != 2 || len(bq.stored("Token_Transfer")) != 6 {
+        t.Fatalf("after 7 writes: %d inserts of %d rows, want 2 of 6", bq.inserts, len(bq.stored("Token_Transfer")))
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    if bq.inserts != 3 || len(bq.stored("Token_Transfer")) != 7 {
+        t.Fatalf("after Close: %d inserts of %d rows, want 3 of 7", bq.inserts, len(bq.stored("Token_Transfer")))
+    }
+}
+
+func TestBigQuerySinkAddsColumnsOfLaterEvents(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    s := bq.sink(10)
+    first := transfer(1)
+    second := transfer(2)
+    second["memo"] = "hello"
+    for _, evt := range []Event{first, second} {
+        if err := s.Write(evt); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    if err := s.Flush(); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+
+    var names []string
+    for _, f := range bq.schemas["Token_Transfer"] {
+        names = append(names, f.Name)
+    }
+    if !strings.Contains(strings.Join(names, ","), "memo") {
+        t.Fatalf("table columns = %v, want memo added", names)
+    }
+    rows := bq.stored("Token_Transfer")
+    if len(rows) != 2 || rows[1]["memo"] != "hello" {
+        t.Fatalf("stored rows = %v", rows)
+    }
+}
+
+func TestBigQuerySinkKeepsBatchOnFailedInsert(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    s := bq.sink(2)
+    if err := s.Write(transfer(1)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    bq.failInserts = 1
+    if err := s.Write(transfer(2)); err == nil {
+        t.Fatal("Write succeeded despite the failing insert")
+    }
+    // The caller (RetrySink) writes the failed event again.
+    if err := s.Write(transfer(2)); err != nil {
+        t.Fatalf("retried Write: %v", err)
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    rows := bq.stored("Token_Transfer")
+    if len(rows) != 2 {
+        t.Fatalf("stored %d rows, want 2: %v", len(rows), rows)
+    }
+}
+
+func TestBigQuerySinkDeadLettersInvalidRows(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    path := filepath.Join(t.TempDir(), "failed.jsonl")
+    dl, err := NewDeadLetterSink(bq.sink(3), path, 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    bad := transfer(2)
+    bad["bad"] = true
+    for _, evt := range []Event{transfer(1), bad, transfer(3)} {
+        if err := dl.Write(evt); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    if err := dl.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    if rows := bq.stored("Token_Transfer"); len(rows) != 2 {
+        t.Fatalf("stored %d rows, want the 2 valid ones: %v", len(rows), rows)
+    }
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    var lines []DeadLetter
+    sc := bufio.NewScanner(f)
+    for sc.Scan() {
+        var dlq DeadLetter
+        if err := json.Unmarshal(sc.Bytes(), &dlq); err != nil {
+            t.Fatal(err)
+        }
+        lines = append(lines, dlq)
+    }
+    if len(lines) != 1 || lines[0].Event["bad"] != true {
+        t.Fatalf("dead letters = %+v, want the invalid row only", lines)
+    }
+}
+
+func TestBigQuerySinkTableMapMergesSchemas(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    s := bq.sink(10)
+    s.tableMap = map[string]string{"*.Transfer": "erc20_transfers"}
+    token := transfer(1)
+    token["value"] = "10"
+    usdc := transfer(2)
+    usdc["contract_name"] = "USDC"
+    usdc["memo"] = "wire"
+    for _, evt := range []Event{token, usdc} {
+        if err := s.Write(evt); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    columns := map[string]bool{}
+    for _, f := range bq.schemas["erc20_transfers"] {
+        columns[f.Name] = true
+    }
+    for _, col := range []string{"value", "memo", "source_event"} {
+        if !columns[col] {
+            t.Errorf("erc20_transfers lacks column %s: %v", col, columns)
+        }
+    }
+    rows := bq.stored("erc20_transfers")
+    if len(rows) != 2 || rows[0]["source_event"] != "Token.Transfer" || rows[1]["source_event"] != "USDC.Transfer" || rows[1]["memo"] != "wire" {
+        t.Fatalf("stored rows = %v", rows)
+    }
+    if len(bq.schemas) != 1 {
+        t.Errorf("tables = %v, want erc20_transfers only", bq.schemas)
+    }
+}
+
+func TestBigQuerySinkPrimaryKey(t *testing.T) {
+    block := Event{"event_name": BlockEventName, "block_number": uint64(1), "block_hash": "0x01"}
+    for _, tc := range []struct {
+        name           string
+        primaryKey     map[string][]string
+        event          Event
+        table          string
+        wantKey        []string
+        wantClustering []string
+    }{
+        {name: "default", event: transfer(1), table: "Token_Transfer", wantKey: []string{"tx_hash", "log_index"}},
+        {name: "default without its columns", event: block, table: "blocks"},
+        {
+            name:           "per table",
+            primaryKey:     map[string][]string{"Token_Transfer": {"block_number", "log_index"}, "*": {"tx_hash"}},
+            event:          transfer(1),
+            table:          "Token_Transfer",
+            wantKey:        []string{"block_number", "log_index"},
+            wantClustering: []string{"block_number", "log_index"},
+        },
+        {
+            name:           "any table",
+            primaryKey:     map[string][]string{"*": {"block_number"}},
+            event:          block,
+            table:          "blocks",
+            wantKey:        []string{"block_number"},
+            wantClustering: []string{"block_number"},
+        },
+    } {
+        t.Run(tc.name, func(t *testing.T) {
+            bq := newFakeBigQuery(t)
+            s := bq.sink(10)
+            s.primaryKey = tc.primaryKey
+            if err := s.Write(tc.event); err != nil {
+                t.Fatalf("Write: %v", err)
+            }
+            if err := s.Close(); err != nil {
+                t.Fatalf("Close: %v", err)
+            }
+            if _, ok := bq.schemas[tc.table]; !ok {
+                t.Fatalf("table %s not created: %v", tc.table, bq.schemas)
+            }
+            if got := strings.Join(bq.keys[tc.table], ","); got != strings.Join(tc.wantKey, ",") {
+                t.Errorf("primary key = [%s], want %v", got, tc.wantKey)
+            }
+            if got := strings.Join(bq.clustering[tc.table], ","); got != strings.Join(tc.wantClustering, ",") {
+                t.Errorf("clustering = [%s], want %v", got, tc.wantClustering)
+            }
+        })
+    }
+}
+
+func TestBigQuerySinkPrimaryKeyClusteringLimit(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    s := bq.sink(10)
+    evt := transfer(1)
+    evt["value"], evt["from"] = "10", "0x01"
+    s.primaryKey = map[string][]string{"Token_Transfer": {"block_number", "tx_hash", "log_index", "from", "value"}}
+    if err := s.Write(evt); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    if len(bq.keys["Token_Transfer"]) != 5 || len(bq.clustering["Token_Transfer"]) != bigQueryMaxClustering {
+        t.Fatalf("primary key %v, clustering %v: want 5 key columns, %d clustered", bq.keys["Token_Transfer"], bq.clustering["Token_Transfer"], bigQueryMaxClustering)
+    }
+}
+
+func TestBigQuerySinkPrimaryKeyMissingColumn(t *testing.T) {
+    bq := newFakeBigQuery(t)
+    s := bq.sink(10)
+    s.primaryKey = map[string][]string{"Token_Transfer": {"block_number", "batch_id"}}
+    err := s.Write(transfer(1))
+    if err == nil || !IsPermanent(err) || !strings.Contains(err.Error(), `column "batch_id" is not a field of the event`) {
+        t.Fatalf("Write = %v, want a permanent error naming batch_id", err)
+    }
+    if _, ok := bq.schemas["Token_Transfer"]; ok {
+        t.Error("table created despite its invalid primary key")
+    }
+}
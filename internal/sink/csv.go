@@ -2,19 +2,69 @@ package sink
 
 import (
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+
+	"github.com/sirupsen/logrus"
 )
 
+func init() {
+    Register("csv", func(cfg config.StorageConfig) (Sink, error) {
+        delim, err := config.ParseDelimiter(cfg.CSV.Delimiter)
+        if err != nil {
+            return nil, err
+        }
+        return NewCSVSink(cfg.CSV.OutputDir, CSVOptions{
+            Delimiter:        delim,
+            UseCRLF:          cfg.CSV.UseCRLF,
+            ForceQuote:       cfg.CSV.ForceQuote,
+            FileNameTemplate: cfg.CSV.FileNameTemplate,
+            FlushRows:        cfg.CSV.FlushRows,
+            FlushInterval:    time.Duration(cfg.CSV.FlushIntervalMS) * time.Millisecond,
+        })
+    })
+    Describe("csv",
+        Field{Name: "csv.output_dir", Type: "string", Required: true, Description: "Directory the CSV files are written to"},
+        Field{Name: "csv.delimiter", Type: "string", Description: "Single-character field separator (default \",\")"},
+        Field{Name: "csv.use_crlf", Type: "bool", Description: "Terminate rows with \\r\\n"},
+        Field{Name: "csv.force_quote", Type: "bool", Description: "Quote every field, header included"},
+        Field{Name: "csv.file_name_template", Type: "string", Description: "File layout, default \"{contract}_{event}.csv\""},
+        Field{Name: "csv.flush_rows", Type: "int", Description: "Flush a file every N rows (0: every row)"},
+        Field{Name: "csv.flush_interval_ms", Type: "int", Description: "Flush pending rows periodically"},
+    )
+}
+
 // csvFile wraps an opened CSV file with its writer and cached headers.
 // All writes must respect the header order to keep column consistency.
 type csvFile struct {
+    mu      sync.Mutex // serialises rows of this file only
     file    *os.File
-    writer  *csv.Writer
+    writer  csvRowWriter
     headers []string
+    pending int // rows written since the last flush
+}
+
+// flushLocked flushes the buffered rows; cf.mu must be held.
+func (cf *csvFile) flushLocked() error {
+    if cf.pending == 0 {
+        return nil
+    }
+    cf.writer.Flush()
+    cf.pending = 0
+    return cf.writer.Error()
 }
 
 // CSVSink persists decoded Ethereum events into per-event CSV files.
@@ -24,50 +74,310 @@ type csvFile struct {
 // alphabetically for determinism) and appends every subsequent row in the
 // same column order.
 //
-// Concurrency note: the Indexer currently calls Sink.Write sequentially, but
-// a mutex is included for future-proofing.
+// Concurrency: workers write in parallel. The sink-wide mutex only guards the
+// files map (and the opening of a new file); rows are serialised per file so
+// writes to different event files proceed concurrently.
+//
+// Rows are flushed to disk per CSVOptions; buffered rows are lost if the
+// process crashes before the next flush. Close flushes and closes every file.
 type CSVSink struct {
     outputDir string
+    opts      CSVOptions
     mu        sync.Mutex
-    files     map[string]*csvFile // keyed by "<contractName>_<eventName>"
+    files     map[string]*csvFile // keyed by path relative to outputDir
+
+    stop      chan struct{} // stops the interval flusher
+    closeOnce sync.Once
+}
+
+// CSVOptions tunes the format of the generated files. The zero value yields
+// standard comma-separated files with \n line endings.
+type CSVOptions struct {
+    // Delimiter is the field separator; 0 means ','.
+    Delimiter rune
+    // UseCRLF terminates every row with \r\n.
+    UseCRLF bool
+    // ForceQuote quotes every field, header included, instead of only the
+    // fields that need it.
+    ForceQuote bool
+    // FileNameTemplate is the path of each event file relative to the output
+    // directory, with {contract}, {event}, {address}, {chain} and {chain_id}
+    // placeholders. Empty means "{contract}_{event}.csv".
+    FileNameTemplate string
+    // FlushRows flushes a file once it holds this many unflushed rows.
+    FlushRows int
+    // FlushInterval flushes every file with pending rows periodically. When
+    // both FlushRows and FlushInterval are zero every row is flushed.
+    FlushInterval time.Duration
 }
 
 // NewCSVSink initialises a sink that writes CSV files under the given
 // directory, creating the directory tree if it doesn’t already exist.
-func NewCSVSink(outputDir string) (*CSVSink, error) {
+func NewCSVSink(outputDir string, opts CSVOptions) (*CSVSink, error) {
+    if opts.Delimiter == 0 {
+        opts.Delimiter = ','
+    }
+    if err := config.ValidateFileNameTemplate(opts.FileNameTemplate); err != nil {
+        return nil, fmt.Errorf("invalid csv file name template: %w", err)
+    }
     if err := os.MkdirAll(outputDir, 0o755); err != nil {
         return nil, fmt.Errorf("failed to create csv output directory: %w", err)
     }
 
-    return &CSVSink{
+    s := &CSVSink{
         outputDir: outputDir,
+        opts:      opts,
         files:     make(map[string]*csvFile),
-    }, nil
+        stop:      make(chan struct{}),
+    }
+    if opts.FlushInterval > 0 {
+        go s.flushLoop(opts.FlushInterval)
+    }
+    return s, nil
+}
+
+// flushLoop flushes pending rows every interval until Close.
+func (s *CSVSink) flushLoop(interval time.Duration) {
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-s.stop:
+            return
+        case <-ticker.C:
+            if err := s.Flush(); err != nil {
+                logrus.Warnf("csv flush failed: %v", err)
+            }
+        }
+    }
+}
+
+// Flush writes the buffered rows of every file to disk.
+func (s *CSVSink) Flush() error {
+    s.mu.Lock()
+    files := make([]*csvFile, 0, len(s.files))
+    for _, cf := range s.files {
+        files = append(files, cf)
+    }
+    s.mu.Unlock()
+
+    var errs []error
+    for _, cf := range files {
+        cf.mu.Lock()
+        errs = append(errs, cf.flushLocked())
+        cf.mu.Unlock()
+    }
+    return errors.Join(errs...)
+}
+
+// Close stops the interval flusher, flushes every file and closes it.
+func (s *CSVSink) Close() error {
+    var err error
+    s.closeOnce.Do(func() {
+        close(s.stop)
+        s.mu.Lock()
+        defer s.mu.Unlock()
+        var errs []error
+        for key, cf := range s.files {
+            cf.mu.Lock()
+            errs = append(errs, cf.flushLocked(), cf.file.Close())
+            cf.mu.Unlock()
+            delete(s.files, key)
+        }
+        err = errors.Join(errs...)
+    })
+    return err
+}
+
+// LastBlock scans every CSV file under the output directory and returns the
+// highest block_number found across them. Files without a block_number
+// column are ignored; rows still buffered by this sink are not seen.
+func (s *CSVSink) LastBlock() (uint64, bool, error) {
+    var last uint64
+    found := false
+    err := filepath.WalkDir(s.outputDir, func(path string, d fs.DirEntry, err error) error {
+        if err != nil || d.IsDir() || filepath.Ext(path) != ".csv" {
+            return err
+        }
+        block, ok, err := s.fileLastBlock(path)
+        if err != nil {
+            return err
+        }
+        if ok && (!found || block > last) {
+            last, found = block, true
+        }
+        return nil
+    })
+    if err != nil {
+        return 0, false, fmt.Errorf("failed to scan csv output: %w", err)
+    }
+    return last, found, nil
+}
+
+// fileLastBlock returns the highest block_number of one CSV file.
+func (s *CSVSink) fileLastBlock(path string) (uint64, bool, error) {
+    f, err := os.Open(path)
+    if err != nil {
+        return 0, false, err
+    }
+    defer f.Close()
+
+    r := csv.NewReader(f)
+    r.Comma = s.opts.Delimiter
+    r.FieldsPerRecord = -1
+    header, err := r.Read()
+    if err == io.EOF {
+        return 0, false, nil
+    }
+    if err != nil {
+        return 0, false, fmt.Errorf("%s: %w", path, err)
+    }
+    col := -1
+    for i, h := range header {
+        if h == "block_number" {
+            col = i
+            break
+        }
+    }
+    if col < 0 {
+        return 0, false, nil
+    }
+
+    var last uint64
+    found := false
+    for {
+        row, err := r.Read()
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            // A partial trailing row of an interrupted run is expected.
+            logrus.Warnf("stopped reading %s: %v", path, err)
+            break
+        }
+        if col >= len(row) {
+            continue
+        }
+        n, err := strconv.ParseUint(row[col], 10, 64)
+        if err != nil {
+            continue
+        }
+        if !found || n > last {
+            last, found = n, true
+        }
+    }
+    return last, found, nil
 }
 
 // Write appends the provided event as a CSV row. It lazily creates the file
 // associated with the event_name (or “unknown” when missing).
 func (s *CSVSink) Write(evt Event) error {
-    s.mu.Lock()
-    defer s.mu.Unlock()
+    key := s.path(evt)
+
+    cf, err := s.file(key, evt)
+    if err != nil {
+        return err
+    }
+
+    cf.mu.Lock()
+    defer cf.mu.Unlock()
+
+    // Prepare row following stored header order.
+    row := make([]string, len(cf.headers))
+    for i, key := range cf.headers {
+        if v, ok := evt[key]; ok {
+            row[i] = fmt.Sprint(v)
+        } else {
+            row[i] = ""
+        }
+    }
 
+    if err := cf.writer.Write(row); err != nil {
+        return err
+    }
+    cf.pending++
+    if s.opts.FlushRows > 0 && cf.pending >= s.opts.FlushRows ||
+        s.opts.FlushRows == 0 && s.opts.FlushInterval == 0 {
+        return cf.flushLocked()
+    }
+    return nil
+}
+
+// CSVKey returns the base name (without the .csv extension) of the file
+// holding the events of eventName emitted by contractName. Both names are
+// sanitised so the result is always a single path segment.
+func CSVKey(contractName, eventName string) string {
+    if eventName == BlockEventName {
+        return "blocks"
+    }
+    if eventName == TraceEventName {
+        return "traces"
+    }
+    return sanitizePathValue(contractName) + "_" + sanitizePathValue(eventName)
+}
+
+// path returns the file of evt relative to the output directory. Block and
+// trace records always go to blocks.csv and traces.csv.
+func (s *CSVSink) path(evt Event) string {
     // Defensive access to event_name so that even malformed events are stored.
     name, _ := evt["event_name"].(string)
     if name == "" {
         name = "unknown"
     }
-
     contractName, _ := evt["contract_name"].(string)
     if contractName == "" {
         contractName = "unknown"
     }
+    if s.opts.FileNameTemplate == "" || name == BlockEventName || name == TraceEventName {
+        return CSVKey(contractName, name) + ".csv"
+    }
+
+    values := map[string]string{
+        "contract": contractName,
+        "event":    name,
+        "address":  fmt.Sprint(evt["contract"]),
+        "chain":    fmt.Sprint(evt["chain"]),
+        "chain_id": fmt.Sprint(evt["chain_id"]),
+    }
+    return filepath.FromSlash(templateRe.ReplaceAllStringFunc(s.opts.FileNameTemplate, func(m string) string {
+        return sanitizePathValue(values[m[1:len(m)-1]])
+    }))
+}
+
+var templateRe = regexp.MustCompile(`\{[^{}]*\}`)
 
-    key := contractName + "_" + name
+// sanitizePathValue makes a template value safe to use as (part of) a single
+// path segment: separators and NUL become underscores and dot-only names are
+// replaced, so event data can never escape the output directory.
+func sanitizePathValue(v string) string {
+    if v == "" || v == "<nil>" {
+        return "unknown"
+    }
+    v = strings.Map(func(r rune) rune {
+        if r == '/' || r == '\\' || r == 0 {
+            return '_'
+        }
+        return r
+    }, v)
+    if strings.Trim(v, ".") == "" {
+        return strings.Repeat("_", len(v))
+    }
+    return v
+}
+
+// file returns the open file for key, creating it (and its header row from
+// evt) on first use.
+func (s *CSVSink) file(key string, evt Event) (*csvFile, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
 
     cf, ok := s.files[key]
     if !ok {
         // First time we see this event – prepare CSV file.
-        fp := filepath.Join(s.outputDir, fmt.Sprintf("%s.csv", key))
+        fp := filepath.Join(s.outputDir, key)
+        if err := os.MkdirAll(filepath.Dir(fp), 0o755); err != nil {
+            return nil, fmt.Errorf("failed to create csv directory for %s: %w", fp, err)
+        }
 
         // Determine whether file already exists (from a previous run).
         _, err := os.Stat(fp)
@@ -76,45 +386,66 @@ func (s *CSVSink) Write(evt Event) error {
         // Open file for append & read (read needed when file pre-exists to fetch headers).
         f, err := os.OpenFile(fp, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
         if err != nil {
-            return fmt.Errorf("failed to open csv file %s: %w", fp, err)
+            return nil, fmt.Errorf("failed to open csv file %s: %w", fp, err)
         }
 
-        w := csv.NewWriter(f)
+        w := newCSVRowWriter(f, s.opts)
 
-        headers := extractHeaders(evt)
+        // Rows appended to a file of a previous run follow its header, which
+        // may order (or name) the columns differently than evt would.
+        var headers []string
+        if exists {
+            headers, err = readCSVHeader(f, s.opts.Delimiter)
+            if err != nil {
+                f.Close()
+                return nil, fmt.Errorf("failed to read csv header of %s: %w", fp, err)
+            }
+            if missing := missingColumns(headers, evt); len(headers) > 0 && len(missing) > 0 {
+                logrus.Warnf("csv file %s has no column for %s; these fields are not written", fp, strings.Join(missing, ", "))
+            }
+        }
 
-        if !exists {
-            // New file – write header row immediately.
+        if len(headers) == 0 {
+            // New (or empty) file – write header row immediately.
+            headers = extractHeaders(evt)
             if err := w.Write(headers); err != nil {
                 f.Close()
-                return fmt.Errorf("failed to write csv header for %s: %w", fp, err)
+                return nil, fmt.Errorf("failed to write csv header for %s: %w", fp, err)
             }
             w.Flush()
             if err := w.Error(); err != nil {
                 f.Close()
-                return fmt.Errorf("failed to flush csv header for %s: %w", fp, err)
+                return nil, fmt.Errorf("failed to flush csv header for %s: %w", fp, err)
             }
         }
 
         cf = &csvFile{file: f, writer: w, headers: headers}
         s.files[key] = cf
     }
+    return cf, nil
+}
 
-    // Prepare row following stored header order.
-    row := make([]string, len(cf.headers))
-    for i, key := range cf.headers {
-        if v, ok := evt[key]; ok {
-            row[i] = fmt.Sprint(v)
-        } else {
-            row[i] = ""
-        }
+// readCSVHeader returns the first row of f, or nil when f is empty.
+func readCSVHeader(f *os.File, comma rune) ([]string, error) {
+    r := csv.NewReader(f)
+    r.Comma = comma
+    r.FieldsPerRecord = -1
+    headers, err := r.Read()
+    if errors.Is(err, io.EOF) {
+        return nil, nil
     }
+    return headers, err
+}
 
-    if err := cf.writer.Write(row); err != nil {
-        return err
+// missingColumns returns the sorted keys of evt absent from headers.
+func missingColumns(headers []string, evt Event) []string {
+    var missing []string
+    for _, k := range extractHeaders(evt) {
+        if !slices.Contains(headers, k) {
+            missing = append(missing, k)
+        }
     }
-    cf.writer.Flush()
-    return cf.writer.Error()
+    return missing
 }
 
 // extractHeaders returns a deterministic, alphabetically-sorted slice of map
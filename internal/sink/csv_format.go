@@ -0,0 +1,97 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/csv"
+	"io"
+	"unicode/utf8"
+)
+
+// csvRowWriter is the part of *csv.Writer used by the CSV sink.
+type csvRowWriter interface {
+    Write(record []string) error
+    Flush()
+    Error() error
+}
+
+// newCSVRowWriter returns a *csv.Writer, or a quotingWriter when every field
+// must be quoted.
+func newCSVRowWriter(w io.Writer, opts CSVOptions) csvRowWriter {
+    if opts.ForceQuote {
+        return &quotingWriter{w: bufio.NewWriter(w), comma: opts.Delimiter, useCRLF: opts.UseCRLF}
+    }
+    cw := csv.NewWriter(w)
+    cw.Comma = opts.Delimiter
+    cw.UseCRLF = opts.UseCRLF
+    return cw
+}
+
+// quotingWriter writes CSV records like csv.Writer, except that every field
+// is quoted, not only those that need it. encoding/csv offers no option for
+// that and some consumers rely on quotes to tell strings from numbers.
+type quotingWriter struct {
+    w       *bufio.Writer
+    comma   rune
+    useCRLF bool
+}
+
+// Write writes a single record, quoting every field and doubling the quotes
+// inside them. Line breaks within fields follow useCRLF as in csv.Writer.
+func (q *quotingWriter) Write(record []string) error {
+    for i, field := range record {
+        if i > 0 {
+            if _, err := q.w.WriteRune(q.comma); err != nil {
+                return err
+            }
+        }
+        if err := q.w.WriteByte('"'); err != nil {
+            return err
+        }
+        for len(field) > 0 {
+            r, size := utf8.DecodeRuneInString(field)
+            field = field[size:]
+            var err error
+            switch r {
+            case '"':
+                _, err = q.w.WriteString(`""`)
+            case '\r':
+                if !q.useCRLF {
+                    err = q.w.WriteByte('\r')
+                }
+            case '\n':
+                if q.useCRLF {
+                    _, err = q.w.WriteString("\r\n")
+                } else {
+                    err = q.w.WriteByte('\n')
+                }
+            default:
+                _, err = q.w.WriteRune(r)
+            }
+            if err != nil {
+                return err
+            }
+        }
+        if err := q.w.WriteByte('"'); err != nil {
+            return err
+        }
+    }
+    var err error
+    if q.useCRLF {
+        _, err = q.w.WriteString("\r\n")
+    } else {
+        err = q.w.WriteByte('\n')
+    }
+    return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer. Call Error to
+// check whether it failed.
+func (q *quotingWriter) Flush() {
+    q.w.Flush()
+}
+
+// Error reports any error that occurred during a previous Write or Flush.
+func (q *quotingWriter) Error() error {
+    _, err := q.w.Write(nil)
+    return err
+}
@@ -0,0 +1,524 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"etl-web3/internal/config"
+)
+
+// transferEvent returns a Transfer event of the Token contract in block.
+func transferEvent(block uint64) Event {
+    return Event{
+        "contract_name": "Token",
+        "event_name":    "Transfer",
+        "block_number":  block,
+        "tx_hash":       fmt.Sprintf("0x%064x", block),
+        "value":         "1",
+    }
+}
+
+// csvRows returns the rows of the CSV file at path as stored on disk.
+func csvRows(t *testing.T, path string) [][]string {
+    t.Helper()
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    rows, err := csv.NewReader(f).ReadAll()
+    if err != nil {
+        t.Fatalf("reading %s: %v", path, err)
+    }
+    return rows
+}
+
+func newTestCSVSink(t testing.TB, opts CSVOptions) (*CSVSink, string) {
+    dir := t.TempDir()
+    s, err := NewCSVSink(dir, opts)
+    if err != nil {
+        t.Fatalf("NewCSVSink: %v", err)
+    }
+    return s, dir
+}
+
+func TestCSVCloseFlushesBufferedRows(t *testing.T) {
+    s, dir := newTestCSVSink(t, CSVOptions{FlushRows: 1000})
+    for b := uint64(1); b <= 10; b++ {
+        if err := s.Write(transferEvent(b)); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    path := filepath.Join(dir, "Token_Transfer.csv")
+    if rows := csvRows(t, path); len(rows) != 1 {
+        t.Fatalf("%d rows on disk before Close, want the header only", len(rows))
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    if rows := csvRows(t, path); len(rows) != 11 {
+        t.Fatalf("%d rows on disk after Close, want the header and 10 events", len(rows))
+    }
+}
+
+func TestCSVFlushRows(t *testing.T) {
+    s, dir := newTestCSVSink(t, CSVOptions{FlushRows: 3})
+    defer s.Close()
+    path := filepath.Join(dir, "Token_Transfer.csv")
+    for b := uint64(1); b <= 2; b++ {
+        s.Write(transferEvent(b))
+    }
+    if rows := csvRows(t, path); len(rows) != 1 {
+        t.Fatalf("%d rows on disk after 2 writes, want the header only", len(rows))
+    }
+    s.Write(transferEvent(3))
+    if rows := csvRows(t, path); len(rows) != 4 {
+        t.Fatalf("%d rows on disk after 3 writes, want the header and 3 events", len(rows))
+    }
+}
+
+func TestCSVFlushInterval(t *testing.T) {
+    s, dir := newTestCSVSink(t, CSVOptions{FlushRows: 1000, FlushInterval: 10 * time.Millisecond})
+    defer s.Close()
+    s.Write(transferEvent(1))
+
+    path := filepath.Join(dir, "Token_Transfer.csv")
+    deadline := time.Now().Add(2 * time.Second)
+    for len(csvRows(t, path)) != 2 {
+        if time.Now().After(deadline) {
+            t.Fatal("buffered row not flushed by the interval")
+        }
+        time.Sleep(5 * time.Millisecond)
+    }
+}
+
+func TestCSVFlushesEveryRowByDefault(t *testing.T) {
+    s, dir := newTestCSVSink(t, CSVOptions{})
+    defer s.Close()
+    s.Write(transferEvent(1))
+    if rows := csvRows(t, filepath.Join(dir, "Token_Transfer.csv")); len(rows) != 2 {
+        t.Fatalf("%d rows on disk, want the header and the event", len(rows))
+    }
+}
+
+// seedCSV writes content to name under dir, as a prior run would have.
+func seedCSV(t *testing.T, dir, name, content string) {
+    t.Helper()
+    path := filepath.Join(dir, name)
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+}
+
+func TestCSVLastBlock(t *testing.T) {
+    cases := []struct {
+        name   string
+        files  map[string]string
+        opts   CSVOptions
+        want   uint64
+        wantOK bool
+    }{
+        {name: "no files"},
+        {
+            name:  "header only",
+            files: map[string]string{"Token_Transfer.csv": "block_number,tx_hash\n"},
+        },
+        {
+            name: "max over every event file",
+            files: map[string]string{
+                "Token_Transfer.csv": "block_number,tx_hash\n10,0xa\n42,0xb\n17,0xc\n",
+                "Token_Approval.csv": "tx_hash,block_number\n0xd,99\n0xe,5\n",
+                "Pool_Swap.csv":      "block_number,tx_hash\n7,0xf\n",
+            },
+            want: 99, wantOK: true,
+        },
+        {
+            name: "nested templated files",
+            files: map[string]string{
+                "Token/Transfer.csv": "block_number\n12\n",
+                "Pool/Swap.csv":      "block_number\n30\n",
+            },
+            want: 30, wantOK: true,
+        },
+        {
+            name:  "partial trailing row",
+            files: map[string]string{"Token_Transfer.csv": "block_number,tx_hash\n10,0xa\n11,\"0x"},
+            want:  10, wantOK: true,
+        },
+        {
+            name:  "unparsable values are skipped",
+            files: map[string]string{"Token_Transfer.csv": "block_number\nabc\n\n8\n"},
+            want:  8, wantOK: true,
+        },
+        {
+            name:  "files without block_number are ignored",
+            files: map[string]string{"Token_Transfer.csv": "tx_hash\n0xa\n", "notes.txt": "block_number\n500\n"},
+        },
+        {
+            name:  "custom delimiter",
+            files: map[string]string{"Token_Transfer.csv": "tx_hash;block_number\n0xa;64\n"},
+            opts:  CSVOptions{Delimiter: ';'},
+            want:  64, wantOK: true,
+        },
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            dir := t.TempDir()
+            for name, content := range tc.files {
+                seedCSV(t, dir, name, content)
+            }
+            s, err := NewCSVSink(dir, tc.opts)
+            if err != nil {
+                t.Fatalf("NewCSVSink: %v", err)
+            }
+            defer s.Close()
+            got, ok, err := s.LastBlock()
+            if err != nil {
+                t.Fatalf("LastBlock: %v", err)
+            }
+            if got != tc.want || ok != tc.wantOK {
+                t.Fatalf("LastBlock = %d, %v, want %d, %v", got, ok, tc.want, tc.wantOK)
+            }
+        })
+    }
+}
+
+func TestCSVLastBlockIncludesRowsWrittenSinceOpen(t *testing.T) {
+    dir := t.TempDir()
+    seedCSV(t, dir, "Token_Transfer.csv", "block_number\n20\n")
+    s, err := NewCSVSink(dir, CSVOptions{})
+    if err != nil {
+        t.Fatalf("NewCSVSink: %v", err)
+    }
+    defer s.Close()
+    s.Write(transferEvent(25))
+    if got, ok, err := s.LastBlock(); err != nil || !ok || got != 25 {
+        t.Fatalf("LastBlock = %d, %v, %v, want 25", got, ok, err)
+    }
+}
+
+// csvText writes records with newCSVRowWriter and returns the output.
+func csvText(t *testing.T, opts CSVOptions, records [][]string) string {
+    t.Helper()
+    var buf bytes.Buffer
+    w := newCSVRowWriter(&buf, opts)
+    for _, rec := range records {
+        if err := w.Write(rec); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    w.Flush()
+    if err := w.Error(); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+    return buf.String()
+}
+
+func TestCSVForceQuote(t *testing.T) {
+    records := [][]string{
+        {"block_number", "tx_hash", "memo"},
+        {"12", "0xabc", ""},
+        {"13", "0xdef", `say "hi", twice`},
+        {"14", "0x123", "two\nlines"},
+    }
+    cases := []struct {
+        name string
+        opts CSVOptions
+        want string
+    }{
+        {
+            name: "default",
+            opts: CSVOptions{Delimiter: ','},
+            want: "block_number,tx_hash,memo\n12,0xabc,\n13,0xdef,\"say \"\"hi\"\", twice\"\n14,0x123,\"two\nlines\"\n",
+        },
+        {
+            name: "force quote",
+            opts: CSVOptions{Delimiter: ',', ForceQuote: true},
+            want: `"block_number","tx_hash","memo"` + "\n" + `"12","0xabc",""` + "\n" + `"13","0xdef","say ""hi"", twice"` + "\n" + `"14","0x123","two` + "\n" + `lines"` + "\n",
+        },
+        {
+            name: "force quote crlf",
+            opts: CSVOptions{Delimiter: ';', ForceQuote: true, UseCRLF: true},
+            want: `"block_number";"tx_hash";"memo"` + "\r\n" + `"12";"0xabc";""` + "\r\n" + `"13";"0xdef";"say ""hi"", twice"` + "\r\n" + `"14";"0x123";"two` + "\r\n" + `lines"` + "\r\n",
+        },
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            got := csvText(t, tc.opts, records)
+            if got != tc.want {
+                t.Fatalf("output =\n%q\nwant\n%q", got, tc.want)
+            }
+            // Both read back as the same records.
+            r := csv.NewReader(strings.NewReader(got))
+            r.Comma = tc.opts.Delimiter
+            back, err := r.ReadAll()
+            if err != nil {
+                t.Fatalf("reading back: %v", err)
+            }
+            for i := range records {
+                if strings.Join(back[i], "|") != strings.Join(records[i], "|") {
+                    t.Errorf("record %d read back as %q, want %q", i, back[i], records[i])
+                }
+            }
+        })
+    }
+}
+
+func TestCSVSinkForceQuotesHeader(t *testing.T) {
+    s, dir := newTestCSVSink(t, CSVOptions{ForceQuote: true})
+    s.Write(transferEvent(7))
+    s.Close()
+    data, err := os.ReadFile(filepath.Join(dir, "Token_Transfer.csv"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    for i, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+        for _, field := range strings.Split(line, ",") {
+            if len(field) < 2 || field[0] != '"' || field[len(field)-1] != '"' {
+                t.Fatalf("line %d field %s is not quoted: %s", i, field, line)
+            }
+        }
+    }
+    if rows := csvRows(t, filepath.Join(dir, "Token_Transfer.csv")); len(rows) != 2 {
+        t.Fatalf("%d rows, want the header and the event", len(rows))
+    }
+}
+
+// BenchmarkCSVWrite compares flushing every row with batched flushes.
+func BenchmarkCSVWrite(b *testing.B) {
+    for _, bc := range []struct {
+        name string
+        opts CSVOptions
+    }{
+        {name: "every row"},
+        {name: "flush_rows=1000", opts: CSVOptions{FlushRows: 1000}},
+    } {
+        b.Run(bc.name, func(b *testing.B) {
+            s, _ := newTestCSVSink(b, bc.opts)
+            evt := transferEvent(1)
+            b.ReportAllocs()
+            b.ResetTimer()
+            for i := 0; i < b.N; i++ {
+                if err := s.Write(evt); err != nil {
+                    b.Fatal(err)
+                }
+            }
+            b.StopTimer()
+            s.Close()
+        })
+    }
+}
+
+func TestCSVAppendFollowsExistingHeader(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "Token_Transfer.csv")
+    // A previous run wrote the columns in another order, without tx_hash
+    // and with a column the new events lack.
+    existing := "value;block_number;note;event_name;contract_name\n1;1;old;Transfer;Token\n"
+    if err := os.WriteFile(path, []byte(existing), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    s, err := NewCSVSink(dir, CSVOptions{Delimiter: ';'})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Write(transferEvent(2)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := s.Close(); err != nil {
+        t.Fatal(err)
+    }
+
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := existing + "1;2;;Transfer;Token\n"; string(data) != want {
+        t.Fatalf("file =\n%s\nwant\n%s", data, want)
+    }
+}
+
+func TestCSVEmptyExistingFileGetsHeader(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "Token_Transfer.csv")
+    if err := os.WriteFile(path, nil, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    s, err := NewCSVSink(dir, CSVOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := s.Write(transferEvent(2)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    s.Close()
+    rows := csvRows(t, path)
+    if len(rows) != 2 || !slices.Equal(rows[0], extractHeaders(transferEvent(2))) {
+        t.Fatalf("rows = %v, want the header and one row", rows)
+    }
+}
+
+func TestCSVDelimiterAndLineEndings(t *testing.T) {
+    cases := []struct {
+        name string
+        cfg  config.StorageConfig
+        want string
+    }{
+        {name: "default", want: "block_number,contract_name,event_name,tx_hash,value\n7,Token,Transfer,0x07,\"1,5\"\n"},
+        {name: "semicolon", cfg: csvStorage(";", false, false), want: "block_number;contract_name;event_name;tx_hash;value\n7;Token;Transfer;0x07;1,5\n"},
+        {name: "tab and crlf", cfg: csvStorage("\t", true, false), want: "block_number\tcontract_name\tevent_name\ttx_hash\tvalue\r\n7\tToken\tTransfer\t0x07\t1,5\r\n"},
+        {name: "pipe, crlf, quoted", cfg: csvStorage("|", true, true), want: "\"block_number\"|\"contract_name\"|\"event_name\"|\"tx_hash\"|\"value\"\r\n\"7\"|\"Token\"|\"Transfer\"|\"0x07\"|\"1,5\"\r\n"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            tc.cfg.Type = "csv"
+            tc.cfg.CSV.OutputDir = t.TempDir()
+            s, err := Build(tc.cfg)
+            if err != nil {
+                t.Fatalf("Build: %v", err)
+            }
+            evt := transferEvent(7)
+            evt["tx_hash"], evt["value"] = "0x07", "1,5"
+            if err := s.Write(evt); err != nil {
+                t.Fatalf("Write: %v", err)
+            }
+            if err := Close(s); err != nil {
+                t.Fatalf("Close: %v", err)
+            }
+            data, err := os.ReadFile(filepath.Join(tc.cfg.CSV.OutputDir, "Token_Transfer.csv"))
+            if err != nil {
+                t.Fatal(err)
+            }
+            if string(data) != tc.want {
+                t.Errorf("file = %q, want %q", data, tc.want)
+            }
+        })
+    }
+
+    for _, delim := range []string{"ab", "\"", "\n"} {
+        if _, err := Build(csvStorage(delim, false, false)); err == nil {
+            t.Errorf("Build with delimiter %q succeeded", delim)
+        }
+    }
+}
+
+// csvStorage returns a csv storage config with the given format options.
+func csvStorage(delimiter string, crlf, quote bool) config.StorageConfig {
+    var cfg config.StorageConfig
+    cfg.Type = "csv"
+    cfg.CSV.Delimiter, cfg.CSV.UseCRLF, cfg.CSV.ForceQuote = delimiter, crlf, quote
+    return cfg
+}
+
+// TestCSVConcurrentEventFiles writes several event files from concurrent
+// goroutines, some sharing a file, while flushes run. Run it with -race.
+func TestCSVConcurrentEventFiles(t *testing.T) {
+    s, dir := newTestCSVSink(t, CSVOptions{FlushRows: 7, FlushInterval: time.Millisecond})
+    events := []string{"Transfer", "Approval", "Swap", "Sync"}
+    const writers, rows = 3, 200
+
+    var wg sync.WaitGroup
+    errs := make(chan error, len(events)*writers+1)
+    for _, name := range events {
+        for w := 0; w < writers; w++ {
+            wg.Add(1)
+            go func(name string, w int) {
+                defer wg.Done()
+                for i := 0; i < rows; i++ {
+                    evt := transferEvent(uint64(w*rows + i))
+                    evt["event_name"] = name
+                    if err := s.Write(evt); err != nil {
+                        errs <- err
+                        return
+                    }
+                }
+            }(name, w)
+        }
+    }
+    wg.Add(1)
+    go func() {
+        defer wg.Done()
+        for i := 0; i < 20; i++ {
+            if err := s.Flush(); err != nil {
+                errs <- err
+                return
+            }
+            if _, _, err := s.LastBlock(); err != nil {
+                errs <- err
+                return
+            }
+        }
+    }()
+    wg.Wait()
+    close(errs)
+    for err := range errs {
+        t.Fatal(err)
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    for _, name := range events {
+        got := csvRows(t, filepath.Join(dir, "Token_"+name+".csv"))
+        if len(got) != 1+writers*rows {
+            t.Fatalf("%s: %d rows, want a header and %d rows", name, len(got), writers*rows)
+        }
+        seen := make(map[string]bool)
+        for _, row := range got[1:] {
+            if len(row) != len(got[0]) || row[2] != name || seen[row[0]] {
+                t.Fatalf("%s: bad or repeated row %q", name, row)
+            }
+            seen[row[0]] = true
+        }
+    }
+}
+
+func TestCSVFileNameTemplate(t *testing.T) {
+    tmpl := "{chain}/{contract}/{event}_{address}.csv"
+    cases := []struct {
+        name   string
+        fields Event
+        want   string
+    }{
+        {name: "plain", fields: Event{"chain": "mainnet", "contract": "0xA1"}, want: "mainnet/Token/Transfer_0xA1.csv"},
+        {name: "missing values", want: "unknown/Token/Transfer_unknown.csv"},
+        {name: "separators", fields: Event{"chain": "a/b", "contract_name": `..\..\etc`}, want: "a_b/.._.._etc/Transfer_unknown.csv"},
+        {name: "parent directory", fields: Event{"chain": "..", "contract_name": "..", "event_name": "."}, want: "__/__/__unknown.csv"},
+        {name: "absolute", fields: Event{"chain": "/etc", "contract_name": "/", "event_name": "passwd\x00"}, want: "_etc/_/passwd__unknown.csv"},
+        {name: "block records keep their file", fields: Event{"event_name": BlockEventName, "chain": "mainnet"}, want: "blocks.csv"},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            s, dir := newTestCSVSink(t, CSVOptions{FileNameTemplate: tmpl})
+            evt := transferEvent(7)
+            for k, v := range tc.fields {
+                evt[k] = v
+            }
+            if got := s.path(evt); got != filepath.FromSlash(tc.want) {
+                t.Errorf("path = %q, want %q", got, tc.want)
+            }
+            if err := s.Write(evt); err != nil {
+                t.Fatalf("Write: %v", err)
+            }
+            s.Close()
+            if _, err := os.Stat(filepath.Join(dir, filepath.FromSlash(tc.want))); err != nil {
+                t.Errorf("file not written inside the output directory: %v", err)
+            }
+            // Nothing lands next to the output directory.
+            if entries, _ := os.ReadDir(filepath.Dir(dir)); len(entries) != 1 {
+                t.Errorf("parent of the output directory holds %d entries", len(entries))
+            }
+        })
+    }
+}
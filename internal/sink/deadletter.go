@@ -0,0 +1,142 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DeadLetterSink decorates a Sink so that events it still fails to write
+// (typically after a RetrySink gave up) are recorded in a JSON-lines file,
+// together with the error, instead of failing the run. Each line is a
+// DeadLetter. Once maxEvents events were dead-lettered further failures are
+// returned again, so a sink that is down altogether still stops the run.
+type DeadLetterSink struct {
+    inner     Sink
+    maxEvents int
+
+    mu    sync.Mutex
+    file  *os.File
+    count int
+}
+
+// DeadLetter is one record of the dead-letter file.
+type DeadLetter struct {
+    Event    Event     `json:"event"`
+    Error    string    `json:"error"`
+    FailedAt time.Time `json:"failed_at"`
+}
+
+// NewDeadLetterSink wraps inner, appending failed events to path. A
+// maxEvents of 0 means no limit. inner must not be nil.
+func NewDeadLetterSink(inner Sink, path string, maxEvents int) (*DeadLetterSink, error) {
+    if inner == nil {
+        return nil, fmt.Errorf("dead-letter file %s configured without a sink to wrap", path)
+    }
+    if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+        return nil, fmt.Errorf("failed to create dead-letter directory: %w", err)
+    }
+    f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return nil, fmt.Errorf("failed to open dead-letter file %s: %w", path, err)
+    }
+    return &DeadLetterSink{inner: inner, maxEvents: maxEvents, file: f}, nil
+}
+
+// WithDeadLetter wraps sk in a DeadLetterSink when the storage config sets a
+// dead_letter path and returns sk unchanged otherwise.
+func WithDeadLetter(sk Sink, cfg config.StorageConfig) (Sink, error) {
+    if cfg.DeadLetter.Path == "" {
+        return sk, nil
+    }
+    return NewDeadLetterSink(sk, cfg.DeadLetter.Path, cfg.DeadLetter.MaxEvents)
+}
+
+// Write forwards the event and dead-letters it if the inner sink fails. When
+// a batching sink reports a RejectedError, the rejected events are
+// dead-lettered instead.
+func (d *DeadLetterSink) Write(evt Event) error {
+    err := d.inner.Write(evt)
+    if err == nil {
+        return nil
+    }
+    var rej *RejectedError
+    if errors.As(err, &rej) {
+        return d.record(rej.Events, rej.Err)
+    }
+    return d.record([]Event{evt}, err)
+}
+
+// record appends events to the dead-letter file with err, or returns err
+// once maxEvents is reached.
+func (d *DeadLetterSink) record(events []Event, err error) error {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    for _, evt := range events {
+        if d.maxEvents > 0 && d.count >= d.maxEvents {
+            return fmt.Errorf("dead-letter limit of %d events reached: %w", d.maxEvents, err)
+        }
+        line, merr := json.Marshal(DeadLetter{Event: evt, Error: err.Error(), FailedAt: time.Now().UTC()})
+        if merr != nil {
+            return fmt.Errorf("%w (dead-letter encoding failed: %v)", err, merr)
+        }
+        if _, werr := d.file.Write(append(line, '\n')); werr != nil {
+            return fmt.Errorf("%w (dead-letter write failed: %v)", err, werr)
+        }
+        d.count++
+        logrus.Warnf("event %v of tx %v dead-lettered: %v", evt["event_name"], evt["tx_hash"], err)
+    }
+    return nil
+}
+
+// Remove retracts the event from the inner sink (see sink.Remove). Failed
+// removals are not dead-lettered.
+func (d *DeadLetterSink) Remove(evt Event) error {
+    return Remove(d.inner, evt)
+}
+
+// Unwrap returns the wrapped sink.
+func (d *DeadLetterSink) Unwrap() Sink {
+    return d.inner
+}
+
+// Count returns the number of events dead-lettered so far.
+func (d *DeadLetterSink) Count() int {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    return d.count
+}
+
+// Flush flushes the wrapped sink (see sink.Flush), dead-lettering the events
+// of a RejectedError. Dead letters are not buffered.
+func (d *DeadLetterSink) Flush() error {
+    err := Flush(d.inner)
+    var rej *RejectedError
+    if errors.As(err, &rej) {
+        return d.record(rej.Events, rej.Err)
+    }
+    return err
+}
+
+// Close flushes the wrapped sink, so events it rejects are still
+// dead-lettered, then closes the dead-letter file and the wrapped sink (see
+// sink.Close).
+func (d *DeadLetterSink) Close() error {
+    return errors.Join(d.Flush(), d.CloseFile(), Close(d.inner))
+}
+
+// CloseFile closes only the dead-letter file, for callers that do not own
+// the wrapped sink.
+func (d *DeadLetterSink) CloseFile() error {
+    d.mu.Lock()
+    defer d.mu.Unlock()
+    return d.file.Close()
+}
@@ -0,0 +1,73 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"etl-web3/internal/config"
+)
+
+// failingSink fails every write with err.
+type failingSink struct{ err error }
+
+func (f failingSink) Write(Event) error { return f.err }
+
+func TestDeadLetterSinkRecordsFailedEvents(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "dlq", "failed.jsonl")
+    dl, err := NewDeadLetterSink(failingSink{errors.New("boom")}, path, 0)
+    if err != nil {
+        t.Fatalf("NewDeadLetterSink: %v", err)
+    }
+    if err := dl.Write(Event{"event_name": "Transfer", "block_number": uint64(7)}); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := dl.CloseFile(); err != nil {
+        t.Fatalf("CloseFile: %v", err)
+    }
+    if dl.Count() != 1 {
+        t.Errorf("Count = %d, want 1", dl.Count())
+    }
+
+    f, err := os.Open(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    sc := bufio.NewScanner(f)
+    if !sc.Scan() {
+        t.Fatal("dead-letter file is empty")
+    }
+    var rec DeadLetter
+    if err := json.Unmarshal(sc.Bytes(), &rec); err != nil {
+        t.Fatalf("decoding %q: %v", sc.Text(), err)
+    }
+    if rec.Error != "boom" || rec.Event["event_name"] != "Transfer" {
+        t.Errorf("record = %+v", rec)
+    }
+}
+
+func TestDeadLetterSinkLimit(t *testing.T) {
+    dl, err := NewDeadLetterSink(failingSink{errors.New("boom")}, filepath.Join(t.TempDir(), "failed.jsonl"), 1)
+    if err != nil {
+        t.Fatalf("NewDeadLetterSink: %v", err)
+    }
+    defer dl.CloseFile()
+    if err := dl.Write(Event{"n": 1}); err != nil {
+        t.Fatalf("first Write: %v", err)
+    }
+    if err := dl.Write(Event{"n": 2}); err == nil {
+        t.Fatal("second Write succeeded past max_events")
+    }
+}
+
+func TestWithDeadLetterRejectsNilSink(t *testing.T) {
+    var cfg config.StorageConfig
+    cfg.DeadLetter.Path = filepath.Join(t.TempDir(), "failed.jsonl")
+    if _, err := WithDeadLetter(NewRetrySink(nil, 3, 1), cfg); err == nil {
+        t.Fatal("WithDeadLetter accepted a nil sink")
+    }
+}
@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Permanent marks err as a write failure that retrying cannot fix, such as
+// a value the storage schema rejects. RetrySink returns such errors without
+// further attempts, so they fail the run, or reach the dead-letter file, at
+// once. Sinks mark errors they know to be permanent; anything else is
+// treated as transient.
+func Permanent(err error) error {
+    if err == nil {
+        return nil
+    }
+    return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err, or an error it wraps, was marked by
+// Permanent.
+func IsPermanent(err error) bool {
+    var p *permanentError
+    return errors.As(err, &p)
+}
+
+type permanentError struct {
+    err error
+}
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// RejectedError reports events a batching sink found it cannot store while
+// sending a batch. They may be other events than the one whose Write (or
+// the Flush) returned the error; DeadLetterSink records these events.
+type RejectedError struct {
+    Events []Event
+    Err    error
+}
+
+func (e *RejectedError) Error() string {
+    return fmt.Sprintf("%d event(s) rejected: %v", len(e.Events), e.Err)
+}
+
+func (e *RejectedError) Unwrap() error { return e.Err }
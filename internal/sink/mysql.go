@@ -1,3 +0,0 @@
-package sink
-
-// TODO: Implement MySQL sink for persisting events. 
\ No newline at end of file
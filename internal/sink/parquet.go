@@ -0,0 +1,395 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"etl-web3/internal/config"
+)
+
+func init() {
+    Register("parquet", func(cfg config.StorageConfig) (Sink, error) {
+        return NewParquetSink(cfg.Parquet.OutputDir, ParquetOptions{
+            RowGroupSize: cfg.Parquet.RowGroupSize,
+            MaxFileBytes: int64(cfg.Parquet.MaxFileMB) << 20,
+            Compression:  cfg.Parquet.Compression,
+        })
+    })
+    Describe("parquet",
+        Field{Name: "parquet.output_dir", Type: "string", Required: true, Description: "Directory the Parquet files are written to"},
+        Field{Name: "parquet.row_group_size", Type: "int", Description: "Rows per row group (default 10000)"},
+        Field{Name: "parquet.max_file_mb", Type: "int", Description: "Roll over to a new part file past this size (default 256)"},
+        Field{Name: "parquet.compression", Type: "string", Description: "\"gzip\" (default) or \"none\""},
+    )
+}
+
+// Defaults applied when the corresponding ParquetOptions field is zero.
+const (
+    DefaultParquetRowGroupSize       = 10_000
+    DefaultParquetMaxFileBytes int64 = 256 << 20
+)
+
+// ParquetOptions tunes the files written by ParquetSink.
+type ParquetOptions struct {
+    // RowGroupSize is the number of rows buffered in memory per file before a
+    // row group is flushed.
+    RowGroupSize int
+    // MaxFileBytes rolls over to a new part file once a file grows past it.
+    MaxFileBytes int64
+    // Compression is "gzip" (the default) or "none".
+    Compression string
+}
+
+// ParquetSink writes decoded events into Parquet files for data-lake
+// ingestion, one "<contractName>_<eventName>-NNNNN.parquet" series per event
+// type (blocks go to "blocks-NNNNN.parquet"). The schema is derived from the
+// first event of each type: booleans, integers and floats keep their type and
+// every other value is stored as a UTF-8 string. All columns are nullable;
+// keys missing from the schema are ignored, like the CSV header.
+//
+// Rows are buffered and written in row groups; a file only becomes readable
+// once its footer is written, on rollover or Close. New part numbers continue
+// after the ones already present so earlier runs are never overwritten.
+type ParquetSink struct {
+    outputDir string
+    opts      ParquetOptions
+    codec     int32
+
+    mu    sync.Mutex
+    files map[string]*parquetFile
+}
+
+// parquetFile is the part file currently written for one event type.
+type parquetFile struct {
+    mu      sync.Mutex // serialises rows of this event type only
+    key     string
+    columns []parquetColumn
+    part    int
+
+    file   parquetOutput
+    size   int64 // bytes of complete row groups written to file so far
+    groups []parquetRowGroup
+    rows   [][]interface{} // buffered rows, one value per column
+}
+
+// parquetOutput is the part file being written, an *os.File.
+type parquetOutput interface {
+    io.WriteCloser
+    io.Seeker
+    Truncate(size int64) error
+}
+
+// NewParquetSink initialises a sink writing Parquet files under outputDir,
+// creating the directory if needed.
+func NewParquetSink(outputDir string, opts ParquetOptions) (*ParquetSink, error) {
+    if opts.RowGroupSize <= 0 {
+        opts.RowGroupSize = DefaultParquetRowGroupSize
+    }
+    if opts.MaxFileBytes <= 0 {
+        opts.MaxFileBytes = DefaultParquetMaxFileBytes
+    }
+    codec, err := parquetCodec(opts.Compression)
+    if err != nil {
+        return nil, err
+    }
+    if err := os.MkdirAll(outputDir, 0o755); err != nil {
+        return nil, fmt.Errorf("failed to create parquet output directory: %w", err)
+    }
+
+    return &ParquetSink{
+        outputDir: outputDir,
+        opts:      opts,
+        codec:     codec,
+        files:     make(map[string]*parquetFile),
+    }, nil
+}
+
+// parquetCodec maps the compression setting to its Parquet codec.
+func parquetCodec(compression string) (int32, error) {
+    switch compression {
+    case "", "gzip":
+        return parquetGzip, nil
+    case "none":
+        return parquetUncompressed, nil
+    default:
+        return 0, fmt.Errorf("unsupported parquet compression %q (expected gzip or none)", compression)
+    }
+}
+
+// Write buffers the event as a row of its event type, flushing a row group
+// when RowGroupSize rows are pending.
+func (s *ParquetSink) Write(evt Event) error {
+    name, _ := evt["event_name"].(string)
+    if name == "" {
+        name = "unknown"
+    }
+    contractName, _ := evt["contract_name"].(string)
+    if contractName == "" {
+        contractName = "unknown"
+    }
+
+    pf := s.file(CSVKey(contractName, name), evt)
+
+    pf.mu.Lock()
+    defer pf.mu.Unlock()
+
+    row := make([]interface{}, len(pf.columns))
+    for i, col := range pf.columns {
+        row[i] = parquetValue(col.typ, evt[col.name])
+    }
+    pf.rows = append(pf.rows, row)
+
+    if len(pf.rows) >= s.opts.RowGroupSize {
+        if err := s.flush(pf); err != nil {
+            // The event is reported as failed, so it must not stay buffered
+            // as well: a retry would add it twice.
+            pf.rows = pf.rows[:len(pf.rows)-1]
+            return err
+        }
+    }
+    return nil
+}
+
+// Close flushes every pending row group and writes the file footers.
+func (s *ParquetSink) Close() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    var errs []error
+    for _, pf := range s.files {
+        pf.mu.Lock()
+        err := s.flush(pf)
+        if err == nil {
+            err = s.closeFile(pf)
+        }
+        pf.mu.Unlock()
+        if err != nil {
+            errs = append(errs, fmt.Errorf("%s: %w", pf.key, err))
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// file returns the state of key, deriving its schema from evt on first use.
+func (s *ParquetSink) file(key string, evt Event) *parquetFile {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    pf, ok := s.files[key]
+    if !ok {
+        pf = &parquetFile{key: key, columns: parquetSchema(evt), part: s.nextPart(key)}
+        s.files[key] = pf
+    }
+    return pf
+}
+
+// nextPart returns the first part number of key not used by an existing file.
+func (s *ParquetSink) nextPart(key string) int {
+    entries, _ := os.ReadDir(s.outputDir)
+    next := 0
+    for _, e := range entries {
+        rest, ok := strings.CutPrefix(e.Name(), key+"-")
+        if !ok {
+            continue
+        }
+        if n, err := strconv.Atoi(strings.TrimSuffix(rest, ".parquet")); err == nil && n >= next {
+            next = n + 1
+        }
+    }
+    return next
+}
+
+// flush writes the buffered rows of pf as a row group, opening the part file
+// if needed and rolling over once it exceeds MaxFileBytes. The row group is
+// written at once and only recorded for the footer once complete; a failed
+// write is cut off the file and the rows stay buffered. pf.mu must be held.
+func (s *ParquetSink) flush(pf *parquetFile) error {
+    if len(pf.rows) == 0 {
+        return nil
+    }
+
+    if pf.file == nil {
+        fp := filepath.Join(s.outputDir, fmt.Sprintf("%s-%05d.parquet", pf.key, pf.part))
+        f, err := os.OpenFile(fp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+        if err != nil {
+            return fmt.Errorf("failed to open parquet file %s: %w", fp, err)
+        }
+        if _, err := f.WriteString(parquetMagic); err != nil {
+            f.Close()
+            return err
+        }
+        pf.file, pf.size, pf.groups = f, int64(len(parquetMagic)), nil
+    }
+
+    group := parquetRowGroup{numRows: int64(len(pf.rows))}
+    var buf bytes.Buffer
+    offset := pf.size
+    values := make([]interface{}, len(pf.rows))
+    for c, col := range pf.columns {
+        for r, row := range pf.rows {
+            values[r] = row[c]
+        }
+        page := append(encodeDefinitionLevels(values), encodePlain(col.typ, values)...)
+        body, err := s.compress(page)
+        if err != nil {
+            return err
+        }
+        header := encodePageHeader(len(values), len(page), len(body))
+
+        chunk := parquetChunk{
+            offset:           offset,
+            numValues:        int64(len(values)),
+            uncompressedSize: int64(len(header) + len(page)),
+            compressedSize:   int64(len(header) + len(body)),
+        }
+        buf.Write(header)
+        buf.Write(body)
+        offset += chunk.compressedSize
+        group.totalSize += chunk.uncompressedSize
+        group.chunks = append(group.chunks, chunk)
+    }
+    if _, err := pf.file.Write(buf.Bytes()); err != nil {
+        return s.rollback(pf, fmt.Errorf("failed to write parquet row group: %w", err))
+    }
+    pf.size = offset
+    pf.groups = append(pf.groups, group)
+    pf.rows = pf.rows[:0]
+
+    if pf.size >= s.opts.MaxFileBytes {
+        return s.closeFile(pf)
+    }
+    return nil
+}
+
+// rollback cuts a partially written row group off the part file so the
+// footer only ever points at complete ones. When that fails too the part
+// file is abandoned: it is closed without a footer and the next flush starts
+// a new part. pf.mu must be held.
+func (s *ParquetSink) rollback(pf *parquetFile, err error) error {
+    if _, serr := pf.file.Seek(pf.size, io.SeekStart); serr != nil {
+        return s.abandon(pf, err, serr)
+    }
+    if terr := pf.file.Truncate(pf.size); terr != nil {
+        return s.abandon(pf, err, terr)
+    }
+    return err
+}
+
+// abandon closes the part file of pf after a failed rollback.
+func (s *ParquetSink) abandon(pf *parquetFile, err, rerr error) error {
+    lost, part := len(pf.groups), pf.part
+    pf.file.Close()
+    pf.file, pf.groups = nil, nil
+    pf.part++
+    return fmt.Errorf("%w (rollback failed, %d row group(s) of part %d lost: %v)", err, lost, part, rerr)
+}
+
+// closeFile writes the footer of the current part file and moves on to the
+// next part number. pf.mu must be held.
+func (s *ParquetSink) closeFile(pf *parquetFile) error {
+    if pf.file == nil {
+        return nil
+    }
+    meta := encodeFileMetaData(pf.columns, pf.groups, s.codec)
+    footer := binary.LittleEndian.AppendUint32(meta, uint32(len(meta)))
+    footer = append(footer, parquetMagic...)
+    _, err := pf.file.Write(footer)
+    if cerr := pf.file.Close(); err == nil {
+        err = cerr
+    }
+    pf.file, pf.groups = nil, nil
+    pf.part++
+    return err
+}
+
+func (s *ParquetSink) compress(page []byte) ([]byte, error) {
+    if s.codec == parquetUncompressed {
+        return page, nil
+    }
+    var buf bytes.Buffer
+    zw := gzip.NewWriter(&buf)
+    if _, err := zw.Write(page); err != nil {
+        return nil, err
+    }
+    if err := zw.Close(); err != nil {
+        return nil, err
+    }
+    return buf.Bytes(), nil
+}
+
+// parquetSchema derives the columns (sorted by name, like CSV headers) from
+// an event.
+func parquetSchema(evt Event) []parquetColumn {
+    cols := make([]parquetColumn, 0, len(evt))
+    for _, k := range extractHeaders(evt) {
+        col := parquetColumn{name: k, typ: parquetByteArray, converted: parquetUTF8}
+        switch evt[k].(type) {
+        case bool:
+            col.typ, col.converted = parquetBoolean, -1
+        case int, int8, int16, int32, int64:
+            col.typ, col.converted = parquetInt64, -1
+        case uint, uint8, uint16, uint32, uint64:
+            col.typ, col.converted = parquetInt64, parquetUint64
+        case float32, float64:
+            col.typ, col.converted = parquetDouble, -1
+        }
+        cols = append(cols, col)
+    }
+    return cols
+}
+
+// parquetValue converts v to the Go type encoded for a column of typ. Values
+// that do not fit the column type are stored as null.
+func parquetValue(typ int32, v interface{}) interface{} {
+    if v == nil {
+        return nil
+    }
+    switch typ {
+    case parquetBoolean:
+        if b, ok := v.(bool); ok {
+            return b
+        }
+    case parquetInt64:
+        switch n := v.(type) {
+        case int:
+            return int64(n)
+        case int8:
+            return int64(n)
+        case int16:
+            return int64(n)
+        case int32:
+            return int64(n)
+        case int64:
+            return n
+        case uint:
+            return int64(n)
+        case uint8:
+            return int64(n)
+        case uint16:
+            return int64(n)
+        case uint32:
+            return int64(n)
+        case uint64:
+            return int64(n) // UINT_64 columns reinterpret the bits
+        }
+    case parquetDouble:
+        switch f := v.(type) {
+        case float32:
+            return float64(f)
+        case float64:
+            return f
+        }
+    default:
+        return fmt.Sprint(v)
+    }
+    return nil
+}
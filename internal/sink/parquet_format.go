@@ -0,0 +1,278 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// Minimal Parquet encoding: flat schemas of OPTIONAL columns, one PLAIN data
+// page (v1) per column chunk, RLE definition levels and a Thrift compact
+// protocol footer. See https://github.com/apache/parquet-format.
+
+// parquetMagic starts and ends every Parquet file.
+const parquetMagic = "PAR1"
+
+// Physical types.
+const (
+    parquetBoolean   int32 = 0
+    parquetInt64     int32 = 2
+    parquetDouble    int32 = 5
+    parquetByteArray int32 = 6
+)
+
+// Converted (logical) types.
+const (
+    parquetUTF8   int32 = 0
+    parquetUint64 int32 = 14
+)
+
+// Compression codecs.
+const (
+    parquetUncompressed int32 = 0
+    parquetGzip         int32 = 2
+)
+
+const (
+    parquetOptional  int32 = 1
+    parquetDataPage  int32 = 0
+    parquetPlain     int32 = 0
+    parquetRLE       int32 = 3
+)
+
+// parquetColumn is a leaf of the flat schema.
+type parquetColumn struct {
+    name      string
+    typ       int32
+    converted int32 // -1 when none
+}
+
+// parquetChunk describes a written column chunk for the footer.
+type parquetChunk struct {
+    offset           int64
+    numValues        int64
+    uncompressedSize int64
+    compressedSize   int64
+}
+
+// parquetRowGroup describes a written row group for the footer.
+type parquetRowGroup struct {
+    numRows   int64
+    totalSize int64
+    chunks    []parquetChunk
+}
+
+// encodePlain encodes the non-null values of a column chunk. values holds
+// bool, int64, float64 or string entries matching col.typ; nils are skipped.
+func encodePlain(typ int32, values []interface{}) []byte {
+    var buf bytes.Buffer
+    var bits byte
+    var nbits uint
+    for _, v := range values {
+        if v == nil {
+            continue
+        }
+        switch typ {
+        case parquetBoolean:
+            if v.(bool) {
+                bits |= 1 << nbits
+            }
+            if nbits++; nbits == 8 {
+                buf.WriteByte(bits)
+                bits, nbits = 0, 0
+            }
+        case parquetInt64:
+            binary.Write(&buf, binary.LittleEndian, v.(int64))
+        case parquetDouble:
+            binary.Write(&buf, binary.LittleEndian, math.Float64bits(v.(float64)))
+        default:
+            s := v.(string)
+            binary.Write(&buf, binary.LittleEndian, uint32(len(s)))
+            buf.WriteString(s)
+        }
+    }
+    if nbits > 0 {
+        buf.WriteByte(bits)
+    }
+    return buf.Bytes()
+}
+
+// encodeDefinitionLevels writes the RLE-encoded definition levels (1 for a
+// value, 0 for null) prefixed by their byte length, as data page v1 expects.
+func encodeDefinitionLevels(values []interface{}) []byte {
+    var rle []byte
+    for i := 0; i < len(values); {
+        j := i
+        for j < len(values) && (values[j] == nil) == (values[i] == nil) {
+            j++
+        }
+        rle = binary.AppendUvarint(rle, uint64(j-i)<<1)
+        if values[i] == nil {
+            rle = append(rle, 0)
+        } else {
+            rle = append(rle, 1)
+        }
+        i = j
+    }
+    out := binary.LittleEndian.AppendUint32(nil, uint32(len(rle)))
+    return append(out, rle...)
+}
+
+// encodePageHeader returns the PageHeader of a v1 data page.
+func encodePageHeader(numValues, uncompressed, compressed int) []byte {
+    var w thriftWriter
+    w.i32(1, parquetDataPage)
+    w.i32(2, int32(uncompressed))
+    w.i32(3, int32(compressed))
+    w.beginStruct(5) // DataPageHeader
+    w.i32(1, int32(numValues))
+    w.i32(2, parquetPlain)
+    w.i32(3, parquetRLE)
+    w.i32(4, parquetRLE)
+    w.endStruct()
+    w.stop()
+    return w.buf.Bytes()
+}
+
+// encodeFileMetaData returns the Thrift-encoded footer of a file.
+func encodeFileMetaData(columns []parquetColumn, groups []parquetRowGroup, codec int32) []byte {
+    var numRows int64
+    for _, g := range groups {
+        numRows += g.numRows
+    }
+
+    var w thriftWriter
+    w.i32(1, 1) // version
+    w.beginList(2, thriftStruct, len(columns)+1)
+    w.beginElem() // root
+    w.str(4, "schema")
+    w.i32(5, int32(len(columns)))
+    w.endStruct()
+    for _, c := range columns {
+        w.beginElem()
+        w.i32(1, c.typ)
+        w.i32(3, parquetOptional)
+        w.str(4, c.name)
+        if c.converted >= 0 {
+            w.i32(6, c.converted)
+        }
+        w.endStruct()
+    }
+    w.i64(3, numRows)
+    w.beginList(4, thriftStruct, len(groups))
+    for _, g := range groups {
+        w.beginElem()
+        w.beginList(1, thriftStruct, len(g.chunks))
+        for i, ch := range g.chunks {
+            w.beginElem() // ColumnChunk
+            w.i64(2, ch.offset)
+            w.beginStruct(3) // ColumnMetaData
+            w.i32(1, columns[i].typ)
+            w.beginList(2, thriftI32, 2)
+            w.elemI32(parquetPlain)
+            w.elemI32(parquetRLE)
+            w.beginList(3, thriftBinary, 1)
+            w.elemStr(columns[i].name)
+            w.i32(4, codec)
+            w.i64(5, ch.numValues)
+            w.i64(6, ch.uncompressedSize)
+            w.i64(7, ch.compressedSize)
+            w.i64(9, ch.offset)
+            w.endStruct()
+            w.endStruct()
+        }
+        w.i64(2, g.totalSize)
+        w.i64(3, g.numRows)
+        w.endStruct()
+    }
+    w.str(6, "etl-web3")
+    w.stop()
+    return w.buf.Bytes()
+}
+
+// Thrift compact protocol type IDs.
+const (
+    thriftI32    byte = 5
+    thriftI64    byte = 6
+    thriftBinary byte = 8
+    thriftList   byte = 9
+    thriftStruct byte = 12
+)
+
+// thriftWriter encodes structs with the Thrift compact protocol, which is
+// all Parquet metadata needs.
+type thriftWriter struct {
+    buf    bytes.Buffer
+    lastID int16
+    stack  []int16
+}
+
+func (w *thriftWriter) field(id int16, typ byte) {
+    if delta := id - w.lastID; delta > 0 && delta <= 15 {
+        w.buf.WriteByte(byte(delta)<<4 | typ)
+    } else {
+        w.buf.WriteByte(typ)
+        w.varint(int64(id))
+    }
+    w.lastID = id
+}
+
+func (w *thriftWriter) varint(v int64) {
+    w.buf.Write(binary.AppendUvarint(nil, uint64((v<<1)^(v>>63))))
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+    w.field(id, thriftI32)
+    w.varint(int64(v))
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+    w.field(id, thriftI64)
+    w.varint(v)
+}
+
+func (w *thriftWriter) str(id int16, s string) {
+    w.field(id, thriftBinary)
+    w.elemStr(s)
+}
+
+func (w *thriftWriter) beginStruct(id int16) {
+    w.field(id, thriftStruct)
+    w.beginElem()
+}
+
+// beginElem starts a struct that is a list element (no field header).
+func (w *thriftWriter) beginElem() {
+    w.stack = append(w.stack, w.lastID)
+    w.lastID = 0
+}
+
+func (w *thriftWriter) endStruct() {
+    w.stop()
+    w.lastID = w.stack[len(w.stack)-1]
+    w.stack = w.stack[:len(w.stack)-1]
+}
+
+// stop terminates the current struct.
+func (w *thriftWriter) stop() {
+    w.buf.WriteByte(0)
+}
+
+func (w *thriftWriter) beginList(id int16, elem byte, n int) {
+    w.field(id, thriftList)
+    if n < 15 {
+        w.buf.WriteByte(byte(n)<<4 | elem)
+        return
+    }
+    w.buf.WriteByte(0xf0 | elem)
+    w.buf.Write(binary.AppendUvarint(nil, uint64(n)))
+}
+
+func (w *thriftWriter) elemI32(v int32) {
+    w.varint(int64(v))
+}
+
+func (w *thriftWriter) elemStr(s string) {
+    w.buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+    w.buf.WriteString(s)
+}
@@ -0,0 +1,316 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The reader below decodes files independently of the encoder, following
+// the parquet-format specification: Thrift compact structs are decoded
+// generically into field-id maps, definition levels as the RLE/bit-packed
+// hybrid.
+
+// thriftReader decodes Thrift compact protocol values.
+type thriftReader struct {
+    b   []byte
+    pos int
+}
+
+func (r *thriftReader) byte() byte {
+    c := r.b[r.pos]
+    r.pos++
+    return c
+}
+
+func (r *thriftReader) uvarint() uint64 {
+    v, n := binary.Uvarint(r.b[r.pos:])
+    if n <= 0 {
+        panic("bad varint")
+    }
+    r.pos += n
+    return v
+}
+
+func (r *thriftReader) zigzag() int64 {
+    v := r.uvarint()
+    return int64(v>>1) ^ -int64(v&1)
+}
+
+// value decodes a value of the compact type typ: structs become
+// map[int16]any, lists []any, integers int64 and binaries []byte.
+func (r *thriftReader) value(typ byte) any {
+    switch typ {
+    case 1:
+        return true
+    case 2:
+        return false
+    case 3:
+        return int64(int8(r.byte()))
+    case 4, 5, 6:
+        return r.zigzag()
+    case 7:
+        v := math.Float64frombits(binary.LittleEndian.Uint64(r.b[r.pos:]))
+        r.pos += 8
+        return v
+    case 8:
+        n := int(r.uvarint())
+        v := r.b[r.pos : r.pos+n]
+        r.pos += n
+        return v
+    case 9, 10:
+        h := r.byte()
+        n, elem := int(h>>4), h&0x0f
+        if n == 15 {
+            n = int(r.uvarint())
+        }
+        list := make([]any, n)
+        for i := range list {
+            if elem == 1 || elem == 2 {
+                list[i] = r.byte() == 1
+                continue
+            }
+            list[i] = r.value(elem)
+        }
+        return list
+    case 12:
+        return r.structure()
+    }
+    panic(fmt.Sprintf("unsupported thrift type %d", typ))
+}
+
+func (r *thriftReader) structure() map[int16]any {
+    fields := map[int16]any{}
+    var last int16
+    for {
+        h := r.byte()
+        if h == 0 {
+            return fields
+        }
+        typ := h & 0x0f
+        id := last + int16(h>>4)
+        if h>>4 == 0 {
+            id = int16(r.zigzag())
+        }
+        fields[id] = r.value(typ)
+        last = id
+    }
+}
+
+// readParquet returns the column names and the rows of a Parquet file
+// written by ParquetSink.
+func readParquet(t *testing.T, path string) ([]string, [][]any) {
+    t.Helper()
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(data) < 12 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+        t.Fatalf("%s: missing PAR1 magic", path)
+    }
+    metaLen := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+    metaStart := len(data) - 8 - metaLen
+    r := &thriftReader{b: data[metaStart : len(data)-8]}
+    meta := r.structure()
+
+    schema := meta[2].([]any)
+    var names []string
+    var types []int64
+    for _, el := range schema[1:] {
+        f := el.(map[int16]any)
+        names = append(names, string(f[4].([]byte)))
+        types = append(types, f[1].(int64))
+    }
+
+    var rows [][]any
+    for _, g := range meta[4].([]any) {
+        group := g.(map[int16]any)
+        numRows := int(group[3].(int64))
+        groupRows := make([][]any, numRows)
+        for i := range groupRows {
+            groupRows[i] = make([]any, len(names))
+        }
+        for c, cc := range group[1].([]any) {
+            md := cc.(map[int16]any)[3].(map[int16]any)
+            offset := md[9].(int64)
+            if offset < 4 || offset >= int64(metaStart) {
+                t.Fatalf("column %s: page offset %d outside the data", names[c], offset)
+            }
+            pr := &thriftReader{b: data[offset:metaStart]}
+            page := pr.structure()
+            size := int(page[3].(int64)) // compressed_page_size
+            body := data[int(offset)+pr.pos : int(offset)+pr.pos+size]
+            if md[4].(int64) == 2 {
+                zr, err := gzip.NewReader(bytes.NewReader(body))
+                if err != nil {
+                    t.Fatalf("column %s: %v", names[c], err)
+                }
+                if body, err = io.ReadAll(zr); err != nil {
+                    t.Fatalf("column %s: %v", names[c], err)
+                }
+            }
+            for i, v := range decodeColumn(t, body, types[c], numRows) {
+                groupRows[i][c] = v
+            }
+        }
+        rows = append(rows, groupRows...)
+    }
+    if int(meta[3].(int64)) != len(rows) {
+        t.Fatalf("footer counts %d rows, row groups hold %d", meta[3], len(rows))
+    }
+    return names, rows
+}
+
+// decodeColumn decodes a data page v1 body: definition levels, then the
+// PLAIN values of the defined entries.
+func decodeColumn(t *testing.T, body []byte, typ int64, n int) []any {
+    t.Helper()
+    levelsLen := int(binary.LittleEndian.Uint32(body))
+    levels := &thriftReader{b: body[4 : 4+levelsLen]}
+    var defined []bool
+    for len(defined) < n {
+        h := levels.uvarint()
+        if h&1 == 0 {
+            v := levels.byte() == 1
+            for i := uint64(0); i < h>>1; i++ {
+                defined = append(defined, v)
+            }
+            continue
+        }
+        for i := uint64(0); i < h>>1; i++ {
+            b := levels.byte()
+            for bit := 0; bit < 8; bit++ {
+                defined = append(defined, b&(1<<bit) != 0)
+            }
+        }
+    }
+
+    vals := body[4+levelsLen:]
+    out := make([]any, n)
+    boolIdx := 0
+    for i := 0; i < n; i++ {
+        if !defined[i] {
+            continue
+        }
+        switch typ {
+        case 0:
+            out[i] = vals[boolIdx/8]&(1<<(boolIdx%8)) != 0
+            boolIdx++
+        case 2:
+            out[i] = int64(binary.LittleEndian.Uint64(vals))
+            vals = vals[8:]
+        case 5:
+            out[i] = math.Float64frombits(binary.LittleEndian.Uint64(vals))
+            vals = vals[8:]
+        case 6:
+            l := int(binary.LittleEndian.Uint32(vals))
+            out[i] = string(vals[4 : 4+l])
+            vals = vals[4+l:]
+        default:
+            t.Fatalf("unexpected physical type %d", typ)
+        }
+    }
+    return out
+}
+
+func TestParquetSinkReadBack(t *testing.T) {
+    for _, compression := range []string{"gzip", "none"} {
+        t.Run(compression, func(t *testing.T) {
+            dir := t.TempDir()
+            s, err := NewParquetSink(dir, ParquetOptions{RowGroupSize: 2, Compression: compression})
+            if err != nil {
+                t.Fatal(err)
+            }
+            events := []Event{
+                {"contract_name": "Token", "event_name": "Transfer", "block_number": uint64(1), "value": "10", "ok": true, "ratio": 0.5},
+                {"contract_name": "Token", "event_name": "Transfer", "block_number": uint64(2), "value": "20", "ok": false, "ratio": 1.5},
+                {"contract_name": "Token", "event_name": "Transfer", "block_number": uint64(3), "ok": true, "ratio": 2.5},
+            }
+            for _, evt := range events {
+                if err := s.Write(evt); err != nil {
+                    t.Fatalf("Write: %v", err)
+                }
+            }
+            if err := s.Close(); err != nil {
+                t.Fatalf("Close: %v", err)
+            }
+
+            names, rows := readParquet(t, filepath.Join(dir, "Token_Transfer-00000.parquet"))
+            wantNames := []string{"block_number", "contract_name", "event_name", "ok", "ratio", "value"}
+            if !reflect.DeepEqual(names, wantNames) {
+                t.Fatalf("columns = %v, want %v", names, wantNames)
+            }
+            want := [][]any{
+                {int64(1), "Token", "Transfer", true, 0.5, "10"},
+                {int64(2), "Token", "Transfer", false, 1.5, "20"},
+                {int64(3), "Token", "Transfer", true, 2.5, nil},
+            }
+            if !reflect.DeepEqual(rows, want) {
+                t.Fatalf("rows = %v, want %v", rows, want)
+            }
+        })
+    }
+}
+
+// flakyOutput fails the first write after limit bytes, once.
+type flakyOutput struct {
+    *os.File
+    limit  int
+    failed bool
+}
+
+func (f *flakyOutput) Write(p []byte) (int, error) {
+    if f.failed || len(p) <= f.limit {
+        return f.File.Write(p)
+    }
+    f.failed = true
+    n, _ := f.File.Write(p[:f.limit])
+    return n, errors.New("disk full")
+}
+
+func TestParquetSinkPartialWriteRollsBack(t *testing.T) {
+    dir := t.TempDir()
+    s, err := NewParquetSink(dir, ParquetOptions{RowGroupSize: 1, Compression: "none"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    evt := func(n uint64) Event {
+        return Event{"contract_name": "Token", "event_name": "Transfer", "block_number": n}
+    }
+    if err := s.Write(evt(1)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    pf := s.files[CSVKey("Token", "Transfer")]
+    pf.file = &flakyOutput{File: pf.file.(*os.File), limit: 5}
+
+    if err := s.Write(evt(2)); err == nil {
+        t.Fatal("Write succeeded despite the failing file")
+    }
+    // The caller retries the failed event.
+    if err := s.Write(evt(2)); err != nil {
+        t.Fatalf("retried Write: %v", err)
+    }
+    if err := s.Write(evt(3)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := s.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    _, rows := readParquet(t, filepath.Join(dir, "Token_Transfer-00000.parquet"))
+    var blocks []any
+    for _, row := range rows {
+        blocks = append(blocks, row[0])
+    }
+    if want := []any{int64(1), int64(2), int64(3)}; !reflect.DeepEqual(blocks, want) {
+        t.Fatalf("block_number column = %v, want %v", blocks, want)
+    }
+}
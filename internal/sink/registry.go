@@ -0,0 +1,116 @@
+package sink
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"etl-web3/internal/config"
+)
+
+// Factory builds a sink from the storage section of the configuration.
+// Custom sinks usually read their settings from StorageConfig.Options.
+type Factory func(cfg config.StorageConfig) (Sink, error)
+
+// Field describes one setting of a storage type, as listed by
+// GET /storage/types.
+type Field struct {
+    // Name is the key under storage, e.g. "csv.output_dir".
+    Name        string `json:"name"`
+    Type        string `json:"type"` // "string", "int", "bool", "map[string]string" or "map[string][]string"
+    Required    bool   `json:"required"`
+    Description string `json:"description,omitempty"`
+}
+
+var (
+    registryMu sync.RWMutex
+    registry   = make(map[string]Factory)
+    schemas    = make(map[string][]Field)
+)
+
+// Register makes a storage type selectable through storage.type (and
+// storage.mirror). It is meant to be called from init functions; built-in
+// sinks register themselves the same way. Registering a name twice panics.
+func Register(name string, factory Factory) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    if factory == nil {
+        panic("sink: Register factory is nil for " + name)
+    }
+    if _, dup := registry[name]; dup {
+        panic("sink: Register called twice for " + name)
+    }
+    registry[name] = factory
+    config.RegisterStorageType(name)
+}
+
+// Describe records the settings of a registered storage type so clients can
+// build a form for it. Types that were never described list no fields.
+func Describe(name string, fields ...Field) {
+    registryMu.Lock()
+    defer registryMu.Unlock()
+
+    if _, ok := registry[name]; !ok {
+        panic("sink: Describe called for unregistered type " + name)
+    }
+    schemas[name] = fields
+}
+
+// Schema returns the fields recorded by Describe for a storage type.
+func Schema(name string) []Field {
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+    return schemas[name]
+}
+
+// Types returns the registered storage types in alphabetical order.
+func Types() []string {
+    registryMu.RLock()
+    defer registryMu.RUnlock()
+
+    names := make([]string, 0, len(registry))
+    for name := range registry {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
+
+// New creates a single sink of the given registered type.
+func New(typ string, cfg config.StorageConfig) (Sink, error) {
+    registryMu.RLock()
+    factory, ok := registry[typ]
+    registryMu.RUnlock()
+    if !ok {
+        return nil, fmt.Errorf("unsupported storage type: %s", typ)
+    }
+
+    s, err := factory(cfg)
+    if err != nil {
+        return nil, fmt.Errorf("failed to initialise %s sink: %w", typ, err)
+    }
+    return s, nil
+}
+
+// Build creates the configured primary sink. When mirrors are configured
+// every sink is combined into a TeeSink.
+func Build(cfg config.StorageConfig) (Sink, error) {
+    primary, err := New(cfg.Type, cfg)
+    if err != nil {
+        return nil, err
+    }
+    if len(cfg.Mirror) == 0 {
+        return primary, nil
+    }
+
+    sinks := []Sink{primary}
+    for _, typ := range cfg.Mirror {
+        s, err := New(typ, cfg)
+        if err != nil {
+            return nil, err
+        }
+        sinks = append(sinks, s)
+    }
+    return NewTeeSink(sinks...).FailFast(cfg.MirrorFailFast), nil
+}
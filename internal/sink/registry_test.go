@@ -0,0 +1,72 @@
+package sink
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"etl-web3/internal/config"
+)
+
+func TestBuildUnknownType(t *testing.T) {
+    if _, err := Build(config.StorageConfig{Type: "nosuchsink"}); err == nil {
+        t.Fatal("Build accepted an unregistered storage type")
+    }
+}
+
+func TestBuildMySQLWithoutDriver(t *testing.T) {
+    sk, err := Build(config.StorageConfig{Type: "mysql"})
+    if err == nil || !strings.Contains(err.Error(), "driver") {
+        t.Fatalf("Build(mysql) = %v, %v; want a missing driver error", sk, err)
+    }
+}
+
+// registerTestSink registers the registrytest type once per process.
+var registerTestSink sync.Once
+
+func TestRegisterAndDescribe(t *testing.T) {
+    registerTestSink.Do(func() {
+        Register("registrytest", func(config.StorageConfig) (Sink, error) { return failingSink{}, nil })
+        Describe("registrytest", Field{Name: "options.path", Type: "string", Required: true})
+    })
+
+    types := Types()
+    for i := 1; i < len(types); i++ {
+        if types[i-1] >= types[i] {
+            t.Fatalf("Types not sorted: %v", types)
+        }
+    }
+    found := false
+    for _, name := range types {
+        found = found || name == "registrytest"
+    }
+    if !found {
+        t.Fatalf("registrytest missing from %v", types)
+    }
+    if fields := Schema("registrytest"); len(fields) != 1 || fields[0].Name != "options.path" || !fields[0].Required {
+        t.Errorf("Schema = %+v", fields)
+    }
+    if Schema("nosuchsink") != nil {
+        t.Error("Schema of an unregistered type is not nil")
+    }
+    if err := config.ValidateStorage(config.StorageConfig{Type: "registrytest"}); err != nil {
+        t.Errorf("registered type rejected by config validation: %v", err)
+    }
+}
+
+func TestRegisterPanics(t *testing.T) {
+    for name, fn := range map[string]func(){
+        "duplicate":        func() { Register("csv", func(config.StorageConfig) (Sink, error) { return nil, nil }) },
+        "nil factory":      func() { Register("nilfactory", nil) },
+        "describe unknown": func() { Describe("nosuchsink") },
+    } {
+        t.Run(name, func(t *testing.T) {
+            defer func() {
+                if recover() == nil {
+                    t.Fatal("no panic")
+                }
+            }()
+            fn()
+        })
+    }
+}
@@ -16,7 +16,7 @@ import (
 // If delayMs is 0, it defaults to 1000ms.
 //
 // The RetrySink propagates the error from the last attempt if all retries
-// fail.
+// fail. Errors marked with Permanent are returned at once.
 type RetrySink struct {
     inner    Sink
     attempts int
@@ -45,12 +45,42 @@ func NewRetrySink(inner Sink, attempts int, delayMs int) Sink {
 
 // Write forwards the call to the wrapped sink retrying on failure.
 func (r *RetrySink) Write(evt Event) error {
+    return r.retry(func() error { return r.inner.Write(evt) })
+}
+
+// Remove retracts the event from the wrapped sink (see sink.Remove) retrying
+// on failure.
+func (r *RetrySink) Remove(evt Event) error {
+    return r.retry(func() error { return Remove(r.inner, evt) })
+}
+
+// Unwrap returns the wrapped sink.
+func (r *RetrySink) Unwrap() Sink {
+    return r.inner
+}
+
+// Flush flushes the wrapped sink (see sink.Flush). It is not retried.
+func (r *RetrySink) Flush() error {
+    return Flush(r.inner)
+}
+
+// Close closes the wrapped sink (see sink.Close).
+func (r *RetrySink) Close() error {
+    return Close(r.inner)
+}
+
+// retry runs fn up to the configured number of attempts.
+func (r *RetrySink) retry(fn func() error) error {
     var err error
     for attempt := 1; attempt <= r.attempts; attempt++ {
-        err = r.inner.Write(evt)
+        err = fn()
         if err == nil {
             return nil
         }
+        if IsPermanent(err) {
+            logrus.Warnf("sink write failed permanently (not retried): %v", err)
+            return err
+        }
 
         logrus.Warnf("sink write failed (attempt %d/%d): %v", attempt, r.attempts, err)
 
@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+// flakySink fails its writes with the errors of errs in turn, then
+// succeeds, counting the calls.
+type flakySink struct {
+    errs  []error
+    calls int
+}
+
+func (f *flakySink) Write(Event) error {
+    f.calls++
+    if f.calls <= len(f.errs) {
+        return f.errs[f.calls-1]
+    }
+    return nil
+}
+
+func TestRetrySinkClassifiesErrors(t *testing.T) {
+    transient := errors.New("dial tcp: connection refused")
+    permanent := Permanent(errors.New("column value too long"))
+    cases := []struct {
+        name      string
+        errs      []error
+        wantCalls int
+        wantErr   error
+    }{
+        {name: "transient then success", errs: []error{transient, transient}, wantCalls: 3},
+        {name: "transient every attempt", errs: []error{transient, transient, transient, transient}, wantCalls: 3, wantErr: transient},
+        {name: "permanent", errs: []error{permanent}, wantCalls: 1, wantErr: permanent},
+        {name: "wrapped permanent", errs: []error{fmt.Errorf("insert: %w", permanent)}, wantCalls: 1, wantErr: permanent},
+        {name: "permanent after transient", errs: []error{transient, permanent}, wantCalls: 2, wantErr: permanent},
+    }
+    for _, tc := range cases {
+        t.Run(tc.name, func(t *testing.T) {
+            inner := &flakySink{errs: tc.errs}
+            err := NewRetrySink(inner, 3, 1).Write(Event{})
+            if inner.calls != tc.wantCalls {
+                t.Errorf("%d write attempts, want %d", inner.calls, tc.wantCalls)
+            }
+            if tc.wantErr == nil && err != nil || tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+                t.Errorf("Write = %v, want %v", err, tc.wantErr)
+            }
+        })
+    }
+}
+
+func TestIsPermanent(t *testing.T) {
+    if Permanent(nil) != nil {
+        t.Error("Permanent(nil) != nil")
+    }
+    base := errors.New("rejected")
+    rejected := Permanent(&RejectedError{Events: []Event{{}}, Err: base})
+    if !IsPermanent(rejected) || !IsPermanent(fmt.Errorf("flush: %w", rejected)) {
+        t.Error("permanent RejectedError not detected")
+    }
+    var re *RejectedError
+    if !errors.As(rejected, &re) || !errors.Is(rejected, base) {
+        t.Error("Permanent hides the wrapped errors")
+    }
+    if IsPermanent(base) || IsPermanent(&RejectedError{Err: base}) {
+        t.Error("unmarked error reported permanent")
+    }
+}
+
+func TestPermanentErrorsReachDeadLetterAtOnce(t *testing.T) {
+    inner := &flakySink{errs: []error{Permanent(errors.New("column value too long"))}}
+    // A long delay would show as a slow test if the write were retried.
+    dl, err := NewDeadLetterSink(NewRetrySink(inner, 5, 60_000), filepath.Join(t.TempDir(), "failed.jsonl"), 0)
+    if err != nil {
+        t.Fatalf("NewDeadLetterSink: %v", err)
+    }
+    defer dl.CloseFile()
+    if err := dl.Write(Event{"event_name": "Transfer"}); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if inner.calls != 1 || dl.Count() != 1 {
+        t.Fatalf("%d attempts, %d dead letters; want 1 and 1", inner.calls, dl.Count())
+    }
+}
@@ -0,0 +1,192 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"etl-web3/internal/config"
+
+	"github.com/sirupsen/logrus"
+)
+
+// schemaOptionalKeys are only set on some events of a type (enrichment that
+// failed or does not apply, decoding warnings), so they are not pinned.
+var schemaOptionalKeys = map[string]bool{
+    "timestamp":       true,
+    "timestamp_error": true,
+    "tx_from":         true,
+    "tx_status":       true,
+    "gas_used":        true,
+    "method_name":     true,
+    "decode_warning":  true,
+    "data":            true,
+    "no_code":         true,
+    "event_signature": true,
+}
+
+// SchemaSink decorates a Sink so the keys of every event are checked
+// against the schema pinned for its type ("<contract>_<event>", like the
+// CSV file names) in a JSON file mapping each type to its sorted keys.
+// Types missing from the file are pinned by their first event and the file
+// is rewritten, so the first run generates it. On drift (a contract upgrade
+// changed the event layout) a warning is logged once per type or, in fail
+// mode, the event is rejected with a Permanent error.
+type SchemaSink struct {
+    inner Sink
+    path  string
+    fail  bool
+
+    mu     sync.Mutex
+    pins   map[string][]string
+    warned map[string]bool
+}
+
+// NewSchemaSink wraps inner, reading the pins from path when it exists.
+func NewSchemaSink(inner Sink, path string, fail bool) (*SchemaSink, error) {
+    pins := make(map[string][]string)
+    data, err := os.ReadFile(path)
+    switch {
+    case errors.Is(err, os.ErrNotExist):
+    case err != nil:
+        return nil, fmt.Errorf("failed to read schema file %s: %w", path, err)
+    default:
+        if err := json.Unmarshal(data, &pins); err != nil {
+            return nil, fmt.Errorf("failed to parse schema file %s: %w", path, err)
+        }
+    }
+    return &SchemaSink{inner: inner, path: path, fail: fail, pins: pins, warned: make(map[string]bool)}, nil
+}
+
+// WithSchema wraps sk in a SchemaSink when the storage config sets a
+// schema file and returns sk unchanged otherwise.
+func WithSchema(sk Sink, cfg config.StorageConfig) (Sink, error) {
+    if cfg.Schema.File == "" || sk == nil {
+        return sk, nil
+    }
+    return NewSchemaSink(sk, cfg.Schema.File, cfg.Schema.OnDrift == config.SchemaDriftFail)
+}
+
+// Write checks evt against its pin and forwards it.
+func (s *SchemaSink) Write(evt Event) error {
+    if err := s.check(evt); err != nil {
+        return err
+    }
+    return s.inner.Write(evt)
+}
+
+// Remove retracts the event from the inner sink (see sink.Remove). Removals
+// are not checked: they repeat an event already written.
+func (s *SchemaSink) Remove(evt Event) error {
+    return Remove(s.inner, evt)
+}
+
+// Unwrap returns the wrapped sink.
+func (s *SchemaSink) Unwrap() Sink {
+    return s.inner
+}
+
+// Flush flushes the wrapped sink (see sink.Flush).
+func (s *SchemaSink) Flush() error {
+    return Flush(s.inner)
+}
+
+// Close closes the wrapped sink (see sink.Close). Pins are saved as they
+// are made, so there is nothing of its own to write.
+func (s *SchemaSink) Close() error {
+    return Close(s.inner)
+}
+
+// check compares the keys of evt with the pin of its type, pinning them
+// when the type has none yet.
+func (s *SchemaSink) check(evt Event) error {
+    name, _ := evt["event_name"].(string)
+    contractName, _ := evt["contract_name"].(string)
+    typ := CSVKey(contractName, name)
+    keys := schemaKeys(evt)
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    pin, ok := s.pins[typ]
+    if !ok {
+        s.pins[typ] = keys
+        if err := s.saveLocked(); err != nil {
+            return err
+        }
+        logrus.Infof("pinned schema of %s (%d fields) in %s", typ, len(keys), s.path)
+        return nil
+    }
+
+    missing, extra := diffKeys(pin, keys)
+    if len(missing) == 0 && len(extra) == 0 {
+        return nil
+    }
+    drift := fmt.Sprintf("schema drift in %s: missing %v, unexpected %v (pinned in %s)", typ, missing, extra, s.path)
+    if s.fail {
+        return Permanent(errors.New(drift))
+    }
+    if !s.warned[typ] {
+        s.warned[typ] = true
+        logrus.Warn(drift)
+    }
+    return nil
+}
+
+// saveLocked rewrites the schema file atomically.
+func (s *SchemaSink) saveLocked() error {
+    data, err := json.MarshalIndent(s.pins, "", "  ")
+    if err != nil {
+        return err
+    }
+    if dir := filepath.Dir(s.path); dir != "" {
+        if err := os.MkdirAll(dir, 0o755); err != nil {
+            return fmt.Errorf("failed to create schema directory: %w", err)
+        }
+    }
+    tmp := s.path + ".tmp"
+    if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+        return fmt.Errorf("failed to write schema file: %w", err)
+    }
+    if err := os.Rename(tmp, s.path); err != nil {
+        return fmt.Errorf("failed to write schema file: %w", err)
+    }
+    return nil
+}
+
+// schemaKeys returns the sorted keys of evt that are part of its schema.
+func schemaKeys(evt Event) []string {
+    keys := make([]string, 0, len(evt))
+    for k := range evt {
+        // Calldata arguments depend on the method called, not the event.
+        if schemaOptionalKeys[k] || strings.HasPrefix(k, "input_") {
+            continue
+        }
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// diffKeys returns the keys of pin absent from keys and those of keys
+// absent from pin. Both must be sorted.
+func diffKeys(pin, keys []string) (missing, extra []string) {
+    i, j := 0, 0
+    for i < len(pin) || j < len(keys) {
+        switch {
+        case j == len(keys) || i < len(pin) && pin[i] < keys[j]:
+            missing = append(missing, pin[i])
+            i++
+        case i == len(pin) || keys[j] < pin[i]:
+            extra = append(extra, keys[j])
+            j++
+        default:
+            i, j = i+1, j+1
+        }
+    }
+    return missing, extra
+}
@@ -0,0 +1,143 @@
+package sink
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+)
+
+// schemaEvent returns a Transfer event of Token with the given extra keys.
+func schemaEvent(extra ...string) Event {
+    evt := Event{"contract_name": "Token", "event_name": "Transfer", "block_number": uint64(1), "from": "0x1", "to": "0x2", "value": "3"}
+    for _, k := range extra {
+        evt[k] = "x"
+    }
+    return evt
+}
+
+// readPins returns the content of the schema file at path.
+func readPins(t *testing.T, path string) map[string][]string {
+    t.Helper()
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var pins map[string][]string
+    if err := json.Unmarshal(data, &pins); err != nil {
+        t.Fatalf("decoding %s: %v", data, err)
+    }
+    return pins
+}
+
+func TestSchemaSinkPinsFirstEvent(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "state", "schema.json")
+    out := &flakySink{}
+    s, err := NewSchemaSink(out, path, true)
+    if err != nil {
+        t.Fatalf("NewSchemaSink: %v", err)
+    }
+    // Optional enrichment keys and calldata arguments are not pinned.
+    if err := s.Write(schemaEvent("timestamp", "tx_from", "input_amount")); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    want := []string{"block_number", "contract_name", "event_name", "from", "to", "value"}
+    if pins := readPins(t, path); !reflect.DeepEqual(pins["Token_Transfer"], want) {
+        t.Fatalf("pins = %v, want Token_Transfer: %v", pins, want)
+    }
+
+    // Matching events, with or without the optional keys, pass.
+    for _, evt := range []Event{schemaEvent(), schemaEvent("decode_warning", "method_name")} {
+        if err := s.Write(evt); err != nil {
+            t.Fatalf("Write(%v): %v", evt, err)
+        }
+    }
+    if out.calls != 3 {
+        t.Fatalf("%d events forwarded, want 3", out.calls)
+    }
+
+    // A restart reads the pin back.
+    s, err = NewSchemaSink(out, path, true)
+    if err != nil {
+        t.Fatalf("NewSchemaSink: %v", err)
+    }
+    if err := s.Write(schemaEvent("owner")); err == nil {
+        t.Fatal("drift accepted after reloading the pins")
+    }
+}
+
+func TestSchemaSinkDrift(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "schema.json")
+    pinned, _ := json.Marshal(map[string][]string{"Token_Transfer": {"block_number", "contract_name", "event_name", "from", "to", "value"}})
+    if err := os.WriteFile(path, pinned, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    drifted := schemaEvent("memo")
+    delete(drifted, "value")
+
+    out := &flakySink{}
+    failing, err := NewSchemaSink(out, path, true)
+    if err != nil {
+        t.Fatalf("NewSchemaSink: %v", err)
+    }
+    err = failing.Write(drifted)
+    if err == nil || !IsPermanent(err) || !strings.Contains(err.Error(), "missing [value], unexpected [memo]") {
+        t.Fatalf("Write = %v, want a permanent drift error", err)
+    }
+    if out.calls != 0 {
+        t.Fatal("drifting event forwarded in fail mode")
+    }
+
+    warning, err := NewSchemaSink(out, path, false)
+    if err != nil {
+        t.Fatalf("NewSchemaSink: %v", err)
+    }
+    if err := warning.Write(drifted); err != nil || out.calls != 1 {
+        t.Fatalf("Write = %v with %d calls, want the event forwarded in warn mode", err, out.calls)
+    }
+    // Other types are pinned next to the existing ones.
+    approval := schemaEvent()
+    approval["event_name"] = "Approval"
+    if err := warning.Write(approval); err != nil {
+        t.Fatalf("Write(Approval): %v", err)
+    }
+    if pins := readPins(t, path); len(pins) != 2 || len(pins["Token_Transfer"]) != 6 {
+        t.Fatalf("pins = %v", pins)
+    }
+}
+
+func TestWithSchema(t *testing.T) {
+    inner := &flakySink{}
+    if sk, err := WithSchema(inner, config.StorageConfig{}); err != nil || sk != Sink(inner) {
+        t.Fatalf("WithSchema without a file = %v, %v", sk, err)
+    }
+    var st config.StorageConfig
+    st.Schema.File = filepath.Join(t.TempDir(), "schema.json")
+    st.Schema.OnDrift = config.SchemaDriftFail
+    sk, err := WithSchema(inner, st)
+    if err != nil {
+        t.Fatalf("WithSchema: %v", err)
+    }
+    if s, ok := sk.(*SchemaSink); !ok || !s.fail || s.Unwrap() != Sink(inner) {
+        t.Fatalf("WithSchema = %#v", sk)
+    }
+
+    os.WriteFile(st.Schema.File, []byte("{not json"), 0o644)
+    if _, err := WithSchema(inner, st); err == nil {
+        t.Fatal("WithSchema accepted a corrupt schema file")
+    }
+}
+
+func TestDiffKeys(t *testing.T) {
+    missing, extra := diffKeys([]string{"a", "b", "d"}, []string{"b", "c", "d", "e"})
+    if !reflect.DeepEqual(missing, []string{"a"}) || !reflect.DeepEqual(extra, []string{"c", "e"}) {
+        t.Fatalf("diffKeys = %v, %v", missing, extra)
+    }
+    if missing, extra := diffKeys([]string{"a"}, []string{"a"}); missing != nil || extra != nil {
+        t.Fatalf("diffKeys of equal keys = %v, %v", missing, extra)
+    }
+}
@@ -1,5 +1,7 @@
 package sink
 
+import "io"
+
 // Event represents a generic decoded event ready to be persisted.
 // Keys are field names and values are their respective data.
 // This flexible structure allows different sink back-ends (CSV, MySQL, etc.)
@@ -12,6 +14,16 @@ package sink
 // to progress without being blocked by storage details.
 type Event map[string]interface{}
 
+// BlockEventName is the synthetic event_name used for per-block metadata
+// records produced when block indexing is enabled. Sinks store them in a
+// dedicated "blocks" table/file instead of the per-contract layout.
+const BlockEventName = "block"
+
+// TraceEventName is the synthetic event_name of the internal call records
+// produced when trace indexing is enabled. Like block records they go to a
+// dedicated "traces" table/file.
+const TraceEventName = "trace"
+
 // Sink defines the behaviour expected from any storage back-end used by the
 // indexer (e.g. CSV files, MySQL, Postgres, webhooks, etc.).
 //
@@ -27,4 +39,126 @@ type Sink interface {
     // Write persists the provided event and returns an error if the operation
     // fails for any reason.
     Write(Event) error
+}
+
+// Remover is implemented by sinks able to delete a previously written event
+// whose log was removed by a chain reorganisation. Events are identified by
+// tx_hash and log_index.
+type Remover interface {
+    Remove(Event) error
+}
+
+// LastBlocker is implemented by sinks able to report the highest
+// block_number they already hold, so a run can resume without a checkpoint.
+// ok is false when the sink holds no events yet.
+type LastBlocker interface {
+    LastBlock() (block uint64, ok bool, err error)
+}
+
+// Range is an inclusive [From, To] interval of blocks.
+type Range struct {
+    From uint64
+    To   uint64
+}
+
+// RangeReporter is implemented by sinks able to tell which block ranges they
+// already hold completely, so a restarted run skips them instead of
+// scanning them again and relying on dedupe.
+type RangeReporter interface {
+    CompletedRanges() ([]Range, error)
+}
+
+// CompletedRanges returns the ranges reported by s, or by the sink it wraps
+// through Unwrapper decorators; ok is false when none is a RangeReporter.
+func CompletedRanges(s Sink) (ranges []Range, ok bool, err error) {
+    for s != nil {
+        if r, is := s.(RangeReporter); is {
+            ranges, err = r.CompletedRanges()
+            return ranges, true, err
+        }
+        u, is := s.(Unwrapper)
+        if !is {
+            break
+        }
+        s = u.Unwrap()
+    }
+    return nil, false, nil
+}
+
+// TransactionalSink is implemented by sinks (typically SQL databases) able
+// to commit the events of a block range together with the progress
+// checkpoint, so a crash can never leave the checkpoint ahead of the rows.
+// When checkpointing is enabled the indexer writes every range through a
+// transaction and keeps its checkpoint in the sink instead of the file.
+type TransactionalSink interface {
+    Sink
+    Begin() (Tx, error)
+    // Checkpoint returns the checkpoint stored by the last commit; ok is
+    // false when none was committed yet.
+    Checkpoint() (block uint64, ok bool, err error)
+}
+
+// Tx is an open transaction of a TransactionalSink. Events written (or
+// removed, when it implements Remover) through it become visible on Commit,
+// with the checkpoint set by SetCheckpoint if any; Rollback discards them.
+type Tx interface {
+    Sink
+    SetCheckpoint(block uint64) error
+    Commit() error
+    Rollback() error
+}
+
+// Unwrapper is implemented by sinks decorating a single other sink.
+type Unwrapper interface {
+    Unwrap() Sink
+}
+
+// AsTransactional returns the TransactionalSink s is, or wraps through
+// Unwrapper decorators, if any.
+func AsTransactional(s Sink) (TransactionalSink, bool) {
+    for s != nil {
+        if t, ok := s.(TransactionalSink); ok {
+            return t, true
+        }
+        u, ok := s.(Unwrapper)
+        if !ok {
+            break
+        }
+        s = u.Unwrap()
+    }
+    return nil, false
+}
+
+// Flusher is implemented by sinks buffering writes (e.g. CSV with
+// flush_rows) that can push their buffered events to storage on demand.
+type Flusher interface {
+    Flush() error
+}
+
+// Flush flushes s when it implements Flusher. Decorators implement Flush by
+// forwarding to the sink they wrap, so the whole chain is flushed.
+func Flush(s Sink) error {
+    if f, ok := s.(Flusher); ok {
+        return f.Flush()
+    }
+    return nil
+}
+
+// Close closes s when it implements io.Closer. Decorators implement Close by
+// forwarding to the sink they wrap, so closing the outermost sink of a chain
+// closes the storage sink at its bottom.
+func Close(s Sink) error {
+    if c, ok := s.(io.Closer); ok {
+        return c.Close()
+    }
+    return nil
+}
+
+// Remove retracts evt from s: sinks implementing Remover delete it, the
+// others receive it as a tombstone row (its "removed" field is true).
+func Remove(s Sink, evt Event) error {
+    if r, ok := s.(Remover); ok {
+        return r.Remove(evt)
+    }
+    return s.Write(evt)
 } 
\ No newline at end of file
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+// closeRecorder counts the Flush and Close calls that reach it.
+type closeRecorder struct {
+    writes, flushes, closes int
+}
+
+func (c *closeRecorder) Write(Event) error {
+    c.writes++
+    return nil
+}
+
+func (c *closeRecorder) Flush() error {
+    c.flushes++
+    return nil
+}
+
+func (c *closeRecorder) Close() error {
+    c.closes++
+    return nil
+}
+
+// decorate wraps inner in the decorators of a run: schema check, retry,
+// then dead-lettering, as the indexer command and API jobs build it.
+func decorate(t *testing.T, inner Sink) Sink {
+    t.Helper()
+    dir := t.TempDir()
+    checked, err := NewSchemaSink(inner, filepath.Join(dir, "schema.json"), false)
+    if err != nil {
+        t.Fatalf("NewSchemaSink: %v", err)
+    }
+    dl, err := NewDeadLetterSink(NewRetrySink(checked, 2, 1), filepath.Join(dir, "dead.jsonl"), 0)
+    if err != nil {
+        t.Fatalf("NewDeadLetterSink: %v", err)
+    }
+    return dl
+}
+
+func TestDecoratorChainForwardsFlushAndClose(t *testing.T) {
+    bottom, mirror := &closeRecorder{}, &closeRecorder{}
+    top := decorate(t, NewTeeSink(bottom, mirror))
+    if err := top.Write(transferEvent(1)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+
+    if err := Flush(top); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+    for _, r := range []*closeRecorder{bottom, mirror} {
+        if r.writes != 1 || r.flushes != 1 || r.closes != 0 {
+            t.Fatalf("after Flush: %+v, want 1 write and 1 flush", *r)
+        }
+    }
+
+    if err := Close(top); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    for _, r := range []*closeRecorder{bottom, mirror} {
+        if r.closes != 1 {
+            t.Fatalf("after Close: %+v, want 1 close", *r)
+        }
+    }
+}
+
+func TestDecoratorChainCloseFlushesCSV(t *testing.T) {
+    csv, dir := newTestCSVSink(t, CSVOptions{FlushRows: 1000})
+    top := decorate(t, csv)
+    for b := uint64(1); b <= 5; b++ {
+        if err := top.Write(transferEvent(b)); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    path := filepath.Join(dir, "Token_Transfer.csv")
+    if rows := csvRows(t, path); len(rows) != 1 {
+        t.Fatalf("%d rows on disk before Close, want the header only", len(rows))
+    }
+    if err := Close(top); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    if rows := csvRows(t, path); len(rows) != 6 {
+        t.Fatalf("%d rows on disk after Close, want the header and 5 events", len(rows))
+    }
+}
+
+func TestCloseAndFlushIgnorePlainSinks(t *testing.T) {
+    plain := &flakySink{}
+    top := NewRetrySink(plain, 1, 1)
+    if err := Flush(top); err != nil {
+        t.Errorf("Flush: %v", err)
+    }
+    if err := Close(top); err != nil {
+        t.Errorf("Close: %v", err)
+    }
+}
@@ -0,0 +1,199 @@
+package sink
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	"etl-web3/internal/config"
+)
+
+func init() {
+    Register("mysql", func(cfg config.StorageConfig) (Sink, error) {
+        if !slices.Contains(sql.Drivers(), "mysql") {
+            // No driver is vendored: fail the run rather than silently
+            // dropping every event.
+            return nil, errors.New(`no "mysql" database/sql driver is linked into this build; import one (e.g. github.com/go-sql-driver/mysql) and rebuild`)
+        }
+        db, err := sql.Open("mysql", cfg.MySQL.DSN)
+        if err != nil {
+            return nil, err
+        }
+        s, err := NewSQLSink(db, cfg.MySQL.CheckpointName)
+        if err != nil {
+            db.Close()
+            return nil, err
+        }
+        return s, nil
+    })
+    Describe("mysql",
+        Field{Name: "mysql.dsn", Type: "string", Required: true, Description: "Data source name, e.g. user:pass@tcp(host:3306)/db"},
+        Field{Name: "mysql.checkpoint_name", Type: "string", Description: "Row of etl_checkpoints holding the checkpoint (default \"default\")"},
+    )
+}
+
+// DefaultSQLCheckpointName is the etl_checkpoints row used when none is set.
+const DefaultSQLCheckpointName = "default"
+
+// sqlSchema creates the tables of an SQLSink. The statements and the "?"
+// placeholders below are understood by MySQL and SQLite.
+var sqlSchema = []string{
+    `CREATE TABLE IF NOT EXISTS etl_events (
+        event_key     VARCHAR(255) NOT NULL PRIMARY KEY,
+        block_number  BIGINT NOT NULL,
+        contract_name VARCHAR(255) NOT NULL,
+        event_name    VARCHAR(255) NOT NULL,
+        fields        TEXT NOT NULL
+    )`,
+    `CREATE TABLE IF NOT EXISTS etl_checkpoints (
+        name  VARCHAR(255) NOT NULL PRIMARY KEY,
+        block BIGINT NOT NULL
+    )`,
+}
+
+// SQLSink stores events in a database/sql database: one etl_events row per
+// event, keyed by its log (tx_hash and log_index), with every field as a
+// JSON document. It is a TransactionalSink: the indexer writes each block
+// range through one transaction that also moves the checkpoint, kept in
+// the etl_checkpoints row of the sink's name.
+type SQLSink struct {
+    db   *sql.DB
+    name string
+}
+
+// NewSQLSink creates the tables of an SQLSink in db when missing. name
+// selects the checkpoint row; empty means DefaultSQLCheckpointName.
+func NewSQLSink(db *sql.DB, name string) (*SQLSink, error) {
+    for _, stmt := range sqlSchema {
+        if _, err := db.Exec(stmt); err != nil {
+            return nil, fmt.Errorf("failed to create sql tables: %w", err)
+        }
+    }
+    if name == "" {
+        name = DefaultSQLCheckpointName
+    }
+    return &SQLSink{db: db, name: name}, nil
+}
+
+// Write stores evt in a transaction of its own.
+func (s *SQLSink) Write(evt Event) error {
+    return s.inTx(func(tx *sqlTx) error { return tx.Write(evt) })
+}
+
+// Remove deletes the row of evt, retracted by a reorg.
+func (s *SQLSink) Remove(evt Event) error {
+    return s.inTx(func(tx *sqlTx) error { return tx.Remove(evt) })
+}
+
+// Begin opens a transaction.
+func (s *SQLSink) Begin() (Tx, error) {
+    tx, err := s.db.Begin()
+    if err != nil {
+        return nil, err
+    }
+    return &sqlTx{tx: tx, name: s.name}, nil
+}
+
+// Checkpoint returns the block of the sink's checkpoint row.
+func (s *SQLSink) Checkpoint() (uint64, bool, error) {
+    var block uint64
+    err := s.db.QueryRow(`SELECT block FROM etl_checkpoints WHERE name = ?`, s.name).Scan(&block)
+    if errors.Is(err, sql.ErrNoRows) {
+        return 0, false, nil
+    }
+    if err != nil {
+        return 0, false, err
+    }
+    return block, true, nil
+}
+
+// Close closes the database.
+func (s *SQLSink) Close() error {
+    return s.db.Close()
+}
+
+func (s *SQLSink) inTx(fn func(*sqlTx) error) error {
+    tx, err := s.Begin()
+    if err != nil {
+        return err
+    }
+    if err := fn(tx.(*sqlTx)); err != nil {
+        tx.Rollback()
+        return err
+    }
+    return tx.Commit()
+}
+
+// sqlTx is a Tx of an SQLSink.
+type sqlTx struct {
+    tx   *sql.Tx
+    name string
+}
+
+// Write stores evt, replacing the row of the same event, so a range
+// indexed again (reindex_overlap, a retried range) leaves one row per event.
+func (t *sqlTx) Write(evt Event) error {
+    key, err := sqlEventKey(evt)
+    if err != nil {
+        return Permanent(err)
+    }
+    fields, err := json.Marshal(evt)
+    if err != nil {
+        return Permanent(fmt.Errorf("failed to encode event: %w", err))
+    }
+    block, _ := evt["block_number"].(uint64)
+    contractName, _ := evt["contract_name"].(string)
+    eventName, _ := evt["event_name"].(string)
+    if _, err := t.tx.Exec(`DELETE FROM etl_events WHERE event_key = ?`, key); err != nil {
+        return err
+    }
+    _, err = t.tx.Exec(`INSERT INTO etl_events (event_key, block_number, contract_name, event_name, fields) VALUES (?, ?, ?, ?, ?)`,
+        key, block, contractName, eventName, string(fields))
+    return err
+}
+
+// Remove deletes the row of evt.
+func (t *sqlTx) Remove(evt Event) error {
+    key, err := sqlEventKey(evt)
+    if err != nil {
+        return Permanent(err)
+    }
+    _, err = t.tx.Exec(`DELETE FROM etl_events WHERE event_key = ?`, key)
+    return err
+}
+
+// SetCheckpoint stores block in the checkpoint row.
+func (t *sqlTx) SetCheckpoint(block uint64) error {
+    if _, err := t.tx.Exec(`DELETE FROM etl_checkpoints WHERE name = ?`, t.name); err != nil {
+        return err
+    }
+    _, err := t.tx.Exec(`INSERT INTO etl_checkpoints (name, block) VALUES (?, ?)`, t.name, block)
+    return err
+}
+
+func (t *sqlTx) Commit() error {
+    return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback() error {
+    return t.tx.Rollback()
+}
+
+// sqlEventKey identifies evt: its log for events, its block for block
+// records and its position in the call tree for traces.
+func sqlEventKey(evt Event) (string, error) {
+    name, _ := evt["event_name"].(string)
+    switch name {
+    case BlockEventName:
+        return fmt.Sprintf("block:%v", evt["block_number"]), nil
+    case TraceEventName:
+        return fmt.Sprintf("trace:%v:%v", evt["tx_hash"], evt["trace_address"]), nil
+    }
+    tx, ok := evt["tx_hash"].(string)
+    if !ok || evt["log_index"] == nil {
+        return "", fmt.Errorf("event %s has no tx_hash and log_index to key it by", name)
+    }
+    return fmt.Sprintf("%s:%v", tx, evt["log_index"]), nil
+}
@@ -0,0 +1,324 @@
+package sink
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memDB is the storage of the "memsql" test driver: the etl_events and
+// etl_checkpoints tables of SQLSink, understood by statement prefix.
+// Transactions work on a copy swapped in on commit. A statement starting
+// with failOn fails, as a database connection dropped by a crash would.
+type memDB struct {
+    mu          sync.Mutex
+    events      map[string]string // event_key → fields
+    checkpoints map[string]int64
+    failOn      string
+}
+
+var (
+    memDBsMu sync.Mutex
+    memDBs   = map[string]*memDB{}
+)
+
+func init() {
+    sql.Register("memsql", memDriver{})
+}
+
+// openMemDB returns a database of the memsql driver and its storage.
+func openMemDB(t *testing.T) (*sql.DB, *memDB) {
+    t.Helper()
+    store := &memDB{events: map[string]string{}, checkpoints: map[string]int64{}}
+    memDBsMu.Lock()
+    memDBs[t.Name()] = store
+    memDBsMu.Unlock()
+    db, err := sql.Open("memsql", t.Name())
+    if err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { db.Close() })
+    return db, store
+}
+
+func (m *memDB) rows() map[string]string {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    out := make(map[string]string, len(m.events))
+    for k, v := range m.events {
+        out[k] = v
+    }
+    return out
+}
+
+type memDriver struct{}
+
+func (memDriver) Open(name string) (driver.Conn, error) {
+    memDBsMu.Lock()
+    defer memDBsMu.Unlock()
+    store, ok := memDBs[name]
+    if !ok {
+        return nil, fmt.Errorf("unknown database %s", name)
+    }
+    return &memConn{db: store}, nil
+}
+
+// memConn runs statements on db, or on the copy of an open transaction.
+type memConn struct {
+    db *memDB
+    tx *memTx
+}
+
+type memTx struct {
+    conn        *memConn
+    events      map[string]string
+    checkpoints map[string]int64
+}
+
+func (c *memConn) Prepare(query string) (driver.Stmt, error) {
+    return &memStmt{conn: c, query: strings.Join(strings.Fields(query), " ")}, nil
+}
+
+func (c *memConn) Close() error { return nil }
+
+func (c *memConn) Begin() (driver.Tx, error) {
+    c.db.mu.Lock()
+    defer c.db.mu.Unlock()
+    tx := &memTx{conn: c, events: map[string]string{}, checkpoints: map[string]int64{}}
+    for k, v := range c.db.events {
+        tx.events[k] = v
+    }
+    for k, v := range c.db.checkpoints {
+        tx.checkpoints[k] = v
+    }
+    c.tx = tx
+    return tx, nil
+}
+
+func (tx *memTx) Commit() error {
+    db := tx.conn.db
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    db.events, db.checkpoints = tx.events, tx.checkpoints
+    tx.conn.tx = nil
+    return nil
+}
+
+func (tx *memTx) Rollback() error {
+    tx.conn.tx = nil
+    return nil
+}
+
+type memStmt struct {
+    conn  *memConn
+    query string
+}
+
+func (s *memStmt) Close() error  { return nil }
+func (s *memStmt) NumInput() int { return -1 }
+
+func (s *memStmt) Exec(args []driver.Value) (driver.Result, error) {
+    db := s.conn.db
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    if db.failOn != "" && strings.HasPrefix(s.query, db.failOn) {
+        return nil, errors.New("connection lost")
+    }
+    events, checkpoints := db.events, db.checkpoints
+    if tx := s.conn.tx; tx != nil {
+        events, checkpoints = tx.events, tx.checkpoints
+    }
+    switch {
+    case strings.HasPrefix(s.query, "CREATE TABLE"):
+    case strings.HasPrefix(s.query, "DELETE FROM etl_events"):
+        delete(events, args[0].(string))
+    case strings.HasPrefix(s.query, "INSERT INTO etl_events"):
+        key := args[0].(string)
+        if _, dup := events[key]; dup {
+            return nil, fmt.Errorf("duplicate primary key %s", key)
+        }
+        events[key] = args[4].(string)
+    case strings.HasPrefix(s.query, "DELETE FROM etl_checkpoints"):
+        delete(checkpoints, args[0].(string))
+    case strings.HasPrefix(s.query, "INSERT INTO etl_checkpoints"):
+        checkpoints[args[0].(string)] = args[1].(int64)
+    default:
+        return nil, fmt.Errorf("unexpected statement %q", s.query)
+    }
+    return driver.RowsAffected(1), nil
+}
+
+func (s *memStmt) Query(args []driver.Value) (driver.Rows, error) {
+    db := s.conn.db
+    db.mu.Lock()
+    defer db.mu.Unlock()
+    if !strings.HasPrefix(s.query, "SELECT block FROM etl_checkpoints") {
+        return nil, fmt.Errorf("unexpected query %q", s.query)
+    }
+    rows := &memRows{}
+    if block, ok := db.checkpoints[args[0].(string)]; ok {
+        rows.values = append(rows.values, block)
+    }
+    return rows, nil
+}
+
+type memRows struct {
+    values []int64
+}
+
+func (r *memRows) Columns() []string { return []string{"block"} }
+func (r *memRows) Close() error      { return nil }
+
+func (r *memRows) Next(dest []driver.Value) error {
+    if len(r.values) == 0 {
+        return io.EOF
+    }
+    dest[0], r.values = r.values[0], r.values[1:]
+    return nil
+}
+
+func newTestSQLSink(t *testing.T) (*SQLSink, *memDB) {
+    t.Helper()
+    db, store := openMemDB(t)
+    s, err := NewSQLSink(db, "")
+    if err != nil {
+        t.Fatalf("NewSQLSink: %v", err)
+    }
+    return s, store
+}
+
+func TestSQLSinkWritesOneRowPerEvent(t *testing.T) {
+    s, store := newTestSQLSink(t)
+    evt := transferEvent(7)
+    evt["log_index"] = uint64(2)
+    for i := 0; i < 2; i++ {
+        if err := s.Write(evt); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    block := Event{"event_name": BlockEventName, "block_number": uint64(7), "block_hash": "0x07"}
+    if err := s.Write(block); err != nil {
+        t.Fatalf("Write block: %v", err)
+    }
+
+    rows := store.rows()
+    if len(rows) != 2 {
+        t.Fatalf("rows = %v, want the event once and the block record", rows)
+    }
+    var fields map[string]any
+    if err := json.Unmarshal([]byte(rows[fmt.Sprintf("0x%064x:2", 7)]), &fields); err != nil || fields["value"] != "1" || fields["event_name"] != "Transfer" {
+        t.Errorf("stored fields = %v (%v)", fields, err)
+    }
+    if _, ok := rows["block:7"]; !ok {
+        t.Errorf("block record missing: %v", rows)
+    }
+
+    if err := s.Remove(evt); err != nil {
+        t.Fatalf("Remove: %v", err)
+    }
+    if rows := store.rows(); len(rows) != 1 {
+        t.Fatalf("rows after Remove = %v, want the block record only", rows)
+    }
+    if err := s.Write(Event{"event_name": "Transfer"}); err == nil || !IsPermanent(err) {
+        t.Errorf("Write without tx_hash = %v, want a permanent error", err)
+    }
+}
+
+func TestSQLSinkCommitsRowsWithCheckpoint(t *testing.T) {
+    s, store := newTestSQLSink(t)
+    if _, ok, err := s.Checkpoint(); ok || err != nil {
+        t.Fatalf("Checkpoint of an empty database = %v, %v", ok, err)
+    }
+
+    tx, err := s.Begin()
+    if err != nil {
+        t.Fatalf("Begin: %v", err)
+    }
+    for b := uint64(1); b <= 3; b++ {
+        evt := transferEvent(b)
+        evt["log_index"] = uint64(0)
+        if err := tx.Write(evt); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    if err := tx.SetCheckpoint(9); err != nil {
+        t.Fatalf("SetCheckpoint: %v", err)
+    }
+    if rows := store.rows(); len(rows) != 0 {
+        t.Fatalf("rows visible before Commit: %v", rows)
+    }
+    if err := tx.Commit(); err != nil {
+        t.Fatalf("Commit: %v", err)
+    }
+    if block, ok, err := s.Checkpoint(); !ok || err != nil || block != 9 {
+        t.Fatalf("Checkpoint = %d, %v, %v; want 9", block, ok, err)
+    }
+    if rows := store.rows(); len(rows) != 3 {
+        t.Fatalf("rows = %d, want 3", len(rows))
+    }
+}
+
+func TestSQLSinkCrashBeforeCheckpointKeepsNeither(t *testing.T) {
+    s, store := newTestSQLSink(t)
+    tx, _ := s.Begin()
+    first := transferEvent(1)
+    first["log_index"] = uint64(0)
+    tx.Write(first)
+    tx.SetCheckpoint(9)
+    if err := tx.Commit(); err != nil {
+        t.Fatalf("Commit: %v", err)
+    }
+
+    // The rows of the next range are inserted, then the connection is lost
+    // before the checkpoint is stored.
+    store.failOn = "INSERT INTO etl_checkpoints"
+    tx, _ = s.Begin()
+    second := transferEvent(15)
+    second["log_index"] = uint64(0)
+    if err := tx.Write(second); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := tx.SetCheckpoint(19); err == nil {
+        t.Fatal("SetCheckpoint succeeded despite the lost connection")
+    }
+    tx.Rollback()
+
+    if block, _, _ := s.Checkpoint(); block != 9 {
+        t.Errorf("checkpoint = %d, want 9", block)
+    }
+    if rows := store.rows(); len(rows) != 1 {
+        t.Errorf("rows = %v, want only the committed range", rows)
+    }
+}
+
+func TestSQLSinkStoresTokenIDsExactly(t *testing.T) {
+    s, store := newTestSQLSink(t)
+    // 2^64 + 1 overflows an int64 and is rounded by a float64.
+    const id = "18446744073709551617"
+    evt := transferEvent(7)
+    evt["log_index"] = uint64(0)
+    evt["tokenId"] = id
+    evt["ids"] = `["` + id + `","1"]`
+    if err := s.Write(evt); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+
+    dec := json.NewDecoder(strings.NewReader(store.rows()[fmt.Sprintf("0x%064x:0", 7)]))
+    dec.UseNumber()
+    var fields map[string]any
+    if err := dec.Decode(&fields); err != nil {
+        t.Fatal(err)
+    }
+    if fields["tokenId"] != id {
+        t.Errorf("stored tokenId = %#v, want %q", fields["tokenId"], id)
+    }
+    if fields["ids"] != `["`+id+`","1"]` {
+        t.Errorf("stored ids = %#v", fields["ids"])
+    }
+}
@@ -0,0 +1,28 @@
+package sink
+
+// SourceEventColumn is the discriminator column added to rows routed to a
+// shared table by storage.table_map, holding the "<contract>.<event>" pair
+// the row came from.
+const SourceEventColumn = "source_event"
+
+// mappedTable returns the table storage.table_map routes evt to, along with
+// its "<contract>.<event>" source. ok is false when the event keeps its own
+// table. An entry for the contract wins over a "*.<event>" one.
+func mappedTable(tableMap map[string]string, evt Event) (table, source string, ok bool) {
+    if len(tableMap) == 0 {
+        return "", "", false
+    }
+    name, _ := evt["event_name"].(string)
+    if name == "" || name == BlockEventName || name == TraceEventName {
+        return "", "", false
+    }
+    contractName, _ := evt["contract_name"].(string)
+    source = contractName + "." + name
+    if table, ok = tableMap[source]; ok {
+        return table, source, true
+    }
+    if table, ok = tableMap["*."+name]; ok {
+        return table, source, true
+    }
+    return "", "", false
+}
@@ -0,0 +1,86 @@
+package sink
+
+import (
+	"errors"
+	"io"
+)
+
+// TeeSink fans every event out to several sinks, e.g. to write CSV and MySQL
+// side by side during a migration.
+//
+// In best-effort mode (the default) every inner sink receives the event and
+// all failures are joined into the returned error. In fail-fast mode the
+// first failure stops the fan-out, so later sinks don't receive the event.
+//
+// Note that when wrapped by a RetrySink a failed write is retried on all
+// inner sinks, so sinks that already succeeded may receive duplicates.
+type TeeSink struct {
+    sinks    []Sink
+    failFast bool
+}
+
+// NewTeeSink builds a best-effort TeeSink over the given sinks. Nil sinks are
+// ignored.
+func NewTeeSink(sinks ...Sink) *TeeSink {
+    t := &TeeSink{}
+    for _, s := range sinks {
+        if s != nil {
+            t.sinks = append(t.sinks, s)
+        }
+    }
+    return t
+}
+
+// FailFast switches the sink to stop at the first failing inner sink.
+func (t *TeeSink) FailFast(enabled bool) *TeeSink {
+    t.failFast = enabled
+    return t
+}
+
+// Write forwards the event to every inner sink.
+func (t *TeeSink) Write(evt Event) error {
+    return t.each(func(s Sink) error { return s.Write(evt) })
+}
+
+// Remove retracts the event from every inner sink (see sink.Remove).
+func (t *TeeSink) Remove(evt Event) error {
+    return t.each(func(s Sink) error { return Remove(s, evt) })
+}
+
+// each applies fn to every inner sink honouring the fail-fast setting.
+func (t *TeeSink) each(fn func(Sink) error) error {
+    var errs []error
+    for _, s := range t.sinks {
+        if err := fn(s); err != nil {
+            if t.failFast {
+                return err
+            }
+            errs = append(errs, err)
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// Flush flushes every inner sink implementing Flusher and joins the errors.
+func (t *TeeSink) Flush() error {
+    var errs []error
+    for _, s := range t.sinks {
+        if err := Flush(s); err != nil {
+            errs = append(errs, err)
+        }
+    }
+    return errors.Join(errs...)
+}
+
+// Close closes every inner sink implementing io.Closer and joins the errors.
+func (t *TeeSink) Close() error {
+    var errs []error
+    for _, s := range t.sinks {
+        if c, ok := s.(io.Closer); ok {
+            if err := c.Close(); err != nil {
+                errs = append(errs, err)
+            }
+        }
+    }
+    return errors.Join(errs...)
+}
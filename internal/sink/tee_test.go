@@ -0,0 +1,104 @@
+package sink
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"etl-web3/internal/config"
+)
+
+// removeRecorder is a closeRecorder that also records retracted events.
+type removeRecorder struct {
+    closeRecorder
+    removed []Event
+}
+
+func (r *removeRecorder) Remove(evt Event) error {
+    r.removed = append(r.removed, evt)
+    return nil
+}
+
+func TestTeeSinkWritesToEverySink(t *testing.T) {
+    a, b := &closeRecorder{}, &removeRecorder{}
+    tee := NewTeeSink(a, nil, b)
+    for i := uint64(1); i <= 3; i++ {
+        if err := tee.Write(transferEvent(i)); err != nil {
+            t.Fatalf("Write: %v", err)
+        }
+    }
+    if err := tee.Remove(transferEvent(2)); err != nil {
+        t.Fatalf("Remove: %v", err)
+    }
+    if err := tee.Flush(); err != nil {
+        t.Fatalf("Flush: %v", err)
+    }
+    if err := tee.Close(); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+
+    // Sinks without Remove get the retraction as a tombstone row.
+    if a.writes != 4 || a.flushes != 1 || a.closes != 1 {
+        t.Errorf("first sink: %+v, want 4 writes, 1 flush and 1 close", *a)
+    }
+    if b.writes != 3 || len(b.removed) != 1 || b.removed[0]["block_number"] != uint64(2) || b.flushes != 1 || b.closes != 1 {
+        t.Errorf("second sink: %+v, want 3 writes, block 2 removed, 1 flush and 1 close", *b)
+    }
+}
+
+func TestTeeSinkPropagatesErrors(t *testing.T) {
+    errA, errB := errors.New("csv disk full"), errors.New("mysql gone")
+
+    // Best effort: every sink gets the event and every failure is reported.
+    ok := &closeRecorder{}
+    err := NewTeeSink(failingSink{errA}, ok, failingSink{errB}).Write(transferEvent(1))
+    if !errors.Is(err, errA) || !errors.Is(err, errB) {
+        t.Errorf("best-effort Write = %v, want both failures", err)
+    }
+    if ok.writes != 1 {
+        t.Errorf("healthy sink got %d writes, want 1", ok.writes)
+    }
+
+    // Fail fast: the first failure stops the fan-out.
+    ok = &closeRecorder{}
+    err = NewTeeSink(failingSink{errA}, ok, failingSink{errB}).FailFast(true).Write(transferEvent(1))
+    if !errors.Is(err, errA) || errors.Is(err, errB) {
+        t.Errorf("fail-fast Write = %v, want the first failure only", err)
+    }
+    if ok.writes != 0 {
+        t.Errorf("sink after the failure got %d writes, want none", ok.writes)
+    }
+
+    if err := NewTeeSink(ok, &closeRecorder{}).Write(transferEvent(1)); err != nil {
+        t.Errorf("Write without failures = %v", err)
+    }
+}
+
+func TestBuildMirrorsToEverySink(t *testing.T) {
+    var cfg config.StorageConfig
+    cfg.Type = "csv"
+    cfg.Mirror = []string{"parquet"}
+    cfg.CSV.OutputDir = filepath.Join(t.TempDir(), "csv")
+    cfg.Parquet.OutputDir = filepath.Join(t.TempDir(), "parquet")
+    s, err := Build(cfg)
+    if err != nil {
+        t.Fatalf("Build: %v", err)
+    }
+    if _, ok := s.(*TeeSink); !ok {
+        t.Fatalf("Build with a mirror = %T, want a TeeSink", s)
+    }
+    if err := s.Write(transferEvent(7)); err != nil {
+        t.Fatalf("Write: %v", err)
+    }
+    if err := Close(s); err != nil {
+        t.Fatalf("Close: %v", err)
+    }
+    for _, dir := range []string{cfg.CSV.OutputDir, cfg.Parquet.OutputDir} {
+        entries, err := os.ReadDir(dir)
+        if err != nil || len(entries) == 0 || !strings.HasPrefix(entries[0].Name(), "Token_Transfer") {
+            t.Errorf("%s holds %v (%v), want the Transfer file", dir, entries, err)
+        }
+    }
+}
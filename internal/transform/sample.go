@@ -0,0 +1,97 @@
+package transform
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+)
+
+// SampleEvery keeps about one in n events, chosen by a hash of the event's
+// (tx_hash, log_index): the same events are kept whatever the order ranges
+// complete in, across runs and worker counts. Tombstones of removed events
+// get the decision of the event they retract.
+func SampleEvery(n int) Transformer {
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        if n <= 1 || sampleHash(evt)%uint64(n) == 0 {
+            return evt, nil
+        }
+        return nil, nil
+    })
+}
+
+// sampleHash hashes the identity of an event, its transaction hash and log
+// index.
+func sampleHash(evt sink.Event) uint64 {
+    h := fnv.New64a()
+    fmt.Fprintf(h, "%v\x00%v", evt["tx_hash"], evt["log_index"])
+    return h.Sum64()
+}
+
+// SamplePer keeps the first event of each contract/event type per bucket of
+// block time (the event's timestamp). Events without a timestamp are kept.
+// With several workers, ranges complete out of order and a bucket spanning a
+// range boundary may keep one event per range.
+func SamplePer(bucket time.Duration) Transformer {
+    size := uint64(bucket / time.Second)
+    var (
+        mu   sync.Mutex
+        last = make(map[string]uint64) // bucket index + 1 of the last kept event
+    )
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        ts, ok := evt["timestamp"].(uint64)
+        if removed, _ := evt["removed"].(bool); removed || !ok || size == 0 {
+            return evt, nil
+        }
+        key := sampleKey(evt)
+        b := ts/size + 1
+        mu.Lock()
+        defer mu.Unlock()
+        if last[key] == b {
+            return nil, nil
+        }
+        last[key] = b
+        return evt, nil
+    })
+}
+
+// sampleKey identifies the event type counters are kept for.
+func sampleKey(evt sink.Event) string {
+    contract, _ := evt["contract_name"].(string)
+    name, _ := evt["event_name"].(string)
+    return contract + "\x00" + name
+}
+
+// FromSamples builds the sampling steps configured on the contracts.
+func FromSamples(contracts []config.ContractConfig) (Chain, error) {
+    var chain Chain
+    for _, c := range contracts {
+        for event, s := range c.Sample {
+            if err := config.ValidateSample(s); err != nil {
+                return nil, fmt.Errorf("contract '%s' sample.%s: %w", c.Name, event, err)
+            }
+            t := SampleEvery(s.Every)
+            if s.Per != "" {
+                bucket, _ := s.Bucket()
+                t = SamplePer(bucket)
+            }
+            chain = append(chain, onlyContractEvent(c.Name, config.EventName(c, event), t))
+        }
+    }
+    return chain, nil
+}
+
+// onlyContractEvent applies t to the events named event of one contract.
+func onlyContractEvent(contract, event string, t Transformer) Transformer {
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        c, _ := evt["contract_name"].(string)
+        n, _ := evt["event_name"].(string)
+        if c != contract || n != event {
+            return evt, nil
+        }
+        return t.Transform(evt)
+    })
+}
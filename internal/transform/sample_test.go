@@ -0,0 +1,94 @@
+package transform
+
+import (
+	"fmt"
+	"testing"
+
+	"etl-web3/internal/sink"
+)
+
+// oracleUpdates returns n AnswerUpdated events, one per transaction.
+func oracleUpdates(n int) []sink.Event {
+    events := make([]sink.Event, n)
+    for i := range events {
+        events[i] = sink.Event{
+            "contract_name": "Feed",
+            "event_name":    "AnswerUpdated",
+            "tx_hash":       fmt.Sprintf("0x%064x", i),
+            "log_index":     uint64(i % 3),
+        }
+    }
+    return events
+}
+
+// kept returns the indexes of the events t keeps, running them in order.
+func kept(t *testing.T, tr Transformer, events []sink.Event, order []int) map[int]bool {
+    t.Helper()
+    out := map[int]bool{}
+    for _, i := range order {
+        evt, err := tr.Transform(copyEvent(events[i]))
+        if err != nil {
+            t.Fatalf("Transform: %v", err)
+        }
+        if evt != nil {
+            out[i] = true
+        }
+    }
+    return out
+}
+
+func copyEvent(evt sink.Event) sink.Event {
+    out := make(sink.Event, len(evt))
+    for k, v := range evt {
+        out[k] = v
+    }
+    return out
+}
+
+func TestSampleEveryIsIndependentOfOrder(t *testing.T) {
+    events := oracleUpdates(1000)
+    forward := make([]int, len(events))
+    backward := make([]int, len(events))
+    for i := range events {
+        forward[i], backward[i] = i, len(events)-1-i
+    }
+
+    first := kept(t, SampleEvery(10), events, forward)
+    second := kept(t, SampleEvery(10), events, backward)
+    if len(first) != len(second) {
+        t.Fatalf("kept %d events in order, %d in reverse", len(first), len(second))
+    }
+    for i := range first {
+        if !second[i] {
+            t.Fatalf("event %d kept in order but not in reverse", i)
+        }
+    }
+    // About one in ten.
+    if len(first) < 60 || len(first) > 140 {
+        t.Fatalf("kept %d of 1000 events with every: 10", len(first))
+    }
+}
+
+func TestSampleEveryTombstonesFollowTheirEvent(t *testing.T) {
+    tr := SampleEvery(4)
+    for _, evt := range oracleUpdates(100) {
+        written, _ := tr.Transform(copyEvent(evt))
+        tombstone := copyEvent(evt)
+        tombstone["removed"] = true
+        retracted, _ := tr.Transform(tombstone)
+        if (written == nil) != (retracted == nil) {
+            t.Fatalf("event %v kept=%v but its tombstone kept=%v", evt["tx_hash"], written != nil, retracted != nil)
+        }
+    }
+}
+
+func TestSampleEveryOneKeepsAll(t *testing.T) {
+    events := oracleUpdates(20)
+    order := make([]int, len(events))
+    for i := range order {
+        order[i] = i
+    }
+    if got := kept(t, SampleEvery(1), events, order); len(got) != len(events) {
+        t.Fatalf("every: 1 kept %d of %d events", len(got), len(events))
+    }
+}
@@ -0,0 +1,140 @@
+// Package transform post-processes decoded events between the parser and the
+// sink: renaming fields, injecting constants or computed values, or dropping
+// events altogether.
+package transform
+
+import (
+	"fmt"
+	"strings"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/sink"
+)
+
+// Transformer rewrites an event before it is written. Returning a nil event
+// drops it; returning an error fails the block range like a sink error.
+// Implementations may modify evt in place and must be safe for concurrent use.
+type Transformer interface {
+    Transform(sink.Event) (sink.Event, error)
+}
+
+// Func adapts a function to the Transformer interface.
+type Func func(sink.Event) (sink.Event, error)
+
+// Transform calls f.
+func (f Func) Transform(evt sink.Event) (sink.Event, error) {
+    return f(evt)
+}
+
+// Chain applies transformers in order, stopping as soon as one drops the
+// event.
+type Chain []Transformer
+
+// Transform runs evt through every transformer of the chain.
+func (c Chain) Transform(evt sink.Event) (sink.Event, error) {
+    var err error
+    for _, t := range c {
+        if evt, err = t.Transform(evt); err != nil || evt == nil {
+            return nil, err
+        }
+    }
+    return evt, nil
+}
+
+// Rename moves the value of field from to field to. Events without from are
+// left untouched.
+func Rename(from, to string) Transformer {
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        if v, ok := evt[from]; ok {
+            delete(evt, from)
+            evt[to] = v
+        }
+        return evt, nil
+    })
+}
+
+// Set adds field with a constant value, overwriting any existing value.
+func Set(field string, value interface{}) Transformer {
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        evt[field] = value
+        return evt, nil
+    })
+}
+
+// Compute sets field to the value returned by fn, e.g. a USD value from a
+// price lookup. An error from fn fails the event.
+func Compute(field string, fn func(sink.Event) (interface{}, error)) Transformer {
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        v, err := fn(evt)
+        if err != nil {
+            return nil, fmt.Errorf("compute %s: %w", field, err)
+        }
+        evt[field] = v
+        return evt, nil
+    })
+}
+
+// Concat sets field to the values of fields joined by sep, e.g. a
+// "<tx_hash>-<log_index>" key. Missing fields contribute an empty string.
+func Concat(field string, fields []string, sep string) Transformer {
+    return Compute(field, func(evt sink.Event) (interface{}, error) {
+        parts := make([]string, len(fields))
+        for i, f := range fields {
+            if v, ok := evt[f]; ok && v != nil {
+                parts[i] = fmt.Sprint(v)
+            }
+        }
+        return strings.Join(parts, sep), nil
+    })
+}
+
+// Drop discards events whose field renders (fmt.Sprint) as value.
+func Drop(field, value string) Transformer {
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        if v, ok := evt[field]; ok && fmt.Sprint(v) == value {
+            return nil, nil
+        }
+        return evt, nil
+    })
+}
+
+// OnlyEvents restricts t to events whose event_name is listed; other events
+// pass through unchanged. An empty list applies t to every event.
+func OnlyEvents(names []string, t Transformer) Transformer {
+    if len(names) == 0 {
+        return t
+    }
+    set := make(map[string]bool, len(names))
+    for _, n := range names {
+        set[n] = true
+    }
+    return Func(func(evt sink.Event) (sink.Event, error) {
+        if name, _ := evt["event_name"].(string); !set[name] {
+            return evt, nil
+        }
+        return t.Transform(evt)
+    })
+}
+
+// FromConfig builds the chain described by the transforms section.
+func FromConfig(cfgs []config.TransformConfig) (Chain, error) {
+    chain := make(Chain, 0, len(cfgs))
+    for i, c := range cfgs {
+        if err := config.ValidateTransform(c); err != nil {
+            return nil, fmt.Errorf("transforms[%d]: %w", i, err)
+        }
+        var t Transformer
+        switch c.Type {
+        case config.TransformRename:
+            t = Rename(c.From, c.To)
+        case config.TransformSet:
+            t = Set(c.Field, c.Value)
+        case config.TransformConcat:
+            t = Concat(c.Field, c.Fields, c.Separator)
+        case config.TransformDrop:
+            t = Drop(c.Field, c.Value)
+        }
+        chain = append(chain, OnlyEvents(c.Events, t))
+    }
+    return chain, nil
+}
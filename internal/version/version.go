@@ -0,0 +1,36 @@
+// Package version holds build information injected at link time:
+//
+//	go build -ldflags "-X etl-web3/internal/version.Version=v1.2.0 \
+//	    -X etl-web3/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	    -X etl-web3/internal/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)" ./cmd/indexer.go
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Set with -ldflags "-X"; the defaults identify a development build.
+var (
+    Version = "dev"
+    Commit  = "unknown"
+    Date    = "unknown"
+)
+
+// Info describes the running build.
+type Info struct {
+    Version   string `json:"version"`
+    Commit    string `json:"commit"`
+    Date      string `json:"date"`
+    GoVersion string `json:"go_version"`
+}
+
+// Get returns the build information of the running binary.
+func Get() Info {
+    return Info{Version: Version, Commit: Commit, Date: Date, GoVersion: runtime.Version()}
+}
+
+// String formats the build information on a single line.
+func (i Info) String() string {
+    return fmt.Sprintf("%s (commit %s, built %s, %s)", i.Version, i.Commit, i.Date, i.GoVersion)
+}
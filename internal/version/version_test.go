@@ -0,0 +1,23 @@
+package version
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGetReportsLinkedValues(t *testing.T) {
+    if got := Get(); got != (Info{Version: "dev", Commit: "unknown", Date: "unknown", GoVersion: runtime.Version()}) {
+        t.Errorf("Get() of a development build = %+v", got)
+    }
+
+    defer func(v, c, d string) { Version, Commit, Date = v, c, d }(Version, Commit, Date)
+    Version, Commit, Date = "v1.2.0", "abc1234", "2026-01-02T03:04:05Z"
+    info := Get()
+    if info.Version != "v1.2.0" || info.Commit != "abc1234" || info.Date != "2026-01-02T03:04:05Z" {
+        t.Errorf("Get() = %+v", info)
+    }
+    want := "v1.2.0 (commit abc1234, built 2026-01-02T03:04:05Z, " + runtime.Version() + ")"
+    if got := info.String(); got != want {
+        t.Errorf("String() = %q, want %q", got, want)
+    }
+}
@@ -0,0 +1,165 @@
+// Package etl is the public entrypoint for embedding the indexer in another
+// Go program. It re-exports the few types a caller needs and hides the
+// packages under internal/, which remain free to change.
+//
+// A minimal embedding with a custom sink:
+//
+//	type printSink struct{}
+//
+//	func (printSink) Write(evt etl.Event) error {
+//	    fmt.Println(evt["event_name"], evt["tx_hash"])
+//	    return nil
+//	}
+//
+//	cfg, err := etl.LoadConfig("config.yaml")
+//	if err != nil {
+//	    log.Fatal(err)
+//	}
+//	summary, err := etl.Run(ctx, cfg, printSink{})
+package etl
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"etl-web3/internal/config"
+	"etl-web3/internal/indexer"
+	"etl-web3/internal/rpc"
+	"etl-web3/internal/sink"
+	"etl-web3/internal/transform"
+)
+
+type (
+    // Config is the indexer configuration, as read by LoadConfig.
+    Config = config.Config
+    // ContractConfig describes one contract of Config.Contracts.
+    ContractConfig = config.ContractConfig
+    // Event is a decoded log (or block record) handed to the sink.
+    Event = sink.Event
+    // Sink receives every decoded event.
+    Sink = sink.Sink
+    // TransactionalSink is a Sink committing each block range atomically
+    // with the checkpoint (e.g. a SQL database).
+    TransactionalSink = sink.TransactionalSink
+    // Tx is an open transaction of a TransactionalSink.
+    Tx = sink.Tx
+    // RangeReporter is a Sink reporting the block ranges it already holds,
+    // which a restarted run skips.
+    RangeReporter = sink.RangeReporter
+    // Range is an inclusive block range reported by a RangeReporter.
+    Range = sink.Range
+    // StorageConfig is the storage section passed to sink factories.
+    StorageConfig = config.StorageConfig
+    // SinkFactory builds a sink for a registered storage type.
+    SinkFactory = sink.Factory
+    // StorageField describes a setting of a storage type for DescribeSink.
+    StorageField = sink.Field
+    // Progress is a snapshot delivered after every completed block range.
+    Progress = indexer.Progress
+    // Summary reports a completed run.
+    Summary = indexer.Summary
+    // Transformer rewrites (or, by returning nil, drops) events before they
+    // reach the sink.
+    Transformer = transform.Transformer
+    // TransformFunc adapts a function to Transformer.
+    TransformFunc = transform.Func
+)
+
+// Options tunes Run. The zero value is valid.
+type Options struct {
+    // OnProgress, when set, receives a snapshot after every block range.
+    OnProgress func(Progress)
+    // Transformers run, in order, after the transforms of cfg.
+    Transformers []Transformer
+}
+
+// Permanent marks an error returned by a custom sink as one retrying cannot
+// fix, so it is not retried.
+func Permanent(err error) error {
+    return sink.Permanent(err)
+}
+
+// NewSQLSink returns a TransactionalSink storing events in db, which may
+// use any database/sql driver understanding MySQL-style "?" placeholders
+// (MySQL, SQLite). name selects its checkpoint row; empty means "default".
+func NewSQLSink(db *sql.DB, name string) (Sink, error) {
+    return sink.NewSQLSink(db, name)
+}
+
+// RegisterSink makes a custom storage type selectable through storage.type
+// in configuration files loaded afterwards. Call it from an init function.
+func RegisterSink(name string, factory SinkFactory) {
+    sink.Register(name, factory)
+}
+
+// DescribeSink records the settings of a storage type registered with
+// RegisterSink, listed by the API under GET /storage/types.
+func DescribeSink(name string, fields ...StorageField) {
+    sink.Describe(name, fields...)
+}
+
+// LoadConfig reads, validates and applies defaults to a YAML configuration
+// file, exactly like the indexer binary does.
+func LoadConfig(path string) (*Config, error) {
+    return config.Load(path)
+}
+
+// Run indexes cfg into sk until the configured range is done (or, in follow
+// mode, until ctx is cancelled). Events go to sk, wrapped with the configured
+// retry policy; of cfg.Storage only the schema and dead_letter settings
+// apply. A single-chain configuration is expected; use Config.ChainConfigs
+// to run several chains. sk is flushed before Run returns when it has a
+// Flush() error method, but closing it is left to the caller.
+func Run(ctx context.Context, cfg *Config, sk Sink, opts ...Options) (*Summary, error) {
+    if len(cfg.Chains) > 0 {
+        return nil, fmt.Errorf("etl.Run expects a single-chain config, expand it with ChainConfigs")
+    }
+    if sk == nil {
+        return nil, fmt.Errorf("etl.Run requires a sink")
+    }
+
+    client, err := rpc.Dial(ctx, cfg.RPCURL, cfg.Retry, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent))
+    if err != nil {
+        return nil, fmt.Errorf("failed to connect to RPC: %w", err)
+    }
+    defer client.Close()
+    client.WithCallTimeout(cfg.RPCTimeout())
+    if cfg.Follow && cfg.RPCWSURL != "" {
+        if err := client.DialSubscriptions(ctx, cfg.RPCWSURL, cfg.RPCTransport, rpc.WithUserAgent(cfg.RPCUserAgent)); err != nil {
+            return nil, err
+        }
+    }
+
+    checked, err := sink.WithSchema(sk, cfg.Storage)
+    if err != nil {
+        return nil, err
+    }
+    wrapped, err := sink.WithDeadLetter(sink.NewRetrySink(checked, cfg.Retry.Attempts, cfg.Retry.DelayMS), cfg.Storage)
+    if err != nil {
+        return nil, err
+    }
+    // sk belongs to the caller: only the dead-letter file is closed here.
+    if dl, ok := wrapped.(*sink.DeadLetterSink); ok {
+        defer dl.CloseFile()
+    }
+
+    // sk replaces the configured storage: clear its type so the indexer
+    // does not write a CSV manifest next to output it never produced.
+    runCfg := *cfg
+    runCfg.Storage.Type, runCfg.Storage.Mirror = "", nil
+    idx := indexer.New(&runCfg, client, wrapped)
+    for _, o := range opts {
+        if o.OnProgress != nil {
+            idx.OnProgress(o.OnProgress)
+        }
+        idx.AddTransformers(o.Transformers...)
+    }
+    err = idx.Run(ctx)
+    // Push rows buffered by the sink (see sink.Flusher) to storage, even on
+    // error, so they are not lost if the caller exits without closing it.
+    if ferr := sink.Flush(wrapped); ferr != nil && err == nil {
+        err = fmt.Errorf("failed to flush sink: %w", ferr)
+    }
+    return idx.Summary(), err
+}
@@ -0,0 +1,299 @@
+package etl_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"etl-web3/pkg/etl"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// The tests use the package from outside, as an embedding program would.
+
+const transferABI = `[{"anonymous":false,"type":"event","name":"Transfer","inputs":[
+	{"indexed":true,"name":"from","type":"address"},
+	{"indexed":true,"name":"to","type":"address"},
+	{"indexed":false,"name":"value","type":"uint256"}]}]`
+
+var (
+    tokenAddress = common.HexToAddress("0x00000000000000000000000000000000000000a1")
+    transferID   = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+    // senderKey signs the transactions served by the fake node.
+    senderKey, _ = crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+)
+
+// transferLog returns a Transfer log of value emitted by tokenAddress.
+func transferLog(block uint64, index uint, value int64) types.Log {
+    return types.Log{
+        Address:     tokenAddress,
+        Topics:      []common.Hash{transferID, common.HexToHash("0x01"), common.HexToHash("0x02")},
+        Data:        common.LeftPadBytes(big.NewInt(value).Bytes(), 32),
+        BlockNumber: block,
+        TxHash:      common.BigToHash(new(big.Int).SetUint64(block*1000 + uint64(index))),
+        Index:       index,
+    }
+}
+
+// startNode serves a JSON-RPC chain of head+1 blocks holding logs. Every
+// transaction is sent by senderKey's address.
+func startNode(head uint64, logs ...types.Log) *httptest.Server {
+    tx, err := types.SignTx(types.NewTx(&types.LegacyTx{Nonce: 1, To: &tokenAddress, Gas: 60_000, GasPrice: big.NewInt(1)}), types.HomesteadSigner{}, senderKey)
+    if err != nil {
+        panic(err)
+    }
+    answer := func(method string, params []json.RawMessage) (any, error) {
+        switch method {
+        case "eth_blockNumber":
+            return hexutil.Uint64(head), nil
+        case "eth_chainId":
+            return hexutil.Uint64(1), nil
+        case "net_version":
+            return "1", nil
+        case "eth_getBlockByNumber":
+            var num hexutil.Uint64
+            if err := json.Unmarshal(params[0], &num); err != nil {
+                num = hexutil.Uint64(head)
+            }
+            return &types.Header{Number: new(big.Int).SetUint64(uint64(num)), Time: 1_700_000_000 + uint64(num)*12, Difficulty: big.NewInt(0)}, nil
+        case "eth_getTransactionByHash":
+            return tx, nil
+        case "eth_getLogs":
+            var q struct {
+                FromBlock hexutil.Uint64 `json:"fromBlock"`
+                ToBlock   hexutil.Uint64 `json:"toBlock"`
+            }
+            if err := json.Unmarshal(params[0], &q); err != nil {
+                return nil, err
+            }
+            out := []types.Log{}
+            for _, lg := range logs {
+                if lg.BlockNumber >= uint64(q.FromBlock) && lg.BlockNumber <= uint64(q.ToBlock) {
+                    out = append(out, lg)
+                }
+            }
+            return out, nil
+        }
+        return nil, fmt.Errorf("the method %s does not exist/is not available", method)
+    }
+    return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        var req struct {
+            ID     json.RawMessage   `json:"id"`
+            Method string            `json:"method"`
+            Params []json.RawMessage `json:"params"`
+        }
+        if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+            http.Error(w, err.Error(), http.StatusBadRequest)
+            return
+        }
+        resp := map[string]any{"jsonrpc": "2.0", "id": req.ID}
+        if result, err := answer(req.Method, req.Params); err != nil {
+            resp["error"] = map[string]any{"code": -32601, "message": err.Error()}
+        } else {
+            resp["result"] = result
+        }
+        w.Header().Set("Content-Type", "application/json")
+        json.NewEncoder(w).Encode(resp)
+    }))
+}
+
+// storageSection is the storage of test configs. LoadConfig validates it
+// although Run writes to the sink it is given instead.
+const storageSection = `storage:
+  type: csv
+  csv:
+    output_dir: out
+`
+
+// writeConfig writes a config indexing the Transfer events of tokenAddress
+// from rpcURL, with extra appended, into dir and returns its path.
+func writeConfig(dir, rpcURL, extra string) (string, error) {
+    if err := os.WriteFile(filepath.Join(dir, "token.json"), []byte(transferABI), 0o644); err != nil {
+        return "", err
+    }
+    cfg := `rpc_url: ` + rpcURL + `
+start_block: 0
+chunk_size: 10
+workers: 1
+retry:
+  attempts: 2
+  delay_ms: 1
+contracts:
+  - name: Token
+    address: "` + tokenAddress.Hex() + `"
+    abi: token.json
+    events: [Transfer]
+` + storageSection + extra
+    path := filepath.Join(dir, "config.yaml")
+    return path, os.WriteFile(path, []byte(cfg), 0o644)
+}
+
+func loadConfig(t *testing.T, rpcURL, extra string) *etl.Config {
+    t.Helper()
+    path, err := writeConfig(t.TempDir(), rpcURL, extra)
+    if err != nil {
+        t.Fatal(err)
+    }
+    cfg, err := etl.LoadConfig(path)
+    if err != nil {
+        t.Fatalf("LoadConfig: %v", err)
+    }
+    return cfg
+}
+
+// recordingSink is a custom sink keeping what it is given. err, when set,
+// is returned by every Write.
+type recordingSink struct {
+    mu      sync.Mutex
+    events  []etl.Event
+    writes  int
+    flushes int
+    err     error
+}
+
+func (s *recordingSink) Write(evt etl.Event) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.writes++
+    if s.err != nil {
+        return s.err
+    }
+    s.events = append(s.events, evt)
+    return nil
+}
+
+func (s *recordingSink) Flush() error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.flushes++
+    return nil
+}
+
+func TestRunIndexesIntoCustomSink(t *testing.T) {
+    node := startNode(29, transferLog(3, 0, 10), transferLog(12, 0, 20), transferLog(12, 1, 30), transferLog(25, 0, 40))
+    defer node.Close()
+    cfg := loadConfig(t, node.URL, "")
+
+    var progress []etl.Progress
+    opts := etl.Options{
+        OnProgress: func(p etl.Progress) { progress = append(progress, p) },
+        Transformers: []etl.Transformer{
+            // Drops the transfer of 30, then tags the others.
+            etl.TransformFunc(func(evt etl.Event) (etl.Event, error) {
+                if evt["value"] == "30" {
+                    return nil, nil
+                }
+                return evt, nil
+            }),
+            etl.TransformFunc(func(evt etl.Event) (etl.Event, error) {
+                evt["source"] = "embedded"
+                return evt, nil
+            }),
+        },
+    }
+    out := &recordingSink{}
+    sum, err := etl.Run(context.Background(), cfg, out, opts)
+    if err != nil {
+        t.Fatalf("Run: %v", err)
+    }
+
+    sender := crypto.PubkeyToAddress(senderKey.PublicKey).Hex()
+    var values []string
+    for _, evt := range out.events {
+        values = append(values, fmt.Sprint(evt["value"]))
+        if evt["event_name"] != "Transfer" || evt["contract_name"] != "Token" || evt["source"] != "embedded" {
+            t.Errorf("event = %v", evt)
+        }
+        block := evt["block_number"].(uint64)
+        if evt["timestamp"] != 1_700_000_000+block*12 || evt["tx_from"] != sender {
+            t.Errorf("event of block %d: timestamp = %v, tx_from = %v", block, evt["timestamp"], evt["tx_from"])
+        }
+    }
+    if strings.Join(values, ",") != "10,20,40" {
+        t.Errorf("values = %v, want 10, 20 and 40", values)
+    }
+    if out.flushes == 0 {
+        t.Error("the sink was not flushed")
+    }
+    // The configured csv storage is not used: no manifest is written for it.
+    if _, err := os.Stat(filepath.Join("out", "manifest.json")); !os.IsNotExist(err) {
+        t.Errorf("manifest written for the unused csv storage: %v", err)
+    }
+
+    if sum == nil || sum.TotalEvents != 3 || sum.Events["Transfer"] != 3 || sum.StartBlock != 0 || sum.EndBlock != 29 {
+        t.Errorf("summary = %+v", sum)
+    }
+    if len(progress) != 3 || progress[2].CurrentBlock != 29 || progress[2].EventsWritten != 3 {
+        t.Errorf("progress = %+v, want one snapshot per range", progress)
+    }
+}
+
+func TestRunStopsOnPermanentSinkError(t *testing.T) {
+    node := startNode(9, transferLog(3, 0, 10))
+    defer node.Close()
+    cfg := loadConfig(t, node.URL, "")
+
+    out := &recordingSink{err: etl.Permanent(errors.New("table is read-only"))}
+    if _, err := etl.Run(context.Background(), cfg, out); err == nil || !strings.Contains(err.Error(), "table is read-only") {
+        t.Fatalf("Run = %v, want the sink error", err)
+    }
+    if out.writes != 1 {
+        t.Errorf("%d writes, want a permanent error not to be retried", out.writes)
+    }
+}
+
+func TestRunRejectsInvalidCalls(t *testing.T) {
+    node := startNode(9)
+    defer node.Close()
+    cfg := loadConfig(t, node.URL, "")
+
+    if _, err := etl.Run(context.Background(), cfg, nil); err == nil || !strings.Contains(err.Error(), "requires a sink") {
+        t.Errorf("Run without sink = %v", err)
+    }
+
+    // A multi-chain config has to be expanded first.
+    dir := t.TempDir()
+    if _, err := writeConfig(dir, node.URL, ""); err != nil {
+        t.Fatal(err)
+    }
+    yaml := `chains:
+  - name: mainnet
+    rpc_url: ` + node.URL + `
+    contracts:
+      - name: Token
+        address: "` + tokenAddress.Hex() + `"
+        abi: token.json
+        events: [Transfer]
+` + storageSection
+    path := filepath.Join(dir, "chains.yaml")
+    if err := os.WriteFile(path, []byte(yaml), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    multi, err := etl.LoadConfig(path)
+    if err != nil {
+        t.Fatalf("LoadConfig: %v", err)
+    }
+    if _, err := etl.Run(context.Background(), multi, &recordingSink{}); err == nil || !strings.Contains(err.Error(), "single-chain") {
+        t.Errorf("Run of a multi-chain config = %v", err)
+    }
+    chains := multi.ChainConfigs()
+    if len(chains) != 1 {
+        t.Fatalf("ChainConfigs = %d configs", len(chains))
+    }
+    if _, err := etl.Run(context.Background(), chains[0], &recordingSink{}); err != nil {
+        t.Errorf("Run of an expanded chain: %v", err)
+    }
+}
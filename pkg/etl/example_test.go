@@ -0,0 +1,47 @@
+package etl_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"etl-web3/pkg/etl"
+)
+
+// printSink is a custom sink printing every transfer.
+type printSink struct{}
+
+func (printSink) Write(evt etl.Event) error {
+    fmt.Println(evt["event_name"], evt["block_number"], evt["value"])
+    return nil
+}
+
+// Example embeds the indexer in a program writing to its own sink.
+func Example() {
+    node := startNode(29, transferLog(3, 0, 10), transferLog(25, 0, 40))
+    defer node.Close()
+    dir, err := os.MkdirTemp("", "etl-example")
+    if err != nil {
+        log.Fatal(err)
+    }
+    defer os.RemoveAll(dir)
+    path, err := writeConfig(dir, node.URL, "")
+    if err != nil {
+        log.Fatal(err)
+    }
+
+    cfg, err := etl.LoadConfig(path)
+    if err != nil {
+        log.Fatal(err)
+    }
+    summary, err := etl.Run(context.Background(), cfg, printSink{})
+    if err != nil {
+        log.Fatal(err)
+    }
+    fmt.Println("events:", summary.TotalEvents)
+    // Output:
+    // Transfer 3 10
+    // Transfer 25 40
+    // events: 2
+}